@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// acceleratorResources are the extended resources advertised by accelerator device plugins
+var acceleratorResources = []corev1.ResourceName{
+	"nvidia.com/gpu",
+	"amd.com/gpu",
+	"aws.amazon.com/neuron",
+	"google.com/tpu",
+}
+
+// acceleratorLabels are the node labels naming the accelerator model, in order of preference.
+// A node carrying one is expected to advertise an accelerator resource.
+var acceleratorLabels = []string{
+	"nvidia.com/gpu.product",               // NVIDIA GPU feature discovery
+	"cloud.google.com/gke-accelerator",     // GKE
+	"cloud.google.com/gke-tpu-accelerator", // GKE TPU
+	"k8s.amazonaws.com/accelerator",        // EKS
+	"accelerator",                          // AKS GPU node pools
+}
+
+// AcceleratorPool is the accelerator capacity of one node pool
+type AcceleratorPool struct {
+	Pool          string   `json:"pool"`
+	Resource      string   `json:"resource"`
+	Model         string   `json:"model,omitempty"`
+	InstanceTypes []string `json:"instanceTypes,omitempty"`
+	Nodes         int      `json:"nodes"`
+	Allocatable   int64    `json:"allocatable"`
+}
+
+// DevicePlugin is the health of a device plugin DaemonSet
+type DevicePlugin struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Desired   int32  `json:"desired"`
+	Ready     int32  `json:"ready"`
+}
+
+// AcceleratorInventory lists a cluster's accelerator node pools and device plugins
+type AcceleratorInventory struct {
+	Pools         []AcceleratorPool `json:"pools,omitempty"`
+	DevicePlugins []DevicePlugin    `json:"devicePlugins,omitempty"`
+	Warnings      []string          `json:"warnings,omitempty"`
+}
+
+// Total returns the number of allocatable accelerators across all pools
+func (i *AcceleratorInventory) Total() int64 {
+	var total int64
+	for _, pool := range i.Pools {
+		total += pool.Allocatable
+	}
+	return total
+}
+
+// DiscoverAccelerators groups nodes advertising accelerator resources by pool and reports the
+// health of device plugin DaemonSets. Nodes labelled with an accelerator model but advertising
+// no accelerators, typically because their device plugin is not running, are warned about.
+func DiscoverAccelerators(ctx context.Context, clientset kubernetes.Interface) (*AcceleratorInventory, error) {
+	inventory := &AcceleratorInventory{}
+	pools := map[string]*AcceleratorPool{}
+	instanceTypes := map[string]map[string]bool{}
+
+	err := EachNode(ctx, clientset, metav1.ListOptions{}, func(node *corev1.Node) error {
+		model := acceleratorModel(node)
+		found := false
+		for _, resource := range acceleratorResources {
+			quantity, ok := node.Status.Allocatable[resource]
+			if !ok || quantity.Value() == 0 {
+				continue
+			}
+			found = true
+			key := nodePoolName(node) + "/" + string(resource)
+			pool, ok := pools[key]
+			if !ok {
+				pool = &AcceleratorPool{Pool: nodePoolName(node), Resource: string(resource), Model: model}
+				pools[key] = pool
+				instanceTypes[key] = map[string]bool{}
+			}
+			pool.Nodes++
+			pool.Allocatable += quantity.Value()
+			if instanceType := node.Labels[corev1.LabelInstanceTypeStable]; instanceType != "" {
+				instanceTypes[key][instanceType] = true
+			}
+		}
+		if !found && model != "" {
+			inventory.Warnings = append(inventory.Warnings,
+				fmt.Sprintf("node %s is labelled with accelerator %s but advertises none", node.Name, model))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for key, pool := range pools {
+		for instanceType := range instanceTypes[key] {
+			pool.InstanceTypes = append(pool.InstanceTypes, instanceType)
+		}
+		sort.Strings(pool.InstanceTypes)
+		inventory.Pools = append(inventory.Pools, *pool)
+	}
+	sort.Slice(inventory.Pools, func(i, j int) bool {
+		if inventory.Pools[i].Pool != inventory.Pools[j].Pool {
+			return inventory.Pools[i].Pool < inventory.Pools[j].Pool
+		}
+		return inventory.Pools[i].Resource < inventory.Pools[j].Resource
+	})
+
+	err = eachObject(ctx, "daemonsets", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.AppsV1().DaemonSets("").List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		ds := obj.(*appsv1.DaemonSet)
+		if !strings.Contains(ds.Name, "device-plugin") {
+			return nil
+		}
+		inventory.DevicePlugins = append(inventory.DevicePlugins, DevicePlugin{
+			Namespace: ds.Namespace,
+			Name:      ds.Name,
+			Desired:   ds.Status.DesiredNumberScheduled,
+			Ready:     ds.Status.NumberReady,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(inventory.Pools) > 0 && len(inventory.DevicePlugins) == 0 {
+		inventory.Warnings = append(inventory.Warnings, "no device plugin DaemonSet found")
+	}
+	return inventory, nil
+}
+
+// acceleratorModel returns the accelerator model a node is labelled with, if any
+func acceleratorModel(node *corev1.Node) string {
+	for _, label := range acceleratorLabels {
+		if model := node.Labels[label]; model != "" {
+			return model
+		}
+	}
+	return ""
+}
+
+// PrintAcceleratorInventory renders a cluster's accelerator pools and device plugins
+func PrintAcceleratorInventory(inventory *AcceleratorInventory) {
+	if len(inventory.Pools) == 0 {
+		fmt.Println("  No accelerator nodes")
+	}
+	for _, pool := range inventory.Pools {
+		model := ""
+		if pool.Model != "" {
+			model = " " + pool.Model
+		}
+		fmt.Printf("  %s: %d x %s%s on %d node(s) [%s]\n", pool.Pool, pool.Allocatable, pool.Resource, model, pool.Nodes, strings.Join(pool.InstanceTypes, ", "))
+	}
+	for _, plugin := range inventory.DevicePlugins {
+		mark := "✓"
+		if plugin.Ready < plugin.Desired {
+			mark = "✗"
+		}
+		fmt.Printf("  %s device plugin %s/%s: %d/%d ready\n", mark, plugin.Namespace, plugin.Name, plugin.Ready, plugin.Desired)
+	}
+	for _, warning := range inventory.Warnings {
+		fmt.Printf("  ⚠ %s\n", warning)
+	}
+}
+
+// printAcceleratorSummary prints the accelerator count across the fleet
+func printAcceleratorSummary(results []FleetResult) {
+	var total int64
+	clusters := 0
+	for _, result := range results {
+		if inventory, ok := result.Output.(*AcceleratorInventory); ok && len(inventory.Pools) > 0 {
+			total += inventory.Total()
+			clusters++
+		}
+	}
+	fmt.Printf("\n%d accelerator(s) on %d of %d clusters\n", total, clusters, len(results))
+}
+
+// CheckAccelerators reports accelerator node pools and fails when a device plugin is not fully
+// ready or accelerator nodes advertise no capacity. Clusters without accelerators pass.
+func CheckAccelerators(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "accelerators"}
+
+	inventory, err := DiscoverAccelerators(ctx, client.Clientset())
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	problems := len(inventory.Warnings)
+	for _, pool := range inventory.Pools {
+		result.Details = append(result.Details, fmt.Sprintf("%s: %d x %s on %d node(s)", pool.Pool, pool.Allocatable, pool.Resource, pool.Nodes))
+	}
+	for _, plugin := range inventory.DevicePlugins {
+		if plugin.Ready < plugin.Desired {
+			problems++
+			result.Details = append(result.Details, fmt.Sprintf("✗ device plugin %s/%s: %d/%d ready", plugin.Namespace, plugin.Name, plugin.Ready, plugin.Desired))
+		} else {
+			result.Details = append(result.Details, fmt.Sprintf("✓ device plugin %s/%s: %d/%d ready", plugin.Namespace, plugin.Name, plugin.Ready, plugin.Desired))
+		}
+	}
+	for _, warning := range inventory.Warnings {
+		result.Details = append(result.Details, "✗ "+warning)
+	}
+
+	switch {
+	case problems > 0:
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%d accelerator problem(s)", problems)
+	case len(inventory.Pools) == 0:
+		result.Status = CheckPass
+		result.Message = "no accelerator nodes"
+	default:
+		result.Status = CheckPass
+		result.Message = fmt.Sprintf("%d accelerator(s) in %d pool(s), device plugins ready", inventory.Total(), len(inventory.Pools))
+	}
+	return result
+}
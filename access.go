@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// AccessMapping is one cloud identity's way into a cluster and what it can do there
+type AccessMapping struct {
+	Source    string   `json:"source"`    // e.g. "EKS access entry", "aws-auth", "GCP IAM", "Azure RBAC"
+	Principal string   `json:"principal"` // IAM ARN, GCP member or Azure AD object ID
+	Username  string   `json:"username,omitempty"`
+	Groups    []string `json:"groups,omitempty"` // Kubernetes groups the principal is mapped to
+	// Access are the cloud-side permissions: EKS access policies, IAM roles or Azure role definitions
+	Access []string `json:"access,omitempty"`
+	Scope  string   `json:"scope,omitempty"`
+	// Bindings are the Kubernetes RBAC roles bound to the mapped username or groups
+	Bindings []string `json:"bindings,omitempty"`
+}
+
+// accessMapper is implemented by clients that can list how their cloud's identities map into
+// the cluster: EKS access entries and aws-auth, GCP IAM bindings, AKS admin groups and Azure RBAC
+type accessMapper interface {
+	CloudAccessMappings(ctx context.Context) ([]AccessMapping, error)
+}
+
+// azureObjectID matches the Azure AD object IDs AKS uses as Kubernetes user and group names
+var azureObjectID = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// MapClusterAccess answers "who can access this cluster and as what": the provider's cloud
+// identity mappings, each with the Kubernetes RBAC roles bound to the username and groups it
+// maps to
+func MapClusterAccess(ctx context.Context, client ClusterClient) ([]AccessMapping, error) {
+	mapper, ok := client.(accessMapper)
+	if !ok {
+		return nil, fmt.Errorf("%s clients cannot map cloud identities", client.Identity().Provider)
+	}
+	mappings, err := mapper.CloudAccessMappings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bindings, err := rbacBindings(ctx, client.Clientset())
+	if err != nil {
+		return nil, err
+	}
+	for i := range mappings {
+		mapping := &mappings[i]
+		if mapping.Username != "" {
+			mapping.Bindings = append(mapping.Bindings, bindings[rbacv1.UserKind+":"+mapping.Username]...)
+		}
+		for _, group := range mapping.Groups {
+			mapping.Bindings = append(mapping.Bindings, bindings[rbacv1.GroupKind+":"+group]...)
+		}
+	}
+	return mappings, nil
+}
+
+// rbacBindings indexes the roles bound by RoleBindings and ClusterRoleBindings by subject
+// ("User:alice", "Group:devs"), e.g. "ClusterRole/view" or "ClusterRole/edit in payments"
+func rbacBindings(ctx context.Context, clientset kubernetes.Interface) (map[string][]string, error) {
+	bindings := map[string][]string{}
+	add := func(subjects []rbacv1.Subject, role rbacv1.RoleRef, namespace string) {
+		bound := role.Kind + "/" + role.Name
+		if namespace != "" {
+			bound += " in " + namespace
+		}
+		for _, subject := range subjects {
+			if subject.Kind == rbacv1.UserKind || subject.Kind == rbacv1.GroupKind {
+				key := subject.Kind + ":" + subject.Name
+				bindings[key] = append(bindings[key], bound)
+			}
+		}
+	}
+
+	err := eachObject(ctx, "clusterrolebindings", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.RbacV1().ClusterRoleBindings().List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		binding := obj.(*rbacv1.ClusterRoleBinding)
+		add(binding.Subjects, binding.RoleRef, "")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = eachObject(ctx, "rolebindings", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.RbacV1().RoleBindings("").List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		binding := obj.(*rbacv1.RoleBinding)
+		add(binding.Subjects, binding.RoleRef, binding.Namespace)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for key := range bindings {
+		sort.Strings(bindings[key])
+	}
+	return bindings, nil
+}
+
+// awsAuthMappings parses the mapRoles and mapUsers of the kube-system/aws-auth ConfigMap, the
+// IAM-to-Kubernetes mapping EKS reads in the CONFIG_MAP authentication modes. A missing
+// ConfigMap maps nothing.
+func awsAuthMappings(ctx context.Context, clientset kubernetes.Interface) ([]AccessMapping, error) {
+	configMap, err := clientset.CoreV1().ConfigMaps("kube-system").Get(ctx, "aws-auth", metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get aws-auth ConfigMap: %w", err)
+	}
+
+	type awsAuthEntry struct {
+		RoleARN  string   `json:"rolearn"`
+		UserARN  string   `json:"userarn"`
+		Username string   `json:"username"`
+		Groups   []string `json:"groups"`
+	}
+	var mappings []AccessMapping
+	for _, key := range []string{"mapRoles", "mapUsers"} {
+		var entries []awsAuthEntry
+		if err := yaml.Unmarshal([]byte(configMap.Data[key]), &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse aws-auth %s: %w", key, err)
+		}
+		for _, entry := range entries {
+			principal := entry.RoleARN
+			if principal == "" {
+				principal = entry.UserARN
+			}
+			mappings = append(mappings, AccessMapping{Source: "aws-auth " + key, Principal: principal, Username: entry.Username, Groups: entry.Groups})
+		}
+	}
+	return mappings, nil
+}
+
+// azureADBindings returns the RBAC subjects named by Azure AD object IDs, which is how AKS
+// clusters with Azure AD integration grant Kubernetes access to Azure AD users and groups
+func azureADBindings(ctx context.Context, clientset kubernetes.Interface) ([]AccessMapping, error) {
+	bindings, err := rbacBindings(ctx, clientset)
+	if err != nil {
+		return nil, err
+	}
+	var mappings []AccessMapping
+	for key := range bindings {
+		kind, name, _ := strings.Cut(key, ":")
+		if !azureObjectID.MatchString(name) {
+			continue
+		}
+		mapping := AccessMapping{Source: "Azure AD " + strings.ToLower(kind) + " binding", Principal: name}
+		if kind == rbacv1.UserKind {
+			mapping.Username = name
+		} else {
+			mapping.Groups = []string{name}
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
+
+// sortAccessMappings orders mappings by source, then principal
+func sortAccessMappings(mappings []AccessMapping) {
+	sort.Slice(mappings, func(i, j int) bool {
+		if mappings[i].Source != mappings[j].Source {
+			return mappings[i].Source < mappings[j].Source
+		}
+		return mappings[i].Principal < mappings[j].Principal
+	})
+}
+
+// PrintAccessMappings prints each identity mapping with the Kubernetes identity it becomes and
+// the access it gets
+func PrintAccessMappings(mappings []AccessMapping) {
+	if len(mappings) == 0 {
+		fmt.Println("  No cloud identity mappings found")
+		return
+	}
+	source := ""
+	for _, mapping := range mappings {
+		if mapping.Source != source {
+			source = mapping.Source
+			fmt.Printf("  %s:\n", source)
+		}
+		fmt.Printf("    %s\n", mapping.Principal)
+		var identity []string
+		if mapping.Username != "" {
+			identity = append(identity, "user "+mapping.Username)
+		}
+		if len(mapping.Groups) > 0 {
+			identity = append(identity, "groups "+strings.Join(mapping.Groups, ", "))
+		}
+		if len(identity) > 0 {
+			fmt.Printf("      as:       %s\n", strings.Join(identity, "; "))
+		}
+		if len(mapping.Access) > 0 {
+			scope := ""
+			if mapping.Scope != "" {
+				scope = " (" + mapping.Scope + ")"
+			}
+			fmt.Printf("      access:   %s%s\n", strings.Join(mapping.Access, ", "), scope)
+		}
+		if len(mapping.Bindings) > 0 {
+			fmt.Printf("      bindings: %s\n", strings.Join(mapping.Bindings, ", "))
+		}
+	}
+}
@@ -2,29 +2,83 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v4"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// aksAADServerAppID is the well-known application ID of the AKS AAD server used by managed AAD.
+// Clouds or tenants using another application set AKS_AAD_SERVER_APP_ID (or azureAADServerAppID
+// in the fleet config).
+const aksAADServerAppID = "6dae42f8-4368-4678-94ff-3960e28e3630"
+
+// AKSAuthStrategy is how the tool authenticates to an AKS API server
+type AKSAuthStrategy string
+
+const (
+	// AKSAuthAzureAD uses an Azure AD token, for clusters with managed or legacy AAD integration
+	AKSAuthAzureAD AKSAuthStrategy = "azure-ad"
+	// AKSAuthLocalAccount uses the cluster's local user credentials, for clusters without AAD
+	AKSAuthLocalAccount AKSAuthStrategy = "local-account"
 )
 
 // AKSClient wraps the AKS and Kubernetes clients
 type AKSClient struct {
 	aksClient      *armcontainerservice.ManagedClustersClient
+	k8sMu          sync.Mutex // guards k8sClient and restConfig
 	k8sClient      *kubernetes.Clientset
+	restConfig     *rest.Config
 	clusterName    string
 	resourceGroup  string
 	subscriptionID string
+	location       string
 	credential     azcore.TokenCredential
+	authStrategy   AKSAuthStrategy
+	azureRBAC      bool
+	options        AKSClientOptions
+}
+
+// AKSClientOptions holds optional AKS connection settings
+type AKSClientOptions struct {
+	// AADServerAppID overrides the AKS AAD server application whose token audience the API
+	// server accepts; by default it is chosen from the cluster's AAD profile and the cloud
+	AADServerAppID string
+	// DeferKubernetes skips connecting to the Kubernetes API server in the constructor, so
+	// cloud-only operations work while it is unreachable; see ConnectKubernetes
+	DeferKubernetes bool
+	// WaitForReady is how long connecting waits for a cluster that is being created or updated
+	// to become ready, polling with backoff; zero fails immediately
+	WaitForReady time.Duration
+	// UserAgent overrides DefaultUserAgent in Kubernetes API requests
+	UserAgent string
+	// Headers are added to every Kubernetes API request, e.g. for an API gateway in front of
+	// the API server
+	Headers map[string]string
+	// Impersonate makes Kubernetes API requests act as another user and groups, e.g. to verify
+	// what they can see; the connecting identity needs the impersonate RBAC verb
+	Impersonate rest.ImpersonationConfig
 }
 
 // NewAKSClient creates a new AKS client
@@ -35,28 +89,76 @@ func NewAKSClient(clusterName, resourceGroup, subscriptionID string) (*AKSClient
 		return nil, fmt.Errorf("failed to create Azure credential: %w", err)
 	}
 
+	return NewAKSClientWithCredential(clusterName, resourceGroup, subscriptionID, cred)
+}
+
+// NewAKSClientWithCredential creates a new AKS client that authenticates with cred instead of
+// the credential resolved from the environment
+func NewAKSClientWithCredential(clusterName, resourceGroup, subscriptionID string, cred azcore.TokenCredential) (*AKSClient, error) {
+	return NewAKSClientWithOptions(clusterName, resourceGroup, subscriptionID, cred, AKSClientOptions{})
+}
+
+// NewAKSClientWithOptions creates a new AKS client that authenticates with cred and applies opts
+func NewAKSClientWithOptions(clusterName, resourceGroup, subscriptionID string, cred azcore.TokenCredential, opts AKSClientOptions) (*AKSClient, error) {
 	// Create AKS client
-	aksClient, err := armcontainerservice.NewManagedClustersClient(subscriptionID, cred, nil)
+	aksClient, err := newManagedClustersClient(subscriptionID, cred)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create AKS client: %w", err)
 	}
 
+	if resourceGroup == "" {
+		resourceGroup, err = locateAKSCluster(context.Background(), aksClient, clusterName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	client := &AKSClient{
 		aksClient:      aksClient,
 		clusterName:    clusterName,
 		resourceGroup:  resourceGroup,
 		subscriptionID: subscriptionID,
 		credential:     cred,
+		options:        opts,
 	}
 
-	// Initialize Kubernetes client
-	if err := client.initKubernetesClient(); err != nil {
-		return nil, fmt.Errorf("failed to initialize Kubernetes client: %w", err)
+	if !opts.DeferKubernetes {
+		if err := client.ConnectKubernetes(context.Background()); err != nil {
+			return nil, err
+		}
 	}
 
 	return client, nil
 }
 
+// ConnectKubernetes connects to the cluster's API server unless already connected. A failed
+// attempt is retried by the next call. Until it succeeds the client's location, auth strategy
+// and Azure RBAC setting are unknown.
+func (c *AKSClient) ConnectKubernetes(ctx context.Context) error {
+	c.k8sMu.Lock()
+	defer c.k8sMu.Unlock()
+	if c.k8sClient != nil {
+		return nil
+	}
+	if err := c.initKubernetesClient(ctx); err != nil {
+		return fmt.Errorf("failed to initialize Kubernetes client: %w", err)
+	}
+	return nil
+}
+
+// armClientOptions returns ARM client options for the configured cloud that apply the ARM
+// rate limiter and the cloud API timeout
+func armClientOptions() *arm.ClientOptions {
+	opts := azureClientOptions()
+	opts.PerCallPolicies = []policy.Policy{azureAuditPolicy{}, azureReadOnlyPolicy{}, azureRateLimitPolicy{}, azureTimeoutPolicy{}}
+	return &arm.ClientOptions{ClientOptions: opts}
+}
+
+// newManagedClustersClient creates an ARM managed clusters client subject to the ARM rate limiter
+func newManagedClustersClient(subscriptionID string, cred azcore.TokenCredential) (*armcontainerservice.ManagedClustersClient, error) {
+	return armcontainerservice.NewManagedClustersClient(subscriptionID, cred, armClientOptions())
+}
+
 // createAzureCredential creates Azure credentials using various authentication methods
 func createAzureCredential() (azcore.TokenCredential, error) {
 	// Try different credential types in order of preference
@@ -67,17 +169,40 @@ func createAzureCredential() (azcore.TokenCredential, error) {
 	tenantID := os.Getenv("AZURE_TENANT_ID")
 
 	if clientID != "" && clientSecret != "" && tenantID != "" {
-		fmt.Println("Using Azure Service Principal authentication")
-		cred, err := azidentity.NewClientSecretCredential(tenantID, clientID, clientSecret, nil)
+		Infof("Using Azure Service Principal authentication")
+		cred, err := azidentity.NewClientSecretCredential(tenantID, clientID, clientSecret,
+			&azidentity.ClientSecretCredentialOptions{ClientOptions: azureClientOptions()})
 		if err != nil {
 			return nil, fmt.Errorf("failed to create service principal credential: %w", err)
 		}
 		return cred, nil
 	}
 
-	// 2. Try Managed Identity (when running in Azure)
+	// 2. Try a Service Principal secret mounted from a Kubernetes Secret, reloaded on rotation
+	if secretPath, ok := credentialFile("AZURE_CLIENT_SECRET"); ok && clientSecret == "" {
+		tenantID, clientID = credentialValue("AZURE_TENANT_ID"), credentialValue("AZURE_CLIENT_ID")
+		if tenantID != "" && clientID != "" {
+			Infof("Using Azure Service Principal authentication with the secret mounted at %s", secretPath)
+			return newRotatingAzureCredential(tenantID, clientID, secretPath)
+		}
+	}
+
+	// 3. Try workload identity (a projected service account token federated with Azure AD)
+	if tokenFile := os.Getenv("AZURE_FEDERATED_TOKEN_FILE"); tokenFile != "" {
+		Infof("Using Azure workload identity authentication")
+		cred, err := azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+			ClientOptions: azureClientOptions(),
+			TokenFilePath: tokenFile,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create workload identity credential: %w", err)
+		}
+		return cred, nil
+	}
+
+	// 4. Try Managed Identity (when running in Azure)
 	if os.Getenv("AZURE_USE_MSI") == "true" {
-		fmt.Println("Using Azure Managed Identity authentication")
+		Infof("Using Azure Managed Identity authentication")
 		cred, err := azidentity.NewManagedIdentityCredential(nil)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create managed identity credential: %w", err)
@@ -85,8 +210,8 @@ func createAzureCredential() (azcore.TokenCredential, error) {
 		return cred, nil
 	}
 
-	// 3. Try Azure CLI credentials (default)
-	fmt.Println("Using Azure CLI authentication")
+	// 5. Try Azure CLI credentials (default)
+	Infof("Using Azure CLI authentication")
 	cred, err := azidentity.NewAzureCLICredential(nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Azure CLI credential: %w", err)
@@ -95,20 +220,83 @@ func createAzureCredential() (azcore.TokenCredential, error) {
 	return cred, nil
 }
 
+// selectAKSAuthStrategy picks the authentication strategy from the cluster's AAD profile and
+// local account setting, returning the AAD token scope when Azure AD is used. serverAppID,
+// when set, overrides the AAD server application the scope is built from.
+func selectAKSAuthStrategy(props *armcontainerservice.ManagedClusterProperties, serverAppID string) (AKSAuthStrategy, string, error) {
+	localAccountsDisabled := props.DisableLocalAccounts != nil && *props.DisableLocalAccounts
+
+	aad := props.AADProfile
+	if aad == nil {
+		if localAccountsDisabled {
+			return "", "", fmt.Errorf("cluster has local accounts disabled but no Azure AD integration; there is no way to authenticate")
+		}
+		return AKSAuthLocalAccount, "", nil
+	}
+
+	if serverAppID != "" {
+		return AKSAuthAzureAD, serverAppID + "/.default", nil
+	}
+
+	// Managed AAD always uses the shared AKS server application
+	if aad.Managed != nil && *aad.Managed {
+		return AKSAuthAzureAD, aksAADServerAppID + "/.default", nil
+	}
+
+	// Legacy AAD integration uses the customer's own server application
+	if aad.ServerAppID != nil && *aad.ServerAppID != "" {
+		return AKSAuthAzureAD, *aad.ServerAppID + "/.default", nil
+	}
+
+	return AKSAuthAzureAD, aksAADServerAppID + "/.default", nil
+}
+
+// initKubernetesClientWithLocalAccount initializes the Kubernetes client from the cluster's local
+// user credentials, which embed a client certificate or token for clusters without AAD
+func (c *AKSClient) initKubernetesClientWithLocalAccount(ctx context.Context) error {
+	userCredResult, err := c.aksClient.ListClusterUserCredentials(ctx, c.resourceGroup, c.clusterName, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list cluster user credentials: %w", err)
+	}
+	if len(userCredResult.Kubeconfigs) == 0 || userCredResult.Kubeconfigs[0].Value == nil {
+		return fmt.Errorf("no kubeconfig returned in cluster user credentials")
+	}
+
+	kubeConfig, err := clientcmd.RESTConfigFromKubeConfig(userCredResult.Kubeconfigs[0].Value)
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster user kubeconfig: %w", err)
+	}
+	applyRequestHeaders(kubeConfig, c.options.UserAgent, c.options.Headers)
+	applyReadOnlyGuard(kubeConfig)
+	applyAuditLog(kubeConfig, c.Identity)
+	kubeConfig.Impersonate = c.options.Impersonate
+	applyKubernetesTimeout(kubeConfig)
+
+	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes clientset: %w", err)
+	}
+
+	c.k8sClient = clientset
+	c.restConfig = kubeConfig
+	Infof("Successfully connected using local account credentials")
+	return nil
+}
+
 // initKubernetesClientWithAzureAD initializes the Kubernetes client using Azure AD authentication
-func (c *AKSClient) initKubernetesClientWithAzureAD(cluster armcontainerservice.ManagedClustersClientGetResponse) error {
+func (c *AKSClient) initKubernetesClientWithAzureAD(ctx context.Context, cluster armcontainerservice.ManagedClustersClientGetResponse, scope string) error {
 	if cluster.Properties == nil || cluster.Properties.Fqdn == nil {
 		return fmt.Errorf("cluster FQDN is not available")
 	}
 
 	// Get Azure AD token for Kubernetes API
-	token, err := c.getAzureADToken()
+	token, err := c.getAzureADToken(scope)
 	if err != nil {
 		return fmt.Errorf("failed to get Azure AD token: %w", err)
 	}
 
 	// Get CA certificate data from cluster
-	caCertData, err := c.getClusterCACertificate()
+	caCertData, err := c.getClusterCACertificate(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get CA certificate: %w", err)
 	}
@@ -122,6 +310,16 @@ func (c *AKSClient) initKubernetesClientWithAzureAD(cluster armcontainerservice.
 			Insecure: false, // Use secure TLS verification with CA certificate
 		},
 	}
+	applyRequestHeaders(kubeConfig, c.options.UserAgent, c.options.Headers)
+	applyReadOnlyGuard(kubeConfig)
+	applyAuditLog(kubeConfig, c.Identity)
+	kubeConfig.Impersonate = c.options.Impersonate
+	applyKubernetesTimeout(kubeConfig)
+	// The credential caches the token until shortly before it expires, so a refresh only helps
+	// once the token has expired; a token rejected earlier is returned again and not resent
+	applyTokenRefresh(kubeConfig, func(ctx context.Context) (string, error) {
+		return c.getAzureADToken(scope)
+	})
 
 	// Create Kubernetes clientset
 	clientset, err := kubernetes.NewForConfig(kubeConfig)
@@ -130,19 +328,27 @@ func (c *AKSClient) initKubernetesClientWithAzureAD(cluster armcontainerservice.
 	}
 
 	c.k8sClient = clientset
-	fmt.Println("Successfully connected using Azure AD token authentication (secure)")
+	c.restConfig = kubeConfig
+	Infof("Successfully connected using Azure AD token authentication (secure)")
 	return nil
 }
 
 // getAzureADToken gets an Azure AD token for Kubernetes API access
-func (c *AKSClient) getAzureADToken() (string, error) {
+func (c *AKSClient) getAzureADToken(scope string) (string, error) {
 	// Use the same credential that we used for the AKS client
 	ctx := context.Background()
 
-	// Get token for Kubernetes API (using the standard AKS server application scope)
-	token, err := c.credential.GetToken(ctx, policy.TokenRequestOptions{
-		Scopes: []string{"6dae42f8-4368-4678-94ff-3960e28e3630/.default"}, // Azure Kubernetes Service scope
+	// Get token for Kubernetes API using the scope of the cluster's AAD server application
+	step := progress.Start("Acquiring Azure AD token")
+	var token azcore.AccessToken
+	err := runPhase(ctx, PhaseAuth, func(ctx context.Context) error {
+		var err error
+		token, err = c.credential.GetToken(ctx, policy.TokenRequestOptions{
+			Scopes: []string{scope},
+		})
+		return err
 	})
+	step.Done()
 	if err != nil {
 		return "", fmt.Errorf("failed to get Azure AD token: %w", err)
 	}
@@ -151,9 +357,9 @@ func (c *AKSClient) getAzureADToken() (string, error) {
 }
 
 // getClusterCACertificate extracts the CA certificate from the AKS cluster
-func (c *AKSClient) getClusterCACertificate() ([]byte, error) {
+func (c *AKSClient) getClusterCACertificate(ctx context.Context) ([]byte, error) {
 	// If admin credentials fail, try user credentials
-	userCredResult, err := c.aksClient.ListClusterUserCredentials(context.Background(), c.resourceGroup, c.clusterName, nil)
+	userCredResult, err := c.aksClient.ListClusterUserCredentials(ctx, c.resourceGroup, c.clusterName, nil)
 	if err == nil && len(userCredResult.Kubeconfigs) > 0 && userCredResult.Kubeconfigs[0].Value != nil {
 		caCert, err := c.extractCACertFromKubeconfig(userCredResult.Kubeconfigs[0].Value)
 		if err == nil {
@@ -181,106 +387,440 @@ func (c *AKSClient) extractCACertFromKubeconfig(kubeconfigData []byte) ([]byte,
 	return nil, fmt.Errorf("no CA certificate found in kubeconfig")
 }
 
-// initKubernetesClient initializes the Kubernetes client using AKS cluster info
-func (c *AKSClient) initKubernetesClient() error {
-	ctx := context.Background()
+// aksTransitionalStates are the provisioning states an AKS cluster leaves on its own
+var aksTransitionalStates = map[string]bool{
+	"Creating":  true,
+	"Updating":  true,
+	"Upgrading": true,
+	"Starting":  true,
+	"Scaling":   true,
+}
+
+// aksClusterState classifies an AKS cluster by its power state, and while that is not Running
+// or not yet known, by its provisioning state
+func aksClusterState(props *armcontainerservice.ManagedClusterProperties) clusterState {
+	var power, provisioning string
+	if props.PowerState != nil && props.PowerState.Code != nil {
+		power = string(*props.PowerState.Code)
+	}
+	if props.ProvisioningState != nil {
+		provisioning = *props.ProvisioningState
+	}
+	if power == string(armcontainerservice.CodeRunning) {
+		return clusterState{Status: power, Ready: true}
+	}
+
+	status := power
+	switch {
+	case status == "" && provisioning == "":
+		status = "unknown"
+	case status == "":
+		status = provisioning
+	case provisioning != "" && provisioning != "Succeeded":
+		status = fmt.Sprintf("%s (%s)", power, provisioning)
+	}
+	return clusterState{Status: status, Transitional: aksTransitionalStates[provisioning]}
+}
 
+// initKubernetesClient initializes the Kubernetes client using AKS cluster info
+func (c *AKSClient) initKubernetesClient(ctx context.Context) error {
 	// Get AKS cluster information
-	cluster, err := c.aksClient.Get(ctx, c.resourceGroup, c.clusterName, nil)
+	var cluster armcontainerservice.ManagedClustersClientGetResponse
+	err := pollClusterReady(ctx, ProviderAKS, c.clusterName, c.options.WaitForReady, func(ctx context.Context) (clusterState, error) {
+		step := progress.Start(fmt.Sprintf("Getting AKS cluster %s", c.clusterName))
+		var err error
+		cluster, err = c.aksClient.Get(ctx, c.resourceGroup, c.clusterName, nil)
+		step.Done()
+		if err != nil {
+			return clusterState{}, fmt.Errorf("failed to get AKS cluster: %w", err)
+		}
+		if cluster.Properties == nil {
+			return clusterState{}, fmt.Errorf("cluster properties are nil")
+		}
+		return aksClusterState(cluster.Properties), nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get AKS cluster: %w", err)
+		return err
 	}
 
-	if cluster.Properties == nil {
-		return fmt.Errorf("cluster properties are nil")
+	if cluster.Location != nil {
+		c.location = *cluster.Location
 	}
 
-	// Check cluster status
-	if cluster.Properties.PowerState == nil || cluster.Properties.PowerState.Code == nil {
-		return fmt.Errorf("cluster power state is unknown")
+	strategy, scope, err := selectAKSAuthStrategy(cluster.Properties, c.options.AADServerAppID)
+	if err != nil {
+		return err
+	}
+	c.authStrategy = strategy
+
+	aad := cluster.Properties.AADProfile
+	c.azureRBAC = aad != nil && aad.EnableAzureRBAC != nil && *aad.EnableAzureRBAC
+	if c.azureRBAC {
+		Infof("Cluster uses Azure RBAC for Kubernetes authorization (requires an Azure Kubernetes Service RBAC role assignment)")
 	}
 
-	if *cluster.Properties.PowerState.Code != armcontainerservice.CodeRunning {
-		return fmt.Errorf("cluster %s is not running, current status: %s", c.clusterName, *cluster.Properties.PowerState.Code)
+	if strategy == AKSAuthLocalAccount {
+		Infof("Cluster has no Azure AD integration, using local account credentials...")
+		return c.initKubernetesClientWithLocalAccount(ctx)
 	}
 
-	fmt.Println("Using Azure AD token-based authentication...")
-	return c.initKubernetesClientWithAzureAD(cluster)
+	Infof("Using Azure AD token-based authentication...")
+	return c.initKubernetesClientWithAzureAD(ctx, cluster, scope)
 
 }
 
 // GetClusterInfo returns basic information about the AKS cluster
-func (c *AKSClient) GetClusterInfo() error {
+func (c *AKSClient) GetClusterInfo() (*ClusterInfo, error) {
 	ctx := context.Background()
 
 	cluster, err := c.aksClient.Get(ctx, c.resourceGroup, c.clusterName, nil)
 	if err != nil {
-		return fmt.Errorf("failed to get cluster info: %w", err)
+		return nil, fmt.Errorf("failed to get cluster info: %w", err)
 	}
 
 	props := cluster.Properties
 	if props == nil {
-		return fmt.Errorf("cluster properties are nil")
+		return nil, fmt.Errorf("cluster properties are nil")
 	}
 
-	fmt.Printf("AKS Cluster Information:\n")
-	fmt.Printf("  Name: %s\n", c.clusterName)
-	fmt.Printf("  Resource Group: %s\n", c.resourceGroup)
+	info := &ClusterInfo{
+		Name:     c.clusterName,
+		Provider: ProviderAKS,
+		Account:  c.subscriptionID,
+		Details:  map[string]string{"Resource Group": c.resourceGroup},
+	}
 
 	if props.PowerState != nil && props.PowerState.Code != nil {
-		fmt.Printf("  Status: %s\n", *props.PowerState.Code)
+		info.Status = string(*props.PowerState.Code)
 	}
 
 	if props.KubernetesVersion != nil {
-		fmt.Printf("  Kubernetes Version: %s\n", *props.KubernetesVersion)
+		info.Version = *props.KubernetesVersion
 	}
 
 	if props.Fqdn != nil {
-		fmt.Printf("  FQDN: %s\n", *props.Fqdn)
+		info.Endpoint = *props.Fqdn
 	}
 
 	if cluster.Location != nil {
-		fmt.Printf("  Location: %s\n", *cluster.Location)
+		info.Region = *cluster.Location
 	}
 
-	if props.AgentPoolProfiles != nil {
-		totalNodes := int32(0)
-		for _, pool := range props.AgentPoolProfiles {
-			if pool.Count != nil {
-				totalNodes += *pool.Count
-			}
+	var spotPools []string
+	for _, pool := range props.AgentPoolProfiles {
+		if pool.Count != nil {
+			info.NodeCount += int(*pool.Count)
 		}
-		fmt.Printf("  Total Nodes: %d\n", totalNodes)
+		if pool.ScaleSetPriority != nil && *pool.ScaleSetPriority == armcontainerservice.ScaleSetPrioritySpot && pool.Name != nil {
+			spotPools = append(spotPools, *pool.Name+" (spot)")
+		}
+	}
+	if len(spotPools) > 0 {
+		info.Details["Interruptible Node Pools"] = strings.Join(spotPools, ", ")
 	}
 
 	if props.NetworkProfile != nil && props.NetworkProfile.NetworkPlugin != nil {
-		fmt.Printf("  Network Plugin: %s\n", *props.NetworkProfile.NetworkPlugin)
+		info.Network = string(*props.NetworkProfile.NetworkPlugin)
 	}
 
-	return nil
+	info.Tags = azureTags(cluster.Tags)
+
+	info.Maintenance = c.getMaintenanceInfo(ctx, props, time.Now())
+	info.ReleaseChannel = "none"
+	if props.AutoUpgradeProfile != nil && props.AutoUpgradeProfile.UpgradeChannel != nil {
+		info.ReleaseChannel = string(*props.AutoUpgradeProfile.UpgradeChannel)
+	}
+
+	return info, nil
 }
 
-// ListPods lists all pods in the kube-system namespace
-func (c *AKSClient) ListPods() error {
-	namespace := "kube-system"
+// getMaintenanceInfo reports the auto-upgrade channels and the cluster's maintenance configurations.
+// If the configurations cannot be read only the channels are reported.
+func (c *AKSClient) getMaintenanceInfo(ctx context.Context, props *armcontainerservice.ManagedClusterProperties, now time.Time) *MaintenanceInfo {
+	info := &MaintenanceInfo{Channel: "none"}
+	if profile := props.AutoUpgradeProfile; profile != nil {
+		var channels []string
+		if profile.UpgradeChannel != nil {
+			channels = append(channels, "upgrade "+string(*profile.UpgradeChannel))
+		}
+		if profile.NodeOSUpgradeChannel != nil {
+			channels = append(channels, "node OS "+string(*profile.NodeOSUpgradeChannel))
+		}
+		if len(channels) > 0 {
+			info.Channel = strings.Join(channels, ", ")
+		}
+	}
+
+	configClient, err := armcontainerservice.NewMaintenanceConfigurationsClient(c.subscriptionID, c.credential, armClientOptions())
+	if err != nil {
+		Warnf("Failed to create maintenance configurations client: %v", err)
+		return info
+	}
+
+	pager := configClient.NewListByManagedClusterPager(c.resourceGroup, c.clusterName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			Warnf("Failed to list maintenance configurations: %v", err)
+			return info
+		}
+		for _, config := range page.Value {
+			if config == nil || config.Properties == nil {
+				continue
+			}
+			windows, exclusions := aksMaintenanceWindows(config.Name, config.Properties, now)
+			info.Windows = append(info.Windows, windows...)
+			info.Exclusions = append(info.Exclusions, exclusions...)
+		}
+	}
+
+	return info
+}
+
+// aksMaintenanceWindows converts a maintenance configuration into windows and exclusions.
+// The legacy "default" configuration uses hour slots per weekday; the managed auto-upgrade
+// configurations use a schedule with a start time, UTC offset and duration.
+func aksMaintenanceWindows(name *string, props *armcontainerservice.MaintenanceConfigurationProperties, now time.Time) ([]MaintenanceWindow, []MaintenanceWindow) {
+	configName := ""
+	if name != nil {
+		configName = *name
+	}
+
+	var windows, exclusions []MaintenanceWindow
+
+	for _, slot := range props.TimeInWeek {
+		if slot == nil || slot.Day == nil {
+			continue
+		}
+		window := MaintenanceWindow{Name: configName}
+		day := string(*slot.Day)
+		rule := ""
+		if len(day) >= 2 {
+			rule = "FREQ=WEEKLY;BYDAY=" + strings.ToUpper(day[:2])
+		}
+		var hours []string
+		for _, hour := range slot.HourSlots {
+			if hour == nil {
+				continue
+			}
+			hours = append(hours, fmt.Sprintf("%02d:00", *hour))
+			first := time.Date(now.Year(), now.Month(), now.Day(), int(*hour), 0, 0, 0, time.UTC).AddDate(0, 0, -7)
+			if next, ok := nextRecurrence(first, time.Hour, rule, now); ok && (window.Start.IsZero() || next.Before(window.Start)) {
+				window.Start, window.End = next, next.Add(time.Hour)
+			}
+		}
+		window.Schedule = fmt.Sprintf("%s at %s UTC (1h slots)", day, strings.Join(hours, ", "))
+		windows = append(windows, window)
+	}
+
+	for _, span := range props.NotAllowedTime {
+		if span == nil || span.Start == nil || span.End == nil || span.End.Before(now) {
+			continue
+		}
+		exclusions = append(exclusions, MaintenanceWindow{Name: configName, Start: *span.Start, End: *span.End})
+	}
+
+	if mw := props.MaintenanceWindow; mw != nil {
+		window := MaintenanceWindow{Name: configName}
+		window.Schedule, window.Start, window.End = aksScheduleWindow(mw, now)
+		windows = append(windows, window)
+
+		for _, span := range mw.NotAllowedDates {
+			if span == nil || span.Start == nil || span.End == nil {
+				continue
+			}
+			// Not-allowed dates are inclusive whole days
+			end := span.End.AddDate(0, 0, 1)
+			if end.Before(now) {
+				continue
+			}
+			exclusions = append(exclusions, MaintenanceWindow{Name: configName, Schedule: "not allowed", Start: *span.Start, End: end})
+		}
+	}
+
+	return windows, exclusions
+}
+
+// aksScheduleWindow describes a maintenance window schedule and computes its next occurrence
+// for daily and weekly schedules without an interval
+func aksScheduleWindow(mw *armcontainerservice.MaintenanceWindow, now time.Time) (string, time.Time, time.Time) {
+	startTime, offset, hours := "00:00", "+00:00", int32(4)
+	if mw.StartTime != nil {
+		startTime = *mw.StartTime
+	}
+	if mw.UTCOffset != nil && *mw.UTCOffset != "" {
+		offset = *mw.UTCOffset
+	}
+	if mw.DurationHours != nil {
+		hours = *mw.DurationHours
+	}
+	duration := time.Duration(hours) * time.Hour
+	when := fmt.Sprintf("at %s UTC%s for %dh", startTime, offset, hours)
+
+	var description, rule string
+	schedule := mw.Schedule
+	switch {
+	case schedule == nil:
+		return when, time.Time{}, time.Time{}
+	case schedule.Daily != nil:
+		interval := int32(1)
+		if schedule.Daily.IntervalDays != nil {
+			interval = *schedule.Daily.IntervalDays
+		}
+		description = fmt.Sprintf("every %d day(s)", interval)
+		if interval == 1 {
+			rule = "FREQ=DAILY"
+		}
+	case schedule.Weekly != nil && schedule.Weekly.DayOfWeek != nil:
+		interval := int32(1)
+		if schedule.Weekly.IntervalWeeks != nil {
+			interval = *schedule.Weekly.IntervalWeeks
+		}
+		day := string(*schedule.Weekly.DayOfWeek)
+		description = fmt.Sprintf("every %d week(s) on %s", interval, day)
+		if interval == 1 && len(day) >= 2 {
+			rule = "FREQ=WEEKLY;BYDAY=" + strings.ToUpper(day[:2])
+		}
+	case schedule.AbsoluteMonthly != nil && schedule.AbsoluteMonthly.DayOfMonth != nil:
+		description = fmt.Sprintf("monthly on day %d", *schedule.AbsoluteMonthly.DayOfMonth)
+	case schedule.RelativeMonthly != nil && schedule.RelativeMonthly.DayOfWeek != nil && schedule.RelativeMonthly.WeekIndex != nil:
+		description = fmt.Sprintf("monthly on the %s %s", *schedule.RelativeMonthly.WeekIndex, *schedule.RelativeMonthly.DayOfWeek)
+	default:
+		description = "custom schedule"
+	}
+	description += " " + when
+	if rule == "" {
+		return description, time.Time{}, time.Time{}
+	}
+
+	clock, err := time.Parse("15:04 -07:00", startTime+" "+offset)
+	if err != nil {
+		return description, time.Time{}, time.Time{}
+	}
+	local := now.In(clock.Location())
+	first := time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, clock.Location()).AddDate(0, 0, -7)
+	if mw.StartDate != nil && mw.StartDate.After(first) {
+		first = time.Date(mw.StartDate.Year(), mw.StartDate.Month(), mw.StartDate.Day(), clock.Hour(), clock.Minute(), 0, 0, clock.Location())
+	}
+
+	next, ok := nextRecurrence(first, duration, rule, now)
+	if !ok {
+		return description, time.Time{}, time.Time{}
+	}
+	return description, next, next.Add(duration)
+}
+
+// azureTags converts ARM resource tags to a plain map
+func azureTags(tags map[string]*string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(tags))
+	for key, value := range tags {
+		if value != nil {
+			out[key] = *value
+		} else {
+			out[key] = ""
+		}
+	}
+	return out
+}
+
+// CreateNodePool creates a user agent pool and waits until it is provisioned
+func (c *AKSClient) CreateNodePool(ctx context.Context, spec NodePoolSpec) error {
+	poolsClient, err := armcontainerservice.NewAgentPoolsClient(c.subscriptionID, c.credential, armClientOptions())
+	if err != nil {
+		return fmt.Errorf("failed to create agent pools client: %w", err)
+	}
+
+	// CreateOrUpdate would reconfigure an existing pool; fail like the GKE and EKS APIs instead
+	_, err = poolsClient.Get(ctx, c.resourceGroup, c.clusterName, spec.Name, nil)
+	var respErr *azcore.ResponseError
+	switch {
+	case err == nil:
+		return fmt.Errorf("agent pool %s already exists", spec.Name)
+	case !errors.As(err, &respErr) || respErr.StatusCode != http.StatusNotFound:
+		return fmt.Errorf("failed to check for agent pool %s: %w", spec.Name, err)
+	}
+
+	props := &armcontainerservice.ManagedClusterAgentPoolProfileProperties{
+		Mode:   to.Ptr(armcontainerservice.AgentPoolModeUser),
+		VMSize: to.Ptr(spec.MachineType),
+		Count:  to.Ptr(spec.Count),
+	}
+	if spec.Autoscaling != nil {
+		props.EnableAutoScaling = to.Ptr(true)
+		props.MinCount = to.Ptr(spec.Autoscaling.Min)
+		props.MaxCount = to.Ptr(spec.Autoscaling.Max)
+	}
+	if len(spec.Labels) > 0 {
+		props.NodeLabels = map[string]*string{}
+		for key, value := range spec.Labels {
+			props.NodeLabels[key] = to.Ptr(value)
+		}
+	}
+	for _, taint := range spec.Taints {
+		props.NodeTaints = append(props.NodeTaints, to.Ptr(taint.ToString()))
+	}
 
-	pods, err := c.k8sClient.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
+	poller, err := poolsClient.BeginCreateOrUpdate(ctx, c.resourceGroup, c.clusterName, spec.Name,
+		armcontainerservice.AgentPool{Properties: props}, nil)
 	if err != nil {
-		return fmt.Errorf("failed to list pods in namespace %s: %w", namespace, err)
+		return fmt.Errorf("failed to create agent pool %s: %w", spec.Name, err)
+	}
+	if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("agent pool %s was not provisioned: %w", spec.Name, err)
 	}
+	return nil
+}
 
-	fmt.Printf("\nPods in namespace '%s' (%d total):\n", namespace, len(pods.Items))
-	for _, pod := range pods.Items {
-		fmt.Printf("  Name: %s\n", pod.Name)
-		fmt.Printf("    Status: %s\n", pod.Status.Phase)
-		fmt.Printf("    Node: %s\n", pod.Spec.NodeName)
-		fmt.Printf("    Created: %s\n", pod.CreationTimestamp.Format(time.RFC3339))
-		fmt.Println()
+// DeleteNodePool deletes an agent pool and waits until it is gone
+func (c *AKSClient) DeleteNodePool(ctx context.Context, name string) error {
+	poolsClient, err := armcontainerservice.NewAgentPoolsClient(c.subscriptionID, c.credential, armClientOptions())
+	if err != nil {
+		return fmt.Errorf("failed to create agent pools client: %w", err)
 	}
+	poller, err := poolsClient.BeginDelete(ctx, c.resourceGroup, c.clusterName, name, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete agent pool %s: %w", name, err)
+	}
+	if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("agent pool %s was not deleted: %w", name, err)
+	}
+	return nil
+}
 
+// UpgradeControlPlane sets the cluster's Kubernetes version, leaving the orchestrator version
+// of its agent pools unchanged as az aks upgrade --control-plane-only does, and waits until
+// the cluster is provisioned
+func (c *AKSClient) UpgradeControlPlane(ctx context.Context, target string) error {
+	cluster, err := c.aksClient.Get(ctx, c.resourceGroup, c.clusterName, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get AKS cluster: %w", err)
+	}
+	if cluster.Properties == nil {
+		return fmt.Errorf("cluster properties are nil")
+	}
+	cluster.Properties.KubernetesVersion = to.Ptr(target)
+
+	poller, err := c.aksClient.BeginCreateOrUpdate(ctx, c.resourceGroup, c.clusterName, cluster.ManagedCluster, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start upgrade: %w", err)
+	}
+	if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("upgrade did not finish: %w", err)
+	}
 	return nil
 }
 
+// ListPods lists all pods in the kube-system namespace, page by page
+func (c *AKSClient) ListPods() error {
+	if err := c.ConnectKubernetes(context.TODO()); err != nil {
+		return err
+	}
+	return printPods(context.TODO(), c.Clientset(), "kube-system")
+}
+
 // GetSubscriptionID returns the configured Azure subscription ID
 func (c *AKSClient) GetSubscriptionID() string {
 	return c.subscriptionID
@@ -291,37 +831,422 @@ func (c *AKSClient) GetResourceGroup() string {
 	return c.resourceGroup
 }
 
-func RunAKSTest() error {
+// GetAuthStrategy returns how the client authenticated to the cluster's API server
+func (c *AKSClient) GetAuthStrategy() AKSAuthStrategy {
+	return c.authStrategy
+}
+
+// GetManagedClustersClient returns the ARM managed clusters client, subject to the ARM rate
+// limiter and cloud API timeout
+func (c *AKSClient) GetManagedClustersClient() *armcontainerservice.ManagedClustersClient {
+	return c.aksClient
+}
+
+// GetCredential returns the Azure credential, for creating other Azure SDK clients without
+// authenticating again
+func (c *AKSClient) GetCredential() azcore.TokenCredential {
+	return c.credential
+}
+
+// GetClientOptions returns ARM client options for the configured cloud with the ARM rate limiter
+// and cloud API timeout applied
+func (c *AKSClient) GetClientOptions() *arm.ClientOptions {
+	return armClientOptions()
+}
+
+// UsesAzureRBAC reports whether the cluster authorizes Kubernetes requests with Azure RBAC
+func (c *AKSClient) UsesAzureRBAC() bool {
+	return c.azureRBAC
+}
+
+// Identity returns the provider-neutral identity of the AKS cluster
+func (c *AKSClient) Identity() ClusterIdentity {
+	return ClusterIdentity{
+		Provider:      ProviderAKS,
+		Account:       c.subscriptionID,
+		Region:        c.location,
+		ResourceGroup: c.resourceGroup,
+		Name:          c.clusterName,
+	}
+}
+
+// kubernetesClients returns the clientset and rest.Config set by ConnectKubernetes, both nil
+// before it succeeds
+func (c *AKSClient) kubernetesClients() (*kubernetes.Clientset, *rest.Config) {
+	c.k8sMu.Lock()
+	defer c.k8sMu.Unlock()
+	return c.k8sClient, c.restConfig
+}
+
+// RESTConfig returns a copy of the authenticated rest.Config for the cluster's API server
+func (c *AKSClient) RESTConfig() *rest.Config {
+	_, config := c.kubernetesClients()
+	if config == nil {
+		return nil
+	}
+	return rest.CopyConfig(config)
+}
+
+// Clientset returns the typed Kubernetes clientset, or nil before ConnectKubernetes
+func (c *AKSClient) Clientset() kubernetes.Interface {
+	clientset, _ := c.kubernetesClients()
+	if clientset == nil {
+		return nil
+	}
+	return clientset
+}
+
+// Discovery returns the discovery client of the Kubernetes clientset, or nil before
+// ConnectKubernetes
+func (c *AKSClient) Discovery() discovery.DiscoveryInterface {
+	clientset, _ := c.kubernetesClients()
+	if clientset == nil {
+		return nil
+	}
+	return clientset.Discovery()
+}
+
+// Dynamic returns a dynamic client sharing the clientset's authentication
+func (c *AKSClient) Dynamic() (dynamic.Interface, error) {
+	_, config := c.kubernetesClients()
+	if config == nil {
+		return nil, ErrKubernetesNotConnected
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	return client, nil
+}
+
+// BuildClientCmdAPIConfig returns an in-memory kubeconfig for the cluster using the
+// provider's naming convention, without writing credentials to disk
+func (c *AKSClient) BuildClientCmdAPIConfig() (*clientcmdapi.Config, error) {
+	return buildKubeconfig(c, defaultKubeconfigNames(c.Identity()))
+}
+
+// RawRequest sends a request to a non-resource path of the cluster's API server
+func (c *AKSClient) RawRequest(ctx context.Context, method, path string) ([]byte, error) {
+	return rawRequest(ctx, c, method, path)
+}
+
+// acrTokenUsername is the username ACR expects with a refresh token obtained by exchanging an
+// Azure AD token
+const acrTokenUsername = "00000000-0000-0000-0000-000000000000"
+
+// acrRefreshTokenLifetime is how long ACR refresh tokens obtained by exchange stay valid
+const acrRefreshTokenLifetime = 3 * time.Hour
+
+// RegistryCredentials exchanges an Azure AD token of the client's credential for an ACR refresh
+// token, as az acr login does. Other registries get nil.
+func (c *AKSClient) RegistryCredentials(ctx context.Context, registry string) (*RegistryAuth, error) {
+	if !acrRegistryHost.MatchString(registry) {
+		return nil, nil
+	}
+	audience := azureCloudConfigs[azureCloud].Services[cloud.ResourceManager].Audience
+	token, err := c.credential.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{strings.TrimSuffix(audience, "/") + "/.default"}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Azure AD token: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {registry},
+		"access_token": {token.Token},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+registry+"/oauth2/exchange", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := auditedHTTPClient("azure").Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange Azure AD token with %s: %w", registry, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s refused the Azure AD token (HTTP %d)", registry, resp.StatusCode)
+	}
+	var exchanged struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&exchanged); err != nil {
+		return nil, fmt.Errorf("failed to decode ACR refresh token: %w", err)
+	}
+	return &RegistryAuth{Username: acrTokenUsername, Password: exchanged.RefreshToken, Expiry: time.Now().Add(acrRefreshTokenLifetime)}, nil
+}
+
+// ClusterCIDRs returns the cluster's pod and service ranges. With Azure CNI outside overlay mode
+// pods take addresses from the node subnets, so there is no pod range.
+func (c *AKSClient) ClusterCIDRs(ctx context.Context) (*ClusterCIDRs, error) {
+	cluster, err := c.aksClient.Get(ctx, c.resourceGroup, c.clusterName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster info: %w", err)
+	}
+	cidrs := &ClusterCIDRs{}
+	network := cluster.Properties.NetworkProfile
+	if network == nil {
+		return cidrs, nil
+	}
+	collect := func(list []*string, single *string) []string {
+		var values []string
+		for _, cidr := range list {
+			if cidr != nil && *cidr != "" {
+				values = append(values, *cidr)
+			}
+		}
+		if len(values) == 0 && single != nil && *single != "" {
+			values = append(values, *single)
+		}
+		return values
+	}
+	cidrs.ServiceCIDRs = collect(network.ServiceCidrs, network.ServiceCidr)
+	overlay := network.NetworkPluginMode != nil && *network.NetworkPluginMode == armcontainerservice.NetworkPluginModeOverlay
+	if network.NetworkPlugin != nil && *network.NetworkPlugin == armcontainerservice.NetworkPluginAzure && !overlay {
+		cidrs.PodsFromSubnets = true
+	} else {
+		cidrs.PodCIDRs = collect(network.PodCidrs, network.PodCidr)
+	}
+	return cidrs, nil
+}
+
+// Session reports the Azure AD user or application of the Azure credential and when its ARM
+// token expires, from the token's claims
+func (c *AKSClient) Session(ctx context.Context) (*SessionInfo, error) {
+	audience := azureCloudConfigs[azureCloud].Services[cloud.ResourceManager].Audience
+	token, err := c.credential.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{strings.TrimSuffix(audience, "/") + "/.default"}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Azure AD token: %w", err)
+	}
+	session := &SessionInfo{
+		Provider: ProviderAKS,
+		Source:   strings.TrimPrefix(fmt.Sprintf("%T", c.credential), "*azidentity."),
+		Expires:  token.ExpiresOn,
+	}
+
+	claims, err := jwtClaims(token.Token)
+	if err != nil {
+		return nil, err
+	}
+	claim := func(name string) string {
+		value, _ := claims[name].(string)
+		return value
+	}
+	switch {
+	case claim("upn") != "":
+		session.Identity = claim("upn")
+	case claim("unique_name") != "":
+		session.Identity = claim("unique_name")
+	case claim("appid") != "":
+		session.Identity = "application " + claim("appid")
+	default:
+		session.Identity = "object " + claim("oid")
+	}
+	if tenant := claim("tid"); tenant != "" {
+		session.Account = "tenant " + tenant + ", subscription " + c.subscriptionID
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		session.Expires = time.Unix(int64(exp), 0)
+	}
+	return session, nil
+}
+
+// ServicePrincipalCredentials reads the client secrets and certificates of the service
+// principal the client authenticates as from Microsoft Graph, or returns nil when it
+// authenticates as a user. The secret in use is recognised when it comes from
+// AZURE_CLIENT_SECRET or its mounted credential.
+func (c *AKSClient) ServicePrincipalCredentials(ctx context.Context) (*ServicePrincipalCredentials, error) {
+	return ReadServicePrincipalCredentials(ctx, c.credential, credentialValue("AZURE_CLIENT_SECRET"))
+}
+
+// CloudAccessMappings lists the cluster's Azure AD admin groups, the local admin account unless
+// disabled, the Azure role assignments granting Kubernetes access on the cluster (inherited ones
+// included) and the Azure AD users and groups bound in Kubernetes RBAC
+func (c *AKSClient) CloudAccessMappings(ctx context.Context) ([]AccessMapping, error) {
+	cluster, err := c.aksClient.Get(ctx, c.resourceGroup, c.clusterName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster info: %w", err)
+	}
+
+	var mappings []AccessMapping
+	seen := map[string]bool{}
+	if aad := cluster.Properties.AADProfile; aad != nil {
+		for _, group := range aad.AdminGroupObjectIDs {
+			if group == nil {
+				continue
+			}
+			seen[*group] = true
+			mappings = append(mappings, AccessMapping{Source: "AKS admin group", Principal: *group, Groups: []string{*group}, Access: []string{"cluster-admin"}, Scope: "cluster"})
+		}
+	}
+	if disabled := cluster.Properties.DisableLocalAccounts; disabled == nil || !*disabled {
+		mappings = append(mappings, AccessMapping{
+			Source:    "AKS local account",
+			Principal: "clusterAdmin credentials (listClusterAdminCredential)",
+			Groups:    []string{"system:masters"},
+			Scope:     "cluster",
+		})
+	}
+
+	assignments, err := c.roleAssignmentMappings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mappings = append(mappings, assignments...)
+
+	if err := c.ConnectKubernetes(ctx); err != nil {
+		return nil, err
+	}
+	bindings, err := azureADBindings(ctx, c.Clientset())
+	if err != nil {
+		return nil, err
+	}
+	for _, binding := range bindings {
+		if !seen[binding.Principal] {
+			mappings = append(mappings, binding)
+		}
+	}
+	sortAccessMappings(mappings)
+	return mappings, nil
+}
+
+// roleAssignmentMappings lists the role assignments at, above and below the cluster's scope
+// whose role grants Kubernetes access: the Azure Kubernetes Service roles, Owner and Contributor
+func (c *AKSClient) roleAssignmentMappings(ctx context.Context) ([]AccessMapping, error) {
+	assignmentsClient, err := armauthorization.NewRoleAssignmentsClient(c.subscriptionID, c.credential, armClientOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create role assignments client: %w", err)
+	}
+	definitionsClient, err := armauthorization.NewRoleDefinitionsClient(c.credential, armClientOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create role definitions client: %w", err)
+	}
+
+	roleNames := map[string]string{}
+	roleName := func(id string) (string, error) {
+		if name, ok := roleNames[id]; ok {
+			return name, nil
+		}
+		definition, err := definitionsClient.GetByID(ctx, id, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to get role definition %s: %w", id, err)
+		}
+		name := id
+		if definition.Properties != nil && definition.Properties.RoleName != nil {
+			name = *definition.Properties.RoleName
+		}
+		roleNames[id] = name
+		return name, nil
+	}
+
+	scope := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.ContainerService/managedClusters/%s",
+		c.subscriptionID, c.resourceGroup, c.clusterName)
+	var mappings []AccessMapping
+	pager := assignmentsClient.NewListForScopePager(scope, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list role assignments: %w", err)
+		}
+		for _, assignment := range page.Value {
+			props := assignment.Properties
+			if props == nil || props.PrincipalID == nil || props.RoleDefinitionID == nil {
+				continue
+			}
+			name, err := roleName(*props.RoleDefinitionID)
+			if err != nil {
+				return nil, err
+			}
+			if !strings.Contains(name, "Kubernetes") && name != "Owner" && name != "Contributor" {
+				continue
+			}
+
+			mapping := AccessMapping{Source: "Azure RBAC", Principal: *props.PrincipalID, Access: []string{name}}
+			if props.PrincipalType != nil {
+				mapping.Principal += " (" + string(*props.PrincipalType) + ")"
+				// Azure AD groups reach the API server as group claims, users and service
+				// principals as their object ID
+				if *props.PrincipalType == armauthorization.PrincipalTypeGroup {
+					mapping.Groups = []string{*props.PrincipalID}
+				} else {
+					mapping.Username = *props.PrincipalID
+				}
+			}
+			if props.Scope != nil {
+				mapping.Scope = *props.Scope
+			}
+			mappings = append(mappings, mapping)
+		}
+	}
+	return mappings, nil
+}
+
+// Close is a no-op; the Azure SDK clients hold no long-lived connections
+func (c *AKSClient) Close() error {
+	return nil
+}
+
+// newAKSClientFromEnv creates an AKS client from the AKS_* and AZURE_* environment variables
+func newAKSClientFromEnv(deferKubernetes bool) (*AKSClient, error) {
 	// Get cluster details from environment variables or use defaults
 	clusterName := os.Getenv("AKS_CLUSTER_NAME")
 	if clusterName == "" {
 		clusterName = "my-aks-cluster" // Default cluster name
 	}
 
+	// Without AZURE_RESOURCE_GROUP the client searches the subscription for the cluster
 	resourceGroup := os.Getenv("AZURE_RESOURCE_GROUP")
-	if resourceGroup == "" {
-		return fmt.Errorf("AZURE_RESOURCE_GROUP environment variable must be set")
-	}
 
 	subscriptionID := os.Getenv("AZURE_SUBSCRIPTION_ID")
 	if subscriptionID == "" {
-		return fmt.Errorf("AZURE_SUBSCRIPTION_ID environment variable must be set")
+		return nil, fmt.Errorf("AZURE_SUBSCRIPTION_ID environment variable must be set")
+	}
+
+	if resourceGroup != "" {
+		Infof("Connecting to AKS cluster '%s' in resource group '%s' (subscription: %s)...",
+			clusterName, resourceGroup, subscriptionID)
+	} else {
+		Infof("AZURE_RESOURCE_GROUP not set, searching subscription %s for AKS cluster '%s'...", subscriptionID, clusterName)
 	}
 
-	fmt.Printf("Connecting to AKS cluster '%s' in resource group '%s' (subscription: %s)...\n",
-		clusterName, resourceGroup, subscriptionID)
+	cred, err := createAzureCredential()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure credential: %w", err)
+	}
 
 	// Create AKS client
-	client, err := NewAKSClient(clusterName, resourceGroup, subscriptionID)
+	opts := AKSClientOptions{
+		AADServerAppID:  os.Getenv("AKS_AAD_SERVER_APP_ID"),
+		DeferKubernetes: deferKubernetes,
+		WaitForReady:    waitForReady,
+		Impersonate:     impersonation,
+	}
+	userAgent, headers, err := requestHeadersFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	opts.UserAgent, opts.Headers = userAgent, headers
+	client, err := NewAKSClientWithOptions(clusterName, resourceGroup, subscriptionID, cred, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AKS client: %w", err)
+	}
+
+	return client, nil
+}
+
+func RunAKSTest() error {
+	client, err := newAKSClientFromEnv(false)
 	if err != nil {
-		return fmt.Errorf("failed to create AKS client: %w", err)
+		return err
 	}
 
-	fmt.Println("✓ Successfully connected to AKS cluster!")
+	Infof("✓ Successfully connected to AKS cluster!")
 
 	// Get cluster information
-	if err := client.GetClusterInfo(); err != nil {
+	if info, err := client.GetClusterInfo(); err != nil {
 		log.Printf("Failed to get cluster info: %v", err)
+	} else {
+		PrintClusterInfo(info)
 	}
 
 	// List pods in kube-system namespace
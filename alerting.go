@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	// opsgenieAlertsURL and opsgenieEUAlertsURL are the Opsgenie Alert API endpoints of the US
+	// and EU instances
+	opsgenieAlertsURL   = "https://api.opsgenie.com/v2/alerts"
+	opsgenieEUAlertsURL = "https://api.eu.opsgenie.com/v2/alerts"
+)
+
+// alertSource is the source alerts are raised by, and the prefix of their dedup keys
+const alertSource = "connect-managed-k8s"
+
+// opsgenieMessageLimit is the longest message Opsgenie accepts
+const opsgenieMessageLimit = 130
+
+// alertDedupKey identifies the alert of one check of one cluster, so that the alert a failure
+// raised is the one its recovery resolves
+func alertDedupKey(t CheckTransition) string {
+	return alertSource + "/" + t.Cluster.Key() + "/" + t.Check
+}
+
+// alertTriggered reports whether the transition raises (or keeps) an alert rather than
+// resolving it: warn and fail raise one, pass and skip resolve it
+func alertTriggered(t CheckTransition) bool {
+	return t.Current.AtLeast(CheckWarn)
+}
+
+// alertSummary is the one-line title of the alert of a transition
+func alertSummary(t CheckTransition) string {
+	summary := fmt.Sprintf("%s %s on %s", t.Check, t.Current, t.Cluster.Key())
+	if t.Message != "" {
+		summary += ": " + Redact(t.Message)
+	}
+	return summary
+}
+
+// alertDetails are the fields attached to the alert of a transition
+func alertDetails(t CheckTransition) map[string]string {
+	details := map[string]string{
+		"cluster":  t.Cluster.Key(),
+		"provider": string(t.Cluster.Provider),
+		"check":    t.Check,
+		"status":   string(t.Current),
+		"message":  Redact(t.Message),
+	}
+	if !t.Initial() {
+		details["previous"] = string(t.Previous)
+		details["previous_duration"] = t.PreviousDuration.Round(time.Second).String()
+	}
+	return details
+}
+
+// postAlertJSON POSTs body as JSON to endpoint with headers, failing on a non-2xx response
+func postAlertJSON(ctx context.Context, client *http.Client, endpoint string, headers map[string]string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post alert: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("alert endpoint returned %s: %s", resp.Status, Redact(string(bytes.TrimSpace(message))))
+	}
+	return nil
+}
+
+// pagerDutyEvent is a PagerDuty Events API v2 event
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"` // trigger or resolve
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+// pagerDutyPayload describes the incident a trigger event opens
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"` // critical, error, warning or info
+	Timestamp     string            `json:"timestamp,omitempty"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// pagerDutyNotifier triggers a PagerDuty incident per cluster and check that warns or fails,
+// and resolves it when the check passes again. The routing key of an Events API v2
+// integration is read from PAGERDUTY_ROUTING_KEY, or the mounted credential of that name, on
+// every notification so that a rotated key applies.
+type pagerDutyNotifier struct {
+	endpoint string
+	client   *http.Client
+}
+
+func (n pagerDutyNotifier) Name() string { return "pagerduty" }
+
+func (n pagerDutyNotifier) Notify(ctx context.Context, transitions []CheckTransition) error {
+	routingKey := credentialValue("PAGERDUTY_ROUTING_KEY")
+	if routingKey == "" {
+		return errors.New("PAGERDUTY_ROUTING_KEY is not set")
+	}
+	RegisterSecret(routingKey)
+
+	var errs []error
+	for _, t := range transitions {
+		event := pagerDutyEvent{RoutingKey: routingKey, EventAction: "resolve", DedupKey: alertDedupKey(t)}
+		if alertTriggered(t) {
+			severity := "error"
+			if t.Current == CheckWarn {
+				severity = "warning"
+			}
+			event.EventAction = "trigger"
+			event.Payload = &pagerDutyPayload{
+				Summary:       alertSummary(t),
+				Source:        t.Cluster.Key(),
+				Severity:      severity,
+				Timestamp:     t.At.UTC().Format(time.RFC3339),
+				Component:     t.Check,
+				Group:         string(t.Cluster.Provider),
+				Class:         "cluster check",
+				CustomDetails: alertDetails(t),
+			}
+		} else if t.Initial() {
+			continue
+		}
+		if err := postAlertJSON(ctx, n.client, n.endpoint, nil, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", t.Cluster.Key(), t.Check, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (n pagerDutyNotifier) Close() error { return nil }
+
+// opsgenieAlert is an Opsgenie alert creation request
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Source      string            `json:"source"`
+	Entity      string            `json:"entity,omitempty"`
+	Priority    string            `json:"priority"` // P1 to P5
+	Tags        []string          `json:"tags,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+// opsgenieClose is an Opsgenie alert close request
+type opsgenieClose struct {
+	Source string `json:"source"`
+	Note   string `json:"note,omitempty"`
+}
+
+// opsgenieNotifier creates an Opsgenie alert per cluster and check that warns or fails, aliased
+// so that repeated failures are deduplicated, and closes it when the check passes again. The
+// API key of an API integration is read from OPSGENIE_API_KEY, or the mounted credential of that
+// name, on every notification.
+type opsgenieNotifier struct {
+	endpoint string
+	client   *http.Client
+}
+
+func (n opsgenieNotifier) Name() string { return "opsgenie (" + n.endpoint + ")" }
+
+func (n opsgenieNotifier) Notify(ctx context.Context, transitions []CheckTransition) error {
+	apiKey := credentialValue("OPSGENIE_API_KEY")
+	if apiKey == "" {
+		return errors.New("OPSGENIE_API_KEY is not set")
+	}
+	RegisterSecret(apiKey)
+	headers := map[string]string{"Authorization": "GenieKey " + apiKey}
+
+	var errs []error
+	for _, t := range transitions {
+		alias := alertDedupKey(t)
+		var err error
+		switch {
+		case alertTriggered(t):
+			priority := "P2"
+			if t.Current == CheckWarn {
+				priority = "P4"
+			}
+			message := alertSummary(t)
+			if runes := []rune(message); len(runes) > opsgenieMessageLimit {
+				message = string(runes[:opsgenieMessageLimit-3]) + "..."
+			}
+			err = postAlertJSON(ctx, n.client, n.endpoint, headers, opsgenieAlert{
+				Message:     message,
+				Alias:       alias,
+				Description: t.String(),
+				Source:      alertSource,
+				Entity:      t.Cluster.Key(),
+				Priority:    priority,
+				Tags:        []string{string(t.Cluster.Provider), t.Check},
+				Details:     alertDetails(t),
+			})
+		case !t.Initial():
+			endpoint := n.endpoint + "/" + url.PathEscape(alias) + "/close?identifierType=alias"
+			err = postAlertJSON(ctx, n.client, endpoint, headers, opsgenieClose{Source: alertSource, Note: t.String()})
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", t.Cluster.Key(), t.Check, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (n opsgenieNotifier) Close() error { return nil }
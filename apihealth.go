@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// apiHealthEndpoints are the API server's verbose health endpoints. /readyz covers etcd,
+// informer sync and post-start hooks of the controllers, /livez whether the process is alive.
+var apiHealthEndpoints = []string{"/readyz", "/livez"}
+
+// rawRequest sends a request to a non-resource API server path, with any query string passed on
+// as parameters. The body is returned even on error status codes, since the health endpoints
+// explain their failures in it.
+func rawRequest(ctx context.Context, client ClusterClient, method, path string) ([]byte, error) {
+	u, err := url.Parse(path)
+	if err != nil || !strings.HasPrefix(u.Path, "/") {
+		return nil, fmt.Errorf("invalid API server path %q", path)
+	}
+
+	discovery := client.Discovery()
+	if discovery == nil || discovery.RESTClient() == nil {
+		return nil, ErrKubernetesNotConnected
+	}
+	restClient := discovery.RESTClient()
+	request := restClient.Verb(strings.ToUpper(method)).AbsPath(u.Path)
+	for key, values := range u.Query() {
+		for _, value := range values {
+			request = request.Param(key, value)
+		}
+	}
+	body, err := request.DoRaw(ctx)
+	if err != nil {
+		return body, fmt.Errorf("failed to %s %s: %w", strings.ToUpper(method), path, err)
+	}
+	return body, nil
+}
+
+// ReadAPIServerHealth reads the individual checks of a verbose API server health endpoint such
+// as /readyz or /livez. API servers that predate /readyz and /livez are asked for /healthz.
+func ReadAPIServerHealth(ctx context.Context, client ClusterClient, endpoint string) ([]ProbeResult, error) {
+	body, err := client.RawRequest(ctx, "GET", endpoint+"?verbose")
+	if apierrors.IsNotFound(err) && endpoint != "/healthz" {
+		return ReadAPIServerHealth(ctx, client, "/healthz")
+	}
+	results := parseHealthChecks(string(body))
+	if err != nil && len(results) == 0 {
+		return nil, err
+	}
+	return results, nil
+}
+
+// parseHealthChecks parses verbose health output, one check per line:
+//
+//	[+]etcd ok
+//	[-]etcd-readiness failed: reason withheld
+func parseHealthChecks(body string) []ProbeResult {
+	var results []ProbeResult
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) < 4 || line[0] != '[' || line[2] != ']' {
+			continue
+		}
+		name, detail, _ := strings.Cut(line[3:], " ")
+		results = append(results, ProbeResult{Name: name, OK: line[1] == '+', Detail: detail})
+	}
+	return results
+}
+
+// CheckAPIServerHealth reports the API server's /readyz and /livez checks, which show etcd,
+// informer and controller health that listing pods cannot, and fails when any of them fails
+func CheckAPIServerHealth(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "api-health"}
+
+	failed := 0
+	for _, endpoint := range apiHealthEndpoints {
+		checks, err := ReadAPIServerHealth(ctx, client, endpoint)
+		if err != nil {
+			result.Status = CheckFail
+			result.Message = err.Error()
+			return result
+		}
+		passed := 0
+		for _, check := range checks {
+			if check.OK {
+				passed++
+				continue
+			}
+			failed++
+			result.Details = append(result.Details, fmt.Sprintf("✗ %s %s: %s", endpoint, check.Name, check.Detail))
+		}
+		result.Details = append(result.Details, fmt.Sprintf("%s: %d/%d check(s) ok", endpoint, passed, len(checks)))
+	}
+
+	if failed > 0 {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%d API server health check(s) failing", failed)
+		return result
+	}
+	result.Status = CheckPass
+	result.Message = "API server ready and live"
+	return result
+}
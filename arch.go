@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// unameMachines maps Kubernetes architectures to what uname -m reports on them
+var unameMachines = map[string]string{
+	"amd64":   "x86_64",
+	"arm64":   "aarch64",
+	"arm":     "armv7l",
+	"s390x":   "s390x",
+	"ppc64le": "ppc64le",
+}
+
+// ArchProbeOptions configures the pods arch-probe schedules onto each architecture
+type ArchProbeOptions struct {
+	Image     string // must be a multi-arch image
+	Namespace string
+	Timeout   time.Duration
+}
+
+// ArchitecturePool is the nodes of one pool, operating system and CPU architecture
+type ArchitecturePool struct {
+	Pool         string `json:"pool"`
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Nodes        int    `json:"nodes"`
+}
+
+// ArchitectureMix is a cluster's nodes by CPU architecture, e.g. Graviton, Tau T2A or Ampere
+// arm64 pools next to amd64 ones
+type ArchitectureMix struct {
+	Pools []ArchitecturePool `json:"pools"`
+	// Nodes counts nodes by architecture
+	Nodes map[string]int `json:"nodes"`
+}
+
+// Architectures returns the architectures of the cluster's nodes, sorted
+func (m *ArchitectureMix) Architectures() []string {
+	archs := make([]string, 0, len(m.Nodes))
+	for arch := range m.Nodes {
+		archs = append(archs, arch)
+	}
+	sort.Strings(archs)
+	return archs
+}
+
+// DiscoverArchitectures groups nodes by pool, OS and architecture from the kubernetes.io/os and
+// kubernetes.io/arch labels
+func DiscoverArchitectures(ctx context.Context, clientset kubernetes.Interface) (*ArchitectureMix, error) {
+	mix := &ArchitectureMix{Nodes: map[string]int{}}
+	pools := map[ArchitecturePool]int{}
+	err := EachNode(ctx, clientset, metav1.ListOptions{}, func(node *corev1.Node) error {
+		arch := node.Labels[corev1.LabelArchStable]
+		if arch == "" {
+			arch = node.Status.NodeInfo.Architecture
+		}
+		os := node.Labels[corev1.LabelOSStable]
+		if os == "" {
+			os = node.Status.NodeInfo.OperatingSystem
+		}
+		pools[ArchitecturePool{Pool: nodePoolName(node), OS: os, Architecture: arch}]++
+		mix.Nodes[arch]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for pool, nodes := range pools {
+		pool.Nodes = nodes
+		mix.Pools = append(mix.Pools, pool)
+	}
+	sort.Slice(mix.Pools, func(i, j int) bool {
+		if mix.Pools[i].Architecture != mix.Pools[j].Architecture {
+			return mix.Pools[i].Architecture < mix.Pools[j].Architecture
+		}
+		return mix.Pools[i].Pool < mix.Pools[j].Pool
+	})
+	return mix, nil
+}
+
+// CheckArchitectures reports the node architecture mix by pool. It is informational and always
+// passes.
+func CheckArchitectures(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "architectures"}
+
+	mix, err := DiscoverArchitectures(ctx, client.Clientset())
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	for _, pool := range mix.Pools {
+		result.Details = append(result.Details, fmt.Sprintf("%s: %s/%s, %d node(s)", pool.Pool, pool.OS, pool.Architecture, pool.Nodes))
+	}
+	var counts []string
+	for _, arch := range mix.Architectures() {
+		counts = append(counts, fmt.Sprintf("%d %s", mix.Nodes[arch], arch))
+	}
+
+	result.Status = CheckPass
+	switch len(counts) {
+	case 0:
+		result.Message = "no nodes"
+	case 1:
+		result.Message = "single architecture: " + counts[0] + " node(s)"
+	default:
+		result.Message = "multi-arch cluster: " + strings.Join(counts, ", ") + " node(s)"
+	}
+	return result
+}
+
+// RunArchProbe schedules a pod from opts.Image onto a Linux node of each architecture in the
+// cluster and checks the architecture it reports with uname -m, verifying that the image's
+// manifest list covers the architecture and that pods schedule there. GKE taints arm64 nodes
+// with kubernetes.io/arch=arm64, which the pods tolerate. The pods are always deleted afterwards.
+func RunArchProbe(ctx context.Context, clientset kubernetes.Interface, opts ArchProbeOptions) ([]ProbeResult, error) {
+	mix, err := DiscoverArchitectures(ctx, clientset)
+	if err != nil {
+		return nil, err
+	}
+	linux := map[string]bool{}
+	for _, pool := range mix.Pools {
+		if pool.OS == "linux" {
+			linux[pool.Architecture] = true
+		}
+	}
+
+	var results []ProbeResult
+	for _, arch := range sortedSet(linux) {
+		results = append(results, runArchProbePod(ctx, clientset, opts, arch))
+	}
+	return results, nil
+}
+
+// runArchProbePod runs one probe pod on arch and reports whether it ran there
+func runArchProbePod(ctx context.Context, clientset kubernetes.Interface, opts ArchProbeOptions, arch string) ProbeResult {
+	result := ProbeResult{Name: arch}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "connect-k8s-arch-probe-",
+			Namespace:    opts.Namespace,
+			Labels:       map[string]string{"app.kubernetes.io/managed-by": "connect-managed-k8s"},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:         corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds: int64Ptr(int64(opts.Timeout.Seconds())),
+			NodeSelector:          map[string]string{corev1.LabelOSStable: "linux", corev1.LabelArchStable: arch},
+			Tolerations: []corev1.Toleration{{
+				Key:      corev1.LabelArchStable,
+				Operator: corev1.TolerationOpEqual,
+				Value:    arch,
+				Effect:   corev1.TaintEffectNoSchedule,
+			}},
+			Containers: []corev1.Container{{
+				Name:    "probe",
+				Image:   opts.Image,
+				Command: []string{"uname", "-m"},
+			}},
+		},
+	}
+
+	created, err := clientset.CoreV1().Pods(opts.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		result.Detail = fmt.Sprintf("failed to create probe pod: %v", err)
+		return result
+	}
+	defer deleteProbePod(clientset, created.Namespace, created.Name)
+
+	if err := waitForPodCompletion(ctx, clientset, created.Namespace, created.Name, opts.Timeout); err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	logs, err := clientset.CoreV1().Pods(created.Namespace).GetLogs(created.Name, &corev1.PodLogOptions{}).DoRaw(ctx)
+	if err != nil {
+		result.Detail = fmt.Sprintf("failed to read probe pod logs: %v", err)
+		return result
+	}
+
+	machine := strings.TrimSpace(string(logs))
+	expected := unameMachines[arch]
+	switch {
+	case machine == "":
+		result.Detail = "probe pod printed nothing; the image may lack a variant for " + arch
+	case expected != "" && machine != expected:
+		result.Detail = fmt.Sprintf("pod reported %s instead of %s, running under emulation or the wrong image variant", machine, expected)
+	default:
+		result.OK = true
+		result.Detail = machine
+	}
+	return result
+}
+
+// CheckArchProbe runs the multi-arch scheduling probe and turns it into a check result
+func CheckArchProbe(ctx context.Context, client ClusterClient, opts ArchProbeOptions) CheckResult {
+	result := CheckResult{Name: "arch-probe"}
+
+	probes, err := RunArchProbe(ctx, client.Clientset(), opts)
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	failed := 0
+	for _, probe := range probes {
+		if probe.OK {
+			result.Details = append(result.Details, fmt.Sprintf("✓ %s: %s", probe.Name, probe.Detail))
+			continue
+		}
+		failed++
+		result.Details = append(result.Details, fmt.Sprintf("✗ %s: %s", probe.Name, probe.Detail))
+	}
+
+	switch {
+	case len(probes) == 0:
+		result.Status = CheckFail
+		result.Message = "no Linux nodes to schedule on"
+	case failed > 0:
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%s did not run on %d of %d architecture(s)", opts.Image, failed, len(probes))
+	default:
+		result.Status = CheckPass
+		result.Message = fmt.Sprintf("%s ran on every architecture (%d)", opts.Image, len(probes))
+	}
+	return result
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/user"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"k8s.io/client-go/rest"
+)
+
+// AuditEntry records one cloud API call or mutating Kubernetes request made by the tool
+type AuditEntry struct {
+	Time          time.Time `json:"time"`
+	Actor         string    `json:"actor"` // local user and host running the tool
+	Impersonating string    `json:"impersonating,omitempty"`
+	API           string    `json:"api"` // kubernetes, aws, azure or gcp
+	Cluster       string    `json:"cluster,omitempty"`
+	Operation     string    `json:"operation"` // e.g. EKS DescribeCluster or POST /api/v1/namespaces
+	Target        string    `json:"target,omitempty"`
+	Result        string    `json:"result"` // ok, an HTTP status or error
+	Error         string    `json:"error,omitempty"`
+	DurationMS    int64     `json:"durationMs"`
+}
+
+// AuditLog appends audit entries as JSON lines to a local file, or collects them and uploads
+// them to object storage as <prefix>/<run timestamp>/audit.jsonl when closed
+type AuditLog struct {
+	mu      sync.Mutex
+	actor   string
+	file    *os.File
+	store   ObjectStore
+	started time.Time
+	buffer  []byte
+}
+
+// auditLog is the process-wide audit log, installed with ConfigureAuditLog; nil disables auditing
+var auditLog *AuditLog
+
+// ParseAuditLogFlag strips --audit-log <dest> from args, falling back to the AUDIT_LOG
+// environment variable when the flag is absent
+func ParseAuditLogFlag(args []string) ([]string, string, error) {
+	dest := os.Getenv("AUDIT_LOG")
+	remaining, err := stripGlobalFlags(args, map[string]bool{"audit-log": true}, func(_, value string, _ bool) error {
+		if value == "" {
+			return fmt.Errorf("--audit-log needs a destination, e.g. --audit-log=audit.jsonl")
+		}
+		dest = value
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return remaining, dest, nil
+}
+
+// ConfigureAuditLog opens the audit log at dest: a file path (optionally file:<path>) appended
+// to, or an s3://, gs:// or Azure Blob https:// URL uploaded to when the log is closed. An empty
+// dest disables auditing.
+func ConfigureAuditLog(ctx context.Context, dest string) error {
+	if dest == "" {
+		auditLog = nil
+		return nil
+	}
+
+	log := &AuditLog{actor: auditActor(), started: time.Now()}
+	if strings.HasPrefix(dest, "s3://") || strings.HasPrefix(dest, "gs://") || (strings.HasPrefix(dest, "https://") && isAzureBlobURL(dest)) {
+		store, err := NewObjectStore(ctx, dest)
+		if err != nil {
+			return fmt.Errorf("failed to open audit log: %w", err)
+		}
+		log.store = store
+	} else {
+		file, err := os.OpenFile(strings.TrimPrefix(dest, "file:"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to open audit log: %w", err)
+		}
+		log.file = file
+	}
+	auditLog = log
+	return nil
+}
+
+// CloseAuditLog closes the audit log, uploading the collected entries for object storage
+func CloseAuditLog(ctx context.Context) error {
+	log := auditLog
+	if log == nil {
+		return nil
+	}
+	auditLog = nil
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if log.file != nil {
+		return log.file.Close()
+	}
+	defer log.store.Close()
+	if len(log.buffer) == 0 {
+		return nil
+	}
+	key := path.Join(log.started.UTC().Format("20060102T150405Z"), "audit.jsonl")
+	if err := log.store.Put(ctx, key, log.buffer, "application/x-ndjson"); err != nil {
+		return fmt.Errorf("failed to upload audit log: %w", err)
+	}
+	return nil
+}
+
+// auditActor describes who runs the tool as user@host
+func auditActor() string {
+	name := "unknown"
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	host, _ := os.Hostname()
+	return name + "@" + host
+}
+
+// record writes entry, redacted, to the log. Write failures are logged as warnings and do not
+// fail the audited operation.
+func (l *AuditLog) record(entry AuditEntry) {
+	entry.Actor = l.actor
+	entry.Impersonating = impersonating(impersonation)
+	entry.Error = Redact(entry.Error)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		l.buffer = append(l.buffer, data...)
+		return
+	}
+	if _, err := l.file.Write(data); err != nil {
+		Warnf("Failed to write audit log: %v", err)
+	}
+}
+
+// recordAudit adds an entry for an operation that started at start and ended with err, or with
+// status for HTTP APIs, when auditing is enabled
+func recordAudit(api, cluster, operation, target string, start time.Time, status int, err error) {
+	log := auditLog
+	if log == nil {
+		return
+	}
+	entry := AuditEntry{
+		Time:       start.UTC(),
+		API:        api,
+		Cluster:    cluster,
+		Operation:  operation,
+		Target:     target,
+		Result:     "ok",
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	switch {
+	case err != nil:
+		entry.Result = "error"
+		entry.Error = err.Error()
+	case status >= 300:
+		entry.Result = fmt.Sprintf("HTTP %d", status)
+	}
+	log.record(entry)
+}
+
+// applyAuditLog records the mutating requests made to the API server of the cluster identity
+// describes, including those refused by read-only mode. Apply it after applyReadOnlyGuard.
+func applyAuditLog(config *rest.Config, identity func() ClusterIdentity) {
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &auditTransport{next: rt, identity: identity}
+	})
+}
+
+// auditTransport records mutating Kubernetes requests
+type auditTransport struct {
+	next     http.RoundTripper
+	identity func() ClusterIdentity
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if auditLog == nil || !kubernetesRequestMutates(req) {
+		return t.next.RoundTrip(req)
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	recordAudit("kubernetes", t.identity().Key(), req.Method+" "+req.URL.Path, "", start, status, err)
+	return resp, err
+}
+
+// azureAuditPolicy is an azcore pipeline policy recording ARM requests
+type azureAuditPolicy struct{}
+
+// Do sends the request down the pipeline and records it
+func (azureAuditPolicy) Do(req *policy.Request) (*http.Response, error) {
+	if auditLog == nil {
+		return req.Next()
+	}
+	start := time.Now()
+	resp, err := req.Next()
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	raw := req.Raw()
+	recordAudit("azure", "", "ARM "+raw.Method, raw.URL.Path, start, status, err)
+	return resp, err
+}
+
+// cloudAuditTransport records the HTTP requests made to a cloud API outside the provider SDKs'
+// own pipelines, such as the Google REST services and Microsoft Graph
+type cloudAuditTransport struct {
+	api  string
+	next http.RoundTripper
+}
+
+func (t cloudAuditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if auditLog == nil {
+		return t.next.RoundTrip(req)
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	// The query is left out, as it may carry a token
+	recordAudit(t.api, "", req.Method+" "+req.URL.Host, req.URL.Path, start, status, err)
+	return resp, err
+}
+
+// auditedHTTPClient returns an HTTP client recording its requests as calls to api (aws, azure
+// or gcp)
+func auditedHTTPClient(api string) *http.Client {
+	return &http.Client{Transport: cloudAuditTransport{api: api, next: http.DefaultTransport}}
+}
+
+// gcpAuditOptions returns client options recording gRPC calls to the GKE API
+func gcpAuditOptions() []option.ClientOption {
+	interceptor := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if auditLog == nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		target := ""
+		if named, ok := req.(interface{ GetName() string }); ok {
+			target = named.GetName()
+		}
+		if target == "" {
+			if parented, ok := req.(interface{ GetParent() string }); ok {
+				target = parented.GetParent()
+			}
+		}
+		recordAudit("gcp", "", "GKE "+path.Base(method), target, start, 0, err)
+		return err
+	}
+	return []option.ClientOption{option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(interceptor))}
+}
+
+// awsAuditMiddleware adds a step to an AWS SDK operation stack recording the operation, with
+// the region and the cluster named in its input. Add it before awsReadOnlyMiddleware so
+// refused operations are recorded too.
+func awsAuditMiddleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("AuditLog",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			if auditLog == nil {
+				return next.HandleInitialize(ctx, in)
+			}
+			start := time.Now()
+			out, metadata, err := next.HandleInitialize(ctx, in)
+			operation := awsmiddleware.GetServiceID(ctx) + " " + awsmiddleware.GetOperationName(ctx)
+			recordAudit("aws", awsInputCluster(in.Parameters), operation, awsmiddleware.GetRegion(ctx), start, 0, err)
+			return out, metadata, err
+		}), middleware.After)
+}
+
+// awsInputCluster returns the cluster an EKS operation input names in ClusterName, or in Name
+// for cluster operations such as DescribeCluster
+func awsInputCluster(params interface{}) string {
+	value := reflect.ValueOf(params)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return ""
+	}
+	for _, field := range []string{"ClusterName", "Name"} {
+		fieldValue := value.Elem().FieldByName(field)
+		if !fieldValue.IsValid() || !fieldValue.CanInterface() {
+			continue
+		}
+		if name, ok := fieldValue.Interface().(*string); ok && name != nil {
+			return *name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// autoscalerStatusConfigMap is written to kube-system by cluster-autoscaler, including the
+// managed one of AKS
+const autoscalerStatusConfigMap = "cluster-autoscaler-status"
+
+// autoscalerEventWindow is how far back scale-up failure events are reported
+const autoscalerEventWindow = time.Hour
+
+// scaleUpFailureReasons are the event reasons cluster-autoscaler and Karpenter record when
+// they cannot add capacity
+var scaleUpFailureReasons = []string{
+	"FailedScaleUp",             // cluster-autoscaler: a node group failed to scale up
+	"ScaleUpTimedOut",           // cluster-autoscaler: nodes did not register in time
+	"NotTriggerScaleUp",         // cluster-autoscaler: no node group fits a pending pod
+	"InsufficientCapacityError", // Karpenter: the cloud has no capacity for the NodeClaim
+	"FailedLaunching",           // Karpenter: instance launch failed
+}
+
+// AutoscalerDeployment is a cluster-autoscaler or Karpenter deployment running in the cluster
+type AutoscalerDeployment struct {
+	Kind      string `json:"kind"` // "cluster-autoscaler" or "karpenter"
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Image     string `json:"image,omitempty"`
+	Replicas  int32  `json:"replicas"`
+	Ready     int32  `json:"ready"`
+}
+
+// ScaleUpFailure is a recent event recording capacity that could not be added
+type ScaleUpFailure struct {
+	Object  string    `json:"object"`
+	Reason  string    `json:"reason"`
+	Message string    `json:"message"`
+	Count   int32     `json:"count"`
+	Last    time.Time `json:"last"`
+}
+
+// AutoscalerReport is what the cluster's node autoscalers report about themselves
+type AutoscalerReport struct {
+	Deployments []AutoscalerDeployment `json:"deployments,omitempty"`
+	// Health and ScaleUp come from the cluster-autoscaler status ConfigMap, when present
+	Health   string           `json:"health,omitempty"`
+	ScaleUp  string           `json:"scaleUp,omitempty"`
+	Failures []ScaleUpFailure `json:"failures,omitempty"`
+}
+
+// Found reports whether any autoscaler was detected
+func (r *AutoscalerReport) Found() bool {
+	return len(r.Deployments) > 0 || r.Health != ""
+}
+
+// InspectAutoscalers finds cluster-autoscaler and Karpenter deployments, reads the
+// cluster-autoscaler status ConfigMap and collects scale-up failure events from the last hour.
+// Managed autoscalers (AKS, GKE) run outside the cluster and are only seen through their
+// status ConfigMap and events.
+func InspectAutoscalers(ctx context.Context, clientset kubernetes.Interface) (*AutoscalerReport, error) {
+	report := &AutoscalerReport{}
+
+	err := EachDeployment(ctx, clientset, "", metav1.ListOptions{}, func(deployment *appsv1.Deployment) error {
+		kind := autoscalerKind(deployment)
+		if kind == "" {
+			return nil
+		}
+		found := AutoscalerDeployment{
+			Kind:      kind,
+			Namespace: deployment.Namespace,
+			Name:      deployment.Name,
+			Ready:     deployment.Status.ReadyReplicas,
+		}
+		if deployment.Spec.Replicas != nil {
+			found.Replicas = *deployment.Spec.Replicas
+		}
+		if containers := deployment.Spec.Template.Spec.Containers; len(containers) > 0 {
+			found.Image = containers[0].Image
+		}
+		report.Deployments = append(report.Deployments, found)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := clientset.CoreV1().ConfigMaps("kube-system").Get(ctx, autoscalerStatusConfigMap, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return nil, fmt.Errorf("failed to get %s ConfigMap: %w", autoscalerStatusConfigMap, err)
+	default:
+		report.Health, report.ScaleUp = parseAutoscalerStatus(status.Data["status"])
+	}
+
+	since := time.Now().Add(-autoscalerEventWindow)
+	for _, reason := range scaleUpFailureReasons {
+		events, err := clientset.CoreV1().Events("").List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("reason", reason).String(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s events: %w", reason, err)
+		}
+		for _, event := range events.Items {
+			last := eventTime(&event)
+			if last.Before(since) {
+				continue
+			}
+			report.Failures = append(report.Failures, ScaleUpFailure{
+				Object:  strings.ToLower(event.InvolvedObject.Kind) + " " + event.InvolvedObject.Namespace + "/" + event.InvolvedObject.Name,
+				Reason:  event.Reason,
+				Message: event.Message,
+				Count:   event.Count,
+				Last:    last,
+			})
+		}
+	}
+	sort.Slice(report.Failures, func(i, j int) bool { return report.Failures[i].Last.After(report.Failures[j].Last) })
+
+	return report, nil
+}
+
+// autoscalerKind tells whether a deployment runs cluster-autoscaler or Karpenter
+func autoscalerKind(deployment *appsv1.Deployment) string {
+	name := deployment.Labels["app.kubernetes.io/name"]
+	if name == "" {
+		name = deployment.Name
+	}
+	switch {
+	case strings.Contains(name, "cluster-autoscaler"):
+		return "cluster-autoscaler"
+	case strings.Contains(name, "karpenter"):
+		return "karpenter"
+	}
+	return ""
+}
+
+// parseAutoscalerStatus extracts the cluster-wide health and scale-up status from the status
+// ConfigMap, which is YAML since cluster-autoscaler 1.30 and free text before
+func parseAutoscalerStatus(status string) (health, scaleUp string) {
+	var parsed struct {
+		ClusterWide struct {
+			Health struct {
+				Status string `json:"status"`
+			} `json:"health"`
+			ScaleUp struct {
+				Status string `json:"status"`
+			} `json:"scaleUp"`
+		} `json:"clusterWide"`
+	}
+	if err := yaml.Unmarshal([]byte(status), &parsed); err == nil && parsed.ClusterWide.Health.Status != "" {
+		return parsed.ClusterWide.Health.Status, parsed.ClusterWide.ScaleUp.Status
+	}
+
+	// Cluster-wide:
+	//   Health:      Healthy (ready=3 unready=0 ...)
+	//   ScaleUp:     NoActivity (ready=3 registered=3)
+	inClusterWide := false
+	for _, line := range strings.Split(status, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "Cluster-wide:"):
+			inClusterWide = true
+		case strings.HasPrefix(trimmed, "NodeGroups:"):
+			inClusterWide = false
+		case inClusterWide && strings.HasPrefix(trimmed, "Health:") && health == "":
+			health = firstField(strings.TrimPrefix(trimmed, "Health:"))
+		case inClusterWide && strings.HasPrefix(trimmed, "ScaleUp:") && scaleUp == "":
+			scaleUp = firstField(strings.TrimPrefix(trimmed, "ScaleUp:"))
+		}
+	}
+	return health, scaleUp
+}
+
+// firstField returns the first whitespace-separated field of s
+func firstField(s string) string {
+	if fields := strings.Fields(s); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// eventTime returns when an event last occurred
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.FirstTimestamp.Time
+	}
+}
+
+// CheckAutoscaler reports the cluster's node autoscalers and fails when cluster-autoscaler is
+// unhealthy, an autoscaler deployment is not ready, or capacity failed to scale up in the last
+// hour. Clusters without an autoscaler pass.
+func CheckAutoscaler(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "autoscaler"}
+
+	report, err := InspectAutoscalers(ctx, client.Clientset())
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	problems := 0
+	for _, deployment := range report.Deployments {
+		mark := "✓"
+		if deployment.Ready < deployment.Replicas {
+			mark = "✗"
+			problems++
+		}
+		result.Details = append(result.Details, fmt.Sprintf("%s %s %s/%s (%s): %d/%d ready",
+			mark, deployment.Kind, deployment.Namespace, deployment.Name, deployment.Image, deployment.Ready, deployment.Replicas))
+	}
+	if report.Health != "" {
+		mark := "✓"
+		if report.Health != "Healthy" {
+			mark = "✗"
+			problems++
+		}
+		result.Details = append(result.Details, fmt.Sprintf("%s cluster-autoscaler health %s, scale-up %s", mark, report.Health, report.ScaleUp))
+	}
+	for _, failure := range report.Failures {
+		result.Details = append(result.Details, fmt.Sprintf("✗ %s %s (%dx, last %s): %s",
+			failure.Object, failure.Reason, failure.Count, failure.Last.Format(time.RFC3339), failure.Message))
+	}
+	problems += len(report.Failures)
+
+	switch {
+	case problems > 0:
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%d autoscaler problem(s), %d scale-up failure(s) in the last %s", problems, len(report.Failures), autoscalerEventWindow)
+	case !report.Found():
+		result.Status = CheckPass
+		result.Message = "no cluster-autoscaler or Karpenter found"
+	default:
+		result.Status = CheckPass
+		result.Message = fmt.Sprintf("autoscaler healthy, no scale-up failures in the last %s", autoscalerEventWindow)
+	}
+	return result
+}
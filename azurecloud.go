@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+)
+
+// AzureCloud names the Azure cloud the AKS clusters live in
+type AzureCloud string
+
+const (
+	AzurePublicCloud       AzureCloud = "AzurePublic"
+	AzureUSGovernmentCloud AzureCloud = "AzureUSGovernment"
+	AzureChinaCloud        AzureCloud = "AzureChina"
+)
+
+// azureCloudConfigs are the ARM and Azure AD endpoints of each cloud
+var azureCloudConfigs = map[AzureCloud]cloud.Configuration{
+	AzurePublicCloud:       cloud.AzurePublic,
+	AzureUSGovernmentCloud: cloud.AzureGovernment,
+	AzureChinaCloud:        cloud.AzureChina,
+}
+
+// azureGraphEndpoints is the Microsoft Graph endpoint of each cloud
+var azureGraphEndpoints = map[AzureCloud]string{
+	AzurePublicCloud:       "https://graph.microsoft.com",
+	AzureUSGovernmentCloud: "https://graph.microsoft.us",
+	AzureChinaCloud:        "https://microsoftgraph.chinacloudapi.cn",
+}
+
+// azureCloudAliases maps the accepted AZURE_CLOUD spellings, including the Azure CLI's cloud
+// names, to clouds
+var azureCloudAliases = map[string]AzureCloud{
+	"azurepublic":            AzurePublicCloud,
+	"azurecloud":             AzurePublicCloud,
+	"public":                 AzurePublicCloud,
+	"azureusgovernment":      AzureUSGovernmentCloud,
+	"azureusgovernmentcloud": AzureUSGovernmentCloud,
+	"usgovernment":           AzureUSGovernmentCloud,
+	"azurechina":             AzureChinaCloud,
+	"azurechinacloud":        AzureChinaCloud,
+	"china":                  AzureChinaCloud,
+}
+
+// azureCloud is the process-wide cloud, installed with ConfigureAzureCloud
+var azureCloud = AzurePublicCloud
+
+// ConfigureAzureCloud selects the cloud used for ARM calls, service principal sign-in and the
+// default AKS AAD server application
+func ConfigureAzureCloud(c AzureCloud) {
+	azureCloud = c
+}
+
+// ParseAzureCloud parses a cloud name such as AzureUSGovernment (case-insensitive; the Azure
+// CLI names AzureCloud and AzureChinaCloud are accepted too)
+func ParseAzureCloud(name string) (AzureCloud, error) {
+	c, ok := azureCloudAliases[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return "", fmt.Errorf("unknown Azure cloud %q (expected %s, %s or %s)", name, AzurePublicCloud, AzureUSGovernmentCloud, AzureChinaCloud)
+	}
+	return c, nil
+}
+
+// AzureCloudFromEnv reads AZURE_CLOUD, defaulting to the public cloud
+func AzureCloudFromEnv() (AzureCloud, error) {
+	name := os.Getenv("AZURE_CLOUD")
+	if name == "" {
+		return AzurePublicCloud, nil
+	}
+	c, err := ParseAzureCloud(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid AZURE_CLOUD: %w", err)
+	}
+	return c, nil
+}
+
+// azureClientOptions returns SDK client options targeting the configured cloud
+func azureClientOptions() azcore.ClientOptions {
+	return azcore.ClientOptions{Cloud: azureCloudConfigs[azureCloud]}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"k8s.io/client-go/discovery"
+)
+
+// NotableAPI is an API group version whose availability commonly decides whether manifests
+// are portable between clusters
+type NotableAPI struct {
+	GroupVersion string
+	Description  string
+}
+
+// notableAPIs are always listed in the capability matrix, available or not
+var notableAPIs = []NotableAPI{
+	{"batch/v1", "CronJob, Job"},
+	{"autoscaling/v2", "HorizontalPodAutoscaler v2"},
+	{"policy/v1", "PodDisruptionBudget"},
+	{"networking.k8s.io/v1", "Ingress, NetworkPolicy"},
+	{"discovery.k8s.io/v1", "EndpointSlice"},
+	{"flowcontrol.apiserver.k8s.io/v1", "API Priority and Fairness"},
+	{"admissionregistration.k8s.io/v1", "admission webhooks, ValidatingAdmissionPolicy"},
+	{"storage.k8s.io/v1", "StorageClass, CSIDriver"},
+	{"snapshot.storage.k8s.io/v1", "VolumeSnapshot"},
+	{"gateway.networking.k8s.io/v1", "Gateway API"},
+	{"metrics.k8s.io/v1beta1", "resource metrics from metrics-server"},
+	{"monitoring.coreos.com/v1", "Prometheus Operator"},
+	{"cert-manager.io/v1", "cert-manager"},
+}
+
+// APICapabilities are the API group versions served by a cluster
+type APICapabilities struct {
+	GroupVersions []string `json:"groupVersions"`
+}
+
+// Has reports whether groupVersion is served
+func (c *APICapabilities) Has(groupVersion string) bool {
+	i := sort.SearchStrings(c.GroupVersions, groupVersion)
+	return i < len(c.GroupVersions) && c.GroupVersions[i] == groupVersion
+}
+
+// DiscoverAPICapabilities lists the group versions the API server serves, core v1 included
+func DiscoverAPICapabilities(client discovery.DiscoveryInterface) (*APICapabilities, error) {
+	groups, err := client.ServerGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover API groups: %w", err)
+	}
+
+	capabilities := &APICapabilities{}
+	for _, group := range groups.Groups {
+		for _, version := range group.Versions {
+			capabilities.GroupVersions = append(capabilities.GroupVersions, version.GroupVersion)
+		}
+	}
+	sort.Strings(capabilities.GroupVersions)
+	return capabilities, nil
+}
+
+// CheckAPICapabilities reports which of the notable APIs the cluster serves. Missing APIs are
+// listed but do not fail the check, since they are often optional add-ons.
+func CheckAPICapabilities(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "api-capabilities"}
+
+	capabilities, err := DiscoverAPICapabilities(client.Discovery())
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	available := 0
+	for _, api := range notableAPIs {
+		if capabilities.Has(api.GroupVersion) {
+			available++
+			result.Details = append(result.Details, fmt.Sprintf("✓ %s (%s)", api.GroupVersion, api.Description))
+		} else {
+			result.Details = append(result.Details, fmt.Sprintf("✗ %s (%s) not served", api.GroupVersion, api.Description))
+		}
+	}
+
+	result.Status = CheckPass
+	result.Message = fmt.Sprintf("%d API group version(s) served; %d of %d notable APIs available",
+		len(capabilities.GroupVersions), available, len(notableAPIs))
+	return result
+}
+
+// PrintCapabilityMatrix prints which group versions each cluster serves: the notable APIs,
+// then every other group version not served by all clusters. Clusters are numbered in the
+// columns and listed in a legend below.
+func PrintCapabilityMatrix(results []FleetResult) {
+	var clusters []string
+	var capabilities []*APICapabilities
+	for _, result := range results {
+		if c, ok := result.Output.(*APICapabilities); ok && result.Err == nil {
+			clusters = append(clusters, result.Cluster.Identity().Key())
+			capabilities = append(capabilities, c)
+		}
+	}
+	if len(clusters) == 0 {
+		fmt.Println("\nNo cluster capabilities discovered")
+		return
+	}
+
+	rows := make([]string, 0, len(notableAPIs))
+	labels := map[string]string{}
+	notable := map[string]bool{}
+	for _, api := range notableAPIs {
+		rows = append(rows, api.GroupVersion)
+		labels[api.GroupVersion] = fmt.Sprintf("%s (%s)", api.GroupVersion, api.Description)
+		notable[api.GroupVersion] = true
+	}
+
+	served := map[string]int{}
+	for _, c := range capabilities {
+		for _, groupVersion := range c.GroupVersions {
+			served[groupVersion]++
+		}
+	}
+	var partial []string
+	for groupVersion, count := range served {
+		if count < len(clusters) && !notable[groupVersion] {
+			partial = append(partial, groupVersion)
+		}
+	}
+	sort.Strings(partial)
+	rows = append(rows, partial...)
+
+	width := 0
+	for _, row := range rows {
+		if label := labelOr(labels, row); len(label) > width {
+			width = len(label)
+		}
+	}
+
+	fmt.Printf("\n%-*s", width, "API")
+	for i := range clusters {
+		fmt.Printf("  %-3d", i+1)
+	}
+	fmt.Println()
+	for _, row := range rows {
+		fmt.Printf("%-*s", width, labelOr(labels, row))
+		for _, c := range capabilities {
+			mark := "✗"
+			if c.Has(row) {
+				mark = "✓"
+			}
+			fmt.Printf("  %-3s", mark)
+		}
+		fmt.Println()
+	}
+
+	fmt.Println()
+	for i, cluster := range clusters {
+		fmt.Printf("%3d  %s\n", i+1, cluster)
+	}
+	if len(partial) == 0 {
+		fmt.Println("\nAll other API group versions are served by every cluster")
+	}
+}
+
+// labelOr returns the label of key, or key itself when it has none
+func labelOr(labels map[string]string, key string) string {
+	if label, ok := labels[key]; ok {
+		return label
+	}
+	return key
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+// DefaultCertExpiryWindow flags certificates expiring within this long
+const DefaultCertExpiryWindow = 30 * 24 * time.Hour
+
+// certHandshakeTimeout bounds the TLS handshake that retrieves the API server certificate
+const certHandshakeTimeout = 10 * time.Second
+
+// certManagerCertificates is the cert-manager Certificate resource
+var certManagerCertificates = schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "certificates"}
+
+// CertificateExpiry is a certificate found on or served by a cluster
+type CertificateExpiry struct {
+	Source   string // e.g. "cluster CA" or "cert-manager default/web-tls"
+	Subject  string
+	NotAfter time.Time
+}
+
+// CollectCertificateExpiries gathers the expiry of the cluster CA, the API server's serving
+// certificate, the CA bundles of admission webhooks and, when cert-manager is installed, its
+// Certificates. Sources that cannot be read are returned as warnings.
+func CollectCertificateExpiries(ctx context.Context, client ClusterClient) ([]CertificateExpiry, []string) {
+	var certs []CertificateExpiry
+	var warnings []string
+	restConfig := client.RESTConfig()
+
+	for _, cert := range parsePEMCertificates(restConfig.CAData) {
+		certs = append(certs, CertificateExpiry{Source: "cluster CA", Subject: cert.Subject.String(), NotAfter: cert.NotAfter})
+	}
+
+	serving, err := servingCertificate(ctx, restConfig)
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("API server certificate not checked: %v", err))
+	} else {
+		certs = append(certs, CertificateExpiry{Source: "API server", Subject: serving.Subject.String(), NotAfter: serving.NotAfter})
+	}
+
+	clientset := client.Clientset()
+	validating, err := clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("validating webhooks not checked: %v", err))
+	} else {
+		for _, config := range validating.Items {
+			for _, webhook := range config.Webhooks {
+				certs = append(certs, webhookCertificates("validating webhook "+config.Name+"/"+webhook.Name, webhook.ClientConfig.CABundle)...)
+			}
+		}
+	}
+	mutating, err := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("mutating webhooks not checked: %v", err))
+	} else {
+		for _, config := range mutating.Items {
+			for _, webhook := range config.Webhooks {
+				certs = append(certs, webhookCertificates("mutating webhook "+config.Name+"/"+webhook.Name, webhook.ClientConfig.CABundle)...)
+			}
+		}
+	}
+
+	managed, err := certManagerExpiries(ctx, client)
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("cert-manager Certificates not checked: %v", err))
+	}
+	certs = append(certs, managed...)
+
+	sort.Slice(certs, func(i, j int) bool { return certs[i].NotAfter.Before(certs[j].NotAfter) })
+	return certs, warnings
+}
+
+// servingCertificate retrieves the API server's leaf certificate with a TLS handshake. The
+// certificate is only inspected, never trusted, so it is read even when it no longer verifies
+// (e.g. because it already expired).
+func servingCertificate(ctx context.Context, restConfig *rest.Config) (*x509.Certificate, error) {
+	endpoint, err := url.Parse(restConfig.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse API server endpoint %q: %w", restConfig.Host, err)
+	}
+	port := endpoint.Port()
+	if port == "" {
+		port = "443"
+	}
+	serverName := endpoint.Hostname()
+	if restConfig.ServerName != "" {
+		serverName = restConfig.ServerName
+	}
+
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: certHandshakeTimeout},
+		Config:    &tls.Config{ServerName: serverName, InsecureSkipVerify: true},
+	}
+	ctx, cancel := context.WithTimeout(ctx, certHandshakeTimeout)
+	defer cancel()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(endpoint.Hostname(), port))
+	if err != nil {
+		return nil, fmt.Errorf("TLS handshake failed: %w", err)
+	}
+	defer conn.Close()
+
+	peers := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("the API server presented no certificate")
+	}
+	return peers[0], nil
+}
+
+// webhookCertificates returns the certificates of a webhook's CA bundle
+func webhookCertificates(source string, caBundle []byte) []CertificateExpiry {
+	var certs []CertificateExpiry
+	for _, cert := range parsePEMCertificates(caBundle) {
+		certs = append(certs, CertificateExpiry{Source: source + " CA", Subject: cert.Subject.String(), NotAfter: cert.NotAfter})
+	}
+	return certs
+}
+
+// certManagerExpiries returns the expiry cert-manager reports for its Certificates, or nothing
+// when cert-manager is not installed
+func certManagerExpiries(ctx context.Context, client ClusterClient) ([]CertificateExpiry, error) {
+	dyn, err := client.Dynamic()
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []CertificateExpiry
+	err = eachObject(ctx, "cert-manager Certificates", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return dyn.Resource(certManagerCertificates).List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		item := obj.(*unstructured.Unstructured)
+		notAfter, found, _ := unstructured.NestedString(item.Object, "status", "notAfter")
+		if !found {
+			return nil
+		}
+		expiry, err := time.Parse(time.RFC3339, notAfter)
+		if err != nil {
+			return nil
+		}
+		secretName, _, _ := unstructured.NestedString(item.Object, "spec", "secretName")
+		certs = append(certs, CertificateExpiry{
+			Source:   "cert-manager " + objectName(item),
+			Subject:  secretName,
+			NotAfter: expiry,
+		})
+		return nil
+	})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	return certs, err
+}
+
+// parsePEMCertificates parses the certificates of a PEM bundle, skipping anything else
+func parsePEMCertificates(data []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+}
+
+// CheckCertificateExpiry fails when a certificate has expired and warns when one expires
+// within window
+func CheckCertificateExpiry(ctx context.Context, client ClusterClient, window time.Duration) CheckResult {
+	result := CheckResult{Name: "cert-expiry"}
+
+	certs, warnings := CollectCertificateExpiries(ctx, client)
+	now := time.Now()
+	expired, expiring := 0, 0
+	for _, cert := range certs {
+		remaining := cert.NotAfter.Sub(now)
+		switch {
+		case remaining <= 0:
+			expired++
+			result.Details = append(result.Details, fmt.Sprintf("✗ %s (%s) expired %s", cert.Source, cert.Subject, cert.NotAfter.Format(time.RFC3339)))
+		case remaining <= window:
+			expiring++
+			result.Details = append(result.Details, fmt.Sprintf("⚠ %s (%s) expires %s, in %d day(s)", cert.Source, cert.Subject, cert.NotAfter.Format(time.RFC3339), int(remaining.Hours()/24)))
+		default:
+			result.Details = append(result.Details, fmt.Sprintf("✓ %s expires %s", cert.Source, cert.NotAfter.Format("2006-01-02")))
+		}
+	}
+	for _, warning := range warnings {
+		result.Details = append(result.Details, "⚠ "+warning)
+	}
+
+	switch {
+	case expired > 0:
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%d of %d certificate(s) expired", expired, len(certs))
+		if expiring > 0 {
+			result.Message += fmt.Sprintf(", %d more expire within %s", expiring, window)
+		}
+		return result
+	case expiring > 0:
+		result.Status = CheckWarn
+		result.Message = fmt.Sprintf("%d of %d certificate(s) expire within %s", expiring, len(certs), window)
+		return result
+	}
+	result.Status = CheckPass
+	result.Message = fmt.Sprintf("%d certificate(s), none expiring within %s", len(certs), window)
+	return result
+}
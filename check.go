@@ -0,0 +1,503 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CheckStatus is the outcome of a diagnostic check, in increasing severity: pass, warn, fail.
+// A skipped check is as severe as a passed one.
+type CheckStatus string
+
+const (
+	CheckPass CheckStatus = "pass"
+	CheckSkip CheckStatus = "skip" // an optional check that timed out, or a check whose dependency failed
+	CheckWarn CheckStatus = "warn" // a non-critical finding, e.g. a version nearing end of support
+	CheckFail CheckStatus = "fail"
+)
+
+// SkipReason says why a check was skipped
+type SkipReason string
+
+const (
+	SkipTimeout          SkipReason = "timeout"           // an optional check that timed out
+	SkipDependencyFailed SkipReason = "dependency-failed" // a dependency failed or was skipped for one
+)
+
+// DefaultCheckTimeout bounds each check that sets no timeout of its own
+const DefaultCheckTimeout = 5 * time.Minute
+
+// checkTimeoutMargin is added to a probe's own timeout for its setup and cleanup
+const checkTimeoutMargin = time.Minute
+
+// DefaultFailOn is the check status that fails a run unless --fail-on says otherwise
+const DefaultFailOn = CheckFail
+
+// checkSeverity orders the check statuses
+var checkSeverity = map[CheckStatus]int{CheckPass: 0, CheckSkip: 0, CheckWarn: 1, CheckFail: 2}
+
+// AtLeast reports whether the status is as severe as threshold
+func (s CheckStatus) AtLeast(threshold CheckStatus) bool {
+	return checkSeverity[s] >= checkSeverity[threshold]
+}
+
+// ParseFailOn parses the --fail-on threshold: the least severe check status that fails a run
+func ParseFailOn(value string) (CheckStatus, error) {
+	switch status := CheckStatus(strings.ToLower(value)); status {
+	case CheckWarn, CheckFail:
+		return status, nil
+	default:
+		return "", fmt.Errorf("unknown --fail-on severity %q (expected warn or fail)", value)
+	}
+}
+
+// CheckResult is the outcome of running a single check against a cluster
+type CheckResult struct {
+	Name    string
+	Status  CheckStatus
+	Message string
+	Details []string
+	// SkipReason says why a check with status CheckSkip did not run
+	SkipReason SkipReason
+}
+
+// Check is a named diagnostic that can be run against a connected cluster
+type Check struct {
+	Name        string
+	Description string
+	Optional    bool // only run when requested by name, e.g. because it creates resources
+	// Timeout bounds the check. An optional check that exceeds it is skipped, a required one
+	// fails.
+	Timeout time.Duration
+	// DependsOn names the checks that must pass for this one to be worth running; connection
+	// when nil. A check is skipped when one of its dependencies in the same run failed.
+	DependsOn []string
+	Run       func(ctx context.Context, client ClusterClient) CheckResult
+}
+
+// CheckOptions holds the tunables shared by the built-in checks
+type CheckOptions struct {
+	PendingThreshold time.Duration // how long a pod may stay Pending before it is reported
+	UpgradeTarget    string        // minor release preflight-upgrade checks against; empty for the next one
+	CertExpiryWindow time.Duration // how soon a certificate may expire before it is reported
+	SPExpiryWindow   time.Duration // how soon an Azure service principal secret may expire before it is reported
+	LBProbeTimeout   time.Duration // timeout of each load balancer probe
+	RequireQuotas    bool          // fail resource-quotas for application namespaces without a ResourceQuota
+	DNSProbe         DNSProbeOptions
+	StorageProbe     StorageProbeOptions
+	NetpolProbe      NetworkPolicyProbeOptions
+	WindowsProbe     WindowsProbeOptions
+	ArchProbe        ArchProbeOptions
+	VersionPolicies  []VersionPolicy          // evaluated by version-policy; from the fleet config
+	CheckTimeout     time.Duration            // timeout of checks without a timeout of their own
+	CheckTimeouts    map[string]time.Duration // timeouts by check name, overriding the defaults
+}
+
+// DefaultCheckOptions returns the options used when none are given on the command line
+func DefaultCheckOptions() CheckOptions {
+	return CheckOptions{
+		PendingThreshold: 5 * time.Minute,
+		CertExpiryWindow: DefaultCertExpiryWindow,
+		SPExpiryWindow:   DefaultSPExpiryWindow,
+		CheckTimeout:     DefaultCheckTimeout,
+		LBProbeTimeout:   DefaultLBProbeTimeout,
+		DNSProbe: DNSProbeOptions{
+			Image:          DefaultProbeImage,
+			Namespace:      "default",
+			ClusterDomain:  "cluster.local",
+			ExternalDomain: "example.com",
+			Timeout:        2 * time.Minute,
+		},
+		StorageProbe: StorageProbeOptions{
+			Size:      "1Gi",
+			Image:     DefaultProbeImage,
+			Namespace: "default",
+			Timeout:   5 * time.Minute,
+		},
+		NetpolProbe: NetworkPolicyProbeOptions{
+			Image:     DefaultProbeImage,
+			Namespace: "default",
+			Timeout:   2 * time.Minute,
+		},
+		WindowsProbe: WindowsProbeOptions{
+			Image:     DefaultWindowsProbeImage,
+			Namespace: "default",
+			Timeout:   10 * time.Minute,
+		},
+		ArchProbe: ArchProbeOptions{
+			Image:     DefaultProbeImage,
+			Namespace: "default",
+			Timeout:   2 * time.Minute,
+		},
+	}
+}
+
+// builtinChecks returns the checks known to the tool, configured with opts
+func builtinChecks(opts CheckOptions) []Check {
+	checks := []Check{
+		{
+			Name:        "connection",
+			Description: "credentials, DNS, TCP, TLS, authentication and RBAC of the API server connection",
+			DependsOn:   []string{},
+			Run:         CheckConnection,
+		},
+		{
+			Name:        "pending-pods",
+			Description: "pods stuck in Pending and why they cannot be scheduled",
+			Run: func(ctx context.Context, client ClusterClient) CheckResult {
+				return CheckPendingPods(ctx, client, opts.PendingThreshold)
+			},
+		},
+		{
+			Name:        "pdb",
+			Description: "PodDisruptionBudgets that currently block voluntary evictions",
+			Run:         CheckPodDisruptionBudgets,
+		},
+		{
+			Name:        "api-capabilities",
+			Description: "API group versions served, such as batch/v1, autoscaling/v2 and the Gateway API",
+			Run:         CheckAPICapabilities,
+		},
+		{
+			Name:        "api-health",
+			Description: "API server /readyz and /livez checks, covering etcd and controller health",
+			Run:         CheckAPIServerHealth,
+		},
+		{
+			Name:        "etcd-objects",
+			Description: "object counts by resource type and etcd database size, from API server metrics",
+			Run:         CheckEtcdUsage,
+		},
+		{
+			Name:        "accelerators",
+			Description: "GPU and other accelerator node pools and the health of their device plugins",
+			Run:         CheckAccelerators,
+		},
+		{
+			Name:        "windows-nodes",
+			Description: "Windows node pools, their OS image and runtime, and Windows nodes that are not Ready",
+			Run:         CheckWindowsNodes,
+		},
+		{
+			Name:        "architectures",
+			Description: "node CPU architecture mix by pool, such as arm64 pools next to amd64 ones",
+			Run:         CheckArchitectures,
+		},
+		{
+			Name:        "spot-capacity",
+			Description: "node pools on spot, preemptible or low-priority capacity and their share of the cluster",
+			Run:         CheckSpotCapacity,
+		},
+		{
+			Name:        "autoscaler",
+			Description: "cluster-autoscaler or Karpenter health and recent scale-up failures",
+			Run:         CheckAutoscaler,
+		},
+		{
+			Name:        "network-policy",
+			Description: "CNI plugin and network policy engine, and whether NetworkPolicies are enforced",
+			Run:         CheckNetworkPolicySupport,
+		},
+		{
+			Name:        "ip-addressing",
+			Description: "IPv4, IPv6 or dual-stack, the client's address family and pod/service CIDR usage",
+			Run:         CheckIPAddressing,
+		},
+		{
+			Name:        "service-mesh",
+			Description: "Istio, Anthos Service Mesh, Linkerd or App Mesh versions, injection and sidecar coverage",
+			Run:         CheckServiceMesh,
+		},
+		{
+			Name:        "policy-engines",
+			Description: "OPA Gatekeeper constraints and Kyverno policies with their violation counts",
+			Run:         CheckPolicyEngines,
+		},
+		{
+			Name:        "priority-classes",
+			Description: "PriorityClasses with their value, preemption policy and the pods using them",
+			Run:         CheckPriorityClasses,
+		},
+		{
+			Name:        "resource-quotas",
+			Description: "ResourceQuotas and LimitRanges per namespace, and namespaces without a quota",
+			Run: func(ctx context.Context, client ClusterClient) CheckResult {
+				return CheckResourceQuotas(ctx, client, opts.RequireQuotas)
+			},
+		},
+		{
+			Name:        "pod-security",
+			Description: "Pod Security Admission labels of every namespace and namespaces with no restriction",
+			Run:         CheckPodSecurity,
+		},
+		{
+			Name:        "registries",
+			Description: "registries running pods pull from and whether their imagePullSecrets exist and parse",
+			Run:         CheckRegistries,
+		},
+		{
+			Name:        "preflight-upgrade",
+			Description: "resources and clients using APIs removed by the next minor release",
+			Run: func(ctx context.Context, client ClusterClient) CheckResult {
+				return CheckUpgradePreflight(ctx, client, opts.UpgradeTarget)
+			},
+		},
+		{
+			Name:        "cert-expiry",
+			Description: "cluster CA, API server, webhook and cert-manager certificates close to expiry",
+			// An expired certificate may be why the connection fails
+			DependsOn: []string{},
+			Run: func(ctx context.Context, client ClusterClient) CheckResult {
+				return CheckCertificateExpiry(ctx, client, opts.CertExpiryWindow)
+			},
+		},
+		{
+			Name:        "sp-expiry",
+			Description: "expiry of the Azure service principal client secret or certificate the tool authenticates with",
+			DependsOn:   []string{}, // reads Microsoft Graph only
+			Run: func(ctx context.Context, client ClusterClient) CheckResult {
+				return CheckServicePrincipalExpiry(ctx, client, opts.SPExpiryWindow)
+			},
+		},
+		{
+			Name:        "version-policy",
+			Description: "Kubernetes version and release channel policies of the fleet config",
+			Optional:    len(opts.VersionPolicies) == 0,
+			DependsOn:   []string{}, // reads the cloud API only
+			Run: func(ctx context.Context, client ClusterClient) CheckResult {
+				return CheckVersionPolicies(ctx, client, opts.VersionPolicies)
+			},
+		},
+		{
+			Name:        "lb-probe",
+			Description: "probes the external addresses of LoadBalancer Services and Ingresses from this machine",
+			Optional:    true,
+			Run: func(ctx context.Context, client ClusterClient) CheckResult {
+				return CheckLoadBalancers(ctx, client, opts.LBProbeTimeout)
+			},
+		},
+		{
+			Name:        "registry-probe",
+			Description: "requests an image manifest from every registry in use, with pull secret or cloud credentials",
+			Optional:    true,
+			Run:         CheckRegistryProbe,
+		},
+		{
+			Name:        "dns-probe",
+			Description: "launches a pod that checks CoreDNS, egress and the cloud metadata endpoint",
+			Optional:    true,
+			Timeout:     opts.DNSProbe.Timeout + checkTimeoutMargin,
+			DependsOn:   []string{"api-health"},
+			Run: func(ctx context.Context, client ClusterClient) CheckResult {
+				return CheckDNSProbe(ctx, client, opts.DNSProbe)
+			},
+		},
+		{
+			Name:        "storage-probe",
+			Description: "creates a small PVC and pod to verify dynamic volume provisioning",
+			Optional:    true,
+			Timeout:     opts.StorageProbe.Timeout + checkTimeoutMargin,
+			DependsOn:   []string{"api-health"},
+			Run: func(ctx context.Context, client ClusterClient) CheckResult {
+				return CheckStorageProbe(ctx, client, opts.StorageProbe)
+			},
+		},
+		{
+			Name:        "netpol-probe",
+			Description: "launches two pods and a deny policy to verify NetworkPolicies are enforced",
+			Optional:    true,
+			Timeout:     opts.NetpolProbe.Timeout + checkTimeoutMargin,
+			DependsOn:   []string{"api-health", "network-policy"},
+			Run: func(ctx context.Context, client ClusterClient) CheckResult {
+				return CheckNetworkPolicyProbe(ctx, client, opts.NetpolProbe)
+			},
+		},
+		{
+			Name:        "windows-probe",
+			Description: "schedules a pod onto a Windows node to verify Windows scheduling and networking",
+			Optional:    true,
+			Timeout:     opts.WindowsProbe.Timeout + checkTimeoutMargin,
+			DependsOn:   []string{"api-health"},
+			Run: func(ctx context.Context, client ClusterClient) CheckResult {
+				return CheckWindowsProbe(ctx, client, opts.WindowsProbe)
+			},
+		},
+		{
+			Name:        "arch-probe",
+			Description: "runs the probe image on a node of each architecture to verify multi-arch scheduling",
+			Optional:    true,
+			Timeout:     opts.ArchProbe.Timeout + checkTimeoutMargin,
+			DependsOn:   []string{"api-health"},
+			Run: func(ctx context.Context, client ClusterClient) CheckResult {
+				return CheckArchProbe(ctx, client, opts.ArchProbe)
+			},
+		},
+	}
+	for i := range checks {
+		if timeout, ok := opts.CheckTimeouts[checks[i].Name]; ok {
+			checks[i].Timeout = timeout
+		} else if checks[i].Timeout == 0 {
+			checks[i].Timeout = opts.CheckTimeout
+		}
+		if checks[i].DependsOn == nil {
+			checks[i].DependsOn = []string{"connection"}
+		}
+	}
+	return checks
+}
+
+// ParseCheckTimeouts parses the --check-timeout flag: comma-separated durations, each either
+// name=duration for one check or a bare duration for all other checks, e.g.
+// 2m,lb-probe=30s,storage-probe=10m
+func ParseCheckTimeouts(value string, opts *CheckOptions) error {
+	known := map[string]bool{}
+	for _, check := range builtinChecks(*opts) {
+		known[check.Name] = true
+	}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, durationText, named := strings.Cut(entry, "=")
+		if !named {
+			name, durationText = "", entry
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(durationText))
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid check timeout %q (expected a positive duration or name=duration)", entry)
+		}
+		if !named {
+			opts.CheckTimeout = timeout
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if !known[name] {
+			return fmt.Errorf("invalid check timeout %q: unknown check %q", entry, name)
+		}
+		if opts.CheckTimeouts == nil {
+			opts.CheckTimeouts = map[string]time.Duration{}
+		}
+		opts.CheckTimeouts[name] = timeout
+	}
+	return nil
+}
+
+// selectChecks returns the checks matching names, or all non-optional checks when names is empty
+func selectChecks(checks []Check, names []string) ([]Check, error) {
+	if len(names) == 0 {
+		var selected []Check
+		for _, check := range checks {
+			if !check.Optional {
+				selected = append(selected, check)
+			}
+		}
+		return selected, nil
+	}
+
+	byName := make(map[string]Check, len(checks))
+	for _, check := range checks {
+		byName[check.Name] = check
+	}
+
+	selected := make([]Check, 0, len(names))
+	for _, name := range names {
+		check, ok := byName[name]
+		if !ok {
+			known := make([]string, 0, len(checks))
+			for _, c := range checks {
+				known = append(known, c.Name)
+			}
+			return nil, fmt.Errorf("unknown check %q (available: %s)", name, strings.Join(known, ", "))
+		}
+		selected = append(selected, check)
+	}
+
+	return selected, nil
+}
+
+// PrintCheckResult prints a check result for humans
+func PrintCheckResult(result CheckResult) {
+	symbol := "✓"
+	switch result.Status {
+	case CheckSkip:
+		symbol = "○"
+	case CheckWarn:
+		symbol = "⚠"
+	case CheckFail:
+		symbol = "✗"
+	}
+
+	fmt.Printf("%s %s: %s\n", symbol, result.Name, Redact(result.Message))
+	for _, detail := range result.Details {
+		fmt.Printf("    %s\n", Redact(detail))
+	}
+}
+
+// runChecks runs checks against client in order, each after the checks it depends on, and
+// returns an error if any of them reported failOn or a more severe status; warnings below failOn
+// do not fail the run. Checks whose dependencies failed are skipped rather than run.
+func runChecks(ctx context.Context, client ClusterClient, checks []Check, failOn CheckStatus) ([]CheckResult, error) {
+	if failOn == "" {
+		failOn = DefaultFailOn
+	}
+	results := make([]CheckResult, 0, len(checks))
+	failed := 0
+	blocked := map[string]bool{}
+	for _, check := range orderChecks(checks) {
+		var result CheckResult
+		if dependencies := failedDependencies(check, blocked); len(dependencies) > 0 {
+			result = dependencySkipped(check, dependencies)
+			blocked[check.Name] = true
+		} else {
+			result = runCheck(ctx, client, check)
+			blocked[check.Name] = result.Status == CheckFail
+		}
+		if result.Status.AtLeast(failOn) {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if failed > 0 {
+		if failOn == CheckWarn {
+			return results, fmt.Errorf("%d of %d check(s) failed or warned", failed, len(checks))
+		}
+		return results, fmt.Errorf("%d of %d check(s) failed", failed, len(checks))
+	}
+	return results, nil
+}
+
+// runCheck runs check within its timeout. A check still running when the timeout passes is
+// abandoned, and its result is skipped for an optional check or failed otherwise. Probes clean
+// up their resources with a context of their own.
+func runCheck(ctx context.Context, client ClusterClient, check Check) CheckResult {
+	if check.Timeout <= 0 {
+		return check.Run(ctx, client)
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+
+	done := make(chan CheckResult, 1)
+	go func() {
+		done <- check.Run(checkCtx, client)
+	}()
+	select {
+	case result := <-done:
+		// A check that gave up because its deadline passed timed out as well
+		if result.Status == CheckPass || checkCtx.Err() == nil || ctx.Err() != nil {
+			return result
+		}
+	case <-checkCtx.Done():
+		if ctx.Err() != nil {
+			return CheckResult{Name: check.Name, Status: CheckFail, Message: fmt.Sprintf("interrupted: %v", ctx.Err())}
+		}
+	}
+	if check.Optional {
+		Verbosef("Check %s on %s timed out after %s", check.Name, client.Identity().Key(), check.Timeout)
+		return CheckResult{Name: check.Name, Status: CheckSkip, Message: fmt.Sprintf("skipped (timeout after %s)", check.Timeout), SkipReason: SkipTimeout}
+	}
+	return CheckResult{Name: check.Name, Status: CheckFail, Message: fmt.Sprintf("timed out after %s", check.Timeout)}
+}
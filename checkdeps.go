@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// connectionCheckTimeout bounds each stage of the connection check
+const connectionCheckTimeout = 10 * time.Second
+
+// CheckConnection walks the connection to the API server and fails at the first stage that
+// fails, such as TLS or authentication; the checks depending on it are then skipped. An API
+// server that is connected but not ready is left to api-health.
+func CheckConnection(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "connection"}
+
+	report := DiagnoseConnection(ctx, client, connectionCheckTimeout)
+	for _, step := range report.Steps {
+		if step.Error != "" {
+			result.Details = append(result.Details, fmt.Sprintf("✗ %s: %s", step.Stage, step.Error))
+			continue
+		}
+		result.Details = append(result.Details, fmt.Sprintf("✓ %s: %s", step.Stage, step.Detail))
+	}
+	result.Details = append(result.Details, report.Hints...)
+
+	if report.Failed != ConnectionNone && report.Failed != ConnectionHealthy {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("connection failed at stage %v", report.Err())
+		return result
+	}
+	result.Status = CheckPass
+	result.Message = fmt.Sprintf("connected to %s", report.Endpoint)
+	if report.User != "" {
+		result.Message += " as " + report.User
+	}
+	return result
+}
+
+// orderChecks orders checks so that every check runs after the checks it depends on, keeping
+// the given order otherwise. Dependencies that are not among checks are ignored.
+func orderChecks(checks []Check) []Check {
+	pending := map[string]bool{}
+	for _, check := range checks {
+		pending[check.Name] = true
+	}
+	ordered := make([]Check, 0, len(checks))
+	remaining := checks
+	for len(remaining) > 0 {
+		var next []Check
+		for _, check := range remaining {
+			ready := true
+			for _, dependency := range check.DependsOn {
+				if pending[dependency] && dependency != check.Name {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				ordered = append(ordered, check)
+				delete(pending, check.Name)
+			} else {
+				next = append(next, check)
+			}
+		}
+		if len(next) == len(remaining) {
+			// A dependency cycle: run the rest in the given order
+			return append(ordered, next...)
+		}
+		remaining = next
+	}
+	return ordered
+}
+
+// failedDependencies returns the dependencies of check that failed or were skipped because of
+// a failure of their own
+func failedDependencies(check Check, blocked map[string]bool) []string {
+	var failed []string
+	for _, dependency := range check.DependsOn {
+		if blocked[dependency] {
+			failed = append(failed, dependency)
+		}
+	}
+	return failed
+}
+
+// dependencySkipped returns the result of a check skipped because dependencies failed
+func dependencySkipped(check Check, dependencies []string) CheckResult {
+	return CheckResult{
+		Name:       check.Name,
+		Status:     CheckSkip,
+		Message:    fmt.Sprintf("skipped (dependency failed: %s)", strings.Join(dependencies, ", ")),
+		SkipReason: SkipDependencyFailed,
+	}
+}
+
+// isDependencySkip reports whether result is of a check skipped because dependencies failed
+func isDependencySkip(result CheckResult) bool {
+	return result.Status == CheckSkip && result.SkipReason == SkipDependencyFailed
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ClusterChecks enables or disables individual checks for one cluster of a fleet config
+type ClusterChecks struct {
+	// Include lists optional checks also run on the cluster when no checks are named, and checks
+	// to run despite the provider defaults
+	Include []string `json:"include,omitempty"`
+	// Exclude lists checks never run on the cluster
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Validate checks that every named check exists and is not both included and excluded
+func (c ClusterChecks) Validate() error {
+	known := map[string]bool{}
+	for _, check := range builtinChecks(DefaultCheckOptions()) {
+		known[check.Name] = true
+	}
+	included := map[string]bool{}
+	for _, name := range c.Include {
+		if !known[name] {
+			return fmt.Errorf("checks.include: unknown check %q", name)
+		}
+		included[name] = true
+	}
+	for _, name := range c.Exclude {
+		if !known[name] {
+			return fmt.Errorf("checks.exclude: unknown check %q", name)
+		}
+		if included[name] {
+			return fmt.Errorf("check %q is both included and excluded", name)
+		}
+	}
+	return nil
+}
+
+// ClusterTraits are properties of a cluster that decide which checks apply to it by default
+type ClusterTraits struct {
+	Autopilot   bool // GKE Autopilot, where Google manages nodes, node pools and autoscaling
+	FargateOnly bool // EKS with Fargate profiles and no managed node groups
+}
+
+// traitsReporter is implemented by clients that can read their cluster's traits from the cloud API
+type traitsReporter interface {
+	ClusterTraits(ctx context.Context) (*ClusterTraits, error)
+}
+
+// autopilotSkippedChecks do not apply to GKE Autopilot clusters: their nodes, Windows support
+// and autoscaling are managed by Google, and probe pods requesting storage are subject to
+// Autopilot's resource rules
+var autopilotSkippedChecks = []string{"storage-probe", "windows-nodes", "windows-probe", "autoscaler"}
+
+// fargateSkippedChecks do not apply to Fargate-only EKS clusters, which have no nodes to list,
+// schedule probes onto or autoscale, and do not support EBS volumes
+var fargateSkippedChecks = []string{"accelerators", "windows-nodes", "architectures", "spot-capacity",
+	"autoscaler", "storage-probe", "windows-probe", "arch-probe"}
+
+// defaultSkippedChecks returns the checks skipped on a cluster with traits, with the reason
+func defaultSkippedChecks(traits *ClusterTraits) (map[string]bool, string) {
+	switch {
+	case traits == nil:
+		return nil, ""
+	case traits.Autopilot:
+		return checkSet(autopilotSkippedChecks), "GKE Autopilot cluster"
+	case traits.FargateOnly:
+		return checkSet(fargateSkippedChecks), "Fargate-only EKS cluster"
+	}
+	return nil, ""
+}
+
+// ChecksForCluster narrows checks to those that apply to the cluster client is connected to.
+// The checks of the fleet config entry's exclude list are dropped, as are those that do not
+// apply to the cluster's traits, such as node checks on Fargate-only EKS clusters, unless the
+// entry includes them. Checks of optional that the entry includes are added; optional is nil
+// when checks were named on the command line.
+func ChecksForCluster(ctx context.Context, client ClusterClient, checks, optional []Check) []Check {
+	var spec ClusterChecks
+	if cluster, ok := fleetClusterFromContext(ctx); ok {
+		spec = cluster.Checks
+	}
+	included, excluded := checkSet(spec.Include), checkSet(spec.Exclude)
+
+	var skipped map[string]bool
+	var reason string
+	if reporter, ok := client.(traitsReporter); ok {
+		traits, err := reporter.ClusterTraits(ctx)
+		if err != nil {
+			Verbosef("Could not read the traits of %s, running all checks: %v", client.Identity().Key(), err)
+		}
+		skipped, reason = defaultSkippedChecks(traits)
+	}
+
+	candidates := append([]Check{}, checks...)
+	for _, check := range optional {
+		if included[check.Name] {
+			candidates = append(candidates, check)
+		}
+	}
+
+	selected := make([]Check, 0, len(candidates))
+	var dropped []string
+	for _, check := range candidates {
+		switch {
+		case excluded[check.Name]:
+			dropped = append(dropped, check.Name+" (excluded)")
+		case skipped[check.Name] && !included[check.Name]:
+			dropped = append(dropped, check.Name+" ("+reason+")")
+		default:
+			selected = append(selected, check)
+		}
+	}
+	if len(dropped) > 0 {
+		Verbosef("Skipping checks on %s: %s", client.Identity().Key(), strings.Join(dropped, ", "))
+	}
+	return selected
+}
+
+// optionalChecks returns the checks of available not in selected
+func optionalChecks(available, selected []Check) []Check {
+	names := map[string]bool{}
+	for _, check := range selected {
+		names[check.Name] = true
+	}
+	var optional []Check
+	for _, check := range available {
+		if !names[check.Name] {
+			optional = append(optional, check)
+		}
+	}
+	return optional
+}
+
+// checkSet returns names as a set
+func checkSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+// fleetClusterKey is the context key of the fleet config entry an operation runs for
+type fleetClusterKey struct{}
+
+// withFleetCluster returns ctx carrying the fleet config entry an operation runs for
+func withFleetCluster(ctx context.Context, cluster FleetCluster) context.Context {
+	return context.WithValue(ctx, fleetClusterKey{}, cluster)
+}
+
+// fleetClusterFromContext returns the fleet config entry an operation runs for, if any
+func fleetClusterFromContext(ctx context.Context) (FleetCluster, bool) {
+	cluster, ok := ctx.Value(fleetClusterKey{}).(FleetCluster)
+	return cluster, ok
+}
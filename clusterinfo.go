@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ClusterInfo is a provider-neutral summary of a managed cluster as reported by the cloud API
+type ClusterInfo struct {
+	Name        string            `json:"name"`
+	Provider    Provider          `json:"provider"`
+	Account     string            `json:"account,omitempty"`
+	Region      string            `json:"region,omitempty"`
+	Version     string            `json:"version,omitempty"`
+	Endpoint    string            `json:"endpoint,omitempty"`
+	Status      string            `json:"status,omitempty"`
+	NodeCount   int               `json:"nodeCount"`
+	Network     string            `json:"network,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"` // AKS/EKS tags or GKE resource labels
+	Maintenance *MaintenanceInfo  `json:"maintenance,omitempty"`
+	// ReleaseChannel is the GKE release channel or AKS auto-upgrade channel, none without one, or
+	// the EKS support type (STANDARD or EXTENDED)
+	ReleaseChannel string            `json:"releaseChannel,omitempty"`
+	Warnings       []string          `json:"warnings,omitempty"`
+	Details        map[string]string `json:"details,omitempty"` // provider-specific attributes
+}
+
+// PrintClusterInfo renders cluster information for humans
+func PrintClusterInfo(info *ClusterInfo) {
+	fmt.Printf("%s Cluster Information:\n", strings.ToUpper(string(info.Provider)))
+	fmt.Printf("  Name: %s\n", info.Name)
+	printIfSet("Account", info.Account)
+	printIfSet("Region", info.Region)
+	printIfSet("Status", info.Status)
+	printIfSet("Kubernetes Version", info.Version)
+	printIfSet("Endpoint", info.Endpoint)
+	fmt.Printf("  Total Nodes: %d\n", info.NodeCount)
+	printIfSet("Network", info.Network)
+	if !info.CreatedAt.IsZero() {
+		fmt.Printf("  Created: %s\n", info.CreatedAt.Format(time.RFC3339))
+	}
+
+	if len(info.Tags) > 0 {
+		fmt.Printf("  Tags: %s\n", labels.Set(info.Tags).String())
+	}
+
+	keys := make([]string, 0, len(info.Details))
+	for key := range info.Details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("  %s: %s\n", key, info.Details[key])
+	}
+
+	if info.Maintenance != nil {
+		PrintMaintenanceInfo(info.Maintenance)
+	}
+
+	for _, warning := range info.Warnings {
+		fmt.Printf("  ⚠ %s\n", warning)
+	}
+}
+
+// printIfSet prints a labelled value unless it is empty
+func printIfSet(label, value string) {
+	if value != "" {
+		fmt.Printf("  %s: %s\n", label, value)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultClientTTL is how long a ClusterRegistry reuses a client before connecting again
+	DefaultClientTTL = 30 * time.Minute
+	// DefaultHealthInterval is how long a ClusterRegistry trusts a client's last health check
+	DefaultHealthInterval = time.Minute
+)
+
+// ClusterRegistryOptions configures how long a ClusterRegistry reuses clients
+type ClusterRegistryOptions struct {
+	// TTL is how long a client is reused after it connected (default DefaultClientTTL)
+	TTL time.Duration
+	// HealthInterval is how long after its last successful health check a client is reused
+	// without checking the API server's /readyz again (default DefaultHealthInterval)
+	HealthInterval time.Duration
+}
+
+// ClusterRegistry caches connected clients by cluster identity, so long-running callers reuse
+// cloud SDK clients and tokens instead of connecting for every request. Clients are evicted when
+// their TTL passes or their health check fails, and closed once the last caller using them has
+// released them. It is safe for concurrent use.
+type ClusterRegistry struct {
+	opts ClusterRegistryOptions
+
+	mu      sync.Mutex
+	entries map[string]*registryEntry
+	closed  bool
+}
+
+// registryEntry is a cached client; ready is closed once connecting has finished
+type registryEntry struct {
+	ready     chan struct{}
+	client    ClusterClient
+	err       error
+	connected time.Time
+	checked   time.Time
+	leases    int
+	evicted   bool
+}
+
+// NewClusterRegistry creates an empty registry, applying defaults to unset options
+func NewClusterRegistry(opts ClusterRegistryOptions) *ClusterRegistry {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultClientTTL
+	}
+	if opts.HealthInterval <= 0 {
+		opts.HealthInterval = DefaultHealthInterval
+	}
+	return &ClusterRegistry{opts: opts, entries: map[string]*registryEntry{}}
+}
+
+// Get returns the cached client for id, connecting with connect when none is cached or the cached
+// one expired or is unhealthy. Concurrent callers for the same cluster share one connection
+// attempt. The returned release function must be called once the caller is done with the client.
+func (r *ClusterRegistry) Get(ctx context.Context, id ClusterIdentity, connect func() (ClusterClient, error)) (ClusterClient, func(), error) {
+	key := id.Key()
+	for {
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			return nil, nil, fmt.Errorf("cluster registry is closed")
+		}
+		entry, ok := r.entries[key]
+		if !ok {
+			entry = &registryEntry{ready: make(chan struct{}), leases: 1}
+			r.entries[key] = entry
+			r.mu.Unlock()
+			return r.connect(key, entry, connect)
+		}
+		entry.leases++
+		r.mu.Unlock()
+
+		select {
+		case <-entry.ready:
+		case <-ctx.Done():
+			r.release(entry)
+			return nil, nil, ctx.Err()
+		}
+		if entry.err != nil {
+			// The attempt that failed already removed the entry; try again
+			r.release(entry)
+			return nil, nil, entry.err
+		}
+		if r.usable(ctx, entry) {
+			return entry.client, r.releaseFunc(entry), nil
+		}
+		r.evict(key, entry)
+		r.release(entry)
+	}
+}
+
+// connect connects the client of a new entry, removing the entry again when it fails
+func (r *ClusterRegistry) connect(key string, entry *registryEntry, connect func() (ClusterClient, error)) (ClusterClient, func(), error) {
+	client, err := connect()
+	now := time.Now()
+
+	r.mu.Lock()
+	entry.client, entry.err = client, err
+	entry.connected, entry.checked = now, now
+	if err != nil {
+		entry.evicted = true
+		entry.leases--
+		if r.entries[key] == entry {
+			delete(r.entries, key)
+		}
+	}
+	r.mu.Unlock()
+	close(entry.ready)
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, r.releaseFunc(entry), nil
+}
+
+// usable reports whether entry is within its TTL and, when its last health check is older than
+// the health interval, whether the API server is still ready for it
+func (r *ClusterRegistry) usable(ctx context.Context, entry *registryEntry) bool {
+	r.mu.Lock()
+	evicted, connected, checked := entry.evicted, entry.connected, entry.checked
+	r.mu.Unlock()
+
+	now := time.Now()
+	if evicted || now.Sub(connected) >= r.opts.TTL {
+		return false
+	}
+	// Clients constructed with DeferKubernetes and not yet connected have nothing to check
+	if now.Sub(checked) < r.opts.HealthInterval || entry.client.RESTConfig() == nil {
+		return true
+	}
+
+	checkCtx, cancel := withPhaseTimeout(ctx, PhaseKubernetes)
+	defer cancel()
+	if _, err := entry.client.RawRequest(checkCtx, "GET", "/readyz"); err != nil {
+		Verbosef("Cached client for %s failed its health check, reconnecting: %v", entry.client.Identity().Key(), err)
+		return false
+	}
+	r.mu.Lock()
+	entry.checked = time.Now()
+	r.mu.Unlock()
+	return true
+}
+
+// Evict removes the cached client for id, e.g. after a caller saw its credentials rejected. It is
+// closed once released by every caller using it.
+func (r *ClusterRegistry) Evict(id ClusterIdentity) {
+	key := id.Key()
+	r.mu.Lock()
+	entry, ok := r.entries[key]
+	r.mu.Unlock()
+	if ok {
+		r.evict(key, entry)
+	}
+}
+
+// evict marks entry evicted and removes it from the registry, closing it when unused
+func (r *ClusterRegistry) evict(key string, entry *registryEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.entries[key] == entry {
+		delete(r.entries, key)
+	}
+	if !entry.evicted {
+		entry.evicted = true
+		r.closeIfUnused(entry)
+	}
+}
+
+// releaseFunc returns a function releasing one lease on entry, safe to call more than once
+func (r *ClusterRegistry) releaseFunc(entry *registryEntry) func() {
+	var once sync.Once
+	return func() { once.Do(func() { r.release(entry) }) }
+}
+
+// release gives up a lease on entry, closing it when it was evicted and this was the last lease
+func (r *ClusterRegistry) release(entry *registryEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry.leases--
+	r.closeIfUnused(entry)
+}
+
+// closeIfUnused closes an evicted entry's client once no caller holds it; r.mu must be held
+func (r *ClusterRegistry) closeIfUnused(entry *registryEntry) {
+	if !entry.evicted || entry.leases > 0 || entry.client == nil {
+		return
+	}
+	client := entry.client
+	entry.client = nil
+	go func() {
+		if err := client.Close(); err != nil {
+			Verbosef("Failed to close client for %s: %v", client.Identity().Key(), err)
+		}
+	}()
+}
+
+// Len returns the number of cached clients
+func (r *ClusterRegistry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.entries)
+}
+
+// Close evicts every cached client and rejects further Gets. Clients still in use are closed when
+// released.
+func (r *ClusterRegistry) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	entries := r.entries
+	r.entries = map[string]*registryEntry{}
+	r.mu.Unlock()
+
+	for key, entry := range entries {
+		select {
+		case <-entry.ready:
+			r.evict(key, entry)
+		default:
+			// Still connecting; the client is closed when its connecting caller releases it
+			r.mu.Lock()
+			entry.evicted = true
+			r.mu.Unlock()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,1344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// runCommand dispatches a command line subcommand
+func runCommand(name string, args []string) error {
+	switch name {
+	case "info":
+		return runInfoCommand(args)
+	case "whoami":
+		return runWhoamiCommand(args)
+	case "kubeconfig":
+		return runKubeconfigCommand(args)
+	case "pods":
+		return runPodsCommand(args)
+	case "top":
+		return runTopCommand(args)
+	case "get":
+		return runGetCommand(args)
+	case "registry-secret":
+		return runRegistrySecretCommand(args)
+	case "rotate-gcp-key":
+		return runRotateGCPKeyCommand(args)
+	case "access":
+		return runAccessCommand(args)
+	case "check":
+		return runCheckCommand(args)
+	case "nettest":
+		return runNetTestCommand(args)
+	case "diagnose":
+		return runDiagnoseCommand(args)
+	case "nodepool":
+		return runNodePoolCommand(args)
+	case "fleet":
+		return runFleetCommand(args)
+	case "compare":
+		return runCompareCommand(args)
+	case "drift":
+		return runDriftCommand(args)
+	case "config":
+		return runConfigCommand(args)
+	case "report":
+		return runReportCommand(args)
+	case "slo":
+		return runSLOCommand(args)
+	case "operator":
+		return runOperatorCommand(args)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// connectFromFlags connects to the cluster of the provider selected with --provider
+func connectFromFlags(providerName string) (ClusterClient, error) {
+	return connectWithFlags(providerName, false)
+}
+
+// connectCloudFromFlags sets up the cloud clients for the provider selected with --provider
+// without connecting to the Kubernetes API server, for commands that only query the cloud
+func connectCloudFromFlags(providerName string) (ClusterClient, error) {
+	return connectWithFlags(providerName, true)
+}
+
+// connectWithFlags connects to the cluster of the provider selected with --provider
+func connectWithFlags(providerName string, deferKubernetes bool) (ClusterClient, error) {
+	provider, err := parseProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	client, err := newClusterClientFromEnv(provider, deferKubernetes)
+	if err != nil {
+		return nil, err
+	}
+	Verbosef("Connected in %s", time.Since(start).Round(time.Millisecond))
+	return client, nil
+}
+
+// runInfoCommand prints the cloud-reported cluster information as text or JSON
+func runInfoCommand(args []string) error {
+	fs := flag.NewFlagSet("info", flag.ContinueOnError)
+	providerName := fs.String("provider", string(ProviderAKS), "cloud provider (aks, eks or gke)")
+	output := fs.String("output", "text", "output format (text or json)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := connectCloudFromFlags(*providerName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	info, err := client.GetClusterInfo()
+	if err != nil {
+		return err
+	}
+
+	switch *output {
+	case "text":
+		PrintClusterInfo(info)
+	case "json":
+		data, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode cluster info: %w", err)
+		}
+		fmt.Println(Redact(string(data)))
+	default:
+		return fmt.Errorf("unknown output format %q (expected text or json)", *output)
+	}
+
+	return nil
+}
+
+// runWhoamiCommand prints the cloud identity the tool is authenticated as and how long its
+// session is valid, warning when it expires before a run of the expected duration would finish
+func runWhoamiCommand(args []string) error {
+	fs := flag.NewFlagSet("whoami", flag.ContinueOnError)
+	providerName := fs.String("provider", string(ProviderAKS), "cloud provider (aks, eks or gke)")
+	output := fs.String("output", "text", "output format (text or json)")
+	expected := fs.Duration("expected-duration", DefaultExpectedRunDuration, "how long the planned run takes; warn when the session expires sooner")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := connectCloudFromFlags(*providerName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	session, err := DescribeSession(context.Background(), client)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	CheckSessionExpiry(session, now, *expected)
+
+	switch *output {
+	case "text":
+		PrintSessionInfo(session, now)
+	case "json":
+		data, err := json.MarshalIndent(session, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode session: %w", err)
+		}
+		fmt.Println(string(data))
+	default:
+		return fmt.Errorf("unknown output format %q (expected text or json)", *output)
+	}
+	return nil
+}
+
+// runKubeconfigCommand exports a kubeconfig for the connected cluster, either as a
+// standalone file or merged into an existing kubeconfig
+func runKubeconfigCommand(args []string) error {
+	fs := flag.NewFlagSet("kubeconfig", flag.ContinueOnError)
+	providerName := fs.String("provider", string(ProviderAKS), "cloud provider (aks, eks or gke)")
+	output := fs.String("output", "", "path of the standalone kubeconfig to write (default <cluster>.kubeconfig)")
+	merge := fs.Bool("merge", false, "merge into an existing kubeconfig instead of writing a standalone file")
+	kubeconfigPath := fs.String("kubeconfig", clientcmd.RecommendedHomeFile, "kubeconfig to merge into")
+	force := fs.Bool("force", false, "overwrite conflicting entries when merging")
+	setCurrent := fs.Bool("set-current", false, "switch current-context to the merged cluster")
+	noBackup := fs.Bool("no-backup", false, "do not back up the kubeconfig before merging")
+	nameTemplate := fs.String("name-template", os.Getenv("KUBECONFIG_NAME_TEMPLATE"),
+		"context name template using {provider}, {account}, {region}, {resourceGroup} and {cluster}")
+	aliasFile := fs.String("aliases", os.Getenv("KUBECONFIG_ALIASES"), "YAML file mapping cluster keys or context names to aliases")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	naming := KubeconfigNaming{Template: *nameTemplate}
+	if *aliasFile != "" {
+		aliases, err := LoadKubeconfigAliases(*aliasFile)
+		if err != nil {
+			return err
+		}
+		naming.Aliases = aliases
+	}
+	if err := naming.Validate(); err != nil {
+		return err
+	}
+
+	client, err := connectFromFlags(*providerName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	id := client.Identity()
+	names := naming.Names(id)
+	config, err := buildKubeconfig(client, names)
+	if err != nil {
+		return fmt.Errorf("failed to build kubeconfig: %w", err)
+	}
+
+	if *merge {
+		opts := MergeOptions{Force: *force, SetCurrent: *setCurrent, NoBackup: *noBackup}
+		if err := MergeKubeconfig(config, *kubeconfigPath, opts); err != nil {
+			return err
+		}
+		Infof("✓ Merged context '%s' into %s", names.Context, *kubeconfigPath)
+		return nil
+	}
+
+	path := *output
+	if path == "" {
+		path = filepath.Join(".", id.Name+".kubeconfig")
+	}
+	if err := WriteKubeconfig(config, path); err != nil {
+		return err
+	}
+
+	Infof("✓ Wrote kubeconfig for context '%s' to %s", names.Context, path)
+	return nil
+}
+
+// runPodsCommand lists pods filtered on the API server by namespace, labels, node and phase
+func runPodsCommand(args []string) error {
+	fs := flag.NewFlagSet("pods", flag.ContinueOnError)
+	providerName := fs.String("provider", string(ProviderAKS), "cloud provider (aks, eks or gke)")
+	namespace := fs.String("namespace", "kube-system", "namespace to list (empty for all namespaces)")
+	selector := fs.String("selector", "", "label selector, e.g. app=web,tier!=cache")
+	node := fs.String("node", "", "only pods scheduled to this node (spec.nodeName)")
+	phase := fs.String("phase", "", "only pods in this phase (status.phase), e.g. Running or Pending")
+	fieldSelector := fs.String("field-selector", "", "additional field selector")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter := PodFilter{
+		Namespace:     *namespace,
+		LabelSelector: *selector,
+		NodeName:      *node,
+		Phase:         *phase,
+		FieldSelector: *fieldSelector,
+	}
+	if _, err := filter.ListOptions(); err != nil {
+		return err
+	}
+
+	client, err := connectFromFlags(*providerName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return printFilteredPods(context.Background(), client.Clientset(), filter)
+}
+
+// runTopCommand reports node or pod resource usage from the metrics API
+func runTopCommand(args []string) error {
+	kind := "nodes"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		kind, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("top", flag.ContinueOnError)
+	providerName := fs.String("provider", string(ProviderAKS), "cloud provider (aks, eks or gke)")
+	namespace := fs.String("namespace", "", "namespace of the pods to report (default all namespaces)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := connectFromFlags(*providerName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	switch kind {
+	case "nodes", "node":
+		usages, err := TopNodes(ctx, client)
+		if errors.Is(err, ErrMetricsUnavailable) {
+			Warnf("%v", err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		PrintNodeUsage(usages)
+	case "pods", "pod":
+		usages, err := TopPods(ctx, client, *namespace)
+		if errors.Is(err, ErrMetricsUnavailable) {
+			Warnf("%v", err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		PrintPodUsage(usages)
+	default:
+		return fmt.Errorf("unknown top resource %q (expected nodes or pods)", kind)
+	}
+
+	return nil
+}
+
+// runGetCommand fetches objects of any resource type, built-in or custom, resolved through API
+// discovery and read with the dynamic client, or the output of a raw API server path
+func runGetCommand(args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	providerName := fs.String("provider", string(ProviderAKS), "cloud provider (aks, eks or gke)")
+	namespace := fs.String("namespace", "", "namespace to get from (default all namespaces)")
+	fs.StringVar(namespace, "n", "", "shorthand for --namespace")
+	selector := fs.String("selector", "", "label selector, e.g. app=web,tier!=cache")
+	fs.StringVar(selector, "l", "", "shorthand for --selector")
+	output := fs.String("output", "text", "output format (text, json or yaml)")
+	fs.StringVar(output, "o", "text", "shorthand for --output")
+	raw := fs.String("raw", "", "API server path to request instead of a resource, e.g. /readyz?verbose or /metrics")
+
+	// Positional arguments may come before, between or after the flags, as with kubectl
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if *raw != "" {
+		if len(positional) > 0 {
+			return errors.New("--raw does not take a resource")
+		}
+		client, err := connectFromFlags(*providerName)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		body, err := client.RawRequest(context.Background(), "GET", *raw)
+		if len(body) > 0 {
+			fmt.Println(strings.TrimRight(Redact(string(body)), "\n"))
+		}
+		return err
+	}
+	if len(positional) == 0 || len(positional) > 2 {
+		return errors.New("usage: get <resource> [name] [-n namespace] [--selector labels] [--output text|json|yaml], or get --raw <path>")
+	}
+	query := GetQuery{Resource: positional[0], Namespace: *namespace, LabelSelector: *selector}
+	if len(positional) == 2 {
+		query.Name = positional[1]
+	}
+
+	client, err := connectFromFlags(*providerName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	resource, items, err := GetResources(context.Background(), client, query)
+	if err != nil {
+		return err
+	}
+	return PrintResources(resource, items, *output, query.Name != "")
+}
+
+// runRegistrySecretCommand mints credentials for the cloud's registry and writes them to a
+// dockerconfigjson pull secret in each given namespace
+func runRegistrySecretCommand(args []string) error {
+	fs := flag.NewFlagSet("registry-secret", flag.ContinueOnError)
+	providerName := fs.String("provider", string(ProviderAKS), "cloud provider (aks, eks or gke)")
+	registry := fs.String("registry", "", "registry host, e.g. 123456789012.dkr.ecr.eu-west-1.amazonaws.com, europe-docker.pkg.dev or myregistry.azurecr.io")
+	name := fs.String("name", "registry-credentials", "name of the pull secret")
+	namespaces := fs.String("namespace", "default", "comma-separated namespaces to write the pull secret to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *registry == "" {
+		return errors.New("usage: registry-secret --registry <host> [--name secret] [--namespace ns1,ns2]")
+	}
+
+	client, err := connectFromFlags(*providerName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	auth, err := MintRegistryCredentials(ctx, client, *registry)
+	if err != nil {
+		return err
+	}
+	for _, namespace := range strings.Split(*namespaces, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace == "" {
+			continue
+		}
+		created, err := ApplyPullSecret(ctx, client.Clientset(), namespace, *name, *registry, *auth)
+		if err != nil {
+			return err
+		}
+		action := "Updated"
+		if created {
+			action = "Created"
+		}
+		expiry := ""
+		if !auth.Expiry.IsZero() {
+			expiry = fmt.Sprintf(", credentials expire %s", auth.Expiry.Local().Format(time.RFC3339))
+		}
+		Infof("✓ %s pull secret %s/%s for %s%s", action, namespace, *name, *registry, expiry)
+	}
+	return nil
+}
+
+// runRotateGCPKeyCommand replaces the GKE service account key with a new one
+func runRotateGCPKeyCommand(args []string) error {
+	fs := flag.NewFlagSet("rotate-gcp-key", flag.ContinueOnError)
+	dest := fs.String("dest", "", "where to write the new key: file:<path>, secret:<namespace>/<name>[/<key>] or dotenv:<path> (default where the current key was read from)")
+	validateTimeout := fs.Duration("validate-timeout", DefaultKeyValidateTimeout, "how long to retry connecting to the cluster with the new key")
+	keepOld := fs.Bool("keep-old", false, "keep the old key instead of deleting it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := KeyRotationOptions{ValidateTimeout: *validateTimeout, KeepOld: *keepOld}
+	if *dest != "" {
+		destination, err := ParseKeyDestination(*dest)
+		if err != nil {
+			return err
+		}
+		opts.Destination = destination
+	}
+	return RotateGCPKey(context.Background(), opts)
+}
+
+// runAccessCommand prints who can access the cluster and as what: the cloud identities mapped
+// into it and the Kubernetes RBAC roles they are bound to
+func runAccessCommand(args []string) error {
+	fs := flag.NewFlagSet("access", flag.ContinueOnError)
+	providerName := fs.String("provider", string(ProviderAKS), "cloud provider (aks, eks or gke)")
+	output := fs.String("output", "text", "output format (text or json)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := connectFromFlags(*providerName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	mappings, err := MapClusterAccess(context.Background(), client)
+	if err != nil {
+		return err
+	}
+
+	switch *output {
+	case "text":
+		PrintAccessMappings(mappings)
+	case "json":
+		data, err := json.MarshalIndent(mappings, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode access mappings: %w", err)
+		}
+		fmt.Println(string(data))
+	default:
+		return fmt.Errorf("unknown output format %q (expected text or json)", *output)
+	}
+	return nil
+}
+
+// runCheckCommand runs the selected diagnostic checks (all of them by default)
+func runCheckCommand(args []string) error {
+	defaults := DefaultCheckOptions()
+
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	providerName := fs.String("provider", string(ProviderAKS), "cloud provider (aks, eks or gke)")
+	list := fs.Bool("list", false, "list the available checks and exit")
+	pendingThreshold := fs.Duration("pending-threshold", defaults.PendingThreshold, "report pods Pending for longer than this")
+	probeImage := fs.String("probe-image", defaults.DNSProbe.Image, "image used by the in-cluster probe pod")
+	probeNamespace := fs.String("probe-namespace", defaults.DNSProbe.Namespace, "namespace for the in-cluster probe pod")
+	probeTimeout := fs.Duration("probe-timeout", defaults.DNSProbe.Timeout, "how long to wait for the in-cluster probe pod")
+	clusterDomain := fs.String("cluster-domain", defaults.DNSProbe.ClusterDomain, "cluster DNS domain")
+	externalDomain := fs.String("external-domain", defaults.DNSProbe.ExternalDomain, "external domain resolved and dialled by the probe pod")
+	targetVersion := fs.String("target-version", "", "minor release preflight-upgrade checks against, e.g. 1.32 (default the next one)")
+	certExpiryWindow := fs.Duration("cert-expiry-window", defaults.CertExpiryWindow, "report certificates expiring within this long")
+	spExpiryWindow := fs.Duration("sp-expiry-window", defaults.SPExpiryWindow, "report Azure service principal secrets and certificates expiring within this long")
+	lbTimeout := fs.Duration("lb-timeout", defaults.LBProbeTimeout, "timeout of each load balancer probe")
+	requireQuotas := fs.Bool("require-quotas", false, "fail resource-quotas for application namespaces without a ResourceQuota")
+	storageClass := fs.String("storage-class", "", "StorageClass used by storage-probe (default the cluster's default class)")
+	storageSize := fs.String("storage-size", defaults.StorageProbe.Size, "size of the volume created by storage-probe")
+	storageTimeout := fs.Duration("storage-timeout", defaults.StorageProbe.Timeout, "how long storage-probe waits for the volume to be provisioned and mounted")
+	windowsImage := fs.String("windows-image", defaults.WindowsProbe.Image, "image windows-probe runs on a Windows node")
+	windowsTimeout := fs.Duration("windows-timeout", defaults.WindowsProbe.Timeout, "how long windows-probe waits for its pod to run (Windows images pull slowly)")
+	failOnFlag := fs.String("fail-on", string(DefaultFailOn), "least severe check status that fails the run (warn or fail)")
+	checkTimeouts := fs.String("check-timeout", "", "timeouts of the checks, e.g. 2m,lb-probe=30s; optional checks that exceed theirs are skipped (default 5m, probes their own timeout plus 1m)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	failOn, err := ParseFailOn(*failOnFlag)
+	if err != nil {
+		return err
+	}
+
+	opts := defaults
+	opts.PendingThreshold = *pendingThreshold
+	opts.UpgradeTarget = *targetVersion
+	opts.CertExpiryWindow = *certExpiryWindow
+	opts.SPExpiryWindow = *spExpiryWindow
+	opts.LBProbeTimeout = *lbTimeout
+	opts.RequireQuotas = *requireQuotas
+	opts.DNSProbe = DNSProbeOptions{
+		Image:          *probeImage,
+		Namespace:      *probeNamespace,
+		ClusterDomain:  *clusterDomain,
+		ExternalDomain: *externalDomain,
+		Timeout:        *probeTimeout,
+	}
+	opts.StorageProbe = StorageProbeOptions{
+		StorageClass: *storageClass,
+		Size:         *storageSize,
+		Image:        *probeImage,
+		Namespace:    *probeNamespace,
+		Timeout:      *storageTimeout,
+	}
+	opts.NetpolProbe = NetworkPolicyProbeOptions{
+		Image:     *probeImage,
+		Namespace: *probeNamespace,
+		Timeout:   *probeTimeout,
+	}
+	opts.ArchProbe = ArchProbeOptions{
+		Image:     *probeImage,
+		Namespace: *probeNamespace,
+		Timeout:   *probeTimeout,
+	}
+	opts.WindowsProbe = WindowsProbeOptions{
+		Image:     *windowsImage,
+		Namespace: *probeNamespace,
+		Timeout:   *windowsTimeout,
+	}
+	if err := ParseCheckTimeouts(*checkTimeouts, &opts); err != nil {
+		return err
+	}
+
+	if *list {
+		for _, check := range builtinChecks(opts) {
+			optional := ""
+			if check.Optional {
+				optional = " (optional)"
+			}
+			fmt.Printf("  %-20s %s%s\n", check.Name, check.Description, optional)
+		}
+		return nil
+	}
+
+	checks, err := selectChecks(builtinChecks(opts), fs.Args())
+	if err != nil {
+		return err
+	}
+
+	client, err := connectFromFlags(*providerName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	results, err := runChecks(context.Background(), client, checks, failOn)
+	for _, result := range results {
+		PrintCheckResult(result)
+	}
+	return err
+}
+
+// runNetTestCommand measures the network path to the cluster's API server endpoint
+func runNetTestCommand(args []string) error {
+	fs := flag.NewFlagSet("nettest", flag.ContinueOnError)
+	providerName := fs.String("provider", string(ProviderAKS), "cloud provider (aks, eks or gke)")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout for each network step")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := connectFromFlags(*providerName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	report, err := RunNetTest(context.Background(), client.RESTConfig(), *timeout)
+	if err != nil {
+		return err
+	}
+
+	PrintNetTestReport(report)
+	for _, result := range report.Results {
+		if result.FailedAt == StageOK {
+			return nil
+		}
+	}
+	return fmt.Errorf("API server endpoint %s is not reachable over IPv4 or IPv6", report.Endpoint)
+}
+
+// runDiagnoseCommand walks the connection to the cluster's API server stage by stage and
+// reports the first that fails
+func runDiagnoseCommand(args []string) error {
+	fs := flag.NewFlagSet("diagnose", flag.ContinueOnError)
+	providerName := fs.String("provider", string(ProviderAKS), "cloud provider (aks, eks or gke)")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout for each stage")
+	output := fs.String("output", "text", "output format (text or json)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := connectCloudFromFlags(*providerName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	report := DiagnoseConnection(context.Background(), client, *timeout)
+	switch *output {
+	case "text":
+		PrintConnectionReport(report)
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode connection report: %w", err)
+		}
+		fmt.Println(string(data))
+	default:
+		return fmt.Errorf("unknown output format %q (expected text or json)", *output)
+	}
+	if err := report.Err(); err != nil {
+		return fmt.Errorf("connection failed at stage %w", err)
+	}
+	return nil
+}
+
+// runNodePoolCommand creates or deletes a node pool of the cluster
+func runNodePoolCommand(args []string) error {
+	const usage = "usage: nodepool create --name <pool> --machine-type <type> [--count n] [--min n --max n] [--labels k=v,...] [--taints k=v:Effect,...]\n" +
+		"       nodepool delete --name <pool>"
+	if len(args) == 0 || (args[0] != "create" && args[0] != "delete") {
+		return errors.New(usage)
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("nodepool "+action, flag.ContinueOnError)
+	providerName := fs.String("provider", string(ProviderAKS), "cloud provider (aks, eks or gke)")
+	name := fs.String("name", "", "name of the node pool")
+	machineType := fs.String("machine-type", "", "EC2 instance type, GCE machine type or Azure VM size of the nodes")
+	count := fs.Int("count", 1, "initial number of nodes (per zone on GKE)")
+	minCount := fs.Int("min", 0, "minimum number of nodes when autoscaling")
+	maxCount := fs.Int("max", 0, "maximum number of nodes; enables autoscaling when set")
+	labelsFlag := fs.String("labels", "", "comma-separated node labels, e.g. role=test,team=qa")
+	taintsFlag := fs.String("taints", "", "comma-separated node taints, e.g. dedicated=test:NoSchedule")
+	nodeRole := fs.String("node-role", "", "IAM role ARN of the nodes (EKS; default the role of an existing node group)")
+	timeout := fs.Duration("timeout", DefaultNodePoolTimeout, "how long to wait for the operation to finish")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *name == "" {
+		return errors.New(usage)
+	}
+
+	client, err := connectCloudFromFlags(*providerName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if action == "delete" {
+		if err := ConfirmDestructive(client, "delete node pool "+*name); err != nil {
+			return err
+		}
+		// The timeout starts once confirmed, so time spent at the prompt does not count
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		if err := DeleteNodePool(ctx, client, *name); err != nil {
+			return err
+		}
+		Infof("✓ Deleted node pool %s", *name)
+		return nil
+	}
+
+	spec := NodePoolSpec{Name: *name, MachineType: *machineType, Count: int32(*count), NodeRole: *nodeRole}
+	if *maxCount > 0 {
+		spec.Autoscaling = &NodePoolAutoscaling{Min: int32(*minCount), Max: int32(*maxCount)}
+	}
+	if *labelsFlag != "" {
+		labelSet, err := labels.ConvertSelectorToLabelsMap(*labelsFlag)
+		if err != nil {
+			return fmt.Errorf("invalid --labels: %w", err)
+		}
+		spec.Labels = labelSet
+	}
+	if spec.Taints, err = ParseTaints(*taintsFlag); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if err := CreateNodePool(ctx, client, spec); err != nil {
+		return err
+	}
+	Infof("✓ Created node pool %s with %d %s nodes", spec.Name, spec.Count, spec.MachineType)
+	return nil
+}
+
+// runFleetCommand runs an operation against every cluster of a fleet config
+func runFleetCommand(args []string) error {
+	action := "info"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		action, args = args[0], args[1:]
+	}
+
+	defaultConfig := os.Getenv("FLEET_CONFIG")
+	if defaultConfig == "" {
+		defaultConfig = "fleet.yaml"
+	}
+
+	fs := flag.NewFlagSet("fleet", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfig, "fleet config file listing the clusters")
+	concurrency := fs.Int("concurrency", 0, "clusters processed at once across all providers (overrides the config)")
+	providerConcurrency := map[Provider]*int{}
+	for _, provider := range []Provider{ProviderAKS, ProviderEKS, ProviderGKE} {
+		providerConcurrency[provider] = fs.Int(string(provider)+"-concurrency", 0,
+			fmt.Sprintf("%s clusters processed at once (overrides the config)", strings.ToUpper(string(provider))))
+	}
+	selectorFlag := fs.String("selector", "", "only clusters whose cloud tags/labels match, e.g. env=prod,team=payments")
+	output := fs.String("output", "text", "output format (text, json or markdown; junit for check)")
+	templatePath := fs.String("template", "", "render the report to stdout with this Go template instead of --output (html/template for .html files)")
+	reportDest := fs.String("report-dest", os.Getenv("FLEET_REPORT_DEST"), "comma-separated report sinks in addition to stdout: file:<path>, s3://, gs://, Azure Blob https://, http(s):// or postgres:// URLs")
+	kindFlag := fs.String("kind", "pods,deployments", "find: workload kinds to search (pods, deployments)")
+	labelFlag := fs.String("label", "", "find: only workloads matching this label selector, e.g. app=payments")
+	namespace := fs.String("namespace", "", "find: only search this namespace (default all)")
+	dest := fs.String("dest", "", "export-resources: s3://, gs:// or Azure Blob https:// URL to write to")
+	resourcesFlag := fs.String("resources", DefaultExportResources, "export-resources: resource types to export (namespaces, rbac, crds, configmaps)")
+	requireQuotas := fs.Bool("require-quotas", false, "check: fail resource-quotas for application namespaces without a ResourceQuota")
+	targetVersion := fs.String("version", "", "upgrade: Kubernetes version to upgrade control planes to, e.g. 1.32")
+	canary := fs.Int("canary", 1, "upgrade: clusters in the first wave")
+	batchSize := fs.Int("batch-size", DefaultRolloutBatchSize, "upgrade: clusters in each wave after the canary")
+	soak := fs.Duration("soak", 0, "upgrade: how long to wait after a wave before its health gate")
+	providerHealth := fs.Bool("provider-health", true, "look up provider-reported incidents and maintenance for failed clusters")
+	cloudTags := fs.Bool("cloud-tags", true, "attach each cluster's cloud tags (GKE resource labels) to the report")
+	statusPages := fs.Bool("status-pages", true, "poll the public provider status pages for incidents in the fleet's regions")
+	every := fs.Duration("every", 0, "run as a daemon repeating the action at this interval, reloading the config when it changes")
+	metricsAddress := fs.String("metrics-bind-address", "0", "with --every: address of the Prometheus metrics endpoint, or 0 to disable it")
+	notifyDest := fs.String("notify", os.Getenv("FLEET_NOTIFY"), "check with --every: comma-separated webhook URLs, pagerduty or opsgenie[:eu], notified when a check's result changes")
+	notifyAfter := fs.Int("notify-after", DefaultNotifyAfter, "check with --every: consecutive runs a changed result must persist before it is notified")
+	failOnFlag := fs.String("fail-on", string(DefaultFailOn), "check, upgrade: least severe check status that fails a cluster (warn or fail)")
+	checkTimeouts := fs.String("check-timeout", "", "check, upgrade: timeouts of the checks, e.g. 2m,lb-probe=30s; optional checks that exceed theirs are skipped")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	failOn, err := ParseFailOn(*failOnFlag)
+	if err != nil {
+		return err
+	}
+
+	selector, err := ParseClusterSelector(*selectorFlag)
+	if err != nil {
+		return err
+	}
+
+	// prepare applies the concurrency flags to the config, and to every reload of it with --every
+	prepare := func(config *FleetConfig) {
+		if *concurrency > 0 {
+			config.Concurrency.Global = *concurrency
+		}
+		for provider, limit := range providerConcurrency {
+			if *limit > 0 {
+				if config.Concurrency.PerProvider == nil {
+					config.Concurrency.PerProvider = map[Provider]int{}
+				}
+				config.Concurrency.PerProvider[provider] = *limit
+			}
+		}
+	}
+	config, err := LoadFleetConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	prepare(config)
+
+	var op FleetOperation
+	var rollout *RolloutOptions
+	switch action {
+	case "info":
+		op = func(ctx context.Context, client ClusterClient) (interface{}, error) {
+			return client.GetClusterInfo()
+		}
+	case "check":
+		opts := DefaultCheckOptions()
+		opts.RequireQuotas = *requireQuotas
+		opts.VersionPolicies = config.VersionPolicies
+		if err := ParseCheckTimeouts(*checkTimeouts, &opts); err != nil {
+			return err
+		}
+		available := builtinChecks(opts)
+		checks, err := selectChecks(available, fs.Args())
+		if err != nil {
+			return err
+		}
+		// Clusters may include optional checks unless checks are named
+		var optional []Check
+		if fs.NArg() == 0 {
+			optional = optionalChecks(available, checks)
+		}
+		op = func(ctx context.Context, client ClusterClient) (interface{}, error) {
+			return runChecks(ctx, client, ChecksForCluster(ctx, client, checks, optional), failOn)
+		}
+	case "upgrade":
+		if *targetVersion == "" {
+			return fmt.Errorf("usage: fleet upgrade --version <version> [--canary n] [--batch-size n] [--soak duration] [health gate checks...]")
+		}
+		opts := DefaultCheckOptions()
+		opts.RequireQuotas = *requireQuotas
+		if err := ParseCheckTimeouts(*checkTimeouts, &opts); err != nil {
+			return err
+		}
+		checks, err := selectChecks(builtinChecks(opts), fs.Args())
+		if err != nil {
+			return err
+		}
+		rollout = &RolloutOptions{Version: *targetVersion, Canary: *canary, BatchSize: *batchSize, Soak: *soak, Checks: checks, FailOn: failOn}
+	case "find":
+		if fs.NArg() > 1 {
+			return fmt.Errorf("usage: fleet find [--kind pods,deployments] [--label selector] [--namespace ns] [name-pattern]")
+		}
+		kinds, err := ParseWorkloadKinds(*kindFlag)
+		if err != nil {
+			return err
+		}
+		query := FindQuery{NamePattern: fs.Arg(0), LabelSelector: *labelFlag, Namespace: *namespace, Kinds: kinds}
+		if err := query.Validate(); err != nil {
+			return err
+		}
+		op = func(ctx context.Context, client ClusterClient) (interface{}, error) {
+			return FindWorkloads(ctx, client.Clientset(), query)
+		}
+	case "capabilities":
+		op = func(ctx context.Context, client ClusterClient) (interface{}, error) {
+			return DiscoverAPICapabilities(client.Discovery())
+		}
+	case "accelerators":
+		op = func(ctx context.Context, client ClusterClient) (interface{}, error) {
+			return DiscoverAccelerators(ctx, client.Clientset())
+		}
+	case "features":
+		op = func(ctx context.Context, client ClusterClient) (interface{}, error) {
+			return InspectServerFeatures(ctx, client)
+		}
+	case "policies":
+		op = func(ctx context.Context, client ClusterClient) (interface{}, error) {
+			return InventoryPolicies(ctx, client)
+		}
+	case "access":
+		op = func(ctx context.Context, client ClusterClient) (interface{}, error) {
+			return MapClusterAccess(ctx, client)
+		}
+	case "export-resources":
+		if *dest == "" {
+			return fmt.Errorf("usage: fleet export-resources --dest <s3://|gs://|https://> [--resources namespaces,rbac,crds,configmaps]")
+		}
+		types, err := ParseExportResources(*resourcesFlag)
+		if err != nil {
+			return err
+		}
+		store, err := NewObjectStore(context.Background(), *dest)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		runID := time.Now().UTC().Format("20060102T150405Z")
+		op = func(ctx context.Context, client ClusterClient) (interface{}, error) {
+			return ExportResources(ctx, client, store, runID, types)
+		}
+	default:
+		return fmt.Errorf("unknown fleet action %q (expected info, check, upgrade, capabilities, accelerators, features, policies, access, find or export-resources)", action)
+	}
+
+	if *output == "junit" && action != "check" {
+		return fmt.Errorf("--output junit is only supported by fleet check")
+	}
+	if *every > 0 && (rollout != nil || action == "export-resources") {
+		return fmt.Errorf("--every is not supported by fleet %s", action)
+	}
+	// FLEET_NOTIFY configures the daemon and is ignored by other fleet commands; only an explicit
+	// --notify is rejected there
+	notifying := strings.TrimSpace(*notifyDest) != "" && *every > 0 && action == "check"
+	notifySet := false
+	fs.Visit(func(f *flag.Flag) { notifySet = notifySet || f.Name == "notify" })
+	if notifySet && strings.TrimSpace(*notifyDest) != "" && !notifying {
+		return fmt.Errorf("--notify is only supported by fleet check with --every")
+	}
+	if *notifyAfter < 1 {
+		return fmt.Errorf("--notify-after must be at least 1")
+	}
+
+	ctx := context.Background()
+	stdout := "stdout:" + *output
+	if *templatePath != "" {
+		stdout = "template:" + *templatePath
+		*output = "template"
+	}
+	sinks, err := NewReportSinks(ctx, stdout+","+*reportDest)
+	if err != nil {
+		return err
+	}
+	defer closeReportSinks(sinks)
+
+	run := func(ctx context.Context, config *FleetConfig, registry *ClusterRegistry) (*Report, error) {
+		selected, results := SelectFleetClusters(ctx, config, selector)
+		if !selector.Empty() && *output == "text" {
+			Infof("Selected %d of %d clusters matching %q", len(selected), len(config.Clusters), selector.String())
+		}
+		// The selection runs on a copy, leaving a watched config intact for the next run
+		selection := *config
+		selection.Clusters = selected
+		if rollout != nil {
+			results = append(results, RunRollout(ctx, &selection, *rollout).Results()...)
+		} else {
+			results = append(results, RunFleetWithRegistry(ctx, &selection, registry, op)...)
+		}
+		if *cloudTags {
+			AnnotateClusterTags(ctx, &selection, results)
+		}
+		if *providerHealth {
+			AnnotateProviderEvents(ctx, &selection, results)
+		}
+
+		report := &Report{Action: action, Finished: time.Now(), Results: results, FailOn: failOn}
+		if *statusPages {
+			report.Incidents = FetchStatusPageIncidents(ctx, StatusPageRegions(&selection))
+		}
+		if err := DeliverReport(ctx, sinks, report); err != nil {
+			return nil, err
+		}
+		if len(sinks) > 1 && *output == "text" {
+			for _, sink := range sinks[1:] {
+				Infof("Delivered report to %s", sink.Name())
+			}
+		}
+		return report, nil
+	}
+
+	if notifying {
+		notifiers, err := NewNotifiers(*notifyDest)
+		if err != nil {
+			return err
+		}
+		defer closeNotifiers(notifiers)
+		// Notify the check results that changed since the previous runs
+		tracker := NewCheckStateTracker(*notifyAfter)
+		queue := NewNotificationQueue(notifiers)
+		deliver := run
+		run = func(ctx context.Context, config *FleetConfig, registry *ClusterRegistry) (*Report, error) {
+			report, err := deliver(ctx, config, registry)
+			if report == nil {
+				return report, err
+			}
+			transitions := tracker.Observe(report)
+			for _, transition := range transitions {
+				if transition.Initial() {
+					Verbosef("Check result: %s", transition)
+					continue
+				}
+				Infof("Check result changed: %s", transition)
+			}
+			if err := queue.Send(ctx, transitions); err != nil {
+				Warnf("%v", err)
+			}
+			return report, err
+		}
+	}
+
+	if *every > 0 {
+		return runFleetDaemon(ctx, *configPath, prepare, *every, *metricsAddress, run)
+	}
+
+	report, err := run(ctx, config, nil)
+	if err != nil {
+		return err
+	}
+	failed := report.Failed()
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cluster(s) failed", failed, len(report.Results))
+	}
+	return nil
+}
+
+// runFleetDaemon repeats run every interval until interrupted, with clients cached between runs
+// and the fleet config reloaded when its file changes
+func runFleetDaemon(ctx context.Context, configPath string, prepare func(*FleetConfig), interval time.Duration, metricsAddress string,
+	run func(context.Context, *FleetConfig, *ClusterRegistry) (*Report, error)) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	registry := NewClusterRegistry(ClusterRegistryOptions{})
+	defer registry.Close()
+	watcher, err := WatchFleetConfig(configPath, prepare, registry)
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	go watcher.Run(ctx)
+	if err := ServeDaemonMetrics(ctx, metricsAddress); err != nil {
+		return err
+	}
+
+	Infof("Running every %s; %s is reloaded when it changes", interval, configPath)
+	for {
+		report, err := run(ctx, watcher.Config(), registry)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil:
+			fleetRuns.WithLabelValues("failure").Inc()
+			Warnf("Fleet run failed: %v", err)
+		case report.Failed() > 0:
+			fleetRuns.WithLabelValues("failure").Inc()
+			Warnf("%d of %d cluster(s) failed", report.Failed(), len(report.Results))
+		default:
+			fleetRuns.WithLabelValues("success").Inc()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// runDriftCommand cross-checks the clusters declared in Terraform state or Crossplane managed
+// resources against the cloud APIs
+func runDriftCommand(args []string) error {
+	fs := flag.NewFlagSet("drift", flag.ContinueOnError)
+	terraformPaths := fs.String("terraform", "", "comma-separated Terraform state files (terraform state pull > state.json)")
+	crossplanePaths := fs.String("crossplane", "", "comma-separated files of Crossplane managed resources (kubectl get managed -o yaml)")
+	configPath := fs.String("config", os.Getenv("FLEET_CONFIG"), "fleet config whose entries supply credentials for the clusters they list")
+	output := fs.String("output", "text", "output format (text or json)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *terraformPaths == "" && *crossplanePaths == "" {
+		return errors.New("usage: drift [--terraform state.json,...] [--crossplane managed.yaml,...] [--config fleet.yaml] [--output text|json]")
+	}
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("unknown output format %q (expected text or json)", *output)
+	}
+
+	var declared []DeclaredCluster
+	for _, source := range []struct {
+		paths string
+		load  func(string) ([]DeclaredCluster, error)
+	}{{*terraformPaths, LoadTerraformState}, {*crossplanePaths, LoadCrossplaneResources}} {
+		for _, path := range strings.Split(source.paths, ",") {
+			if path = strings.TrimSpace(path); path == "" {
+				continue
+			}
+			clusters, err := source.load(path)
+			if err != nil {
+				return err
+			}
+			declared = append(declared, clusters...)
+		}
+	}
+	if len(declared) == 0 {
+		return fmt.Errorf("no EKS, GKE or AKS clusters declared in the given files")
+	}
+
+	var fleet *FleetConfig
+	if *configPath != "" {
+		config, err := LoadFleetConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		fleet = config
+	}
+
+	results := CheckDrift(context.Background(), declared, fleet)
+	problems := 0
+	switch *output {
+	case "text":
+		problems = PrintDriftReport(results)
+	case "json":
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode drift report: %w", err)
+		}
+		fmt.Println(Redact(string(data)))
+		for _, result := range results {
+			if result.Error != "" || len(result.Drift) > 0 {
+				problems++
+			}
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d of %d declared cluster(s) drifted or could not be checked", problems, len(results))
+	}
+	return nil
+}
+
+// runCompareCommand diffs two clusters of a fleet config for environment parity audits
+func runCompareCommand(args []string) error {
+	defaultConfig := os.Getenv("FLEET_CONFIG")
+	if defaultConfig == "" {
+		defaultConfig = "fleet.yaml"
+	}
+
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfig, "fleet config file listing the clusters")
+	output := fs.String("output", "text", "output format (text or json)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: compare [--config fleet.yaml] [--output text|json] <clusterA> <clusterB>")
+	}
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("unknown output format %q (expected text or json)", *output)
+	}
+
+	config, err := LoadFleetConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	var clusters []FleetCluster
+	for _, ref := range fs.Args() {
+		cluster, err := config.FindCluster(ref)
+		if err != nil {
+			return err
+		}
+		clusters = append(clusters, cluster)
+	}
+	config.Clusters = clusters
+
+	results := RunFleet(context.Background(), config, func(ctx context.Context, client ClusterClient) (interface{}, error) {
+		return TakeClusterSnapshot(ctx, client)
+	})
+	var snapshots []*ClusterSnapshot
+	for _, result := range results {
+		if result.Err != nil {
+			return fmt.Errorf("failed to snapshot %s: %w", result.Cluster.Identity().Key(), result.Err)
+		}
+		snapshots = append(snapshots, result.Output.(*ClusterSnapshot))
+	}
+
+	diff := CompareSnapshots(snapshots[0], snapshots[1])
+	if *output == "json" {
+		if err := printClusterDiffJSON(diff); err != nil {
+			return err
+		}
+	} else {
+		PrintClusterDiff(diff)
+	}
+
+	if diff.Differences > 0 {
+		return fmt.Errorf("clusters differ in %d item(s)", diff.Differences)
+	}
+	return nil
+}
+
+// runConfigCommand inspects the tool's configuration; "validate" checks the environment
+func runConfigCommand(args []string) error {
+	if len(args) == 0 || args[0] != "validate" {
+		return fmt.Errorf("usage: config validate [--provider aks|eks|gke] [--output text|json]")
+	}
+
+	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	providerName := fs.String("provider", "", "only check this provider (default all)")
+	output := fs.String("output", "text", "output format (text or json)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	var providers []Provider
+	if *providerName != "" {
+		provider, err := parseProvider(*providerName)
+		if err != nil {
+			return err
+		}
+		providers = append(providers, provider)
+	}
+
+	report := ValidateEnvConfig(providers...)
+	switch *output {
+	case "text":
+		PrintConfigReport(report)
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode config report: %w", err)
+		}
+		fmt.Println(Redact(string(data)))
+	default:
+		return fmt.Errorf("unknown output format %q (expected text or json)", *output)
+	}
+
+	if report.HasErrors() {
+		return fmt.Errorf("configuration has errors")
+	}
+	return nil
+}
+
+// runReportCommand prints the JSON Schema of fleet reports or validates a report against it
+func runReportCommand(args []string) error {
+	const usage = "usage: report schema\n       report validate <file|->"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	switch {
+	case args[0] == "schema" && len(args) == 1:
+		fmt.Print(string(ReportSchema))
+		return nil
+	case args[0] == "validate" && len(args) == 2:
+		var data []byte
+		var err error
+		if args[1] == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(args[1])
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read report: %w", err)
+		}
+		if err := ValidateReportJSON(data); err != nil {
+			return fmt.Errorf("report does not match schema version %d:\n%w", ReportSchemaVersion, err)
+		}
+		Infof("✓ Report matches schema version %d", ReportSchemaVersion)
+		return nil
+	default:
+		return errors.New(usage)
+	}
+}
+
+// runSLOCommand computes per-cluster availability, MTTR and latency trends from the stored
+// reports of fleet runs
+func runSLOCommand(args []string) error {
+	defaults := DefaultSLOOptions()
+	fs := flag.NewFlagSet("slo", flag.ContinueOnError)
+	history := fs.String("history", os.Getenv("FLEET_HISTORY"), "postgres:// URL of the database report sink, or a glob of JSON report files")
+	action := fs.String("action", defaults.Action, "fleet action whose runs are measured")
+	window := fs.String("window", formatWindow(defaults.Window), "SLO window ending now, e.g. 30d or 12h")
+	target := fs.Float64("target", defaults.Target, "availability objective in percent")
+	burnWindow := fs.String("burn-window", formatWindow(defaults.BurnWindow), "recent window whose error budget burn rate is checked")
+	burnThreshold := fs.Float64("burn-threshold", defaults.BurnThreshold, "burn rate in --burn-window that triggers a warning")
+	output := fs.String("output", "text", "output format (text or json)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *history == "" {
+		return fmt.Errorf("usage: slo --history <postgres://...|reports/*.json> [--window 30d] [--target 99.5] [--burn-window 1d] [--burn-threshold 2]")
+	}
+
+	opts := SLOOptions{Action: *action, Target: *target, BurnThreshold: *burnThreshold}
+	var err error
+	if opts.Window, err = ParseWindow(*window); err != nil {
+		return err
+	}
+	if opts.BurnWindow, err = ParseWindow(*burnWindow); err != nil {
+		return err
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	reports, err := LoadReportHistory(context.Background(), *history, opts.Action, now.Add(-opts.Window))
+	if err != nil {
+		return err
+	}
+	report := ComputeSLOs(reports, opts, now)
+
+	problems := 0
+	switch *output {
+	case "text":
+		problems = PrintSLOReport(report, opts)
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode SLO report: %w", err)
+		}
+		fmt.Println(Redact(string(data)))
+		for _, slo := range report.Clusters {
+			if len(slo.Warnings) > 0 {
+				problems++
+			}
+		}
+	default:
+		return fmt.Errorf("unknown output format %q (expected text or json)", *output)
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d of %d cluster(s) miss the SLO or burn their error budget too fast", problems, len(report.Clusters))
+	}
+	return nil
+}
+
+// runOperatorCommand prints the ClusterConnection CRD or runs the operator maintaining the
+// status of ClusterConnections
+func runOperatorCommand(args []string) error {
+	const usage = "usage: operator crd\n       operator run [--namespace ns] [--concurrency n] [--metrics-bind-address :8080] [--health-probe-bind-address :8081] [--leader-elect]"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	switch args[0] {
+	case "crd":
+		fmt.Print(string(ClusterConnectionCRD))
+		return nil
+	case "run":
+		fs := flag.NewFlagSet("operator run", flag.ContinueOnError)
+		namespace := fs.String("namespace", os.Getenv("WATCH_NAMESPACE"), "only watch ClusterConnections in this namespace (default all)")
+		concurrency := fs.Int("concurrency", 4, "ClusterConnections probed at once")
+		metricsAddress := fs.String("metrics-bind-address", ":8080", "address of the metrics endpoint, or 0 to disable it")
+		healthAddress := fs.String("health-probe-bind-address", ":8081", "address of the /healthz and /readyz endpoints")
+		leaderElect := fs.Bool("leader-elect", false, "elect a leader so only one replica probes clusters")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		return RunOperator(ctrl.SetupSignalHandler(), OperatorOptions{
+			Namespace:          *namespace,
+			Concurrency:        *concurrency,
+			MetricsAddress:     *metricsAddress,
+			HealthProbeAddress: *healthAddress,
+			LeaderElection:     *leaderElect,
+		})
+	default:
+		return errors.New(usage)
+	}
+}
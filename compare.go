@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/pager"
+)
+
+// Sections of a ClusterSnapshot, in the order they are compared and printed
+const (
+	SectionVersion    = "version"
+	SectionNodePools  = "node pools"
+	SectionAddOns     = "add-ons"
+	SectionNamespaces = "namespaces"
+	SectionWorkloads  = "workloads"
+)
+
+var snapshotSections = []string{SectionVersion, SectionNodePools, SectionAddOns, SectionNamespaces, SectionWorkloads}
+
+// addOnNamespace holds the add-ons (CoreDNS, kube-proxy, CNI and CSI drivers, metrics-server)
+// on all three providers
+const addOnNamespace = "kube-system"
+
+// nodePoolLabels are the node labels naming a node's pool on each provider, in order of preference
+var nodePoolLabels = []string{
+	"kubernetes.azure.com/agentpool",
+	"agentpool",
+	"eks.amazonaws.com/nodegroup",
+	"karpenter.sh/nodepool",
+	"alpha.eksctl.io/nodegroup-name",
+	"cloud.google.com/gke-nodepool",
+}
+
+// ClusterSnapshot is the state of a cluster compared by CompareSnapshots. Each section maps an
+// item (a node pool, an add-on, a workload) to a description of it; items whose descriptions
+// differ between clusters are reported as changed.
+type ClusterSnapshot struct {
+	Cluster  string                       `json:"cluster"`
+	Sections map[string]map[string]string `json:"sections"`
+}
+
+// TakeClusterSnapshot collects the control plane version, node pool shapes, add-ons, namespaces
+// and workloads of a cluster. Node counts and replica counts are left out since they
+// legitimately differ between environments; pools are compared by instance types, kubelet
+// version and architecture, workloads by container images.
+func TakeClusterSnapshot(ctx context.Context, client ClusterClient) (*ClusterSnapshot, error) {
+	snapshot := &ClusterSnapshot{Cluster: client.Identity().Key(), Sections: map[string]map[string]string{}}
+	for _, section := range snapshotSections {
+		snapshot.Sections[section] = map[string]string{}
+	}
+
+	info, err := client.GetClusterInfo()
+	if err != nil {
+		return nil, err
+	}
+	version := info.Version
+	if version == "" {
+		serverVersion, err := client.Discovery().ServerVersion()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get server version: %w", err)
+		}
+		version = serverVersion.GitVersion
+	}
+	snapshot.Sections[SectionVersion]["control plane"] = version
+
+	clientset := client.Clientset()
+	pools := map[string]*nodePoolShape{}
+	err = EachNode(ctx, clientset, metav1.ListOptions{}, func(node *corev1.Node) error {
+		name := nodePoolName(node)
+		if pools[name] == nil {
+			pools[name] = &nodePoolShape{}
+		}
+		pools[name].add(node)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name, pool := range pools {
+		snapshot.Sections[SectionNodePools][name] = pool.String()
+	}
+
+	err = eachObject(ctx, "namespaces", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.CoreV1().Namespaces().List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		snapshot.Sections[SectionNamespaces][obj.(*corev1.Namespace).Name] = "present"
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	record := func(kind string, meta metav1.ObjectMeta, spec corev1.PodSpec) {
+		section := SectionWorkloads
+		if meta.Namespace == addOnNamespace {
+			section = SectionAddOns
+		} else if strings.HasPrefix(meta.Namespace, "kube-") {
+			return
+		}
+		snapshot.Sections[section][fmt.Sprintf("%s/%s/%s", meta.Namespace, kind, meta.Name)] = containerImages(spec)
+	}
+	err = EachDeployment(ctx, clientset, "", metav1.ListOptions{}, func(deployment *appsv1.Deployment) error {
+		record("Deployment", deployment.ObjectMeta, deployment.Spec.Template.Spec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = eachObject(ctx, "statefulsets", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.AppsV1().StatefulSets("").List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		statefulSet := obj.(*appsv1.StatefulSet)
+		record("StatefulSet", statefulSet.ObjectMeta, statefulSet.Spec.Template.Spec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = eachObject(ctx, "daemonsets", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.AppsV1().DaemonSets("").List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		daemonSet := obj.(*appsv1.DaemonSet)
+		record("DaemonSet", daemonSet.ObjectMeta, daemonSet.Spec.Template.Spec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// eachObject streams the objects returned by list page by page
+func eachObject(ctx context.Context, what string, list func(metav1.ListOptions) (runtime.Object, error), fn func(runtime.Object) error) error {
+	p := pager.New(pager.SimplePageFunc(list))
+	p.PageSize = ListPageSize
+	if err := p.EachListItem(ctx, metav1.ListOptions{}, fn); err != nil {
+		return fmt.Errorf("failed to list %s: %w", what, err)
+	}
+	return nil
+}
+
+// nodePoolName returns the pool a node belongs to, from its provider's pool label
+func nodePoolName(node *corev1.Node) string {
+	for _, label := range nodePoolLabels {
+		if name := node.Labels[label]; name != "" {
+			return name
+		}
+	}
+	return "(no pool)"
+}
+
+// nodePoolShape accumulates the instance types, kubelet versions and architectures of a pool
+type nodePoolShape struct {
+	instanceTypes, kubeletVersions, architectures map[string]bool
+}
+
+// add records node's attributes
+func (p *nodePoolShape) add(node *corev1.Node) {
+	if p.instanceTypes == nil {
+		p.instanceTypes, p.kubeletVersions, p.architectures = map[string]bool{}, map[string]bool{}, map[string]bool{}
+	}
+	if instanceType := node.Labels[corev1.LabelInstanceTypeStable]; instanceType != "" {
+		p.instanceTypes[instanceType] = true
+	}
+	p.kubeletVersions[node.Status.NodeInfo.KubeletVersion] = true
+	p.architectures[node.Status.NodeInfo.Architecture] = true
+}
+
+// String describes the pool as e.g. "m5.large, kubelet v1.29.3-eks-1234, amd64"
+func (p *nodePoolShape) String() string {
+	return fmt.Sprintf("%s, kubelet %s, %s", sortedKeys(p.instanceTypes), sortedKeys(p.kubeletVersions), sortedKeys(p.architectures))
+}
+
+// sortedKeys joins the keys of set in sorted order
+func sortedKeys(set map[string]bool) string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return "unknown"
+	}
+	return strings.Join(keys, "/")
+}
+
+// containerImages lists the images of a pod template's init and regular containers
+func containerImages(spec corev1.PodSpec) string {
+	var images []string
+	for _, container := range spec.InitContainers {
+		images = append(images, container.Image)
+	}
+	for _, container := range spec.Containers {
+		images = append(images, container.Image)
+	}
+	return strings.Join(images, ",")
+}
+
+// ItemChange is an item present in both clusters with different descriptions
+type ItemChange struct {
+	Item string `json:"item"`
+	A    string `json:"a"`
+	B    string `json:"b"`
+}
+
+// SectionDiff lists the differences of one snapshot section
+type SectionDiff struct {
+	Section string            `json:"section"`
+	OnlyInA map[string]string `json:"onlyInA,omitempty"`
+	OnlyInB map[string]string `json:"onlyInB,omitempty"`
+	Changed []ItemChange      `json:"changed,omitempty"`
+}
+
+// Count returns the number of differing items
+func (d SectionDiff) Count() int {
+	return len(d.OnlyInA) + len(d.OnlyInB) + len(d.Changed)
+}
+
+// ClusterDiff is the result of comparing two cluster snapshots
+type ClusterDiff struct {
+	A           string        `json:"a"`
+	B           string        `json:"b"`
+	Sections    []SectionDiff `json:"sections"`
+	Differences int           `json:"differences"`
+}
+
+// CompareSnapshots diffs two snapshots section by section
+func CompareSnapshots(a, b *ClusterSnapshot) ClusterDiff {
+	diff := ClusterDiff{A: a.Cluster, B: b.Cluster}
+	for _, section := range snapshotSections {
+		itemsA, itemsB := a.Sections[section], b.Sections[section]
+		sectionDiff := SectionDiff{Section: section, OnlyInA: map[string]string{}, OnlyInB: map[string]string{}}
+		for item, descA := range itemsA {
+			descB, ok := itemsB[item]
+			switch {
+			case !ok:
+				sectionDiff.OnlyInA[item] = descA
+			case descA != descB:
+				sectionDiff.Changed = append(sectionDiff.Changed, ItemChange{Item: item, A: descA, B: descB})
+			}
+		}
+		for item, descB := range itemsB {
+			if _, ok := itemsA[item]; !ok {
+				sectionDiff.OnlyInB[item] = descB
+			}
+		}
+		sort.Slice(sectionDiff.Changed, func(i, j int) bool { return sectionDiff.Changed[i].Item < sectionDiff.Changed[j].Item })
+
+		diff.Differences += sectionDiff.Count()
+		diff.Sections = append(diff.Sections, sectionDiff)
+	}
+	return diff
+}
+
+// PrintClusterDiff renders a diff for humans: "-" items exist only in A, "+" only in B and
+// "~" in both with differences
+func PrintClusterDiff(diff ClusterDiff) {
+	fmt.Printf("Comparing %s (-) with %s (+):\n", diff.A, diff.B)
+	for _, section := range diff.Sections {
+		if section.Count() == 0 {
+			fmt.Printf("\n✓ %s: identical\n", section.Section)
+			continue
+		}
+		fmt.Printf("\n✗ %s: %d difference(s)\n", section.Section, section.Count())
+		for _, item := range sortedItems(section.OnlyInA) {
+			fmt.Printf("  - %s%s\n", item, describeItem(section.OnlyInA[item]))
+		}
+		for _, item := range sortedItems(section.OnlyInB) {
+			fmt.Printf("  + %s%s\n", item, describeItem(section.OnlyInB[item]))
+		}
+		for _, change := range section.Changed {
+			fmt.Printf("  ~ %s: %s → %s\n", change.Item, change.A, change.B)
+		}
+	}
+	fmt.Printf("\n%d difference(s)\n", diff.Differences)
+}
+
+// printClusterDiffJSON prints a diff as JSON
+func printClusterDiffJSON(diff ClusterDiff) error {
+	data, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cluster diff: %w", err)
+	}
+	fmt.Println(Redact(string(data)))
+	return nil
+}
+
+// sortedItems returns the keys of items in sorted order
+func sortedItems(items map[string]string) []string {
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// describeItem formats an item's description for printing after its name
+func describeItem(description string) string {
+	if description == "" || description == "present" {
+		return ""
+	}
+	return " (" + description + ")"
+}
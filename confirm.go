@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrNotConfirmed is returned when a destructive operation was not confirmed
+var ErrNotConfirmed = errors.New("operation not confirmed")
+
+// assumeYes skips the confirmation of destructive operations, installed with ConfigureConfirmation
+var assumeYes bool
+
+// DefaultProductionTags are the cluster tags (GKE labels) marking a production cluster when
+// PRODUCTION_TAGS is not set; keys and values are compared ignoring case
+const DefaultProductionTags = "environment=production,environment=prod,env=production,env=prod"
+
+// ConfigureConfirmation sets whether destructive operations run without asking for confirmation
+func ConfigureConfirmation(yes bool) {
+	assumeYes = yes
+}
+
+// ParseYesFlag strips --yes[=bool] from args, falling back to the ASSUME_YES environment
+// variable when the flag is absent
+func ParseYesFlag(args []string) ([]string, bool, error) {
+	yes := false
+	set := false
+	remaining, err := stripGlobalFlags(args, map[string]bool{"yes": false}, func(_, value string, hasValue bool) error {
+		set = true
+		yes = true
+		if hasValue {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid --yes %q", value)
+			}
+			yes = parsed
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !set {
+		if value := os.Getenv("ASSUME_YES"); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid ASSUME_YES %q", value)
+			}
+			yes = parsed
+		}
+	}
+	return remaining, yes, nil
+}
+
+// productionTags returns the key=value tags marking production clusters, from PRODUCTION_TAGS
+// (comma-separated) or DefaultProductionTags
+func productionTags() ([][2]string, error) {
+	value := os.Getenv("PRODUCTION_TAGS")
+	if value == "" {
+		value = DefaultProductionTags
+	}
+	var tags [][2]string
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, tagValue, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid PRODUCTION_TAGS entry %q (expected key=value)", pair)
+		}
+		tags = append(tags, [2]string{strings.TrimSpace(key), strings.TrimSpace(tagValue)})
+	}
+	return tags, nil
+}
+
+// IsProductionCluster reports whether a cluster's tags mark it as production
+func IsProductionCluster(tags map[string]string) (bool, error) {
+	production, err := productionTags()
+	if err != nil {
+		return false, err
+	}
+	for key, value := range tags {
+		for _, tag := range production {
+			if strings.EqualFold(key, tag[0]) && strings.EqualFold(value, tag[1]) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// ConfirmDestructive asks on the terminal before action (e.g. "delete node pool spot") runs
+// against client's cluster. Production-tagged clusters require retyping the cluster name,
+// others a yes. --yes skips the prompt, as does read-only mode, which refuses the operation
+// anyway; without a terminal to ask on, the operation is refused.
+func ConfirmDestructive(client ClusterClient, action string) error {
+	if assumeYes || readOnly {
+		return nil
+	}
+	identity := client.Identity()
+	if !isTerminal(os.Stdin) {
+		return fmt.Errorf("%s on cluster %s needs confirmation; pass --yes to run it non-interactively: %w", action, identity.Name, ErrNotConfirmed)
+	}
+
+	production := false
+	if info, err := client.GetClusterInfo(); err != nil {
+		Warnf("Failed to read the tags of cluster %s, treating it as production: %v", identity.Name, err)
+		production = true
+	} else if production, err = IsProductionCluster(info.Tags); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	if production {
+		fmt.Fprintf(os.Stderr, "⚠ Cluster %s is a production cluster.\nType the cluster name to %s: ", identity.Name, action)
+		answer, _ := reader.ReadString('\n')
+		if strings.TrimSpace(answer) != identity.Name {
+			return fmt.Errorf("%s: cluster name did not match: %w", action, ErrNotConfirmed)
+		}
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "%s on cluster %s? [y/N]: ", capitalize(action), identity.Name)
+	answer, _ := reader.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("%s: %w", action, ErrNotConfirmed)
+}
+
+// capitalize upper-cases the first letter of s
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
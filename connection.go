@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConnectionStage is a step towards a working API server connection. The stages progress in
+// order, so reaching one implies every earlier one succeeded.
+type ConnectionStage int
+
+const (
+	// ConnectionNone is the zero stage: nothing succeeded, or nothing failed
+	ConnectionNone ConnectionStage = iota
+	// ConnectionCredentials gets the endpoint, CA and token from the cloud API
+	ConnectionCredentials
+	// ConnectionDNS resolves the endpoint's host name
+	ConnectionDNS
+	// ConnectionTCP connects to the endpoint
+	ConnectionTCP
+	// ConnectionTLS completes a TLS handshake verified against the cluster CA
+	ConnectionTLS
+	// ConnectionAuthenticated has the API server accept the token
+	ConnectionAuthenticated
+	// ConnectionAuthorized has RBAC allow listing namespaces, which most operations need
+	ConnectionAuthorized
+	// ConnectionHealthy has the API server report ready on /readyz
+	ConnectionHealthy
+)
+
+// connectionStages are the stages in the order they are attempted
+var connectionStages = []ConnectionStage{
+	ConnectionCredentials, ConnectionDNS, ConnectionTCP, ConnectionTLS,
+	ConnectionAuthenticated, ConnectionAuthorized, ConnectionHealthy,
+}
+
+// String returns the stage name used in reports
+func (s ConnectionStage) String() string {
+	switch s {
+	case ConnectionNone:
+		return "none"
+	case ConnectionCredentials:
+		return "credentials"
+	case ConnectionDNS:
+		return "dns"
+	case ConnectionTCP:
+		return "tcp"
+	case ConnectionTLS:
+		return "tls"
+	case ConnectionAuthenticated:
+		return "authn"
+	case ConnectionAuthorized:
+		return "authz"
+	case ConnectionHealthy:
+		return "healthy"
+	default:
+		return fmt.Sprintf("stage(%d)", int(s))
+	}
+}
+
+// MarshalText renders the stage by name in JSON reports
+func (s ConnectionStage) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ConnectionError is a connection failure with the stage it happened at
+type ConnectionError struct {
+	Stage ConnectionStage
+	Err   error
+}
+
+func (e *ConnectionError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Stage, e.Err)
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// ConnectionStep is the outcome of one stage
+type ConnectionStep struct {
+	Stage    ConnectionStage `json:"stage"`
+	Detail   string          `json:"detail,omitempty"`
+	Duration time.Duration   `json:"duration"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// ConnectionReport is how far a connection to the cluster's API server got
+type ConnectionReport struct {
+	Endpoint string `json:"endpoint,omitempty"`
+	// Reached is the last stage that succeeded; ConnectionHealthy when everything works
+	Reached ConnectionStage `json:"reached"`
+	// Failed is the stage that failed, or ConnectionNone
+	Failed ConnectionStage  `json:"failed,omitempty"`
+	Steps  []ConnectionStep `json:"steps"`
+	User   string           `json:"user,omitempty"` // as authenticated by the API server
+	Groups []string         `json:"groups,omitempty"`
+	Hints  []string         `json:"hints,omitempty"`
+	err    *ConnectionError
+}
+
+// Err returns the failure as a *ConnectionError, or nil when the API server is healthy
+func (r *ConnectionReport) Err() error {
+	if r.err == nil {
+		return nil
+	}
+	return r.err
+}
+
+// DiagnoseConnection walks client's connection to its API server stage by stage and stops at
+// the first that fails, so a failure is reported as e.g. a TLS or authorization problem rather
+// than as an opaque request error. A client constructed with DeferKubernetes is connected first.
+// Each network step is bounded by timeout.
+func DiagnoseConnection(ctx context.Context, client ClusterClient, timeout time.Duration) *ConnectionReport {
+	report := &ConnectionReport{}
+	provider := client.Identity().Provider
+
+	run := func(stage ConnectionStage, step func() (string, error)) bool {
+		start := time.Now()
+		detail, err := step()
+		result := ConnectionStep{Stage: stage, Detail: detail, Duration: time.Since(start)}
+		if err != nil {
+			result.Error = err.Error()
+			report.Steps = append(report.Steps, result)
+			report.Failed = stage
+			report.err = &ConnectionError{Stage: stage, Err: err}
+			report.Hints = connectionHints(provider, stage, err)
+			return false
+		}
+		report.Steps = append(report.Steps, result)
+		report.Reached = stage
+		return true
+	}
+
+	var host, port, address string
+	var tlsConfig *tls.Config
+	ok := run(ConnectionCredentials, func() (string, error) {
+		if err := client.ConnectKubernetes(ctx); err != nil {
+			return "", err
+		}
+		restConfig := client.RESTConfig()
+		endpoint, err := url.Parse(restConfig.Host)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse API server endpoint %q: %w", restConfig.Host, err)
+		}
+		report.Endpoint = restConfig.Host
+		host, port = endpoint.Hostname(), endpoint.Port()
+		if port == "" {
+			port = "443"
+		}
+		tlsConfig, err = netTestTLSConfig(restConfig, host)
+		if err != nil {
+			return "", err
+		}
+		return restConfig.Host, nil
+	})
+
+	ok = ok && run(ConnectionDNS, func() (string, error) {
+		if ip := net.ParseIP(host); ip != nil {
+			address = host
+			return host, nil
+		}
+		lookupCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupHost(lookupCtx, host)
+		if err != nil || len(addrs) == 0 {
+			return "", fmt.Errorf("%s does not resolve: %w", host, errOrNoAddress(err))
+		}
+		address = addrs[0]
+		return fmt.Sprintf("%s → %s", host, address), nil
+	})
+
+	var conn net.Conn
+	ok = ok && run(ConnectionTCP, func() (string, error) {
+		dialer := &net.Dialer{Timeout: timeout}
+		var err error
+		conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, port))
+		if err != nil {
+			return "", err
+		}
+		return conn.RemoteAddr().String(), nil
+	})
+	if conn != nil {
+		defer conn.Close()
+	}
+
+	ok = ok && run(ConnectionTLS, func() (string, error) {
+		if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return "", err
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("certificate valid for %s", tlsConfig.ServerName), nil
+	})
+
+	ok = ok && run(ConnectionAuthenticated, func() (string, error) {
+		stepCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		review, err := client.Clientset().AuthenticationV1().SelfSubjectReviews().Create(stepCtx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+		switch {
+		case err == nil:
+			report.User = review.Status.UserInfo.Username
+			report.Groups = review.Status.UserInfo.Groups
+			return "as " + report.User, nil
+		case apierrors.IsNotFound(err) || apierrors.IsForbidden(err):
+			// SelfSubjectReview needs 1.28; a rejection other than 401 still means the token
+			// was accepted
+			return "identity not reported by this API server", nil
+		default:
+			return "", err
+		}
+	})
+
+	ok = ok && run(ConnectionAuthorized, func() (string, error) {
+		stepCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{Verb: "list", Resource: "namespaces"},
+			},
+		}
+		result, err := client.Clientset().AuthorizationV1().SelfSubjectAccessReviews().Create(stepCtx, review, metav1.CreateOptions{})
+		if err != nil {
+			return "", err
+		}
+		if !result.Status.Allowed {
+			reason := result.Status.Reason
+			if reason == "" {
+				reason = "no RBAC binding grants it"
+			}
+			return "", fmt.Errorf("not allowed to list namespaces: %s", reason)
+		}
+		return "allowed to list namespaces", nil
+	})
+
+	if ok {
+		run(ConnectionHealthy, func() (string, error) {
+			stepCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			if _, err := client.RawRequest(stepCtx, "GET", "/readyz"); err != nil {
+				return "", fmt.Errorf("/readyz: %w", err)
+			}
+			return "/readyz ok", nil
+		})
+	}
+
+	return report
+}
+
+// connectionHints suggests the likely cause of a failure at stage
+func connectionHints(provider Provider, stage ConnectionStage, err error) []string {
+	switch stage {
+	case ConnectionCredentials:
+		return []string{"The cluster could not be described or no token could be minted: check the cloud credentials with whoami, and that the cluster exists and is running with info."}
+	case ConnectionDNS:
+		return []string{"The endpoint name does not resolve: check your resolver, VPN split DNS, or the private DNS zone of a private cluster endpoint. Run nettest for details."}
+	case ConnectionTCP:
+		if isTimeout(err) {
+			return []string{"The endpoint resolves but TCP times out: it is likely private or filtered (authorized networks, security groups, NSGs, corporate firewall). Run nettest for details."}
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return []string{"The connection was refused: something answers on that address but not the API server (wrong port, proxy or load balancer without backends)."}
+		}
+		return []string{"Check routing to the endpoint address. Run nettest for details."}
+	case ConnectionTLS:
+		var unknownAuthority x509.UnknownAuthorityError
+		var hostname x509.HostnameError
+		switch {
+		case errors.As(err, &unknownAuthority):
+			return []string{"The server certificate is not signed by the cluster CA: a TLS-intercepting proxy is in the path, or an endpoint override points at something other than the API server."}
+		case errors.As(err, &hostname):
+			return []string{"The server certificate does not cover the endpoint name: with an endpoint override, set the TLS server name to the cluster's own endpoint host."}
+		case isTimeout(err):
+			return []string{"TCP connects but the TLS handshake times out, which usually points to an MTU blackhole on a VPN or tunnel."}
+		}
+		return nil
+	case ConnectionAuthenticated:
+		switch provider {
+		case ProviderEKS:
+			return []string{"EKS rejected the token: the IAM principal needs an access entry or an aws-auth mapping, and EKS_AUTH_ROLE_ARN, the STS region and the cluster name in the token must be right. Run access to see the mappings."}
+		case ProviderGKE:
+			return []string{"GKE rejected the token: check GKE_K8S_SCOPES or GKE_K8S_AUDIENCE, and that the identity has a container.* IAM role in the project."}
+		case ProviderAKS:
+			return []string{"AKS rejected the token: check AKS_AAD_SERVER_APP_ID, and that the cluster's Azure AD integration trusts your tenant."}
+		}
+		return nil
+	case ConnectionAuthorized:
+		switch provider {
+		case ProviderEKS:
+			return []string{"The identity is authenticated but not authorized: associate an access policy such as AmazonEKSViewPolicy with its access entry, or bind its aws-auth username or groups with RBAC."}
+		case ProviderGKE:
+			return []string{"The identity is authenticated but not authorized: grant roles/container.viewer in the project or bind it with RBAC."}
+		case ProviderAKS:
+			return []string{"The identity is authenticated but not authorized: with Azure RBAC, assign an Azure Kubernetes Service RBAC role on the cluster; otherwise bind the user or its groups with Kubernetes RBAC."}
+		}
+		return nil
+	case ConnectionHealthy:
+		return []string{"The API server is reachable but reports not ready: run check api-health to see which of its checks fail (etcd, admission webhooks, aggregated APIs)."}
+	}
+	return nil
+}
+
+// PrintConnectionReport prints each stage with ✓, ✗ or not reached, followed by hints
+func PrintConnectionReport(report *ConnectionReport) {
+	if report.Endpoint != "" {
+		fmt.Printf("Connection to %s:\n", report.Endpoint)
+	} else {
+		fmt.Println("Connection:")
+	}
+	steps := map[ConnectionStage]ConnectionStep{}
+	for _, step := range report.Steps {
+		steps[step.Stage] = step
+	}
+	for _, stage := range connectionStages {
+		step, ok := steps[stage]
+		switch {
+		case !ok:
+			fmt.Printf("  - %-11s not reached\n", stage)
+		case step.Error != "":
+			fmt.Printf("  ✗ %-11s %s\n", stage, step.Error)
+		default:
+			fmt.Printf("  ✓ %-11s %s (%s)\n", stage, step.Detail, step.Duration.Round(time.Millisecond))
+		}
+	}
+	if len(report.Hints) > 0 {
+		fmt.Println("\nHints:")
+		for _, hint := range report.Hints {
+			fmt.Printf("  - %s\n", hint)
+		}
+	}
+}
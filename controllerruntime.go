@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AddToSchemeFunc registers API types with a scheme, e.g. the AddToScheme of a CRD's API package
+type AddToSchemeFunc func(*runtime.Scheme) error
+
+// NewScheme returns a scheme with the built-in Kubernetes types plus the types added by addToScheme
+func NewScheme(addToScheme ...AddToSchemeFunc) (*runtime.Scheme, error) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("failed to register Kubernetes types: %w", err)
+	}
+
+	for _, add := range addToScheme {
+		if err := add(scheme); err != nil {
+			return nil, fmt.Errorf("failed to register types with scheme: %w", err)
+		}
+	}
+
+	return scheme, nil
+}
+
+// NewControllerRuntimeClient returns a controller-runtime client for a connected managed cluster,
+// so operators can use this package as the layer that authenticates to AKS, EKS or GKE
+func NewControllerRuntimeClient(client ClusterClient, addToScheme ...AddToSchemeFunc) (ctrlclient.Client, error) {
+	restConfig := client.RESTConfig()
+	if restConfig == nil {
+		return nil, fmt.Errorf("kubernetes client is not initialized")
+	}
+
+	return NewControllerRuntimeClientForConfig(restConfig, addToScheme...)
+}
+
+// NewControllerRuntimeClientForConfig returns a controller-runtime client for restConfig
+func NewControllerRuntimeClientForConfig(restConfig *rest.Config, addToScheme ...AddToSchemeFunc) (ctrlclient.Client, error) {
+	scheme, err := NewScheme(addToScheme...)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := ctrlclient.New(restConfig, ctrlclient.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create controller-runtime client: %w", err)
+	}
+
+	return client, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ParseClusterSelector parses a tag selector such as "env=prod,team=payments" using
+// Kubernetes label selector syntax (=, !=, in, notin, exists)
+func ParseClusterSelector(selector string) (labels.Selector, error) {
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster selector %q: %w", selector, err)
+	}
+	return parsed, nil
+}
+
+// FetchClusterTags reads a cluster's cloud tags (AKS/EKS tags, GKE resource labels) from the
+// provider API without connecting to its Kubernetes API server
+func FetchClusterTags(ctx context.Context, cluster FleetCluster) (map[string]string, error) {
+	switch cluster.Provider {
+	case ProviderAKS:
+		cred, err := cluster.credentials.azureCredential()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Azure credential: %w", err)
+		}
+		client, err := newManagedClustersClient(cluster.Account, cred)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create AKS client: %w", err)
+		}
+		resp, err := client.Get(ctx, cluster.ResourceGroup, cluster.Name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cluster: %w", err)
+		}
+		return azureTags(resp.Tags), nil
+
+	case ProviderEKS:
+		manager, err := NewAWSClientManager(cluster.awsConfig())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create AWS client manager: %w", err)
+		}
+		out, err := newEKSAPIClient(manager.GetAWSConfig()).DescribeCluster(ctx, &eks.DescribeClusterInput{
+			Name: aws.String(cluster.Name),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe cluster: %w", err)
+		}
+		return out.Cluster.Tags, nil
+
+	case ProviderGKE:
+		gcpConfig, err := cluster.gcpConfig()
+		if err != nil {
+			return nil, err
+		}
+		manager, err := NewGCPClientManager(gcpConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GCP client manager: %w", err)
+		}
+		defer manager.Close()
+		resp, err := manager.GetGKEClient().GetCluster(ctx, &containerpb.GetClusterRequest{
+			Name: fmt.Sprintf("projects/%s/locations/%s/clusters/%s", manager.GetProjectID(), manager.GetZone(), cluster.Name),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cluster: %w", err)
+		}
+		return resp.ResourceLabels, nil
+
+	default:
+		return nil, fmt.Errorf("unknown provider %q", cluster.Provider)
+	}
+}
+
+// SelectFleetClusters resolves the tags of every cluster in config, honouring the fleet's
+// concurrency limits, and returns the clusters matching selector in config order. Clusters
+// whose tags cannot be read are reported in the returned results and are not selected.
+func SelectFleetClusters(ctx context.Context, config *FleetConfig, selector labels.Selector) ([]FleetCluster, []FleetResult) {
+	if selector.Empty() {
+		return config.Clusters, nil
+	}
+
+	slots := newFleetSlots(config.Concurrency)
+	matched := make([]bool, len(config.Clusters))
+	tags := make([]map[string]string, len(config.Clusters))
+	errs := make([]error, len(config.Clusters))
+
+	var wg sync.WaitGroup
+	for i, cluster := range config.Clusters {
+		wg.Add(1)
+		go func(i int, cluster FleetCluster) {
+			defer wg.Done()
+
+			release, err := slots.acquire(ctx, cluster.Provider)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer release()
+
+			clusterTags, err := FetchClusterTags(ctx, cluster)
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to resolve tags: %w", err)
+				return
+			}
+			tags[i] = clusterTags
+			matched[i] = selector.Matches(labels.Set(clusterTags))
+		}(i, cluster)
+	}
+	wg.Wait()
+
+	var selected []FleetCluster
+	var failures []FleetResult
+	for i, cluster := range config.Clusters {
+		switch {
+		case errs[i] != nil:
+			failures = append(failures, FleetResult{Cluster: cluster, Err: errs[i]})
+		case matched[i]:
+			// Keep the tags for AnnotateClusterTags, on a copy of the config entry
+			cluster.tags = tags[i]
+			selected = append(selected, cluster)
+		}
+	}
+
+	return selected, failures
+}
+
+// AnnotateClusterTags attaches the cloud tags of each cluster to its result, honouring the
+// fleet's concurrency limits. Tags read by SelectFleetClusters are reused; clusters whose tags
+// cannot be read are left without them.
+func AnnotateClusterTags(ctx context.Context, config *FleetConfig, results []FleetResult) {
+	slots := newFleetSlots(config.Concurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		if results[i].Cluster.tags != nil {
+			results[i].Tags = results[i].Cluster.tags
+			continue
+		}
+		wg.Add(1)
+		go func(result *FleetResult) {
+			defer wg.Done()
+
+			release, err := slots.acquire(ctx, result.Cluster.Provider)
+			if err != nil {
+				return
+			}
+			defer release()
+
+			tags, err := FetchClusterTags(ctx, result.Cluster)
+			if err != nil {
+				Verbosef("Failed to read the tags of %s: %v", result.Cluster.Identity().Key(), err)
+				return
+			}
+			result.Tags = tags
+		}(&results[i])
+	}
+	wg.Wait()
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DefaultProbeImage is a small image that ships nslookup and nc
+	DefaultProbeImage = "busybox:1.36"
+	// cloudMetadataAddress is the link-local metadata endpoint on all three clouds
+	cloudMetadataAddress = "169.254.169.254"
+)
+
+// ProbeResult is the outcome of a single in-cluster probe step
+type ProbeResult struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// DNSProbeOptions configures the in-cluster DNS and connectivity probe pod
+type DNSProbeOptions struct {
+	Image          string
+	Namespace      string
+	ClusterDomain  string
+	ExternalDomain string
+	Timeout        time.Duration
+}
+
+// dnsProbeScript builds the shell script run by the probe pod. Each step prints a
+// "PROBE <name> ok|fail <detail>" line that is parsed from the pod logs.
+func dnsProbeScript(provider Provider, opts DNSProbeOptions) string {
+	steps := []string{
+		fmt.Sprintf("probe cluster-dns nslookup kubernetes.default.svc.%s", opts.ClusterDomain),
+		fmt.Sprintf("probe external-dns nslookup %s", opts.ExternalDomain),
+		fmt.Sprintf("probe egress-tcp nc -z -w 5 %s 443", opts.ExternalDomain),
+	}
+	if provider == ProviderGKE {
+		steps = append(steps, "probe metadata-dns nslookup metadata.google.internal")
+	}
+	steps = append(steps, fmt.Sprintf("probe metadata-tcp nc -z -w 3 %s 80", cloudMetadataAddress))
+
+	return `probe() {
+  name=$1; shift
+  if out=$("$@" 2>&1); then echo "PROBE $name ok"; else echo "PROBE $name fail $(echo "$out" | tail -n 2 | tr '\n' ' ')"; fi
+}
+` + strings.Join(steps, "\n") + "\n"
+}
+
+// RunDNSProbe launches a short-lived pod that resolves the cluster DNS name of the API
+// server service, an external domain and the cloud metadata endpoint, and reports the result
+// of each step. The pod is always deleted afterwards.
+func RunDNSProbe(ctx context.Context, clientset kubernetes.Interface, provider Provider, opts DNSProbeOptions) ([]ProbeResult, error) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "connect-k8s-dns-probe-",
+			Namespace:    opts.Namespace,
+			Labels:       map[string]string{"app.kubernetes.io/managed-by": "connect-managed-k8s"},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:         corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds: int64Ptr(int64(opts.Timeout.Seconds())),
+			NodeSelector:          map[string]string{"kubernetes.io/os": "linux"},
+			Containers: []corev1.Container{{
+				Name:    "probe",
+				Image:   opts.Image,
+				Command: []string{"sh", "-c", dnsProbeScript(provider, opts)},
+			}},
+		},
+	}
+
+	created, err := clientset.CoreV1().Pods(opts.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create probe pod: %w", err)
+	}
+	defer deleteProbePod(clientset, created.Namespace, created.Name)
+
+	if err := waitForPodCompletion(ctx, clientset, created.Namespace, created.Name, opts.Timeout); err != nil {
+		return nil, err
+	}
+
+	logs, err := clientset.CoreV1().Pods(created.Namespace).GetLogs(created.Name, &corev1.PodLogOptions{}).DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read probe pod logs: %w", err)
+	}
+
+	return parseProbeOutput(string(logs)), nil
+}
+
+// CheckDNSProbe runs the in-cluster probe and turns it into a check result
+func CheckDNSProbe(ctx context.Context, client ClusterClient, opts DNSProbeOptions) CheckResult {
+	result := CheckResult{Name: "dns-probe"}
+
+	probes, err := RunDNSProbe(ctx, client.Clientset(), client.Identity().Provider, opts)
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	failed := 0
+	for _, probe := range probes {
+		if probe.OK {
+			result.Details = append(result.Details, fmt.Sprintf("✓ %s", probe.Name))
+			continue
+		}
+		failed++
+		result.Details = append(result.Details, fmt.Sprintf("✗ %s: %s", probe.Name, probe.Detail))
+	}
+
+	switch {
+	case len(probes) == 0:
+		result.Status = CheckFail
+		result.Message = "probe pod produced no results"
+	case failed > 0:
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%d of %d in-cluster probes failed", failed, len(probes))
+	default:
+		result.Status = CheckPass
+		result.Message = "CoreDNS, egress and metadata endpoint reachable from inside the cluster"
+	}
+
+	return result
+}
+
+// waitForPodCompletion waits until the pod has succeeded or failed
+func waitForPodCompletion(ctx context.Context, clientset kubernetes.Interface, namespace, name string, timeout time.Duration) error {
+	step := progress.Start(fmt.Sprintf("Waiting for probe pod %s/%s", namespace, name))
+	defer step.Done()
+
+	var lastPhase corev1.PodPhase
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		lastPhase = pod.Status.Phase
+		return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed, nil
+	})
+	if err != nil {
+		return fmt.Errorf("probe pod %s/%s did not complete (last phase %q): %w", namespace, name, lastPhase, err)
+	}
+	return nil
+}
+
+// deleteProbePod removes a probe pod, logging instead of failing so cleanup never masks a result
+func deleteProbePod(clientset kubernetes.Interface, namespace, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	propagation := metav1.DeletePropagationBackground
+	err := clientset.CoreV1().Pods(namespace).Delete(ctx, name, metav1.DeleteOptions{
+		GracePeriodSeconds: int64Ptr(0),
+		PropagationPolicy:  &propagation,
+	})
+	if err != nil {
+		Warnf("Failed to delete probe pod %s/%s: %v", namespace, name, err)
+	}
+}
+
+// parseProbeOutput extracts the PROBE lines written by the probe script
+func parseProbeOutput(output string) []ProbeResult {
+	var results []ProbeResult
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.SplitN(strings.TrimSpace(scanner.Text()), " ", 4)
+		if len(fields) < 3 || fields[0] != "PROBE" {
+			continue
+		}
+
+		result := ProbeResult{Name: fields[1], OK: fields[2] == "ok"}
+		if len(fields) == 4 {
+			result.Detail = strings.TrimSpace(fields[3])
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// int64Ptr returns a pointer to v
+func int64Ptr(v int64) *int64 {
+	return &v
+}
@@ -0,0 +1,596 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsarn "github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/version"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// DeclaredCluster is a cluster as declared in infrastructure as code, with the attributes
+// compared against the cloud API
+type DeclaredCluster struct {
+	Cluster FleetCluster
+	// Source names the declaration, e.g. terraform:module.eks.aws_eks_cluster.this
+	Source string
+	// Attributes are keyed like the live attributes: version, location, tags.<key>, ...
+	Attributes map[string]string
+	// ownTagPrefix marks live tags added by the IaC tool itself, which are not drift
+	ownTagPrefix string
+}
+
+// iacSchema locates a cluster's identity and attributes in a Terraform resource's attributes
+// or a Crossplane managed resource. Each field lists candidate paths, the first found wins;
+// lists on the way are entered at their first element.
+type iacSchema struct {
+	provider      Provider
+	name          [][]string
+	account       [][]string
+	region        [][]string
+	resourceGroup [][]string
+	id            [][]string // ARN or Azure resource ID supplying what is not declared directly
+	tags          [][]string
+	attributes    map[string][]string
+}
+
+// terraformSchemas are the supported Terraform resource types
+var terraformSchemas = map[string]iacSchema{
+	"aws_eks_cluster": {
+		provider: ProviderEKS,
+		name:     [][]string{{"name"}},
+		id:       [][]string{{"arn"}},
+		tags:     [][]string{{"tags_all"}, {"tags"}},
+		attributes: map[string][]string{
+			"version":               {"version"},
+			"roleArn":               {"role_arn"},
+			"endpointPublicAccess":  {"vpc_config", "endpoint_public_access"},
+			"endpointPrivateAccess": {"vpc_config", "endpoint_private_access"},
+		},
+	},
+	"google_container_cluster": {
+		provider: ProviderGKE,
+		name:     [][]string{{"name"}},
+		account:  [][]string{{"project"}},
+		region:   [][]string{{"location"}},
+		tags:     [][]string{{"effective_labels"}, {"resource_labels"}},
+		attributes: map[string][]string{
+			"version":        {"min_master_version"},
+			"location":       {"location"},
+			"releaseChannel": {"release_channel", "channel"},
+			"privateCluster": {"private_cluster_config", "enable_private_nodes"},
+		},
+	},
+	"azurerm_kubernetes_cluster": {
+		provider:      ProviderAKS,
+		name:          [][]string{{"name"}},
+		resourceGroup: [][]string{{"resource_group_name"}},
+		id:            [][]string{{"id"}},
+		tags:          [][]string{{"tags"}},
+		attributes: map[string][]string{
+			"version":        {"kubernetes_version"},
+			"location":       {"location"},
+			"skuTier":        {"sku_tier"},
+			"privateCluster": {"private_cluster_enabled"},
+		},
+	},
+}
+
+// crossplaneSchemas are the supported Crossplane managed resources of the Upbound providers,
+// keyed by API group and kind
+var crossplaneSchemas = map[string]iacSchema{
+	"eks.aws.upbound.io/Cluster": {
+		provider: ProviderEKS,
+		name:     [][]string{{"metadata", "annotations", "crossplane.io/external-name"}, {"metadata", "name"}},
+		region:   [][]string{{"spec", "forProvider", "region"}},
+		id:       [][]string{{"status", "atProvider", "arn"}},
+		tags:     [][]string{{"spec", "forProvider", "tags"}},
+		attributes: map[string][]string{
+			"version":               {"spec", "forProvider", "version"},
+			"roleArn":               {"spec", "forProvider", "roleArn"},
+			"endpointPublicAccess":  {"spec", "forProvider", "vpcConfig", "endpointPublicAccess"},
+			"endpointPrivateAccess": {"spec", "forProvider", "vpcConfig", "endpointPrivateAccess"},
+		},
+	},
+	"container.gcp.upbound.io/Cluster": {
+		provider: ProviderGKE,
+		name:     [][]string{{"metadata", "annotations", "crossplane.io/external-name"}, {"metadata", "name"}},
+		account:  [][]string{{"spec", "forProvider", "project"}, {"status", "atProvider", "project"}},
+		region:   [][]string{{"spec", "forProvider", "location"}},
+		tags:     [][]string{{"spec", "forProvider", "resourceLabels"}},
+		attributes: map[string][]string{
+			"version":        {"spec", "forProvider", "minMasterVersion"},
+			"location":       {"spec", "forProvider", "location"},
+			"releaseChannel": {"spec", "forProvider", "releaseChannel", "channel"},
+			"privateCluster": {"spec", "forProvider", "privateClusterConfig", "enablePrivateNodes"},
+		},
+	},
+	"containerservice.azure.upbound.io/KubernetesCluster": {
+		provider:      ProviderAKS,
+		name:          [][]string{{"metadata", "annotations", "crossplane.io/external-name"}, {"metadata", "name"}},
+		resourceGroup: [][]string{{"spec", "forProvider", "resourceGroupName"}},
+		id:            [][]string{{"status", "atProvider", "id"}},
+		tags:          [][]string{{"spec", "forProvider", "tags"}},
+		attributes: map[string][]string{
+			"version":        {"spec", "forProvider", "kubernetesVersion"},
+			"location":       {"spec", "forProvider", "location"},
+			"skuTier":        {"spec", "forProvider", "skuTier"},
+			"privateCluster": {"spec", "forProvider", "privateClusterEnabled"},
+		},
+	},
+}
+
+// terraformState is the part of a Terraform state file (format version 4) naming resources
+type terraformState struct {
+	Version   int `json:"version"`
+	Resources []struct {
+		Module    string `json:"module"`
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Instances []struct {
+			IndexKey   interface{}            `json:"index_key"`
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+// LoadTerraformState reads the EKS, GKE and AKS clusters managed by a Terraform state file, as
+// written by the local backend or terraform state pull
+func LoadTerraformState(path string) ([]DeclaredCluster, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Terraform state: %w", err)
+	}
+	var state terraformState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse Terraform state %s: %w", path, err)
+	}
+	if state.Version != 4 {
+		return nil, fmt.Errorf("unsupported Terraform state version %d in %s (expected 4)", state.Version, path)
+	}
+
+	var clusters []DeclaredCluster
+	for _, resource := range state.Resources {
+		schema, ok := terraformSchemas[resource.Type]
+		if !ok || resource.Mode != "managed" {
+			continue
+		}
+		address := resource.Type + "." + resource.Name
+		if resource.Module != "" {
+			address = resource.Module + "." + address
+		}
+		for _, instance := range resource.Instances {
+			source := "terraform:" + address
+			if instance.IndexKey != nil {
+				key, _ := json.Marshal(instance.IndexKey)
+				source += "[" + string(key) + "]"
+			}
+			cluster, err := schema.declare(instance.Attributes, source)
+			if err != nil {
+				return nil, err
+			}
+			clusters = append(clusters, cluster)
+		}
+	}
+	return clusters, nil
+}
+
+// LoadCrossplaneResources reads the EKS, GKE and AKS clusters among Crossplane managed resources
+// saved as YAML or JSON, e.g. with kubectl get managed -o yaml. Lists and multi-document files
+// are accepted.
+func LoadCrossplaneResources(path string) ([]DeclaredCluster, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Crossplane resources: %w", err)
+	}
+
+	var clusters []DeclaredCluster
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		var obj unstructured.Unstructured
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse Crossplane resources %s: %w", path, err)
+		}
+		if obj.Object == nil {
+			continue
+		}
+		objects := []unstructured.Unstructured{obj}
+		if obj.IsList() {
+			list, err := obj.ToList()
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse Crossplane resources %s: %w", path, err)
+			}
+			objects = list.Items
+		}
+
+		for _, item := range objects {
+			schema, ok := crossplaneSchemas[item.GroupVersionKind().Group+"/"+item.GetKind()]
+			if !ok {
+				continue
+			}
+			cluster, err := schema.declare(item.Object, "crossplane:"+item.GetKind()+"/"+item.GetName())
+			if err != nil {
+				return nil, err
+			}
+			// Crossplane tags or labels cloud resources with crossplane-kind, crossplane-name
+			// and crossplane-providerconfig
+			cluster.ownTagPrefix = "crossplane-"
+			clusters = append(clusters, cluster)
+		}
+	}
+	return clusters, nil
+}
+
+// declare extracts the cluster identity and attributes described by schema from obj
+func (s iacSchema) declare(obj map[string]interface{}, source string) (DeclaredCluster, error) {
+	cluster := FleetCluster{
+		Provider:      s.provider,
+		Name:          lookupFirst(obj, s.name),
+		Account:       lookupFirst(obj, s.account),
+		Region:        lookupFirst(obj, s.region),
+		ResourceGroup: lookupFirst(obj, s.resourceGroup),
+	}
+	if id := lookupFirst(obj, s.id); id != "" {
+		switch s.provider {
+		case ProviderEKS:
+			if parsed, err := awsarn.Parse(id); err == nil {
+				cluster.Account = parsed.AccountID
+				if cluster.Region == "" {
+					cluster.Region = parsed.Region
+				}
+			}
+		case ProviderAKS:
+			if parsed, err := arm.ParseResourceID(id); err == nil {
+				cluster.Account = parsed.SubscriptionID
+				if cluster.ResourceGroup == "" {
+					cluster.ResourceGroup = parsed.ResourceGroupName
+				}
+			}
+		}
+	}
+	if cluster.Name == "" {
+		return DeclaredCluster{}, fmt.Errorf("%s: cluster name not found", source)
+	}
+	if cluster.Region != "" {
+		if region, err := NormalizeLocation(s.provider, cluster.Region, LocationAny); err == nil {
+			cluster.Region = region
+		}
+	}
+
+	attributes := map[string]string{}
+	for name, path := range s.attributes {
+		if value, ok := lookupPath(obj, path); ok {
+			attributes[name] = value
+		}
+	}
+	for _, path := range s.tags {
+		value, ok := lookupValue(obj, path)
+		if !ok {
+			continue
+		}
+		tags, _ := value.(map[string]interface{})
+		for key, tag := range tags {
+			attributes["tags."+key] = fmt.Sprint(tag)
+		}
+		// An empty map still declares that the cluster has no tags
+		attributes["tags"] = ""
+		break
+	}
+	return DeclaredCluster{Cluster: cluster, Source: source, Attributes: attributes}, nil
+}
+
+// lookupFirst returns the first of paths found in obj as a string
+func lookupFirst(obj map[string]interface{}, paths [][]string) string {
+	for _, path := range paths {
+		if value, ok := lookupPath(obj, path); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// lookupPath returns the scalar at path in obj as a string
+func lookupPath(obj map[string]interface{}, path []string) (string, bool) {
+	value, ok := lookupValue(obj, path)
+	if !ok {
+		return "", false
+	}
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	default:
+		return "", false
+	}
+}
+
+// lookupValue walks path through obj, entering lists at their first element
+func lookupValue(obj map[string]interface{}, path []string) (interface{}, bool) {
+	var current interface{} = obj
+	for _, key := range path {
+		if list, ok := current.([]interface{}); ok {
+			if len(list) == 0 {
+				return nil, false
+			}
+			current = list[0]
+		}
+		fields, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = fields[key]; !ok || current == nil {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// AttributeDrift is an attribute whose declared value differs from the live one
+type AttributeDrift struct {
+	Attribute string `json:"attribute"`
+	Declared  string `json:"declared"`
+	Live      string `json:"live"`
+}
+
+// ClusterDrift is the drift found for one declared cluster
+type ClusterDrift struct {
+	Cluster string           `json:"cluster"`
+	Source  string           `json:"source"`
+	Drift   []AttributeDrift `json:"drift,omitempty"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// CheckDrift compares each declared cluster with its live state from the cloud API, honouring
+// the concurrency limits of fleet, or the defaults without one. Clusters also listed in fleet, when given, connect with
+// the credentials of their fleet entry; others use the environment.
+func CheckDrift(ctx context.Context, declared []DeclaredCluster, fleet *FleetConfig) []ClusterDrift {
+	var concurrency ConcurrencyConfig
+	if fleet != nil {
+		concurrency = fleet.Concurrency
+	}
+	slots := newFleetSlots(concurrency)
+	results := make([]ClusterDrift, len(declared))
+
+	var wg sync.WaitGroup
+	for i, cluster := range declared {
+		wg.Add(1)
+		go func(i int, cluster DeclaredCluster) {
+			defer wg.Done()
+			target := cluster.Cluster
+			if fleet != nil {
+				if entry, err := fleet.FindCluster(target.Identity().Key()); err == nil {
+					target = entry
+				}
+			}
+			results[i] = ClusterDrift{Cluster: target.Identity().Key(), Source: cluster.Source}
+
+			release, err := slots.acquire(ctx, target.Provider)
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			defer release()
+
+			live, err := fetchLiveAttributes(ctx, target)
+			if err != nil {
+				results[i].Error = Redact(err.Error())
+				return
+			}
+			results[i].Drift = compareAttributes(target.Provider, cluster, live)
+		}(i, cluster)
+	}
+	wg.Wait()
+	return results
+}
+
+// compareAttributes lists the declared attributes whose live value differs. Declared versions
+// match live versions they prefix, so 1.31 matches 1.31.5-eks-1234, and a declared GKE minimum
+// master version matches any live version at least as new. Tags are compared only when
+// the declaration has tags, and then live tags it lacks are drift too.
+func compareAttributes(provider Provider, cluster DeclaredCluster, live map[string]string) []AttributeDrift {
+	declared := cluster.Attributes
+	var drift []AttributeDrift
+	for name, want := range declared {
+		if name == "tags" || want == "" {
+			continue
+		}
+		got, ok := live[name]
+		if !ok && !strings.HasPrefix(name, "tags.") {
+			continue
+		}
+		if !attributeMatches(provider, name, want, got) {
+			drift = append(drift, AttributeDrift{Attribute: name, Declared: want, Live: got})
+		}
+	}
+	if _, ok := declared["tags"]; ok {
+		for name, got := range live {
+			_, declaredTag := declared[name]
+			ownTag := cluster.ownTagPrefix != "" && strings.HasPrefix(name, "tags."+cluster.ownTagPrefix)
+			if strings.HasPrefix(name, "tags.") && !declaredTag && !ownTag {
+				drift = append(drift, AttributeDrift{Attribute: name, Live: got})
+			}
+		}
+	}
+	sort.Slice(drift, func(i, j int) bool { return drift[i].Attribute < drift[j].Attribute })
+	return drift
+}
+
+// attributeMatches compares a declared and a live value the way the provider reports them
+func attributeMatches(provider Provider, name, want, got string) bool {
+	switch name {
+	case "version":
+		if provider == ProviderGKE {
+			// GKE declares min_master_version, which the control plane may be upgraded past
+			if want == "latest" {
+				return true
+			}
+			minimum, err1 := version.ParseGeneric(want)
+			current, err2 := version.ParseGeneric(got)
+			if err1 == nil && err2 == nil {
+				return current.AtLeast(minimum)
+			}
+		}
+		return got == want || strings.HasPrefix(got, want+".") || strings.HasPrefix(got, want+"-")
+	case "location":
+		normalizedWant, err1 := NormalizeLocation(provider, want, LocationAny)
+		normalizedGot, err2 := NormalizeLocation(provider, got, LocationAny)
+		if err1 == nil && err2 == nil {
+			return normalizedWant == normalizedGot
+		}
+	case "skuTier", "releaseChannel":
+		return strings.EqualFold(want, got)
+	}
+	return want == got
+}
+
+// fetchLiveAttributes reads the attributes compared for drift from the provider API, without
+// connecting to the cluster's Kubernetes API server
+func fetchLiveAttributes(ctx context.Context, cluster FleetCluster) (map[string]string, error) {
+	attributes := map[string]string{}
+	var tags map[string]string
+
+	switch cluster.Provider {
+	case ProviderAKS:
+		if cluster.Account == "" || cluster.ResourceGroup == "" {
+			return nil, fmt.Errorf("subscription and resource group of AKS cluster %s are not declared", cluster.Name)
+		}
+		cred, err := cluster.credentials.azureCredential()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Azure credential: %w", err)
+		}
+		client, err := newManagedClustersClient(cluster.Account, cred)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create AKS client: %w", err)
+		}
+		resp, err := client.Get(ctx, cluster.ResourceGroup, cluster.Name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cluster: %w", err)
+		}
+		if resp.Location != nil {
+			attributes["location"] = *resp.Location
+		}
+		if props := resp.Properties; props != nil {
+			if props.CurrentKubernetesVersion != nil {
+				attributes["version"] = *props.CurrentKubernetesVersion
+			}
+			private := props.APIServerAccessProfile != nil && props.APIServerAccessProfile.EnablePrivateCluster != nil && *props.APIServerAccessProfile.EnablePrivateCluster
+			attributes["privateCluster"] = strconv.FormatBool(private)
+		}
+		if resp.SKU != nil && resp.SKU.Tier != nil {
+			attributes["skuTier"] = string(*resp.SKU.Tier)
+		}
+		tags = azureTags(resp.Tags)
+
+	case ProviderEKS:
+		if cluster.Region == "" {
+			return nil, fmt.Errorf("region of EKS cluster %s is not declared", cluster.Name)
+		}
+		manager, err := NewAWSClientManager(cluster.awsConfig())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create AWS client manager: %w", err)
+		}
+		out, err := newEKSAPIClient(manager.GetAWSConfig()).DescribeCluster(ctx, &eks.DescribeClusterInput{
+			Name: aws.String(cluster.Name),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe cluster: %w", err)
+		}
+		attributes["version"] = aws.ToString(out.Cluster.Version)
+		attributes["roleArn"] = aws.ToString(out.Cluster.RoleArn)
+		if vpc := out.Cluster.ResourcesVpcConfig; vpc != nil {
+			attributes["endpointPublicAccess"] = strconv.FormatBool(vpc.EndpointPublicAccess)
+			attributes["endpointPrivateAccess"] = strconv.FormatBool(vpc.EndpointPrivateAccess)
+		}
+		tags = out.Cluster.Tags
+
+	case ProviderGKE:
+		if cluster.Account == "" || cluster.Region == "" {
+			return nil, fmt.Errorf("project and location of GKE cluster %s are not declared", cluster.Name)
+		}
+		gcpConfig, err := cluster.gcpConfig()
+		if err != nil {
+			return nil, err
+		}
+		manager, err := NewGCPClientManager(gcpConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GCP client manager: %w", err)
+		}
+		defer manager.Close()
+		resp, err := manager.GetGKEClient().GetCluster(ctx, &containerpb.GetClusterRequest{
+			Name: fmt.Sprintf("projects/%s/locations/%s/clusters/%s", manager.GetProjectID(), manager.GetZone(), cluster.Name),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cluster: %w", err)
+		}
+		attributes["version"] = resp.CurrentMasterVersion
+		attributes["location"] = resp.Location
+		if resp.ReleaseChannel != nil {
+			attributes["releaseChannel"] = resp.ReleaseChannel.Channel.String()
+		}
+		attributes["privateCluster"] = strconv.FormatBool(resp.GetPrivateClusterConfig().GetEnablePrivateNodes())
+		tags = resp.ResourceLabels
+
+	default:
+		return nil, fmt.Errorf("unknown provider %q", cluster.Provider)
+	}
+
+	for key, value := range tags {
+		attributes["tags."+key] = value
+	}
+	return attributes, nil
+}
+
+// PrintDriftReport prints the drift of each declared cluster and returns the number of clusters
+// that drifted or could not be checked
+func PrintDriftReport(results []ClusterDrift) int {
+	problems := 0
+	for _, result := range results {
+		switch {
+		case result.Error != "":
+			problems++
+			fmt.Printf("✗ %s (%s): %s\n", result.Cluster, result.Source, result.Error)
+		case len(result.Drift) > 0:
+			problems++
+			fmt.Printf("✗ %s (%s): %d attribute(s) drifted\n", result.Cluster, result.Source, len(result.Drift))
+			for _, drift := range result.Drift {
+				fmt.Printf("    %s: declared %s, live %s\n", drift.Attribute, quoteOrUnset(drift.Declared), quoteOrUnset(drift.Live))
+			}
+		default:
+			fmt.Printf("✓ %s (%s): no drift\n", result.Cluster, result.Source)
+		}
+	}
+	fmt.Printf("\n%d of %d declared clusters match the cloud\n", len(results)-problems, len(results))
+	return problems
+}
+
+// quoteOrUnset quotes value, or describes an empty value as unset
+func quoteOrUnset(value string) string {
+	if value == "" {
+		return "(unset)"
+	}
+	return strconv.Quote(value)
+}
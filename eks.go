@@ -5,18 +5,29 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
 	"github.com/aws/aws-sdk-go-v2/service/eks"
+	ekstypes "github.com/aws/aws-sdk-go-v2/service/eks/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/joho/godotenv"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
 )
 
@@ -26,17 +37,26 @@ const (
 
 // AWSConfig represents AWS configuration options
 type AWSConfig struct {
-	Region       string
-	Profile      string
-	AccessKey    string
-	SecretKey    string
-	SessionToken string
+	Region         string // empty finds the region of an EKS client's cluster by searching
+	Profile        string
+	AccessKey      string
+	SecretKey      string
+	SessionToken   string
+	CredentialsDir string        // mounted Secret directory with AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY files (optional)
+	TokenTTL       time.Duration // how long EKS auth tokens are reused (default DefaultEKSTokenTTL)
+	RoleARN        string        // role assumed on top of the base credentials (optional)
+	ExternalID     string        // external ID for RoleARN (optional)
+	AuthRoleARN    string        // role the Kubernetes token is minted as, if not the discovery role (optional)
+	STSRegion      string        // region whose STS endpoint tokens are presigned for (default Region)
+	STSEndpoint    string        // STS endpoint URL tokens are presigned for, e.g. a VPC or FIPS endpoint (optional)
 }
 
 // AWSClientManager manages AWS clients and configurations
 type AWSClientManager struct {
-	config    AWSConfig
-	awsConfig aws.Config
+	config      AWSConfig
+	awsConfig   aws.Config
+	tokenConfig aws.Config // presigns Kubernetes tokens; awsConfig unless AuthRoleARN is set
+	accountID   string
 }
 
 // NewAWSClientManager creates a new AWS client manager
@@ -62,25 +82,57 @@ func (m *AWSClientManager) initializeAWSConfig(ctx context.Context) error {
 	}
 
 	if m.config.AccessKey != "" && m.config.SecretKey != "" {
-		fmt.Println("Using static AWS credentials")
+		Infof("Using static AWS credentials")
 		awsCfg, err = m.configWithStaticCredentials(ctx)
+	} else if m.config.CredentialsDir != "" {
+		Infof("Using AWS credentials mounted in %s", m.config.CredentialsDir)
+		awsCfg, err = config.LoadDefaultConfig(ctx,
+			config.WithRegion(m.config.Region),
+			config.WithCredentialsProvider(aws.NewCredentialsCache(newAWSFileCredentials(m.config.CredentialsDir))),
+		)
 	} else if m.config.Profile != "" {
-		fmt.Printf("Using AWS profile: %s\n", m.config.Profile)
+		Infof("Using AWS profile: %s", m.config.Profile)
 		awsCfg, err = m.configWithSharedProfile(ctx)
 	} else {
-		fmt.Println("Using default AWS credential chain")
+		Infof("Using default AWS credential chain")
 		awsCfg, err = m.configWithDefaultChain(ctx)
 	}
 
 	if err != nil {
 		return fmt.Errorf("failed to load AWS configuration: %w", err)
 	}
+	// Every client made from the configuration, STS and S3 included, records its operations and
+	// is subject to read-only mode
+	awsCfg.APIOptions = append(awsCfg.APIOptions, awsAuditMiddleware, awsReadOnlyMiddleware)
 
-	if err := m.validateCredentials(ctx, awsCfg); err != nil {
+	if m.config.RoleARN != "" {
+		Infof("Assuming AWS role: %s", m.config.RoleARN)
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awsCfg), m.config.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = "connect-managed-k8s"
+			if m.config.ExternalID != "" {
+				o.ExternalID = aws.String(m.config.ExternalID)
+			}
+		})
+		awsCfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	// Validation retrieves the credentials, assuming the role if one is configured
+	err = runPhase(ctx, PhaseAuth, func(ctx context.Context) error {
+		return m.validateCredentials(ctx, awsCfg)
+	})
+	if err != nil {
 		return fmt.Errorf("AWS credential validation failed: %w", err)
 	}
 
 	m.awsConfig = awsCfg
+	m.tokenConfig = awsCfg
+	if m.config.AuthRoleARN != "" {
+		Infof("Minting Kubernetes tokens as AWS role: %s", m.config.AuthRoleARN)
+		m.tokenConfig = awsCfg.Copy()
+		m.tokenConfig.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awsCfg), m.config.AuthRoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = "connect-managed-k8s"
+		}))
+	}
 	return nil
 }
 
@@ -146,11 +198,12 @@ func (m *AWSClientManager) validateCredentials(ctx context.Context, awsCfg aws.C
 		return fmt.Errorf("incomplete AWS caller identity information")
 	}
 
-	fmt.Printf("AWS Credentials Validated:\n")
-	fmt.Printf("  Account ID: %s\n", aws.ToString(result.Account))
-	fmt.Printf("  User ID: %s\n", aws.ToString(result.UserId))
-	fmt.Printf("  ARN: %s\n", aws.ToString(result.Arn))
+	Verbosef("AWS Credentials Validated:")
+	Verbosef("  Account ID: %s", aws.ToString(result.Account))
+	Verbosef("  User ID: %s", aws.ToString(result.UserId))
+	Verbosef("  ARN: %s", aws.ToString(result.Arn))
 
+	m.accountID = aws.ToString(result.Account)
 	return nil
 }
 
@@ -159,6 +212,50 @@ func (m *AWSClientManager) GetAWSConfig() aws.Config {
 	return m.awsConfig
 }
 
+// setRegion switches the manager to region, e.g. once the cluster has been found there
+func (m *AWSClientManager) setRegion(region string) {
+	m.config.Region = region
+	m.awsConfig.Region = region
+	m.tokenConfig.Region = region
+}
+
+// GetTokenConfig returns the AWS configuration Kubernetes tokens are presigned with, which
+// assumes AuthRoleARN when one is configured
+func (m *AWSClientManager) GetTokenConfig() aws.Config {
+	return m.tokenConfig
+}
+
+// NewS3Client returns an S3 client using the manager's credentials, in region when set
+func (m *AWSClientManager) NewS3Client(region string) *s3.Client {
+	return s3.NewFromConfig(m.awsConfig, func(o *s3.Options) {
+		if region != "" {
+			o.Region = region
+		}
+	})
+}
+
+// newTokenSTSClient returns the STS client Kubernetes tokens are presigned with. Tokens are
+// always presigned for a regional endpoint (the SDK never uses the global sts.amazonaws.com),
+// by default in the cluster's region.
+func (m *AWSClientManager) newTokenSTSClient() *sts.Client {
+	return sts.NewFromConfig(m.tokenConfig, func(o *sts.Options) {
+		if m.config.STSRegion != "" {
+			o.Region = m.config.STSRegion
+		}
+		if m.config.STSEndpoint != "" {
+			o.BaseEndpoint = aws.String(m.config.STSEndpoint)
+		}
+	})
+}
+
+// tokenRoleARN returns the role Kubernetes tokens are minted as, if any
+func (m *AWSClientManager) tokenRoleARN() string {
+	if m.config.AuthRoleARN != "" {
+		return m.config.AuthRoleARN
+	}
+	return m.config.RoleARN
+}
+
 // GetAccountID retrieves the AWS Account ID dynamically using STS
 func (m *AWSClientManager) GetAccountID(ctx context.Context) (string, error) {
 	stsClient := sts.NewFromConfig(m.awsConfig)
@@ -170,50 +267,139 @@ func (m *AWSClientManager) GetAccountID(ctx context.Context) (string, error) {
 	return aws.ToString(result.Account), nil
 }
 
+// EKSClientOptions holds per-cluster connection options for EKS
+type EKSClientOptions struct {
+	// EndpointOverride replaces the API server endpoint returned by EKS, e.g. a custom DNS
+	// name or a PrivateLink endpoint in front of the cluster
+	EndpointOverride string
+	// TLSServerName is the name the API server certificate is validated against. It defaults
+	// to the EKS endpoint's host name when EndpointOverride is set, so the cluster CA and
+	// certificate SANs keep being verified through the custom endpoint.
+	TLSServerName string
+	// SupportWarningDays is how many days before the end of standard support GetClusterInfo
+	// starts warning (default DefaultEKSSupportWarningDays)
+	SupportWarningDays int
+	// SearchRegions are the regions searched for the cluster when AWSConfig.Region is empty
+	// (default the commercial regions)
+	SearchRegions []string
+	// DeferKubernetes skips connecting to the Kubernetes API server in the constructor, so
+	// cloud-only operations work while it is unreachable; see ConnectKubernetes
+	DeferKubernetes bool
+	// WaitForReady is how long connecting waits for a cluster that is being created or updated
+	// to become ready, polling with backoff; zero fails immediately
+	WaitForReady time.Duration
+	// UserAgent overrides DefaultUserAgent in Kubernetes API requests
+	UserAgent string
+	// Headers are added to every Kubernetes API request, e.g. for an API gateway in front of
+	// the API server
+	Headers map[string]string
+	// Impersonate makes Kubernetes API requests act as another user and groups, e.g. to verify
+	// what they can see; the connecting identity needs the impersonate RBAC verb
+	Impersonate rest.ImpersonationConfig
+}
+
 // EKSClient wraps the EKS and Kubernetes clients with improved AWS configuration
 type EKSClient struct {
 	awsClientManager *AWSClientManager
 	eksClient        *eks.Client
+	k8sMu            sync.Mutex // guards k8sClient and restConfig
 	k8sClient        *kubernetes.Clientset
+	restConfig       *rest.Config
 	clusterName      string
 	region           string
+	options          EKSClientOptions
+}
+
+// newEKSAPIClient creates an EKS API client subject to the EKS rate limiter
+func newEKSAPIClient(cfg aws.Config) *eks.Client {
+	return eks.NewFromConfig(cfg, func(o *eks.Options) {
+		o.APIOptions = append(o.APIOptions, awsTimeoutMiddleware, awsRateLimitMiddleware)
+	})
 }
 
 // NewEKSClient creates a new EKS client with improved AWS configuration management
 func NewEKSClient(clusterName string, awsConfig AWSConfig) (*EKSClient, error) {
+	return NewEKSClientWithOptions(clusterName, awsConfig, EKSClientOptions{})
+}
+
+// NewEKSClientWithOptions creates a new EKS client with per-cluster connection options
+func NewEKSClientWithOptions(clusterName string, awsConfig AWSConfig, opts EKSClientOptions) (*EKSClient, error) {
 	clientManager, err := NewAWSClientManager(awsConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create AWS client manager: %w", err)
 	}
+	if awsConfig.Region == "" {
+		regions := opts.SearchRegions
+		if len(regions) == 0 {
+			regions = defaultEKSSearchRegions()
+		}
+		region, err := locateEKSCluster(context.Background(), clientManager.GetAWSConfig(), clusterName, regions)
+		if err != nil {
+			return nil, err
+		}
+		clientManager.setRegion(region)
+	}
 
-	eksClient := eks.NewFromConfig(clientManager.GetAWSConfig())
+	eksClient := newEKSAPIClient(clientManager.GetAWSConfig())
 
 	client := &EKSClient{
 		awsClientManager: clientManager,
 		eksClient:        eksClient,
 		clusterName:      clusterName,
-		region:           awsConfig.Region,
+		region:           clientManager.config.Region,
+		options:          opts,
 	}
 
-	if err := client.initKubernetesClient(); err != nil {
-		return nil, fmt.Errorf("failed to initialize Kubernetes client: %w", err)
+	if !opts.DeferKubernetes {
+		if err := client.ConnectKubernetes(context.Background()); err != nil {
+			return nil, err
+		}
 	}
 
 	return client, nil
 }
 
+// ConnectKubernetes connects to the cluster's API server unless already connected. A failed
+// attempt is retried by the next call.
+func (c *EKSClient) ConnectKubernetes(ctx context.Context) error {
+	c.k8sMu.Lock()
+	defer c.k8sMu.Unlock()
+	if c.k8sClient != nil {
+		return nil
+	}
+	if err := c.initKubernetesClient(ctx); err != nil {
+		return fmt.Errorf("failed to initialize Kubernetes client: %w", err)
+	}
+	return nil
+}
+
+// eksClusterState classifies an EKS cluster status; CREATING and UPDATING clusters become ACTIVE
+// on their own
+func eksClusterState(status ekstypes.ClusterStatus) clusterState {
+	return clusterState{
+		Status:       string(status),
+		Ready:        status == ekstypes.ClusterStatusActive,
+		Transitional: status == ekstypes.ClusterStatusCreating || status == ekstypes.ClusterStatusUpdating || status == ekstypes.ClusterStatusPending,
+	}
+}
+
 // initKubernetesClient initializes the Kubernetes client using EKS cluster info
-func (c *EKSClient) initKubernetesClient() error {
-	clusterOutput, err := c.eksClient.DescribeCluster(context.TODO(), &eks.DescribeClusterInput{
-		Name: aws.String(c.clusterName),
+func (c *EKSClient) initKubernetesClient(ctx context.Context) error {
+	var cluster *ekstypes.Cluster
+	err := pollClusterReady(ctx, ProviderEKS, c.clusterName, c.options.WaitForReady, func(ctx context.Context) (clusterState, error) {
+		step := progress.Start(fmt.Sprintf("Describing EKS cluster %s", c.clusterName))
+		clusterOutput, err := c.eksClient.DescribeCluster(ctx, &eks.DescribeClusterInput{
+			Name: aws.String(c.clusterName),
+		})
+		step.Done()
+		if err != nil {
+			return clusterState{}, fmt.Errorf("failed to describe EKS cluster: %w", err)
+		}
+		cluster = clusterOutput.Cluster
+		return eksClusterState(cluster.Status), nil
 	})
 	if err != nil {
-		return fmt.Errorf("failed to describe EKS cluster: %w", err)
-	}
-
-	cluster := clusterOutput.Cluster
-	if cluster.Status != "ACTIVE" {
-		return fmt.Errorf("cluster %s is not active, current status: %s", c.clusterName, cluster.Status)
+		return err
 	}
 
 	caCert, err := base64.StdEncoding.DecodeString(*cluster.CertificateAuthority.Data)
@@ -221,25 +407,34 @@ func (c *EKSClient) initKubernetesClient() error {
 		return fmt.Errorf("failed to decode certificate authority data: %w", err)
 	}
 
-	generator, err := token.NewGenerator(true, false)
+	tok, err := c.getToken()
 	if err != nil {
-		return fmt.Errorf("failed to create token generator: %w", err)
+		return err
 	}
 
-	tok, err := generator.GetWithOptions(context.TODO(), &token.GetTokenOptions{
-		ClusterID: c.clusterName,
-	})
+	host, serverName, err := c.resolveEndpoint(aws.ToString(cluster.Endpoint))
 	if err != nil {
-		return fmt.Errorf("failed to generate auth token: %w", err)
+		return err
 	}
 
 	kubeConfig := &rest.Config{
-		Host:        *cluster.Endpoint,
+		Host:        host,
 		BearerToken: tok.Token,
 		TLSClientConfig: rest.TLSClientConfig{
-			CAData: caCert,
+			CAData:     caCert,
+			ServerName: serverName,
 		},
 	}
+	applyRequestHeaders(kubeConfig, c.options.UserAgent, c.options.Headers)
+	applyReadOnlyGuard(kubeConfig)
+	applyAuditLog(kubeConfig, c.Identity)
+	kubeConfig.Impersonate = c.options.Impersonate
+	applyKubernetesTimeout(kubeConfig)
+	applyTokenRefresh(kubeConfig, func(ctx context.Context) (string, error) {
+		defaultEKSTokenCache.Invalidate(c.tokenCacheKey())
+		tok, err := c.getToken()
+		return tok.Token, err
+	})
 
 	clientset, err := kubernetes.NewForConfig(kubeConfig)
 	if err != nil {
@@ -247,51 +442,316 @@ func (c *EKSClient) initKubernetesClient() error {
 	}
 
 	c.k8sClient = clientset
+	c.restConfig = kubeConfig
 	return nil
 }
 
+// resolveEndpoint applies the endpoint and TLS server name overrides to the EKS endpoint
+func (c *EKSClient) resolveEndpoint(endpoint string) (string, string, error) {
+	if c.options.EndpointOverride == "" {
+		return endpoint, c.options.TLSServerName, nil
+	}
+
+	host := c.options.EndpointOverride
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+
+	serverName := c.options.TLSServerName
+	if serverName == "" {
+		parsed, err := url.Parse(endpoint)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to parse EKS endpoint %q: %w", endpoint, err)
+		}
+		serverName = parsed.Hostname()
+	}
+
+	Verbosef("Using endpoint override %s (validating certificate for %s)", host, serverName)
+	return host, serverName, nil
+}
+
+// tokenCacheKey identifies the client's tokens in the EKS token cache
+func (c *EKSClient) tokenCacheKey() string {
+	return eksTokenCacheKey(c.awsClientManager.accountID, c.region, c.clusterName, c.awsClientManager.tokenRoleARN())
+}
+
+// getToken returns a presigned authentication token for the cluster, reusing a cached
+// one while it is still valid
+func (c *EKSClient) getToken() (token.Token, error) {
+	ttl := c.awsClientManager.config.TokenTTL
+	if ttl <= 0 {
+		ttl = DefaultEKSTokenTTL
+	}
+
+	return defaultEKSTokenCache.Get(c.tokenCacheKey(), ttl, func() (token.Token, error) {
+		step := progress.Start("Minting EKS authentication token")
+		defer step.Done()
+
+		generator, err := token.NewGenerator(true, false)
+		if err != nil {
+			return token.Token{}, fmt.Errorf("failed to create token generator: %w", err)
+		}
+
+		// Presign with the client's own credentials (static keys, profile or assumed role,
+		// or AuthRoleARN on top of them) rather than the generator's default chain
+		var tok token.Token
+		err = runPhase(context.Background(), PhaseAuth, func(ctx context.Context) error {
+			var err error
+			tok, err = generator.GetWithSTS(c.clusterName, c.awsClientManager.newTokenSTSClient())
+			return err
+		})
+		if err != nil {
+			return token.Token{}, fmt.Errorf("failed to generate auth token: %w", err)
+		}
+		return tok, nil
+	})
+}
+
 // GetClusterInfo returns basic information about the EKS cluster
-func (c *EKSClient) GetClusterInfo() error {
-	clusterOutput, err := c.eksClient.DescribeCluster(context.TODO(), &eks.DescribeClusterInput{
+func (c *EKSClient) GetClusterInfo() (*ClusterInfo, error) {
+	ctx := context.TODO()
+
+	clusterOutput, err := c.eksClient.DescribeCluster(ctx, &eks.DescribeClusterInput{
 		Name: aws.String(c.clusterName),
 	})
 	if err != nil {
-		return fmt.Errorf("failed to describe cluster: %w", err)
+		return nil, fmt.Errorf("failed to describe cluster: %w", err)
 	}
 
 	cluster := clusterOutput.Cluster
-	fmt.Printf("Cluster Information:\n")
-	fmt.Printf("  Name: %s\n", *cluster.Name)
-	fmt.Printf("  Status: %s\n", cluster.Status)
-	fmt.Printf("  Version: %s\n", *cluster.Version)
-	fmt.Printf("  Endpoint: %s\n", *cluster.Endpoint)
-	fmt.Printf("  Created: %s\n", cluster.CreatedAt.Format(time.RFC3339))
-	fmt.Printf("  Platform Version: %s\n", *cluster.PlatformVersion)
+	info := &ClusterInfo{
+		Name:     aws.ToString(cluster.Name),
+		Provider: ProviderEKS,
+		Account:  c.awsClientManager.accountID,
+		Region:   c.region,
+		Version:  aws.ToString(cluster.Version),
+		Endpoint: aws.ToString(cluster.Endpoint),
+		Status:   string(cluster.Status),
+		Details:  map[string]string{"Platform Version": aws.ToString(cluster.PlatformVersion)},
+	}
 
-	return nil
+	if cluster.CreatedAt != nil {
+		info.CreatedAt = *cluster.CreatedAt
+	}
+
+	if cluster.ResourcesVpcConfig != nil {
+		info.Network = aws.ToString(cluster.ResourcesVpcConfig.VpcId)
+	}
+
+	if len(cluster.Tags) > 0 {
+		info.Tags = cluster.Tags
+	}
+
+	supportType := ""
+	if cluster.UpgradePolicy != nil {
+		supportType = string(cluster.UpgradePolicy.SupportType)
+		info.Details["Support Type"] = supportType
+		info.ReleaseChannel = supportType
+	}
+	support := c.GetSupportStatus(ctx, info.Version, supportType)
+	if !support.StandardSupportEnds.IsZero() {
+		info.Details["Standard Support Ends"] = support.StandardSupportEnds.Format("2006-01-02")
+		info.Details["Extended Support Ends"] = support.ExtendedSupportEnds.Format("2006-01-02")
+	}
+	warnDays := c.options.SupportWarningDays
+	if warnDays <= 0 {
+		warnDays = DefaultEKSSupportWarningDays
+	}
+	info.Warnings = append(info.Warnings, support.Warnings(time.Now(), warnDays)...)
+
+	nodeCount, spotGroups, err := c.summarizeNodegroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	info.NodeCount = nodeCount
+	if len(spotGroups) > 0 {
+		info.Details["Interruptible Node Pools"] = strings.Join(spotGroups, ", ")
+	}
+
+	return info, nil
 }
 
-// ListKubeSystemPods lists all pods in the kube-system namespace
-func (c *EKSClient) ListPods() error {
-	namespace := "kube-system"
+// summarizeNodegroups sums the desired size of the cluster's managed node groups and lists
+// those running on spot capacity
+func (c *EKSClient) summarizeNodegroups(ctx context.Context) (int, []string, error) {
+	total := 0
+	var spot []string
+	paginator := eks.NewListNodegroupsPaginator(c.eksClient, &eks.ListNodegroupsInput{
+		ClusterName: aws.String(c.clusterName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to list node groups: %w", err)
+		}
+
+		for _, name := range page.Nodegroups {
+			nodegroup, err := c.eksClient.DescribeNodegroup(ctx, &eks.DescribeNodegroupInput{
+				ClusterName:   aws.String(c.clusterName),
+				NodegroupName: aws.String(name),
+			})
+			if err != nil {
+				return 0, nil, fmt.Errorf("failed to describe node group %s: %w", name, err)
+			}
+			if scaling := nodegroup.Nodegroup.ScalingConfig; scaling != nil && scaling.DesiredSize != nil {
+				total += int(*scaling.DesiredSize)
+			}
+			if nodegroup.Nodegroup.CapacityType == ekstypes.CapacityTypesSpot {
+				spot = append(spot, name+" (spot)")
+			}
+		}
+	}
+
+	return total, spot, nil
+}
+
+// eksTaintEffects maps Kubernetes taint effects to their EKS API names
+var eksTaintEffects = map[corev1.TaintEffect]ekstypes.TaintEffect{
+	corev1.TaintEffectNoSchedule:       ekstypes.TaintEffectNoSchedule,
+	corev1.TaintEffectPreferNoSchedule: ekstypes.TaintEffectPreferNoSchedule,
+	corev1.TaintEffectNoExecute:        ekstypes.TaintEffectNoExecute,
+}
+
+// CreateNodePool creates a managed node group in the cluster's subnets and waits until it is
+// ACTIVE. Without spec.NodeRole the node role of an existing node group is used.
+func (c *EKSClient) CreateNodePool(ctx context.Context, spec NodePoolSpec) error {
+	cluster, err := c.eksClient.DescribeCluster(ctx, &eks.DescribeClusterInput{Name: aws.String(c.clusterName)})
+	if err != nil {
+		return fmt.Errorf("failed to describe EKS cluster: %w", err)
+	}
+	if cluster.Cluster.ResourcesVpcConfig == nil || len(cluster.Cluster.ResourcesVpcConfig.SubnetIds) == 0 {
+		return fmt.Errorf("cluster %s has no subnets to place nodes in", c.clusterName)
+	}
 
-	pods, err := c.k8sClient.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
+	nodeRole := spec.NodeRole
+	if nodeRole == "" {
+		if nodeRole, err = c.existingNodeRole(ctx); err != nil {
+			return err
+		}
+	}
+
+	scaling := &ekstypes.NodegroupScalingConfig{
+		DesiredSize: aws.Int32(spec.Count),
+		MinSize:     aws.Int32(spec.Count),
+		MaxSize:     aws.Int32(max(spec.Count, 1)),
+	}
+	if spec.Autoscaling != nil {
+		scaling.MinSize = aws.Int32(spec.Autoscaling.Min)
+		scaling.MaxSize = aws.Int32(spec.Autoscaling.Max)
+	}
+	var taints []ekstypes.Taint
+	for _, taint := range spec.Taints {
+		taints = append(taints, ekstypes.Taint{
+			Key:    aws.String(taint.Key),
+			Value:  aws.String(taint.Value),
+			Effect: eksTaintEffects[taint.Effect],
+		})
+	}
+
+	_, err = c.eksClient.CreateNodegroup(ctx, &eks.CreateNodegroupInput{
+		ClusterName:   aws.String(c.clusterName),
+		NodegroupName: aws.String(spec.Name),
+		NodeRole:      aws.String(nodeRole),
+		Subnets:       cluster.Cluster.ResourcesVpcConfig.SubnetIds,
+		InstanceTypes: []string{spec.MachineType},
+		ScalingConfig: scaling,
+		Labels:        spec.Labels,
+		Taints:        taints,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to list pods in namespace %s: %w", namespace, err)
+		return fmt.Errorf("failed to create node group %s: %w", spec.Name, err)
 	}
 
-	fmt.Printf("\nPods in namespace '%s' (%d total):\n", namespace, len(pods.Items))
-	for _, pod := range pods.Items {
-		fmt.Printf("  Name: %s\n", pod.Name)
-		fmt.Printf("    Status: %s\n", pod.Status.Phase)
-		fmt.Printf("    Node: %s\n", pod.Spec.NodeName)
-		fmt.Printf("    Created: %s\n", pod.CreationTimestamp.Format(time.RFC3339))
-		fmt.Println()
+	waiter := eks.NewNodegroupActiveWaiter(c.eksClient)
+	input := &eks.DescribeNodegroupInput{ClusterName: aws.String(c.clusterName), NodegroupName: aws.String(spec.Name)}
+	if err := waiter.Wait(ctx, input, nodePoolWait(ctx)); err != nil {
+		return fmt.Errorf("node group %s did not become active: %w", spec.Name, err)
 	}
+	return nil
+}
 
+// existingNodeRole returns the node role of the cluster's first managed node group
+func (c *EKSClient) existingNodeRole(ctx context.Context) (string, error) {
+	groups, err := c.eksClient.ListNodegroups(ctx, &eks.ListNodegroupsInput{ClusterName: aws.String(c.clusterName)})
+	if err != nil {
+		return "", fmt.Errorf("failed to list node groups: %w", err)
+	}
+	for _, name := range groups.Nodegroups {
+		nodegroup, err := c.eksClient.DescribeNodegroup(ctx, &eks.DescribeNodegroupInput{
+			ClusterName:   aws.String(c.clusterName),
+			NodegroupName: aws.String(name),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to describe node group %s: %w", name, err)
+		}
+		if role := aws.ToString(nodegroup.Nodegroup.NodeRole); role != "" {
+			Verbosef("Using node role %s of node group %s", role, name)
+			return role, nil
+		}
+	}
+	return "", fmt.Errorf("cluster %s has no node group to copy the node role from; set the node role", c.clusterName)
+}
+
+// DeleteNodePool deletes a managed node group and waits until it is gone
+func (c *EKSClient) DeleteNodePool(ctx context.Context, name string) error {
+	_, err := c.eksClient.DeleteNodegroup(ctx, &eks.DeleteNodegroupInput{
+		ClusterName:   aws.String(c.clusterName),
+		NodegroupName: aws.String(name),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete node group %s: %w", name, err)
+	}
+
+	waiter := eks.NewNodegroupDeletedWaiter(c.eksClient)
+	input := &eks.DescribeNodegroupInput{ClusterName: aws.String(c.clusterName), NodegroupName: aws.String(name)}
+	if err := waiter.Wait(ctx, input, nodePoolWait(ctx)); err != nil {
+		return fmt.Errorf("node group %s was not deleted: %w", name, err)
+	}
 	return nil
 }
 
+// UpgradeControlPlane starts a cluster version update and polls it until it succeeds or fails
+func (c *EKSClient) UpgradeControlPlane(ctx context.Context, target string) error {
+	out, err := c.eksClient.UpdateClusterVersion(ctx, &eks.UpdateClusterVersionInput{
+		Name:    aws.String(c.clusterName),
+		Version: aws.String(target),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start upgrade: %w", err)
+	}
+
+	input := &eks.DescribeUpdateInput{Name: aws.String(c.clusterName), UpdateId: out.Update.Id}
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for update %s: %w", aws.ToString(out.Update.Id), ctx.Err())
+		case <-time.After(30 * time.Second):
+		}
+		update, err := c.eksClient.DescribeUpdate(ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to get update status: %w", err)
+		}
+		switch update.Update.Status {
+		case ekstypes.UpdateStatusSuccessful:
+			return nil
+		case ekstypes.UpdateStatusFailed, ekstypes.UpdateStatusCancelled:
+			var messages []string
+			for _, detail := range update.Update.Errors {
+				messages = append(messages, aws.ToString(detail.ErrorMessage))
+			}
+			return fmt.Errorf("update %s %s: %s", aws.ToString(out.Update.Id), strings.ToLower(string(update.Update.Status)), strings.Join(messages, "; "))
+		}
+	}
+}
+
+// ListPods lists all pods in the kube-system namespace, page by page
+func (c *EKSClient) ListPods() error {
+	if err := c.ConnectKubernetes(context.TODO()); err != nil {
+		return err
+	}
+	return printPods(context.TODO(), c.Clientset(), "kube-system")
+}
+
 // GetAccountID returns the AWS account ID for this EKS client
 func (c *EKSClient) GetAccountID(ctx context.Context) (string, error) {
 	return c.awsClientManager.GetAccountID(ctx)
@@ -302,40 +762,398 @@ func (c *EKSClient) GetRegion() string {
 	return c.region
 }
 
-// RunAWSTest runs the AWS EKS test client
-func RunEKSTest() error {
-	err := godotenv.Load()
+// GetAWSConfig returns the authenticated aws.Config, for creating other AWS SDK clients without
+// resolving credentials again
+func (c *EKSClient) GetAWSConfig() aws.Config {
+	return c.awsClientManager.GetAWSConfig()
+}
+
+// GetEKSAPIClient returns the EKS API client, subject to the EKS rate limiter and cloud API timeout
+func (c *EKSClient) GetEKSAPIClient() *eks.Client {
+	return c.eksClient
+}
+
+// Identity returns the provider-neutral identity of the EKS cluster
+func (c *EKSClient) Identity() ClusterIdentity {
+	return ClusterIdentity{
+		Provider: ProviderEKS,
+		Account:  c.awsClientManager.accountID,
+		Region:   c.region,
+		Name:     c.clusterName,
+	}
+}
+
+// kubernetesClients returns the clientset and rest.Config set by ConnectKubernetes, both nil
+// before it succeeds
+func (c *EKSClient) kubernetesClients() (*kubernetes.Clientset, *rest.Config) {
+	c.k8sMu.Lock()
+	defer c.k8sMu.Unlock()
+	return c.k8sClient, c.restConfig
+}
+
+// RESTConfig returns a copy of the authenticated rest.Config for the cluster's API server
+func (c *EKSClient) RESTConfig() *rest.Config {
+	_, config := c.kubernetesClients()
+	if config == nil {
+		return nil
+	}
+	return rest.CopyConfig(config)
+}
+
+// Clientset returns the typed Kubernetes clientset, or nil before ConnectKubernetes
+func (c *EKSClient) Clientset() kubernetes.Interface {
+	clientset, _ := c.kubernetesClients()
+	if clientset == nil {
+		return nil
+	}
+	return clientset
+}
+
+// Discovery returns the discovery client of the Kubernetes clientset, or nil before
+// ConnectKubernetes
+func (c *EKSClient) Discovery() discovery.DiscoveryInterface {
+	clientset, _ := c.kubernetesClients()
+	if clientset == nil {
+		return nil
+	}
+	return clientset.Discovery()
+}
+
+// Dynamic returns a dynamic client sharing the clientset's authentication
+func (c *EKSClient) Dynamic() (dynamic.Interface, error) {
+	_, config := c.kubernetesClients()
+	if config == nil {
+		return nil, ErrKubernetesNotConnected
+	}
+	client, err := dynamic.NewForConfig(config)
 	if err != nil {
-		log.Printf("Warning: .env file not found, using environment variables")
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	return client, nil
+}
+
+// BuildClientCmdAPIConfig returns an in-memory kubeconfig for the cluster using the
+// provider's naming convention, without writing credentials to disk
+func (c *EKSClient) BuildClientCmdAPIConfig() (*clientcmdapi.Config, error) {
+	return buildKubeconfig(c, defaultKubeconfigNames(c.Identity()))
+}
+
+// RawRequest sends a request to a non-resource path of the cluster's API server
+func (c *EKSClient) RawRequest(ctx context.Context, method, path string) ([]byte, error) {
+	return rawRequest(ctx, c, method, path)
+}
+
+// RegistryCredentials mints credentials for an ECR registry with GetAuthorizationToken in the
+// registry's region. Other registries get nil.
+func (c *EKSClient) RegistryCredentials(ctx context.Context, registry string) (*RegistryAuth, error) {
+	match := ecrRegistryHost.FindStringSubmatch(registry)
+	if match == nil {
+		return nil, nil
+	}
+	ecrClient := ecr.NewFromConfig(c.awsClientManager.GetAWSConfig(), func(o *ecr.Options) {
+		o.Region = match[2]
+		o.APIOptions = append(o.APIOptions, awsTimeoutMiddleware, awsRateLimitMiddleware)
+	})
+	output, err := ecrClient.GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ECR authorization token: %w", err)
+	}
+	if len(output.AuthorizationData) == 0 || output.AuthorizationData[0].AuthorizationToken == nil {
+		return nil, fmt.Errorf("ECR returned no authorization token")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(*output.AuthorizationData[0].AuthorizationToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ECR authorization token: %w", err)
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return nil, fmt.Errorf("ECR authorization token is not username:password")
+	}
+	auth := &RegistryAuth{Username: username, Password: password}
+	if expiresAt := output.AuthorizationData[0].ExpiresAt; expiresAt != nil {
+		auth.Expiry = *expiresAt
+	}
+	return auth, nil
+}
+
+// CloudAccessMappings lists the cluster's access entries with their associated access policies
+// and, when the authentication mode still reads it, the IAM roles and users mapped in the
+// aws-auth ConfigMap
+func (c *EKSClient) CloudAccessMappings(ctx context.Context) ([]AccessMapping, error) {
+	clusterOutput, err := c.eksClient.DescribeCluster(ctx, &eks.DescribeClusterInput{
+		Name: aws.String(c.clusterName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe cluster: %w", err)
+	}
+	mode := ekstypes.AuthenticationModeConfigMap
+	if access := clusterOutput.Cluster.AccessConfig; access != nil && access.AuthenticationMode != "" {
+		mode = access.AuthenticationMode
+	}
+
+	var mappings []AccessMapping
+	if mode != ekstypes.AuthenticationModeConfigMap {
+		entries, err := c.accessEntryMappings(ctx)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, entries...)
+	}
+	if mode != ekstypes.AuthenticationModeApi {
+		if err := c.ConnectKubernetes(ctx); err != nil {
+			return nil, err
+		}
+		awsAuth, err := awsAuthMappings(ctx, c.Clientset())
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, awsAuth...)
+	}
+	sortAccessMappings(mappings)
+	return mappings, nil
+}
+
+// accessEntryMappings describes each access entry and lists the access policies associated with it
+func (c *EKSClient) accessEntryMappings(ctx context.Context) ([]AccessMapping, error) {
+	var mappings []AccessMapping
+	paginator := eks.NewListAccessEntriesPaginator(c.eksClient, &eks.ListAccessEntriesInput{
+		ClusterName: aws.String(c.clusterName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list access entries: %w", err)
+		}
+
+		for _, principal := range page.AccessEntries {
+			entry, err := c.eksClient.DescribeAccessEntry(ctx, &eks.DescribeAccessEntryInput{
+				ClusterName:  aws.String(c.clusterName),
+				PrincipalArn: aws.String(principal),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe access entry %s: %w", principal, err)
+			}
+			mapping := AccessMapping{
+				Source:    "EKS access entry",
+				Principal: principal,
+				Username:  aws.ToString(entry.AccessEntry.Username),
+				Groups:    entry.AccessEntry.KubernetesGroups,
+			}
+			if entryType := aws.ToString(entry.AccessEntry.Type); entryType != "" && entryType != "STANDARD" {
+				mapping.Source += " (" + strings.ToLower(entryType) + ")"
+			}
+
+			policies := eks.NewListAssociatedAccessPoliciesPaginator(c.eksClient, &eks.ListAssociatedAccessPoliciesInput{
+				ClusterName:  aws.String(c.clusterName),
+				PrincipalArn: aws.String(principal),
+			})
+			for policies.HasMorePages() {
+				policyPage, err := policies.NextPage(ctx)
+				if err != nil {
+					return nil, fmt.Errorf("failed to list access policies of %s: %w", principal, err)
+				}
+				for _, policy := range policyPage.AssociatedAccessPolicies {
+					name := aws.ToString(policy.PolicyArn)
+					if i := strings.LastIndex(name, "/"); i >= 0 {
+						name = name[i+1:]
+					}
+					if scope := policy.AccessScope; scope != nil && scope.Type == ekstypes.AccessScopeTypeNamespace {
+						name += " in " + strings.Join(scope.Namespaces, ", ")
+					}
+					mapping.Access = append(mapping.Access, name)
+				}
+			}
+			mappings = append(mappings, mapping)
+		}
+	}
+	return mappings, nil
+}
+
+// Session reports the caller identity of the AWS credentials and when they expire. Credentials
+// that cannot expire, such as IAM user access keys, have no expiry.
+func (c *EKSClient) Session(ctx context.Context) (*SessionInfo, error) {
+	awsCfg := c.awsClientManager.GetAWSConfig()
+	creds, err := awsCfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	caller, err := sts.NewFromConfig(awsCfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AWS caller identity: %w", err)
 	}
 
+	session := &SessionInfo{
+		Provider: ProviderEKS,
+		Identity: aws.ToString(caller.Arn),
+		Account:  aws.ToString(caller.Account),
+		Source:   creds.Source,
+	}
+	if creds.CanExpire {
+		session.Expires = creds.Expires
+	}
+	return session, nil
+}
+
+// ClusterCIDRs returns the cluster's service range. Pods take VPC subnet addresses through the
+// Amazon VPC CNI, so there is no pod range.
+func (c *EKSClient) ClusterCIDRs(ctx context.Context) (*ClusterCIDRs, error) {
+	clusterOutput, err := c.eksClient.DescribeCluster(ctx, &eks.DescribeClusterInput{
+		Name: aws.String(c.clusterName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe cluster: %w", err)
+	}
+	cidrs := &ClusterCIDRs{PodsFromSubnets: true}
+	if network := clusterOutput.Cluster.KubernetesNetworkConfig; network != nil {
+		for _, cidr := range []*string{network.ServiceIpv4Cidr, network.ServiceIpv6Cidr} {
+			if aws.ToString(cidr) != "" {
+				cidrs.ServiceCIDRs = append(cidrs.ServiceCIDRs, *cidr)
+			}
+		}
+	}
+	return cidrs, nil
+}
+
+// ClusterTraits reports whether the cluster is Fargate-only: it has Fargate profiles and no
+// managed node groups
+func (c *EKSClient) ClusterTraits(ctx context.Context) (*ClusterTraits, error) {
+	nodegroups, err := c.eksClient.ListNodegroups(ctx, &eks.ListNodegroupsInput{
+		ClusterName: aws.String(c.clusterName),
+		MaxResults:  aws.Int32(1),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list node groups: %w", err)
+	}
+	traits := &ClusterTraits{}
+	if len(nodegroups.Nodegroups) > 0 {
+		return traits, nil
+	}
+	profiles, err := c.eksClient.ListFargateProfiles(ctx, &eks.ListFargateProfilesInput{
+		ClusterName: aws.String(c.clusterName),
+		MaxResults:  aws.Int32(1),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Fargate profiles: %w", err)
+	}
+	traits.FargateOnly = len(profiles.FargateProfileNames) > 0
+	return traits, nil
+}
+
+// Close is a no-op; the AWS SDK clients hold no long-lived connections
+func (c *EKSClient) Close() error {
+	return nil
+}
+
+// newEKSClientFromEnv creates an EKS client from the EKS_* and AWS_* environment variables
+func newEKSClientFromEnv(deferKubernetes bool) (*EKSClient, error) {
 	clusterName := os.Getenv("EKS_CLUSTER_NAME")
 	if clusterName == "" {
-		return fmt.Errorf("EKS_CLUSTER_NAME environment variable is required")
+		return nil, fmt.Errorf("EKS_CLUSTER_NAME environment variable is required")
 	}
 
+	// Without AWS_REGION the client searches the regions for the cluster
 	region := os.Getenv("AWS_REGION")
-	if region == "" {
-		region = AWSDefaultRegion
-		fmt.Printf("AWS_REGION not set, using default: %s\n", region)
+	if region != "" {
+		normalized, err := NormalizeLocation(ProviderEKS, region, LocationRegion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AWS_REGION: %w", err)
+		}
+		region = normalized
+	}
+
+	awsConfig := awsCredentialsFromEnv(region)
+	awsConfig.AuthRoleARN = os.Getenv("EKS_AUTH_ROLE_ARN")
+	awsConfig.STSEndpoint = os.Getenv("EKS_STS_ENDPOINT")
+
+	if stsRegion := os.Getenv("EKS_STS_REGION"); stsRegion != "" {
+		normalized, err := NormalizeLocation(ProviderEKS, stsRegion, LocationRegion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EKS_STS_REGION: %w", err)
+		}
+		awsConfig.STSRegion = normalized
+	}
+
+	if ttl := os.Getenv("EKS_TOKEN_TTL"); ttl != "" {
+		tokenTTL, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EKS_TOKEN_TTL %q: %w", ttl, err)
+		}
+		awsConfig.TokenTTL = tokenTTL
+	}
+
+	if region != "" {
+		Infof("Connecting to EKS cluster '%s' in region '%s'...", clusterName, region)
+	} else {
+		Infof("AWS_REGION not set, searching for EKS cluster '%s'...", clusterName)
 	}
 
-	awsConfig := AWSConfig{
+	opts := EKSClientOptions{
+		EndpointOverride: os.Getenv("EKS_ENDPOINT_OVERRIDE"),
+		TLSServerName:    os.Getenv("EKS_TLS_SERVER_NAME"),
+		DeferKubernetes:  deferKubernetes,
+		WaitForReady:     waitForReady,
+		Impersonate:      impersonation,
+	}
+	userAgent, headers, err := requestHeadersFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	opts.UserAgent, opts.Headers = userAgent, headers
+	searchRegions, err := eksSearchRegionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	opts.SearchRegions = searchRegions
+
+	if days := os.Getenv("EKS_SUPPORT_WARN_DAYS"); days != "" {
+		warnDays, err := strconv.Atoi(days)
+		if err != nil || warnDays <= 0 {
+			return nil, fmt.Errorf("invalid EKS_SUPPORT_WARN_DAYS %q", days)
+		}
+		opts.SupportWarningDays = warnDays
+	}
+
+	client, err := NewEKSClientWithOptions(clusterName, awsConfig, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create EKS client: %w", err)
+	}
+
+	return client, nil
+}
+
+// awsCredentialsFromEnv returns an AWSConfig for region with the AWS_PROFILE and static key
+// settings of the environment, falling back to keys mounted in the credentials directory
+func awsCredentialsFromEnv(region string) AWSConfig {
+	cfg := AWSConfig{
 		Region:       region,
 		Profile:      os.Getenv("AWS_PROFILE"),
 		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
 		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
 		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
 	}
+	if cfg.AccessKey == "" && cfg.Profile == "" {
+		_, hasAccessKey := credentialFile("AWS_ACCESS_KEY_ID")
+		_, hasSecretKey := credentialFile("AWS_SECRET_ACCESS_KEY")
+		if hasAccessKey && hasSecretKey {
+			cfg.CredentialsDir = credentialsDir()
+		}
+	}
+	return cfg
+}
 
-	fmt.Printf("Connecting to EKS cluster '%s' in region '%s'...\n", clusterName, region)
+// RunAWSTest runs the AWS EKS test client
+func RunEKSTest() error {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf("Warning: .env file not found, using environment variables")
+	}
 
-	client, err := NewEKSClient(clusterName, awsConfig)
+	client, err := newEKSClientFromEnv(false)
 	if err != nil {
-		return fmt.Errorf("failed to create EKS client: %w", err)
+		return err
 	}
 
-	fmt.Println("✓ Successfully connected to EKS cluster!")
+	Infof("✓ Successfully connected to EKS cluster!")
 
 	accountID, err := client.GetAccountID(context.Background())
 	if err != nil {
@@ -344,8 +1162,10 @@ func RunEKSTest() error {
 		fmt.Printf("Connected to AWS Account: %s\n", accountID)
 	}
 
-	if err := client.GetClusterInfo(); err != nil {
+	if info, err := client.GetClusterInfo(); err != nil {
 		log.Printf("Failed to get cluster info: %v", err)
+	} else {
+		PrintClusterInfo(info)
 	}
 
 	if err := client.ListPods(); err != nil {
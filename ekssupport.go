@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	ekstypes "github.com/aws/aws-sdk-go-v2/service/eks/types"
+)
+
+// DefaultEKSSupportWarningDays is how many days before standard support ends a warning is raised
+const DefaultEKSSupportWarningDays = 90
+
+// eksSupportDates are the end of standard and extended support for an EKS Kubernetes version
+type eksSupportDates struct {
+	standardEnds time.Time
+	extendedEnds time.Time
+}
+
+// eksSupportCalendar is a built-in copy of the published EKS Kubernetes version calendar, used
+// when DescribeClusterVersions is unavailable (older partitions or missing permissions)
+var eksSupportCalendar = map[string]eksSupportDates{
+	"1.23": {date(2023, 10, 11), date(2024, 10, 11)},
+	"1.24": {date(2024, 1, 31), date(2025, 1, 31)},
+	"1.25": {date(2024, 5, 1), date(2025, 5, 1)},
+	"1.26": {date(2024, 6, 11), date(2025, 6, 11)},
+	"1.27": {date(2024, 7, 24), date(2025, 7, 24)},
+	"1.28": {date(2024, 11, 26), date(2025, 11, 26)},
+	"1.29": {date(2025, 3, 23), date(2026, 3, 23)},
+	"1.30": {date(2025, 7, 23), date(2026, 7, 23)},
+	"1.31": {date(2025, 11, 26), date(2026, 11, 26)},
+	"1.32": {date(2026, 3, 23), date(2027, 3, 23)},
+	"1.33": {date(2026, 7, 29), date(2027, 7, 29)},
+}
+
+// date returns midnight UTC of the given day
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// EKSSupportStatus is where a cluster's Kubernetes version stands in the EKS support calendar
+type EKSSupportStatus struct {
+	Version             string
+	SupportType         string // STANDARD (auto-upgraded at end of standard support) or EXTENDED
+	StandardSupportEnds time.Time
+	ExtendedSupportEnds time.Time
+	Source              string // "api" or "built-in calendar"
+}
+
+// Warnings returns human readable warnings when the version is within warnDays of the end of
+// standard support, already in (paid) extended support, or out of support altogether
+func (s EKSSupportStatus) Warnings(now time.Time, warnDays int) []string {
+	if s.StandardSupportEnds.IsZero() {
+		return nil
+	}
+
+	window := time.Duration(warnDays) * 24 * time.Hour
+	switch {
+	case !s.ExtendedSupportEnds.IsZero() && !now.Before(s.ExtendedSupportEnds):
+		return []string{fmt.Sprintf("Kubernetes %s reached end of extended support on %s and is no longer supported",
+			s.Version, s.ExtendedSupportEnds.Format("2006-01-02"))}
+	case !now.Before(s.StandardSupportEnds):
+		warning := fmt.Sprintf("Kubernetes %s is in extended support (standard support ended %s), which is billed at a higher rate",
+			s.Version, s.StandardSupportEnds.Format("2006-01-02"))
+		if !s.ExtendedSupportEnds.IsZero() && s.ExtendedSupportEnds.Sub(now) <= window {
+			warning += fmt.Sprintf("; extended support ends in %d days", daysUntil(now, s.ExtendedSupportEnds))
+		}
+		return []string{warning}
+	case s.StandardSupportEnds.Sub(now) <= window:
+		next := "the cluster will enter extended support, which is billed at a higher rate"
+		if s.SupportType == string(ekstypes.SupportTypeStandard) {
+			next = "the cluster will be upgraded automatically"
+		}
+		return []string{fmt.Sprintf("standard support for Kubernetes %s ends in %d days (%s); %s",
+			s.Version, daysUntil(now, s.StandardSupportEnds), s.StandardSupportEnds.Format("2006-01-02"), next)}
+	}
+
+	return nil
+}
+
+// daysUntil returns the whole days from now until t
+func daysUntil(now, t time.Time) int {
+	return int(t.Sub(now).Hours() / 24)
+}
+
+// GetSupportStatus looks up the cluster version's support dates, preferring the EKS API and
+// falling back to the built-in calendar
+func (c *EKSClient) GetSupportStatus(ctx context.Context, version string, supportType string) EKSSupportStatus {
+	status := EKSSupportStatus{Version: version, SupportType: supportType}
+
+	out, err := c.eksClient.DescribeClusterVersions(ctx, &eks.DescribeClusterVersionsInput{
+		ClusterVersions: []string{version},
+	})
+	if err == nil {
+		for _, info := range out.ClusterVersions {
+			if info.EndOfStandardSupportDate == nil {
+				continue
+			}
+			status.StandardSupportEnds = *info.EndOfStandardSupportDate
+			if info.EndOfExtendedSupportDate != nil {
+				status.ExtendedSupportEnds = *info.EndOfExtendedSupportDate
+			}
+			status.Source = "api"
+			return status
+		}
+	}
+
+	if dates, ok := eksSupportCalendar[version]; ok {
+		status.StandardSupportEnds = dates.standardEnds
+		status.ExtendedSupportEnds = dates.extendedEnds
+		status.Source = "built-in calendar"
+	}
+	return status
+}
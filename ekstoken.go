@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+const (
+	// DefaultEKSTokenTTL is how long a presigned EKS token is reused before a new one is minted
+	DefaultEKSTokenTTL = 10 * time.Minute
+	// eksTokenExpirySkew keeps cached tokens from being handed out right before they expire
+	eksTokenExpirySkew = 1 * time.Minute
+)
+
+// cachedEKSToken is a token together with the time it stops being reused
+type cachedEKSToken struct {
+	token     token.Token
+	reuseTill time.Time
+}
+
+// EKSTokenCache reuses presigned EKS authentication tokens across client constructions,
+// keyed by cluster and role, so connecting to many EKS clusters does not presign a fresh
+// STS request each time
+type EKSTokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]cachedEKSToken
+}
+
+// defaultEKSTokenCache is shared by all EKS clients in the process
+var defaultEKSTokenCache = NewEKSTokenCache()
+
+// NewEKSTokenCache creates an empty token cache
+func NewEKSTokenCache() *EKSTokenCache {
+	return &EKSTokenCache{tokens: map[string]cachedEKSToken{}}
+}
+
+// eksTokenCacheKey identifies a token by the cluster it is valid for and the role it was minted as
+func eksTokenCacheKey(accountID, region, clusterName, roleARN string) string {
+	return accountID + "/" + region + "/" + clusterName + "|" + roleARN
+}
+
+// Get returns a cached token for key if it is still within ttl and not close to expiring,
+// otherwise it mints a new one and caches it
+func (c *EKSTokenCache) Get(key string, ttl time.Duration, mint func() (token.Token, error)) (token.Token, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	cached, ok := c.tokens[key]
+	c.mu.Unlock()
+	if ok && now.Before(cached.reuseTill) {
+		return cached.token, nil
+	}
+
+	tok, err := mint()
+	if err != nil {
+		return token.Token{}, err
+	}
+
+	reuseTill := now.Add(ttl)
+	if latest := tok.Expiration.Add(-eksTokenExpirySkew); latest.Before(reuseTill) {
+		reuseTill = latest
+	}
+
+	c.mu.Lock()
+	c.tokens[key] = cachedEKSToken{token: tok, reuseTill: reuseTill}
+	c.mu.Unlock()
+
+	return tok, nil
+}
+
+// Invalidate drops the cached token for key, e.g. after the API server rejected it
+func (c *EKSTokenCache) Invalidate(key string) {
+	c.mu.Lock()
+	delete(c.tokens, key)
+	c.mu.Unlock()
+}
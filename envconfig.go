@@ -0,0 +1,545 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvVar is an environment variable recognized by this tool
+type EnvVar struct {
+	Name        string
+	Provider    Provider // empty for settings shared by all providers
+	Description string
+	Default     string
+	Required    bool // required to connect to a cluster of Provider from the environment
+	Secret      bool // value is never printed
+}
+
+// recognizedEnvVars lists every environment variable the tool reads
+var recognizedEnvVars = []EnvVar{
+	{Name: "K8S_LIST_PAGE_SIZE", Description: "page size for Kubernetes list calls", Default: "500"},
+	{Name: "KUBECONFIG_NAME_TEMPLATE", Description: "kubeconfig context name template"},
+	{Name: "KUBECONFIG_ALIASES", Description: "YAML file of kubeconfig context aliases"},
+	{Name: "FLEET_CONFIG", Description: "fleet config file", Default: "fleet.yaml"},
+	{Name: "FLEET_REPORT_DEST", Description: "comma-separated report sinks fleet reports are delivered to"},
+	{Name: "FLEET_NOTIFY", Description: "comma-separated notifiers of check result changes in fleet daemon mode"},
+	{Name: "PAGERDUTY_ROUTING_KEY", Description: "routing key of the PagerDuty Events API v2 integration the pagerduty notifier uses", Secret: true},
+	{Name: "OPSGENIE_API_KEY", Description: "API key of the Opsgenie API integration the opsgenie notifier uses", Secret: true},
+	{Name: "WATCH_NAMESPACE", Description: "namespace the operator watches ClusterConnections in (default all)"},
+	{Name: "CREDENTIALS_DIR", Description: "directory of a mounted Secret whose files, named like the credential environment variables, are read and reloaded on rotation", Default: DefaultCredentialsDir},
+	{Name: "FLEET_HISTORY", Description: "postgres:// URL or glob of JSON reports slo reads stored fleet runs from"},
+	{Name: "AUTH_TIMEOUT", Description: "credential acquisition timeout", Default: DefaultPhaseTimeouts().Auth.String()},
+	{Name: "CLOUD_API_TIMEOUT", Description: "per-call timeout for cloud control plane APIs", Default: DefaultPhaseTimeouts().CloudAPI.String()},
+	{Name: "K8S_TIMEOUT", Description: "per-request timeout for the Kubernetes API", Default: DefaultPhaseTimeouts().Kubernetes.String()},
+	{Name: "K8S_USER_AGENT", Description: "User-Agent of Kubernetes API requests", Default: "connect-managed-k8s/<version>"},
+	{Name: "K8S_HEADERS", Description: "comma-separated Name=Value headers added to Kubernetes API requests", Secret: true},
+	{Name: "K8S_AS", Description: "user Kubernetes requests impersonate, like --as"},
+	{Name: "K8S_AS_GROUPS", Description: "comma-separated groups Kubernetes requests impersonate, like --as-group"},
+	{Name: "K8S_AS_UID", Description: "UID Kubernetes requests impersonate, like --as-uid"},
+	{Name: "WAIT_FOR_READY", Description: "how long to wait for a cluster being created or updated, like --wait-for-ready", Default: "fail immediately"},
+	{Name: "READ_ONLY", Description: "block mutating Kubernetes and cloud operations when true, like --read-only", Default: "false"},
+	{Name: "AUDIT_LOG", Description: "file or s3://, gs://, Azure Blob URL recording cloud calls and Kubernetes mutations, like --audit-log"},
+	{Name: "ASSUME_YES", Description: "run destructive operations without asking for confirmation when true, like --yes", Default: "false"},
+	{Name: "PRODUCTION_TAGS", Description: "comma-separated key=value cluster tags marking production clusters, whose name must be retyped to confirm", Default: DefaultProductionTags},
+
+	{Name: "AKS_CLUSTER_NAME", Provider: ProviderAKS, Description: "AKS cluster name", Default: "my-aks-cluster"},
+	{Name: "AZURE_RESOURCE_GROUP", Provider: ProviderAKS, Description: "resource group of the AKS cluster", Default: "found by searching the subscription"},
+	{Name: "AZURE_SUBSCRIPTION_ID", Provider: ProviderAKS, Description: "Azure subscription ID", Required: true},
+	{Name: "AZURE_CLIENT_ID", Provider: ProviderAKS, Description: "service principal client ID"},
+	{Name: "AZURE_CLIENT_SECRET", Provider: ProviderAKS, Description: "service principal client secret", Secret: true},
+	{Name: "AZURE_TENANT_ID", Provider: ProviderAKS, Description: "service principal tenant ID"},
+	{Name: "AZURE_FEDERATED_TOKEN_FILE", Provider: ProviderAKS, Description: "projected service account token for Azure workload identity, with AZURE_CLIENT_ID and AZURE_TENANT_ID"},
+	{Name: "AZURE_USE_MSI", Provider: ProviderAKS, Description: "use managed identity when set to true"},
+	{Name: "AZURE_CLOUD", Provider: ProviderAKS, Description: "Azure cloud (AzurePublic, AzureUSGovernment or AzureChina)", Default: string(AzurePublicCloud)},
+	{Name: "AKS_AAD_SERVER_APP_ID", Provider: ProviderAKS, Description: "AKS AAD server application override"},
+	{Name: "AZURE_ARM_RATE_LIMIT", Provider: ProviderAKS, Description: "ARM client-side rate limit", Default: "5:10"},
+
+	{Name: "EKS_CLUSTER_NAME", Provider: ProviderEKS, Description: "EKS cluster name", Required: true},
+	{Name: "AWS_REGION", Provider: ProviderEKS, Description: "AWS region", Default: "found by searching EKS_SEARCH_REGIONS"},
+	{Name: "EKS_SEARCH_REGIONS", Provider: ProviderEKS, Description: "comma-separated regions searched for the cluster without AWS_REGION", Default: "commercial regions"},
+	{Name: "AWS_PROFILE", Provider: ProviderEKS, Description: "shared config profile"},
+	{Name: "AWS_ACCESS_KEY_ID", Provider: ProviderEKS, Description: "static access key ID"},
+	{Name: "AWS_SECRET_ACCESS_KEY", Provider: ProviderEKS, Description: "static secret access key", Secret: true},
+	{Name: "AWS_SESSION_TOKEN", Provider: ProviderEKS, Description: "session token for temporary static credentials", Secret: true},
+	{Name: "EKS_AUTH_ROLE_ARN", Provider: ProviderEKS, Description: "role the Kubernetes token is minted as"},
+	{Name: "EKS_STS_REGION", Provider: ProviderEKS, Description: "region whose STS endpoint tokens are presigned for", Default: "AWS_REGION"},
+	{Name: "EKS_STS_ENDPOINT", Provider: ProviderEKS, Description: "STS endpoint URL tokens are presigned for"},
+	{Name: "EKS_TOKEN_TTL", Provider: ProviderEKS, Description: "how long EKS tokens are reused", Default: DefaultEKSTokenTTL.String()},
+	{Name: "EKS_ENDPOINT_OVERRIDE", Provider: ProviderEKS, Description: "API server endpoint override"},
+	{Name: "EKS_TLS_SERVER_NAME", Provider: ProviderEKS, Description: "TLS server name for the endpoint override"},
+	{Name: "EKS_SUPPORT_WARN_DAYS", Provider: ProviderEKS, Description: "days before end of standard support to warn", Default: strconv.Itoa(DefaultEKSSupportWarningDays)},
+	{Name: "EKS_API_RATE_LIMIT", Provider: ProviderEKS, Description: "EKS API client-side rate limit", Default: "10:20"},
+
+	{Name: "GKE_CLUSTER_NAME", Provider: ProviderGKE, Description: "GKE cluster name", Required: true},
+	{Name: "GOOGLE_CLOUD_PROJECT", Provider: ProviderGKE, Description: "GCP project ID", Required: true},
+	{Name: "GKE_ZONE", Provider: ProviderGKE, Description: "GKE zone or region", Default: "found by searching the project"},
+	{Name: "GOOGLE_APPLICATION_CREDENTIALS", Provider: ProviderGKE, Description: "service account JSON file"},
+	{Name: "GCP_CREDENTIALS_JSON", Provider: ProviderGKE, Description: "base64 encoded service account JSON", Secret: true},
+	{Name: "GKE_K8S_SCOPES", Provider: ProviderGKE, Description: "comma-separated OAuth scopes of the Kubernetes API token", Default: "cloud-platform"},
+	{Name: "GKE_K8S_AUDIENCE", Provider: ProviderGKE, Description: "audience of ID tokens used for the Kubernetes API instead of access tokens"},
+	{Name: "GKE_ENDPOINT", Provider: ProviderGKE, Description: "control plane endpoint (auto, ip or dns)", Default: string(GKEEndpointAuto)},
+	{Name: "GCP_CONTAINER_RATE_LIMIT", Provider: ProviderGKE, Description: "GKE API client-side rate limit", Default: "10:20"},
+}
+
+// recognizedEnvPrefixes are the prefixes scanned for misspelled or unknown variables
+var recognizedEnvPrefixes = []string{"AKS_", "GKE_", "EKS_", "AZURE_", "AWS_", "GOOGLE_", "GCP_", "K8S_", "KUBECONFIG_", "FLEET_"}
+
+// ConfigSeverity is how serious a configuration finding is
+type ConfigSeverity string
+
+const (
+	ConfigError   ConfigSeverity = "error"
+	ConfigWarning ConfigSeverity = "warning"
+	ConfigInfo    ConfigSeverity = "info"
+)
+
+// ConfigFinding is a problem or note about the environment configuration
+type ConfigFinding struct {
+	Severity ConfigSeverity `json:"severity"`
+	Provider Provider       `json:"provider,omitempty"`
+	Message  string         `json:"message"`
+}
+
+// EnvVarStatus is the state of a recognized variable in the environment
+type EnvVarStatus struct {
+	Name     string   `json:"name"`
+	Provider Provider `json:"provider,omitempty"`
+	Set      bool     `json:"set"`
+	Value    string   `json:"value,omitempty"` // redacted for secrets
+	Default  string   `json:"default,omitempty"`
+}
+
+// ConfigReport is the result of validating the environment configuration
+type ConfigReport struct {
+	Variables []EnvVarStatus        `json:"variables"`
+	Effective map[Provider][]string `json:"effective"`
+	Findings  []ConfigFinding       `json:"findings,omitempty"`
+}
+
+// HasErrors reports whether any finding is an error
+func (r *ConfigReport) HasErrors() bool {
+	for _, finding := range r.Findings {
+		if finding.Severity == ConfigError {
+			return true
+		}
+	}
+	return false
+}
+
+// add records a finding
+func (r *ConfigReport) add(severity ConfigSeverity, provider Provider, format string, args ...interface{}) {
+	r.Findings = append(r.Findings, ConfigFinding{Severity: severity, Provider: provider, Message: fmt.Sprintf(format, args...)})
+}
+
+// ValidateEnvConfig checks the recognized environment variables for missing, malformed and
+// conflicting values and resolves the configuration each provider would use. The providers
+// to check for required variables can be narrowed with providers; all are checked by default.
+func ValidateEnvConfig(providers ...Provider) *ConfigReport {
+	if len(providers) == 0 {
+		providers = []Provider{ProviderAKS, ProviderEKS, ProviderGKE}
+	}
+	checked := map[Provider]bool{"": true}
+	for _, provider := range providers {
+		checked[provider] = true
+	}
+
+	report := &ConfigReport{Effective: map[Provider][]string{}}
+	for _, v := range recognizedEnvVars {
+		value, set := os.LookupEnv(v.Name)
+		set = set && value != ""
+		status := EnvVarStatus{Name: v.Name, Provider: v.Provider, Set: set, Default: v.Default}
+		if set {
+			status.Value = value
+			if v.Secret {
+				status.Value = "(redacted)"
+			}
+		}
+		if checked[v.Provider] {
+			report.Variables = append(report.Variables, status)
+		}
+		if v.Required && !set && checked[v.Provider] {
+			report.add(ConfigError, v.Provider, "%s is required (%s)", v.Name, v.Description)
+		}
+	}
+
+	validateSharedEnv(report)
+	if checked[ProviderAKS] {
+		validateAKSEnv(report)
+	}
+	if checked[ProviderEKS] {
+		validateEKSEnv(report)
+	}
+	if checked[ProviderGKE] {
+		validateGKEEnv(report)
+	}
+	findUnrecognizedEnv(report)
+
+	return report
+}
+
+// validateSharedEnv checks the settings shared by all providers
+func validateSharedEnv(report *ConfigReport) {
+	if size := os.Getenv("K8S_LIST_PAGE_SIZE"); size != "" {
+		if n, err := strconv.ParseInt(size, 10, 64); err != nil || n <= 0 {
+			report.add(ConfigError, "", "K8S_LIST_PAGE_SIZE %q must be a positive integer", size)
+		}
+	}
+	if _, err := PhaseTimeoutsFromEnv(); err != nil {
+		report.add(ConfigError, "", "%v", err)
+	}
+	if _, err := ParseRequestHeaders(os.Getenv("K8S_HEADERS")); err != nil {
+		report.add(ConfigError, "", "K8S_HEADERS: %v", err)
+	}
+	if os.Getenv("K8S_AS") == "" && (os.Getenv("K8S_AS_GROUPS") != "" || os.Getenv("K8S_AS_UID") != "") {
+		report.add(ConfigError, "", "K8S_AS_GROUPS and K8S_AS_UID also require K8S_AS")
+	}
+	if value := os.Getenv("READ_ONLY"); value != "" {
+		if _, err := strconv.ParseBool(value); err != nil {
+			report.add(ConfigError, "", "READ_ONLY %q must be true or false", value)
+		}
+	}
+	if value := os.Getenv("ASSUME_YES"); value != "" {
+		if _, err := strconv.ParseBool(value); err != nil {
+			report.add(ConfigError, "", "ASSUME_YES %q must be true or false", value)
+		}
+	}
+	if _, err := productionTags(); err != nil {
+		report.add(ConfigError, "", "%v", err)
+	}
+	if dir := os.Getenv("CREDENTIALS_DIR"); dir != "" {
+		if info, err := os.Stat(dir); err != nil {
+			report.add(ConfigError, "", "CREDENTIALS_DIR: %v", err)
+		} else if !info.IsDir() {
+			report.add(ConfigError, "", "CREDENTIALS_DIR %q is not a directory", dir)
+		}
+	}
+	if dest := os.Getenv("AUDIT_LOG"); strings.Contains(dest, "://") {
+		if _, err := ParseObjectStoreLocation(dest); err != nil {
+			report.add(ConfigError, "", "AUDIT_LOG: %v", err)
+		}
+	}
+	if wait := os.Getenv("WAIT_FOR_READY"); wait != "" {
+		if _, err := parseWaitForReady(wait); err != nil {
+			report.add(ConfigError, "", "WAIT_FOR_READY: %v", err)
+		}
+	}
+	if template := os.Getenv("KUBECONFIG_NAME_TEMPLATE"); template != "" {
+		if err := (KubeconfigNaming{Template: template}).Validate(); err != nil {
+			report.add(ConfigError, "", "KUBECONFIG_NAME_TEMPLATE: %v", err)
+		}
+	}
+	if path := os.Getenv("KUBECONFIG_ALIASES"); path != "" {
+		if _, err := LoadKubeconfigAliases(path); err != nil {
+			report.add(ConfigError, "", "KUBECONFIG_ALIASES: %v", err)
+		}
+	}
+	if path := os.Getenv("FLEET_CONFIG"); path != "" {
+		if _, err := LoadFleetConfig(path); err != nil {
+			report.add(ConfigError, "", "FLEET_CONFIG: %v", err)
+		}
+	}
+	for _, spec := range strings.Split(os.Getenv("FLEET_REPORT_DEST"), ",") {
+		if spec = strings.TrimSpace(spec); spec == "" {
+			continue
+		}
+		if _, err := reportSinkKind(spec); err != nil {
+			report.add(ConfigError, "", "FLEET_REPORT_DEST: %v", err)
+		}
+	}
+	for _, spec := range strings.Split(os.Getenv("FLEET_NOTIFY"), ",") {
+		if spec = strings.TrimSpace(spec); spec == "" {
+			continue
+		}
+		kind, err := notifierKind(spec)
+		switch {
+		case err != nil:
+			report.add(ConfigError, "", "FLEET_NOTIFY: %v", err)
+		case kind == "pagerduty" && credentialValue("PAGERDUTY_ROUTING_KEY") == "":
+			report.add(ConfigError, "", "FLEET_NOTIFY: pagerduty needs PAGERDUTY_ROUTING_KEY")
+		case kind == "opsgenie" && credentialValue("OPSGENIE_API_KEY") == "":
+			report.add(ConfigError, "", "FLEET_NOTIFY: opsgenie needs OPSGENIE_API_KEY")
+		}
+	}
+}
+
+// validateAKSEnv checks the Azure settings and resolves the credential that will be used
+func validateAKSEnv(report *ConfigReport) {
+	validateRateLimitEnv(report, ProviderAKS, "AZURE_ARM_RATE_LIMIT")
+	if _, err := AzureCloudFromEnv(); err != nil {
+		report.add(ConfigError, ProviderAKS, "%v", err)
+	}
+
+	clientID, secret, tenant := os.Getenv("AZURE_CLIENT_ID"), os.Getenv("AZURE_CLIENT_SECRET"), os.Getenv("AZURE_TENANT_ID")
+	servicePrincipal := clientID != "" && secret != "" && tenant != ""
+	msi := os.Getenv("AZURE_USE_MSI")
+	if !servicePrincipal && (clientID != "" || secret != "" || tenant != "") {
+		fallback := "Azure CLI credentials"
+		if msi == "true" {
+			fallback = "managed identity"
+		}
+		report.add(ConfigWarning, ProviderAKS, "service principal is incomplete (AZURE_CLIENT_ID, AZURE_CLIENT_SECRET and AZURE_TENANT_ID are all needed); falling back to %s", fallback)
+	}
+	if msi != "" && msi != "true" && msi != "false" {
+		report.add(ConfigWarning, ProviderAKS, "AZURE_USE_MSI=%q is ignored; only \"true\" enables managed identity", msi)
+	}
+	if servicePrincipal && msi == "true" {
+		report.add(ConfigWarning, ProviderAKS, "both a service principal and AZURE_USE_MSI=true are set; the service principal is used")
+	}
+
+	credential := "Azure CLI"
+	switch {
+	case servicePrincipal:
+		credential = "service principal " + clientID
+	case msi == "true":
+		credential = "managed identity"
+	}
+
+	clusterName := envOrDefault("AKS_CLUSTER_NAME", "my-aks-cluster")
+	if os.Getenv("AKS_CLUSTER_NAME") == "" {
+		report.add(ConfigWarning, ProviderAKS, "AKS_CLUSTER_NAME is not set; the placeholder %q is used", clusterName)
+	}
+	report.Effective[ProviderAKS] = []string{
+		"cluster: " + clusterName,
+		"resource group: " + envOrDefault("AZURE_RESOURCE_GROUP", "searched"),
+		"subscription: " + os.Getenv("AZURE_SUBSCRIPTION_ID"),
+		"credential: " + credential,
+	}
+}
+
+// validateEKSEnv checks the AWS settings and resolves the credential source that will be used
+func validateEKSEnv(report *ConfigReport) {
+	validateRateLimitEnv(report, ProviderEKS, "EKS_API_RATE_LIMIT")
+
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "searched"
+		if _, err := eksSearchRegionsFromEnv(); err != nil {
+			report.add(ConfigError, ProviderEKS, "%v", err)
+		}
+	} else if normalized, err := NormalizeLocation(ProviderEKS, region, LocationRegion); err != nil {
+		report.add(ConfigError, ProviderEKS, "AWS_REGION: %v", err)
+	} else {
+		region = normalized
+	}
+
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	profile := os.Getenv("AWS_PROFILE")
+	staticKeys := accessKey != "" && secretKey != ""
+	if (accessKey != "") != (secretKey != "") {
+		report.add(ConfigWarning, ProviderEKS, "only one of AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY is set; static credentials are not used")
+	}
+	if staticKeys && profile != "" {
+		report.add(ConfigWarning, ProviderEKS, "both static keys and AWS_PROFILE=%s are set; the static keys are used and the profile is ignored", profile)
+	}
+	if os.Getenv("AWS_SESSION_TOKEN") != "" && !staticKeys {
+		report.add(ConfigWarning, ProviderEKS, "AWS_SESSION_TOKEN is set without static keys and is ignored")
+	}
+
+	credential := "default credential chain"
+	switch {
+	case staticKeys:
+		credential = "static keys " + accessKey
+	case profile != "":
+		credential = "profile " + profile
+	}
+
+	if ttl := os.Getenv("EKS_TOKEN_TTL"); ttl != "" {
+		if _, err := time.ParseDuration(ttl); err != nil {
+			report.add(ConfigError, ProviderEKS, "EKS_TOKEN_TTL %q is not a duration", ttl)
+		}
+	}
+	if days := os.Getenv("EKS_SUPPORT_WARN_DAYS"); days != "" {
+		if n, err := strconv.Atoi(days); err != nil || n <= 0 {
+			report.add(ConfigError, ProviderEKS, "EKS_SUPPORT_WARN_DAYS %q must be a positive integer", days)
+		}
+	}
+	if region := os.Getenv("EKS_STS_REGION"); region != "" {
+		if _, err := NormalizeLocation(ProviderEKS, region, LocationRegion); err != nil {
+			report.add(ConfigError, ProviderEKS, "EKS_STS_REGION: %v", err)
+		}
+	}
+	if endpoint := os.Getenv("EKS_STS_ENDPOINT"); endpoint != "" && !strings.HasPrefix(endpoint, "https://") {
+		report.add(ConfigError, ProviderEKS, "EKS_STS_ENDPOINT %q must be an https:// URL", endpoint)
+	}
+	if role := os.Getenv("EKS_AUTH_ROLE_ARN"); role != "" && !strings.HasPrefix(role, "arn:") {
+		report.add(ConfigError, ProviderEKS, "EKS_AUTH_ROLE_ARN %q is not an IAM role ARN", role)
+	}
+	if os.Getenv("EKS_TLS_SERVER_NAME") != "" && os.Getenv("EKS_ENDPOINT_OVERRIDE") == "" {
+		report.add(ConfigInfo, ProviderEKS, "EKS_TLS_SERVER_NAME overrides the server name of the EKS endpoint itself")
+	}
+
+	effective := []string{
+		"cluster: " + os.Getenv("EKS_CLUSTER_NAME"),
+		"region: " + region,
+		"credential: " + credential,
+	}
+	if endpoint := os.Getenv("EKS_ENDPOINT_OVERRIDE"); endpoint != "" {
+		effective = append(effective, "endpoint: "+endpoint)
+	}
+	report.Effective[ProviderEKS] = effective
+}
+
+// validateGKEEnv checks the GCP settings and resolves the credential source that will be used
+func validateGKEEnv(report *ConfigReport) {
+	validateRateLimitEnv(report, ProviderGKE, "GCP_CONTAINER_RATE_LIMIT")
+	if os.Getenv("GKE_K8S_AUDIENCE") != "" && os.Getenv("GKE_K8S_SCOPES") != "" {
+		report.add(ConfigWarning, ProviderGKE, "GKE_K8S_SCOPES is ignored because GKE_K8S_AUDIENCE requests ID tokens")
+	}
+
+	zone := os.Getenv("GKE_ZONE")
+	if zone == "" {
+		zone = "searched"
+	} else if normalized, err := NormalizeLocation(ProviderGKE, zone, LocationAny); err != nil {
+		report.add(ConfigError, ProviderGKE, "GKE_ZONE: %v", err)
+	} else {
+		zone = normalized
+	}
+
+	switch endpoint := GKEEndpointPreference(envOrDefault("GKE_ENDPOINT", string(GKEEndpointAuto))); endpoint {
+	case GKEEndpointAuto, GKEEndpointIP, GKEEndpointDNS:
+	default:
+		report.add(ConfigError, ProviderGKE, "GKE_ENDPOINT %q must be auto, ip or dns", endpoint)
+	}
+
+	credentialsPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	credentialsJSON := os.Getenv("GCP_CREDENTIALS_JSON")
+	if credentialsJSON != "" {
+		decoded, err := base64.StdEncoding.DecodeString(credentialsJSON)
+		if err != nil {
+			report.add(ConfigError, ProviderGKE, "GCP_CREDENTIALS_JSON is not valid base64")
+		} else if !json.Valid(decoded) {
+			report.add(ConfigError, ProviderGKE, "GCP_CREDENTIALS_JSON does not decode to JSON")
+		}
+		if credentialsPath != "" {
+			report.add(ConfigWarning, ProviderGKE, "both GCP_CREDENTIALS_JSON and GOOGLE_APPLICATION_CREDENTIALS are set; GCP_CREDENTIALS_JSON is used")
+		}
+	}
+	if credentialsPath != "" {
+		if _, err := os.Stat(credentialsPath); err != nil {
+			report.add(ConfigError, ProviderGKE, "GOOGLE_APPLICATION_CREDENTIALS: %v", err)
+		}
+	}
+
+	credential := "application default credentials"
+	switch {
+	case credentialsJSON != "":
+		credential = "service account JSON from GCP_CREDENTIALS_JSON"
+	case credentialsPath != "":
+		credential = "service account file " + credentialsPath
+	}
+
+	report.Effective[ProviderGKE] = []string{
+		"cluster: " + os.Getenv("GKE_CLUSTER_NAME"),
+		"project: " + os.Getenv("GOOGLE_CLOUD_PROJECT"),
+		"location: " + zone,
+		"credential: " + credential,
+	}
+}
+
+// validateRateLimitEnv checks a rate limit variable
+func validateRateLimitEnv(report *ConfigReport, provider Provider, name string) {
+	if value := os.Getenv(name); value != "" {
+		if _, err := parseRateLimit(value); err != nil {
+			report.add(ConfigError, provider, "%s: %v", name, err)
+		}
+	}
+}
+
+// findUnrecognizedEnv reports variables with a recognized prefix that this tool does not read,
+// pointing out likely misspellings of recognized names
+func findUnrecognizedEnv(report *ConfigReport) {
+	known := map[string]bool{}
+	for _, v := range recognizedEnvVars {
+		known[v.Name] = true
+	}
+
+	var names []string
+	for _, entry := range os.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		if known[name] {
+			continue
+		}
+		for _, prefix := range recognizedEnvPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		best, bestDistance := "", 3
+		for _, v := range recognizedEnvVars {
+			if d := editDistance(name, v.Name); d < bestDistance {
+				best, bestDistance = v.Name, d
+			}
+		}
+		if best != "" {
+			report.add(ConfigWarning, "", "%s is not recognized (did you mean %s?)", name, best)
+		} else {
+			report.add(ConfigInfo, "", "%s is not read by this tool (it may still be used by a cloud SDK)", name)
+		}
+	}
+}
+
+// envOrDefault returns the value of the environment variable or def when it is unset
+func envOrDefault(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// PrintConfigReport renders the configuration report for humans
+func PrintConfigReport(report *ConfigReport) {
+	fmt.Println("Environment variables:")
+	for _, v := range report.Variables {
+		switch {
+		case v.Set:
+			fmt.Printf("  ✓ %-32s %s\n", v.Name, v.Value)
+		case v.Default != "":
+			fmt.Printf("  - %-32s (unset, default %s)\n", v.Name, v.Default)
+		default:
+			fmt.Printf("  - %-32s (unset)\n", v.Name)
+		}
+	}
+
+	for _, provider := range []Provider{ProviderAKS, ProviderEKS, ProviderGKE} {
+		lines, ok := report.Effective[provider]
+		if !ok {
+			continue
+		}
+		fmt.Printf("\nEffective %s configuration:\n", strings.ToUpper(string(provider)))
+		for _, line := range lines {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+
+	if len(report.Findings) == 0 {
+		fmt.Println("\n✓ No problems found")
+		return
+	}
+
+	fmt.Println("\nFindings:")
+	for _, finding := range report.Findings {
+		symbol := "ℹ"
+		switch finding.Severity {
+		case ConfigError:
+			symbol = "✗"
+		case ConfigWarning:
+			symbol = "⚠"
+		}
+		scope := ""
+		if finding.Provider != "" {
+			scope = "[" + strings.ToUpper(string(finding.Provider)) + "] "
+		}
+		fmt.Printf("  %s %s%s\n", symbol, scope, finding.Message)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Metrics the API server reports about the objects it stores in etcd. apiserver_storage_objects
+// replaced etcd_object_counts in Kubernetes 1.21; apiserver_storage_size_bytes reports the etcd
+// database size since 1.28.
+const (
+	storageObjectsMetric    = "apiserver_storage_objects"
+	legacyObjectCountMetric = "etcd_object_counts"
+	storageSizeMetric       = "apiserver_storage_size_bytes"
+)
+
+// etcdQuotaBytes is the etcd backend quota of managed control planes (and etcd's recommended
+// maximum); writes fail once the database reaches it
+const etcdQuotaBytes = 8 << 30
+
+// etcdSizeWarning is the fraction of etcdQuotaBytes at which the etcd-objects check fails
+const etcdSizeWarning = 0.8
+
+// etcdTopResources is how many resource types the etcd-objects check lists
+const etcdTopResources = 15
+
+// ResourceCount is the number of objects of one resource type stored in etcd
+type ResourceCount struct {
+	Resource string `json:"resource"`
+	Count    int64  `json:"count"`
+}
+
+// EtcdUsage is what the API server reports about the objects it stores in etcd
+type EtcdUsage struct {
+	Resources []ResourceCount `json:"resources"` // largest count first
+	Total     int64           `json:"total"`
+	// SizeBytes is the etcd database size, when the API server reports it
+	SizeBytes int64 `json:"sizeBytes,omitempty"`
+}
+
+// MeasureEtcdUsage reads object counts by resource type, and the database size where reported,
+// from the API server's /metrics, which needs permission to read the non-resource URL
+func MeasureEtcdUsage(ctx context.Context, client ClusterClient) (*EtcdUsage, error) {
+	metrics, err := client.RawRequest(ctx, "GET", "/metrics")
+	if err != nil {
+		return nil, err
+	}
+	return parseEtcdUsage(string(metrics))
+}
+
+// parseEtcdUsage extracts object counts and database size from API server metrics
+func parseEtcdUsage(metrics string) (*EtcdUsage, error) {
+	samples := parseMetricSamples(metrics, storageObjectsMetric)
+	if len(samples) == 0 {
+		samples = parseMetricSamples(metrics, legacyObjectCountMetric)
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("API server reports neither %s nor %s", storageObjectsMetric, legacyObjectCountMetric)
+	}
+
+	usage := &EtcdUsage{}
+	for _, sample := range samples {
+		// -1 means the count is not known yet
+		if sample.Value < 0 || sample.Labels["resource"] == "" {
+			continue
+		}
+		count := int64(sample.Value)
+		usage.Resources = append(usage.Resources, ResourceCount{Resource: sample.Labels["resource"], Count: count})
+		usage.Total += count
+	}
+	sort.Slice(usage.Resources, func(i, j int) bool {
+		if usage.Resources[i].Count != usage.Resources[j].Count {
+			return usage.Resources[i].Count > usage.Resources[j].Count
+		}
+		return usage.Resources[i].Resource < usage.Resources[j].Resource
+	})
+
+	// One sample per etcd cluster the API server talks to; the largest is the one at risk
+	for _, sample := range parseMetricSamples(metrics, storageSizeMetric) {
+		if size := int64(sample.Value); size > usage.SizeBytes {
+			usage.SizeBytes = size
+		}
+	}
+	return usage, nil
+}
+
+// CheckEtcdUsage reports the resource types with the most objects in etcd and fails when the
+// database is close to the etcd quota. Clusters that do not report their database size pass,
+// with the object counts as a guide.
+func CheckEtcdUsage(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "etcd-objects"}
+
+	usage, err := MeasureEtcdUsage(ctx, client)
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	for i, resource := range usage.Resources {
+		if i == etcdTopResources {
+			result.Details = append(result.Details, fmt.Sprintf("… %d more resource type(s)", len(usage.Resources)-i))
+			break
+		}
+		result.Details = append(result.Details, fmt.Sprintf("%s: %d", resource.Resource, resource.Count))
+	}
+
+	message := fmt.Sprintf("%d object(s) across %d resource type(s)", usage.Total, len(usage.Resources))
+	result.Status = CheckPass
+	if usage.SizeBytes > 0 {
+		fraction := float64(usage.SizeBytes) / etcdQuotaBytes
+		message += fmt.Sprintf("; etcd database %s, %.0f%% of the %s quota", formatBytes(usage.SizeBytes), fraction*100, formatBytes(etcdQuotaBytes))
+		if fraction >= etcdSizeWarning {
+			result.Status = CheckFail
+		}
+	}
+	result.Message = message
+	return result
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. 1.5GiB
+func formatBytes(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(n)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", value), ".0") + units[unit]
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// exportResourceTypes maps the resource type names accepted by export-resources to the API
+// resources they cover. Secrets are deliberately not exportable.
+var exportResourceTypes = map[string][]schema.GroupVersionResource{
+	"namespaces": {{Version: "v1", Resource: "namespaces"}},
+	"rbac": {
+		{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"},
+		{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterrolebindings"},
+		{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "roles"},
+		{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"},
+	},
+	"crds":       {{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}},
+	"configmaps": {{Version: "v1", Resource: "configmaps"}},
+}
+
+// DefaultExportResources are the resource types exported unless --resources is given
+const DefaultExportResources = "namespaces,rbac,crds,configmaps"
+
+// ParseExportResources parses a comma-separated list of resource type names
+func ParseExportResources(value string) ([]string, error) {
+	var types []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if _, ok := exportResourceTypes[name]; !ok {
+			return nil, fmt.Errorf("unknown resource type %q (expected namespaces, rbac, crds or configmaps)", name)
+		}
+		seen[name] = true
+		types = append(types, name)
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("at least one resource type is required")
+	}
+	return types, nil
+}
+
+// ExportedFile is one object written by ExportResources
+type ExportedFile struct {
+	Resource string `json:"resource"`
+	Objects  int    `json:"objects"`
+	URL      string `json:"url"`
+}
+
+// ExportResources writes the resources of the given types to store, one YAML List per API
+// resource under <runID>/<cluster key>/<resource>.yaml. Server-managed field metadata is
+// dropped; everything else is kept so the objects can be re-applied.
+func ExportResources(ctx context.Context, client ClusterClient, store ObjectStore, runID string, types []string) ([]ExportedFile, error) {
+	dyn, err := client.Dynamic()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []ExportedFile
+	for _, name := range types {
+		for _, gvr := range exportResourceTypes[name] {
+			var items []interface{}
+			err := eachObject(ctx, gvr.Resource, func(opts metav1.ListOptions) (runtime.Object, error) {
+				return dyn.Resource(gvr).List(ctx, opts)
+			}, func(obj runtime.Object) error {
+				item := obj.(*unstructured.Unstructured)
+				unstructured.RemoveNestedField(item.Object, "metadata", "managedFields")
+				items = append(items, item.Object)
+				return nil
+			})
+			if err != nil {
+				return files, err
+			}
+
+			data, err := yaml.Marshal(map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": items})
+			if err != nil {
+				return files, fmt.Errorf("failed to encode %s: %w", gvr.Resource, err)
+			}
+			key := path.Join(runID, client.Identity().Key(), gvr.Resource+".yaml")
+			if err := store.Put(ctx, key, data, "application/yaml"); err != nil {
+				return files, err
+			}
+			files = append(files, ExportedFile{Resource: gvr.Resource, Objects: len(items), URL: store.URL(key)})
+		}
+	}
+	return files, nil
+}
+
+// PrintExportedFiles prints one line per exported object
+func PrintExportedFiles(files []ExportedFile) {
+	for _, file := range files {
+		fmt.Printf("  ✓ %s: %d object(s) → %s\n", file.Resource, file.Objects, file.URL)
+	}
+}
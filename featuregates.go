@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// featureEnabledMetric is the API server metric reporting each feature gate, since Kubernetes 1.26:
+//
+//	kubernetes_feature_enabled{name="InPlacePodVerticalScaling",stage="ALPHA"} 0
+const featureEnabledMetric = "kubernetes_feature_enabled"
+
+// FeatureGate is a feature gate of the API server and whether it is enabled
+type FeatureGate struct {
+	Name    string `json:"name"`
+	Stage   string `json:"stage,omitempty"` // ALPHA, BETA or DEPRECATED; empty for GA
+	Enabled bool   `json:"enabled"`
+}
+
+// ServerFeatures is the build and feature gates of a cluster's API server
+type ServerFeatures struct {
+	GitVersion   string        `json:"gitVersion"`
+	GitCommit    string        `json:"gitCommit,omitempty"`
+	BuildDate    string        `json:"buildDate,omitempty"`
+	GoVersion    string        `json:"goVersion,omitempty"`
+	Platform     string        `json:"platform,omitempty"`
+	FeatureGates []FeatureGate `json:"featureGates,omitempty"`
+	// MetricsError explains why feature gates are missing: /metrics is often forbidden on
+	// managed control planes, or the API server predates the feature gate metric
+	MetricsError string `json:"metricsError,omitempty"`
+}
+
+// Enabled returns the names of the enabled feature gates that are not GA
+func (f *ServerFeatures) Enabled() []string {
+	var names []string
+	for _, gate := range f.FeatureGates {
+		if gate.Enabled && gate.Stage != "" {
+			names = append(names, gate.Name)
+		}
+	}
+	return names
+}
+
+// InspectServerFeatures reads the API server's build info from /version and, where the caller
+// may read /metrics, which feature gates are enabled
+func InspectServerFeatures(ctx context.Context, client ClusterClient) (*ServerFeatures, error) {
+	version, err := client.Discovery().ServerVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server version: %w", err)
+	}
+	features := &ServerFeatures{
+		GitVersion: version.GitVersion,
+		GitCommit:  version.GitCommit,
+		BuildDate:  version.BuildDate,
+		GoVersion:  version.GoVersion,
+		Platform:   version.Platform,
+	}
+
+	metrics, err := client.RawRequest(ctx, "GET", "/metrics")
+	if err != nil {
+		features.MetricsError = err.Error()
+		return features, nil
+	}
+	features.FeatureGates = parseFeatureGates(string(metrics))
+	if len(features.FeatureGates) == 0 {
+		features.MetricsError = "API server does not report " + featureEnabledMetric
+	}
+	return features, nil
+}
+
+// parseFeatureGates extracts the feature gate samples from Prometheus text exposition output
+func parseFeatureGates(metrics string) []FeatureGate {
+	var gates []FeatureGate
+	for _, sample := range parseMetricSamples(metrics, featureEnabledMetric) {
+		if sample.Labels["name"] == "" {
+			continue
+		}
+		gates = append(gates, FeatureGate{Name: sample.Labels["name"], Stage: sample.Labels["stage"], Enabled: sample.Value == 1})
+	}
+	sort.Slice(gates, func(i, j int) bool { return gates[i].Name < gates[j].Name })
+	return gates
+}
+
+// metricSample is one sample of a metric in Prometheus text exposition output
+type metricSample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// parseMetricSamples returns the samples of the named metric in Prometheus text exposition output
+func parseMetricSamples(metrics, name string) []metricSample {
+	var samples []metricSample
+	for _, line := range strings.Split(metrics, "\n") {
+		rest, ok := strings.CutPrefix(line, name)
+		if !ok || rest == "" || (rest[0] != '{' && rest[0] != ' ') {
+			continue
+		}
+		labelText := ""
+		if rest[0] == '{' {
+			labelText, rest, ok = strings.Cut(rest[1:], "}")
+			if !ok {
+				continue
+			}
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		samples = append(samples, metricSample{Labels: parseMetricLabels(labelText), Value: value})
+	}
+	return samples
+}
+
+// parseMetricLabels parses the labels of a sample, e.g. name="X",stage="BETA"
+func parseMetricLabels(text string) map[string]string {
+	labels := map[string]string{}
+	for text != "" {
+		key, rest, ok := strings.Cut(text, "=")
+		if !ok || !strings.HasPrefix(rest, `"`) {
+			break
+		}
+		value, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			break
+		}
+		labels[strings.TrimSpace(key)], _ = strconv.Unquote(value)
+		text = strings.TrimPrefix(rest[len(value):], ",")
+	}
+	return labels
+}
+
+// PrintServerFeatures prints a cluster's API server build and its enabled alpha, beta and
+// deprecated feature gates
+func PrintServerFeatures(features *ServerFeatures) {
+	fmt.Printf("  API server %s (commit %s, built %s, %s, %s)\n",
+		features.GitVersion, features.GitCommit, features.BuildDate, features.GoVersion, features.Platform)
+	if features.MetricsError != "" {
+		fmt.Printf("  ⚠ feature gates unavailable: %s\n", features.MetricsError)
+		return
+	}
+	enabled := features.Enabled()
+	fmt.Printf("  %d feature gate(s), %d non-GA enabled\n", len(features.FeatureGates), len(enabled))
+	for _, name := range enabled {
+		fmt.Printf("    %s\n", name)
+	}
+}
+
+// printFeatureConsistency lists the API server builds of a fleet and the feature gates whose
+// state differs between the clusters that expose them
+func printFeatureConsistency(results []FleetResult) {
+	var clusters []string
+	var features []*ServerFeatures
+	for _, result := range results {
+		if f, ok := result.Output.(*ServerFeatures); ok && result.Err == nil {
+			clusters = append(clusters, result.Cluster.Identity().Key())
+			features = append(features, f)
+		}
+	}
+	if len(clusters) == 0 {
+		fmt.Println("\nNo API server features collected")
+		return
+	}
+
+	builds := map[string][]string{}
+	for i, f := range features {
+		builds[f.GitVersion] = append(builds[f.GitVersion], clusters[i])
+	}
+	versions := make([]string, 0, len(builds))
+	for version := range builds {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	fmt.Printf("\n%d API server build(s):\n", len(versions))
+	for _, version := range versions {
+		fmt.Printf("  %s: %s\n", version, strings.Join(builds[version], ", "))
+	}
+
+	// state[gate][cluster] is "on", "off" or missing when the cluster does not know the gate
+	state := map[string]map[string]string{}
+	exposed := 0
+	for i, f := range features {
+		if len(f.FeatureGates) == 0 {
+			continue
+		}
+		exposed++
+		for _, gate := range f.FeatureGates {
+			if state[gate.Name] == nil {
+				state[gate.Name] = map[string]string{}
+			}
+			value := "off"
+			if gate.Enabled {
+				value = "on"
+			}
+			state[gate.Name][clusters[i]] = value
+		}
+	}
+	var inconsistent []string
+	for name, byCluster := range state {
+		values := map[string]bool{}
+		for _, value := range byCluster {
+			values[value] = true
+		}
+		if len(values) > 1 {
+			inconsistent = append(inconsistent, name)
+		}
+	}
+	sort.Strings(inconsistent)
+
+	switch {
+	case exposed < 2:
+		fmt.Printf("\nFeature gates exposed by %d of %d clusters; nothing to compare\n", exposed, len(clusters))
+	case len(inconsistent) == 0:
+		fmt.Printf("\n✓ Feature gates consistent across the %d clusters that expose them\n", exposed)
+	default:
+		fmt.Printf("\n✗ %d feature gate(s) differ between clusters:\n", len(inconsistent))
+		for _, name := range inconsistent {
+			var on, off []string
+			for cluster, value := range state[name] {
+				if value == "on" {
+					on = append(on, cluster)
+				} else {
+					off = append(off, cluster)
+				}
+			}
+			sort.Strings(on)
+			sort.Strings(off)
+			fmt.Printf("  %s: on in %s; off in %s\n", name, listOrNone(on), listOrNone(off))
+		}
+	}
+}
+
+// listOrNone joins names, or returns "none" when there are none
+func listOrNone(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Workload kinds searched by FindWorkloads
+const (
+	KindPod        = "Pod"
+	KindDeployment = "Deployment"
+)
+
+// workloadKindAliases maps the accepted --kind spellings to workload kinds
+var workloadKindAliases = map[string]string{
+	"pod":         KindPod,
+	"pods":        KindPod,
+	"po":          KindPod,
+	"deployment":  KindDeployment,
+	"deployments": KindDeployment,
+	"deploy":      KindDeployment,
+}
+
+// FindQuery selects the workloads to look for on each cluster
+type FindQuery struct {
+	// NamePattern is a glob such as payments-* matched against workload names; a pattern
+	// without wildcards matches names containing it. Empty matches every name.
+	NamePattern   string
+	LabelSelector string   // e.g. "app=payments,tier!=cache"
+	Namespace     string   // empty for all namespaces
+	Kinds         []string // KindPod and/or KindDeployment
+}
+
+// Validate checks the name pattern, label selector and kinds before any cluster is contacted
+func (q FindQuery) Validate() error {
+	if q.NamePattern == "" && q.LabelSelector == "" {
+		return fmt.Errorf("a name pattern or --label selector is required")
+	}
+	if _, err := path.Match(q.NamePattern, ""); err != nil {
+		return fmt.Errorf("invalid name pattern %q: %w", q.NamePattern, err)
+	}
+	if _, err := labels.Parse(q.LabelSelector); err != nil {
+		return fmt.Errorf("invalid label selector %q: %w", q.LabelSelector, err)
+	}
+	if len(q.Kinds) == 0 {
+		return fmt.Errorf("at least one kind is required")
+	}
+	return nil
+}
+
+// ParseWorkloadKinds parses a comma-separated list of kinds such as "pods,deployments"
+func ParseWorkloadKinds(value string) ([]string, error) {
+	var kinds []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		kind, ok := workloadKindAliases[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown kind %q (expected pods or deployments)", name)
+		}
+		if !seen[kind] {
+			seen[kind] = true
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds, nil
+}
+
+// matchesName reports whether name matches the query's name pattern
+func (q FindQuery) matchesName(name string) bool {
+	if q.NamePattern == "" {
+		return true
+	}
+	if !strings.ContainsAny(q.NamePattern, "*?[") {
+		return strings.Contains(name, q.NamePattern)
+	}
+	matched, _ := path.Match(q.NamePattern, name)
+	return matched
+}
+
+// WorkloadMatch is a workload found by FindWorkloads
+type WorkloadMatch struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Status    string `json:"status"` // pod phase, or ready/desired replicas for deployments
+}
+
+// FindWorkloads lists the workloads of the query's kinds and returns those matching it, sorted
+// by namespace, kind and name. The label selector is applied by the API server; names are
+// matched client-side since the API cannot filter on name patterns.
+func FindWorkloads(ctx context.Context, clientset kubernetes.Interface, query FindQuery) ([]WorkloadMatch, error) {
+	opts := metav1.ListOptions{LabelSelector: query.LabelSelector}
+
+	var matches []WorkloadMatch
+	for _, kind := range query.Kinds {
+		var err error
+		switch kind {
+		case KindPod:
+			err = EachPod(ctx, clientset, query.Namespace, opts, func(pod *corev1.Pod) error {
+				if query.matchesName(pod.Name) {
+					matches = append(matches, WorkloadMatch{
+						Kind:      KindPod,
+						Namespace: pod.Namespace,
+						Name:      pod.Name,
+						Status:    string(pod.Status.Phase),
+					})
+				}
+				return nil
+			})
+		case KindDeployment:
+			err = EachDeployment(ctx, clientset, query.Namespace, opts, func(deployment *appsv1.Deployment) error {
+				if query.matchesName(deployment.Name) {
+					desired := int32(1)
+					if deployment.Spec.Replicas != nil {
+						desired = *deployment.Spec.Replicas
+					}
+					matches = append(matches, WorkloadMatch{
+						Kind:      KindDeployment,
+						Namespace: deployment.Namespace,
+						Name:      deployment.Name,
+						Status:    fmt.Sprintf("%d/%d ready", deployment.Status.ReadyReplicas, desired),
+					})
+				}
+				return nil
+			})
+		default:
+			err = fmt.Errorf("unknown kind %q", kind)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+	return matches, nil
+}
+
+// PrintWorkloadMatches prints one line per matched workload
+func PrintWorkloadMatches(matches []WorkloadMatch) {
+	for _, match := range matches {
+		fmt.Printf("  %s/%s %s (%s)\n", match.Namespace, match.Name, match.Kind, match.Status)
+	}
+}
+
+// printFindSummary prints how many workloads were found and on how many clusters
+func printFindSummary(results []FleetResult) {
+	total, clusters := 0, 0
+	for _, result := range results {
+		if matches, ok := result.Output.([]WorkloadMatch); ok && len(matches) > 0 {
+			total += len(matches)
+			clusters++
+		}
+	}
+	fmt.Printf("\nFound %d workload(s) on %d of %d clusters\n", total, clusters, len(results))
+}
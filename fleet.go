@@ -0,0 +1,603 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultGlobalConcurrency is the number of clusters processed at once across all providers
+const DefaultGlobalConcurrency = 20
+
+// defaultProviderConcurrency caps each provider separately because they throttle differently
+var defaultProviderConcurrency = map[Provider]int{
+	ProviderAKS: 5,
+	ProviderEKS: 10,
+	ProviderGKE: 10,
+}
+
+// FleetConfig lists the clusters to operate on and how many may be processed concurrently
+type FleetConfig struct {
+	Concurrency ConcurrencyConfig            `json:"concurrency,omitempty"`
+	Profiles    map[string]ConnectionProfile `json:"profiles,omitempty"`
+	Clusters    []FleetCluster               `json:"clusters"`
+	// VersionPolicies are evaluated by the version-policy check of fleet check
+	VersionPolicies []VersionPolicy `json:"versionPolicies,omitempty"`
+}
+
+// ConcurrencyConfig limits how many clusters are processed at once, overall and per provider
+type ConcurrencyConfig struct {
+	Global      int              `json:"global,omitempty"`
+	PerProvider map[Provider]int `json:"perProvider,omitempty"`
+}
+
+// FleetCluster is one cluster entry of a fleet config
+type FleetCluster struct {
+	Provider      Provider `json:"provider"`
+	Name          string   `json:"name"`
+	Account       string   `json:"account,omitempty"`       // Azure subscription ID or GCP project ID
+	Region        string   `json:"region,omitempty"`        // AWS region or GKE zone/region
+	ResourceGroup string   `json:"resourceGroup,omitempty"` // AKS only
+	Profile       string   `json:"profile,omitempty"`       // connection profile supplying credentials and defaults
+
+	// UserAgent and Headers override DefaultUserAgent and add headers in requests to the
+	// cluster's API server, for API gateways or service meshes in front of it
+	UserAgent string            `json:"userAgent,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+
+	// Checks enables or disables individual checks of fleet check and upgrade health gates
+	// for the cluster
+	Checks ClusterChecks `json:"checks,omitempty"`
+
+	// ClusterCredentials set on the entry itself override those of its profile, so each
+	// cluster can use its own role, tenant or service account
+	ClusterCredentials
+
+	credentials ClusterCredentials // resolved from the profile and the entry
+	tags        map[string]string  // cloud tags, when already read by SelectFleetClusters
+}
+
+// LoadFleetConfig reads and validates a fleet config file (YAML or JSON)
+func LoadFleetConfig(path string) (*FleetConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fleet config: %w", err)
+	}
+	return parseFleetConfig(path, data)
+}
+
+// parseFleetConfig parses and validates the content of the fleet config file path
+func parseFleetConfig(path string, data []byte) (*FleetConfig, error) {
+	var config FleetConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse fleet config %s: %w", path, err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid fleet config %s: %w", path, err)
+	}
+
+	return &config, nil
+}
+
+// Validate checks that every cluster entry has what its provider needs to connect
+func (c *FleetConfig) Validate() error {
+	if c.Concurrency.Global < 0 {
+		return fmt.Errorf("concurrency.global must not be negative")
+	}
+	for provider, limit := range c.Concurrency.PerProvider {
+		if _, err := parseProvider(string(provider)); err != nil {
+			return fmt.Errorf("concurrency.perProvider: %w", err)
+		}
+		if limit < 0 {
+			return fmt.Errorf("concurrency.perProvider.%s must not be negative", provider)
+		}
+	}
+
+	for name, profile := range c.Profiles {
+		if err := profile.Validate(); err != nil {
+			return fmt.Errorf("profiles.%s: %w", name, err)
+		}
+	}
+
+	seen := map[string]bool{}
+	for i := range c.Clusters {
+		cluster := &c.Clusters[i]
+		if err := c.resolveProfile(cluster); err != nil {
+			return fmt.Errorf("clusters[%d]: %w", i, err)
+		}
+		if err := cluster.Validate(); err != nil {
+			return fmt.Errorf("clusters[%d]: %w", i, err)
+		}
+		if cluster.Region != "" {
+			cluster.Region, _ = NormalizeLocation(cluster.Provider, cluster.Region, LocationAny)
+		}
+		key := cluster.Identity().Key()
+		if seen[key] {
+			return fmt.Errorf("clusters[%d]: duplicate cluster %s", i, key)
+		}
+		seen[key] = true
+	}
+
+	names := map[string]bool{}
+	for i := range c.VersionPolicies {
+		policy := &c.VersionPolicies[i]
+		if err := policy.Validate(); err != nil {
+			return fmt.Errorf("versionPolicies[%d]: %w", i, err)
+		}
+		if names[policy.Name] {
+			return fmt.Errorf("versionPolicies[%d]: duplicate policy %q", i, policy.Name)
+		}
+		names[policy.Name] = true
+	}
+
+	return nil
+}
+
+// resolveProfile fills in the provider, defaults and credentials of the cluster's profile
+func (c *FleetConfig) resolveProfile(cluster *FleetCluster) error {
+	if cluster.Profile == "" {
+		cluster.credentials = cluster.ClusterCredentials
+		return nil
+	}
+
+	profile, ok := c.Profiles[cluster.Profile]
+	if !ok {
+		return fmt.Errorf("unknown profile %q", cluster.Profile)
+	}
+	if cluster.Provider == "" {
+		cluster.Provider = profile.Provider
+	}
+	if cluster.Provider != profile.Provider {
+		return fmt.Errorf("%s cluster %q uses %s profile %q", cluster.Provider, cluster.Name, profile.Provider, cluster.Profile)
+	}
+	if cluster.Account == "" {
+		cluster.Account = profile.Account
+	}
+	if cluster.Region == "" {
+		cluster.Region = profile.Region
+	}
+	cluster.credentials = profile.ClusterCredentials.merge(cluster.ClusterCredentials)
+
+	return nil
+}
+
+// FindCluster returns the cluster referenced by ref: its identity key, profile/name or, when
+// unambiguous, its name
+func (c *FleetConfig) FindCluster(ref string) (FleetCluster, error) {
+	var matches []FleetCluster
+	for _, cluster := range c.Clusters {
+		if ref == cluster.Identity().Key() || ref == cluster.ProfileName()+"/"+cluster.Name {
+			return cluster, nil
+		}
+		if ref == cluster.Name {
+			matches = append(matches, cluster)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return FleetCluster{}, fmt.Errorf("cluster %q is not in the fleet config", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return FleetCluster{}, fmt.Errorf("cluster name %q is ambiguous (%d clusters); use profile/name or the cluster key", ref, len(matches))
+	}
+}
+
+// ProfileName returns the cluster's connection profile, or "default" when it uses the environment
+func (c FleetCluster) ProfileName() string {
+	if c.Profile == "" {
+		return "default"
+	}
+	return c.Profile
+}
+
+// Validate checks the fields required by the cluster's provider
+func (c FleetCluster) Validate() error {
+	if _, err := parseProvider(string(c.Provider)); err != nil {
+		return err
+	}
+	if c.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if err := c.credentials.validate(c.Provider); err != nil {
+		return fmt.Errorf("cluster %q: %w", c.Name, err)
+	}
+	if err := validateRequestHeaders(c.Headers); err != nil {
+		return fmt.Errorf("cluster %q: %w", c.Name, err)
+	}
+	if err := c.Checks.Validate(); err != nil {
+		return fmt.Errorf("cluster %q: %w", c.Name, err)
+	}
+
+	if c.Region != "" {
+		if _, err := NormalizeLocation(c.Provider, c.Region, LocationAny); err != nil {
+			return err
+		}
+	}
+
+	switch c.Provider {
+	case ProviderAKS:
+		if c.Account == "" || c.ResourceGroup == "" {
+			return fmt.Errorf("AKS cluster %q needs account (subscription ID) and resourceGroup", c.Name)
+		}
+	case ProviderGKE:
+		if c.Account == "" {
+			return fmt.Errorf("GKE cluster %q needs account (project ID)", c.Name)
+		}
+	}
+
+	return nil
+}
+
+// Identity returns the identity the entry describes, as far as it is known before connecting
+func (c FleetCluster) Identity() ClusterIdentity {
+	return ClusterIdentity{
+		Provider:      c.Provider,
+		Account:       c.Account,
+		Region:        c.Region,
+		ResourceGroup: c.ResourceGroup,
+		Name:          c.Name,
+	}
+}
+
+// Connect creates a client for the cluster using the ambient credentials of its provider
+func (c FleetCluster) Connect() (ClusterClient, error) {
+	var client ClusterClient
+	var err error
+
+	switch c.Provider {
+	case ProviderAKS:
+		cred, credErr := c.credentials.azureCredential()
+		if credErr != nil {
+			return nil, fmt.Errorf("failed to create Azure credential: %w", credErr)
+		}
+		client, err = NewAKSClientWithOptions(c.Name, c.ResourceGroup, c.Account, cred,
+			AKSClientOptions{AADServerAppID: c.credentials.AzureAADServerAppID, UserAgent: c.UserAgent, Headers: c.Headers, Impersonate: impersonation})
+	case ProviderEKS:
+		client, err = NewEKSClientWithOptions(c.Name, c.awsConfig(), EKSClientOptions{UserAgent: c.UserAgent, Headers: c.Headers, Impersonate: impersonation})
+	case ProviderGKE:
+		gcpConfig, cfgErr := c.gcpConfig()
+		if cfgErr != nil {
+			return nil, cfgErr
+		}
+		client, err = NewGKEClientWithOptions(c.Name, gcpConfig, GKEClientOptions{UserAgent: c.UserAgent, Headers: c.Headers, Impersonate: impersonation})
+	default:
+		return nil, fmt.Errorf("unknown provider %q", c.Provider)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// awsConfig returns the AWS configuration for an EKS entry; a profile named in the config takes
+// precedence over static keys in the environment
+func (c FleetCluster) awsConfig() AWSConfig {
+	cfg := AWSConfig{
+		Region:       c.Region,
+		Profile:      os.Getenv("AWS_PROFILE"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if c.credentials.AWSProfile != "" {
+		cfg = AWSConfig{Region: c.Region, Profile: c.credentials.AWSProfile}
+	}
+	cfg.RoleARN = c.credentials.AWSRoleARN
+	cfg.ExternalID = c.credentials.AWSExternalID
+	cfg.AuthRoleARN = c.credentials.AWSAuthRoleARN
+	cfg.STSRegion, _ = NormalizeLocation(ProviderEKS, c.credentials.AWSSTSRegion, LocationRegion) // validated with the config
+	return cfg
+}
+
+// gcpConfig returns the GCP configuration for a GKE entry
+func (c FleetCluster) gcpConfig() (GCPConfig, error) {
+	cfg := GCPConfig{
+		ProjectID:                 c.Account,
+		Zone:                      c.Region,
+		ImpersonateServiceAccount: c.credentials.GCPImpersonateServiceAccount,
+		KubernetesScopes:          expandGCPScopes(c.credentials.GCPKubernetesScopes),
+		KubernetesAudience:        c.credentials.GCPKubernetesAudience,
+	}
+	if c.credentials.GCPCredentialsFile != "" {
+		cfg.CredentialsPath = c.credentials.GCPCredentialsFile
+		return cfg, nil
+	}
+	if err := applyGCPCredentialsFromEnv(&cfg); err != nil {
+		return GCPConfig{}, err
+	}
+	return cfg, nil
+}
+
+// FleetResult is the outcome of running an operation against one cluster
+type FleetResult struct {
+	Cluster  FleetCluster
+	Output   interface{} // value returned by the operation
+	Err      error
+	Duration time.Duration
+	// ProviderEvents are the incidents and maintenance the provider reported when the cluster failed
+	ProviderEvents []ProviderEvent
+	// Tags are the cluster's cloud tags (AKS/EKS tags or GKE resource labels), for grouping reports
+	Tags map[string]string
+}
+
+// FleetOperation is run against each connected cluster of a fleet and returns its per-cluster output
+type FleetOperation func(ctx context.Context, client ClusterClient) (interface{}, error)
+
+// RunFleet connects to every cluster of config and runs op against it, bounded by the global
+// and per-provider concurrency limits. Results are returned in config order.
+func RunFleet(ctx context.Context, config *FleetConfig, op FleetOperation) []FleetResult {
+	return RunFleetWithRegistry(ctx, config, nil, op)
+}
+
+// RunFleetWithRegistry is RunFleet reusing the clients cached in registry, for callers that run
+// operations against the fleet repeatedly. A nil registry connects afresh and closes the clients.
+func RunFleetWithRegistry(ctx context.Context, config *FleetConfig, registry *ClusterRegistry, op FleetOperation) []FleetResult {
+	slots := newFleetSlots(config.Concurrency)
+
+	// Per-cluster steps are folded into this one, which shows the share of clusters done
+	step := progress.Start(fmt.Sprintf("Running on %d clusters", len(config.Clusters)))
+	defer step.Done()
+	var finished atomic.Int32
+
+	results := make([]FleetResult, len(config.Clusters))
+	var wg sync.WaitGroup
+	for i, cluster := range config.Clusters {
+		wg.Add(1)
+		go func(i int, cluster FleetCluster) {
+			defer wg.Done()
+			defer func() {
+				step.Update(int(finished.Add(1)) * 100 / len(config.Clusters))
+			}()
+			results[i] = FleetResult{Cluster: cluster}
+
+			release, err := slots.acquire(ctx, cluster.Provider)
+			if err != nil {
+				results[i].Err = err
+				return
+			}
+			defer release()
+
+			start := time.Now()
+			results[i].Output, results[i].Err = runFleetOperation(ctx, cluster, registry, op)
+			results[i].Duration = time.Since(start)
+		}(i, cluster)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// fleetSlots are the semaphores enforcing the global and per-provider concurrency limits
+type fleetSlots struct {
+	global      chan struct{}
+	perProvider map[Provider]chan struct{}
+}
+
+// newFleetSlots creates semaphores sized by config, falling back to the defaults
+func newFleetSlots(config ConcurrencyConfig) *fleetSlots {
+	global := config.Global
+	if global <= 0 {
+		global = DefaultGlobalConcurrency
+	}
+
+	slots := &fleetSlots{
+		global:      make(chan struct{}, global),
+		perProvider: map[Provider]chan struct{}{},
+	}
+	for _, provider := range []Provider{ProviderAKS, ProviderEKS, ProviderGKE} {
+		limit := config.PerProvider[provider]
+		if limit <= 0 {
+			limit = defaultProviderConcurrency[provider]
+		}
+		slots.perProvider[provider] = make(chan struct{}, limit)
+	}
+
+	return slots
+}
+
+// acquire takes a provider slot and a global slot, returning a function that releases both.
+// The provider slot is taken first so a throttled provider does not hold global slots that
+// other providers could use.
+func (s *fleetSlots) acquire(ctx context.Context, provider Provider) (func(), error) {
+	providerSlots, ok := s.perProvider[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q", provider)
+	}
+
+	if err := acquireSlot(ctx, providerSlots); err != nil {
+		return nil, err
+	}
+	if err := acquireSlot(ctx, s.global); err != nil {
+		<-providerSlots
+		return nil, err
+	}
+
+	return func() {
+		<-s.global
+		<-providerSlots
+	}, nil
+}
+
+// runFleetOperation connects to a single cluster, or takes its client from registry when set,
+// and runs op against it with the cluster's config entry in its context
+func runFleetOperation(ctx context.Context, cluster FleetCluster, registry *ClusterRegistry, op FleetOperation) (interface{}, error) {
+	ctx = withFleetCluster(ctx, cluster)
+	if registry != nil {
+		client, release, err := registry.Get(ctx, cluster.Identity(), cluster.Connect)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect: %w", err)
+		}
+		defer release()
+		return op(ctx, client)
+	}
+
+	client, err := cluster.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer client.Close()
+
+	return op(ctx, client)
+}
+
+// acquireSlot takes a slot from a semaphore channel, giving up when ctx is done
+func acquireSlot(ctx context.Context, slots chan struct{}) error {
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PrintFleetResults summarizes the outcome for each cluster, grouped by connection profile,
+// and returns the number of failures
+func PrintFleetResults(results []FleetResult) int {
+	failed := 0
+	profiles, byProfile := groupFleetResults(results)
+	for _, profile := range profiles {
+		if len(profiles) > 1 || profile != "default" {
+			fmt.Printf("Profile %s:\n", profile)
+		}
+		for _, result := range byProfile[profile] {
+			key := result.Cluster.Identity().Key()
+			if result.Err != nil {
+				failed++
+				fmt.Printf("✗ %s: %s\n", key, Redact(result.Err.Error()))
+				for _, event := range result.ProviderEvents {
+					fmt.Printf("    ⚠ %s\n", event)
+				}
+				continue
+			}
+			// Checks that warned or were skipped are listed below a cluster that succeeded
+			var notable []CheckResult
+			warned := 0
+			for _, check := range resultChecks(result) {
+				switch check.Status {
+				case CheckWarn:
+					warned++
+					notable = append(notable, check)
+				case CheckSkip:
+					notable = append(notable, check)
+				}
+			}
+			if warned > 0 {
+				fmt.Printf("⚠ %s (%s): %d check(s) warned\n", key, result.Duration.Round(time.Millisecond), warned)
+			} else {
+				fmt.Printf("✓ %s (%s)\n", key, result.Duration.Round(time.Millisecond))
+			}
+			for _, check := range notable {
+				symbol := "⚠"
+				if check.Status == CheckSkip {
+					symbol = "○"
+				}
+				fmt.Printf("    %s %s: %s\n", symbol, check.Name, Redact(check.Message))
+			}
+		}
+	}
+	fmt.Printf("\n%d of %d clusters succeeded\n", len(results)-failed, len(results))
+	return failed
+}
+
+// resultChecks returns the check results of a fleet check or upgrade health gate result
+func resultChecks(result FleetResult) []CheckResult {
+	switch output := result.Output.(type) {
+	case []CheckResult:
+		return output
+	case *RolloutClusterOutput:
+		return output.Checks
+	}
+	return nil
+}
+
+// groupFleetResults groups results by profile name, returning the names in first-seen order
+func groupFleetResults(results []FleetResult) ([]string, map[string][]FleetResult) {
+	var names []string
+	groups := map[string][]FleetResult{}
+	for _, result := range results {
+		name := result.Cluster.ProfileName()
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], result)
+	}
+	return names, groups
+}
+
+// fleetResultJSON is the JSON form of a FleetResult. Check results are typed in Checks rather
+// than Output.
+type fleetResultJSON struct {
+	Cluster    string            `json:"cluster"`
+	Provider   Provider          `json:"provider"`
+	Name       string            `json:"name"`
+	Output     interface{}       `json:"output,omitempty"`
+	Checks     []checkResultJSON `json:"checks,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	DurationMS int64             `json:"durationMs"`
+
+	ProviderEvents []ProviderEvent   `json:"providerEvents,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+}
+
+// printFleetResultsJSON prints the report as JSON and returns the number of failures
+func printFleetResultsJSON(report *Report) int {
+	data, failed, err := encodeFleetResultsJSON(report)
+	if err != nil {
+		fmt.Printf("✗ %v\n", err)
+		return len(report.Results)
+	}
+	fmt.Println(string(data))
+	return failed
+}
+
+// encodeFleetResultsJSON encodes the report as redacted JSON in the current report schema, with
+// the results keyed by profile name, and returns it with the number of failures
+func encodeFleetResultsJSON(report *Report) ([]byte, int, error) {
+	out := fleetReportJSON{
+		SchemaVersion: ReportSchemaVersion,
+		ToolVersion:   ToolVersion(),
+		Action:        report.Action,
+		Finished:      report.Finished.UTC(),
+		Clusters:      len(report.Results),
+		Incidents:     report.Incidents,
+		Profiles:      map[string][]fleetResultJSON{},
+	}
+	for _, result := range report.Results {
+		entry := fleetResultJSON{
+			Cluster:    result.Cluster.Identity().Key(),
+			Provider:   result.Cluster.Provider,
+			Name:       result.Cluster.Name,
+			Output:     result.Output,
+			DurationMS: result.Duration.Milliseconds(),
+
+			ProviderEvents: result.ProviderEvents,
+			Tags:           result.Tags,
+		}
+		if checks, ok := result.Output.([]CheckResult); ok {
+			entry.Output = nil
+			entry.Checks = newCheckResultsJSON(checks)
+		}
+		if result.Err != nil {
+			out.Failed++
+			entry.Error = Redact(result.Err.Error())
+		}
+		profile := result.Cluster.ProfileName()
+		out.Profiles[profile] = append(out.Profiles[profile], entry)
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, out.Failed, fmt.Errorf("failed to encode fleet results: %w", err)
+	}
+	return []byte(Redact(string(data))), out.Failed, nil
+}
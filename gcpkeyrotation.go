@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2/google"
+	iam "google.golang.org/api/iam/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// DefaultKeyValidateTimeout is how long a new service account key is retried against the
+// cluster before the rotation is abandoned. New keys can take a minute to be accepted.
+const DefaultKeyValidateTimeout = 2 * time.Minute
+
+// keyValidateInterval is the pause between attempts to connect with a new key
+const keyValidateInterval = 10 * time.Second
+
+// gcpCredentialsSecretKey is the key a rotated service account key is written to in a Secret,
+// the one mounted credentials are read from
+const gcpCredentialsSecretKey = "GCP_CREDENTIALS_JSON"
+
+// serviceAccountKeyFile is the part of a service account key file rotation needs
+type serviceAccountKeyFile struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+}
+
+// parseServiceAccountKey reads the service account and key ID of a service account key file
+func parseServiceAccountKey(data []byte) (serviceAccountKeyFile, error) {
+	var key serviceAccountKeyFile
+	if err := json.Unmarshal(data, &key); err != nil {
+		return key, fmt.Errorf("invalid service account key: %w", err)
+	}
+	if key.Type != "service_account" || key.ClientEmail == "" || key.PrivateKeyID == "" {
+		return key, fmt.Errorf("credentials of type %q are not a service account key", key.Type)
+	}
+	return key, nil
+}
+
+// KeyDestination is where a rotated service account key is written:
+//
+//	file:<path>                          a key file, replaced atomically
+//	secret:<namespace>/<name>[/<key>]    a key of a Secret of the home cluster (default GCP_CREDENTIALS_JSON)
+//	dotenv:<path>                        the GCP_CREDENTIALS_JSON line of a .env file, base64-encoded
+type KeyDestination struct {
+	Kind      string // file, secret or dotenv
+	Path      string
+	Namespace string
+	Name      string
+	Key       string
+}
+
+// ParseKeyDestination parses a --dest value
+func ParseKeyDestination(spec string) (KeyDestination, error) {
+	kind, rest, _ := strings.Cut(spec, ":")
+	if rest == "" {
+		return KeyDestination{}, fmt.Errorf("invalid key destination %q (expected file:<path>, secret:<namespace>/<name>[/<key>] or dotenv:<path>)", spec)
+	}
+	switch kind {
+	case "file", "dotenv":
+		return KeyDestination{Kind: kind, Path: rest}, nil
+	case "secret":
+		parts := strings.Split(rest, "/")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return KeyDestination{}, fmt.Errorf("invalid key destination %q (expected secret:<namespace>/<name>[/<key>])", spec)
+		}
+		dest := KeyDestination{Kind: kind, Namespace: parts[0], Name: parts[1], Key: gcpCredentialsSecretKey}
+		if len(parts) == 3 && parts[2] != "" {
+			dest.Key = parts[2]
+		}
+		return dest, nil
+	default:
+		return KeyDestination{}, fmt.Errorf("unknown key destination %q (expected file:, secret: or dotenv:)", spec)
+	}
+}
+
+// String describes the destination
+func (d KeyDestination) String() string {
+	if d.Kind == "secret" {
+		return fmt.Sprintf("secret %s/%s key %s", d.Namespace, d.Name, d.Key)
+	}
+	return d.Kind + " " + d.Path
+}
+
+// defaultKeyDestination is where the key in cfg was read from, when it can be written back
+func defaultKeyDestination(cfg GCPConfig) (KeyDestination, error) {
+	switch {
+	case len(cfg.CredentialsJSON) > 0:
+		if data, err := os.ReadFile(".env"); err == nil && dotenvHasKey(data, "GCP_CREDENTIALS_JSON") {
+			return KeyDestination{Kind: "dotenv", Path: ".env"}, nil
+		}
+		return KeyDestination{}, errors.New("GCP_CREDENTIALS_JSON is not set in .env; pass --dest to say where the new key goes")
+	case cfg.CredentialsPath != "" && cfg.CredentialsPath == os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"):
+		return KeyDestination{Kind: "file", Path: cfg.CredentialsPath}, nil
+	case cfg.CredentialsPath != "":
+		return KeyDestination{}, fmt.Errorf("the key is mounted from a Secret at %s; pass --dest secret:<namespace>/<name> to update it", cfg.CredentialsPath)
+	default:
+		return KeyDestination{}, errors.New("pass --dest to say where the new key goes")
+	}
+}
+
+// KeyRotationOptions configures RotateGCPKey
+type KeyRotationOptions struct {
+	Destination     KeyDestination
+	ValidateTimeout time.Duration
+	KeepOld         bool // leave the old key in place, e.g. while other consumers switch over
+}
+
+// RotateGCPKey replaces the service account key GKE clients authenticate with: it creates a
+// new key for the service account, connects to the cluster with it, writes it to the
+// destination and deletes the old key. A new key that cannot connect or be written is deleted
+// again, leaving the old one in use.
+func RotateGCPKey(ctx context.Context, opts KeyRotationOptions) error {
+	if readOnly {
+		return fmt.Errorf("rotating the GCP service account key: %w", ErrReadOnly)
+	}
+	clusterName, gcpConfig, clientOptions, err := gkeSettingsFromEnv(false)
+	if err != nil {
+		return err
+	}
+	current := gcpConfig.CredentialsJSON
+	if len(current) == 0 {
+		if gcpConfig.CredentialsPath == "" {
+			return errors.New("no service account key configured (GCP_CREDENTIALS_JSON or GOOGLE_APPLICATION_CREDENTIALS); application default credentials cannot be rotated")
+		}
+		if current, err = os.ReadFile(gcpConfig.CredentialsPath); err != nil {
+			return fmt.Errorf("failed to read service account key: %w", err)
+		}
+	}
+	oldKey, err := parseServiceAccountKey(current)
+	if err != nil {
+		return err
+	}
+	if opts.Destination.Kind == "" {
+		if opts.Destination, err = defaultKeyDestination(gcpConfig); err != nil {
+			return err
+		}
+	}
+	Infof("Rotating key %s of service account %s", oldKey.PrivateKeyID, oldKey.ClientEmail)
+
+	service, err := newIAMService(ctx, current)
+	if err != nil {
+		return fmt.Errorf("failed to create IAM client: %w", err)
+	}
+	keys := service.Projects.ServiceAccounts.Keys
+
+	start := time.Now()
+	account := "projects/-/serviceAccounts/" + oldKey.ClientEmail
+	created, err := keys.Create(account, &iam.CreateServiceAccountKeyRequest{}).Context(ctx).Do()
+	recordAudit("gcp", "", "IAM CreateServiceAccountKey", account, start, 0, err)
+	if err != nil {
+		return fmt.Errorf("failed to create service account key: %w", err)
+	}
+	newKey, err := base64.StdEncoding.DecodeString(created.PrivateKeyData)
+	if err != nil {
+		return fmt.Errorf("failed to decode new service account key: %w", err)
+	}
+	RegisterSecret(created.PrivateKeyData)
+	RegisterSecret(string(newKey))
+	newKeyID := created.Name[strings.LastIndex(created.Name, "/")+1:]
+	Infof("✓ Created key %s", newKeyID)
+
+	// abandon deletes the new key after a failed step, keeping the old one in use
+	abandon := func(cause error) error {
+		if err := deleteServiceAccountKey(ctx, keys, created.Name); err != nil {
+			Warnf("Failed to delete new key %s, delete it by hand: %v", newKeyID, err)
+		}
+		return cause
+	}
+
+	gcpConfig.CredentialsJSON, gcpConfig.CredentialsPath = newKey, ""
+	if err := validateGKEKey(ctx, clusterName, gcpConfig, clientOptions, opts.ValidateTimeout); err != nil {
+		return abandon(fmt.Errorf("new key cannot connect to cluster %s: %w", clusterName, err))
+	}
+	Infof("✓ Connected to cluster %s with the new key", clusterName)
+
+	if err := writeServiceAccountKey(ctx, opts.Destination, newKey); err != nil {
+		return abandon(err)
+	}
+	Infof("✓ Wrote the new key to %s", opts.Destination)
+
+	if opts.KeepOld {
+		Infof("✓ Kept old key %s; delete it once nothing uses it", oldKey.PrivateKeyID)
+		return nil
+	}
+	newService, err := newIAMService(ctx, newKey)
+	if err != nil {
+		Warnf("Failed to delete old key %s, delete it by hand: %v", oldKey.PrivateKeyID, err)
+		return nil
+	}
+	if err := deleteServiceAccountKey(ctx, newService.Projects.ServiceAccounts.Keys, account+"/keys/"+oldKey.PrivateKeyID); err != nil {
+		Warnf("Failed to delete old key %s, delete it by hand: %v", oldKey.PrivateKeyID, err)
+		return nil
+	}
+	Infof("✓ Deleted old key %s", oldKey.PrivateKeyID)
+	return nil
+}
+
+// newIAMService returns an IAM client authenticating with the service account key
+func newIAMService(ctx context.Context, key []byte) (*iam.Service, error) {
+	creds, err := google.CredentialsFromJSON(ctx, key, iam.CloudPlatformScope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account key: %w", err)
+	}
+	return iam.NewService(ctx, gcpRESTOptions(creds.TokenSource)...)
+}
+
+// deleteServiceAccountKey deletes the service account key name
+func deleteServiceAccountKey(ctx context.Context, keys *iam.ProjectsServiceAccountsKeysService, name string) error {
+	start := time.Now()
+	_, err := keys.Delete(name).Context(ctx).Do()
+	recordAudit("gcp", "", "IAM DeleteServiceAccountKey", name, start, 0, err)
+	return err
+}
+
+// validateGKEKey connects to the cluster with the key in gcpConfig until the API server answers
+// or timeout passes
+func validateGKEKey(ctx context.Context, clusterName string, gcpConfig GCPConfig, clientOptions GKEClientOptions, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		err := connectWithGKEKey(clusterName, gcpConfig, clientOptions)
+		if err == nil {
+			return nil
+		}
+		Verbosef("New key not accepted yet: %v", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(keyValidateInterval):
+		}
+	}
+}
+
+// connectWithGKEKey connects to the cluster once and asks the API server for its version
+func connectWithGKEKey(clusterName string, gcpConfig GCPConfig, clientOptions GKEClientOptions) error {
+	client, err := NewGKEClientWithOptions(clusterName, gcpConfig, clientOptions)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	_, err = client.Clientset().Discovery().ServerVersion()
+	return err
+}
+
+// writeServiceAccountKey writes key to dest
+func writeServiceAccountKey(ctx context.Context, dest KeyDestination, key []byte) error {
+	switch dest.Kind {
+	case "file":
+		return replaceFile(dest.Path, key)
+	case "dotenv":
+		data, err := os.ReadFile(dest.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read %s: %w", dest.Path, err)
+		}
+		return replaceFile(dest.Path, setDotenvValue(data, "GCP_CREDENTIALS_JSON", base64.StdEncoding.EncodeToString(key)))
+	case "secret":
+		config, err := ctrl.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load the home cluster config: %w", err)
+		}
+		clientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return fmt.Errorf("failed to create home cluster client: %w", err)
+		}
+		return applyKeySecret(ctx, clientset, dest, key)
+	default:
+		return fmt.Errorf("unknown key destination %q", dest.Kind)
+	}
+}
+
+// applyKeySecret sets the key of the destination Secret to key, creating the Secret when it
+// does not exist. Its other keys are left alone.
+func applyKeySecret(ctx context.Context, clientset kubernetes.Interface, dest KeyDestination, key []byte) error {
+	secrets := clientset.CoreV1().Secrets(dest.Namespace)
+	existing, err := secrets.Get(ctx, dest.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      dest.Name,
+				Namespace: dest.Namespace,
+				Labels:    map[string]string{"app.kubernetes.io/managed-by": "connect-managed-k8s"},
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{dest.Key: key},
+		}
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create secret %s/%s: %w", dest.Namespace, dest.Name, err)
+		}
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to get secret %s/%s: %w", dest.Namespace, dest.Name, err)
+	}
+
+	if existing.Data == nil {
+		existing.Data = map[string][]byte{}
+	}
+	existing.Data[dest.Key] = key
+	if _, err := secrets.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update secret %s/%s: %w", dest.Namespace, dest.Name, err)
+	}
+	return nil
+}
+
+// replaceFile replaces path with data, readable only by the owner, through a temporary file
+// renamed over it so that readers never see a partial key
+func replaceFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// dotenvHasKey reports whether the .env content data assigns name
+func dotenvHasKey(data []byte, name string) bool {
+	for _, line := range strings.Split(string(data), "\n") {
+		if dotenvLineKey(line) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// setDotenvValue returns the .env content data with name assigned value, replacing its existing
+// assignment or appending one
+func setDotenvValue(data []byte, name, value string) []byte {
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(data) == 0 {
+		lines = nil
+	}
+	found := false
+	for i, line := range lines {
+		if dotenvLineKey(line) == name {
+			lines[i] = name + "=" + value
+			found = true
+		}
+	}
+	if !found {
+		lines = append(lines, name+"="+value)
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// dotenvLineKey returns the variable a .env line assigns, or "" for comments and blank lines
+func dotenvLineKey(line string) string {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ""
+	}
+	line = strings.TrimPrefix(line, "export ")
+	name, _, ok := strings.Cut(line, "=")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(name)
+}
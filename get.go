@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/restmapper"
+	"sigs.k8s.io/yaml"
+)
+
+// ResolvedResource is an API resource resolved from a name typed by the user
+type ResolvedResource struct {
+	GVR        schema.GroupVersionResource
+	Kind       string
+	Namespaced bool
+}
+
+// ResolveResource resolves a resource name as kubectl accepts it, e.g. "pods", "po",
+// "deployment", "deployments.apps" or "certificates.v1.cert-manager.io", using API discovery,
+// so custom resources work the same as built-in ones
+func ResolveResource(client discovery.DiscoveryInterface, name string) (*ResolvedResource, error) {
+	cached := memory.NewMemCacheClient(client)
+	mapper := restmapper.NewShortcutExpander(restmapper.NewDeferredDiscoveryRESTMapper(cached), cached, nil)
+
+	gvr, resource := schema.ParseResourceArg(strings.ToLower(name))
+	var err error
+	var resolved schema.GroupVersionResource
+	if gvr != nil {
+		resolved, err = mapper.ResourceFor(*gvr)
+	}
+	if gvr == nil || err != nil {
+		resolved, err = mapper.ResourceFor(resource.WithVersion(""))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unknown resource type %q: %w", name, err)
+	}
+
+	kind, err := mapper.KindFor(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve kind of %s: %w", resolved.Resource, err)
+	}
+	mapping, err := mapper.RESTMapping(kind.GroupKind(), kind.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", kind.Kind, err)
+	}
+	return &ResolvedResource{
+		GVR:        mapping.Resource,
+		Kind:       kind.Kind,
+		Namespaced: mapping.Scope.Name() == meta.RESTScopeNameNamespace,
+	}, nil
+}
+
+// GetQuery selects the objects fetched by GetResources
+type GetQuery struct {
+	Resource      string
+	Name          string // a single object; empty for all matching objects
+	Namespace     string // empty for all namespaces
+	LabelSelector string
+}
+
+// GetResources fetches objects of any resource type through the dynamic client, page by page.
+// Server-managed field metadata is dropped.
+func GetResources(ctx context.Context, client ClusterClient, query GetQuery) (*ResolvedResource, []*unstructured.Unstructured, error) {
+	if _, err := labels.Parse(query.LabelSelector); err != nil {
+		return nil, nil, fmt.Errorf("invalid label selector %q: %w", query.LabelSelector, err)
+	}
+
+	resource, err := ResolveResource(client.Discovery(), query.Resource)
+	if err != nil {
+		return nil, nil, err
+	}
+	dyn, err := client.Dynamic()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	namespace := query.Namespace
+	if !resource.Namespaced {
+		namespace = ""
+	}
+	objects := dyn.Resource(resource.GVR).Namespace(namespace)
+
+	if query.Name != "" {
+		if resource.Namespaced && namespace == "" {
+			return nil, nil, fmt.Errorf("%s are namespaced: give --namespace to get %q", resource.GVR.Resource, query.Name)
+		}
+		obj, err := objects.Get(ctx, query.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get %s %q: %w", resource.Kind, query.Name, err)
+		}
+		unstructured.RemoveNestedField(obj.Object, "metadata", "managedFields")
+		return resource, []*unstructured.Unstructured{obj}, nil
+	}
+
+	var items []*unstructured.Unstructured
+	err = eachObject(ctx, resource.GVR.Resource, func(opts metav1.ListOptions) (runtime.Object, error) {
+		opts.LabelSelector = query.LabelSelector
+		return objects.List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		item := obj.(*unstructured.Unstructured)
+		unstructured.RemoveNestedField(item.Object, "metadata", "managedFields")
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return resource, items, nil
+}
+
+// PrintResources prints objects as a table of namespace, name and age, or as JSON or YAML. Like
+// kubectl, JSON and YAML print the object itself only when it was requested by name (named),
+// and otherwise a List, even when a single object matched.
+func PrintResources(resource *ResolvedResource, items []*unstructured.Unstructured, output string, named bool) error {
+	switch output {
+	case "json", "yaml":
+		var doc interface{}
+		if named && len(items) == 1 {
+			doc = items[0].Object
+		} else {
+			list := make([]interface{}, 0, len(items))
+			for _, item := range items {
+				list = append(list, item.Object)
+			}
+			doc = map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": list}
+		}
+		var data []byte
+		var err error
+		if output == "json" {
+			data, err = json.MarshalIndent(doc, "", "  ")
+		} else {
+			data, err = yaml.Marshal(doc)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", resource.GVR.Resource, err)
+		}
+		fmt.Println(strings.TrimRight(Redact(string(data)), "\n"))
+	case "text":
+		if len(items) == 0 {
+			fmt.Printf("No %s found\n", resource.GVR.Resource)
+			return nil
+		}
+		if resource.Namespaced {
+			fmt.Printf("%-30s %-50s %s\n", "NAMESPACE", "NAME", "AGE")
+		} else {
+			fmt.Printf("%-50s %s\n", "NAME", "AGE")
+		}
+		for _, item := range items {
+			age := duration.HumanDuration(time.Since(item.GetCreationTimestamp().Time))
+			if resource.Namespaced {
+				fmt.Printf("%-30s %-50s %s\n", item.GetNamespace(), item.GetName(), age)
+			} else {
+				fmt.Printf("%-50s %s\n", item.GetName(), age)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown output format %q (expected text, json or yaml)", output)
+	}
+	return nil
+}
@@ -6,20 +6,31 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	container "cloud.google.com/go/container/apiv1"
 	containerpb "cloud.google.com/go/container/apiv1/containerpb"
 	"cloud.google.com/go/storage"
 	"github.com/joho/godotenv"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/idtoken"
+	"google.golang.org/api/impersonate"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
 const (
@@ -30,9 +41,17 @@ const (
 // GCPConfig represents GCP configuration options
 type GCPConfig struct {
 	ProjectID       string // GCP project ID (required)
-	Zone            string // GCP zone/location (optional)
+	Zone            string // GCP zone/location; empty finds a GKE client's cluster by searching
 	CredentialsJSON []byte // Service account JSON credentials (optional)
 	CredentialsPath string // Path to service account JSON file (optional)
+	// ImpersonateServiceAccount is a service account impersonated with the credentials above (optional)
+	ImpersonateServiceAccount string
+	// KubernetesScopes are the OAuth scopes of the tokens sent to the Kubernetes API server
+	// (default cloud-platform, like the GCP API clients)
+	KubernetesScopes []string
+	// KubernetesAudience, when set, authenticates to the Kubernetes API server with ID tokens
+	// restricted to this audience instead of access tokens
+	KubernetesAudience string
 }
 
 // GCPClientManager manages GCP clients and configurations
@@ -40,6 +59,10 @@ type GCPClientManager struct {
 	config        GCPConfig
 	gkeClient     *container.ClusterManagerClient
 	storageClient *storage.Client
+	tokenSource   oauth2.TokenSource
+	// kubernetesTokenSource authenticates to the Kubernetes API server; tokenSource unless
+	// Kubernetes scopes or an audience are configured
+	kubernetesTokenSource oauth2.TokenSource
 }
 
 // NewGCPClientManager creates a new GCP client manager
@@ -64,24 +87,36 @@ func (m *GCPClientManager) initializeGCPClients(ctx context.Context) error {
 	if m.config.Zone == "" {
 		m.config.Zone = GCPDefaultZone
 	}
-	var clientOptions []option.ClientOption
+	// The token source keeps the context it is created with for later refreshes, so it gets
+	// the long-lived ctx and the timeout only abandons a slow credential lookup
+	var tokenSource oauth2.TokenSource
+	err := runPhase(ctx, PhaseAuth, func(context.Context) error {
+		var err error
+		tokenSource, err = m.newTokenSource(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	m.tokenSource = tokenSource
 
-	if len(m.config.CredentialsJSON) > 0 {
-		fmt.Println("Using static service account JSON")
-		clientOptions = append(clientOptions, option.WithCredentialsJSON(m.config.CredentialsJSON))
-	} else if m.config.CredentialsPath != "" {
-		fmt.Println("Using static service account file")
-		clientOptions = append(clientOptions, option.WithCredentialsFile(m.config.CredentialsPath))
-	} else {
-		fmt.Println("Using application default credentials")
+	kubernetesTokenSource, err := m.newKubernetesTokenSource(ctx)
+	if err != nil {
+		return err
+	}
+	if kubernetesTokenSource == nil {
+		kubernetesTokenSource = tokenSource
 	}
+	m.kubernetesTokenSource = kubernetesTokenSource
+	clientOptions := []option.ClientOption{option.WithTokenSource(tokenSource)}
 
-	gkeClient, err := container.NewClusterManagerClient(ctx, clientOptions...)
+	gkeClient, err := container.NewClusterManagerClient(ctx, append(append(append(append(clientOptions,
+		gcpRateLimitOptions()...), gcpTimeoutOptions()...), gcpAuditOptions()...), gcpReadOnlyOptions()...)...)
 	if err != nil {
 		return fmt.Errorf("failed to create GKE client: %w", err)
 	}
 
-	storageClient, err := storage.NewClient(ctx, clientOptions...)
+	storageClient, err := storage.NewClient(ctx, gcpRESTOptions(tokenSource)...)
 	if err != nil {
 		gkeClient.Close()
 		return fmt.Errorf("failed to create storage client: %w", err)
@@ -91,13 +126,154 @@ func (m *GCPClientManager) initializeGCPClients(ctx context.Context) error {
 	m.storageClient = storageClient
 
 	// Validate credentials
-	if err := m.validateCredentials(ctx); err != nil {
+	err = runPhase(ctx, PhaseAuth, m.validateCredentials)
+	if err != nil {
 		return fmt.Errorf("credential validation failed: %w", err)
 	}
 
 	return nil
 }
 
+// newTokenSource returns the token source of the GCP API clients for the configured
+// credentials, impersonating ImpersonateServiceAccount when set
+func (m *GCPClientManager) newTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	if len(m.config.CredentialsJSON) > 0 {
+		Infof("Using static service account JSON")
+	} else if m.config.CredentialsPath != "" {
+		Infof("Using static service account file")
+	} else {
+		Infof("Using application default credentials")
+	}
+	if m.config.ImpersonateServiceAccount != "" {
+		Infof("Impersonating service account: %s", m.config.ImpersonateServiceAccount)
+	}
+
+	return m.scopedTokenSource(ctx, container.DefaultAuthScopes())
+}
+
+// loadCredentials loads the configured base credentials with scopes
+func (m *GCPClientManager) loadCredentials(ctx context.Context, scopes []string) (*google.Credentials, error) {
+	var creds *google.Credentials
+	var err error
+	if len(m.config.CredentialsJSON) > 0 {
+		creds, err = google.CredentialsFromJSON(ctx, m.config.CredentialsJSON, scopes...)
+	} else if m.config.CredentialsPath != "" {
+		// The file is re-read when it changes, so rotating a mounted key Secret takes effect
+		creds, err = newRotatingCredentials(ctx, m.config.CredentialsPath, scopes)
+	} else {
+		creds, err = google.FindDefaultCredentials(ctx, scopes...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Google Cloud credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// scopedTokenSource returns an access token source with scopes, impersonating
+// ImpersonateServiceAccount when set
+func (m *GCPClientManager) scopedTokenSource(ctx context.Context, scopes []string) (oauth2.TokenSource, error) {
+	creds, err := m.loadCredentials(ctx, scopes)
+	if err != nil {
+		return nil, err
+	}
+	if m.config.ImpersonateServiceAccount == "" {
+		return creds.TokenSource, nil
+	}
+
+	tokenSource, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+		TargetPrincipal: m.config.ImpersonateServiceAccount,
+		Scopes:          scopes,
+	}, option.WithTokenSource(creds.TokenSource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to impersonate service account %s: %w", m.config.ImpersonateServiceAccount, err)
+	}
+	return tokenSource, nil
+}
+
+// newKubernetesTokenSource returns the token source for the Kubernetes API server: ID tokens
+// for KubernetesAudience when set, otherwise access tokens with KubernetesScopes. It returns
+// nil when neither is set, in which case the GCP API token source is used.
+func (m *GCPClientManager) newKubernetesTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	switch {
+	case m.config.KubernetesAudience != "":
+		return m.idTokenSource(ctx, m.config.KubernetesAudience)
+	case len(m.config.KubernetesScopes) > 0:
+		return m.scopedTokenSource(ctx, m.config.KubernetesScopes)
+	default:
+		return nil, nil
+	}
+}
+
+// idTokenSource returns a source of ID tokens restricted to audience, minted for the
+// impersonated service account when one is configured
+func (m *GCPClientManager) idTokenSource(ctx context.Context, audience string) (oauth2.TokenSource, error) {
+	creds, err := m.loadCredentials(ctx, container.DefaultAuthScopes())
+	if err != nil {
+		return nil, err
+	}
+
+	if m.config.ImpersonateServiceAccount != "" {
+		tokenSource, err := impersonate.IDTokenSource(ctx, impersonate.IDTokenConfig{
+			Audience:        audience,
+			TargetPrincipal: m.config.ImpersonateServiceAccount,
+			IncludeEmail:    true,
+		}, option.WithTokenSource(creds.TokenSource))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ID token source for %s: %w", m.config.ImpersonateServiceAccount, err)
+		}
+		return tokenSource, nil
+	}
+
+	tokenSource, err := idtoken.NewTokenSource(ctx, audience, option.WithCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ID token source (audience-restricted tokens need service account credentials or impersonation): %w", err)
+	}
+	return tokenSource, nil
+}
+
+// refreshToken replaces the Kubernetes token source with a new one, so the next token is
+// minted rather than served from the cache, and returns a token from it
+func (m *GCPClientManager) refreshToken(ctx context.Context) (*oauth2.Token, error) {
+	tokenSource, err := m.newKubernetesTokenSource(context.Background())
+	if err == nil && tokenSource == nil {
+		tokenSource, err = m.scopedTokenSource(context.Background(), container.DefaultAuthScopes())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var token *oauth2.Token
+	err = runPhase(ctx, PhaseAuth, func(context.Context) error {
+		var err error
+		token, err = tokenSource.Token()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access token: %w", err)
+	}
+	m.kubernetesTokenSource = tokenSource
+	return token, nil
+}
+
+// TokenSource returns the OAuth2 token source of the GCP API clients
+func (m *GCPClientManager) TokenSource() oauth2.TokenSource {
+	return m.tokenSource
+}
+
+// gcpRESTOptions returns client options authenticating Google REST API clients, such as
+// Cloud Storage and Resource Manager, with tokenSource over an HTTP client recording their
+// calls in the audit log and subject to read-only mode
+func gcpRESTOptions(tokenSource oauth2.TokenSource) []option.ClientOption {
+	base := cloudAuditTransport{api: "gcp", next: gcpReadOnlyTransport{next: http.DefaultTransport}}
+	transport := &oauth2.Transport{Source: tokenSource, Base: base}
+	return []option.ClientOption{option.WithHTTPClient(&http.Client{Transport: transport})}
+}
+
+// KubernetesTokenSource returns the token source used for the Kubernetes API server
+func (m *GCPClientManager) KubernetesTokenSource() oauth2.TokenSource {
+	return m.kubernetesTokenSource
+}
+
 // validateConfig validates the GCP configuration
 func (m *GCPClientManager) validateConfig() error {
 	if m.config.ProjectID == "" {
@@ -120,7 +296,7 @@ func (m *GCPClientManager) validateCredentials(ctx context.Context) error {
 		return fmt.Errorf("failed to validate GCP credentials: %w", err)
 	}
 
-	fmt.Printf("GCP Credentials Validated for project: %s\n", m.config.ProjectID)
+	Verbosef("GCP Credentials Validated for project: %s", m.config.ProjectID)
 	return nil
 }
 
@@ -129,6 +305,11 @@ func (m *GCPClientManager) GetGKEClient() *container.ClusterManagerClient {
 	return m.gkeClient
 }
 
+// GetStorageClient returns the Cloud Storage client
+func (m *GCPClientManager) GetStorageClient() *storage.Client {
+	return m.storageClient
+}
+
 // GetProjectID returns the configured project ID
 func (m *GCPClientManager) GetProjectID() string {
 	return m.config.ProjectID
@@ -159,84 +340,179 @@ func (m *GCPClientManager) Close() error {
 	return err
 }
 
+// GKEEndpointPreference selects which GKE control plane endpoint to connect to
+type GKEEndpointPreference string
+
+const (
+	// GKEEndpointAuto uses the IP endpoint unless the cluster has IP endpoints disabled
+	GKEEndpointAuto GKEEndpointPreference = "auto"
+	// GKEEndpointIP uses the control plane IP address, validated against the cluster CA
+	GKEEndpointIP GKEEndpointPreference = "ip"
+	// GKEEndpointDNS uses the DNS-based endpoint (*.gke.goog), which serves a publicly trusted certificate
+	GKEEndpointDNS GKEEndpointPreference = "dns"
+)
+
+// GKEClientOptions holds per-cluster connection options for GKE
+type GKEClientOptions struct {
+	Endpoint GKEEndpointPreference
+	// DeferKubernetes skips connecting to the Kubernetes API server in the constructor, so
+	// cloud-only operations work while it is unreachable; see ConnectKubernetes
+	DeferKubernetes bool
+	// WaitForReady is how long connecting waits for a cluster that is being created or updated
+	// to become ready, polling with backoff; zero fails immediately
+	WaitForReady time.Duration
+	// UserAgent overrides DefaultUserAgent in Kubernetes API requests
+	UserAgent string
+	// Headers are added to every Kubernetes API request, e.g. for an API gateway in front of
+	// the API server
+	Headers map[string]string
+	// Impersonate makes Kubernetes API requests act as another user and groups, e.g. to verify
+	// what they can see; the connecting identity needs the impersonate RBAC verb
+	Impersonate rest.ImpersonationConfig
+}
+
 // GKEClient wraps the GKE and Kubernetes clients with improved GCP configuration
 type GKEClient struct {
 	gcpClientManager *GCPClientManager
+	k8sMu            sync.Mutex // guards k8sClient and restConfig
 	k8sClient        *kubernetes.Clientset
+	restConfig       *rest.Config
 	clusterName      string
+	options          GKEClientOptions
 }
 
 func NewGKEClient(clusterName string, gcpConfig GCPConfig) (*GKEClient, error) {
+	return NewGKEClientWithOptions(clusterName, gcpConfig, GKEClientOptions{})
+}
+
+// NewGKEClientWithOptions creates a new GKE client with per-cluster connection options
+func NewGKEClientWithOptions(clusterName string, gcpConfig GCPConfig, opts GKEClientOptions) (*GKEClient, error) {
+	if opts.Endpoint == "" {
+		opts.Endpoint = GKEEndpointAuto
+	}
+
 	// Create GCP client manager
 	clientManager, err := NewGCPClientManager(gcpConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create GCP client manager: %w", err)
 	}
 
+	if gcpConfig.Zone == "" {
+		zone, err := locateGKECluster(context.Background(), clientManager.GetGKEClient(), clientManager.GetProjectID(), clusterName)
+		if err != nil {
+			clientManager.Close()
+			return nil, err
+		}
+		clientManager.config.Zone = zone
+	}
+
 	client := &GKEClient{
 		gcpClientManager: clientManager,
 		clusterName:      clusterName,
+		options:          opts,
 	}
 
-	// Initialize Kubernetes client
-	if err := client.initKubernetesClient(); err != nil {
-		clientManager.Close()
-		return nil, fmt.Errorf("failed to initialize Kubernetes client: %w", err)
+	if !opts.DeferKubernetes {
+		if err := client.ConnectKubernetes(context.Background()); err != nil {
+			clientManager.Close()
+			return nil, err
+		}
 	}
 
 	return client, nil
 }
 
-// initKubernetesClient initializes the Kubernetes client using GKE cluster info
-func (c *GKEClient) initKubernetesClient() error {
-	ctx := context.Background()
+// ConnectKubernetes connects to the cluster's API server unless already connected. A failed
+// attempt is retried by the next call.
+func (c *GKEClient) ConnectKubernetes(ctx context.Context) error {
+	c.k8sMu.Lock()
+	defer c.k8sMu.Unlock()
+	if c.k8sClient != nil {
+		return nil
+	}
+	if err := c.initKubernetesClient(ctx); err != nil {
+		return fmt.Errorf("failed to initialize Kubernetes client: %w", err)
+	}
+	return nil
+}
 
+// gkeClusterState classifies a GKE cluster status; PROVISIONING and RECONCILING clusters become
+// RUNNING on their own
+func gkeClusterState(status containerpb.Cluster_Status) clusterState {
+	return clusterState{
+		Status:       status.String(),
+		Ready:        status == containerpb.Cluster_RUNNING,
+		Transitional: status == containerpb.Cluster_PROVISIONING || status == containerpb.Cluster_RECONCILING,
+	}
+}
+
+// initKubernetesClient initializes the Kubernetes client using GKE cluster info
+func (c *GKEClient) initKubernetesClient(ctx context.Context) error {
 	// Get GKE cluster information
-	clusterPath := fmt.Sprintf("projects/%s/locations/%s/clusters/%s", c.gcpClientManager.GetProjectID(), c.gcpClientManager.GetZone(), c.clusterName)
+	clusterPath := c.clusterPath()
 	clusterReq := &containerpb.GetClusterRequest{
 		Name: clusterPath,
 	}
 
-	fmt.Println("clusterPath", clusterPath)
-
-	cluster, err := c.gcpClientManager.GetGKEClient().GetCluster(ctx, clusterReq)
-	if err != nil {
-		return fmt.Errorf("failed to get GKE cluster: %w", err)
-	}
-
-	if cluster.Status != containerpb.Cluster_RUNNING {
-		return fmt.Errorf("cluster %s is not running, current status: %s", c.clusterName, cluster.Status.String())
-	}
+	Debugf("Getting cluster %s", clusterPath)
 
-	// Decode the certificate authority data
-	caCert, err := base64.StdEncoding.DecodeString(cluster.MasterAuth.ClusterCaCertificate)
+	var cluster *containerpb.Cluster
+	err := pollClusterReady(ctx, ProviderGKE, c.clusterName, c.options.WaitForReady, func(ctx context.Context) (clusterState, error) {
+		step := progress.Start(fmt.Sprintf("Getting GKE cluster %s", c.clusterName))
+		var err error
+		cluster, err = c.gcpClientManager.GetGKEClient().GetCluster(ctx, clusterReq)
+		step.Done()
+		if err != nil {
+			return clusterState{}, fmt.Errorf("failed to get GKE cluster: %w", err)
+		}
+		return gkeClusterState(cluster.Status), nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to decode certificate authority data: %w", err)
+		return err
 	}
 
-	// Get Google Cloud credentials for authentication
-	creds, err := google.FindDefaultCredentials(ctx, container.DefaultAuthScopes()...)
+	host, caCert, err := c.selectEndpoint(cluster)
 	if err != nil {
-		return fmt.Errorf("failed to get Google Cloud credentials: %w", err)
+		return err
 	}
 
-	// Get OAuth2 token source
-	tokenSource := creds.TokenSource
+	// Authenticate to the API server with the configured credentials; the scopes or audience
+	// of its tokens may differ from those of the GKE API
+	tokenSource := c.gcpClientManager.KubernetesTokenSource()
 
 	// Get an access token
-	token, err := tokenSource.Token()
+	step := progress.Start("Acquiring Google access token")
+	var token *oauth2.Token
+	err = runPhase(ctx, PhaseAuth, func(context.Context) error {
+		var err error
+		token, err = tokenSource.Token()
+		return err
+	})
+	step.Done()
 	if err != nil {
 		return fmt.Errorf("failed to get access token: %w", err)
 	}
 
 	// Create Kubernetes client configuration
 	kubeConfig := &rest.Config{
-		Host:        fmt.Sprintf("https://%s", cluster.Endpoint),
+		Host:        host,
 		BearerToken: token.AccessToken,
 		TLSClientConfig: rest.TLSClientConfig{
 			CAData: caCert,
 		},
 	}
+	applyRequestHeaders(kubeConfig, c.options.UserAgent, c.options.Headers)
+	applyReadOnlyGuard(kubeConfig)
+	applyAuditLog(kubeConfig, c.Identity)
+	kubeConfig.Impersonate = c.options.Impersonate
+	applyKubernetesTimeout(kubeConfig)
+	applyTokenRefresh(kubeConfig, func(ctx context.Context) (string, error) {
+		token, err := c.gcpClientManager.refreshToken(ctx)
+		if err != nil {
+			return "", err
+		}
+		return token.AccessToken, nil
+	})
 
 	// Create Kubernetes clientset
 	clientset, err := kubernetes.NewForConfig(kubeConfig)
@@ -245,54 +521,288 @@ func (c *GKEClient) initKubernetesClient() error {
 	}
 
 	c.k8sClient = clientset
+	c.restConfig = kubeConfig
 	return nil
 }
 
+// selectEndpoint chooses between the IP and DNS-based control plane endpoints according to
+// the cluster configuration and the endpoint preference, returning the host and the CA to
+// validate it with (nil for the DNS endpoint, whose certificate is publicly trusted)
+func (c *GKEClient) selectEndpoint(cluster *containerpb.Cluster) (string, []byte, error) {
+	var dnsEndpoint string
+	dnsExternal := false
+	ipEnabled := true
+	if endpoints := cluster.GetControlPlaneEndpointsConfig(); endpoints != nil {
+		if dns := endpoints.GetDnsEndpointConfig(); dns != nil {
+			dnsEndpoint = dns.GetEndpoint()
+			dnsExternal = dns.GetAllowExternalTraffic()
+		}
+		if ip := endpoints.GetIpEndpointsConfig(); ip != nil && ip.Enabled != nil {
+			ipEnabled = ip.GetEnabled()
+		}
+	}
+
+	useDNS := false
+	switch c.options.Endpoint {
+	case GKEEndpointDNS:
+		if dnsEndpoint == "" {
+			return "", nil, fmt.Errorf("cluster %s has no DNS-based control plane endpoint", c.clusterName)
+		}
+		useDNS = true
+	case GKEEndpointIP:
+		if !ipEnabled {
+			return "", nil, fmt.Errorf("cluster %s has IP-based control plane endpoints disabled; use the DNS endpoint", c.clusterName)
+		}
+	case GKEEndpointAuto:
+		useDNS = !ipEnabled && dnsEndpoint != ""
+	default:
+		return "", nil, fmt.Errorf("unknown GKE endpoint preference %q (expected auto, ip or dns)", c.options.Endpoint)
+	}
+
+	if useDNS {
+		if !dnsExternal {
+			Warnf("DNS endpoint does not allow external traffic; it is only reachable from inside the VPC")
+		}
+		Infof("Using DNS-based control plane endpoint %s", dnsEndpoint)
+		return fmt.Sprintf("https://%s", dnsEndpoint), nil, nil
+	}
+
+	// Decode the certificate authority data
+	caCert, err := base64.StdEncoding.DecodeString(cluster.MasterAuth.ClusterCaCertificate)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode certificate authority data: %w", err)
+	}
+
+	if !ipEnabled || cluster.Endpoint == "" {
+		return "", nil, fmt.Errorf("cluster %s has no IP-based control plane endpoint", c.clusterName)
+	}
+	return fmt.Sprintf("https://%s", cluster.Endpoint), caCert, nil
+}
+
 // GetClusterInfo returns basic information about the GKE cluster
-func (c *GKEClient) GetClusterInfo() error {
+func (c *GKEClient) GetClusterInfo() (*ClusterInfo, error) {
 	ctx := context.Background()
 
-	clusterPath := fmt.Sprintf("projects/%s/locations/%s/clusters/%s", c.gcpClientManager.GetProjectID(), c.gcpClientManager.GetZone(), c.clusterName)
+	clusterPath := c.clusterPath()
 	clusterReq := &containerpb.GetClusterRequest{
 		Name: clusterPath,
 	}
 
 	cluster, err := c.gcpClientManager.GetGKEClient().GetCluster(ctx, clusterReq)
 	if err != nil {
-		return fmt.Errorf("failed to get cluster info: %w", err)
+		return nil, fmt.Errorf("failed to get cluster info: %w", err)
 	}
 
-	fmt.Printf("GKE Cluster Information:\n")
-	fmt.Printf("  Name: %s\n", cluster.Name)
-	fmt.Printf("  Status: %s\n", cluster.Status.String())
-	fmt.Printf("  Location: %s\n", cluster.Location)
-	fmt.Printf("  Current Version: %s\n", cluster.CurrentMasterVersion)
-	fmt.Printf("  Endpoint: %s\n", cluster.Endpoint)
-	fmt.Printf("  Created: %s\n", cluster.CreateTime)
-	fmt.Printf("  Network: %s\n", cluster.Network)
-	fmt.Printf("  Subnetwork: %s\n", cluster.Subnetwork)
+	info := &ClusterInfo{
+		Name:      cluster.Name,
+		Provider:  ProviderGKE,
+		Account:   c.gcpClientManager.GetProjectID(),
+		Region:    cluster.Location,
+		Version:   cluster.CurrentMasterVersion,
+		Endpoint:  cluster.Endpoint,
+		Status:    cluster.Status.String(),
+		NodeCount: int(cluster.CurrentNodeCount),
+		Network:   cluster.Network,
+		Details:   map[string]string{"Subnetwork": cluster.Subnetwork},
+	}
 
-	return nil
+	if created, err := time.Parse(time.RFC3339, cluster.CreateTime); err == nil {
+		info.CreatedAt = created
+	}
+
+	var interruptible []string
+	for _, pool := range cluster.NodePools {
+		switch {
+		case pool.GetConfig().GetSpot():
+			interruptible = append(interruptible, pool.Name+" (spot)")
+		case pool.GetConfig().GetPreemptible():
+			interruptible = append(interruptible, pool.Name+" (preemptible)")
+		}
+	}
+	if len(interruptible) > 0 {
+		info.Details["Interruptible Node Pools"] = strings.Join(interruptible, ", ")
+	}
+
+	if len(cluster.ResourceLabels) > 0 {
+		info.Tags = cluster.ResourceLabels
+	}
+
+	info.Maintenance = gkeMaintenanceInfo(cluster, time.Now())
+	info.ReleaseChannel = "none"
+	if channel := cluster.GetReleaseChannel().GetChannel(); channel != containerpb.ReleaseChannel_UNSPECIFIED {
+		info.ReleaseChannel = channel.String()
+	}
+
+	return info, nil
+}
+
+// gkeMaintenanceInfo summarizes the release channel, maintenance policy and upgrade notifications
+func gkeMaintenanceInfo(cluster *containerpb.Cluster, now time.Time) *MaintenanceInfo {
+	info := &MaintenanceInfo{Channel: "none (static version)"}
+	if channel := cluster.GetReleaseChannel().GetChannel(); channel != containerpb.ReleaseChannel_UNSPECIFIED {
+		info.Channel = channel.String()
+	}
+
+	window := cluster.GetMaintenancePolicy().GetWindow()
+	if daily := window.GetDailyMaintenanceWindow(); daily != nil {
+		entry := MaintenanceWindow{Schedule: fmt.Sprintf("daily at %s UTC", daily.StartTime)}
+		if start, err := time.Parse("15:04", daily.StartTime); err == nil {
+			duration, err := parseISODuration(daily.Duration)
+			if err != nil {
+				duration = 4 * time.Hour // GKE daily windows are four hours long
+			}
+			first := time.Date(now.Year(), now.Month(), now.Day(), start.Hour(), start.Minute(), 0, 0, time.UTC).AddDate(0, 0, -1)
+			if next, ok := nextRecurrence(first, duration, "FREQ=DAILY", now); ok {
+				entry.Start, entry.End = next, next.Add(duration)
+			}
+		}
+		info.Windows = append(info.Windows, entry)
+	}
+	if recurring := window.GetRecurringWindow(); recurring != nil {
+		entry := MaintenanceWindow{Schedule: recurring.GetRecurrence()}
+		start := recurring.GetWindow().GetStartTime().AsTime()
+		end := recurring.GetWindow().GetEndTime().AsTime()
+		if next, ok := nextRecurrence(start, end.Sub(start), recurring.GetRecurrence(), now); ok {
+			entry.Start, entry.End = next, next.Add(end.Sub(start))
+		}
+		info.Windows = append(info.Windows, entry)
+	}
+
+	names := make([]string, 0, len(window.GetMaintenanceExclusions()))
+	for name := range window.GetMaintenanceExclusions() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		exclusion := window.GetMaintenanceExclusions()[name]
+		entry := MaintenanceWindow{
+			Name:  name,
+			Start: exclusion.GetStartTime().AsTime(),
+			End:   exclusion.GetEndTime().AsTime(),
+		}
+		if options := exclusion.GetMaintenanceExclusionOptions(); options != nil {
+			entry.Schedule = options.GetScope().String()
+		}
+		if entry.End.Before(now) {
+			continue
+		}
+		info.Exclusions = append(info.Exclusions, entry)
+	}
+
+	info.Notifications = "disabled"
+	if pubsub := cluster.GetNotificationConfig().GetPubsub(); pubsub.GetEnabled() {
+		info.Notifications = "Pub/Sub " + pubsub.GetTopic()
+		if events := pubsub.GetFilter().GetEventType(); len(events) > 0 {
+			types := make([]string, 0, len(events))
+			for _, event := range events {
+				types = append(types, event.String())
+			}
+			info.Notifications += " (" + strings.Join(types, ", ") + ")"
+		}
+	}
+
+	return info
 }
 
-// ListPods lists all pods in the kube-system namespace
+// ListPods lists all pods in the kube-system namespace, page by page
 func (c *GKEClient) ListPods() error {
-	namespace := "kube-system"
+	if err := c.ConnectKubernetes(context.TODO()); err != nil {
+		return err
+	}
+	return printPods(context.TODO(), c.Clientset(), "kube-system")
+}
 
-	pods, err := c.k8sClient.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
+// gkeTaintEffects maps Kubernetes taint effects to their GKE API values
+var gkeTaintEffects = map[corev1.TaintEffect]containerpb.NodeTaint_Effect{
+	corev1.TaintEffectNoSchedule:       containerpb.NodeTaint_NO_SCHEDULE,
+	corev1.TaintEffectPreferNoSchedule: containerpb.NodeTaint_PREFER_NO_SCHEDULE,
+	corev1.TaintEffectNoExecute:        containerpb.NodeTaint_NO_EXECUTE,
+}
+
+// CreateNodePool creates a node pool and waits for the operation to finish. spec.Count is the
+// number of nodes in each of the cluster's zones.
+func (c *GKEClient) CreateNodePool(ctx context.Context, spec NodePoolSpec) error {
+	var taints []*containerpb.NodeTaint
+	for _, taint := range spec.Taints {
+		taints = append(taints, &containerpb.NodeTaint{Key: taint.Key, Value: taint.Value, Effect: gkeTaintEffects[taint.Effect]})
+	}
+	pool := &containerpb.NodePool{
+		Name:             spec.Name,
+		InitialNodeCount: spec.Count,
+		Config: &containerpb.NodeConfig{
+			MachineType: spec.MachineType,
+			Labels:      spec.Labels,
+			Taints:      taints,
+		},
+	}
+	if spec.Autoscaling != nil {
+		pool.Autoscaling = &containerpb.NodePoolAutoscaling{
+			Enabled:      true,
+			MinNodeCount: spec.Autoscaling.Min,
+			MaxNodeCount: spec.Autoscaling.Max,
+		}
+	}
+
+	op, err := c.gcpClientManager.GetGKEClient().CreateNodePool(ctx, &containerpb.CreateNodePoolRequest{
+		Parent:   c.clusterPath(),
+		NodePool: pool,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to list pods in namespace %s: %w", namespace, err)
+		return fmt.Errorf("failed to create node pool %s: %w", spec.Name, err)
 	}
+	return c.waitForOperation(ctx, op)
+}
 
-	fmt.Printf("\nPods in namespace '%s' (%d total):\n", namespace, len(pods.Items))
-	for _, pod := range pods.Items {
-		fmt.Printf("  Name: %s\n", pod.Name)
-		fmt.Printf("    Status: %s\n", pod.Status.Phase)
-		fmt.Printf("    Node: %s\n", pod.Spec.NodeName)
-		fmt.Printf("    Created: %s\n", pod.CreationTimestamp.Format(time.RFC3339))
-		fmt.Println()
+// DeleteNodePool deletes a node pool and waits for the operation to finish
+func (c *GKEClient) DeleteNodePool(ctx context.Context, name string) error {
+	op, err := c.gcpClientManager.GetGKEClient().DeleteNodePool(ctx, &containerpb.DeleteNodePoolRequest{
+		Name: fmt.Sprintf("%s/nodePools/%s", c.clusterPath(), name),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete node pool %s: %w", name, err)
+	}
+	return c.waitForOperation(ctx, op)
+}
+
+// UpgradeControlPlane updates the master version and waits for the operation to finish
+func (c *GKEClient) UpgradeControlPlane(ctx context.Context, target string) error {
+	op, err := c.gcpClientManager.GetGKEClient().UpdateMaster(ctx, &containerpb.UpdateMasterRequest{
+		Name:          c.clusterPath(),
+		MasterVersion: target,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start upgrade: %w", err)
 	}
+	return c.waitForOperation(ctx, op)
+}
+
+// clusterPath returns the resource name of the cluster in the GKE API
+func (c *GKEClient) clusterPath() string {
+	return fmt.Sprintf("projects/%s/locations/%s/clusters/%s", c.GetProjectID(), c.GetZone(), c.clusterName)
+}
 
+// waitForOperation polls a GKE operation until it is done, returning its error if it failed
+func (c *GKEClient) waitForOperation(ctx context.Context, op *containerpb.Operation) error {
+	location := op.Location
+	if location == "" {
+		location = c.GetZone()
+	}
+	name := fmt.Sprintf("projects/%s/locations/%s/operations/%s", c.GetProjectID(), location, op.Name)
+	for op.Status != containerpb.Operation_DONE {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for operation %s: %w", op.Name, ctx.Err())
+		case <-time.After(10 * time.Second):
+		}
+		var err error
+		op, err = c.gcpClientManager.GetGKEClient().GetOperation(ctx, &containerpb.GetOperationRequest{Name: name})
+		if err != nil {
+			return fmt.Errorf("failed to get operation status: %w", err)
+		}
+	}
+	if message := op.GetError().GetMessage(); message != "" {
+		return fmt.Errorf("operation %s failed: %s", op.Name, message)
+	}
 	return nil
 }
 
@@ -306,40 +816,342 @@ func (c *GKEClient) GetZone() string {
 	return c.gcpClientManager.GetZone()
 }
 
+// GetClusterManagerClient returns the GKE API client, subject to the GKE rate limiter and cloud
+// API timeout. It is closed by Close.
+func (c *GKEClient) GetClusterManagerClient() *container.ClusterManagerClient {
+	return c.gcpClientManager.GetGKEClient()
+}
+
+// GetClientOptions returns the client options authenticating Google Cloud clients as this client
+// does, impersonation included
+func (c *GKEClient) GetClientOptions() []option.ClientOption {
+	return []option.ClientOption{option.WithTokenSource(c.gcpClientManager.TokenSource())}
+}
+
 // Close closes the GKE client connections
 func (c *GKEClient) Close() error {
 	return c.gcpClientManager.Close()
 }
 
-// RunGCPTest runs the GKE test client
-func RunGKETest() error {
-	err := godotenv.Load()
+// Identity returns the provider-neutral identity of the GKE cluster
+func (c *GKEClient) Identity() ClusterIdentity {
+	return ClusterIdentity{
+		Provider: ProviderGKE,
+		Account:  c.gcpClientManager.GetProjectID(),
+		Region:   c.gcpClientManager.GetZone(),
+		Name:     c.clusterName,
+	}
+}
+
+// kubernetesClients returns the clientset and rest.Config set by ConnectKubernetes, both nil
+// before it succeeds
+func (c *GKEClient) kubernetesClients() (*kubernetes.Clientset, *rest.Config) {
+	c.k8sMu.Lock()
+	defer c.k8sMu.Unlock()
+	return c.k8sClient, c.restConfig
+}
+
+// RESTConfig returns a copy of the authenticated rest.Config for the cluster's API server
+func (c *GKEClient) RESTConfig() *rest.Config {
+	_, config := c.kubernetesClients()
+	if config == nil {
+		return nil
+	}
+	return rest.CopyConfig(config)
+}
+
+// Clientset returns the typed Kubernetes clientset, or nil before ConnectKubernetes
+func (c *GKEClient) Clientset() kubernetes.Interface {
+	clientset, _ := c.kubernetesClients()
+	if clientset == nil {
+		return nil
+	}
+	return clientset
+}
+
+// Discovery returns the discovery client of the Kubernetes clientset, or nil before
+// ConnectKubernetes
+func (c *GKEClient) Discovery() discovery.DiscoveryInterface {
+	clientset, _ := c.kubernetesClients()
+	if clientset == nil {
+		return nil
+	}
+	return clientset.Discovery()
+}
+
+// Dynamic returns a dynamic client sharing the clientset's authentication
+func (c *GKEClient) Dynamic() (dynamic.Interface, error) {
+	_, config := c.kubernetesClients()
+	if config == nil {
+		return nil, ErrKubernetesNotConnected
+	}
+	client, err := dynamic.NewForConfig(config)
 	if err != nil {
-		log.Printf("Warning: .env file not found, using environment variables")
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	return client, nil
+}
+
+// BuildClientCmdAPIConfig returns an in-memory kubeconfig for the cluster using the
+// provider's naming convention, without writing credentials to disk
+func (c *GKEClient) BuildClientCmdAPIConfig() (*clientcmdapi.Config, error) {
+	return buildKubeconfig(c, defaultKubeconfigNames(c.Identity()))
+}
+
+// RawRequest sends a request to a non-resource path of the cluster's API server
+func (c *GKEClient) RawRequest(ctx context.Context, method, path string) ([]byte, error) {
+	return rawRequest(ctx, c, method, path)
+}
+
+// RegistryCredentials returns an OAuth access token of the GCP credentials for Artifact
+// Registry and Container Registry hosts. Other registries get nil.
+func (c *GKEClient) RegistryCredentials(ctx context.Context, registry string) (*RegistryAuth, error) {
+	if !gcrRegistryHost.MatchString(registry) {
+		return nil, nil
+	}
+	token, err := c.gcpClientManager.TokenSource().Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GCP access token: %w", err)
+	}
+	return &RegistryAuth{Username: "oauth2accesstoken", Password: token.AccessToken, Expiry: token.Expiry}, nil
+}
+
+// ClusterCIDRs returns the cluster's pod and service ranges, including the IPv6 service range of
+// dual-stack clusters
+func (c *GKEClient) ClusterCIDRs(ctx context.Context) (*ClusterCIDRs, error) {
+	clusterPath := c.clusterPath()
+	cluster, err := c.gcpClientManager.GetGKEClient().GetCluster(ctx, &containerpb.GetClusterRequest{Name: clusterPath})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster info: %w", err)
+	}
+	cidrs := &ClusterCIDRs{}
+	if cluster.ClusterIpv4Cidr != "" {
+		cidrs.PodCIDRs = append(cidrs.PodCIDRs, cluster.ClusterIpv4Cidr)
+	}
+	for _, cidr := range []string{cluster.ServicesIpv4Cidr, cluster.GetIpAllocationPolicy().GetServicesIpv6CidrBlock()} {
+		if cidr != "" {
+			cidrs.ServiceCIDRs = append(cidrs.ServiceCIDRs, cidr)
+		}
+	}
+	return cidrs, nil
+}
+
+// ClusterTraits reports whether the cluster runs in Autopilot mode
+func (c *GKEClient) ClusterTraits(ctx context.Context) (*ClusterTraits, error) {
+	cluster, err := c.gcpClientManager.GetGKEClient().GetCluster(ctx, &containerpb.GetClusterRequest{Name: c.clusterPath()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster info: %w", err)
+	}
+	return &ClusterTraits{Autopilot: cluster.GetAutopilot().GetEnabled()}, nil
+}
+
+// googleTokenInfoURL returns the account an OAuth access token was issued to
+const googleTokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+
+// Session reports the Google account of the GCP credentials and when the current access token
+// expires. Tokens are renewed by the token source when they expire, so the expiry matters for
+// credentials that cannot mint new ones, such as a static access token.
+func (c *GKEClient) Session(ctx context.Context) (*SessionInfo, error) {
+	token, err := c.gcpClientManager.TokenSource().Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GCP access token: %w", err)
+	}
+	session := &SessionInfo{Provider: ProviderGKE, Account: c.GetProjectID(), Expires: token.Expiry}
+
+	if account := c.gcpClientManager.config.ImpersonateServiceAccount; account != "" {
+		session.Identity = account
+		session.Source = "impersonated service account"
+		return session, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, googleTokenInfoURL+"?access_token="+url.QueryEscape(token.AccessToken), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := auditedHTTPClient("gcp").Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up GCP token info: %w", err)
+	}
+	defer resp.Body.Close()
+	var info struct {
+		Email string `json:"email"`
+	}
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+			return nil, fmt.Errorf("failed to decode GCP token info: %w", err)
+		}
+	}
+	session.Identity = info.Email
+	if session.Identity == "" {
+		// User credentials only reveal their email with the email scope
+		session.Identity = "unknown (token has no email scope)"
+	}
+	return session, nil
+}
+
+// gkeAccessRoles are the project roles outside roles/container.* that grant access to GKE clusters
+var gkeAccessRoles = map[string]bool{"roles/owner": true, "roles/editor": true, "roles/viewer": true}
+
+// CloudAccessMappings lists the project IAM bindings of roles/container.* roles and the basic
+// roles that include container permissions. GKE authenticates users and service accounts as
+// their email, and Google Groups for RBAC maps group members to the group's email.
+func (c *GKEClient) CloudAccessMappings(ctx context.Context) ([]AccessMapping, error) {
+	service, err := cloudresourcemanager.NewService(ctx, gcpRESTOptions(c.gcpClientManager.TokenSource())...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Resource Manager client: %w", err)
+	}
+	callCtx, cancel := withPhaseTimeout(ctx, PhaseCloudAPI)
+	defer cancel()
+	policy, err := service.Projects.GetIamPolicy(c.GetProjectID(), &cloudresourcemanager.GetIamPolicyRequest{
+		Options: &cloudresourcemanager.GetPolicyOptions{RequestedPolicyVersion: 3},
+	}).Context(callCtx).Do()
+	if err = phaseTimeoutError(callCtx, PhaseCloudAPI, err); err != nil {
+		return nil, fmt.Errorf("failed to get IAM policy of project %s: %w", c.GetProjectID(), err)
+	}
+
+	members := map[string]*AccessMapping{}
+	for _, binding := range policy.Bindings {
+		if !strings.HasPrefix(binding.Role, "roles/container.") && !gkeAccessRoles[binding.Role] {
+			continue
+		}
+		role := binding.Role
+		if binding.Condition != nil {
+			role += " (if " + binding.Condition.Title + ")"
+		}
+		for _, member := range binding.Members {
+			mapping := members[member]
+			if mapping == nil {
+				mapping = &AccessMapping{Source: "GCP IAM", Principal: member, Scope: "project " + c.GetProjectID()}
+				kind, email, _ := strings.Cut(member, ":")
+				switch kind {
+				case "user", "serviceAccount":
+					mapping.Username = email
+				case "group":
+					mapping.Groups = []string{email}
+				}
+				members[member] = mapping
+			}
+			mapping.Access = append(mapping.Access, role)
+		}
 	}
 
+	mappings := make([]AccessMapping, 0, len(members))
+	for _, mapping := range members {
+		sort.Strings(mapping.Access)
+		mappings = append(mappings, *mapping)
+	}
+	sortAccessMappings(mappings)
+	return mappings, nil
+}
+
+// newGKEClientFromEnv creates a GKE client from the GKE_*, GOOGLE_* and GCP_* environment variables
+func newGKEClientFromEnv(deferKubernetes bool) (*GKEClient, error) {
+	clusterName, gcpConfig, opts, err := gkeSettingsFromEnv(deferKubernetes)
+	if err != nil {
+		return nil, err
+	}
+
+	if gcpConfig.Zone != "" {
+		Infof("Connecting to GKE cluster '%s' in zone '%s' (project: %s)...", clusterName, gcpConfig.Zone, gcpConfig.ProjectID)
+	} else {
+		Infof("GKE_ZONE not set, searching project %s for GKE cluster '%s'...", gcpConfig.ProjectID, clusterName)
+	}
+
+	// Log configuration method being used
+	if len(gcpConfig.CredentialsJSON) > 0 {
+		Infof("Using service account JSON from environment variable")
+	} else if gcpConfig.CredentialsPath != "" {
+		Infof("Using service account file from GOOGLE_APPLICATION_CREDENTIALS")
+	} else {
+		Infof("Using application default credentials (gcloud auth, service accounts, etc.)")
+	}
+
+	// Create GKE client with improved GCP configuration
+	client, err := NewGKEClientWithOptions(clusterName, gcpConfig, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GKE client: %w", err)
+	}
+
+	return client, nil
+}
+
+// gkeSettingsFromEnv reads the cluster name, GCP configuration and client options of a GKE
+// client from the environment
+func gkeSettingsFromEnv(deferKubernetes bool) (string, GCPConfig, GKEClientOptions, error) {
 	// Get cluster details from environment variables
 	clusterName := os.Getenv("GKE_CLUSTER_NAME")
 	if clusterName == "" {
-		return fmt.Errorf("GKE_CLUSTER_NAME environment variable is required")
+		return "", GCPConfig{}, GKEClientOptions{}, fmt.Errorf("GKE_CLUSTER_NAME environment variable is required")
 	}
 
 	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
 	if projectID == "" {
-		return fmt.Errorf("GOOGLE_CLOUD_PROJECT environment variable is required")
+		return "", GCPConfig{}, GKEClientOptions{}, fmt.Errorf("GOOGLE_CLOUD_PROJECT environment variable is required")
 	}
 
+	// Without GKE_ZONE the client searches the project for the cluster
 	zone := os.Getenv("GKE_ZONE")
-	if zone == "" {
-		zone = GCPDefaultZone
-		fmt.Printf("GKE_ZONE not set, using default: %s\n", zone)
+	if zone != "" {
+		normalized, err := NormalizeLocation(ProviderGKE, zone, LocationAny)
+		if err != nil {
+			return "", GCPConfig{}, GKEClientOptions{}, fmt.Errorf("invalid GKE_ZONE: %w", err)
+		}
+		zone = normalized
 	}
 
 	// Create GCP configuration based on environment variables
 	gcpConfig := GCPConfig{
-		ProjectID:       projectID,
-		Zone:            zone,
-		CredentialsPath: os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"), // Optional: service account file
+		ProjectID:          projectID,
+		Zone:               zone,
+		KubernetesAudience: os.Getenv("GKE_K8S_AUDIENCE"),
+	}
+	if scopes := os.Getenv("GKE_K8S_SCOPES"); scopes != "" {
+		gcpConfig.KubernetesScopes = expandGCPScopes(strings.Split(scopes, ","))
+	}
+	if err := applyGCPCredentialsFromEnv(&gcpConfig); err != nil {
+		return "", GCPConfig{}, GKEClientOptions{}, err
+	}
+
+	opts := GKEClientOptions{
+		Endpoint:        GKEEndpointPreference(os.Getenv("GKE_ENDPOINT")),
+		DeferKubernetes: deferKubernetes,
+		WaitForReady:    waitForReady,
+		Impersonate:     impersonation,
+	}
+	userAgent, headers, err := requestHeadersFromEnv()
+	if err != nil {
+		return "", GCPConfig{}, GKEClientOptions{}, err
+	}
+	opts.UserAgent, opts.Headers = userAgent, headers
+	return clusterName, gcpConfig, opts, nil
+}
+
+// gcpScopePrefix is the prefix of Google OAuth scope URLs
+const gcpScopePrefix = "https://www.googleapis.com/auth/"
+
+// expandGCPScopes turns short scope names such as userinfo.email into scope URLs, dropping
+// empty entries
+func expandGCPScopes(scopes []string) []string {
+	var expanded []string
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		switch {
+		case scope == "":
+			continue
+		case strings.Contains(scope, "://"):
+			expanded = append(expanded, scope)
+		default:
+			expanded = append(expanded, gcpScopePrefix+scope)
+		}
+	}
+	return expanded
+}
+
+// applyGCPCredentialsFromEnv fills in the credentials from GOOGLE_APPLICATION_CREDENTIALS,
+// the base64 encoded GCP_CREDENTIALS_JSON or a mounted GCP_CREDENTIALS_JSON key, leaving them empty for application default credentials
+func applyGCPCredentialsFromEnv(cfg *GCPConfig) error {
+	cfg.CredentialsPath = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS") // Optional: service account file
+	if path, ok := credentialFile("GCP_CREDENTIALS_JSON"); ok && cfg.CredentialsPath == "" && os.Getenv("GCP_CREDENTIALS_JSON") == "" {
+		cfg.CredentialsPath = path // Raw JSON key mounted from a Secret
 	}
 
 	// Check for base64 encoded credentials in environment
@@ -355,36 +1167,36 @@ func RunGKETest() error {
 			return fmt.Errorf("invalid JSON in GCP_CREDENTIALS_JSON: %w", err)
 		}
 
-		gcpConfig.CredentialsJSON = credentialsJSON
+		cfg.CredentialsJSON = credentialsJSON
 	}
 
-	fmt.Printf("Connecting to GKE cluster '%s' in zone '%s' (project: %s)...\n", clusterName, zone, projectID)
+	return nil
+}
 
-	// Log configuration method being used
-	if len(gcpConfig.CredentialsJSON) > 0 {
-		fmt.Println("Using service account JSON from environment variable")
-	} else if gcpConfig.CredentialsPath != "" {
-		fmt.Printf("Using service account file: %s\n", gcpConfig.CredentialsPath)
-	} else {
-		fmt.Println("Using application default credentials (gcloud auth, service accounts, etc.)")
+// RunGCPTest runs the GKE test client
+func RunGKETest() error {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf("Warning: .env file not found, using environment variables")
 	}
 
-	// Create GKE client with improved GCP configuration
-	client, err := NewGKEClient(clusterName, gcpConfig)
+	client, err := newGKEClientFromEnv(false)
 	if err != nil {
-		return fmt.Errorf("failed to create GKE client: %w", err)
+		return err
 	}
 	defer client.Close()
 
-	fmt.Println("✓ Successfully connected to GKE cluster!")
+	Infof("✓ Successfully connected to GKE cluster!")
 
 	// Display GCP project information
 	fmt.Printf("Connected to GCP Project: %s\n", client.GetProjectID())
 	fmt.Printf("Cluster Zone: %s\n", client.GetZone())
 
 	// Get cluster information
-	if err := client.GetClusterInfo(); err != nil {
+	if info, err := client.GetClusterInfo(); err != nil {
 		log.Printf("Failed to get cluster info: %v", err)
+	} else {
+		PrintClusterInfo(info)
 	}
 
 	// List pods in kube-system namespace
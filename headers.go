@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+	"k8s.io/client-go/rest"
+)
+
+// toolName identifies the tool in the User-Agent of Kubernetes API requests
+const toolName = "connect-managed-k8s"
+
+// toolVersion is the released version, set with -ldflags "-X main.toolVersion=v1.2.3"; without
+// it the module version from the build info is used
+var toolVersion string
+
+// ToolVersion returns the version of this build, or "dev" for builds of a working tree
+func ToolVersion() string {
+	if toolVersion != "" {
+		return toolVersion
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
+// DefaultUserAgent is the User-Agent sent to Kubernetes API servers, naming the tool and its
+// version so requests can be traced in API server audit logs
+func DefaultUserAgent() string {
+	return fmt.Sprintf("%s/%s (%s/%s)", toolName, ToolVersion(), runtime.GOOS, runtime.GOARCH)
+}
+
+// ParseRequestHeaders parses comma-separated Name=Value pairs of extra HTTP headers, e.g.
+// "X-Team=payments,X-Gateway-Key=abc". Values cannot contain commas.
+func ParseRequestHeaders(value string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, headerValue, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid header %q (expected Name=Value)", pair)
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(headerValue)
+	}
+	if err := validateRequestHeaders(headers); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+// validateRequestHeaders checks header names and values, and refuses the headers set from the
+// cluster credentials
+func validateRequestHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return fmt.Errorf("invalid value for header %s", name)
+		}
+		switch canonical := http.CanonicalHeaderKey(name); {
+		case canonical == "Authorization", canonical == "User-Agent", canonical == "Impersonate-User",
+			canonical == "Impersonate-Group", canonical == "Impersonate-Uid", strings.HasPrefix(canonical, "Impersonate-Extra-"):
+			return fmt.Errorf("header %s cannot be set as an extra header", name)
+		}
+	}
+	return nil
+}
+
+// requestHeadersFromEnv reads the User-Agent override and extra headers of Kubernetes API
+// requests from K8S_USER_AGENT and K8S_HEADERS
+func requestHeadersFromEnv() (string, map[string]string, error) {
+	headers, err := ParseRequestHeaders(os.Getenv("K8S_HEADERS"))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid K8S_HEADERS: %w", err)
+	}
+	return os.Getenv("K8S_USER_AGENT"), headers, nil
+}
+
+// applyRequestHeaders sets the User-Agent of requests to the API server, DefaultUserAgent
+// unless userAgent overrides it, and adds headers to every request, for API gateways and
+// service meshes in front of the API server that require identification headers
+func applyRequestHeaders(config *rest.Config, userAgent string, headers map[string]string) {
+	if userAgent == "" {
+		userAgent = DefaultUserAgent()
+	}
+	config.UserAgent = userAgent
+	if len(headers) == 0 {
+		return
+	}
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &headerTransport{next: rt, headers: headers}
+	})
+}
+
+// headerTransport adds extra headers to each request
+type headerTransport struct {
+	next    http.RoundTripper
+	headers map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+	return t.next.RoundTrip(req)
+}
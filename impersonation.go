@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/client-go/rest"
+)
+
+// impersonation is the process-wide user and groups Kubernetes requests impersonate, installed
+// with ConfigureImpersonation and applied by the clients created from the environment and fleets
+var impersonation rest.ImpersonationConfig
+
+// ConfigureImpersonation sets the user, groups and UID Kubernetes requests impersonate; an empty
+// config disables impersonation
+func ConfigureImpersonation(config rest.ImpersonationConfig) {
+	impersonation = config
+}
+
+// ParseImpersonationFlags strips kubectl-style --as, --as-group (repeatable) and --as-uid from
+// args, each taking its value as "--as=user" or "--as user". Without the flags, K8S_AS,
+// K8S_AS_GROUPS (comma-separated) and K8S_AS_UID are used.
+func ParseImpersonationFlags(args []string) ([]string, rest.ImpersonationConfig, error) {
+	var config rest.ImpersonationConfig
+	set := false
+	flags := map[string]bool{"as": true, "as-group": true, "as-uid": true}
+	remaining, err := stripGlobalFlags(args, flags, func(name, value string, _ bool) error {
+		set = true
+		switch name {
+		case "as":
+			config.UserName = value
+		case "as-group":
+			config.Groups = append(config.Groups, value)
+		case "as-uid":
+			config.UID = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, rest.ImpersonationConfig{}, err
+	}
+
+	if !set {
+		config.UserName = os.Getenv("K8S_AS")
+		config.UID = os.Getenv("K8S_AS_UID")
+		for _, group := range strings.Split(os.Getenv("K8S_AS_GROUPS"), ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				config.Groups = append(config.Groups, group)
+			}
+		}
+	}
+	if err := validateImpersonation(config); err != nil {
+		return nil, rest.ImpersonationConfig{}, err
+	}
+	return remaining, config, nil
+}
+
+// validateImpersonation requires a user whenever groups or a UID are impersonated, as the API
+// server does
+func validateImpersonation(config rest.ImpersonationConfig) error {
+	if config.UserName == "" && (len(config.Groups) > 0 || config.UID != "") {
+		return fmt.Errorf("impersonating groups or a UID also requires a user (--as or K8S_AS)")
+	}
+	return nil
+}
+
+// impersonating describes the impersonated identity for log messages, or "" without one
+func impersonating(config rest.ImpersonationConfig) string {
+	if config.UserName == "" {
+		return ""
+	}
+	if len(config.Groups) == 0 {
+		return config.UserName
+	}
+	return fmt.Sprintf("%s (groups %s)", config.UserName, strings.Join(config.Groups, ", "))
+}
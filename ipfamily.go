@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// cidrUsageWarning is the share of a pod or service range in use at which ip-addressing warns
+	cidrUsageWarning = 0.8
+	// cidrExhaustionThreshold is the share of a pod or service range in use at which ip-addressing fails
+	cidrExhaustionThreshold = 0.9
+)
+
+// ClusterCIDRs are the pod and service ranges the cloud reports for a cluster
+type ClusterCIDRs struct {
+	PodCIDRs     []string `json:"podCIDRs,omitempty"`
+	ServiceCIDRs []string `json:"serviceCIDRs,omitempty"`
+	// PodsFromSubnets is set when pods take addresses from the node subnets (Amazon VPC CNI,
+	// Azure CNI without overlay) rather than from a pod CIDR
+	PodsFromSubnets bool `json:"podsFromSubnets,omitempty"`
+}
+
+// cidrReporter is implemented by clients that can read their cluster's pod and service ranges
+// from the cloud API
+type cidrReporter interface {
+	ClusterCIDRs(ctx context.Context) (*ClusterCIDRs, error)
+}
+
+// CIDRUsage is how much of a pod or service range is in use. Pod ranges are counted in node
+// ranges allocated from them, service ranges in ClusterIPs. Where pods take subnet addresses,
+// the pod entry counts pods against the pods the nodes can address.
+type CIDRUsage struct {
+	Kind     string `json:"kind"` // "pod" or "service"
+	CIDR     string `json:"cidr"` // "node subnets" when pods take subnet addresses
+	Used     int64  `json:"used"`
+	Capacity int64  `json:"capacity"`
+	Unit     string `json:"unit"` // "node ranges", "addresses" or "pod addresses"
+}
+
+// Fraction is the share of the range in use
+func (u CIDRUsage) Fraction() float64 {
+	if u.Capacity <= 0 {
+		return 0
+	}
+	return float64(u.Used) / float64(u.Capacity)
+}
+
+// NodePodUsage is the pods with their own IP on a node against the node's pod capacity, which
+// with the Amazon VPC CNI and Azure CNI is bounded by the addresses the node can attach
+type NodePodUsage struct {
+	Node     string `json:"node"`
+	Pool     string `json:"pool"`
+	Pods     int64  `json:"pods"`
+	Capacity int64  `json:"capacity"`
+}
+
+// IPAddressingReport describes a cluster's IP families, the address family the client reaches
+// its API server over and how full its pod and service ranges are
+type IPAddressingReport struct {
+	Stack            string        `json:"stack"` // "IPv4", "IPv6" or "dual-stack"
+	ServiceFamilies  []string      `json:"serviceFamilies"`
+	PodFamilies      []string      `json:"podFamilies"`
+	NodeFamilies     []string      `json:"nodeFamilies"`
+	CIDRs            *ClusterCIDRs `json:"cidrs,omitempty"`
+	EndpointFamilies []string      `json:"endpointFamilies"`
+	ClientFamily     string        `json:"clientFamily,omitempty"`
+	Usage            []CIDRUsage   `json:"usage,omitempty"`
+	// NodePods is set when pods take subnet addresses, sorted by usage, fullest first
+	NodePods []NodePodUsage `json:"nodePods,omitempty"`
+	Warnings []string       `json:"warnings,omitempty"`
+}
+
+// addressFamily returns "IPv4" or "IPv6" for addr
+func addressFamily(addr netip.Addr) string {
+	if addr.Unmap().Is4() {
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
+// AnalyzeIPAddressing works out whether a cluster is IPv4, IPv6 or dual-stack from the
+// kubernetes Service, node pod ranges and node addresses, checks which family the client
+// connects to the API server over, and measures the usage of the pod and service ranges the
+// cloud reports
+func AnalyzeIPAddressing(ctx context.Context, client ClusterClient) (*IPAddressingReport, error) {
+	clientset := client.Clientset()
+	report := &IPAddressingReport{}
+
+	service, err := clientset.CoreV1().Services("default").Get(ctx, "kubernetes", metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the kubernetes Service: %w", err)
+	}
+	serviceFamilies := map[string]bool{}
+	for _, family := range service.Spec.IPFamilies {
+		serviceFamilies[string(family)] = true
+	}
+
+	podFamilies, nodeFamilies := map[string]bool{}, map[string]bool{}
+	var nodeRanges []netip.Prefix
+	nodePods := map[string]*NodePodUsage{}
+	err = EachNode(ctx, clientset, metav1.ListOptions{}, func(node *corev1.Node) error {
+		capacity := node.Status.Allocatable[corev1.ResourcePods]
+		nodePods[node.Name] = &NodePodUsage{Node: node.Name, Pool: nodePoolName(node), Capacity: capacity.Value()}
+		for _, cidr := range node.Spec.PodCIDRs {
+			if prefix, err := netip.ParsePrefix(cidr); err == nil {
+				podFamilies[addressFamily(prefix.Addr())] = true
+				nodeRanges = append(nodeRanges, prefix)
+			}
+		}
+		for _, address := range node.Status.Addresses {
+			if address.Type != corev1.NodeInternalIP {
+				continue
+			}
+			if addr, err := netip.ParseAddr(address.Address); err == nil {
+				nodeFamilies[addressFamily(addr)] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Without node pod ranges (VPC CNI, Azure CNI) the pod families come from pod IPs
+	rangesAllocated := len(podFamilies) > 0
+	err = EachPod(ctx, clientset, "", metav1.ListOptions{}, func(pod *corev1.Pod) error {
+		if pod.Spec.HostNetwork || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			return nil
+		}
+		if usage := nodePods[pod.Spec.NodeName]; usage != nil {
+			usage.Pods++
+		}
+		if !rangesAllocated {
+			for _, ip := range pod.Status.PodIPs {
+				if addr, err := netip.ParseAddr(ip.IP); err == nil {
+					podFamilies[addressFamily(addr)] = true
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var clusterIPs []netip.Addr
+	err = eachObject(ctx, "services", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.CoreV1().Services("").List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		for _, ip := range obj.(*corev1.Service).Spec.ClusterIPs {
+			if addr, err := netip.ParseAddr(ip); err == nil {
+				clusterIPs = append(clusterIPs, addr)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.ServiceFamilies = sortedSet(serviceFamilies)
+	report.PodFamilies = sortedSet(podFamilies)
+	report.NodeFamilies = sortedSet(nodeFamilies)
+	all := map[string]bool{}
+	for _, families := range []map[string]bool{serviceFamilies, podFamilies} {
+		for family := range families {
+			all[family] = true
+		}
+	}
+	switch {
+	case all["IPv4"] && all["IPv6"]:
+		report.Stack = "dual-stack"
+	case all["IPv6"]:
+		report.Stack = "IPv6"
+	default:
+		report.Stack = "IPv4"
+	}
+
+	if reporter, ok := client.(cidrReporter); ok {
+		cidrs, err := reporter.ClusterCIDRs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		report.CIDRs = cidrs
+		report.Usage = measureCIDRUsage(cidrs, nodeRanges, clusterIPs)
+		if cidrs.PodsFromSubnets {
+			report.NodePods, report.Usage = measureNodePodCapacity(nodePods, report.Usage)
+		}
+	}
+
+	probeEndpointFamily(ctx, report, client.RESTConfig().Host)
+	return report, nil
+}
+
+// measureCIDRUsage counts the node ranges allocated from each pod CIDR and the ClusterIPs in
+// each service CIDR
+func measureCIDRUsage(cidrs *ClusterCIDRs, nodeRanges []netip.Prefix, clusterIPs []netip.Addr) []CIDRUsage {
+	var usage []CIDRUsage
+	for _, cidr := range cidrs.PodCIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			continue
+		}
+		entry := CIDRUsage{Kind: "pod", CIDR: cidr, Unit: "node ranges"}
+		for _, nodeRange := range nodeRanges {
+			if prefix.Contains(nodeRange.Addr()) {
+				entry.Used++
+				entry.Capacity = prefixSize(nodeRange.Bits() - prefix.Bits())
+			}
+		}
+		if entry.Capacity > 0 {
+			usage = append(usage, entry)
+		}
+	}
+	for _, cidr := range cidrs.ServiceCIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			continue
+		}
+		// The first and last addresses of a service range are never assigned
+		entry := CIDRUsage{Kind: "service", CIDR: cidr, Unit: "addresses", Capacity: prefixSize(prefix.Addr().BitLen()-prefix.Bits()) - 2}
+		for _, ip := range clusterIPs {
+			if prefix.Contains(ip) {
+				entry.Used++
+			}
+		}
+		usage = append(usage, entry)
+	}
+	return usage
+}
+
+// measureNodePodCapacity sorts the nodes by pod capacity usage and adds a pod entry to usage
+// totalling the pods against the pods the nodes can address
+func measureNodePodCapacity(nodePods map[string]*NodePodUsage, usage []CIDRUsage) ([]NodePodUsage, []CIDRUsage) {
+	total := CIDRUsage{Kind: "pod", CIDR: "node subnets", Unit: "pod addresses"}
+	nodes := make([]NodePodUsage, 0, len(nodePods))
+	for _, node := range nodePods {
+		total.Used += node.Pods
+		total.Capacity += node.Capacity
+		nodes = append(nodes, *node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		// Compare pods/capacity without dividing: a/b > c/d ⇔ a·d > c·b
+		left, right := nodes[i].Pods*nodes[j].Capacity, nodes[j].Pods*nodes[i].Capacity
+		if left != right {
+			return left > right
+		}
+		return nodes[i].Node < nodes[j].Node
+	})
+	if total.Capacity > 0 {
+		usage = append(usage, total)
+	}
+	return nodes, usage
+}
+
+// prefixSize returns 2^bits, capped so IPv6 ranges do not overflow
+func prefixSize(bits int) int64 {
+	if bits > 62 {
+		bits = 62
+	}
+	if bits < 0 {
+		return 0
+	}
+	return int64(1) << bits
+}
+
+// probeEndpointFamily resolves the API server host and dials it the way the client does,
+// recording which address family the connection uses
+func probeEndpointFamily(ctx context.Context, report *IPAddressingReport, endpoint string) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("cannot parse API server endpoint: %v", err))
+		return
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	families := map[string]bool{}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil {
+		families[addressFamily(addr)] = true
+	} else {
+		addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("cannot resolve API server host %s: %v", u.Hostname(), err))
+			return
+		}
+		for _, addr := range addrs {
+			families[addressFamily(addr)] = true
+		}
+	}
+	report.EndpointFamilies = sortedSet(families)
+
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("cannot connect to the API server: %v", err))
+		return
+	}
+	defer conn.Close()
+	if remote, err := netip.ParseAddrPort(conn.RemoteAddr().String()); err == nil {
+		report.ClientFamily = addressFamily(remote.Addr())
+	}
+	if families["IPv6"] && report.ClientFamily == "IPv4" {
+		report.Warnings = append(report.Warnings, "the API server endpoint has an IPv6 address but the client fell back to IPv4; run nettest to diagnose the IPv6 path")
+	}
+}
+
+// CheckIPAddressing reports whether the cluster is IPv4, IPv6 or dual-stack, the address family
+// the client reaches the API server over and the usage of the pod and service ranges. It fails
+// when a range is nearly exhausted.
+func CheckIPAddressing(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "ip-addressing"}
+
+	report, err := AnalyzeIPAddressing(ctx, client)
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	result.Details = append(result.Details,
+		fmt.Sprintf("services: %s; pods: %s; nodes: %s", listOrNone(report.ServiceFamilies), listOrNone(report.PodFamilies), listOrNone(report.NodeFamilies)))
+	if report.CIDRs != nil && report.CIDRs.PodsFromSubnets {
+		result.Details = append(result.Details, "pods take addresses from the node subnets")
+	}
+	var exhausted, nearlyFull []string
+	for _, usage := range report.Usage {
+		mark := "✓"
+		switch {
+		case usage.Fraction() >= cidrExhaustionThreshold:
+			mark = "✗"
+			exhausted = append(exhausted, usage.Kind+" "+usage.CIDR)
+		case usage.Fraction() >= cidrUsageWarning:
+			mark = "⚠"
+			nearlyFull = append(nearlyFull, usage.Kind+" "+usage.CIDR)
+		}
+		label := usage.Kind + " CIDR " + usage.CIDR
+		if usage.CIDR == "node subnets" {
+			label = usage.Kind + " capacity of the nodes"
+		}
+		result.Details = append(result.Details, fmt.Sprintf("%s %s: %d/%d %s used (%.0f%%)",
+			mark, label, usage.Used, usage.Capacity, usage.Unit, usage.Fraction()*100))
+	}
+	fullNodes := 0
+	for _, node := range report.NodePods {
+		if node.Capacity > 0 && float64(node.Pods) >= cidrExhaustionThreshold*float64(node.Capacity) {
+			fullNodes++
+			result.Details = append(result.Details, fmt.Sprintf("    ⚠ node %s (%s): %d/%d pods", node.Node, node.Pool, node.Pods, node.Capacity))
+		}
+	}
+	if fullNodes > 0 {
+		result.Details = append(result.Details, fmt.Sprintf("⚠ %d node(s) can address few or no more pods; new pods need new nodes", fullNodes))
+	}
+	for _, warning := range report.Warnings {
+		result.Details = append(result.Details, "⚠ "+warning)
+	}
+
+	message := report.Stack + " cluster"
+	if report.ClientFamily != "" {
+		message += ", client connects over " + report.ClientFamily
+	}
+	if len(exhausted) > 0 {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%s; nearly exhausted: %s", message, strings.Join(exhausted, ", "))
+		return result
+	}
+	if len(nearlyFull) > 0 {
+		message += "; nearing exhaustion: " + strings.Join(nearlyFull, ", ")
+	}
+	result.Status = CheckPass
+	result.Message = message
+	return result
+}
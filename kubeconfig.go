@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/yaml"
+)
+
+// templatePlaceholderPattern matches {placeholder} tokens in a context name template
+var templatePlaceholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// contextNamePlaceholders lists the placeholders supported in context name templates
+var contextNamePlaceholders = []string{"{provider}", "{account}", "{region}", "{resourceGroup}", "{cluster}"}
+
+// KubeconfigNames holds the cluster, user and context entry names for an exported cluster
+type KubeconfigNames struct {
+	Cluster string
+	User    string
+	Context string
+}
+
+// KubeconfigNaming controls how exported kubeconfig entries are named
+type KubeconfigNaming struct {
+	// Template renders entry names from placeholders, e.g. "{provider}-{account}-{region}-{cluster}".
+	// When empty the provider's own naming convention is used.
+	Template string
+	// Aliases maps a cluster key (provider/account/scope/name) or a default context name to
+	// the name to use instead, taking precedence over Template
+	Aliases map[string]string
+}
+
+// MergeOptions controls how generated entries are merged into an existing kubeconfig
+type MergeOptions struct {
+	Force      bool // overwrite conflicting entries instead of failing
+	SetCurrent bool // switch current-context to the merged cluster
+	NoBackup   bool // skip the backup copy of the original file
+}
+
+// defaultKubeconfigNames returns the entry names each provider's own CLI uses,
+// so merged entries line up with those created by aws, gcloud and az
+func defaultKubeconfigNames(id ClusterIdentity) KubeconfigNames {
+	switch id.Provider {
+	case ProviderEKS:
+		arn := fmt.Sprintf("arn:aws:eks:%s:%s:cluster/%s", id.Region, id.Account, id.Name)
+		return KubeconfigNames{Cluster: arn, User: arn, Context: arn}
+	case ProviderGKE:
+		name := fmt.Sprintf("gke_%s_%s_%s", id.Account, id.Region, id.Name)
+		return KubeconfigNames{Cluster: name, User: name, Context: name}
+	case ProviderAKS:
+		return KubeconfigNames{
+			Cluster: id.Name,
+			User:    fmt.Sprintf("clusterUser_%s_%s", id.ResourceGroup, id.Name),
+			Context: id.Name,
+		}
+	default:
+		return KubeconfigNames{Cluster: id.Name, User: id.Name, Context: id.Name}
+	}
+}
+
+// Validate checks that the template only uses known placeholders
+func (n KubeconfigNaming) Validate() error {
+	for _, placeholder := range templatePlaceholderPattern.FindAllString(n.Template, -1) {
+		known := false
+		for _, p := range contextNamePlaceholders {
+			if placeholder == p {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown placeholder %s in name template (supported: %s)",
+				placeholder, strings.Join(contextNamePlaceholders, ", "))
+		}
+	}
+
+	for key, alias := range n.Aliases {
+		if alias == "" {
+			return fmt.Errorf("alias for %s is empty", key)
+		}
+	}
+
+	return nil
+}
+
+// Names returns the kubeconfig entry names for a cluster, applying aliases first,
+// then the template, and falling back to the provider's naming convention
+func (n KubeconfigNaming) Names(id ClusterIdentity) KubeconfigNames {
+	defaults := defaultKubeconfigNames(id)
+
+	if alias, ok := n.Aliases[id.Key()]; ok {
+		return KubeconfigNames{Cluster: alias, User: alias, Context: alias}
+	}
+	if alias, ok := n.Aliases[defaults.Context]; ok {
+		return KubeconfigNames{Cluster: alias, User: alias, Context: alias}
+	}
+
+	if n.Template == "" {
+		return defaults
+	}
+
+	name := strings.NewReplacer(
+		"{provider}", string(id.Provider),
+		"{account}", id.Account,
+		"{region}", id.Region,
+		"{resourceGroup}", id.ResourceGroup,
+		"{cluster}", id.Name,
+	).Replace(n.Template)
+
+	return KubeconfigNames{Cluster: name, User: name, Context: name}
+}
+
+// LoadKubeconfigAliases reads an alias map from a YAML or JSON file of key: alias pairs
+func LoadKubeconfigAliases(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alias file %s: %w", path, err)
+	}
+
+	aliases := map[string]string{}
+	if err := yaml.Unmarshal(data, &aliases); err != nil {
+		return nil, fmt.Errorf("failed to parse alias file %s: %w", path, err)
+	}
+
+	return aliases, nil
+}
+
+// buildKubeconfig builds a standalone kubeconfig for the connected cluster
+func buildKubeconfig(client ClusterClient, names KubeconfigNames) (*clientcmdapi.Config, error) {
+	restConfig := client.RESTConfig()
+	if restConfig == nil {
+		return nil, ErrKubernetesNotConnected
+	}
+
+	cluster := clientcmdapi.NewCluster()
+	cluster.Server = restConfig.Host
+	cluster.CertificateAuthorityData = restConfig.CAData
+	cluster.TLSServerName = restConfig.ServerName
+
+	user := clientcmdapi.NewAuthInfo()
+	user.Token = restConfig.BearerToken
+	user.Impersonate = restConfig.Impersonate.UserName
+	user.ImpersonateUID = restConfig.Impersonate.UID
+	user.ImpersonateGroups = restConfig.Impersonate.Groups
+
+	kubeContext := clientcmdapi.NewContext()
+	kubeContext.Cluster = names.Cluster
+	kubeContext.AuthInfo = names.User
+
+	config := clientcmdapi.NewConfig()
+	config.Clusters[names.Cluster] = cluster
+	config.AuthInfos[names.User] = user
+	config.Contexts[names.Context] = kubeContext
+	config.CurrentContext = names.Context
+
+	return config, nil
+}
+
+// NewClientCmdClientConfig wraps an in-memory kubeconfig in a clientcmd.ClientConfig, the
+// interface expected by Helm and kubectl's genericclioptions
+func NewClientCmdClientConfig(config *clientcmdapi.Config) clientcmd.ClientConfig {
+	return clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{})
+}
+
+// WriteKubeconfig writes a standalone kubeconfig to path
+func WriteKubeconfig(config *clientcmdapi.Config, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create kubeconfig directory: %w", err)
+	}
+
+	if err := clientcmd.WriteToFile(*config, path); err != nil {
+		return fmt.Errorf("failed to write kubeconfig %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// MergeKubeconfig merges the generated entries into the kubeconfig at path.
+// Entries that already exist with different content are reported as conflicts
+// unless opts.Force is set; the original file is backed up before it is rewritten.
+func MergeKubeconfig(generated *clientcmdapi.Config, path string, opts MergeOptions) error {
+	existing, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to load kubeconfig %s: %w", path, err)
+		}
+		existing = clientcmdapi.NewConfig()
+	}
+
+	conflicts := findKubeconfigConflicts(existing, generated)
+	if len(conflicts) > 0 && !opts.Force {
+		return fmt.Errorf("kubeconfig %s has conflicting entries (use --force to overwrite): %v", path, conflicts)
+	}
+
+	if _, err := os.Stat(path); err == nil && !opts.NoBackup {
+		backupPath, err := backupKubeconfig(path)
+		if err != nil {
+			return err
+		}
+		Infof("Backed up %s to %s", path, backupPath)
+	}
+
+	for name, cluster := range generated.Clusters {
+		existing.Clusters[name] = cluster
+	}
+	for name, user := range generated.AuthInfos {
+		existing.AuthInfos[name] = user
+	}
+	for name, kubeContext := range generated.Contexts {
+		existing.Contexts[name] = kubeContext
+	}
+
+	if opts.SetCurrent || existing.CurrentContext == "" {
+		existing.CurrentContext = generated.CurrentContext
+	}
+
+	return WriteKubeconfig(existing, path)
+}
+
+// findKubeconfigConflicts lists generated entries whose names are already used for something else.
+// User entries only conflict when the existing one is not token based, since tokens are
+// expected to be refreshed on every export.
+func findKubeconfigConflicts(existing, generated *clientcmdapi.Config) []string {
+	var conflicts []string
+
+	for name, cluster := range generated.Clusters {
+		if current, ok := existing.Clusters[name]; ok {
+			if current.Server != cluster.Server || string(current.CertificateAuthorityData) != string(cluster.CertificateAuthorityData) {
+				conflicts = append(conflicts, "cluster "+name)
+			}
+		}
+	}
+
+	for name := range generated.AuthInfos {
+		if current, ok := existing.AuthInfos[name]; ok {
+			if current.Exec != nil || current.AuthProvider != nil || len(current.ClientCertificateData) > 0 || current.ClientCertificate != "" {
+				conflicts = append(conflicts, "user "+name)
+			}
+		}
+	}
+
+	for name, kubeContext := range generated.Contexts {
+		if current, ok := existing.Contexts[name]; ok {
+			if current.Cluster != kubeContext.Cluster || current.AuthInfo != kubeContext.AuthInfo {
+				conflicts = append(conflicts, "context "+name)
+			}
+		}
+	}
+
+	sort.Strings(conflicts)
+	return conflicts
+}
+
+// backupKubeconfig copies the kubeconfig at path next to itself with a timestamp suffix
+func backupKubeconfig(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read kubeconfig for backup: %w", err)
+	}
+
+	backupPath := fmt.Sprintf("%s.bak-%s", path, time.Now().Format("20060102-150405"))
+	if err := os.WriteFile(backupPath, data, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write kubeconfig backup: %w", err)
+	}
+
+	return backupPath, nil
+}
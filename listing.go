@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/pager"
+)
+
+// DefaultListPageSize is the number of objects requested per page from the API server
+const DefaultListPageSize = 500
+
+// ListPageSize is the page size used by the list helpers; lower it for very large clusters
+var ListPageSize int64 = DefaultListPageSize
+
+// EachPod streams the pods in namespace (all namespaces when empty) page by page using
+// Limit/Continue, so only one page is held in memory at a time. If the continue token
+// expires mid-way the pager falls back to a full list.
+func EachPod(ctx context.Context, clientset kubernetes.Interface, namespace string, opts metav1.ListOptions, fn func(*corev1.Pod) error) error {
+	p := pager.New(pager.SimplePageFunc(func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.CoreV1().Pods(namespace).List(ctx, opts)
+	}))
+	p.PageSize = ListPageSize
+
+	err := p.EachListItem(ctx, opts, func(obj runtime.Object) error {
+		return fn(obj.(*corev1.Pod))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list pods in namespace %q: %w", namespace, err)
+	}
+	return nil
+}
+
+// ListPodsPaged collects the pods in namespace using paginated requests
+func ListPodsPaged(ctx context.Context, clientset kubernetes.Interface, namespace string, opts metav1.ListOptions) ([]corev1.Pod, error) {
+	var pods []corev1.Pod
+	err := EachPod(ctx, clientset, namespace, opts, func(pod *corev1.Pod) error {
+		pods = append(pods, *pod)
+		return nil
+	})
+	return pods, err
+}
+
+// EachNode streams the cluster's nodes page by page
+func EachNode(ctx context.Context, clientset kubernetes.Interface, opts metav1.ListOptions, fn func(*corev1.Node) error) error {
+	p := pager.New(pager.SimplePageFunc(func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.CoreV1().Nodes().List(ctx, opts)
+	}))
+	p.PageSize = ListPageSize
+
+	err := p.EachListItem(ctx, opts, func(obj runtime.Object) error {
+		return fn(obj.(*corev1.Node))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	return nil
+}
+
+// ListNodesPaged collects the cluster's nodes using paginated requests
+func ListNodesPaged(ctx context.Context, clientset kubernetes.Interface, opts metav1.ListOptions) ([]corev1.Node, error) {
+	var nodes []corev1.Node
+	err := EachNode(ctx, clientset, opts, func(node *corev1.Node) error {
+		nodes = append(nodes, *node)
+		return nil
+	})
+	return nodes, err
+}
+
+// EachDeployment streams the deployments in namespace (all namespaces when empty) page by page
+func EachDeployment(ctx context.Context, clientset kubernetes.Interface, namespace string, opts metav1.ListOptions, fn func(*appsv1.Deployment) error) error {
+	p := pager.New(pager.SimplePageFunc(func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.AppsV1().Deployments(namespace).List(ctx, opts)
+	}))
+	p.PageSize = ListPageSize
+
+	err := p.EachListItem(ctx, opts, func(obj runtime.Object) error {
+		return fn(obj.(*appsv1.Deployment))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list deployments in namespace %q: %w", namespace, err)
+	}
+	return nil
+}
+
+// PodFilter narrows a pod listing on the API server side, so only matching pods are transferred
+type PodFilter struct {
+	Namespace     string // empty for all namespaces
+	LabelSelector string // e.g. "app=web,tier!=cache"
+	NodeName      string // spec.nodeName
+	Phase         string // status.phase, e.g. Running or Pending
+	FieldSelector string // additional raw field selector
+}
+
+// ListOptions converts the filter into validated list options
+func (f PodFilter) ListOptions() (metav1.ListOptions, error) {
+	if _, err := labels.Parse(f.LabelSelector); err != nil {
+		return metav1.ListOptions{}, fmt.Errorf("invalid label selector %q: %w", f.LabelSelector, err)
+	}
+
+	var selectors []fields.Selector
+	if f.NodeName != "" {
+		selectors = append(selectors, fields.OneTermEqualSelector("spec.nodeName", f.NodeName))
+	}
+	if f.Phase != "" {
+		selectors = append(selectors, fields.OneTermEqualSelector("status.phase", f.Phase))
+	}
+	if f.FieldSelector != "" {
+		selector, err := fields.ParseSelector(f.FieldSelector)
+		if err != nil {
+			return metav1.ListOptions{}, fmt.Errorf("invalid field selector %q: %w", f.FieldSelector, err)
+		}
+		selectors = append(selectors, selector)
+	}
+
+	opts := metav1.ListOptions{LabelSelector: f.LabelSelector}
+	if len(selectors) > 0 {
+		opts.FieldSelector = fields.AndSelectors(selectors...).String()
+	}
+	return opts, nil
+}
+
+// printPods streams the pods in namespace to stdout as they are received
+func printPods(ctx context.Context, clientset kubernetes.Interface, namespace string) error {
+	return printFilteredPods(ctx, clientset, PodFilter{Namespace: namespace})
+}
+
+// printFilteredPods streams the pods matching filter to stdout as they are received
+func printFilteredPods(ctx context.Context, clientset kubernetes.Interface, filter PodFilter) error {
+	opts, err := filter.ListOptions()
+	if err != nil {
+		return err
+	}
+
+	if filter.Namespace == "" {
+		fmt.Printf("\nPods in all namespaces:\n")
+	} else {
+		fmt.Printf("\nPods in namespace '%s':\n", filter.Namespace)
+	}
+
+	total := 0
+	err = EachPod(ctx, clientset, filter.Namespace, opts, func(pod *corev1.Pod) error {
+		total++
+		if filter.Namespace == "" {
+			fmt.Printf("  Name: %s/%s\n", pod.Namespace, pod.Name)
+		} else {
+			fmt.Printf("  Name: %s\n", pod.Name)
+		}
+		fmt.Printf("    Status: %s\n", pod.Status.Phase)
+		fmt.Printf("    Node: %s\n", pod.Spec.NodeName)
+		fmt.Printf("    Created: %s\n", pod.CreationTimestamp.Format(time.RFC3339))
+		fmt.Println()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("(%d total)\n", total)
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DefaultLBProbeTimeout bounds each probe of a load balancer address
+const DefaultLBProbeTimeout = 5 * time.Second
+
+// LoadBalancerProbe is one external address of a LoadBalancer Service or Ingress, probed from
+// where the tool runs
+type LoadBalancerProbe struct {
+	Object  string // e.g. "service default/web" or "ingress shop/storefront"
+	Address string // IP or hostname assigned by the cloud load balancer
+	Port    int32
+	Scheme  string // "tcp", "http" or "https"
+	Host    string // Host header and SNI for Ingress rules
+	OK      bool
+	Detail  string
+}
+
+// loadBalancerAddresses returns the IPs and hostnames assigned to a Service load balancer
+func loadBalancerAddresses(ingress []corev1.LoadBalancerIngress) []string {
+	var addresses []string
+	for _, lb := range ingress {
+		if lb.IP != "" {
+			addresses = append(addresses, lb.IP)
+		} else if lb.Hostname != "" {
+			addresses = append(addresses, lb.Hostname)
+		}
+	}
+	return addresses
+}
+
+// ProbeLoadBalancers lists Services of type LoadBalancer and Ingresses, resolves their external
+// addresses and probes them: Service ports over TCP, Ingress rules over HTTP or HTTPS. Objects
+// without an address yet are returned as failed probes.
+func ProbeLoadBalancers(ctx context.Context, client ClusterClient, timeout time.Duration) ([]LoadBalancerProbe, error) {
+	clientset := client.Clientset()
+	var probes []LoadBalancerProbe
+
+	err := eachObject(ctx, "services", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.CoreV1().Services("").List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		svc := obj.(*corev1.Service)
+		if svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+			return nil
+		}
+		object := "service " + svc.Namespace + "/" + svc.Name
+		addresses := loadBalancerAddresses(svc.Status.LoadBalancer.Ingress)
+		if len(addresses) == 0 {
+			probes = append(probes, LoadBalancerProbe{Object: object, Detail: "no external address assigned"})
+			return nil
+		}
+		for _, address := range addresses {
+			for _, port := range svc.Spec.Ports {
+				if port.Protocol != corev1.ProtocolTCP {
+					continue
+				}
+				probes = append(probes, LoadBalancerProbe{Object: object, Address: address, Port: port.Port, Scheme: "tcp"})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachObject(ctx, "ingresses", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.NetworkingV1().Ingresses("").List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		ingress := obj.(*networkingv1.Ingress)
+		object := "ingress " + ingress.Namespace + "/" + ingress.Name
+		var addresses []string
+		for _, lb := range ingress.Status.LoadBalancer.Ingress {
+			if lb.IP != "" {
+				addresses = append(addresses, lb.IP)
+			} else if lb.Hostname != "" {
+				addresses = append(addresses, lb.Hostname)
+			}
+		}
+		if len(addresses) == 0 {
+			probes = append(probes, LoadBalancerProbe{Object: object, Detail: "no external address assigned"})
+			return nil
+		}
+
+		tlsHosts := map[string]bool{}
+		for _, t := range ingress.Spec.TLS {
+			for _, host := range t.Hosts {
+				tlsHosts[host] = true
+			}
+		}
+		hosts := []string{""}
+		if len(ingress.Spec.Rules) > 0 {
+			hosts = hosts[:0]
+			for _, rule := range ingress.Spec.Rules {
+				// wildcard hosts cannot be requested by name; probe the address instead
+				if strings.HasPrefix(rule.Host, "*") {
+					hosts = append(hosts, "")
+					continue
+				}
+				hosts = append(hosts, rule.Host)
+			}
+		}
+		for _, address := range addresses {
+			for _, host := range hosts {
+				probe := LoadBalancerProbe{Object: object, Address: address, Port: 80, Scheme: "http", Host: host}
+				if tlsHosts[host] {
+					probe.Port, probe.Scheme = 443, "https"
+				}
+				probes = append(probes, probe)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range probes {
+		if probes[i].Address == "" {
+			continue
+		}
+		probeLoadBalancer(ctx, &probes[i], timeout)
+	}
+	return probes, nil
+}
+
+// probeLoadBalancer resolves the probe's address and dials it, then for HTTP(S) probes sends
+// a GET. Any HTTP response counts as reachable, since the check validates the load balancer
+// path rather than the application behind it.
+func probeLoadBalancer(ctx context.Context, probe *LoadBalancerProbe, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if net.ParseIP(probe.Address) == nil {
+		if _, err := net.DefaultResolver.LookupHost(ctx, probe.Address); err != nil {
+			probe.Detail = fmt.Sprintf("DNS lookup failed: %v", err)
+			return
+		}
+	}
+
+	target := net.JoinHostPort(probe.Address, strconv.Itoa(int(probe.Port)))
+	dialer := &net.Dialer{Timeout: timeout}
+	if probe.Scheme == "tcp" {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", target)
+		if err != nil {
+			probe.Detail = fmt.Sprintf("TCP connect failed: %v", err)
+			return
+		}
+		conn.Close()
+		probe.OK = true
+		probe.Detail = fmt.Sprintf("connected in %s", time.Since(start).Round(time.Millisecond))
+		return
+	}
+
+	host := probe.Host
+	if host == "" {
+		host = probe.Address
+	}
+	// Requests name the Ingress host but are always dialled to the load balancer address, so
+	// DNS for the host need not point at the cluster yet. Certificates are not verified: the
+	// cert-expiry check covers them, and an untrusted certificate still proves the path works.
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, target)
+		},
+		TLSClientConfig:   &tls.Config{ServerName: host, InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	}
+	defer transport.CloseIdleConnections()
+	httpClient := &http.Client{
+		Transport:     transport,
+		Timeout:       timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probe.Scheme+"://"+net.JoinHostPort(host, strconv.Itoa(int(probe.Port)))+"/", nil)
+	if err != nil {
+		probe.Detail = fmt.Sprintf("invalid request: %v", err)
+		return
+	}
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		probe.Detail = fmt.Sprintf("request failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+	probe.OK = true
+	probe.Detail = fmt.Sprintf("%s in %s", resp.Status, time.Since(start).Round(time.Millisecond))
+}
+
+// CheckLoadBalancers probes every LoadBalancer Service and Ingress from the tool's vantage
+// point and fails when any of them is unreachable or has no address
+func CheckLoadBalancers(ctx context.Context, client ClusterClient, timeout time.Duration) CheckResult {
+	result := CheckResult{Name: "lb-probe"}
+
+	probes, err := ProbeLoadBalancers(ctx, client, timeout)
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	failed := 0
+	for _, probe := range probes {
+		target := probe.Object
+		if probe.Address != "" {
+			target = fmt.Sprintf("%s %s://%s", probe.Object, probe.Scheme, net.JoinHostPort(probe.Address, strconv.Itoa(int(probe.Port))))
+			if probe.Host != "" {
+				target += " (host " + probe.Host + ")"
+			}
+		}
+		if probe.OK {
+			result.Details = append(result.Details, fmt.Sprintf("✓ %s: %s", target, probe.Detail))
+			continue
+		}
+		failed++
+		result.Details = append(result.Details, fmt.Sprintf("✗ %s: %s", target, probe.Detail))
+	}
+
+	switch {
+	case len(probes) == 0:
+		result.Status = CheckPass
+		result.Message = "no LoadBalancer Services or Ingresses"
+	case failed > 0:
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%d of %d load balancer probe(s) failed", failed, len(probes))
+	default:
+		result.Status = CheckPass
+		result.Message = fmt.Sprintf("%d load balancer probe(s) succeeded", len(probes))
+	}
+	return result
+}
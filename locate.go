@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	container "cloud.google.com/go/container/apiv1"
+	containerpb "cloud.google.com/go/container/apiv1/containerpb"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v4"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	ekstypes "github.com/aws/aws-sdk-go-v2/service/eks/types"
+)
+
+// defaultEKSSearchRegions returns the regions searched for an EKS cluster given without a
+// region: the known commercial regions, as China and GovCloud are separate partitions the same
+// credentials cannot reach
+func defaultEKSSearchRegions() []string {
+	var regions []string
+	for _, region := range knownRegions[ProviderEKS] {
+		if !strings.HasPrefix(region, "cn-") && !strings.HasPrefix(region, "us-gov-") {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// eksSearchRegionsFromEnv parses EKS_SEARCH_REGIONS, a comma-separated list of regions
+func eksSearchRegionsFromEnv() ([]string, error) {
+	value := os.Getenv("EKS_SEARCH_REGIONS")
+	if value == "" {
+		return nil, nil
+	}
+	var regions []string
+	for _, region := range strings.Split(value, ",") {
+		region, err := NormalizeLocation(ProviderEKS, region, LocationRegion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EKS_SEARCH_REGIONS: %w", err)
+		}
+		regions = append(regions, region)
+	}
+	return regions, nil
+}
+
+// locateEKSCluster finds the region of the EKS cluster name by describing it in each of regions
+// concurrently. Regions that cannot be searched, such as opt-in regions not enabled for the
+// account, are skipped.
+func locateEKSCluster(ctx context.Context, cfg aws.Config, name string, regions []string) (string, error) {
+	step := progress.Start(fmt.Sprintf("Searching %d regions for EKS cluster %s", len(regions), name))
+	defer step.Done()
+
+	var mu sync.Mutex
+	var found []string
+	skipped := map[string]error{}
+	var wg sync.WaitGroup
+	for _, region := range regions {
+		wg.Add(1)
+		go func(region string) {
+			defer wg.Done()
+			regional := cfg.Copy()
+			regional.Region = region
+			_, err := newEKSAPIClient(regional).DescribeCluster(ctx, &eks.DescribeClusterInput{Name: aws.String(name)})
+
+			var notFound *ekstypes.ResourceNotFoundException
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				found = append(found, region)
+			case errors.As(err, &notFound):
+			default:
+				skipped[region] = err
+			}
+		}(region)
+	}
+	wg.Wait()
+
+	for region, err := range skipped {
+		Verbosef("Could not search %s for EKS cluster %s: %v", region, name, err)
+	}
+	if len(found) == 0 && len(skipped) > 0 {
+		return "", fmt.Errorf("EKS cluster %s not found in %d regions (%d could not be searched, see --verbose); set AWS_REGION",
+			name, len(regions)-len(skipped), len(skipped))
+	}
+	return uniqueClusterLocation(ProviderEKS, name, found, "region", "AWS_REGION")
+}
+
+// locateGKECluster finds the location of the GKE cluster name in project by listing the
+// project's clusters across all locations
+func locateGKECluster(ctx context.Context, client *container.ClusterManagerClient, project, name string) (string, error) {
+	step := progress.Start(fmt.Sprintf("Searching project %s for GKE cluster %s", project, name))
+	resp, err := client.ListClusters(ctx, &containerpb.ListClustersRequest{Parent: fmt.Sprintf("projects/%s/locations/-", project)})
+	step.Done()
+	if err != nil {
+		return "", fmt.Errorf("failed to list GKE clusters: %w", err)
+	}
+
+	var found []string
+	for _, cluster := range resp.Clusters {
+		if cluster.Name == name {
+			found = append(found, cluster.Location)
+		}
+	}
+	if len(found) == 0 && len(resp.MissingZones) > 0 {
+		Warnf("Zones %s could not be searched for GKE cluster %s", strings.Join(resp.MissingZones, ", "), name)
+	}
+	return uniqueClusterLocation(ProviderGKE, name, found, "location", "GKE_ZONE")
+}
+
+// locateAKSCluster finds the resource group of the AKS cluster name by listing the managed
+// clusters of the subscription. Azure resource names are case-insensitive.
+func locateAKSCluster(ctx context.Context, client *armcontainerservice.ManagedClustersClient, name string) (string, error) {
+	step := progress.Start(fmt.Sprintf("Searching the subscription for AKS cluster %s", name))
+	defer step.Done()
+
+	var found []string
+	pager := client.NewListPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to list AKS clusters: %w", err)
+		}
+		for _, cluster := range page.Value {
+			if cluster.Name == nil || cluster.ID == nil || !strings.EqualFold(*cluster.Name, name) {
+				continue
+			}
+			id, err := arm.ParseResourceID(*cluster.ID)
+			if err != nil {
+				return "", fmt.Errorf("failed to parse cluster ID %q: %w", *cluster.ID, err)
+			}
+			found = append(found, id.ResourceGroupName)
+		}
+	}
+	return uniqueClusterLocation(ProviderAKS, name, found, "resource group", "AZURE_RESOURCE_GROUP")
+}
+
+// uniqueClusterLocation returns the single location or resource group, the scope, a cluster was
+// found in, or an error listing the candidates to choose from with setting
+func uniqueClusterLocation(provider Provider, name string, found []string, scope, setting string) (string, error) {
+	sort.Strings(found)
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("%s cluster %s not found in any %s; check the name or set %s", strings.ToUpper(string(provider)), name, scope, setting)
+	case 1:
+		Infof("Found %s cluster %s in %s %s", strings.ToUpper(string(provider)), name, scope, found[0])
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("%s cluster %s exists in several %ss (%s); set %s to choose one",
+			strings.ToUpper(string(provider)), name, scope, strings.Join(found, ", "), setting)
+	}
+}
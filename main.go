@@ -1,18 +1,97 @@
-﻿package main
+package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
 
 func main() {
-	err := godotenv.Load()
+	args, level, err := ParseGlobalFlags(os.Args[1:])
 	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	SetVerbosity(level)
+	SetProgressReporter(NewProgressReporter(os.Stderr))
+
+	if err := godotenv.Load(); err != nil && level > VerbosityQuiet {
 		log.Printf("Warning: .env file not found, using environment variables")
 	}
+	registerEnvSecrets()
+	args, wait, err := ParseWaitForReadyFlag(args)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	ConfigureWaitForReady(wait)
+	args, imp, err := ParseImpersonationFlags(args)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	ConfigureImpersonation(imp)
+	args, readOnly, err := ParseReadOnlyFlag(args)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	ConfigureReadOnly(readOnly)
+	args, yes, err := ParseYesFlag(args)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	ConfigureConfirmation(yes)
+	args, auditDest, err := ParseAuditLogFlag(args)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if who := impersonating(imp); who != "" {
+		Infof("Impersonating %s in Kubernetes requests", who)
+	}
+	log.SetOutput(NewRedactingWriter(os.Stderr))
+
+	if size := os.Getenv("K8S_LIST_PAGE_SIZE"); size != "" {
+		pageSize, err := strconv.ParseInt(size, 10, 64)
+		if err != nil || pageSize <= 0 {
+			log.Fatalf("invalid K8S_LIST_PAGE_SIZE %q", size)
+		}
+		ListPageSize = pageSize
+	}
+
+	limits, err := CloudRateLimitsFromEnv()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	ConfigureCloudRateLimits(limits)
+
+	azureCloud, err := AzureCloudFromEnv()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	ConfigureAzureCloud(azureCloud)
+
+	timeouts, err := PhaseTimeoutsFromEnv()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	ConfigurePhaseTimeouts(timeouts)
 
-	if err := RunAKSTest(); err != nil {
+	if err := ConfigureAuditLog(context.Background(), auditDest); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	if len(args) > 0 {
+		err := runCommand(args[0], args[1:])
+		closeAuditLog()
+		if err != nil {
+			log.Fatalf("%s failed: %v", args[0], err)
+		}
+		return
+	}
+
+	err = RunAKSTest()
+	closeAuditLog()
+	if err != nil {
 		log.Fatalf("test failed: %v", err)
 	}
 
@@ -24,3 +103,10 @@ func main() {
 	// 	log.Fatalf("test failed: %v", err)
 	// }
 }
+
+// closeAuditLog closes the audit log before the process exits, warning when it cannot be written
+func closeAuditLog() {
+	if err := CloseAuditLog(context.Background()); err != nil {
+		Warnf("%v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maintenanceLookahead bounds how far ahead the next occurrence of a recurring window is searched
+const maintenanceLookahead = 400 * 24 * time.Hour
+
+// MaintenanceInfo describes when the provider may disrupt the control plane or nodes
+type MaintenanceInfo struct {
+	Channel       string              `json:"channel,omitempty"` // GKE release channel or AKS auto-upgrade channel
+	Windows       []MaintenanceWindow `json:"windows,omitempty"`
+	Exclusions    []MaintenanceWindow `json:"exclusions,omitempty"`
+	Notifications string              `json:"notifications,omitempty"`
+}
+
+// MaintenanceWindow is a maintenance window or exclusion with its next (or current) occurrence
+type MaintenanceWindow struct {
+	Name     string    `json:"name,omitempty"`
+	Schedule string    `json:"schedule,omitempty"` // provider description of the recurrence
+	Start    time.Time `json:"start,omitempty"`
+	End      time.Time `json:"end,omitempty"`
+}
+
+// Active reports whether the window's known occurrence contains t
+func (w MaintenanceWindow) Active(t time.Time) bool {
+	return !w.Start.IsZero() && !t.Before(w.Start) && t.Before(w.End)
+}
+
+// PrintMaintenanceInfo renders maintenance settings below the cluster information
+func PrintMaintenanceInfo(info *MaintenanceInfo) {
+	now := time.Now()
+
+	fmt.Println("  Maintenance:")
+	if info.Channel != "" {
+		fmt.Printf("    Channel: %s\n", info.Channel)
+	}
+	if len(info.Windows) == 0 {
+		fmt.Println("    Windows: none (maintenance may happen at any time)")
+	}
+	for _, window := range info.Windows {
+		fmt.Printf("    Window: %s\n", formatMaintenanceWindow(window, now))
+	}
+	for _, exclusion := range info.Exclusions {
+		fmt.Printf("    Exclusion: %s\n", formatMaintenanceWindow(exclusion, now))
+	}
+	if info.Notifications != "" {
+		fmt.Printf("    Notifications: %s\n", info.Notifications)
+	}
+}
+
+// formatMaintenanceWindow describes a window and when it next applies
+func formatMaintenanceWindow(window MaintenanceWindow, now time.Time) string {
+	var parts []string
+	if window.Name != "" {
+		parts = append(parts, window.Name)
+	}
+	if window.Schedule != "" {
+		parts = append(parts, window.Schedule)
+	}
+
+	switch {
+	case window.Active(now):
+		parts = append(parts, fmt.Sprintf("IN PROGRESS until %s", window.End.Format(time.RFC3339)))
+	case !window.Start.IsZero():
+		parts = append(parts, fmt.Sprintf("next %s - %s", window.Start.Format(time.RFC3339), window.End.Format(time.RFC3339)))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// nextRecurrence returns the first occurrence of a window that starts at firstStart, lasts
+// duration and repeats per an RFC 5545 RRULE, which has not ended by now. Only FREQ=DAILY and
+// FREQ=WEEKLY (optionally with BYDAY) are expanded; ok is false for other rules.
+func nextRecurrence(firstStart time.Time, duration time.Duration, rrule string, now time.Time) (time.Time, bool) {
+	rule := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(rrule, "RRULE:"), ";") {
+		if key, value, found := strings.Cut(part, "="); found {
+			rule[strings.ToUpper(key)] = strings.ToUpper(value)
+		}
+	}
+
+	var matches func(time.Time) bool
+	switch rule["FREQ"] {
+	case "DAILY":
+		matches = func(time.Time) bool { return true }
+	case "WEEKLY":
+		days := map[time.Weekday]bool{firstStart.Weekday(): true}
+		if byDay := rule["BYDAY"]; byDay != "" {
+			days = map[time.Weekday]bool{}
+			for _, day := range strings.Split(byDay, ",") {
+				weekday, ok := rruleWeekdays[day]
+				if !ok {
+					return time.Time{}, false
+				}
+				days[weekday] = true
+			}
+		}
+		matches = func(t time.Time) bool { return days[t.Weekday()] }
+	default:
+		return time.Time{}, false
+	}
+	if interval := rule["INTERVAL"]; interval != "" && interval != "1" {
+		return time.Time{}, false
+	}
+
+	candidate := firstStart
+	if earliest := now.Add(-duration); candidate.Before(earliest) {
+		days := int(earliest.Sub(candidate).Hours() / 24)
+		candidate = candidate.AddDate(0, 0, days)
+	}
+	for limit := now.Add(maintenanceLookahead); candidate.Before(limit); candidate = candidate.AddDate(0, 0, 1) {
+		if matches(candidate) && candidate.Add(duration).After(now) {
+			return candidate, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// rruleWeekdays maps RRULE day codes to weekdays
+var rruleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// isoDurationPattern matches the time part of ISO 8601 durations such as PT4H0M0S
+var isoDurationPattern = regexp.MustCompile(`^PT(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?$`)
+
+// parseISODuration parses an ISO 8601 duration that only has hour, minute and second parts
+func parseISODuration(value string) (time.Duration, error) {
+	match := isoDurationPattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("unsupported duration %q", value)
+	}
+
+	var total time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			return 0, fmt.Errorf("unsupported duration %q", value)
+		}
+		total += time.Duration(n) * unit
+	}
+	return total, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// markdownPass, markdownWarn and markdownFail mark a cluster or check green, yellow or red in
+// Markdown reports
+const (
+	markdownPass = "🟢"
+	markdownWarn = "🟡"
+	markdownFail = "🔴"
+)
+
+// EncodeMarkdownReport renders a fleet report as Markdown for GitHub issues and wikis: a summary,
+// the active status page incidents, a table of clusters per provider with their status, and a
+// matrix of the Kubernetes versions the clusters run when the action reports them
+func EncodeMarkdownReport(report *Report) []byte {
+	var b strings.Builder
+	failed := report.Failed()
+	fmt.Fprintf(&b, "# Fleet %s report\n\n", report.Action)
+	status := markdownPass
+	if failed > 0 {
+		status = markdownFail
+	}
+	fmt.Fprintf(&b, "%s **%d of %d clusters succeeded** · finished %s · %s %s\n",
+		status, len(report.Results)-failed, len(report.Results), report.Finished.UTC().Format(time.RFC3339), toolName, ToolVersion())
+
+	if len(report.Incidents) > 0 {
+		b.WriteString("\n## Provider status page incidents\n\n")
+		for _, incident := range report.Incidents {
+			fmt.Fprintf(&b, "- ⚠ **%s**: %s\n", incident.Source, markdownInline(incident.Summary))
+		}
+	}
+
+	versions := map[Provider]map[string]int{}
+	for _, provider := range []Provider{ProviderAKS, ProviderEKS, ProviderGKE} {
+		var results []FleetResult
+		for _, result := range report.Results {
+			if result.Cluster.Provider == provider {
+				results = append(results, result)
+			}
+		}
+		if len(results) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n## %s\n\n", strings.ToUpper(string(provider)))
+		b.WriteString("| Status | Cluster | Profile | Region | Version | Duration | Details |\n")
+		b.WriteString("|:---:|---|---|---|---|---:|---|\n")
+		for _, result := range results {
+			status, details := markdownResultStatus(result)
+			kubeVersion := markdownResultVersion(result)
+			if kubeVersion != "" {
+				if versions[provider] == nil {
+					versions[provider] = map[string]int{}
+				}
+				versions[provider][kubeVersion]++
+			} else {
+				kubeVersion = "—"
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s | %s |\n",
+				status, markdownCell(result.Cluster.Name), markdownCell(result.Cluster.ProfileName()), markdownCell(result.Cluster.Region),
+				markdownCell(kubeVersion), result.Duration.Round(time.Millisecond), markdownCell(details))
+		}
+	}
+
+	if len(versions) > 0 {
+		writeMarkdownVersionMatrix(&b, versions)
+	}
+	return []byte(Redact(b.String()))
+}
+
+// markdownResultStatus returns the red, yellow or green status of a result and a one-line
+// explanation: the error, the failed, warning or skipped checks, or the number of passed checks
+func markdownResultStatus(result FleetResult) (string, string) {
+	checks := resultChecks(result)
+	var failedChecks, notes []string
+	skipped := 0
+	for _, check := range checks {
+		switch check.Status {
+		case CheckFail:
+			failedChecks = append(failedChecks, check.Name+": "+check.Message)
+		case CheckWarn:
+			notes = append(notes, "⚠ "+check.Name+": "+check.Message)
+		case CheckSkip:
+			notes = append(notes, "○ "+check.Name+": "+check.Message)
+			skipped++
+		}
+	}
+
+	if result.Err != nil {
+		details := result.Err.Error()
+		if len(failedChecks) == 0 && len(notes) > 0 {
+			// Warnings failed the cluster with --fail-on warn
+			details += "; " + strings.Join(notes, "; ")
+		}
+		for _, event := range result.ProviderEvents {
+			details += "; " + event.String()
+		}
+		return markdownFail, details
+	}
+	if len(checks) == 0 {
+		return markdownPass, ""
+	}
+	if len(failedChecks) > 0 {
+		return markdownFail, strings.Join(failedChecks, "; ")
+	}
+	if len(notes) > skipped {
+		return markdownWarn, strings.Join(notes, "; ")
+	}
+	if skipped > 0 {
+		return markdownPass, strings.Join(notes, "; ")
+	}
+	return markdownPass, fmt.Sprintf("%d checks passed", len(checks))
+}
+
+// markdownResultVersion returns the Kubernetes version a result reports, from fleet info or an
+// upgrade, or "" when the action does not report one
+func markdownResultVersion(result FleetResult) string {
+	switch output := result.Output.(type) {
+	case *ClusterInfo:
+		return output.Version
+	case *RolloutClusterOutput:
+		if output.Upgrade != nil {
+			return output.Upgrade.To
+		}
+	}
+	return ""
+}
+
+// writeMarkdownVersionMatrix writes a table of the number of clusters per provider running each
+// Kubernetes version
+func writeMarkdownVersionMatrix(b *strings.Builder, versions map[Provider]map[string]int) {
+	var all []string
+	seen := map[string]bool{}
+	for _, byVersion := range versions {
+		for kubeVersion := range byVersion {
+			if !seen[kubeVersion] {
+				seen[kubeVersion] = true
+				all = append(all, kubeVersion)
+			}
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		vi, errI := version.ParseGeneric(all[i])
+		vj, errJ := version.ParseGeneric(all[j])
+		if errI != nil || errJ != nil {
+			return all[i] < all[j]
+		}
+		return vi.LessThan(vj)
+	})
+
+	var providers []Provider
+	for _, provider := range []Provider{ProviderAKS, ProviderEKS, ProviderGKE} {
+		if versions[provider] != nil {
+			providers = append(providers, provider)
+		}
+	}
+
+	b.WriteString("\n## Version matrix\n\n| Version |")
+	for _, provider := range providers {
+		fmt.Fprintf(b, " %s |", strings.ToUpper(string(provider)))
+	}
+	b.WriteString("\n|---|")
+	b.WriteString(strings.Repeat("---:|", len(providers)))
+	b.WriteString("\n")
+	for _, kubeVersion := range all {
+		fmt.Fprintf(b, "| %s |", markdownCell(kubeVersion))
+		for _, provider := range providers {
+			if count := versions[provider][kubeVersion]; count > 0 {
+				fmt.Fprintf(b, " %d |", count)
+			} else {
+				b.WriteString(" |")
+			}
+		}
+		b.WriteString("\n")
+	}
+}
+
+// markdownCell escapes text for a Markdown table cell
+func markdownCell(text string) string {
+	return strings.ReplaceAll(markdownInline(text), "|", "\\|")
+}
+
+// markdownInline folds text onto one line
+func markdownInline(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
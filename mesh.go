@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// serviceMesh describes how to recognise a service mesh's control plane, injection settings and
+// sidecars
+type serviceMesh struct {
+	name         string
+	controlPlane string // control plane deployment name prefix
+	sidecar      string // sidecar container name
+	// injected reports whether a namespace has automatic sidecar injection enabled, and the
+	// revision when the mesh has them
+	injected func(ns *corev1.Namespace) (bool, string)
+}
+
+// serviceMeshes are the meshes recognised, Istio covering Anthos Service Mesh
+var serviceMeshes = []serviceMesh{
+	{
+		name:         "Istio",
+		controlPlane: "istiod",
+		sidecar:      "istio-proxy",
+		injected: func(ns *corev1.Namespace) (bool, string) {
+			if rev := ns.Labels["istio.io/rev"]; rev != "" {
+				return true, rev
+			}
+			return ns.Labels["istio-injection"] == "enabled", ""
+		},
+	},
+	{
+		name:         "Linkerd",
+		controlPlane: "linkerd-destination",
+		sidecar:      "linkerd-proxy",
+		injected: func(ns *corev1.Namespace) (bool, string) {
+			return ns.Annotations["linkerd.io/inject"] == "enabled", ""
+		},
+	},
+	{
+		name:         "AWS App Mesh",
+		controlPlane: "appmesh-controller",
+		sidecar:      "envoy",
+		injected: func(ns *corev1.Namespace) (bool, string) {
+			return ns.Labels["appmesh.k8s.aws/sidecarInjectorWebhook"] == "enabled", ""
+		},
+	},
+}
+
+// MeshControlPlane is a service mesh control plane running in, or managed for, a cluster
+type MeshControlPlane struct {
+	Mesh      string `json:"mesh"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Version   string `json:"version,omitempty"`
+}
+
+// MeshNamespace is a namespace with sidecar injection enabled and its sidecar coverage
+type MeshNamespace struct {
+	Mesh     string `json:"mesh"`
+	Name     string `json:"name"`
+	Revision string `json:"revision,omitempty"`
+	Pods     int    `json:"pods"`
+	Meshed   int    `json:"meshed"`
+}
+
+// MeshReport lists a cluster's service meshes, injected namespaces and sidecar coverage
+type MeshReport struct {
+	ControlPlanes []MeshControlPlane `json:"controlPlanes,omitempty"`
+	Namespaces    []MeshNamespace    `json:"namespaces,omitempty"`
+	// Pods and Meshed count pods outside system namespaces, and those running a sidecar
+	Pods   int `json:"pods"`
+	Meshed int `json:"meshed"`
+}
+
+// Coverage returns the fraction of application pods running a mesh sidecar
+func (r *MeshReport) Coverage() float64 {
+	if r.Pods == 0 {
+		return 0
+	}
+	return float64(r.Meshed) / float64(r.Pods)
+}
+
+// InspectServiceMeshes detects Istio (including Anthos Service Mesh), Linkerd and AWS App Mesh
+// control planes, the namespaces with sidecar injection enabled, and the share of application
+// pods running a sidecar. Managed Anthos Service Mesh runs its control plane outside the
+// cluster and is recognised from its asm-managed injection revisions.
+func InspectServiceMeshes(ctx context.Context, clientset kubernetes.Interface) (*MeshReport, error) {
+	report := &MeshReport{}
+
+	err := EachDeployment(ctx, clientset, "", metav1.ListOptions{}, func(deployment *appsv1.Deployment) error {
+		for _, mesh := range serviceMeshes {
+			if !strings.HasPrefix(deployment.Name, mesh.controlPlane) {
+				continue
+			}
+			name := mesh.name
+			if strings.Contains(deployment.Name, "asm") {
+				name = "Anthos Service Mesh"
+			}
+			report.ControlPlanes = append(report.ControlPlanes, MeshControlPlane{
+				Mesh:      name,
+				Namespace: deployment.Namespace,
+				Name:      deployment.Name,
+				Version:   controlPlaneVersion(deployment),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	injected := map[string]*MeshNamespace{}
+	managedRevisions := map[string]bool{}
+	err = eachObject(ctx, "namespaces", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.CoreV1().Namespaces().List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		ns := obj.(*corev1.Namespace)
+		for _, mesh := range serviceMeshes {
+			if ok, revision := mesh.injected(ns); ok {
+				injected[ns.Name] = &MeshNamespace{Mesh: mesh.name, Name: ns.Name, Revision: revision}
+				if strings.HasPrefix(revision, "asm-managed") {
+					managedRevisions[revision] = true
+				}
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for revision := range managedRevisions {
+		report.ControlPlanes = append(report.ControlPlanes, MeshControlPlane{Mesh: "Anthos Service Mesh (managed)", Name: revision})
+	}
+
+	err = EachPod(ctx, clientset, "", metav1.ListOptions{}, func(pod *corev1.Pod) error {
+		if isSystemNamespace(pod.Namespace) || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			return nil
+		}
+		meshed := hasMeshSidecar(pod)
+		report.Pods++
+		if meshed {
+			report.Meshed++
+		}
+		if ns := injected[pod.Namespace]; ns != nil {
+			ns.Pods++
+			if meshed {
+				ns.Meshed++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ns := range injected {
+		report.Namespaces = append(report.Namespaces, *ns)
+	}
+	sort.Slice(report.Namespaces, func(i, j int) bool { return report.Namespaces[i].Name < report.Namespaces[j].Name })
+	sort.Slice(report.ControlPlanes, func(i, j int) bool { return report.ControlPlanes[i].Name < report.ControlPlanes[j].Name })
+	return report, nil
+}
+
+// controlPlaneVersion returns the version a control plane deployment runs, from its image tag
+func controlPlaneVersion(deployment *appsv1.Deployment) string {
+	if version := deployment.Labels["app.kubernetes.io/version"]; version != "" {
+		return version
+	}
+	containers := deployment.Spec.Template.Spec.Containers
+	if len(containers) == 0 {
+		return ""
+	}
+	image, _, _ := strings.Cut(containers[0].Image, "@")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return ""
+}
+
+// hasMeshSidecar reports whether a pod runs a mesh sidecar, either as a regular container or a
+// native sidecar init container
+func hasMeshSidecar(pod *corev1.Pod) bool {
+	containers := append(append([]corev1.Container{}, pod.Spec.Containers...), pod.Spec.InitContainers...)
+	for _, container := range containers {
+		for _, mesh := range serviceMeshes {
+			if container.Name == mesh.sidecar {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isSystemNamespace reports whether namespace belongs to Kubernetes or a mesh control plane
+// rather than an application
+func isSystemNamespace(namespace string) bool {
+	switch namespace {
+	case "kube-system", "kube-public", "kube-node-lease", "istio-system", "linkerd", "appmesh-system", "gke-managed-system", "asm-system":
+		return true
+	}
+	return false
+}
+
+// CheckServiceMesh reports service mesh control planes, injected namespaces and sidecar
+// coverage. It fails when pods in a namespace with injection enabled run without a sidecar,
+// typically because they started before injection was enabled and were never restarted.
+func CheckServiceMesh(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "service-mesh"}
+
+	report, err := InspectServiceMeshes(ctx, client.Clientset())
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	for _, plane := range report.ControlPlanes {
+		location := plane.Name
+		if plane.Namespace != "" {
+			location = plane.Namespace + "/" + plane.Name
+		}
+		version := ""
+		if plane.Version != "" {
+			version = " " + plane.Version
+		}
+		result.Details = append(result.Details, fmt.Sprintf("%s%s (%s)", plane.Mesh, version, location))
+	}
+	unmeshed := 0
+	for _, ns := range report.Namespaces {
+		mark := "✓"
+		if ns.Meshed < ns.Pods {
+			mark = "✗"
+			unmeshed += ns.Pods - ns.Meshed
+		}
+		revision := ""
+		if ns.Revision != "" {
+			revision = ", revision " + ns.Revision
+		}
+		result.Details = append(result.Details, fmt.Sprintf("%s namespace %s (%s%s): %d/%d pod(s) with a sidecar", mark, ns.Name, ns.Mesh, revision, ns.Meshed, ns.Pods))
+	}
+
+	switch {
+	case len(report.ControlPlanes) == 0 && len(report.Namespaces) == 0:
+		result.Status = CheckPass
+		result.Message = "no service mesh found"
+	case unmeshed > 0:
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%d pod(s) in injected namespaces run without a sidecar; %.0f%% sidecar coverage overall", unmeshed, report.Coverage()*100)
+	default:
+		result.Status = CheckPass
+		result.Message = fmt.Sprintf("%d of %d application pod(s) meshed (%.0f%%)", report.Meshed, report.Pods, report.Coverage()*100)
+	}
+	return result
+}
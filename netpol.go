@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// networkEngine identifies a CNI plugin or network policy engine by its node DaemonSet
+type networkEngine struct {
+	daemonSet string
+	name      string
+	policy    bool // whether the engine enforces NetworkPolicies
+}
+
+// networkEngines are the CNI plugins and policy engines recognised on managed clusters
+var networkEngines = []networkEngine{
+	{"calico-node", "Calico", true},
+	{"cilium", "Cilium", true},
+	{"anetd", "GKE Dataplane V2 (Cilium)", true},
+	{"azure-npm", "Azure Network Policy Manager", true},
+	{"azure-cns", "Azure CNI", false},
+	{"aws-node", "Amazon VPC CNI", false},
+	{"antrea-agent", "Antrea", true},
+	{"kube-router", "kube-router", true},
+	{"weave-net", "Weave Net", true},
+	{"kube-flannel-ds", "Flannel", false},
+}
+
+// vpcCNIPolicyFlag enables the network policy agent shipped with the Amazon VPC CNI
+const vpcCNIPolicyFlag = "--enable-network-policy=true"
+
+// NetworkEngine is a CNI plugin or policy engine found running in a cluster
+type NetworkEngine struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	DaemonSet string `json:"daemonSet"`
+	Policy    bool   `json:"enforcesPolicy"`
+}
+
+// NetworkPolicySupport lists the network engines of a cluster and whether any enforces
+// NetworkPolicies
+type NetworkPolicySupport struct {
+	Engines  []NetworkEngine `json:"engines"`
+	Policies int             `json:"networkPolicies"`
+}
+
+// Enforced reports whether any detected engine enforces NetworkPolicies
+func (s *NetworkPolicySupport) Enforced() bool {
+	for _, engine := range s.Engines {
+		if engine.Policy {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectNetworkPolicySupport identifies the CNI plugin and network policy engine from their
+// DaemonSets and counts the cluster's NetworkPolicies
+func DetectNetworkPolicySupport(ctx context.Context, clientset kubernetes.Interface) (*NetworkPolicySupport, error) {
+	support := &NetworkPolicySupport{}
+
+	err := eachObject(ctx, "daemonsets", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.AppsV1().DaemonSets("").List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		ds := obj.(*appsv1.DaemonSet)
+		for _, engine := range networkEngines {
+			if ds.Name != engine.daemonSet {
+				continue
+			}
+			found := NetworkEngine{Name: engine.name, Namespace: ds.Namespace, DaemonSet: ds.Name, Policy: engine.policy}
+			if engine.daemonSet == "aws-node" && vpcCNIEnforcesPolicy(ds) {
+				found.Name += " with network policy agent"
+				found.Policy = true
+			}
+			support.Engines = append(support.Engines, found)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachObject(ctx, "network policies", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.NetworkingV1().NetworkPolicies("").List(ctx, opts)
+	}, func(runtime.Object) error {
+		support.Policies++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return support, nil
+}
+
+// vpcCNIEnforcesPolicy reports whether the aws-node DaemonSet runs its network policy agent
+func vpcCNIEnforcesPolicy(ds *appsv1.DaemonSet) bool {
+	for _, container := range ds.Spec.Template.Spec.Containers {
+		for _, arg := range container.Args {
+			if arg == vpcCNIPolicyFlag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckNetworkPolicySupport reports the network engines and fails when the cluster has
+// NetworkPolicies but nothing enforces them
+func CheckNetworkPolicySupport(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "network-policy"}
+
+	support, err := DetectNetworkPolicySupport(ctx, client.Clientset())
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	var names []string
+	for _, engine := range support.Engines {
+		names = append(names, engine.Name)
+		enforces := "does not enforce NetworkPolicies"
+		if engine.Policy {
+			enforces = "enforces NetworkPolicies"
+		}
+		result.Details = append(result.Details, fmt.Sprintf("%s (%s/%s) %s", engine.Name, engine.Namespace, engine.DaemonSet, enforces))
+	}
+	if len(names) == 0 {
+		names = append(names, "no known CNI plugin")
+	}
+
+	switch {
+	case support.Policies > 0 && !support.Enforced():
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%d NetworkPolicies but no engine enforcing them (%s)", support.Policies, strings.Join(names, ", "))
+	case support.Enforced():
+		result.Status = CheckPass
+		result.Message = fmt.Sprintf("%s; %d NetworkPolicies", strings.Join(names, ", "), support.Policies)
+	default:
+		result.Status = CheckPass
+		result.Message = fmt.Sprintf("%s; NetworkPolicies are not enforced", strings.Join(names, ", "))
+	}
+	return result
+}
+
+// NetworkPolicyProbeOptions configures the network policy enforcement test
+type NetworkPolicyProbeOptions struct {
+	Image     string
+	Namespace string
+	Timeout   time.Duration
+}
+
+// netpolProbePort is the port the enforcement test's server pod listens on
+const netpolProbePort = 8080
+
+// RunNetworkPolicyProbe verifies that NetworkPolicies are enforced: it starts a server pod,
+// checks that a client pod can connect to it, applies a policy denying all ingress to the
+// server and checks that the client is then blocked. Everything created is deleted afterwards.
+func RunNetworkPolicyProbe(ctx context.Context, clientset kubernetes.Interface, opts NetworkPolicyProbeOptions) ([]ProbeResult, error) {
+	run := rand.String(6)
+	labels := map[string]string{
+		"app.kubernetes.io/managed-by": "connect-managed-k8s",
+		"connect-k8s/netpol-probe":     run,
+	}
+	serverSelector := map[string]string{"connect-k8s/netpol-probe": run, "connect-k8s/role": "server"}
+	serverLabels := map[string]string{"app.kubernetes.io/managed-by": "connect-managed-k8s"}
+	for key, value := range serverSelector {
+		serverLabels[key] = value
+	}
+
+	server := netpolProbePod("connect-k8s-netpol-server-"+run, opts, serverLabels,
+		fmt.Sprintf("mkdir -p /www && httpd -f -p %d -h /www", netpolProbePort))
+	server.Spec.ActiveDeadlineSeconds = int64Ptr(int64(opts.Timeout.Seconds()))
+	created, err := clientset.CoreV1().Pods(opts.Namespace).Create(ctx, server, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create server pod: %w", err)
+	}
+	defer deleteProbePod(clientset, created.Namespace, created.Name)
+
+	serverIP, err := waitForPodIP(ctx, clientset, created.Namespace, created.Name, opts.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	target := fmt.Sprintf("%s %d", serverIP, netpolProbePort)
+
+	var results []ProbeResult
+	allowed, err := runNetpolClient(ctx, clientset, opts, "connect-k8s-netpol-allowed-"+run, labels, "nc -z -w 5 "+target)
+	if err != nil {
+		return nil, err
+	}
+	results = append(results, ProbeResult{Name: "allowed-without-policy", OK: allowed, Detail: "client could not reach the server before any policy was applied"})
+	if !allowed {
+		return results, nil
+	}
+
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "connect-k8s-netpol-deny-" + run, Namespace: opts.Namespace, Labels: labels},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: serverSelector},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	}
+	if _, err := clientset.NetworkingV1().NetworkPolicies(opts.Namespace).Create(ctx, policy, metav1.CreateOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to create deny policy: %w", err)
+	}
+	defer deleteProbePolicy(clientset, policy.Namespace, policy.Name)
+
+	// Policies take a few seconds to be programmed, so the client retries until it is blocked
+	denied, err := runNetpolClient(ctx, clientset, opts, "connect-k8s-netpol-denied-"+run, labels,
+		fmt.Sprintf("for i in $(seq 15); do nc -z -w 2 %s || exit 0; sleep 2; done; exit 1", target))
+	if err != nil {
+		return nil, err
+	}
+	results = append(results, ProbeResult{Name: "denied-with-policy", OK: denied, Detail: "client still reached the server 30s after a deny-all ingress policy was applied"})
+	return results, nil
+}
+
+// netpolProbePod builds a probe pod running script
+func netpolProbePod(name string, opts NetworkPolicyProbeOptions, labels map[string]string, script string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: opts.Namespace, Labels: labels},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			NodeSelector:  map[string]string{"kubernetes.io/os": "linux"},
+			Containers: []corev1.Container{{
+				Name:    "probe",
+				Image:   opts.Image,
+				Command: []string{"sh", "-c", script},
+			}},
+		},
+	}
+}
+
+// runNetpolClient runs a client pod to completion and reports whether it succeeded
+func runNetpolClient(ctx context.Context, clientset kubernetes.Interface, opts NetworkPolicyProbeOptions, name string, labels map[string]string, script string) (bool, error) {
+	pod := netpolProbePod(name, opts, labels, script)
+	pod.Spec.ActiveDeadlineSeconds = int64Ptr(int64(opts.Timeout.Seconds()))
+	created, err := clientset.CoreV1().Pods(opts.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to create client pod: %w", err)
+	}
+	defer deleteProbePod(clientset, created.Namespace, created.Name)
+
+	if err := waitForPodCompletion(ctx, clientset, created.Namespace, created.Name, opts.Timeout); err != nil {
+		return false, err
+	}
+	finished, err := clientset.CoreV1().Pods(created.Namespace).Get(ctx, created.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to get client pod: %w", err)
+	}
+	return finished.Status.Phase == corev1.PodSucceeded, nil
+}
+
+// waitForPodIP waits until a pod is running and returns its IP
+func waitForPodIP(ctx context.Context, clientset kubernetes.Interface, namespace, name string, timeout time.Duration) (string, error) {
+	step := progress.Start(fmt.Sprintf("Waiting for probe pod %s/%s to start", namespace, name))
+	defer step.Done()
+
+	var ip string
+	var lastPhase corev1.PodPhase
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		lastPhase, ip = pod.Status.Phase, pod.Status.PodIP
+		return pod.Status.Phase == corev1.PodRunning && ip != "", nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("probe pod %s/%s did not start (last phase %q): %w", namespace, name, lastPhase, err)
+	}
+	return ip, nil
+}
+
+// deleteProbePolicy removes a probe NetworkPolicy, logging instead of failing
+func deleteProbePolicy(clientset kubernetes.Interface, namespace, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := clientset.NetworkingV1().NetworkPolicies(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		Warnf("Failed to delete probe network policy %s/%s: %v", namespace, name, err)
+	}
+}
+
+// CheckNetworkPolicyProbe runs the enforcement test and turns it into a check result
+func CheckNetworkPolicyProbe(ctx context.Context, client ClusterClient, opts NetworkPolicyProbeOptions) CheckResult {
+	result := CheckResult{Name: "netpol-probe"}
+
+	probes, err := RunNetworkPolicyProbe(ctx, client.Clientset(), opts)
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	failed := 0
+	for _, probe := range probes {
+		if probe.OK {
+			result.Details = append(result.Details, fmt.Sprintf("✓ %s", probe.Name))
+			continue
+		}
+		failed++
+		result.Details = append(result.Details, fmt.Sprintf("✗ %s: %s", probe.Name, probe.Detail))
+	}
+
+	if failed > 0 {
+		result.Status = CheckFail
+		result.Message = "NetworkPolicies are not enforced"
+		return result
+	}
+	result.Status = CheckPass
+	result.Message = "a deny-all ingress policy blocked traffic that was allowed without it"
+	return result
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// NetTestStage names the step at which a network test stopped
+type NetTestStage string
+
+const (
+	StageDNS       NetTestStage = "dns"
+	StageTCP       NetTestStage = "tcp"
+	StageTLS       NetTestStage = "tls"
+	StageFirstByte NetTestStage = "first-byte"
+	StageOK        NetTestStage = "ok"
+)
+
+// NetTestResult holds the timings of one address family towards the API server endpoint
+type NetTestResult struct {
+	Family       string // "ipv4" or "ipv6"
+	Address      string
+	TCPConnect   time.Duration
+	TLSHandshake time.Duration
+	FirstByte    time.Duration
+	FailedAt     NetTestStage // StageOK when every step succeeded
+	Err          error
+}
+
+// NetTestReport is the outcome of testing the network path to a cluster endpoint
+type NetTestReport struct {
+	Endpoint string
+	Host     string
+	Port     string
+	Results  []NetTestResult
+	Hints    []string
+}
+
+// RunNetTest measures TCP connect, TLS handshake and first-byte latency to the API server
+// separately over IPv4 and IPv6, and derives hints from asymmetric failures
+func RunNetTest(ctx context.Context, restConfig *rest.Config, timeout time.Duration) (*NetTestReport, error) {
+	endpoint, err := url.Parse(restConfig.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse API server endpoint %q: %w", restConfig.Host, err)
+	}
+
+	report := &NetTestReport{Endpoint: restConfig.Host, Host: endpoint.Hostname(), Port: endpoint.Port()}
+	if report.Port == "" {
+		report.Port = "443"
+	}
+
+	tlsConfig, err := netTestTLSConfig(restConfig, report.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, family := range []string{"ipv4", "ipv6"} {
+		report.Results = append(report.Results, testAddressFamily(ctx, report, family, tlsConfig, timeout))
+	}
+
+	report.Hints = netTestHints(report.Results)
+	return report, nil
+}
+
+// testAddressFamily runs the staged test against the first address of the given family
+func testAddressFamily(ctx context.Context, report *NetTestReport, family string, tlsConfig *tls.Config, timeout time.Duration) NetTestResult {
+	result := NetTestResult{Family: family}
+
+	network := "ip4"
+	if family == "ipv6" {
+		network = "ip6"
+	}
+
+	address := report.Host
+	if ip := net.ParseIP(report.Host); ip != nil {
+		if (ip.To4() != nil) != (family == "ipv4") {
+			result.FailedAt = StageDNS
+			result.Err = fmt.Errorf("endpoint is a literal %s address", otherFamily(family))
+			return result
+		}
+	} else {
+		lookupCtx, cancel := context.WithTimeout(ctx, timeout)
+		ips, err := net.DefaultResolver.LookupIP(lookupCtx, network, report.Host)
+		cancel()
+		if err != nil || len(ips) == 0 {
+			result.FailedAt = StageDNS
+			result.Err = fmt.Errorf("no %s address: %w", family, errOrNoAddress(err))
+			return result
+		}
+		address = ips[0].String()
+	}
+	result.Address = address
+
+	dialer := &net.Dialer{Timeout: timeout}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, report.Port))
+	result.TCPConnect = time.Since(start)
+	if err != nil {
+		result.FailedAt = StageTCP
+		result.Err = err
+		return result
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		result.FailedAt = StageTCP
+		result.Err = err
+		return result
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	start = time.Now()
+	err = tlsConn.HandshakeContext(ctx)
+	result.TLSHandshake = time.Since(start)
+	if err != nil {
+		result.FailedAt = StageTLS
+		result.Err = err
+		return result
+	}
+
+	request := fmt.Sprintf("GET /livez HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", report.Host)
+	start = time.Now()
+	if _, err := tlsConn.Write([]byte(request)); err != nil {
+		result.FailedAt = StageFirstByte
+		result.Err = err
+		return result
+	}
+	buf := make([]byte, 1)
+	_, err = tlsConn.Read(buf)
+	result.FirstByte = time.Since(start)
+	if err != nil {
+		result.FailedAt = StageFirstByte
+		result.Err = err
+		return result
+	}
+
+	result.FailedAt = StageOK
+	return result
+}
+
+// netTestTLSConfig builds a TLS config that validates the API server against the cluster CA
+func netTestTLSConfig(restConfig *rest.Config, host string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if restConfig.ServerName != "" {
+		tlsConfig.ServerName = restConfig.ServerName
+	}
+
+	if len(restConfig.CAData) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(restConfig.CAData) {
+			return nil, fmt.Errorf("failed to parse cluster CA certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// netTestHints turns the per-family results into targeted troubleshooting hints
+func netTestHints(results []NetTestResult) []string {
+	var hints []string
+	byFamily := map[string]NetTestResult{}
+	for _, r := range results {
+		byFamily[r.Family] = r
+	}
+	v4, v6 := byFamily["ipv4"], byFamily["ipv6"]
+
+	if v4.FailedAt == StageDNS && v6.FailedAt == StageDNS {
+		hints = append(hints, "The endpoint name does not resolve at all: check your resolver, VPN split DNS, or the private DNS zone of a private cluster endpoint.")
+		return hints
+	}
+
+	for _, r := range []NetTestResult{v4, v6} {
+		switch r.FailedAt {
+		case StageTCP:
+			if isTimeout(r.Err) {
+				hints = append(hints, fmt.Sprintf("%s: DNS resolves to %s but TCP times out; the endpoint is likely private or filtered (authorized networks, security groups, NSGs, corporate firewall).", r.Family, r.Address))
+			} else if errors.Is(r.Err, syscall.ECONNREFUSED) {
+				hints = append(hints, fmt.Sprintf("%s: connection to %s refused; something answers on that address but not the API server (wrong port, proxy or load balancer without backends).", r.Family, r.Address))
+			} else {
+				hints = append(hints, fmt.Sprintf("%s: TCP connect to %s failed: %v; check routing to this address.", r.Family, r.Address, r.Err))
+			}
+		case StageTLS:
+			if isTimeout(r.Err) {
+				hints = append(hints, fmt.Sprintf("%s: TCP connects but the TLS handshake times out; large handshake packets are being dropped, which usually points to an MTU / path-MTU-discovery blackhole on a VPN or tunnel.", r.Family))
+			} else {
+				hints = append(hints, fmt.Sprintf("%s: TLS handshake failed (%v); a TLS-intercepting proxy or a certificate that does not match the cluster CA is in the path.", r.Family, r.Err))
+			}
+		case StageFirstByte:
+			hints = append(hints, fmt.Sprintf("%s: TLS succeeded but the API server did not answer (%v); the control plane may be overloaded or an intermediary is stalling requests.", r.Family, r.Err))
+		}
+	}
+
+	if v4.FailedAt == StageOK && v6.FailedAt != StageOK && v6.FailedAt != StageDNS {
+		hints = append(hints, "IPv4 works but IPv6 does not even though the name has an AAAA record; clients that prefer IPv6 will stall until they fall back. Fix IPv6 routing or prefer IPv4.")
+	}
+	if v6.FailedAt == StageOK && v4.FailedAt != StageOK && v4.FailedAt != StageDNS {
+		hints = append(hints, "IPv6 works but IPv4 does not; check IPv4 egress (NAT, proxy) on this network.")
+	}
+
+	return hints
+}
+
+// PrintNetTestReport prints the network test results for humans
+func PrintNetTestReport(report *NetTestReport) {
+	fmt.Printf("Network path to %s (port %s):\n", report.Host, report.Port)
+	for _, r := range report.Results {
+		if r.FailedAt == StageDNS {
+			fmt.Printf("  %s: no address (%v)\n", r.Family, r.Err)
+			continue
+		}
+
+		fmt.Printf("  %s %s:\n", r.Family, r.Address)
+		fmt.Printf("    TCP connect:   %s\n", formatStage(r, StageTCP, r.TCPConnect))
+		fmt.Printf("    TLS handshake: %s\n", formatStage(r, StageTLS, r.TLSHandshake))
+		fmt.Printf("    First byte:    %s\n", formatStage(r, StageFirstByte, r.FirstByte))
+	}
+
+	if len(report.Hints) > 0 {
+		fmt.Println("\nHints:")
+		for _, hint := range report.Hints {
+			fmt.Printf("  - %s\n", hint)
+		}
+	}
+}
+
+// formatStage renders a stage timing, or why the stage failed or was not reached
+func formatStage(r NetTestResult, stage NetTestStage, d time.Duration) string {
+	order := map[NetTestStage]int{StageDNS: 0, StageTCP: 1, StageTLS: 2, StageFirstByte: 3, StageOK: 4}
+	switch {
+	case r.FailedAt == stage:
+		return fmt.Sprintf("FAILED after %s (%v)", d.Round(time.Millisecond), r.Err)
+	case order[r.FailedAt] < order[stage]:
+		return "not reached"
+	default:
+		return d.Round(time.Millisecond).String()
+	}
+}
+
+// isTimeout reports whether err is a network timeout
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout() || errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// errOrNoAddress returns err, or a generic error when the lookup returned no addresses
+func errOrNoAddress(err error) error {
+	if err != nil {
+		return err
+	}
+	return errors.New("no addresses returned")
+}
+
+// otherFamily returns the address family that is not family
+func otherFamily(family string) string {
+	if family == "ipv4" {
+		return "ipv6"
+	}
+	return "ipv4"
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DefaultNodePoolTimeout bounds creating or deleting a node pool, which takes several minutes on
+// every provider
+const DefaultNodePoolTimeout = 30 * time.Minute
+
+// NodePoolAutoscaling is the size range the provider's autoscaler keeps a node pool in. EKS does
+// not scale node groups itself; the range bounds the Cluster Autoscaler or Karpenter.
+type NodePoolAutoscaling struct {
+	Min int32 `json:"min"`
+	Max int32 `json:"max"`
+}
+
+// NodePoolSpec describes a node pool in provider-neutral terms: an EKS managed node group, a GKE
+// node pool or an AKS user agent pool
+type NodePoolSpec struct {
+	Name string `json:"name"`
+	// MachineType is the EC2 instance type, GCE machine type or Azure VM size of the nodes
+	MachineType string `json:"machineType"`
+	// Count is the initial number of nodes; on GKE it is per zone of the cluster
+	Count       int32                `json:"count"`
+	Autoscaling *NodePoolAutoscaling `json:"autoscaling,omitempty"`
+	Labels      map[string]string    `json:"labels,omitempty"`
+	Taints      []corev1.Taint       `json:"taints,omitempty"`
+	// NodeRole is the IAM role ARN of EKS nodes; by default the role of an existing node group
+	// is reused. Other providers ignore it.
+	NodeRole string `json:"nodeRole,omitempty"`
+}
+
+// Validate checks the settings every provider requires
+func (s NodePoolSpec) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("node pool name is required")
+	}
+	if errs := validation.IsDNS1123Label(s.Name); len(errs) > 0 {
+		return fmt.Errorf("invalid node pool name %q: %s", s.Name, strings.Join(errs, "; "))
+	}
+	if s.MachineType == "" {
+		return fmt.Errorf("node pool machine type is required")
+	}
+	if s.Count < 0 {
+		return fmt.Errorf("node pool count must not be negative")
+	}
+	if a := s.Autoscaling; a != nil {
+		if a.Min < 0 || a.Max < 1 || a.Min > a.Max {
+			return fmt.Errorf("invalid node pool autoscaling range %d-%d", a.Min, a.Max)
+		}
+		if s.Count < a.Min || s.Count > a.Max {
+			return fmt.Errorf("node pool count %d is outside the autoscaling range %d-%d", s.Count, a.Min, a.Max)
+		}
+	}
+	for key, value := range s.Labels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid label key %q: %s", key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("invalid value of label %s: %s", key, strings.Join(errs, "; "))
+		}
+	}
+	for _, taint := range s.Taints {
+		if errs := validation.IsQualifiedName(taint.Key); len(errs) > 0 {
+			return fmt.Errorf("invalid taint key %q: %s", taint.Key, strings.Join(errs, "; "))
+		}
+		switch taint.Effect {
+		case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			return fmt.Errorf("invalid effect %q of taint %s", taint.Effect, taint.Key)
+		}
+	}
+	return nil
+}
+
+// ParseTaints parses comma-separated taints in kubectl's key[=value]:Effect form
+func ParseTaints(value string) ([]corev1.Taint, error) {
+	var taints []corev1.Taint
+	for _, spec := range strings.Split(value, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		keyValue, effect, ok := strings.Cut(spec, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid taint %q, expected key[=value]:Effect", spec)
+		}
+		key, val, _ := strings.Cut(keyValue, "=")
+		taints = append(taints, corev1.Taint{Key: key, Value: val, Effect: corev1.TaintEffect(effect)})
+	}
+	return taints, nil
+}
+
+// nodePoolManager is implemented by clients that can add and remove node pools of their cluster.
+// Both calls return once the provider reports the operation finished.
+type nodePoolManager interface {
+	CreateNodePool(ctx context.Context, spec NodePoolSpec) error
+	DeleteNodePool(ctx context.Context, name string) error
+}
+
+// CreateNodePool adds the node pool described by spec to client's cluster and waits until its
+// nodes are provisioned
+func CreateNodePool(ctx context.Context, client ClusterClient, spec NodePoolSpec) error {
+	manager, ok := client.(nodePoolManager)
+	if !ok {
+		return fmt.Errorf("%s clients cannot manage node pools", client.Identity().Provider)
+	}
+	if err := spec.Validate(); err != nil {
+		return err
+	}
+	step := progress.Start(fmt.Sprintf("Creating node pool %s", spec.Name))
+	defer step.Done()
+	return manager.CreateNodePool(ctx, spec)
+}
+
+// DeleteNodePool removes the node pool name from client's cluster and waits until it is gone
+func DeleteNodePool(ctx context.Context, client ClusterClient, name string) error {
+	manager, ok := client.(nodePoolManager)
+	if !ok {
+		return fmt.Errorf("%s clients cannot manage node pools", client.Identity().Provider)
+	}
+	if name == "" {
+		return fmt.Errorf("node pool name is required")
+	}
+	step := progress.Start(fmt.Sprintf("Deleting node pool %s", name))
+	defer step.Done()
+	return manager.DeleteNodePool(ctx, name)
+}
+
+// nodePoolWait is how long a provider waiter may wait for a node pool operation: the time left
+// before ctx's deadline, or DefaultNodePoolTimeout without one
+func nodePoolWait(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+	return DefaultNodePoolTimeout
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultNotifyAfter is how many consecutive runs a changed check result must persist before it
+// is notified
+const DefaultNotifyAfter = 2
+
+// notifyHTTPTimeout bounds a notification POST
+const notifyHTTPTimeout = 30 * time.Second
+
+// connectionCheckName is the check a cluster's reachability is tracked under. A cluster that
+// could not be connected to has no check results, and is reported as failing it.
+const connectionCheckName = "connection"
+
+// CheckTransition is a change of a check's result on a cluster between fleet daemon runs, or
+// the warning or failing result of a check in the first run
+type CheckTransition struct {
+	Cluster  ClusterIdentity
+	Check    string
+	Previous CheckStatus // empty in the first run
+	Current  CheckStatus
+	Message  string // of the current result
+	// PreviousSince is when the check entered the previous state, and PreviousDuration how long
+	// it stayed in it
+	PreviousSince    time.Time
+	PreviousDuration time.Duration
+	At               time.Time // when the current state was first seen
+}
+
+// Initial reports whether the transition is a result of the first run rather than a change
+func (t CheckTransition) Initial() bool {
+	return t.Previous == ""
+}
+
+// String describes the transition for humans, e.g. "eks/123/us-east-1/prod pdb: pass → fail
+// after 3h0m0s: 2 PDBs block evictions"
+func (t CheckTransition) String() string {
+	text := fmt.Sprintf("%s %s: %s → %s after %s", t.Cluster.Key(), t.Check, t.Previous, t.Current,
+		t.PreviousDuration.Round(time.Second))
+	if t.Initial() {
+		text = fmt.Sprintf("%s %s: %s on the first run", t.Cluster.Key(), t.Check, t.Current)
+	}
+	if t.Message != "" {
+		text += ": " + Redact(t.Message)
+	}
+	return text
+}
+
+// checkState is the last notified state of one check of one cluster
+type checkState struct {
+	status CheckStatus
+	since  time.Time
+	// candidate is a different status seen in the latest runs but not yet notified
+	candidate      CheckStatus
+	candidateRuns  int
+	candidateSince time.Time
+}
+
+// CheckStateTracker follows the check results of consecutive fleet runs and reports the checks
+// whose result changed. A new result must persist for a number of runs before it counts as a
+// change, so a flapping check does not notify on every run. The first run records the results
+// it sees, returning those that warn or fail as initial transitions for alerting integrations
+// to raise alerts that may predate a restart.
+type CheckStateTracker struct {
+	stableRuns int
+	states     map[string]*checkState // by cluster key and check name
+}
+
+// NewCheckStateTracker returns a tracker reporting changes that persisted for stableRuns runs
+func NewCheckStateTracker(stableRuns int) *CheckStateTracker {
+	if stableRuns < 1 {
+		stableRuns = 1
+	}
+	return &CheckStateTracker{stableRuns: stableRuns, states: map[string]*checkState{}}
+}
+
+// Observe records the check results of report and returns the changes they complete. Checks
+// skipped because a dependency failed keep their state, so an unreachable cluster is notified
+// once, as a failing connection, rather than once per check.
+func (t *CheckStateTracker) Observe(report *Report) []CheckTransition {
+	var transitions []CheckTransition
+	clusters := map[string]bool{}
+	for _, result := range report.Results {
+		identity := result.Cluster.Identity()
+		clusters[identity.Key()] = true
+
+		checks := resultChecks(result)
+		if len(checks) == 0 {
+			if result.Err == nil {
+				continue
+			}
+			checks = []CheckResult{{Name: connectionCheckName, Status: CheckFail, Message: result.Err.Error()}}
+		} else if !hasCheck(checks, connectionCheckName) {
+			checks = append(append([]CheckResult{}, checks...), CheckResult{Name: connectionCheckName, Status: CheckPass, Message: "connected"})
+		}
+
+		for _, check := range checks {
+			if isDependencySkip(check) {
+				continue
+			}
+			if transition, ok := t.observe(identity, check, report.Finished); ok {
+				transitions = append(transitions, transition)
+			}
+		}
+	}
+
+	// Forget the clusters no longer in the fleet
+	for key := range t.states {
+		cluster, _, _ := strings.Cut(key, "\x00")
+		if !clusters[cluster] {
+			delete(t.states, key)
+		}
+	}
+	return transitions
+}
+
+// observe records one check result seen at now
+func (t *CheckStateTracker) observe(identity ClusterIdentity, check CheckResult, now time.Time) (CheckTransition, bool) {
+	key := identity.Key() + "\x00" + check.Name
+	state, ok := t.states[key]
+	if !ok {
+		t.states[key] = &checkState{status: check.Status, since: now}
+		if check.Status.AtLeast(CheckWarn) {
+			return CheckTransition{Cluster: identity, Check: check.Name, Current: check.Status, Message: check.Message, At: now}, true
+		}
+		return CheckTransition{}, false
+	}
+	if check.Status == state.status {
+		state.candidate, state.candidateRuns = "", 0
+		return CheckTransition{}, false
+	}
+
+	if check.Status != state.candidate {
+		state.candidate, state.candidateRuns, state.candidateSince = check.Status, 0, now
+	}
+	state.candidateRuns++
+	if state.candidateRuns < t.stableRuns {
+		Verbosef("%s %s is %s, notified after %d more run(s)", identity.Key(), check.Name, check.Status, t.stableRuns-state.candidateRuns)
+		return CheckTransition{}, false
+	}
+
+	transition := CheckTransition{
+		Cluster:          identity,
+		Check:            check.Name,
+		Previous:         state.status,
+		Current:          check.Status,
+		Message:          check.Message,
+		PreviousSince:    state.since,
+		PreviousDuration: state.candidateSince.Sub(state.since),
+		At:               state.candidateSince,
+	}
+	*state = checkState{status: check.Status, since: state.candidateSince}
+	return transition, true
+}
+
+// hasCheck reports whether results include the check name
+func hasCheck(results []CheckResult, name string) bool {
+	for _, result := range results {
+		if result.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Notifier delivers the check result changes of a fleet daemon run. Any number of notifiers can
+// be active at once.
+type Notifier interface {
+	// Name describes the destination, without credentials
+	Name() string
+	Notify(ctx context.Context, transitions []CheckTransition) error
+	Close() error
+}
+
+// NewNotifier opens the notifier described by spec:
+//
+//	http://, https://   POSTed as JSON, with a text summary Slack and Teams webhooks display
+//	pagerduty           PagerDuty Events API v2, with PAGERDUTY_ROUTING_KEY
+//	opsgenie[:eu]       Opsgenie alerts on the US or EU instance, with OPSGENIE_API_KEY
+func NewNotifier(spec string) (Notifier, error) {
+	kind, err := notifierKind(spec)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: notifyHTTPTimeout}
+	switch kind {
+	case "pagerduty":
+		if credentialValue("PAGERDUTY_ROUTING_KEY") == "" {
+			return nil, errors.New("notifier pagerduty needs PAGERDUTY_ROUTING_KEY")
+		}
+		return pagerDutyNotifier{endpoint: pagerDutyEventsURL, client: client}, nil
+	case "opsgenie":
+		if credentialValue("OPSGENIE_API_KEY") == "" {
+			return nil, errors.New("notifier opsgenie needs OPSGENIE_API_KEY")
+		}
+		endpoint := opsgenieAlertsURL
+		if spec == "opsgenie:eu" {
+			endpoint = opsgenieEUAlertsURL
+		}
+		return opsgenieNotifier{endpoint: endpoint, client: client}, nil
+	default:
+		return webhookNotifier{url: spec, client: client}, nil
+	}
+}
+
+// notifierKind validates spec without opening it and returns the kind of notifier it describes
+func notifierKind(spec string) (string, error) {
+	scheme, rest, _ := strings.Cut(spec, ":")
+	switch scheme {
+	case "http", "https":
+		if _, err := url.ParseRequestURI(spec); err != nil {
+			return "", fmt.Errorf("invalid notifier %q: %w", Redact(spec), err)
+		}
+		return "webhook", nil
+	case "pagerduty":
+		if rest != "" {
+			return "", fmt.Errorf("invalid notifier %q: the routing key is read from PAGERDUTY_ROUTING_KEY", Redact(spec))
+		}
+		return "pagerduty", nil
+	case "opsgenie":
+		if rest != "" && rest != "eu" {
+			return "", fmt.Errorf("invalid notifier %q (expected opsgenie or opsgenie:eu)", Redact(spec))
+		}
+		return "opsgenie", nil
+	default:
+		return "", fmt.Errorf("unknown notifier %q (expected an http:// or https:// webhook URL, pagerduty or opsgenie)", Redact(spec))
+	}
+}
+
+// NewNotifiers opens the notifiers of a comma-separated list of specs
+func NewNotifiers(specs string) ([]Notifier, error) {
+	var notifiers []Notifier
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		notifier, err := NewNotifier(spec)
+		if err != nil {
+			closeNotifiers(notifiers)
+			return nil, err
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	return notifiers, nil
+}
+
+// maxPendingTransitions bounds the transitions kept for a notifier that keeps failing; the
+// oldest are dropped beyond it
+const maxPendingTransitions = 1000
+
+// NotificationQueue delivers the transitions of consecutive fleet daemon runs. A notifier that
+// fails keeps the transitions of that run and gets them again, before the next run's, so a
+// trigger or resolve is not lost to a transient outage. PagerDuty and Opsgenie deduplicate by
+// alert key, so resending transitions they partly accepted is safe.
+type NotificationQueue struct {
+	notifiers []Notifier
+	pending   [][]CheckTransition // by notifier
+}
+
+// NewNotificationQueue returns a queue delivering to notifiers
+func NewNotificationQueue(notifiers []Notifier) *NotificationQueue {
+	return &NotificationQueue{notifiers: notifiers, pending: make([][]CheckTransition, len(notifiers))}
+}
+
+// Send delivers the transitions still pending and then transitions to every notifier,
+// returning the failures of all notifiers that failed
+func (q *NotificationQueue) Send(ctx context.Context, transitions []CheckTransition) error {
+	var errs []error
+	for i, notifier := range q.notifiers {
+		batch := append(q.pending[i], transitions...)
+		if len(batch) == 0 {
+			continue
+		}
+		if err := notifier.Notify(ctx, batch); err != nil {
+			notifications.WithLabelValues("failure").Inc()
+			if dropped := len(batch) - maxPendingTransitions; dropped > 0 {
+				Warnf("Dropping %d undelivered check result change(s) for %s", dropped, notifier.Name())
+				batch = batch[dropped:]
+			}
+			q.pending[i] = batch
+			errs = append(errs, fmt.Errorf("failed to notify %s, retrying with the next run: %w", notifier.Name(), err))
+			continue
+		}
+		notifications.WithLabelValues("success").Inc()
+		q.pending[i] = nil
+	}
+	return errors.Join(errs...)
+}
+
+// closeNotifiers closes every notifier
+func closeNotifiers(notifiers []Notifier) {
+	for _, notifier := range notifiers {
+		notifier.Close()
+	}
+}
+
+// webhookPayload is the JSON body POSTed by the webhook notifier
+type webhookPayload struct {
+	Text        string              `json:"text"`
+	Transitions []webhookTransition `json:"transitions"`
+}
+
+// webhookTransition is a CheckTransition in a webhook payload
+type webhookTransition struct {
+	Cluster                 string      `json:"cluster"`
+	Provider                Provider    `json:"provider"`
+	Check                   string      `json:"check"`
+	Previous                CheckStatus `json:"previous"`
+	Current                 CheckStatus `json:"current"`
+	Message                 string      `json:"message,omitempty"`
+	PreviousSince           time.Time   `json:"previous_since"`
+	PreviousDurationSeconds int64       `json:"previous_duration_seconds"`
+	ChangedAt               time.Time   `json:"changed_at"`
+}
+
+// webhookNotifier POSTs the transitions of a run to a webhook endpoint
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n webhookNotifier) Name() string { return Redact(n.url) }
+
+func (n webhookNotifier) Notify(ctx context.Context, transitions []CheckTransition) error {
+	var changes []CheckTransition
+	for _, t := range transitions {
+		if !t.Initial() {
+			changes = append(changes, t)
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	payload := webhookPayload{Text: fmt.Sprintf("%d check result(s) changed:", len(changes))}
+	for _, t := range changes {
+		payload.Text += "\n• " + t.String()
+		payload.Transitions = append(payload.Transitions, webhookTransition{
+			Cluster:                 t.Cluster.Key(),
+			Provider:                t.Cluster.Provider,
+			Check:                   t.Check,
+			Previous:                t.Previous,
+			Current:                 t.Current,
+			Message:                 Redact(t.Message),
+			PreviousSince:           t.PreviousSince.UTC(),
+			PreviousDurationSeconds: int64(t.PreviousDuration.Seconds()),
+			ChangedAt:               t.At.UTC(),
+		})
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post notification: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notification endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (n webhookNotifier) Close() error { return nil }
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ObjectStore writes objects to a bucket or container under a fixed prefix
+type ObjectStore interface {
+	// Put writes data to key, relative to the store's prefix
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// URL returns the location key is written to
+	URL(key string) string
+	Close() error
+}
+
+// ObjectStoreLocation is a parsed object storage URL
+type ObjectStoreLocation struct {
+	Scheme  string // s3, gs or https (Azure Blob)
+	Account string // Azure storage account URL, e.g. https://acct.blob.core.windows.net
+	Bucket  string // S3 or GCS bucket, or Azure container
+	Prefix  string // object key prefix, without leading or trailing slashes
+	Region  string // S3 bucket region (optional ?region= parameter)
+}
+
+// ParseObjectStoreLocation parses s3://bucket/prefix[?region=...], gs://bucket/prefix or
+// https://<account>.blob.core.windows.net/<container>/prefix
+func ParseObjectStoreLocation(raw string) (ObjectStoreLocation, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ObjectStoreLocation{}, fmt.Errorf("invalid object storage URL %q: %w", raw, err)
+	}
+
+	location := ObjectStoreLocation{Scheme: u.Scheme, Region: u.Query().Get("region")}
+	switch u.Scheme {
+	case "s3", "gs":
+		location.Bucket = u.Host
+		location.Prefix = strings.Trim(u.Path, "/")
+	case "https":
+		if !strings.Contains(u.Host, ".blob.") {
+			return ObjectStoreLocation{}, fmt.Errorf("invalid object storage URL %q: https URLs must be Azure Blob endpoints (<account>.blob.core.windows.net)", raw)
+		}
+		container, prefix, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+		location.Account = "https://" + u.Host
+		location.Bucket = container
+		location.Prefix = prefix
+	default:
+		return ObjectStoreLocation{}, fmt.Errorf("invalid object storage URL %q: expected s3://, gs:// or an Azure Blob https:// URL", raw)
+	}
+	if location.Bucket == "" {
+		return ObjectStoreLocation{}, fmt.Errorf("invalid object storage URL %q: bucket or container is missing", raw)
+	}
+	if location.Region != "" && location.Scheme != "s3" {
+		return ObjectStoreLocation{}, fmt.Errorf("invalid object storage URL %q: region applies to s3:// URLs only", raw)
+	}
+	return location, nil
+}
+
+// key joins name to the location's prefix
+func (l ObjectStoreLocation) key(name string) string {
+	return path.Join(l.Prefix, name)
+}
+
+// URL returns the location of the object name
+func (l ObjectStoreLocation) URL(name string) string {
+	if l.Scheme == "https" {
+		return fmt.Sprintf("%s/%s/%s", l.Account, l.Bucket, l.key(name))
+	}
+	return fmt.Sprintf("%s://%s/%s", l.Scheme, l.Bucket, l.key(name))
+}
+
+// NewObjectStore opens the bucket or container at raw with the environment's credentials for
+// its cloud, resolved the same way as for connecting to clusters: AWS_* for S3,
+// GOOGLE_CLOUD_PROJECT and GOOGLE_* for GCS, AZURE_* or the Azure CLI for Azure Blob
+func NewObjectStore(ctx context.Context, raw string) (ObjectStore, error) {
+	location, err := ParseObjectStoreLocation(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	switch location.Scheme {
+	case "s3":
+		region := os.Getenv("AWS_REGION")
+		if region == "" {
+			region = AWSDefaultRegion
+		}
+		manager, err := NewAWSClientManager(awsCredentialsFromEnv(region))
+		if err != nil {
+			return nil, err
+		}
+		return &s3Store{ObjectStoreLocation: location, client: manager.NewS3Client(location.Region)}, nil
+	case "gs":
+		gcpConfig := GCPConfig{ProjectID: os.Getenv("GOOGLE_CLOUD_PROJECT")}
+		if gcpConfig.ProjectID == "" {
+			return nil, fmt.Errorf("GOOGLE_CLOUD_PROJECT environment variable is required for gs:// URLs")
+		}
+		if err := applyGCPCredentialsFromEnv(&gcpConfig); err != nil {
+			return nil, err
+		}
+		manager, err := NewGCPClientManager(gcpConfig)
+		if err != nil {
+			return nil, err
+		}
+		return &gcsStore{ObjectStoreLocation: location, manager: manager}, nil
+	default:
+		cred, err := createAzureCredential()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Azure credential: %w", err)
+		}
+		client, err := azblob.NewClient(location.Account, cred, &azblob.ClientOptions{ClientOptions: azureClientOptions()})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Azure Blob client: %w", err)
+		}
+		return &azureBlobStore{ObjectStoreLocation: location, client: client}, nil
+	}
+}
+
+// s3Store writes objects to an S3 bucket
+type s3Store struct {
+	ObjectStoreLocation
+	client *s3.Client
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(s.key(key)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", s.URL(key), err)
+	}
+	return nil
+}
+
+func (s *s3Store) Close() error { return nil }
+
+// gcsStore writes objects to a Cloud Storage bucket
+type gcsStore struct {
+	ObjectStoreLocation
+	manager *GCPClientManager
+}
+
+func (s *gcsStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	w := s.manager.GetStorageClient().Bucket(s.Bucket).Object(s.key(key)).NewWriter(ctx)
+	w.ContentType = contentType
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to upload %s: %w", s.URL(key), err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", s.URL(key), err)
+	}
+	return nil
+}
+
+func (s *gcsStore) Close() error { return s.manager.Close() }
+
+// azureBlobStore writes blobs to an Azure Storage container
+type azureBlobStore struct {
+	ObjectStoreLocation
+	client *azblob.Client
+}
+
+func (s *azureBlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := s.client.UploadBuffer(ctx, s.Bucket, s.key(key), data, &azblob.UploadBufferOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: &contentType},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", s.URL(key), err)
+	}
+	return nil
+}
+
+func (s *azureBlobStore) Close() error { return nil }
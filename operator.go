@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/go-logr/logr/funcr"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ClusterConnectionCRD is the CustomResourceDefinition of ClusterConnection, applied before
+// running the operator
+//
+//go:embed clusterconnection-crd.yaml
+var ClusterConnectionCRD []byte
+
+// ClusterConnectionGroupVersion is the API group and version of ClusterConnection
+var ClusterConnectionGroupVersion = schema.GroupVersion{Group: "connect.hmsayem.github.io", Version: "v1alpha1"}
+
+// DefaultProbeInterval is how often a ClusterConnection is probed when its spec sets no interval
+const DefaultProbeInterval = 5 * time.Minute
+
+// probeStageTimeout bounds each stage of a ClusterConnection probe
+const probeStageTimeout = 10 * time.Second
+
+// ClusterConnection phases
+const (
+	ConnectionConnected = "Connected"
+	ConnectionFailed    = "Failed"
+)
+
+// ClusterConnection condition types. Reachable covers the credentials, DNS, TCP and TLS stages
+// of the connection, Authenticated the API server accepting the token and RBAC allowing it to
+// list namespaces, and Ready the whole connection including /readyz.
+const (
+	ConditionReachable     = "Reachable"
+	ConditionAuthenticated = "Authenticated"
+	ConditionReady         = "Ready"
+)
+
+// operatorEventSource is the component Events of ClusterConnections are reported by
+const operatorEventSource = "clusterconnection-operator"
+
+// ClusterConnection declares a managed cluster whose connectivity the operator maintains in
+// the resource's status
+type ClusterConnection struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterConnectionSpec   `json:"spec"`
+	Status ClusterConnectionStatus `json:"status,omitempty"`
+}
+
+// ClusterConnectionSpec describes the target cluster like a fleet config entry, with the
+// credentials read from a Secret instead of the environment
+type ClusterConnectionSpec struct {
+	Provider      Provider `json:"provider"`
+	Name          string   `json:"name"`
+	Account       string   `json:"account,omitempty"`       // Azure subscription ID or GCP project ID
+	Region        string   `json:"region,omitempty"`        // AWS region or GKE zone/region
+	ResourceGroup string   `json:"resourceGroup,omitempty"` // AKS only
+
+	// CredentialsSecretRef names a Secret in the resource's namespace holding the provider
+	// credentials under the keys of their environment variables (AWS_ACCESS_KEY_ID,
+	// AZURE_CLIENT_SECRET, GCP_CREDENTIALS_JSON, ...); without it the operator's own
+	// credentials are used
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+	// Interval is how often the connection is probed (default DefaultProbeInterval)
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	ClusterCredentials `json:",inline"`
+}
+
+// ClusterConnectionStatus is the outcome of the latest connection probe
+type ClusterConnectionStatus struct {
+	Phase              string       `json:"phase,omitempty"`
+	Message            string       `json:"message,omitempty"`
+	ServerVersion      string       `json:"serverVersion,omitempty"`
+	Endpoint           string       `json:"endpoint,omitempty"`
+	LastProbeTime      *metav1.Time `json:"lastProbeTime,omitempty"`
+	LastConnectedTime  *metav1.Time `json:"lastConnectedTime,omitempty"`
+	ObservedGeneration int64        `json:"observedGeneration,omitempty"`
+	// Conditions are Reachable, Authenticated and Ready, each with the reason of the stage that
+	// failed
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ClusterConnectionList is a list of ClusterConnections
+type ClusterConnectionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterConnection `json:"items"`
+}
+
+// AddClusterConnectionToScheme registers ClusterConnection with a scheme, for NewScheme
+func AddClusterConnectionToScheme(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(ClusterConnectionGroupVersion, &ClusterConnection{}, &ClusterConnectionList{})
+	metav1.AddToGroupVersion(scheme, ClusterConnectionGroupVersion)
+	return nil
+}
+
+// DeepCopyInto copies the connection into out
+func (c *ClusterConnection) DeepCopyInto(out *ClusterConnection) {
+	*out = *c
+	c.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if c.Spec.CredentialsSecretRef != nil {
+		ref := *c.Spec.CredentialsSecretRef
+		out.Spec.CredentialsSecretRef = &ref
+	}
+	if c.Spec.Interval != nil {
+		interval := *c.Spec.Interval
+		out.Spec.Interval = &interval
+	}
+	out.Spec.GCPKubernetesScopes = append([]string(nil), c.Spec.GCPKubernetesScopes...)
+	out.Status.LastProbeTime = c.Status.LastProbeTime.DeepCopy()
+	out.Status.LastConnectedTime = c.Status.LastConnectedTime.DeepCopy()
+	out.Status.Conditions = append([]metav1.Condition(nil), c.Status.Conditions...)
+}
+
+// DeepCopyObject implements runtime.Object
+func (c *ClusterConnection) DeepCopyObject() runtime.Object {
+	out := &ClusterConnection{}
+	c.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object
+func (l *ClusterConnectionList) DeepCopyObject() runtime.Object {
+	out := &ClusterConnectionList{TypeMeta: l.TypeMeta}
+	l.ListMeta.DeepCopyInto(&out.ListMeta)
+	if l.Items != nil {
+		out.Items = make([]ClusterConnection, len(l.Items))
+		for i := range l.Items {
+			l.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+	return out
+}
+
+// interval returns how often the connection is probed
+func (c *ClusterConnection) interval() time.Duration {
+	if c.Spec.Interval != nil && c.Spec.Interval.Duration > 0 {
+		return c.Spec.Interval.Duration
+	}
+	return DefaultProbeInterval
+}
+
+// fleetCluster returns the fleet entry the spec describes, so it is validated and connected
+// like one
+func (s ClusterConnectionSpec) fleetCluster() FleetCluster {
+	return FleetCluster{
+		Provider:           s.Provider,
+		Name:               s.Name,
+		Account:            s.Account,
+		Region:             s.Region,
+		ResourceGroup:      s.ResourceGroup,
+		ClusterCredentials: s.ClusterCredentials,
+		credentials:        s.ClusterCredentials,
+	}
+}
+
+// ClusterConnectionReconciler probes the cluster of each ClusterConnection and records the
+// outcome in its status and conditions, probing again after the connection's interval. Only
+// spec changes trigger a probe early, so its own status updates do not. Failures, recoveries
+// and version changes are recorded as Events on the resource when Recorder is set.
+type ClusterConnectionReconciler struct {
+	Client ctrlclient.Client
+	// SecretReader reads the referenced credential Secrets, Client when nil. The manager's
+	// uncached API reader only needs get on those Secrets, where the cached client would watch
+	// every Secret of the cluster.
+	SecretReader ctrlclient.Reader
+	Recorder     record.EventRecorder
+}
+
+// connectionProbe is the outcome of probing a ClusterConnection
+type connectionProbe struct {
+	Version  string
+	Endpoint string
+	// Reached is the last connection stage that succeeded, and Failed the one that failed
+	Reached ConnectionStage
+	Failed  ConnectionStage
+	// Reason is the CamelCase condition reason of a failure, e.g. TLSFailed
+	Reason string
+	Err    error
+}
+
+// connectionStageReasons are the condition reasons of failures at each connection stage
+var connectionStageReasons = map[ConnectionStage]string{
+	ConnectionCredentials:   "CredentialsFailed",
+	ConnectionDNS:           "DNSFailed",
+	ConnectionTCP:           "TCPFailed",
+	ConnectionTLS:           "TLSFailed",
+	ConnectionAuthenticated: "AuthenticationFailed",
+	ConnectionAuthorized:    "AuthorizationFailed",
+	ConnectionHealthy:       "NotReady",
+}
+
+// Reconcile probes one ClusterConnection
+func (r *ClusterConnectionReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	var conn ClusterConnection
+	if err := r.Client.Get(ctx, req.NamespacedName, &conn); err != nil {
+		return reconcile.Result{}, ctrlclient.IgnoreNotFound(err)
+	}
+
+	previous := conn.Status
+	status := conn.Status
+	now := metav1.Now()
+	status.LastProbeTime = &now
+	status.ObservedGeneration = conn.Generation
+	probe := r.probe(ctx, &conn)
+	if probe.Err != nil {
+		status.Phase = ConnectionFailed
+		status.Message = Redact(probe.Err.Error())
+		Warnf("ClusterConnection %s: %s", req.NamespacedName, status.Message)
+		r.event(&conn, corev1.EventTypeWarning, probe.Reason, status.Message)
+	} else {
+		status.Phase = ConnectionConnected
+		status.Message = ""
+		status.ServerVersion = probe.Version
+		status.Endpoint = probe.Endpoint
+		status.LastConnectedTime = &now
+		Verbosef("ClusterConnection %s: connected to Kubernetes %s", req.NamespacedName, probe.Version)
+		if previous.Phase != ConnectionConnected {
+			r.event(&conn, corev1.EventTypeNormal, "Connected", fmt.Sprintf("Connected to Kubernetes %s at %s", probe.Version, probe.Endpoint))
+		} else if previous.ServerVersion != "" && previous.ServerVersion != probe.Version {
+			r.event(&conn, corev1.EventTypeNormal, "VersionChanged", fmt.Sprintf("Kubernetes version changed from %s to %s", previous.ServerVersion, probe.Version))
+		}
+	}
+	setConnectionConditions(&status, probe, conn.Generation)
+
+	conn.Status = status
+	if err := r.Client.Status().Update(ctx, &conn); err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to update status of %s: %w", req.NamespacedName, err)
+	}
+	return reconcile.Result{RequeueAfter: conn.interval()}, nil
+}
+
+// event records an Event on conn when the reconciler has a recorder
+func (r *ClusterConnectionReconciler) event(conn *ClusterConnection, eventType, reason, message string) {
+	if r.Recorder != nil {
+		r.Recorder.Event(conn, eventType, reason, message)
+	}
+}
+
+// probe connects to the connection's cluster stage by stage, like diagnose, and returns the
+// API server version and endpoint or the stage that failed
+func (r *ClusterConnectionReconciler) probe(ctx context.Context, conn *ClusterConnection) connectionProbe {
+	cluster := conn.Spec.fleetCluster()
+	if err := cluster.Validate(); err != nil {
+		return connectionProbe{Reason: "InvalidSpec", Err: err}
+	}
+
+	var secret map[string][]byte
+	if ref := conn.Spec.CredentialsSecretRef; ref != nil {
+		var credentials corev1.Secret
+		reader := r.SecretReader
+		if reader == nil {
+			reader = r.Client
+		}
+		if err := reader.Get(ctx, ctrlclient.ObjectKey{Namespace: conn.Namespace, Name: ref.Name}, &credentials); err != nil {
+			return connectionProbe{Reason: "SecretUnavailable", Err: fmt.Errorf("failed to read credentials secret %s: %w", ref.Name, err)}
+		}
+		secret = credentials.Data
+	}
+
+	client, err := connectWithSecret(cluster, secret)
+	if err != nil {
+		return connectionProbe{Failed: ConnectionCredentials, Reason: connectionStageReasons[ConnectionCredentials], Err: err}
+	}
+	defer client.Close()
+	report := DiagnoseConnection(ctx, client, probeStageTimeout)
+	probe := connectionProbe{Endpoint: report.Endpoint, Reached: report.Reached, Failed: report.Failed}
+	if err := report.Err(); err != nil {
+		probe.Reason, probe.Err = connectionStageReasons[report.Failed], fmt.Errorf("connection failed at stage %w", err)
+		return probe
+	}
+	version, err := client.Discovery().ServerVersion()
+	if err != nil {
+		probe.Reason, probe.Err = "VersionUnavailable", fmt.Errorf("failed to read the API server version: %w", err)
+		return probe
+	}
+	probe.Version = version.GitVersion
+	return probe
+}
+
+// setConnectionConditions sets the Reachable, Authenticated and Ready conditions of status
+// from probe. A condition whose stages were not attempted is Unknown.
+func setConnectionConditions(status *ClusterConnectionStatus, probe connectionProbe, generation int64) {
+	condition := func(conditionType string, first, last ConnectionStage, reason string) metav1.Condition {
+		c := metav1.Condition{Type: conditionType, ObservedGeneration: generation}
+		switch {
+		case probe.Reached >= last:
+			c.Status, c.Reason = metav1.ConditionTrue, reason
+		case probe.Failed >= first && probe.Failed <= last:
+			c.Status, c.Reason, c.Message = metav1.ConditionFalse, probe.Reason, Redact(probe.Err.Error())
+		default:
+			c.Status, c.Reason = metav1.ConditionUnknown, "NotProbed"
+			if probe.Reason != "" {
+				c.Reason = probe.Reason
+			}
+		}
+		return c
+	}
+	apimeta.SetStatusCondition(&status.Conditions, condition(ConditionReachable, ConnectionCredentials, ConnectionTLS, "Reachable"))
+	apimeta.SetStatusCondition(&status.Conditions, condition(ConditionAuthenticated, ConnectionAuthenticated, ConnectionAuthorized, "Authenticated"))
+
+	ready := metav1.Condition{Type: ConditionReady, Status: metav1.ConditionTrue, Reason: "Connected", ObservedGeneration: generation,
+		Message: fmt.Sprintf("Kubernetes %s", probe.Version)}
+	if probe.Err != nil {
+		ready.Status, ready.Reason, ready.Message = metav1.ConditionFalse, probe.Reason, Redact(probe.Err.Error())
+	}
+	apimeta.SetStatusCondition(&status.Conditions, ready)
+}
+
+// connectWithSecret connects to cluster with the credentials of a Secret's data, keyed by the
+// names of the environment variables they replace, or with the ambient credentials when data
+// is nil
+func connectWithSecret(cluster FleetCluster, data map[string][]byte) (ClusterClient, error) {
+	if data == nil {
+		return cluster.Connect()
+	}
+	for _, value := range data {
+		RegisterSecret(string(value))
+	}
+
+	switch cluster.Provider {
+	case ProviderAKS:
+		cred, err := azidentity.NewClientSecretCredential(string(data["AZURE_TENANT_ID"]), string(data["AZURE_CLIENT_ID"]),
+			string(data["AZURE_CLIENT_SECRET"]), &azidentity.ClientSecretCredentialOptions{ClientOptions: azureClientOptions()})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create service principal credential: %w", err)
+		}
+		return NewAKSClientWithOptions(cluster.Name, cluster.ResourceGroup, cluster.Account, cred,
+			AKSClientOptions{AADServerAppID: cluster.credentials.AzureAADServerAppID, Impersonate: impersonation})
+	case ProviderEKS:
+		cfg := cluster.awsConfig()
+		cfg.Profile = ""
+		cfg.AccessKey = string(data["AWS_ACCESS_KEY_ID"])
+		cfg.SecretKey = string(data["AWS_SECRET_ACCESS_KEY"])
+		cfg.SessionToken = string(data["AWS_SESSION_TOKEN"])
+		return NewEKSClientWithOptions(cluster.Name, cfg, EKSClientOptions{Impersonate: impersonation})
+	case ProviderGKE:
+		cfg := GCPConfig{
+			ProjectID:                 cluster.Account,
+			Zone:                      cluster.Region,
+			CredentialsJSON:           data["GCP_CREDENTIALS_JSON"],
+			ImpersonateServiceAccount: cluster.credentials.GCPImpersonateServiceAccount,
+			KubernetesScopes:          expandGCPScopes(cluster.credentials.GCPKubernetesScopes),
+			KubernetesAudience:        cluster.credentials.GCPKubernetesAudience,
+		}
+		return NewGKEClientWithOptions(cluster.Name, cfg, GKEClientOptions{Impersonate: impersonation})
+	default:
+		return nil, fmt.Errorf("unknown provider %q", cluster.Provider)
+	}
+}
+
+// OperatorOptions configures the ClusterConnection operator
+type OperatorOptions struct {
+	Namespace          string // only watch this namespace (default all)
+	Concurrency        int    // connections probed at once
+	MetricsAddress     string // ":8080", or "0" to disable the metrics endpoint
+	HealthProbeAddress string // address of the /healthz and /readyz endpoints
+	LeaderElection     bool   // elect a leader so only one replica probes
+}
+
+// RunOperator runs the ClusterConnection controller against the cluster of the in-cluster
+// config or kubeconfig until ctx is done
+func RunOperator(ctx context.Context, opts OperatorOptions) error {
+	ctrllog.SetLogger(funcr.New(func(prefix, args string) {
+		Verbosef("%s %s", prefix, args)
+	}, funcr.Options{}))
+
+	config, err := ctrl.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load the home cluster config: %w", err)
+	}
+	scheme, err := NewScheme(AddClusterConnectionToScheme)
+	if err != nil {
+		return err
+	}
+
+	managerOptions := ctrl.Options{
+		Scheme:                 scheme,
+		Metrics:                metricsserver.Options{BindAddress: opts.MetricsAddress},
+		HealthProbeBindAddress: opts.HealthProbeAddress,
+		LeaderElection:         opts.LeaderElection,
+		LeaderElectionID:       "clusterconnection-operator." + ClusterConnectionGroupVersion.Group,
+	}
+	if opts.Namespace != "" {
+		managerOptions.Cache.DefaultNamespaces = map[string]cache.Config{opts.Namespace: {}}
+	}
+	manager, err := ctrl.NewManager(config, managerOptions)
+	if err != nil {
+		return fmt.Errorf("failed to create controller manager: %w", err)
+	}
+	if err := manager.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		return fmt.Errorf("failed to add health check: %w", err)
+	}
+	if err := manager.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+		return fmt.Errorf("failed to add readiness check: %w", err)
+	}
+
+	err = ctrl.NewControllerManagedBy(manager).
+		For(&ClusterConnection{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{MaxConcurrentReconciles: max(opts.Concurrency, 1)}).
+		Complete(&ClusterConnectionReconciler{
+			Client:       manager.GetClient(),
+			SecretReader: manager.GetAPIReader(),
+			Recorder:     manager.GetEventRecorderFor(operatorEventSource),
+		})
+	if err != nil {
+		return fmt.Errorf("failed to create ClusterConnection controller: %w", err)
+	}
+
+	Infof("Watching ClusterConnections in %s", namespaceDescription(opts.Namespace))
+	if err := manager.Start(ctx); err != nil {
+		return fmt.Errorf("operator stopped: %w", err)
+	}
+	return nil
+}
+
+// namespaceDescription describes the namespace watched, where "" means all of them
+func namespaceDescription(namespace string) string {
+	if namespace == "" {
+		return "all namespaces"
+	}
+	return "namespace " + namespace
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PendingPodDiagnosis explains why a pod has been Pending for too long
+type PendingPodDiagnosis struct {
+	Namespace  string
+	Name       string
+	PendingFor time.Duration
+	Reasons    []string
+}
+
+// nodeCapacity tracks how much of a node's allocatable resources are still unrequested
+type nodeCapacity struct {
+	node       corev1.Node
+	freeCPU    resource.Quantity
+	freeMemory resource.Quantity
+}
+
+// DiagnosePendingPods finds pods that have been Pending longer than threshold and explains
+// why, cross-referencing the scheduler's conditions with node allocatable data, taints and
+// the state of the pods' persistent volume claims
+func DiagnosePendingPods(ctx context.Context, clientset kubernetes.Interface, threshold time.Duration) ([]PendingPodDiagnosis, error) {
+	var stuck []corev1.Pod
+	err := EachPod(ctx, clientset, "", metav1.ListOptions{FieldSelector: "status.phase=Pending"}, func(pod *corev1.Pod) error {
+		if time.Since(pod.CreationTimestamp.Time) >= threshold {
+			stuck = append(stuck, *pod)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(stuck) == 0 {
+		return nil, nil
+	}
+
+	capacities, err := nodeCapacities(ctx, clientset)
+	if err != nil {
+		return nil, err
+	}
+
+	diagnoses := make([]PendingPodDiagnosis, 0, len(stuck))
+	for _, pod := range stuck {
+		diagnosis := PendingPodDiagnosis{
+			Namespace:  pod.Namespace,
+			Name:       pod.Name,
+			PendingFor: time.Since(pod.CreationTimestamp.Time).Round(time.Second),
+		}
+
+		if pod.Spec.NodeName != "" {
+			diagnosis.Reasons = append(diagnosis.Reasons, containerWaitingReasons(pod)...)
+			if len(diagnosis.Reasons) == 0 {
+				diagnosis.Reasons = append(diagnosis.Reasons, fmt.Sprintf("scheduled to %s but containers have not started", pod.Spec.NodeName))
+			}
+		} else {
+			if message := unschedulableMessage(pod); message != "" {
+				diagnosis.Reasons = append(diagnosis.Reasons, "scheduler: "+message)
+			}
+			diagnosis.Reasons = append(diagnosis.Reasons, schedulingReasons(pod, capacities)...)
+
+			volumeReasons, err := volumeBindingReasons(ctx, clientset, pod)
+			if err != nil {
+				return nil, err
+			}
+			diagnosis.Reasons = append(diagnosis.Reasons, volumeReasons...)
+
+			if len(diagnosis.Reasons) == 0 {
+				diagnosis.Reasons = append(diagnosis.Reasons, "waiting for the scheduler; no obvious constraint found")
+			}
+		}
+
+		diagnoses = append(diagnoses, diagnosis)
+	}
+
+	sort.Slice(diagnoses, func(i, j int) bool {
+		return diagnoses[i].PendingFor > diagnoses[j].PendingFor
+	})
+
+	return diagnoses, nil
+}
+
+// CheckPendingPods reports pods stuck in Pending for longer than threshold
+func CheckPendingPods(ctx context.Context, client ClusterClient, threshold time.Duration) CheckResult {
+	result := CheckResult{Name: "pending-pods"}
+
+	diagnoses, err := DiagnosePendingPods(ctx, client.Clientset(), threshold)
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	if len(diagnoses) == 0 {
+		result.Status = CheckPass
+		result.Message = fmt.Sprintf("no pods pending longer than %s", threshold)
+		return result
+	}
+
+	result.Status = CheckFail
+	result.Message = fmt.Sprintf("%d pod(s) pending longer than %s", len(diagnoses), threshold)
+	for _, d := range diagnoses {
+		result.Details = append(result.Details, fmt.Sprintf("%s/%s (pending %s): %s",
+			d.Namespace, d.Name, d.PendingFor, strings.Join(d.Reasons, "; ")))
+	}
+
+	return result
+}
+
+// CheckPodDisruptionBudgets reports PodDisruptionBudgets that currently allow no disruptions,
+// which block node drains during upgrades and autoscaler scale-downs
+func CheckPodDisruptionBudgets(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "pdb"}
+
+	pdbs, err := client.Clientset().PolicyV1().PodDisruptionBudgets("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("failed to list PodDisruptionBudgets: %v", err)
+		return result
+	}
+
+	for _, pdb := range pdbs.Items {
+		if pdb.Status.DisruptionsAllowed > 0 {
+			continue
+		}
+		result.Details = append(result.Details, fmt.Sprintf("%s/%s allows 0 disruptions (%d/%d healthy, %d desired)",
+			pdb.Namespace, pdb.Name, pdb.Status.CurrentHealthy, pdb.Status.ExpectedPods, pdb.Status.DesiredHealthy))
+	}
+
+	if len(result.Details) == 0 {
+		result.Status = CheckPass
+		result.Message = fmt.Sprintf("%d PodDisruptionBudget(s), none blocking evictions", len(pdbs.Items))
+		return result
+	}
+
+	result.Status = CheckFail
+	result.Message = fmt.Sprintf("%d of %d PodDisruptionBudget(s) block evictions", len(result.Details), len(pdbs.Items))
+	return result
+}
+
+// nodeCapacities computes the unrequested CPU and memory of every schedulable node
+func nodeCapacities(ctx context.Context, clientset kubernetes.Interface) ([]nodeCapacity, error) {
+	nodes, err := ListNodesPaged(ctx, clientset, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	requested := map[string]corev1.ResourceList{}
+	err = EachPod(ctx, clientset, "", metav1.ListOptions{
+		FieldSelector: "status.phase!=Succeeded,status.phase!=Failed",
+	}, func(pod *corev1.Pod) error {
+		if pod.Spec.NodeName == "" {
+			return nil
+		}
+		total, ok := requested[pod.Spec.NodeName]
+		if !ok {
+			total = corev1.ResourceList{}
+		}
+		for name, quantity := range podRequests(*pod) {
+			sum := total[name]
+			sum.Add(quantity)
+			total[name] = sum
+		}
+		requested[pod.Spec.NodeName] = total
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	capacities := make([]nodeCapacity, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Spec.Unschedulable || !nodeReady(node) {
+			continue
+		}
+
+		freeCPU := node.Status.Allocatable.Cpu().DeepCopy()
+		freeMemory := node.Status.Allocatable.Memory().DeepCopy()
+		if used, ok := requested[node.Name]; ok {
+			freeCPU.Sub(*used.Cpu())
+			freeMemory.Sub(*used.Memory())
+		}
+
+		capacities = append(capacities, nodeCapacity{node: node, freeCPU: freeCPU, freeMemory: freeMemory})
+	}
+
+	return capacities, nil
+}
+
+// podRequests returns the effective resource requests of a pod: the sum of its containers'
+// requests, or the largest init container request if that is higher
+func podRequests(pod corev1.Pod) corev1.ResourceList {
+	total := corev1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		for name, quantity := range container.Resources.Requests {
+			sum := total[name]
+			sum.Add(quantity)
+			total[name] = sum
+		}
+	}
+
+	for _, container := range pod.Spec.InitContainers {
+		for name, quantity := range container.Resources.Requests {
+			if current, ok := total[name]; !ok || quantity.Cmp(current) > 0 {
+				total[name] = quantity.DeepCopy()
+			}
+		}
+	}
+
+	return total
+}
+
+// schedulingReasons checks the pod's node selector, taints and resource requests against
+// every schedulable node and explains which constraint leaves no node available
+func schedulingReasons(pod corev1.Pod, capacities []nodeCapacity) []string {
+	if len(capacities) == 0 {
+		return []string{"no Ready, schedulable nodes in the cluster"}
+	}
+
+	requests := podRequests(pod)
+	selector := labels.SelectorFromSet(pod.Spec.NodeSelector)
+
+	var selectorMatches, tolerated, fitting int
+	untolerated := map[string]bool{}
+	var maxFreeCPU, maxFreeMemory resource.Quantity
+
+	for _, capacity := range capacities {
+		if !selector.Matches(labels.Set(capacity.node.Labels)) {
+			continue
+		}
+		selectorMatches++
+
+		if taint := firstUntoleratedTaint(pod.Spec.Tolerations, capacity.node.Spec.Taints); taint != nil {
+			untolerated[taint.ToString()] = true
+			continue
+		}
+		tolerated++
+
+		if capacity.freeCPU.Cmp(maxFreeCPU) > 0 {
+			maxFreeCPU = capacity.freeCPU
+		}
+		if capacity.freeMemory.Cmp(maxFreeMemory) > 0 {
+			maxFreeMemory = capacity.freeMemory
+		}
+		if capacity.freeCPU.Cmp(*requests.Cpu()) >= 0 && capacity.freeMemory.Cmp(*requests.Memory()) >= 0 {
+			fitting++
+		}
+	}
+
+	switch {
+	case selectorMatches == 0:
+		return []string{fmt.Sprintf("no node matches nodeSelector %s", selector.String())}
+	case tolerated == 0:
+		taints := make([]string, 0, len(untolerated))
+		for taint := range untolerated {
+			taints = append(taints, taint)
+		}
+		sort.Strings(taints)
+		return []string{fmt.Sprintf("pod does not tolerate node taints: %s", strings.Join(taints, ", "))}
+	case fitting == 0:
+		var reasons []string
+		if requests.Cpu().Cmp(maxFreeCPU) > 0 {
+			reasons = append(reasons, fmt.Sprintf("insufficient cpu: requests %s, most free on any node %s",
+				requests.Cpu().String(), maxFreeCPU.String()))
+		}
+		if requests.Memory().Cmp(maxFreeMemory) > 0 {
+			reasons = append(reasons, fmt.Sprintf("insufficient memory: requests %s, most free on any node %s",
+				requests.Memory().String(), maxFreeMemory.String()))
+		}
+		if len(reasons) == 0 {
+			reasons = append(reasons, "no single node has enough free cpu and memory together")
+		}
+		return reasons
+	}
+
+	return nil
+}
+
+// volumeBindingReasons reports persistent volume claims used by the pod that are not bound
+func volumeBindingReasons(ctx context.Context, clientset kubernetes.Interface, pod corev1.Pod) ([]string, error) {
+	var reasons []string
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		claimName := volume.PersistentVolumeClaim.ClaimName
+		claim, err := clientset.CoreV1().PersistentVolumeClaims(pod.Namespace).Get(ctx, claimName, metav1.GetOptions{})
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("volume %s: claim %s could not be read: %v", volume.Name, claimName, err))
+			continue
+		}
+
+		if claim.Status.Phase != corev1.ClaimBound {
+			storageClass := "<default>"
+			if claim.Spec.StorageClassName != nil {
+				storageClass = *claim.Spec.StorageClassName
+			}
+			reasons = append(reasons, fmt.Sprintf("volume %s: claim %s is %s (storageClass %s)",
+				volume.Name, claimName, claim.Status.Phase, storageClass))
+		}
+	}
+
+	return reasons, nil
+}
+
+// unschedulableMessage returns the scheduler's explanation from the PodScheduled condition
+func unschedulableMessage(pod corev1.Pod) string {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse {
+			return condition.Message
+		}
+	}
+	return ""
+}
+
+// containerWaitingReasons lists why the containers of a scheduled pod have not started
+func containerWaitingReasons(pod corev1.Pod) []string {
+	var reasons []string
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+			reason := fmt.Sprintf("container %s waiting: %s", status.Name, status.State.Waiting.Reason)
+			if status.State.Waiting.Message != "" {
+				reason += " (" + status.State.Waiting.Message + ")"
+			}
+			reasons = append(reasons, reason)
+		}
+	}
+	return reasons
+}
+
+// firstUntoleratedTaint returns the first scheduling taint not tolerated by tolerations
+func firstUntoleratedTaint(tolerations []corev1.Toleration, taints []corev1.Taint) *corev1.Taint {
+	for i := range taints {
+		taint := &taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+
+		tolerated := false
+		for _, toleration := range tolerations {
+			if toleration.ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return taint
+		}
+	}
+	return nil
+}
+
+// nodeReady reports whether the node's Ready condition is True
+func nodeReady(node corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
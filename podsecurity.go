@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// podSecurityLabelPrefix prefixes the Pod Security Admission namespace labels: enforce, audit
+// and warn, each with a -version label pinning the policy version
+const podSecurityLabelPrefix = "pod-security.kubernetes.io/"
+
+// podSecurityModes are the Pod Security Admission modes, strictest effect first
+var podSecurityModes = []string{"enforce", "audit", "warn"}
+
+// NamespacePodSecurity is the Pod Security Admission level of each mode of a namespace; an empty
+// level means the mode is not set and the cluster default (privileged unless configured) applies
+type NamespacePodSecurity struct {
+	Namespace string            `json:"namespace"`
+	Levels    map[string]string `json:"levels,omitempty"`   // mode → level
+	Versions  map[string]string `json:"versions,omitempty"` // mode → pinned policy version
+	System    bool              `json:"system,omitempty"`
+}
+
+// Unrestricted reports whether nothing restricts or reports privileged pods in the namespace:
+// enforce is privileged or unset, and audit and warn do not flag anything either
+func (n NamespacePodSecurity) Unrestricted() bool {
+	for _, mode := range podSecurityModes {
+		if level := n.Levels[mode]; level != "" && level != "privileged" {
+			return false
+		}
+	}
+	return true
+}
+
+// AuditPodSecurity reads the Pod Security Admission labels of every namespace
+func AuditPodSecurity(ctx context.Context, clientset kubernetes.Interface) ([]NamespacePodSecurity, error) {
+	var namespaces []NamespacePodSecurity
+	err := eachObject(ctx, "namespaces", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.CoreV1().Namespaces().List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		ns := obj.(*corev1.Namespace)
+		security := NamespacePodSecurity{Namespace: ns.Name, Levels: map[string]string{}, Versions: map[string]string{}, System: isSystemNamespace(ns.Name)}
+		for _, mode := range podSecurityModes {
+			if level := ns.Labels[podSecurityLabelPrefix+mode]; level != "" {
+				security.Levels[mode] = level
+			}
+			if version := ns.Labels[podSecurityLabelPrefix+mode+"-version"]; version != "" {
+				security.Versions[mode] = version
+			}
+		}
+		namespaces = append(namespaces, security)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Namespace < namespaces[j].Namespace })
+	return namespaces, nil
+}
+
+// describePodSecurity renders a namespace's modes, e.g. "enforce=baseline, warn=restricted@v1.30"
+func describePodSecurity(ns NamespacePodSecurity) string {
+	var parts []string
+	for _, mode := range podSecurityModes {
+		level := ns.Levels[mode]
+		if level == "" {
+			continue
+		}
+		if version := ns.Versions[mode]; version != "" {
+			level += "@" + version
+		}
+		parts = append(parts, mode+"="+level)
+	}
+	if len(parts) == 0 {
+		return "no labels"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// CheckPodSecurity reports the Pod Security Admission labels of every namespace and fails when
+// an application namespace allows privileged pods without enforcing, auditing or warning at a
+// stricter level. System namespaces legitimately run privileged and are only listed.
+// Unlabelled namespaces are assumed privileged: a cluster-wide default set through the API
+// server's admission configuration is not visible through the API.
+func CheckPodSecurity(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "pod-security"}
+
+	namespaces, err := AuditPodSecurity(ctx, client.Clientset())
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	var unrestricted []string
+	for _, ns := range namespaces {
+		mark, system := "✓", ""
+		switch {
+		case ns.System:
+			system = " (system)"
+		case ns.Unrestricted():
+			mark = "✗"
+			unrestricted = append(unrestricted, ns.Namespace)
+		}
+		result.Details = append(result.Details, fmt.Sprintf("%s %s%s: %s", mark, ns.Namespace, system, describePodSecurity(ns)))
+	}
+
+	if len(unrestricted) > 0 {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%d application namespace(s) allow privileged pods with no Pod Security restriction: %s",
+			len(unrestricted), strings.Join(unrestricted, ", "))
+		return result
+	}
+	result.Status = CheckPass
+	result.Message = fmt.Sprintf("all application namespaces restrict, audit or warn on privileged pods (%d namespaces)", len(namespaces))
+	return result
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// API groups of the policy engines. Gatekeeper serves one resource per ConstraintTemplate in
+// its constraints group; Kyverno records violations in the Policy Reports API.
+const (
+	gatekeeperConstraintsGroup = "constraints.gatekeeper.sh"
+	kyvernoGroup               = "kyverno.io"
+	policyReportGroup          = "wgpolicyk8s.io"
+)
+
+// Policy is a Gatekeeper constraint or Kyverno policy active in a cluster
+type Policy struct {
+	Engine     string `json:"engine"` // "Gatekeeper" or "Kyverno"
+	Kind       string `json:"kind"`   // constraint kind, ClusterPolicy or Policy
+	Name       string `json:"name"`   // namespace/name for namespaced Kyverno policies
+	Action     string `json:"action,omitempty"`
+	Violations int64  `json:"violations"`
+}
+
+// Key identifies a policy across clusters
+func (p Policy) Key() string {
+	return p.Engine + " " + p.Kind + " " + p.Name
+}
+
+// PolicyInventory lists the policy engines of a cluster and their active policies
+type PolicyInventory struct {
+	Engines  []string `json:"engines,omitempty"`
+	Policies []Policy `json:"policies,omitempty"`
+}
+
+// Violations returns the total violations of all policies
+func (i *PolicyInventory) Violations() int64 {
+	var total int64
+	for _, policy := range i.Policies {
+		total += policy.Violations
+	}
+	return total
+}
+
+// InventoryPolicies detects OPA Gatekeeper and Kyverno from the API groups they serve and lists
+// Gatekeeper constraints with their audit violation counts and Kyverno policies with the failed
+// results of their policy reports
+func InventoryPolicies(ctx context.Context, client ClusterClient) (*PolicyInventory, error) {
+	groups, err := client.Discovery().ServerGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover API groups: %w", err)
+	}
+	preferred := map[string]string{}
+	for _, group := range groups.Groups {
+		preferred[group.Name] = group.PreferredVersion.GroupVersion
+	}
+
+	dyn, err := client.Dynamic()
+	if err != nil {
+		return nil, err
+	}
+	inventory := &PolicyInventory{}
+
+	if groupVersion, ok := preferred[gatekeeperConstraintsGroup]; ok {
+		inventory.Engines = append(inventory.Engines, "Gatekeeper")
+		constraints, err := gatekeeperConstraints(ctx, client, dyn, groupVersion)
+		if err != nil {
+			return nil, err
+		}
+		inventory.Policies = append(inventory.Policies, constraints...)
+	}
+
+	if groupVersion, ok := preferred[kyvernoGroup]; ok {
+		inventory.Engines = append(inventory.Engines, "Kyverno")
+		var violations map[string]int64
+		if reportVersion, ok := preferred[policyReportGroup]; ok {
+			if violations, err = policyReportFailures(ctx, dyn, reportVersion); err != nil {
+				return nil, err
+			}
+		}
+		policies, err := kyvernoPolicies(ctx, dyn, groupVersion, violations)
+		if err != nil {
+			return nil, err
+		}
+		inventory.Policies = append(inventory.Policies, policies...)
+	}
+
+	sort.Slice(inventory.Policies, func(i, j int) bool { return inventory.Policies[i].Key() < inventory.Policies[j].Key() })
+	return inventory, nil
+}
+
+// gatekeeperConstraints lists the constraints of every constraint kind, with the violation
+// count of Gatekeeper's last audit
+func gatekeeperConstraints(ctx context.Context, client ClusterClient, dyn dynamic.Interface, groupVersion string) ([]Policy, error) {
+	resources, err := client.Discovery().ServerResourcesForGroupVersion(groupVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover Gatekeeper constraint kinds: %w", err)
+	}
+	gv, err := schema.ParseGroupVersion(groupVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies []Policy
+	for _, resource := range resources.APIResources {
+		if strings.Contains(resource.Name, "/") {
+			continue
+		}
+		err := eachObject(ctx, resource.Name, func(opts metav1.ListOptions) (runtime.Object, error) {
+			return dyn.Resource(gv.WithResource(resource.Name)).List(ctx, opts)
+		}, func(obj runtime.Object) error {
+			item := obj.(*unstructured.Unstructured)
+			action, _, _ := unstructured.NestedString(item.Object, "spec", "enforcementAction")
+			if action == "" {
+				action = "deny"
+			}
+			violations, _, _ := unstructured.NestedInt64(item.Object, "status", "totalViolations")
+			policies = append(policies, Policy{Engine: "Gatekeeper", Kind: resource.Kind, Name: item.GetName(), Action: action, Violations: violations})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return policies, nil
+}
+
+// kyvernoPolicies lists Kyverno ClusterPolicies and Policies with their failure action and the
+// violations recorded for them
+func kyvernoPolicies(ctx context.Context, dyn dynamic.Interface, groupVersion string, violations map[string]int64) ([]Policy, error) {
+	gv, err := schema.ParseGroupVersion(groupVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies []Policy
+	for _, kind := range []struct{ kind, resource string }{{"ClusterPolicy", "clusterpolicies"}, {"Policy", "policies"}} {
+		err := eachObject(ctx, "Kyverno "+kind.resource, func(opts metav1.ListOptions) (runtime.Object, error) {
+			return dyn.Resource(gv.WithResource(kind.resource)).List(ctx, opts)
+		}, func(obj runtime.Object) error {
+			item := obj.(*unstructured.Unstructured)
+			// Reports name namespaced policies either way depending on the Kyverno version
+			count, ok := violations[objectName(item)]
+			if !ok {
+				count = violations[item.GetName()]
+			}
+			policies = append(policies, Policy{
+				Engine:     "Kyverno",
+				Kind:       kind.kind,
+				Name:       objectName(item),
+				Action:     kyvernoFailureAction(item),
+				Violations: count,
+			})
+			return nil
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	return policies, nil
+}
+
+// kyvernoFailureAction returns whether a policy audits or enforces, from the policy-wide
+// validationFailureAction or, since Kyverno 1.13, the failureAction of its validate rules
+func kyvernoFailureAction(policy *unstructured.Unstructured) string {
+	if action, _, _ := unstructured.NestedString(policy.Object, "spec", "validationFailureAction"); action != "" {
+		return action
+	}
+	rules, _, _ := unstructured.NestedSlice(policy.Object, "spec", "rules")
+	for _, rule := range rules {
+		if rule, ok := rule.(map[string]interface{}); ok {
+			if action, _, _ := unstructured.NestedString(rule, "validate", "failureAction"); action != "" {
+				return action
+			}
+		}
+	}
+	return "Audit"
+}
+
+// policyReportFailures counts the failed results of all policy reports by policy name
+func policyReportFailures(ctx context.Context, dyn dynamic.Interface, groupVersion string) (map[string]int64, error) {
+	gv, err := schema.ParseGroupVersion(groupVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	failures := map[string]int64{}
+	for _, resource := range []string{"policyreports", "clusterpolicyreports"} {
+		err := eachObject(ctx, resource, func(opts metav1.ListOptions) (runtime.Object, error) {
+			return dyn.Resource(gv.WithResource(resource)).List(ctx, opts)
+		}, func(obj runtime.Object) error {
+			results, _, _ := unstructured.NestedSlice(obj.(*unstructured.Unstructured).Object, "results")
+			for _, result := range results {
+				if result, ok := result.(map[string]interface{}); ok && result["result"] == "fail" {
+					if policy, ok := result["policy"].(string); ok {
+						failures[policy]++
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	return failures, nil
+}
+
+// PrintPolicyInventory prints the policy engines and policies of a cluster
+func PrintPolicyInventory(inventory *PolicyInventory) {
+	if len(inventory.Engines) == 0 {
+		fmt.Println("  No Gatekeeper or Kyverno found")
+		return
+	}
+	fmt.Printf("  Engines: %s\n", strings.Join(inventory.Engines, ", "))
+	for _, policy := range inventory.Policies {
+		fmt.Printf("  %-10s %-30s %-40s %-8s %d violation(s)\n", policy.Engine, policy.Kind, policy.Name, policy.Action, policy.Violations)
+	}
+}
+
+// printPolicyConsistency lists the policies not active on every cluster, so platform teams can
+// see where guardrails are missing
+func printPolicyConsistency(results []FleetResult) {
+	var clusters []string
+	present := map[string]map[string]bool{}
+	for _, result := range results {
+		inventory, ok := result.Output.(*PolicyInventory)
+		if !ok || result.Err != nil {
+			continue
+		}
+		cluster := result.Cluster.Identity().Key()
+		clusters = append(clusters, cluster)
+		for _, policy := range inventory.Policies {
+			if present[policy.Key()] == nil {
+				present[policy.Key()] = map[string]bool{}
+			}
+			present[policy.Key()][cluster] = true
+		}
+	}
+	if len(clusters) == 0 {
+		fmt.Println("\nNo policy inventories collected")
+		return
+	}
+
+	var partial []string
+	for key, on := range present {
+		if len(on) < len(clusters) {
+			partial = append(partial, key)
+		}
+	}
+	sort.Strings(partial)
+	if len(partial) == 0 {
+		fmt.Printf("\n✓ %d policies active on all %d clusters\n", len(present), len(clusters))
+		return
+	}
+	fmt.Printf("\n✗ %d of %d policies not active on every cluster:\n", len(partial), len(present))
+	for _, key := range partial {
+		var missing []string
+		for _, cluster := range clusters {
+			if !present[key][cluster] {
+				missing = append(missing, cluster)
+			}
+		}
+		fmt.Printf("  %s: missing on %s\n", key, strings.Join(missing, ", "))
+	}
+}
+
+// CheckPolicyEngines reports the Gatekeeper constraints and Kyverno policies of a cluster and
+// their violations. It is informational: violations of audit policies are expected, and it
+// passes whether or not an engine is installed.
+func CheckPolicyEngines(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "policy-engines"}
+
+	inventory, err := InventoryPolicies(ctx, client)
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	for _, policy := range inventory.Policies {
+		mark := "✓"
+		if policy.Violations > 0 {
+			mark = "⚠"
+		}
+		result.Details = append(result.Details, fmt.Sprintf("%s %s %s %s (%s): %d violation(s)",
+			mark, policy.Engine, policy.Kind, policy.Name, policy.Action, policy.Violations))
+	}
+
+	result.Status = CheckPass
+	if len(inventory.Engines) == 0 {
+		result.Message = "no Gatekeeper or Kyverno found"
+		return result
+	}
+	result.Message = fmt.Sprintf("%s: %d policies, %d violation(s)",
+		strings.Join(inventory.Engines, ", "), len(inventory.Policies), inventory.Violations())
+	return result
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// DeprecatedAPI is an API version Kubernetes removes in a given minor release
+type DeprecatedAPI struct {
+	GroupVersion string
+	Resource     string
+	RemovedIn    string // minor release, e.g. 1.25
+	Replacement  string // group version to migrate to
+}
+
+// deprecatedAPIs is the built-in removal table, from the Kubernetes deprecated API migration guide
+var deprecatedAPIs = []DeprecatedAPI{
+	{"admissionregistration.k8s.io/v1beta1", "mutatingwebhookconfigurations", "1.22", "admissionregistration.k8s.io/v1"},
+	{"admissionregistration.k8s.io/v1beta1", "validatingwebhookconfigurations", "1.22", "admissionregistration.k8s.io/v1"},
+	{"apiextensions.k8s.io/v1beta1", "customresourcedefinitions", "1.22", "apiextensions.k8s.io/v1"},
+	{"apiregistration.k8s.io/v1beta1", "apiservices", "1.22", "apiregistration.k8s.io/v1"},
+	{"certificates.k8s.io/v1beta1", "certificatesigningrequests", "1.22", "certificates.k8s.io/v1"},
+	{"coordination.k8s.io/v1beta1", "leases", "1.22", "coordination.k8s.io/v1"},
+	{"extensions/v1beta1", "ingresses", "1.22", "networking.k8s.io/v1"},
+	{"networking.k8s.io/v1beta1", "ingresses", "1.22", "networking.k8s.io/v1"},
+	{"networking.k8s.io/v1beta1", "ingressclasses", "1.22", "networking.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "clusterroles", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "clusterrolebindings", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "roles", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "rolebindings", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"scheduling.k8s.io/v1beta1", "priorityclasses", "1.22", "scheduling.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "csidrivers", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "csinodes", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "storageclasses", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "volumeattachments", "1.22", "storage.k8s.io/v1"},
+	{"batch/v1beta1", "cronjobs", "1.25", "batch/v1"},
+	{"discovery.k8s.io/v1beta1", "endpointslices", "1.25", "discovery.k8s.io/v1"},
+	{"events.k8s.io/v1beta1", "events", "1.25", "events.k8s.io/v1"},
+	{"autoscaling/v2beta1", "horizontalpodautoscalers", "1.25", "autoscaling/v2"},
+	{"policy/v1beta1", "poddisruptionbudgets", "1.25", "policy/v1"},
+	{"policy/v1beta1", "podsecuritypolicies", "1.25", "Pod Security Admission"},
+	{"node.k8s.io/v1beta1", "runtimeclasses", "1.25", "node.k8s.io/v1"},
+	{"autoscaling/v2beta2", "horizontalpodautoscalers", "1.26", "autoscaling/v2"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "flowschemas", "1.26", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "prioritylevelconfigurations", "1.26", "flowcontrol.apiserver.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "csistoragecapacities", "1.27", "storage.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "flowschemas", "1.29", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "prioritylevelconfigurations", "1.29", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "flowschemas", "1.32", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "prioritylevelconfigurations", "1.32", "flowcontrol.apiserver.k8s.io/v1"},
+}
+
+// DeprecatedAPIUsage is a removed-soon API that the cluster still uses
+type DeprecatedAPIUsage struct {
+	API DeprecatedAPI
+	// Objects were last applied (kubectl apply, Helm, GitOps) with the deprecated version
+	Objects []string
+	// Requested is set when the API server metrics show clients calling the deprecated version
+	Requested bool
+}
+
+// PreflightReport lists the deprecated API usage found for an upgrade to Target
+type PreflightReport struct {
+	Current, Target string
+	Usages          []DeprecatedAPIUsage
+	// MetricsErr is why the API server's deprecated API request metrics could not be read
+	MetricsErr error
+	// Skipped are the deprecated APIs whose objects could not be listed for lack of permission
+	Skipped []string
+}
+
+// lastAppliedAnnotation records the manifest an object was last applied with
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// ScanDeprecatedAPIs finds usage of the APIs removed after the cluster's current minor release
+// up to and including target (default: the next minor release). Usage is detected from the
+// apiVersion of objects' last-applied manifests, which is what the tooling re-applying them
+// will send, and from the API server's apiserver_requested_deprecated_apis metric.
+func ScanDeprecatedAPIs(ctx context.Context, client ClusterClient, target string) (*PreflightReport, error) {
+	serverVersion, err := client.Discovery().ServerVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server version: %w", err)
+	}
+	current, err := version.ParseGeneric(serverVersion.GitVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse server version %q: %w", serverVersion.GitVersion, err)
+	}
+
+	targetVersion := version.MajorMinor(current.Major(), current.Minor()+1)
+	if target != "" {
+		if targetVersion, err = version.ParseGeneric(target); err != nil {
+			return nil, fmt.Errorf("invalid target version %q: %w", target, err)
+		}
+	}
+	report := &PreflightReport{
+		Current: fmt.Sprintf("%d.%d", current.Major(), current.Minor()),
+		Target:  fmt.Sprintf("%d.%d", targetVersion.Major(), targetVersion.Minor()),
+	}
+
+	requested, err := requestedDeprecatedAPIs(ctx, client)
+	if err != nil {
+		report.MetricsErr = err
+	}
+
+	dyn, err := client.Dynamic()
+	if err != nil {
+		return nil, err
+	}
+	for _, api := range deprecatedAPIs {
+		removedIn := version.MustParseGeneric(api.RemovedIn)
+		if !removedIn.GreaterThan(version.MajorMinor(current.Major(), current.Minor())) || removedIn.GreaterThan(targetVersion) {
+			continue
+		}
+
+		usage := DeprecatedAPIUsage{API: api, Requested: requested[api.GroupVersion+"/"+api.Resource]}
+		gv, err := schema.ParseGroupVersion(api.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		gvr := gv.WithResource(api.Resource)
+		err = eachObject(ctx, api.Resource, func(opts metav1.ListOptions) (runtime.Object, error) {
+			return dyn.Resource(gvr).List(ctx, opts)
+		}, func(obj runtime.Object) error {
+			item := obj.(*unstructured.Unstructured)
+			if lastAppliedAPIVersion(item) == api.GroupVersion {
+				usage.Objects = append(usage.Objects, objectName(item))
+			}
+			return nil
+		})
+		// NotFound means the deprecated version is no longer served, so nothing can use it
+		switch {
+		case apierrors.IsForbidden(err):
+			report.Skipped = append(report.Skipped, fmt.Sprintf("%s %s", api.GroupVersion, api.Resource))
+		case err != nil && !apierrors.IsNotFound(err):
+			return nil, err
+		}
+
+		if usage.Requested || len(usage.Objects) > 0 {
+			report.Usages = append(report.Usages, usage)
+		}
+	}
+	return report, nil
+}
+
+// lastAppliedAPIVersion returns the apiVersion of the manifest obj was last applied with
+func lastAppliedAPIVersion(obj *unstructured.Unstructured) string {
+	applied, ok := obj.GetAnnotations()[lastAppliedAnnotation]
+	if !ok {
+		return ""
+	}
+	var manifest struct {
+		APIVersion string `json:"apiVersion"`
+	}
+	if err := json.Unmarshal([]byte(applied), &manifest); err != nil {
+		return ""
+	}
+	return manifest.APIVersion
+}
+
+// objectName returns namespace/name, or name for cluster-scoped objects
+func objectName(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// deprecatedAPIMetric counts API server requests for deprecated group/version/resources
+const deprecatedAPIMetric = "apiserver_requested_deprecated_apis"
+
+// requestedDeprecatedAPIs reads the API server's metrics and returns the deprecated
+// group/version/resource combinations clients have requested since the server started.
+// Reading /metrics needs RBAC access to that non-resource URL.
+func requestedDeprecatedAPIs(ctx context.Context, client ClusterClient) (map[string]bool, error) {
+	data, err := client.RawRequest(ctx, "GET", "/metrics")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API server metrics: %w", err)
+	}
+
+	requested := map[string]bool{}
+	for _, sample := range parseMetricSamples(string(data), deprecatedAPIMetric) {
+		labels := sample.Labels
+		groupVersion := labels["version"]
+		if labels["group"] != "" {
+			groupVersion = labels["group"] + "/" + labels["version"]
+		}
+		requested[groupVersion+"/"+labels["resource"]] = true
+	}
+	return requested, nil
+}
+
+// CheckUpgradePreflight fails when resources or clients use APIs removed by the target release
+func CheckUpgradePreflight(ctx context.Context, client ClusterClient, target string) CheckResult {
+	result := CheckResult{Name: "preflight-upgrade"}
+
+	report, err := ScanDeprecatedAPIs(ctx, client, target)
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("failed to scan for deprecated APIs: %v", err)
+		return result
+	}
+
+	for _, usage := range report.Usages {
+		api := usage.API
+		prefix := fmt.Sprintf("%s %s (removed in %s, use %s)", api.GroupVersion, api.Resource, api.RemovedIn, api.Replacement)
+		if len(usage.Objects) > 0 {
+			result.Details = append(result.Details, fmt.Sprintf("%s: applied with the deprecated version: %s", prefix, strings.Join(usage.Objects, ", ")))
+		}
+		if usage.Requested {
+			result.Details = append(result.Details, fmt.Sprintf("%s: requested by clients since the API server started", prefix))
+		}
+	}
+	if len(report.Skipped) > 0 {
+		result.Details = append(result.Details, fmt.Sprintf("⚠ objects not checked (forbidden): %s", strings.Join(report.Skipped, ", ")))
+	}
+	if report.MetricsErr != nil {
+		result.Details = append(result.Details, fmt.Sprintf("⚠ client requests not checked: %v", report.MetricsErr))
+	}
+
+	if len(report.Usages) == 0 {
+		result.Status = CheckPass
+		result.Message = fmt.Sprintf("no usage of APIs removed between %s and %s", report.Current, report.Target)
+		return result
+	}
+
+	result.Status = CheckFail
+	result.Message = fmt.Sprintf("%d deprecated API(s) in use would break upgrading from %s to %s", len(report.Usages), report.Current, report.Target)
+	return result
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// ClusterCredentials selects the cloud credentials used to reach a cluster. Fields left empty
+// fall back to the credential resolved from the environment. Secrets are never stored in the
+// config file; they are read from the environment variable named by the *Env fields.
+type ClusterCredentials struct {
+	// AWS
+	AWSProfile     string `json:"awsProfile,omitempty"`     // shared config profile
+	AWSRoleARN     string `json:"awsRoleARN,omitempty"`     // role assumed on top of the base credentials
+	AWSExternalID  string `json:"awsExternalID,omitempty"`  // external ID required by the role's trust policy
+	AWSAuthRoleARN string `json:"awsAuthRoleARN,omitempty"` // role the Kubernetes token is minted as, if not the discovery role
+	AWSSTSRegion   string `json:"awsSTSRegion,omitempty"`   // region whose STS endpoint tokens are presigned for
+
+	// Azure
+	AzureTenantID           string `json:"azureTenantID,omitempty"`
+	AzureClientID           string `json:"azureClientID,omitempty"`           // service principal or user-assigned identity
+	AzureClientSecretEnv    string `json:"azureClientSecretEnv,omitempty"`    // env var holding the client secret
+	AzureUseManagedIdentity bool   `json:"azureUseManagedIdentity,omitempty"` // use the (optionally user-assigned) managed identity
+	AzureAADServerAppID     string `json:"azureAADServerAppID,omitempty"`     // AKS AAD server application override
+
+	// GCP
+	GCPCredentialsFile           string   `json:"gcpCredentialsFile,omitempty"`           // service account JSON file
+	GCPImpersonateServiceAccount string   `json:"gcpImpersonateServiceAccount,omitempty"` // service account impersonated with the base credentials
+	GCPKubernetesScopes          []string `json:"gcpKubernetesScopes,omitempty"`          // OAuth scopes of the Kubernetes API token
+	GCPKubernetesAudience        string   `json:"gcpKubernetesAudience,omitempty"`        // audience of ID tokens used instead of access tokens
+}
+
+// ConnectionProfile is a named set of credentials and defaults shared by the fleet clusters
+// that reference it, e.g. one profile per AWS account or GCP project
+type ConnectionProfile struct {
+	Provider Provider `json:"provider"`
+	Account  string   `json:"account,omitempty"` // default Azure subscription ID or GCP project ID
+	Region   string   `json:"region,omitempty"`  // default AWS region or GKE zone/region
+	ClusterCredentials
+}
+
+// Validate checks that the profile's credentials fit its provider
+func (p ConnectionProfile) Validate() error {
+	if _, err := parseProvider(string(p.Provider)); err != nil {
+		return err
+	}
+	return p.ClusterCredentials.validate(p.Provider)
+}
+
+// validate checks that only the credential fields of provider are set and are complete
+func (c ClusterCredentials) validate(provider Provider) error {
+	aws := c.AWSProfile != "" || c.AWSRoleARN != "" || c.AWSExternalID != "" || c.AWSAuthRoleARN != "" || c.AWSSTSRegion != ""
+	azure := c.AzureTenantID != "" || c.AzureClientID != "" || c.AzureClientSecretEnv != "" || c.AzureUseManagedIdentity || c.AzureAADServerAppID != ""
+	gcp := c.GCPCredentialsFile != "" || c.GCPImpersonateServiceAccount != "" || len(c.GCPKubernetesScopes) > 0 || c.GCPKubernetesAudience != ""
+
+	switch {
+	case aws && provider != ProviderEKS:
+		return fmt.Errorf("AWS credentials given for a %s cluster", provider)
+	case azure && provider != ProviderAKS:
+		return fmt.Errorf("Azure credentials given for a %s cluster", provider)
+	case gcp && provider != ProviderGKE:
+		return fmt.Errorf("GCP credentials given for a %s cluster", provider)
+	}
+
+	if c.AWSExternalID != "" && c.AWSRoleARN == "" {
+		return fmt.Errorf("awsExternalID needs awsRoleARN")
+	}
+	if len(c.GCPKubernetesScopes) > 0 && c.GCPKubernetesAudience != "" {
+		return fmt.Errorf("gcpKubernetesScopes and gcpKubernetesAudience are mutually exclusive")
+	}
+	if c.AWSSTSRegion != "" {
+		if _, err := NormalizeLocation(ProviderEKS, c.AWSSTSRegion, LocationRegion); err != nil {
+			return fmt.Errorf("awsSTSRegion: %w", err)
+		}
+	}
+
+	if c.AzureClientSecretEnv != "" {
+		if c.AzureTenantID == "" || c.AzureClientID == "" {
+			return fmt.Errorf("azureClientSecretEnv needs azureTenantID and azureClientID")
+		}
+		if c.AzureUseManagedIdentity {
+			return fmt.Errorf("azureClientSecretEnv and azureUseManagedIdentity are mutually exclusive")
+		}
+	}
+
+	return nil
+}
+
+// merge returns c with the fields set in override replacing its own
+func (c ClusterCredentials) merge(override ClusterCredentials) ClusterCredentials {
+	merged := c
+	if override.AWSProfile != "" {
+		merged.AWSProfile = override.AWSProfile
+	}
+	if override.AWSRoleARN != "" {
+		merged.AWSRoleARN = override.AWSRoleARN
+		merged.AWSExternalID = override.AWSExternalID
+	}
+	if override.AWSAuthRoleARN != "" {
+		merged.AWSAuthRoleARN = override.AWSAuthRoleARN
+	}
+	if override.AWSSTSRegion != "" {
+		merged.AWSSTSRegion = override.AWSSTSRegion
+	}
+	if override.AzureTenantID != "" {
+		merged.AzureTenantID = override.AzureTenantID
+	}
+	if override.AzureClientID != "" {
+		merged.AzureClientID = override.AzureClientID
+	}
+	if override.AzureClientSecretEnv != "" {
+		merged.AzureClientSecretEnv = override.AzureClientSecretEnv
+	}
+	if override.AzureUseManagedIdentity {
+		merged.AzureUseManagedIdentity = true
+	}
+	if override.AzureAADServerAppID != "" {
+		merged.AzureAADServerAppID = override.AzureAADServerAppID
+	}
+	if override.GCPCredentialsFile != "" {
+		merged.GCPCredentialsFile = override.GCPCredentialsFile
+	}
+	if override.GCPImpersonateServiceAccount != "" {
+		merged.GCPImpersonateServiceAccount = override.GCPImpersonateServiceAccount
+	}
+	if len(override.GCPKubernetesScopes) > 0 {
+		merged.GCPKubernetesScopes = override.GCPKubernetesScopes
+	}
+	if override.GCPKubernetesAudience != "" {
+		merged.GCPKubernetesAudience = override.GCPKubernetesAudience
+	}
+	return merged
+}
+
+// azureCredential builds the Azure credential selected by c, falling back to the environment
+func (c ClusterCredentials) azureCredential() (azcore.TokenCredential, error) {
+	switch {
+	case c.AzureClientSecretEnv != "":
+		secret := os.Getenv(c.AzureClientSecretEnv)
+		if path, ok := credentialFile(c.AzureClientSecretEnv); ok && secret == "" {
+			return newRotatingAzureCredential(c.AzureTenantID, c.AzureClientID, path)
+		}
+		if secret == "" {
+			return nil, fmt.Errorf("environment variable %s holding the client secret is not set", c.AzureClientSecretEnv)
+		}
+		RegisterSecret(secret)
+		cred, err := azidentity.NewClientSecretCredential(c.AzureTenantID, c.AzureClientID, secret,
+			&azidentity.ClientSecretCredentialOptions{ClientOptions: azureClientOptions()})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create service principal credential: %w", err)
+		}
+		return cred, nil
+
+	case c.AzureUseManagedIdentity:
+		opts := &azidentity.ManagedIdentityCredentialOptions{}
+		if c.AzureClientID != "" {
+			opts.ID = azidentity.ClientID(c.AzureClientID)
+		}
+		cred, err := azidentity.NewManagedIdentityCredential(opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create managed identity credential: %w", err)
+		}
+		return cred, nil
+
+	case c.AzureTenantID != "":
+		cred, err := azidentity.NewAzureCLICredential(&azidentity.AzureCLICredentialOptions{TenantID: c.AzureTenantID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Azure CLI credential: %w", err)
+		}
+		return cred, nil
+
+	default:
+		return createAzureCredential()
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ProgressReporter shows the progress of long running operations such as cluster lookups,
+// token minting and waiting for pods
+type ProgressReporter interface {
+	// Start begins a step. Steps started while another one is running (nested or concurrent,
+	// e.g. per-cluster connections during a fleet run) are folded into the running step.
+	Start(message string) ProgressStep
+}
+
+// ProgressStep is a running step of a ProgressReporter
+type ProgressStep interface {
+	// Update sets the step's completion, 0 to 100
+	Update(percent int)
+	// Done ends the step
+	Done()
+}
+
+// progress is the process-wide reporter; it reports nothing until main installs one
+var progress ProgressReporter = noopProgress{}
+
+// SetProgressReporter sets the process-wide progress reporter
+func SetProgressReporter(reporter ProgressReporter) {
+	progress = reporter
+}
+
+// NewProgressReporter returns a spinner writing to out when out is an interactive terminal
+// and progress output is wanted, and a reporter that prints nothing otherwise (pipes, CI
+// logs, --quiet)
+func NewProgressReporter(out *os.File) ProgressReporter {
+	if verbosity == VerbosityQuiet || os.Getenv("TERM") == "dumb" || !isTerminal(out) {
+		return noopProgress{}
+	}
+	return newSpinner(out)
+}
+
+// isTerminal reports whether f is a character device such as a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// noopProgress is the ProgressReporter used when nothing should be drawn
+type noopProgress struct{}
+
+func (noopProgress) Start(string) ProgressStep { return noopProgress{} }
+
+func (noopProgress) Update(int) {}
+
+func (noopProgress) Done() {}
+
+// spinnerFrames are drawn in turn while a step is running
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// spinnerInterval is how often the spinner is redrawn
+const spinnerInterval = 100 * time.Millisecond
+
+// spinner draws the running step on a single, continuously redrawn terminal line
+type spinner struct {
+	out io.Writer
+
+	mu      sync.Mutex
+	message string
+	percent int // negative while unknown
+	started time.Time
+	frame   int
+	active  bool
+	stop    chan struct{}
+}
+
+// newSpinner creates a spinner drawing on out
+func newSpinner(out io.Writer) *spinner {
+	return &spinner{out: out}
+}
+
+// Start begins drawing message, unless a step is already being drawn
+func (s *spinner) Start(message string) ProgressStep {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active {
+		return noopProgress{}
+	}
+
+	s.message, s.percent, s.started, s.active = message, -1, time.Now(), true
+	s.stop = make(chan struct{})
+	go s.run(s.stop)
+	return s
+}
+
+// Update sets the percentage shown after the message
+func (s *spinner) Update(percent int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.percent = min(max(percent, 0), 100)
+}
+
+// Done stops drawing and clears the line
+func (s *spinner) Done() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.active {
+		return
+	}
+	s.active = false
+	close(s.stop)
+	s.clearLocked()
+}
+
+// Clear erases the spinner line so other output can be printed; it is redrawn on the next tick
+func (s *spinner) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active {
+		s.clearLocked()
+	}
+}
+
+// run redraws the spinner until stop is closed
+func (s *spinner) run(stop chan struct{}) {
+	ticker := time.NewTicker(spinnerInterval)
+	defer ticker.Stop()
+	for {
+		s.draw()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// draw renders the current frame, message, percentage and elapsed time
+func (s *spinner) draw() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.active {
+		return
+	}
+
+	line := fmt.Sprintf("%s %s", spinnerFrames[s.frame%len(spinnerFrames)], s.message)
+	if s.percent >= 0 {
+		line += fmt.Sprintf(" %d%%", s.percent)
+	}
+	line += fmt.Sprintf(" (%s)", time.Since(s.started).Round(time.Second))
+	s.frame++
+	fmt.Fprintf(s.out, "\r\033[K%s", line)
+}
+
+// clearLocked erases the spinner line; s.mu must be held
+func (s *spinner) clearLocked() {
+	fmt.Fprint(s.out, "\r\033[K")
+}
+
+// clearProgress erases the spinner line, if one is drawn, before other output is printed
+func clearProgress() {
+	if s, ok := progress.(*spinner); ok {
+		s.Clear()
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Provider identifies a managed Kubernetes offering
+type Provider string
+
+const (
+	ProviderAKS Provider = "aks"
+	ProviderEKS Provider = "eks"
+	ProviderGKE Provider = "gke"
+)
+
+// ClusterIdentity describes where a managed cluster lives, independently of its provider
+type ClusterIdentity struct {
+	Provider      Provider
+	Account       string // AWS account ID, GCP project ID or Azure subscription ID
+	Region        string // AWS region, GCP zone/region or Azure location
+	ResourceGroup string // Azure resource group (AKS only)
+	Name          string
+}
+
+// Key returns a stable identifier for the cluster in the form provider/account/scope/name,
+// where scope is the resource group for AKS and the region or zone otherwise
+func (id ClusterIdentity) Key() string {
+	scope := id.Region
+	if id.Provider == ProviderAKS {
+		scope = id.ResourceGroup
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", id.Provider, id.Account, scope, id.Name)
+}
+
+// ErrKubernetesNotConnected is returned by Kubernetes operations of a client constructed with
+// DeferKubernetes before ConnectKubernetes succeeded
+var ErrKubernetesNotConnected = errors.New("kubernetes client is not initialized; call ConnectKubernetes first")
+
+// ClusterClient is the behaviour shared by the AKS, EKS and GKE clients
+type ClusterClient interface {
+	Identity() ClusterIdentity
+	GetClusterInfo() (*ClusterInfo, error)
+	ListPods() error
+	Close() error
+
+	// ConnectKubernetes connects to the cluster's API server; the constructors do so unless
+	// their options set DeferKubernetes
+	ConnectKubernetes(ctx context.Context) error
+
+	// RESTConfig, Clientset, Discovery and Dynamic expose the authenticated Kubernetes
+	// connection so callers can build their own clients on top of it. They are nil, or fail
+	// with ErrKubernetesNotConnected, until ConnectKubernetes succeeded.
+	RESTConfig() *rest.Config
+	Clientset() kubernetes.Interface
+	Discovery() discovery.DiscoveryInterface
+	Dynamic() (dynamic.Interface, error)
+
+	// BuildClientCmdAPIConfig returns the connection as an in-memory kubeconfig for
+	// consumers that need kubeconfig semantics (Helm, kubectl libraries)
+	BuildClientCmdAPIConfig() (*clientcmdapi.Config, error)
+
+	// RawRequest sends a request to a non-resource API server path such as /readyz, /livez,
+	// /version or /metrics and returns the response body
+	RawRequest(ctx context.Context, method, path string) ([]byte, error)
+}
+
+// parseProvider validates a provider name given on the command line
+func parseProvider(name string) (Provider, error) {
+	switch p := Provider(strings.ToLower(name)); p {
+	case ProviderAKS, ProviderEKS, ProviderGKE:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown provider %q (expected aks, eks or gke)", name)
+	}
+}
+
+// newClusterClientFromEnv connects to the cluster described by the environment for the given
+// provider; with deferKubernetes only the cloud clients are set up
+func newClusterClientFromEnv(provider Provider, deferKubernetes bool) (ClusterClient, error) {
+	var client ClusterClient
+	var err error
+
+	switch provider {
+	case ProviderAKS:
+		client, err = newAKSClientFromEnv(deferKubernetes)
+	case ProviderEKS:
+		client, err = newEKSClientFromEnv(deferKubernetes)
+	case ProviderGKE:
+		client, err = newGKEClientFromEnv(deferKubernetes)
+	default:
+		return nil, fmt.Errorf("unknown provider %q", provider)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
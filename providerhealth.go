@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/container/apiv1/containerpb"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// gcpZone matches a GCP zone such as us-central1-a, whose region is the part before the last dash
+var gcpZone = regexp.MustCompile(`^([a-z]+-[a-z]+\d+)-[a-z]$`)
+
+// ProviderEvent is an incident or maintenance the cloud provider reports for a cluster, its
+// service or its region
+type ProviderEvent struct {
+	Source  string    `json:"source"` // AWS Health, Azure Resource Health or Google Cloud
+	Kind    string    `json:"kind"`   // incident or maintenance
+	Summary string    `json:"summary"`
+	Started time.Time `json:"started,omitempty"`
+}
+
+// String describes the event on one line
+func (e ProviderEvent) String() string {
+	s := fmt.Sprintf("provider-reported %s in progress (%s): %s", e.Kind, e.Source, e.Summary)
+	if !e.Started.IsZero() {
+		s += fmt.Sprintf(", since %s", e.Started.UTC().Format(time.RFC3339))
+	}
+	return s
+}
+
+// FetchProviderEvents asks the cluster's cloud provider for incidents and maintenance in
+// progress: AWS Health events of EKS and EC2 in the cluster's region, the Azure Resource Health
+// availability of the AKS cluster, or the Google Cloud status feed and the GKE operations
+// running on the cluster. Like FetchClusterTags it only needs cloud credentials.
+func FetchProviderEvents(ctx context.Context, cluster FleetCluster) ([]ProviderEvent, error) {
+	switch cluster.Provider {
+	case ProviderAKS:
+		return fetchAzureResourceHealth(ctx, cluster)
+	case ProviderEKS:
+		return fetchAWSHealthEvents(ctx, cluster)
+	case ProviderGKE:
+		return fetchGCPHealthEvents(ctx, cluster)
+	default:
+		return nil, fmt.Errorf("unknown provider %q", cluster.Provider)
+	}
+}
+
+// AnnotateProviderEvents looks up the provider events of every failed result, honouring the
+// fleet's concurrency limits, so reports can tell provider incidents from cluster faults.
+// Lookups that fail are logged and leave the result unannotated.
+func AnnotateProviderEvents(ctx context.Context, config *FleetConfig, results []FleetResult) {
+	slots := newFleetSlots(config.Concurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		if results[i].Err == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(result *FleetResult) {
+			defer wg.Done()
+
+			release, err := slots.acquire(ctx, result.Cluster.Provider)
+			if err != nil {
+				return
+			}
+			defer release()
+
+			events, err := FetchProviderEvents(ctx, result.Cluster)
+			if err != nil {
+				Verbosef("Failed to check provider health of %s: %v", result.Cluster.Identity().Key(), err)
+				return
+			}
+			result.ProviderEvents = events
+		}(&results[i])
+	}
+	wg.Wait()
+}
+
+// awsHealthEndpoint returns the AWS Health endpoint and signing region of a region's partition
+func awsHealthEndpoint(region string) (string, string) {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "https://health.cn-northwest-1.amazonaws.com.cn", "cn-northwest-1"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "https://health.us-gov-west-1.amazonaws.com", "us-gov-west-1"
+	default:
+		return "https://health.us-east-1.amazonaws.com", "us-east-1"
+	}
+}
+
+// fetchAWSHealthEvents lists the open EKS and EC2 issues and scheduled changes of the cluster's
+// region. The AWS Health API needs a Business or Enterprise support plan. The request is signed
+// with the shared AWS config's credentials and bounded by the cloud API timeout like SDK calls.
+func fetchAWSHealthEvents(ctx context.Context, cluster FleetCluster) ([]ProviderEvent, error) {
+	manager, err := NewAWSClientManager(cluster.awsConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS client manager: %w", err)
+	}
+	cfg := manager.GetAWSConfig()
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"filter": map[string]interface{}{
+			"services":            []string{"EKS", "EC2"},
+			"regions":             []string{cfg.Region},
+			"eventStatusCodes":    []string{"open"},
+			"eventTypeCategories": []string{"issue", "scheduledChange"},
+		},
+		"maxResults": 50,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := withPhaseTimeout(ctx, PhaseCloudAPI)
+	defer cancel()
+	endpoint, signingRegion := awsHealthEndpoint(cfg.Region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AWSHealth_20160804.DescribeEvents")
+	hash := sha256.Sum256(body)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "health", signingRegion, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign AWS Health request: %w", err)
+	}
+
+	resp, err := auditedHTTPClient("aws").Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call AWS Health: %w", phaseTimeoutError(ctx, PhaseCloudAPI, err))
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Type    string `json:"__type"`
+		Message string `json:"message"`
+		Events  []struct {
+			Service           string  `json:"service"`
+			EventTypeCode     string  `json:"eventTypeCode"`
+			EventTypeCategory string  `json:"eventTypeCategory"`
+			StartTime         float64 `json:"startTime"`
+		} `json:"events"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode AWS Health response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("AWS Health refused DescribeEvents (HTTP %d): %s %s", resp.StatusCode, out.Type, out.Message)
+	}
+
+	var events []ProviderEvent
+	for _, event := range out.Events {
+		kind := "incident"
+		if event.EventTypeCategory == "scheduledChange" {
+			kind = "maintenance"
+		}
+		events = append(events, ProviderEvent{
+			Source:  "AWS Health",
+			Kind:    kind,
+			Summary: fmt.Sprintf("%s %s in %s", event.Service, event.EventTypeCode, cfg.Region),
+			Started: time.Unix(int64(event.StartTime), 0),
+		})
+	}
+	return events, nil
+}
+
+// fetchAzureResourceHealth reads the current Resource Health availability status of the AKS
+// cluster and reports it when the cluster is not Available
+func fetchAzureResourceHealth(ctx context.Context, cluster FleetCluster) ([]ProviderEvent, error) {
+	cred, err := cluster.credentials.azureCredential()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure credential: %w", err)
+	}
+	client, err := arm.NewClient("connect-managed-k8s", "v0.0.0", cred, armClientOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ARM client: %w", err)
+	}
+
+	resourceID := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.ContainerService/managedClusters/%s",
+		cluster.Account, cluster.ResourceGroup, cluster.Name)
+	req, err := runtime.NewRequest(ctx, http.MethodGet,
+		runtime.JoinPaths(client.Endpoint(), resourceID, "providers/Microsoft.ResourceHealth/availabilityStatuses/current"))
+	if err != nil {
+		return nil, err
+	}
+	req.Raw().URL.RawQuery = "api-version=2022-10-01"
+	resp, err := client.Pipeline().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Resource Health status: %w", err)
+	}
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return nil, runtime.NewResponseError(resp)
+	}
+
+	var status struct {
+		Properties struct {
+			AvailabilityState string    `json:"availabilityState"`
+			Summary           string    `json:"summary"`
+			ReasonType        string    `json:"reasonType"`
+			OccurredTime      time.Time `json:"occuredTime"`
+		} `json:"properties"`
+	}
+	if err := runtime.UnmarshalAsJSON(resp, &status); err != nil {
+		return nil, fmt.Errorf("failed to decode Resource Health status: %w", err)
+	}
+	props := status.Properties
+	if props.AvailabilityState == "" || strings.EqualFold(props.AvailabilityState, "Available") {
+		return nil, nil
+	}
+
+	kind := "incident"
+	if strings.Contains(strings.ToLower(props.ReasonType), "planned") && !strings.Contains(strings.ToLower(props.ReasonType), "unplanned") {
+		kind = "maintenance"
+	}
+	return []ProviderEvent{{
+		Source:  "Azure Resource Health",
+		Kind:    kind,
+		Summary: fmt.Sprintf("%s: %s", props.AvailabilityState, props.Summary),
+		Started: props.OccurredTime,
+	}}, nil
+}
+
+// fetchGCPHealthEvents lists the ongoing Google Cloud incidents of the products GKE depends on
+// in the cluster's region, and the operations running on the cluster, such as an automatic
+// control plane upgrade
+func fetchGCPHealthEvents(ctx context.Context, cluster FleetCluster) ([]ProviderEvent, error) {
+	region := cluster.Region
+	if m := gcpZone.FindStringSubmatch(region); m != nil {
+		region = m[1]
+	}
+	events, err := fetchGCPIncidents(ctx, []string{region})
+	if err != nil {
+		return nil, err
+	}
+
+	gcpConfig, err := cluster.gcpConfig()
+	if err != nil {
+		return nil, err
+	}
+	manager, err := NewGCPClientManager(gcpConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCP client manager: %w", err)
+	}
+	defer manager.Close()
+	ops, err := manager.GetGKEClient().ListOperations(ctx, &containerpb.ListOperationsRequest{
+		Parent: fmt.Sprintf("projects/%s/locations/%s", manager.GetProjectID(), manager.GetZone()),
+	})
+	if err != nil {
+		return events, fmt.Errorf("failed to list operations: %w", err)
+	}
+	for _, op := range ops.Operations {
+		if op.Status != containerpb.Operation_RUNNING || !strings.Contains(op.TargetLink+"/", "/clusters/"+cluster.Name+"/") {
+			continue
+		}
+		started, _ := time.Parse(time.RFC3339Nano, op.StartTime)
+		events = append(events, ProviderEvent{
+			Source:  "Google Cloud",
+			Kind:    "maintenance",
+			Summary: fmt.Sprintf("GKE operation %s %s", op.OperationType, op.Name),
+			Started: started,
+		})
+	}
+	return events, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// pullSecretExpiryAnnotation records when the credentials of a pull secret written by
+// ApplyPullSecret expire, so a refresh job can tell when to run again
+const pullSecretExpiryAnnotation = "connect-managed-k8s/credentials-expire"
+
+// MintRegistryCredentials mints credentials for registry from the cloud credentials client
+// connected with: an ECR authorization token (valid 12 hours) on EKS, a GCP access token (about
+// an hour) for Artifact Registry and Container Registry on GKE, or an ACR refresh token (about
+// three hours) exchanged for an Azure AD token on AKS
+func MintRegistryCredentials(ctx context.Context, client ClusterClient, registry string) (*RegistryAuth, error) {
+	credentialer, ok := client.(registryCredentialer)
+	if !ok {
+		return nil, fmt.Errorf("%s clients cannot mint registry credentials", client.Identity().Provider)
+	}
+	auth, err := credentialer.RegistryCredentials(ctx, registry)
+	if err != nil {
+		return nil, err
+	}
+	if auth == nil {
+		return nil, fmt.Errorf("%s is not a registry %s credentials can be minted for", registry, client.Identity().Provider)
+	}
+	return auth, nil
+}
+
+// BuildDockerConfigJSON renders registry credentials as the .dockerconfigjson of a
+// kubernetes.io/dockerconfigjson secret
+func BuildDockerConfigJSON(auths map[string]RegistryAuth) ([]byte, error) {
+	type entry struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Auth     string `json:"auth"`
+	}
+	config := struct {
+		Auths map[string]entry `json:"auths"`
+	}{Auths: map[string]entry{}}
+	for registry, auth := range auths {
+		config.Auths[registry] = entry{
+			Username: auth.Username,
+			Password: auth.Password,
+			Auth:     base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password)),
+		}
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode docker config: %w", err)
+	}
+	return data, nil
+}
+
+// ApplyPullSecret creates a kubernetes.io/dockerconfigjson secret holding auth for registry, or
+// updates it when it was created by this tool. Secrets of the same name created otherwise are
+// left alone. It reports whether the secret was created.
+func ApplyPullSecret(ctx context.Context, clientset kubernetes.Interface, namespace, name, registry string, auth RegistryAuth) (bool, error) {
+	data, err := BuildDockerConfigJSON(map[string]RegistryAuth{registry: auth})
+	if err != nil {
+		return false, err
+	}
+	annotations := map[string]string{}
+	if !auth.Expiry.IsZero() {
+		annotations[pullSecretExpiryAnnotation] = auth.Expiry.UTC().Format(time.RFC3339)
+	}
+
+	secrets := clientset.CoreV1().Secrets(namespace)
+	existing, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   namespace,
+				Labels:      map[string]string{"app.kubernetes.io/managed-by": "connect-managed-k8s"},
+				Annotations: annotations,
+			},
+			Type: corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{corev1.DockerConfigJsonKey: data},
+		}
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return false, fmt.Errorf("failed to create pull secret %s/%s: %w", namespace, name, err)
+		}
+		return true, nil
+	case err != nil:
+		return false, fmt.Errorf("failed to get secret %s/%s: %w", namespace, name, err)
+	}
+
+	if existing.Labels["app.kubernetes.io/managed-by"] != "connect-managed-k8s" || existing.Type != corev1.SecretTypeDockerConfigJson {
+		return false, fmt.Errorf("secret %s/%s exists and was not created by this tool; not overwriting it", namespace, name)
+	}
+	existing.Data = map[string][]byte{corev1.DockerConfigJsonKey: data}
+	if existing.Annotations == nil {
+		existing.Annotations = map[string]string{}
+	}
+	delete(existing.Annotations, pullSecretExpiryAnnotation)
+	for key, value := range annotations {
+		existing.Annotations[key] = value
+	}
+	if _, err := secrets.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return false, fmt.Errorf("failed to update pull secret %s/%s: %w", namespace, name, err)
+	}
+	return false, nil
+}
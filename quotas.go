@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// quotaUsageWarning is the fraction of a quota's hard limit at which it is reported as nearly used up
+const quotaUsageWarning = 0.9
+
+// PriorityClassUsage is a PriorityClass and the number of pods running with it
+type PriorityClassUsage struct {
+	Name          string `json:"name"`
+	Value         int32  `json:"value"`
+	GlobalDefault bool   `json:"globalDefault,omitempty"`
+	Preemption    string `json:"preemption"`
+	Pods          int    `json:"pods"`
+}
+
+// ListPriorityClasses lists the cluster's PriorityClasses, highest value first, with the number
+// of pods using each
+func ListPriorityClasses(ctx context.Context, clientset kubernetes.Interface) ([]PriorityClassUsage, error) {
+	var classes []PriorityClassUsage
+	index := map[string]int{}
+	err := eachObject(ctx, "priorityclasses", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.SchedulingV1().PriorityClasses().List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		class := obj.(*schedulingv1.PriorityClass)
+		preemption := string(corev1.PreemptLowerPriority)
+		if class.PreemptionPolicy != nil {
+			preemption = string(*class.PreemptionPolicy)
+		}
+		index[class.Name] = len(classes)
+		classes = append(classes, PriorityClassUsage{Name: class.Name, Value: class.Value, GlobalDefault: class.GlobalDefault, Preemption: preemption})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = EachPod(ctx, clientset, "", metav1.ListOptions{}, func(pod *corev1.Pod) error {
+		if i, ok := index[pod.Spec.PriorityClassName]; ok {
+			classes[i].Pods++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(classes, func(i, j int) bool {
+		if classes[i].Value != classes[j].Value {
+			return classes[i].Value > classes[j].Value
+		}
+		return classes[i].Name < classes[j].Name
+	})
+	return classes, nil
+}
+
+// CheckPriorityClasses lists PriorityClasses with their value, preemption policy and pod count.
+// It is informational and always passes.
+func CheckPriorityClasses(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "priority-classes"}
+
+	classes, err := ListPriorityClasses(ctx, client.Clientset())
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	defaultClass := "none"
+	for _, class := range classes {
+		marker := ""
+		if class.GlobalDefault {
+			marker = ", global default"
+			defaultClass = class.Name
+		}
+		result.Details = append(result.Details, fmt.Sprintf("%s: value %d, %s%s, %d pod(s)", class.Name, class.Value, class.Preemption, marker, class.Pods))
+	}
+
+	result.Status = CheckPass
+	result.Message = fmt.Sprintf("%d PriorityClass(es), global default %s", len(classes), defaultClass)
+	return result
+}
+
+// NamespaceQuotas are the ResourceQuotas and LimitRanges of a namespace, and the quota
+// resources close to their hard limit
+type NamespaceQuotas struct {
+	Namespace   string   `json:"namespace"`
+	Quotas      []string `json:"quotas,omitempty"`
+	LimitRanges []string `json:"limitRanges,omitempty"`
+	NearLimit   []string `json:"nearLimit,omitempty"` // e.g. "compute/requests.cpu 19/20"
+}
+
+// ListNamespaceQuotas returns the quotas and limit ranges of every application namespace,
+// system namespaces excluded, sorted by namespace
+func ListNamespaceQuotas(ctx context.Context, clientset kubernetes.Interface) ([]NamespaceQuotas, error) {
+	namespaces := map[string]*NamespaceQuotas{}
+	err := eachObject(ctx, "namespaces", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.CoreV1().Namespaces().List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		ns := obj.(*corev1.Namespace)
+		if !isSystemNamespace(ns.Name) {
+			namespaces[ns.Name] = &NamespaceQuotas{Namespace: ns.Name}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachObject(ctx, "resourcequotas", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.CoreV1().ResourceQuotas("").List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		quota := obj.(*corev1.ResourceQuota)
+		ns := namespaces[quota.Namespace]
+		if ns == nil {
+			return nil
+		}
+		ns.Quotas = append(ns.Quotas, quota.Name)
+		for name, hard := range quota.Status.Hard {
+			used := quota.Status.Used[name]
+			if hard.MilliValue() > 0 && float64(used.MilliValue()) >= quotaUsageWarning*float64(hard.MilliValue()) {
+				ns.NearLimit = append(ns.NearLimit, fmt.Sprintf("%s/%s %s/%s", quota.Name, name, used.String(), hard.String()))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachObject(ctx, "limitranges", func(opts metav1.ListOptions) (runtime.Object, error) {
+		return clientset.CoreV1().LimitRanges("").List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		limitRange := obj.(*corev1.LimitRange)
+		if ns := namespaces[limitRange.Namespace]; ns != nil {
+			ns.LimitRanges = append(ns.LimitRanges, limitRange.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]NamespaceQuotas, 0, len(namespaces))
+	for _, ns := range namespaces {
+		sort.Strings(ns.NearLimit)
+		result = append(result, *ns)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Namespace < result[j].Namespace })
+	return result, nil
+}
+
+// CheckResourceQuotas lists the ResourceQuotas and LimitRanges of each application namespace and
+// the quotas nearly used up. When requireQuotas is set, because the cluster's policy mandates
+// quota enforcement, it fails for namespaces without a ResourceQuota.
+func CheckResourceQuotas(ctx context.Context, client ClusterClient, requireQuotas bool) CheckResult {
+	result := CheckResult{Name: "resource-quotas"}
+
+	namespaces, err := ListNamespaceQuotas(ctx, client.Clientset())
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	var unquoted []string
+	for _, ns := range namespaces {
+		if len(ns.Quotas) == 0 {
+			unquoted = append(unquoted, ns.Namespace)
+			continue
+		}
+		limitRanges := "no LimitRange"
+		if len(ns.LimitRanges) > 0 {
+			limitRanges = "LimitRange " + strings.Join(ns.LimitRanges, ", ")
+		}
+		result.Details = append(result.Details, fmt.Sprintf("✓ %s: ResourceQuota %s; %s", ns.Namespace, strings.Join(ns.Quotas, ", "), limitRanges))
+		for _, near := range ns.NearLimit {
+			result.Details = append(result.Details, fmt.Sprintf("⚠ %s: %s used", ns.Namespace, near))
+		}
+	}
+	if len(unquoted) > 0 {
+		mark := "⚠"
+		if requireQuotas {
+			mark = "✗"
+		}
+		result.Details = append(result.Details, fmt.Sprintf("%s without a ResourceQuota: %s", mark, strings.Join(unquoted, ", ")))
+	}
+
+	message := fmt.Sprintf("%d of %d application namespace(s) have a ResourceQuota", len(namespaces)-len(unquoted), len(namespaces))
+	result.Status = CheckPass
+	if requireQuotas && len(unquoted) > 0 {
+		result.Status = CheckFail
+		message = fmt.Sprintf("%d namespace(s) without a ResourceQuota where quotas are required", len(unquoted))
+	}
+	result.Message = message
+	return result
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/aws/smithy-go/middleware"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+)
+
+// RateLimit is a token bucket limit for calls to a cloud API
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+// CloudRateLimits configures the client-side limits applied to cloud control plane calls.
+// The limiters are shared by every client in the process, so fleet-wide scans stay under
+// the provider's throttling thresholds no matter how many clusters are connected.
+type CloudRateLimits struct {
+	AzureARM     RateLimit
+	GCPContainer RateLimit
+	AWSEKS       RateLimit
+}
+
+// DefaultCloudRateLimits returns conservative limits well below each provider's documented quotas
+func DefaultCloudRateLimits() CloudRateLimits {
+	return CloudRateLimits{
+		AzureARM:     RateLimit{PerSecond: 5, Burst: 10},
+		GCPContainer: RateLimit{PerSecond: 10, Burst: 20},
+		AWSEKS:       RateLimit{PerSecond: 10, Burst: 20},
+	}
+}
+
+// cloudLimiters holds the process-wide limiter for each cloud API
+var cloudLimiters = newCloudLimiters(DefaultCloudRateLimits())
+
+// cloudLimiterSet is one limiter per cloud API
+type cloudLimiterSet struct {
+	azureARM     *rate.Limiter
+	gcpContainer *rate.Limiter
+	awsEKS       *rate.Limiter
+}
+
+// newCloudLimiters creates limiters for limits
+func newCloudLimiters(limits CloudRateLimits) cloudLimiterSet {
+	return cloudLimiterSet{
+		azureARM:     newLimiter(limits.AzureARM),
+		gcpContainer: newLimiter(limits.GCPContainer),
+		awsEKS:       newLimiter(limits.AWSEKS),
+	}
+}
+
+// newLimiter creates a limiter, treating a non-positive rate as unlimited
+func newLimiter(limit RateLimit) *rate.Limiter {
+	if limit.PerSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	burst := limit.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(limit.PerSecond), burst)
+}
+
+// ConfigureCloudRateLimits replaces the process-wide limits; call it before creating clients
+func ConfigureCloudRateLimits(limits CloudRateLimits) {
+	cloudLimiters = newCloudLimiters(limits)
+}
+
+// CloudRateLimitsFromEnv reads AZURE_ARM_RATE_LIMIT, GCP_CONTAINER_RATE_LIMIT and
+// EKS_API_RATE_LIMIT, each given as "<requests per second>[:<burst>]" ("0" disables the limit)
+func CloudRateLimitsFromEnv() (CloudRateLimits, error) {
+	limits := DefaultCloudRateLimits()
+	for env, limit := range map[string]*RateLimit{
+		"AZURE_ARM_RATE_LIMIT":     &limits.AzureARM,
+		"GCP_CONTAINER_RATE_LIMIT": &limits.GCPContainer,
+		"EKS_API_RATE_LIMIT":       &limits.AWSEKS,
+	} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := parseRateLimit(value)
+		if err != nil {
+			return CloudRateLimits{}, fmt.Errorf("invalid %s: %w", env, err)
+		}
+		*limit = parsed
+	}
+	return limits, nil
+}
+
+// parseRateLimit parses "<rate>[:<burst>]"; the burst defaults to twice the rate
+func parseRateLimit(value string) (RateLimit, error) {
+	ratePart, burstPart, hasBurst := strings.Cut(value, ":")
+
+	perSecond, err := strconv.ParseFloat(ratePart, 64)
+	if err != nil || perSecond < 0 {
+		return RateLimit{}, fmt.Errorf("rate %q must be a non-negative number", ratePart)
+	}
+
+	burst := int(perSecond * 2)
+	if hasBurst {
+		burst, err = strconv.Atoi(burstPart)
+		if err != nil || burst < 1 {
+			return RateLimit{}, fmt.Errorf("burst %q must be a positive integer", burstPart)
+		}
+	}
+
+	return RateLimit{PerSecond: perSecond, Burst: burst}, nil
+}
+
+// azureRateLimitPolicy is an azcore pipeline policy that waits on the ARM limiter
+type azureRateLimitPolicy struct{}
+
+// Do waits for the limiter before sending the request down the pipeline
+func (azureRateLimitPolicy) Do(req *policy.Request) (*http.Response, error) {
+	if err := cloudLimiters.azureARM.Wait(req.Raw().Context()); err != nil {
+		return nil, fmt.Errorf("azure ARM rate limiter: %w", err)
+	}
+	return req.Next()
+}
+
+// gcpRateLimitOptions returns client options that rate limit gRPC calls to the GKE API
+func gcpRateLimitOptions() []option.ClientOption {
+	interceptor := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := cloudLimiters.gcpContainer.Wait(ctx); err != nil {
+			return fmt.Errorf("GKE API rate limiter: %w", err)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	return []option.ClientOption{option.WithGRPCDialOption(grpc.WithUnaryInterceptor(interceptor))}
+}
+
+// awsRateLimitMiddleware adds a step to an AWS SDK operation stack that waits on the EKS limiter
+func awsRateLimitMiddleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("CloudRateLimit",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			if err := cloudLimiters.awsEKS.Wait(ctx); err != nil {
+				return middleware.InitializeOutput{}, middleware.Metadata{}, fmt.Errorf("EKS API rate limiter: %w", err)
+			}
+			return next.HandleInitialize(ctx, in)
+		}), middleware.Before)
+}
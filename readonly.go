@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"k8s.io/client-go/rest"
+)
+
+// ErrReadOnly is returned for operations blocked by read-only mode
+var ErrReadOnly = errors.New("blocked by read-only mode")
+
+// readOnly is the process-wide read-only mode, installed with ConfigureReadOnly. The guards
+// check it per request, so clients created before it was set are covered too.
+var readOnly bool
+
+// ConfigureReadOnly enables or disables read-only mode, in which every mutating request to a
+// Kubernetes API server or to the AWS, Google Cloud and ARM APIs fails with ErrReadOnly
+func ConfigureReadOnly(enabled bool) {
+	readOnly = enabled
+}
+
+// ParseReadOnlyFlag strips --read-only[=bool] from args, falling back to the READ_ONLY
+// environment variable when the flag is absent
+func ParseReadOnlyFlag(args []string) ([]string, bool, error) {
+	enabled := false
+	set := false
+	remaining, err := stripGlobalFlags(args, map[string]bool{"read-only": false}, func(_, value string, hasValue bool) error {
+		set = true
+		enabled = true
+		if hasValue {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid --read-only %q", value)
+			}
+			enabled = parsed
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !set {
+		if value := os.Getenv("READ_ONLY"); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid READ_ONLY %q", value)
+			}
+			enabled = parsed
+		}
+	}
+	return remaining, enabled, nil
+}
+
+// kubernetesRequestMutates reports whether a Kubernetes API request may change cluster state.
+// Access and identity reviews are creates that only ask a question, and dry-run requests are
+// not persisted.
+func kubernetesRequestMutates(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	if req.Method == http.MethodPost && (strings.HasPrefix(req.URL.Path, "/apis/authentication.k8s.io/") ||
+		strings.HasPrefix(req.URL.Path, "/apis/authorization.k8s.io/")) {
+		return false
+	}
+	return req.URL.Query().Get("dryRun") != "All"
+}
+
+// applyReadOnlyGuard makes requests to the API server that may change cluster state fail in
+// read-only mode
+func applyReadOnlyGuard(config *rest.Config) {
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &readOnlyTransport{next: rt}
+	})
+}
+
+// readOnlyTransport rejects mutating Kubernetes requests in read-only mode
+type readOnlyTransport struct {
+	next http.RoundTripper
+}
+
+func (t *readOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if readOnly && kubernetesRequestMutates(req) {
+		return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, ErrReadOnly)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// cloudOperationMutates reports whether a cloud API operation, named like DescribeCluster or
+// ListNodePools, may change resources; only Describe, Get and List operations are read-only
+func cloudOperationMutates(operation string) bool {
+	for _, prefix := range []string{"Describe", "Get", "List"} {
+		if strings.HasPrefix(operation, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// azureReadOnlyPolicy is an azcore pipeline policy rejecting ARM requests that may change
+// resources in read-only mode. POST actions named list*, such as listClusterUserCredential,
+// only read.
+type azureReadOnlyPolicy struct{}
+
+// Do rejects the request in read-only mode unless it is a read
+func (azureReadOnlyPolicy) Do(req *policy.Request) (*http.Response, error) {
+	raw := req.Raw()
+	if !readOnly || raw.Method == http.MethodGet || raw.Method == http.MethodHead ||
+		(raw.Method == http.MethodPost && strings.HasPrefix(strings.ToLower(path.Base(raw.URL.Path)), "list")) {
+		return req.Next()
+	}
+	return nil, fmt.Errorf("ARM %s %s: %w", raw.Method, raw.URL.Path, ErrReadOnly)
+}
+
+// gcpReadOnlyOptions returns client options rejecting gRPC calls to the GKE API that may change
+// clusters in read-only mode
+func gcpReadOnlyOptions() []option.ClientOption {
+	interceptor := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if readOnly && cloudOperationMutates(path.Base(method)) {
+			return fmt.Errorf("GKE %s: %w", path.Base(method), ErrReadOnly)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	return []option.ClientOption{option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(interceptor))}
+}
+
+// gcpReadOnlyTransport rejects Google REST API requests that may change resources in read-only
+// mode. Custom methods named like reads, such as projects/p:getIamPolicy, pass. Cloud Storage is
+// exempt: report sinks and audit logs are still written in read-only mode.
+type gcpReadOnlyTransport struct {
+	next http.RoundTripper
+}
+
+func (t gcpReadOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !readOnly || req.Method == http.MethodGet || req.Method == http.MethodHead || req.URL.Host == "storage.googleapis.com" {
+		return t.next.RoundTrip(req)
+	}
+	if _, method, ok := strings.Cut(path.Base(req.URL.Path), ":"); ok && method != "" &&
+		!cloudOperationMutates(strings.ToUpper(method[:1])+method[1:]) {
+		return t.next.RoundTrip(req)
+	}
+	return nil, fmt.Errorf("GCP %s %s: %w", req.Method, req.URL.Path, ErrReadOnly)
+}
+
+// awsReadOnlyExemptServices are the AWS services read-only mode lets through: STS only mints and
+// checks credentials, AssumeRole included, and S3 receives the report sink output and audit logs
+// that are still written in read-only mode
+var awsReadOnlyExemptServices = map[string]bool{"STS": true, "S3": true}
+
+// awsReadOnlyMiddleware adds a step to an AWS SDK operation stack rejecting operations that may
+// change resources in read-only mode. It runs after the operation name is registered.
+func awsReadOnlyMiddleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("ReadOnly",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			operation := awsmiddleware.GetOperationName(ctx)
+			if readOnly && !awsReadOnlyExemptServices[awsmiddleware.GetServiceID(ctx)] && cloudOperationMutates(operation) {
+				return middleware.InitializeOutput{}, middleware.Metadata{}, fmt.Errorf("%s %s: %w", awsmiddleware.GetServiceID(ctx), operation, ErrReadOnly)
+			}
+			return next.HandleInitialize(ctx, in)
+		}), middleware.After)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// redactedPlaceholder replaces secret material in output
+const redactedPlaceholder = "[REDACTED]"
+
+// minSecretLength keeps short values such as "true" from being registered as secrets and
+// blanking out unrelated output
+const minSecretLength = 8
+
+// secretPattern is a kind of credential material recognized in free text; replacement may
+// refer to the pattern's capture groups to keep the non-secret prefix
+type secretPattern struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// secretPatterns match credentials that can end up in error messages, logs and reports
+var secretPatterns = []secretPattern{
+	// Authorization header values
+	{regexp.MustCompile(`(?i)\b(bearer)\s+[A-Za-z0-9._~+/=-]{16,}`), "${1} " + redactedPlaceholder},
+	// EKS tokens are presigned STS URLs prefixed with k8s-aws-v1.
+	{regexp.MustCompile(`k8s-aws-v1\.[A-Za-z0-9_-]+`), "k8s-aws-v1." + redactedPlaceholder},
+	// Azure AD and other JWTs
+	{regexp.MustCompile(`eyJ[A-Za-z0-9_-]{4,}\.[A-Za-z0-9_-]{4,}\.[A-Za-z0-9_-]*`), redactedPlaceholder},
+	// Google OAuth access tokens
+	{regexp.MustCompile(`ya29\.[A-Za-z0-9._-]+`), redactedPlaceholder},
+	// Signatures and tokens in presigned/SAS URL query strings
+	{regexp.MustCompile(`(?i)([?&](?:X-Amz-Signature|X-Amz-Credential|X-Amz-Security-Token|Signature|sig|access_token|token)=)[^&\s"']+`), "${1}" + redactedPlaceholder},
+	// PEM private keys, raw or JSON-escaped as in service account files
+	{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), redactedPlaceholder},
+	// Secret fields of service account JSON, kubeconfigs and OAuth responses
+	{regexp.MustCompile(`("(?:private_key|private_key_id|client_secret|refresh_token|access_token|id_token|token|password)"\s*:\s*")(?:[^"\\]|\\.)*"`), "${1}" + redactedPlaceholder + `"`},
+	// AWS access key IDs
+	{regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z0-9]{16}\b`), redactedPlaceholder},
+}
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+)
+
+// RegisterSecret makes Redact hide every occurrence of value, for secrets with no
+// recognizable shape such as client secrets read from the environment
+func RegisterSecret(value string) {
+	value = strings.TrimSpace(value)
+	if len(value) < minSecretLength {
+		return
+	}
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, s := range secrets {
+		if s == value {
+			return
+		}
+	}
+	secrets = append(secrets, value)
+}
+
+// registerEnvSecrets registers the values of the recognized secret environment variables
+func registerEnvSecrets() {
+	for _, v := range recognizedEnvVars {
+		if v.Secret {
+			RegisterSecret(os.Getenv(v.Name))
+		}
+	}
+}
+
+// Redact replaces tokens, keys, client secrets and presigned URL signatures in s
+func Redact(s string) string {
+	secretsMu.RLock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redactedPlaceholder)
+	}
+	secretsMu.RUnlock()
+
+	for _, p := range secretPatterns {
+		s = p.pattern.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// redactingWriter redacts everything written through it
+type redactingWriter struct {
+	w io.Writer
+}
+
+// NewRedactingWriter returns a writer that redacts each write before passing it to w. Each
+// write must be complete (as with the log package) for secrets to be recognized.
+func NewRedactingWriter(w io.Writer) io.Writer {
+	return redactingWriter{w: w}
+}
+
+func (r redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
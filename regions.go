@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LocationKind is the kind of location an API call requires
+type LocationKind string
+
+const (
+	// LocationAny accepts a region or, where the provider has them, a zone
+	LocationAny LocationKind = "location"
+	// LocationRegion requires a region
+	LocationRegion LocationKind = "region"
+	// LocationZone requires a zone
+	LocationZone LocationKind = "zone"
+)
+
+var (
+	awsRegionPattern = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]?)?-[a-z]+-\d+$`)
+	gcpRegionPattern = regexp.MustCompile(`^[a-z]+-[a-z]+\d+$`)
+	gcpZonePattern   = regexp.MustCompile(`^([a-z]+-[a-z]+\d+)-[a-z]$`)
+	azurePattern     = regexp.MustCompile(`^[a-z]+[a-z0-9]*$`)
+)
+
+// knownRegions are the regions typos are compared against; well-formed names missing from
+// these lists are still accepted so newly launched regions keep working
+var knownRegions = map[Provider][]string{
+	ProviderEKS: {
+		"af-south-1", "ap-east-1", "ap-east-2", "ap-northeast-1", "ap-northeast-2", "ap-northeast-3",
+		"ap-south-1", "ap-south-2", "ap-southeast-1", "ap-southeast-2", "ap-southeast-3",
+		"ap-southeast-4", "ap-southeast-5", "ap-southeast-7", "ca-central-1", "ca-west-1",
+		"cn-north-1", "cn-northwest-1", "eu-central-1", "eu-central-2", "eu-north-1", "eu-south-1",
+		"eu-south-2", "eu-west-1", "eu-west-2", "eu-west-3", "il-central-1", "me-central-1",
+		"me-south-1", "mx-central-1", "sa-east-1", "us-east-1", "us-east-2", "us-gov-east-1",
+		"us-gov-west-1", "us-west-1", "us-west-2",
+	},
+	ProviderGKE: {
+		"africa-south1", "asia-east1", "asia-east2", "asia-northeast1", "asia-northeast2",
+		"asia-northeast3", "asia-south1", "asia-south2", "asia-southeast1", "asia-southeast2",
+		"australia-southeast1", "australia-southeast2", "europe-central2", "europe-north1",
+		"europe-north2", "europe-southwest1", "europe-west1", "europe-west10", "europe-west12",
+		"europe-west2", "europe-west3", "europe-west4", "europe-west6", "europe-west8",
+		"europe-west9", "me-central1", "me-central2", "me-west1", "northamerica-northeast1",
+		"northamerica-northeast2", "northamerica-south1", "southamerica-east1",
+		"southamerica-west1", "us-central1", "us-east1", "us-east4", "us-east5", "us-south1",
+		"us-west1", "us-west2", "us-west3", "us-west4",
+	},
+	ProviderAKS: {
+		"australiacentral", "australiaeast", "australiasoutheast", "brazilsouth", "canadacentral",
+		"canadaeast", "centralindia", "centralus", "eastasia", "eastus", "eastus2",
+		"francecentral", "germanywestcentral", "indonesiacentral", "israelcentral", "italynorth",
+		"japaneast", "japanwest", "koreacentral", "koreasouth", "malaysiawest", "mexicocentral",
+		"newzealandnorth", "northcentralus", "northeurope", "norwayeast", "polandcentral",
+		"qatarcentral", "southafricanorth", "southcentralus", "southeastasia", "southindia",
+		"spaincentral", "swedencentral", "switzerlandnorth", "uaenorth", "uksouth", "ukwest",
+		"westcentralus", "westeurope", "westindia", "westus", "westus2", "westus3",
+	},
+}
+
+// NormalizeLocation validates a region or zone for provider before any API call is made and
+// returns its canonical form: trimmed and lower-cased, with spaces removed from Azure display
+// names ("East US" becomes "eastus"). Near-miss typos of known regions are rejected with a
+// suggestion.
+func NormalizeLocation(provider Provider, value string, kind LocationKind) (string, error) {
+	location := strings.ToLower(strings.TrimSpace(value))
+	if provider == ProviderAKS {
+		location = strings.ReplaceAll(location, " ", "")
+	}
+	if location == "" {
+		return "", fmt.Errorf("%s %s must not be empty", strings.ToUpper(string(provider)), kind)
+	}
+
+	var region string
+	switch provider {
+	case ProviderEKS:
+		if kind == LocationZone {
+			return "", fmt.Errorf("EKS clusters are addressed by region, not zone")
+		}
+		if !awsRegionPattern.MatchString(location) {
+			return "", invalidLocationError(provider, value, kind, location)
+		}
+		region = location
+
+	case ProviderGKE:
+		zoneMatch := gcpZonePattern.FindStringSubmatch(location)
+		isRegion := gcpRegionPattern.MatchString(location)
+		switch {
+		case zoneMatch == nil && !isRegion:
+			return "", invalidLocationError(provider, value, kind, location)
+		case kind == LocationZone && isRegion:
+			return "", fmt.Errorf("GCP region %q given where a zone is required (e.g. %s-a)", location, location)
+		case kind == LocationRegion && zoneMatch != nil:
+			return "", fmt.Errorf("GCP zone %q given where a region is required (did you mean %s?)", location, zoneMatch[1])
+		}
+		region = location
+		if zoneMatch != nil {
+			region = zoneMatch[1]
+		}
+
+	case ProviderAKS:
+		if kind == LocationZone {
+			return "", fmt.Errorf("AKS clusters are addressed by location, not zone")
+		}
+		if !azurePattern.MatchString(location) {
+			return "", invalidLocationError(provider, value, kind, location)
+		}
+		region = location
+
+	default:
+		return "", fmt.Errorf("unknown provider %q", provider)
+	}
+
+	if suggestion := suggestRegion(provider, region); suggestion != "" {
+		return "", fmt.Errorf("unknown %s %s %q (did you mean %s?)", strings.ToUpper(string(provider)), kind, value,
+			strings.Replace(location, region, suggestion, 1))
+	}
+
+	return location, nil
+}
+
+// invalidLocationError reports a malformed location, suggesting the closest known region
+func invalidLocationError(provider Provider, value string, kind LocationKind, location string) error {
+	err := fmt.Errorf("invalid %s %s %q", strings.ToUpper(string(provider)), kind, value)
+	if suggestion := closestRegion(provider, location); suggestion != "" {
+		err = fmt.Errorf("%w (did you mean %s?)", err, suggestion)
+	}
+	return err
+}
+
+// suggestRegion returns a known region that region is probably a typo of, or "" if region
+// is known or not close to any known region. Regions differing from a known one only in their
+// digits (e.g. us-east-7) are treated as new regions rather than typos.
+func suggestRegion(provider Provider, region string) string {
+	for _, known := range knownRegions[provider] {
+		if known == region {
+			return ""
+		}
+	}
+
+	suggestion := closestRegion(provider, region)
+	if stripDigits(suggestion) == stripDigits(region) {
+		return ""
+	}
+	return suggestion
+}
+
+// stripDigits removes the digits from s
+func stripDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// closestRegion returns the known region within two edits of value, if any
+func closestRegion(provider Provider, value string) string {
+	best, bestDistance := "", 3
+	for _, known := range knownRegions[provider] {
+		if d := editDistance(value, known); d < bestDistance {
+			best, bestDistance = known, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
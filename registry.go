@@ -0,0 +1,555 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// dockerHub is the registry of images referenced without a registry host
+const dockerHub = "docker.io"
+
+// registryProbeTimeout bounds the requests made to probe one registry
+const registryProbeTimeout = 15 * time.Second
+
+// manifestMediaTypes are accepted when probing a manifest, covering single and multi-arch images
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Cloud registry hosts, whose pulls are authorized through the node's cloud identity rather
+// than pull secrets
+var (
+	ecrRegistryHost = regexp.MustCompile(`^\d{12}\.dkr\.ecr(-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+	gcrRegistryHost = regexp.MustCompile(`^([a-z]+\.)?gcr\.io$|^[a-z0-9-]+-docker\.pkg\.dev$`)
+	acrRegistryHost = regexp.MustCompile(`^[a-z0-9]+\.azurecr\.(io|us|cn)$`)
+)
+
+// RegistryAuth is a username and password accepted by a registry
+type RegistryAuth struct {
+	Username string
+	Password string
+	Expiry   time.Time // when minted credentials expire; zero when unknown
+}
+
+// registryCredentialer is implemented by clients that can mint credentials for their cloud's
+// registry (ECR, Artifact Registry/GCR or ACR) from the cloud credentials they connected with.
+// RegistryCredentials returns nil for registries of other clouds.
+type registryCredentialer interface {
+	RegistryCredentials(ctx context.Context, registry string) (*RegistryAuth, error)
+}
+
+// ImageReference is a container image split into registry, repository and tag or digest
+type ImageReference struct {
+	Registry   string
+	Repository string
+	Reference  string // tag or digest
+}
+
+// ParseImageReference splits an image such as nginx, ghcr.io/org/app:v1 or app@sha256:…
+// following Docker's rules: the first path component is a registry when it contains a dot or
+// a port, or is localhost
+func ParseImageReference(image string) ImageReference {
+	ref := ImageReference{Registry: dockerHub, Reference: "latest"}
+	name := image
+	digest := ""
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, digest = name[:i], name[i+1:]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Reference = name[:i], name[i+1:]
+	}
+	// a digest pins the image whatever the tag says
+	if digest != "" {
+		ref.Reference = digest
+	}
+	if first, rest, ok := strings.Cut(name, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		ref.Registry, name = first, rest
+	}
+	if ref.Registry == dockerHub && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	ref.Repository = name
+	return ref
+}
+
+// cloudRegistry names the cloud registry service of a host, or returns "" for other registries
+func cloudRegistry(host string) string {
+	switch {
+	case ecrRegistryHost.MatchString(host):
+		return "ECR"
+	case gcrRegistryHost.MatchString(host):
+		return "Artifact Registry"
+	case acrRegistryHost.MatchString(host):
+		return "ACR"
+	}
+	return ""
+}
+
+// RegistryUsage is a registry that running pods pull images from
+type RegistryUsage struct {
+	Registry string   `json:"registry"`
+	Cloud    string   `json:"cloud,omitempty"` // ECR, Artifact Registry or ACR
+	Pods     int      `json:"pods"`
+	Images   []string `json:"images"`
+	// Secrets are the pull secrets, as namespace/name, of pods pulling from the registry
+	Secrets []string `json:"secrets,omitempty"`
+}
+
+// PullSecretStatus is an imagePullSecret referenced by pods and what it holds
+type PullSecretStatus struct {
+	Name       string   `json:"name"` // namespace/name
+	Registries []string `json:"registries,omitempty"`
+	Problem    string   `json:"problem,omitempty"`
+	// Unmatched is set when the secret holds credentials for none of the registries its pods
+	// pull from, typically a service account's pull secret added to every pod
+	Unmatched []string `json:"unmatched,omitempty"`
+}
+
+// RegistryReport lists the registries used by a cluster's pods and the state of their pull secrets
+type RegistryReport struct {
+	Registries []RegistryUsage    `json:"registries"`
+	Secrets    []PullSecretStatus `json:"secrets,omitempty"`
+	auths      map[string]RegistryAuth
+}
+
+// CollectRegistries finds the registries of the images of all pods and reads every
+// imagePullSecret they reference, reporting secrets that are missing, of the wrong type or do
+// not parse, and those holding credentials for none of the registries their pods pull from
+func CollectRegistries(ctx context.Context, clientset kubernetes.Interface) (*RegistryReport, error) {
+	report := &RegistryReport{auths: map[string]RegistryAuth{}}
+	registries := map[string]*RegistryUsage{}
+	images := map[string]map[string]bool{}
+	secretRefs := map[string]map[string]bool{} // secret → registries of the pods using it
+
+	err := EachPod(ctx, clientset, "", metav1.ListOptions{}, func(pod *corev1.Pod) error {
+		containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+		podRegistries := map[string]bool{}
+		for _, container := range containers {
+			ref := ParseImageReference(container.Image)
+			usage := registries[ref.Registry]
+			if usage == nil {
+				usage = &RegistryUsage{Registry: ref.Registry, Cloud: cloudRegistry(ref.Registry)}
+				registries[ref.Registry] = usage
+				images[ref.Registry] = map[string]bool{}
+			}
+			if !podRegistries[ref.Registry] {
+				usage.Pods++
+				podRegistries[ref.Registry] = true
+			}
+			images[ref.Registry][container.Image] = true
+		}
+		for _, secret := range pod.Spec.ImagePullSecrets {
+			name := pod.Namespace + "/" + secret.Name
+			if secretRefs[name] == nil {
+				secretRefs[name] = map[string]bool{}
+			}
+			for registry := range podRegistries {
+				secretRefs[name][registry] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	secretsByRegistry := map[string][]string{}
+	for name, pulledFrom := range secretRefs {
+		status := readPullSecret(ctx, clientset, name, report.auths)
+		if status.Problem == "" {
+			covered := false
+			for _, registry := range status.Registries {
+				covered = covered || pulledFrom[registry]
+			}
+			if !covered {
+				status.Unmatched = sortedSet(pulledFrom)
+			}
+		}
+		report.Secrets = append(report.Secrets, status)
+		for registry := range pulledFrom {
+			secretsByRegistry[registry] = append(secretsByRegistry[registry], name)
+		}
+	}
+	sort.Slice(report.Secrets, func(i, j int) bool { return report.Secrets[i].Name < report.Secrets[j].Name })
+
+	for registry, usage := range registries {
+		usage.Images = sortedSet(images[registry])
+		usage.Secrets = secretsByRegistry[registry]
+		sort.Strings(usage.Secrets)
+		report.Registries = append(report.Registries, *usage)
+	}
+	sort.Slice(report.Registries, func(i, j int) bool {
+		if report.Registries[i].Pods != report.Registries[j].Pods {
+			return report.Registries[i].Pods > report.Registries[j].Pods
+		}
+		return report.Registries[i].Registry < report.Registries[j].Registry
+	})
+	return report, nil
+}
+
+// readPullSecret reads a pull secret, recording the credentials it holds in auths
+func readPullSecret(ctx context.Context, clientset kubernetes.Interface, name string, auths map[string]RegistryAuth) PullSecretStatus {
+	status := PullSecretStatus{Name: name}
+	namespace, secretName, _ := strings.Cut(name, "/")
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		status.Problem = "does not exist"
+		return status
+	case err != nil:
+		status.Problem = fmt.Sprintf("cannot be read: %v", err)
+		return status
+	}
+
+	var entries map[string]dockerConfigEntry
+	switch secret.Type {
+	case corev1.SecretTypeDockerConfigJson:
+		var config struct {
+			Auths map[string]dockerConfigEntry `json:"auths"`
+		}
+		err = json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config)
+		entries = config.Auths
+	case corev1.SecretTypeDockercfg:
+		err = json.Unmarshal(secret.Data[corev1.DockerConfigKey], &entries)
+	default:
+		status.Problem = fmt.Sprintf("has type %s, not %s", secret.Type, corev1.SecretTypeDockerConfigJson)
+		return status
+	}
+	if err != nil {
+		status.Problem = fmt.Sprintf("does not parse: %v", err)
+		return status
+	}
+	if len(entries) == 0 {
+		status.Problem = "holds no registry credentials"
+		return status
+	}
+
+	for server, entry := range entries {
+		registry := normalizeRegistryServer(server)
+		auth, err := entry.auth()
+		if err != nil {
+			status.Problem = fmt.Sprintf("credentials for %s do not parse: %v", registry, err)
+			return status
+		}
+		status.Registries = append(status.Registries, registry)
+		if _, ok := auths[registry]; !ok {
+			auths[registry] = auth
+		}
+	}
+	sort.Strings(status.Registries)
+	return status
+}
+
+// dockerConfigEntry is one registry's credentials in a Docker config
+type dockerConfigEntry struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Auth     string `json:"auth,omitempty"` // base64 of username:password
+}
+
+// auth returns the entry's username and password
+func (e dockerConfigEntry) auth() (RegistryAuth, error) {
+	if e.Auth == "" {
+		return RegistryAuth{Username: e.Username, Password: e.Password}, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(e.Auth)
+	if err != nil {
+		return RegistryAuth{}, err
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return RegistryAuth{}, fmt.Errorf("auth is not username:password")
+	}
+	return RegistryAuth{Username: username, Password: password}, nil
+}
+
+// normalizeRegistryServer turns a Docker config server key such as https://index.docker.io/v1/
+// into a registry host
+func normalizeRegistryServer(server string) string {
+	host := server
+	if u, err := url.Parse(server); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	host, _, _ = strings.Cut(host, "/")
+	switch host {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return dockerHub
+	}
+	return host
+}
+
+// sortedSet returns the members of a set in sorted order
+func sortedSet(set map[string]bool) []string {
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// RegistryProbe is the result of pulling the manifest of one image of a registry from where
+// the tool runs
+type RegistryProbe struct {
+	Registry string
+	Image    string
+	Auth     string // "anonymous", "pull secret" or the cloud registry credentials used
+	OK       bool
+	Detail   string
+}
+
+// ProbeRegistries requests the manifest of one image per registry, as the kubelet would at the
+// start of a pull: anonymously, with the credentials of a pull secret, or for the connected
+// cloud's registry with credentials minted from the cloud credentials
+func ProbeRegistries(ctx context.Context, client ClusterClient, report *RegistryReport) []RegistryProbe {
+	credentialer, _ := client.(registryCredentialer)
+	httpClient := &http.Client{Timeout: registryProbeTimeout}
+
+	var probes []RegistryProbe
+	for _, usage := range report.Registries {
+		probe := RegistryProbe{Registry: usage.Registry, Image: usage.Images[0], Auth: "anonymous"}
+		var auth *RegistryAuth
+		if secretAuth, ok := report.auths[usage.Registry]; ok {
+			auth, probe.Auth = &secretAuth, "pull secret"
+		} else if credentialer != nil && usage.Cloud != "" {
+			cloudAuth, err := credentialer.RegistryCredentials(ctx, usage.Registry)
+			if err != nil {
+				probe.Detail = fmt.Sprintf("failed to get %s credentials: %v", usage.Cloud, err)
+				probes = append(probes, probe)
+				continue
+			}
+			if cloudAuth != nil {
+				auth, probe.Auth = cloudAuth, usage.Cloud+" credentials"
+			}
+		}
+
+		status, err := headManifest(ctx, httpClient, ParseImageReference(probe.Image), auth)
+		switch {
+		case err != nil:
+			probe.Detail = err.Error()
+		case status == http.StatusOK:
+			probe.OK = true
+			probe.Detail = "manifest available"
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			probe.Detail = fmt.Sprintf("not authorized (HTTP %d)", status)
+		case status == http.StatusNotFound:
+			probe.Detail = "manifest not found (HTTP 404)"
+		default:
+			probe.Detail = fmt.Sprintf("HTTP %d", status)
+		}
+		probes = append(probes, probe)
+	}
+	return probes
+}
+
+// headManifest requests an image manifest with HEAD, answering the registry's bearer token or
+// basic auth challenge with auth (or anonymously when nil), and returns the HTTP status
+func headManifest(ctx context.Context, httpClient *http.Client, ref ImageReference, auth *RegistryAuth) (int, error) {
+	host := ref.Registry
+	if host == dockerHub {
+		host = "registry-1.docker.io"
+	}
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", host, ref.Repository, ref.Reference)
+
+	send := func(authorization string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, manifestURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("registry unreachable: %w", err)
+		}
+		resp.Body.Close()
+		return resp, nil
+	}
+
+	resp, err := send("")
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp.StatusCode, nil
+	}
+
+	scheme, params := parseAuthChallenge(resp.Header.Get("WWW-Authenticate"))
+	var authorization string
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if auth == nil {
+			return resp.StatusCode, nil
+		}
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(auth.Username+":"+auth.Password))
+	case "bearer":
+		token, err := registryToken(ctx, httpClient, params, "repository:"+ref.Repository+":pull", auth)
+		if err != nil {
+			return 0, err
+		}
+		authorization = "Bearer " + token
+	default:
+		return resp.StatusCode, nil
+	}
+
+	resp, err = send(authorization)
+	if err != nil {
+		return 0, err
+	}
+	return resp.StatusCode, nil
+}
+
+// registryToken requests a bearer token for scope from the token service of a challenge
+func registryToken(ctx context.Context, httpClient *http.Client, challenge map[string]string, scope string, auth *RegistryAuth) (string, error) {
+	realm, err := url.Parse(challenge["realm"])
+	if err != nil || realm.Scheme == "" {
+		return "", fmt.Errorf("registry returned an invalid token realm %q", challenge["realm"])
+	}
+	query := realm.Query()
+	if service := challenge["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if auth != nil {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token service unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token service refused the credentials (HTTP %d)", resp.StatusCode)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode registry token: %w", err)
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
+
+// authChallengeParam matches one key="value" parameter of a WWW-Authenticate challenge
+var authChallengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// parseAuthChallenge splits a WWW-Authenticate header into its scheme and parameters
+func parseAuthChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := map[string]string{}
+	for _, match := range authChallengeParam.FindAllStringSubmatch(rest, -1) {
+		params[strings.ToLower(match[1])] = match[2]
+	}
+	return scheme, params
+}
+
+// CheckRegistries lists the registries running pods pull from and validates the pull secrets
+// they reference. It fails for pull secrets that are missing, of the wrong type or unparsable;
+// secrets holding credentials only for other registries are reported without failing.
+func CheckRegistries(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "registries"}
+
+	report, err := CollectRegistries(ctx, client.Clientset())
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	for _, usage := range report.Registries {
+		cloud := ""
+		if usage.Cloud != "" {
+			cloud = " (" + usage.Cloud + ")"
+		}
+		secrets := ""
+		if len(usage.Secrets) > 0 {
+			secrets = ", pull secrets " + strings.Join(usage.Secrets, ", ")
+		}
+		result.Details = append(result.Details, fmt.Sprintf("%s%s: %d pod(s), %d image(s)%s", usage.Registry, cloud, usage.Pods, len(usage.Images), secrets))
+	}
+	problems := 0
+	for _, secret := range report.Secrets {
+		switch {
+		case secret.Problem != "":
+			problems++
+			result.Details = append(result.Details, fmt.Sprintf("✗ pull secret %s %s", secret.Name, secret.Problem))
+		case len(secret.Unmatched) > 0:
+			result.Details = append(result.Details, fmt.Sprintf("⚠ pull secret %s holds %s, not the registries its pods pull from (%s)",
+				secret.Name, strings.Join(secret.Registries, ", "), strings.Join(secret.Unmatched, ", ")))
+		default:
+			result.Details = append(result.Details, fmt.Sprintf("✓ pull secret %s: %s", secret.Name, strings.Join(secret.Registries, ", ")))
+		}
+	}
+
+	if problems > 0 {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%d of %d pull secret(s) unusable", problems, len(report.Secrets))
+		return result
+	}
+	result.Status = CheckPass
+	result.Message = fmt.Sprintf("%d registries in use, %d pull secret(s) valid", len(report.Registries), len(report.Secrets))
+	return result
+}
+
+// CheckRegistryProbe requests the manifest of one image of every registry in use from this
+// machine, with the credentials the cluster would use where they are available, and fails
+// when a registry is unreachable or refuses the pull
+func CheckRegistryProbe(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "registry-probe"}
+
+	report, err := CollectRegistries(ctx, client.Clientset())
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	failed := 0
+	for _, probe := range ProbeRegistries(ctx, client, report) {
+		mark := "✓"
+		if !probe.OK {
+			mark = "✗"
+			failed++
+		}
+		result.Details = append(result.Details, fmt.Sprintf("%s %s (%s, %s): %s", mark, probe.Registry, probe.Image, probe.Auth, probe.Detail))
+	}
+
+	if failed > 0 {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%d of %d registries refused or failed the probe", failed, len(report.Registries))
+		return result
+	}
+	result.Status = CheckPass
+	result.Message = fmt.Sprintf("manifests available from all %d registries", len(report.Registries))
+	return result
+}
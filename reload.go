@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// configReloadDebounce is how long the config watcher waits for a burst of file events, such as
+// an editor's write and rename or a ConfigMap's symlink swap, to settle before reloading
+const configReloadDebounce = 500 * time.Millisecond
+
+// daemonMetrics is the registry of the metrics served by fleet daemon mode
+var daemonMetrics = prometheus.NewRegistry()
+
+var (
+	configReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "connect_managed_k8s_config_reloads_total",
+		Help: "Fleet config reloads by result (success or failure).",
+	}, []string{"result"})
+	configReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "connect_managed_k8s_config_last_reload_successful",
+		Help: "Whether the last fleet config reload succeeded (1) or failed (0).",
+	})
+	configReloadTime = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "connect_managed_k8s_config_last_reload_success_timestamp_seconds",
+		Help: "Time of the last successful fleet config load.",
+	})
+	configClusters = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "connect_managed_k8s_config_clusters",
+		Help: "Clusters in the loaded fleet config.",
+	})
+	fleetRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "connect_managed_k8s_fleet_runs_total",
+		Help: "Fleet daemon runs by result (success or failure).",
+	}, []string{"result"})
+	notifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "connect_managed_k8s_notifications_total",
+		Help: "Check result change notifications by result (success or failure).",
+	}, []string{"result"})
+)
+
+func init() {
+	daemonMetrics.MustRegister(configReloads, configReloadSuccess, configReloadTime, configClusters, fleetRuns, notifications)
+}
+
+// ServeDaemonMetrics serves daemonMetrics at /metrics on address until ctx is done; "" or "0"
+// disables it
+func ServeDaemonMetrics(ctx context.Context, address string) error {
+	if address == "" || address == "0" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to serve metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(daemonMetrics, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			Warnf("Metrics endpoint failed: %v", err)
+		}
+	}()
+	Infof("Serving metrics on %s/metrics", address)
+	return nil
+}
+
+// FleetConfigChange is the difference between two fleet configs, by cluster identity
+type FleetConfigChange struct {
+	Added   []FleetCluster
+	Removed []FleetCluster
+	Changed []FleetCluster // same identity, different credentials, profile or request settings
+}
+
+// String summarizes the change, e.g. "2 added, 1 removed, 0 changed"
+func (c FleetConfigChange) String() string {
+	return fmt.Sprintf("%d added, %d removed, %d changed", len(c.Added), len(c.Removed), len(c.Changed))
+}
+
+// DiffFleetConfigs compares the clusters of two fleet configs, including the credentials they
+// resolve from their profiles
+func DiffFleetConfigs(old, new *FleetConfig) FleetConfigChange {
+	var change FleetConfigChange
+	previous := map[string]FleetCluster{}
+	for _, cluster := range old.Clusters {
+		previous[cluster.Identity().Key()] = cluster
+	}
+	for _, cluster := range new.Clusters {
+		key := cluster.Identity().Key()
+		before, ok := previous[key]
+		switch {
+		case !ok:
+			change.Added = append(change.Added, cluster)
+		case !reflect.DeepEqual(before, cluster):
+			change.Changed = append(change.Changed, cluster)
+		}
+		delete(previous, key)
+	}
+	for _, cluster := range old.Clusters {
+		if _, ok := previous[cluster.Identity().Key()]; ok {
+			change.Removed = append(change.Removed, cluster)
+		}
+	}
+	return change
+}
+
+// ConfigWatcher keeps a fleet config current by reloading its file when it changes. Clients of
+// removed clusters and clusters whose credentials changed are evicted from the registry, so the
+// next run connects with the new settings. An invalid file is reported and the previous config
+// kept.
+type ConfigWatcher struct {
+	path     string
+	prepare  func(*FleetConfig)
+	registry *ClusterRegistry
+	watcher  *fsnotify.Watcher
+
+	mu     sync.Mutex
+	config *FleetConfig
+	data   []byte
+}
+
+// WatchFleetConfig loads the fleet config at path and watches it for changes. prepare, when
+// set, adjusts every loaded config, e.g. with command line overrides.
+func WatchFleetConfig(path string, prepare func(*FleetConfig), registry *ClusterRegistry) (*ConfigWatcher, error) {
+	w := &ConfigWatcher{path: path, prepare: prepare, registry: registry}
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+	configReloadSuccess.Set(1)
+	configReloadTime.SetToCurrentTime()
+	configClusters.Set(float64(len(w.config.Clusters)))
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch fleet config: %w", err)
+	}
+	// The directory is watched, as editors and ConfigMap mounts replace the file rather than
+	// write to it
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch fleet config: %w", err)
+	}
+	w.watcher = watcher
+	return w, nil
+}
+
+// Config returns the current fleet config
+func (w *ConfigWatcher) Config() *FleetConfig {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.config
+}
+
+// Run reloads the config on file changes until ctx is done
+func (w *ConfigWatcher) Run(ctx context.Context) {
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			Verbosef("Fleet config directory event: %s", event)
+			debounce = time.After(configReloadDebounce)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			Warnf("Watching fleet config %s: %v", w.path, err)
+		case <-debounce:
+			debounce = nil
+			w.Reload()
+		}
+	}
+}
+
+// Reload reads the config file and applies it when its content changed
+func (w *ConfigWatcher) Reload() {
+	w.mu.Lock()
+	previous, previousData := w.config, w.data
+	w.mu.Unlock()
+
+	if err := w.load(); err != nil {
+		configReloads.WithLabelValues("failure").Inc()
+		configReloadSuccess.Set(0)
+		Warnf("Failed to reload fleet config, keeping the previous one: %v", err)
+		return
+	}
+	configReloadSuccess.Set(1)
+	w.mu.Lock()
+	config, data := w.config, w.data
+	w.mu.Unlock()
+	if bytes.Equal(data, previousData) {
+		return
+	}
+
+	change := DiffFleetConfigs(previous, config)
+	if w.registry != nil {
+		for _, cluster := range append(change.Removed, change.Changed...) {
+			w.registry.Evict(cluster.Identity())
+		}
+	}
+	configReloads.WithLabelValues("success").Inc()
+	configReloadTime.SetToCurrentTime()
+	configClusters.Set(float64(len(config.Clusters)))
+	Infof("✓ Reloaded fleet config %s: %s", w.path, change)
+	for _, cluster := range change.Added {
+		Verbosef("  added %s", cluster.Identity().Key())
+	}
+	for _, cluster := range change.Removed {
+		Verbosef("  removed %s", cluster.Identity().Key())
+	}
+	for _, cluster := range change.Changed {
+		Verbosef("  changed %s", cluster.Identity().Key())
+	}
+}
+
+// load reads and validates the config file, replacing the current config when valid
+func (w *ConfigWatcher) load() error {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return fmt.Errorf("failed to read fleet config: %w", err)
+	}
+	config, err := parseFleetConfig(w.path, data)
+	if err != nil {
+		return err
+	}
+	if w.prepare != nil {
+		w.prepare(config)
+	}
+	w.mu.Lock()
+	w.config, w.data = config, data
+	w.mu.Unlock()
+	return nil
+}
+
+// Close stops watching the file
+func (w *ConfigWatcher) Close() error {
+	return w.watcher.Close()
+}
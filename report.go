@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// junitTestSuites is the root element of a JUnit XML report
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite holds the checks of one cluster
+type junitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Errors     int              `xml:"errors,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       float64          `xml:"time,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Cases      []junitTestCase  `xml:"testcase"`
+}
+
+// junitProperties are the cloud tags of a cluster, as properties of its test suite
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+// junitProperty is one property of a test suite
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// junitTestCase is one check, or the connection of a cluster that could not be checked
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+// junitSkipped marks a check that was skipped
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// junitFailure describes a failed check (failure) or a cluster that could not be checked (error)
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// EncodeJUnitReport renders fleet check results as JUnit XML, with one test suite per cluster
+// and one test case per check, so CI systems can display them. Checks reporting failOn or a
+// more severe status are failures; warnings below it pass with the warning as their output, and
+// skipped checks are marked skipped.
+// Clusters that could not be checked get a single errored "connect" case.
+func EncodeJUnitReport(results []FleetResult, failOn CheckStatus) ([]byte, error) {
+	if failOn == "" {
+		failOn = DefaultFailOn
+	}
+	report := junitTestSuites{Name: "fleet check"}
+	for _, result := range results {
+		key := result.Cluster.Identity().Key()
+		suite := junitTestSuite{Name: key, Time: result.Duration.Seconds()}
+		if len(result.Tags) > 0 {
+			suite.Properties = &junitProperties{}
+			for _, name := range sortedItems(result.Tags) {
+				suite.Properties.Properties = append(suite.Properties.Properties, junitProperty{Name: "tag." + name, Value: Redact(result.Tags[name])})
+			}
+		}
+		var annotation string
+		for _, event := range result.ProviderEvents {
+			annotation += "\n" + event.String()
+		}
+
+		checks, _ := result.Output.([]CheckResult)
+		for _, check := range checks {
+			testCase := junitTestCase{Name: check.Name, ClassName: key}
+			switch {
+			case check.Status != CheckPass && check.Status.AtLeast(failOn):
+				testCase.Failure = &junitFailure{Message: Redact(check.Message), Text: Redact(strings.Join(check.Details, "\n") + annotation)}
+				suite.Failures++
+			case check.Status == CheckSkip:
+				testCase.Skipped = &junitSkipped{Message: Redact(check.Message)}
+				suite.Skipped++
+			case check.Status == CheckWarn:
+				testCase.SystemOut = Redact(strings.Join(append([]string{"⚠ " + check.Message}, check.Details...), "\n"))
+			}
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		if len(checks) == 0 && result.Err != nil {
+			message := Redact(result.Err.Error())
+			suite.Cases = append(suite.Cases, junitTestCase{Name: "connect", ClassName: key, Error: &junitFailure{Message: message, Text: message + Redact(annotation)}})
+			suite.Errors++
+		}
+
+		suite.Tests = len(suite.Cases)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		report.Skipped += suite.Skipped
+		report.Suites = append(report.Suites, suite)
+	}
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode JUnit report: %w", err)
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// reportFile is an encoded report and the name it is stored under
+type reportFile struct {
+	name, contentType string
+	data              []byte
+}
+
+// reportFiles encodes report as fleet-<action>.json and .md and, for checks, fleet-<action>.junit.xml
+func reportFiles(report *Report) ([]reportFile, error) {
+	jsonReport, _, err := encodeFleetResultsJSON(report)
+	if err != nil {
+		return nil, err
+	}
+	files := []reportFile{
+		{"fleet-" + report.Action + ".json", "application/json", jsonReport},
+		{"fleet-" + report.Action + ".md", "text/markdown", EncodeMarkdownReport(report)},
+	}
+	if report.Action == "check" {
+		junitReport, err := EncodeJUnitReport(report.Results, report.FailOn)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, reportFile{"fleet-" + report.Action + ".junit.xml", "application/xml", junitReport})
+	}
+	return files, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ReportSchemaVersion is the version of the JSON fleet report format. Fields are only added
+// within a version; removing or changing one increments it. Version 2 added the warn and skip
+// check statuses.
+const ReportSchemaVersion = 2
+
+// ReportSchema is the JSON Schema of the current fleet report format, for downstream consumers
+//
+//go:embed fleet-report.schema.json
+var ReportSchema []byte
+
+// fleetReportJSON is the JSON form of a Report
+type fleetReportJSON struct {
+	SchemaVersion int                          `json:"schemaVersion"`
+	ToolVersion   string                       `json:"toolVersion"`
+	Action        string                       `json:"action"`
+	Finished      time.Time                    `json:"finished"`
+	Clusters      int                          `json:"clusters"`
+	Failed        int                          `json:"failed"`
+	Incidents     []ProviderEvent              `json:"incidents,omitempty"`
+	Profiles      map[string][]fleetResultJSON `json:"profiles"`
+}
+
+// checkResultJSON is the JSON form of a CheckResult
+type checkResultJSON struct {
+	Name    string      `json:"name"`
+	Status  CheckStatus `json:"status"`
+	Message string      `json:"message,omitempty"`
+	Details []string    `json:"details,omitempty"`
+}
+
+// newCheckResultsJSON converts check results to their JSON form
+func newCheckResultsJSON(results []CheckResult) []checkResultJSON {
+	out := make([]checkResultJSON, 0, len(results))
+	for _, result := range results {
+		out = append(out, checkResultJSON{Name: result.Name, Status: result.Status, Message: result.Message, Details: result.Details})
+	}
+	return out
+}
+
+// ValidateReportJSON checks that data is a fleet report in the current schema version, applying
+// the rules of ReportSchema: required fields, no unknown fields, known providers, check
+// statuses and event kinds, and counts that match the results. All problems are returned.
+func ValidateReportJSON(data []byte) error {
+	var version struct {
+		SchemaVersion *int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(data, &version); err != nil {
+		return fmt.Errorf("report is not a JSON object: %w", err)
+	}
+	if version.SchemaVersion == nil {
+		return errors.New("schemaVersion is missing")
+	}
+	if *version.SchemaVersion != ReportSchemaVersion {
+		return fmt.Errorf("unsupported schemaVersion %d (expected %d)", *version.SchemaVersion, ReportSchemaVersion)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("report is not a JSON object: %w", err)
+	}
+	var errs []error
+	for _, field := range []string{"toolVersion", "action", "finished", "clusters", "failed", "profiles"} {
+		if _, ok := raw[field]; !ok {
+			errs = append(errs, fmt.Errorf("%s is missing", field))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var report fleetReportJSON
+	if err := decoder.Decode(&report); err != nil {
+		return fmt.Errorf("invalid report: %w", err)
+	}
+
+	if report.Action == "" {
+		errs = append(errs, errors.New("action is empty"))
+	}
+	for i, event := range report.Incidents {
+		errs = append(errs, validateProviderEventJSON(fmt.Sprintf("incidents[%d]", i), event)...)
+	}
+	clusters, failed := 0, 0
+	for profile, results := range report.Profiles {
+		for i, result := range results {
+			at := fmt.Sprintf("profiles.%s[%d]", profile, i)
+			clusters++
+			if result.Error != "" {
+				failed++
+			}
+			if result.Name == "" {
+				errs = append(errs, fmt.Errorf("%s: name is empty", at))
+			}
+			if _, err := parseProvider(string(result.Provider)); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", at, err))
+			}
+			if result.DurationMS < 0 {
+				errs = append(errs, fmt.Errorf("%s: durationMs is negative", at))
+			}
+			for j, check := range result.Checks {
+				if check.Name == "" {
+					errs = append(errs, fmt.Errorf("%s.checks[%d]: name is empty", at, j))
+				}
+				if _, ok := checkSeverity[check.Status]; !ok {
+					errs = append(errs, fmt.Errorf("%s.checks[%d]: unknown status %q", at, j, check.Status))
+				}
+			}
+			for j, event := range result.ProviderEvents {
+				errs = append(errs, validateProviderEventJSON(fmt.Sprintf("%s.providerEvents[%d]", at, j), event)...)
+			}
+		}
+	}
+	if report.Clusters != clusters {
+		errs = append(errs, fmt.Errorf("clusters is %d but the report has %d results", report.Clusters, clusters))
+	}
+	if report.Failed != failed {
+		errs = append(errs, fmt.Errorf("failed is %d but %d results have an error", report.Failed, failed))
+	}
+	return errors.Join(errs...)
+}
+
+// validateProviderEventJSON checks the required fields and kind of a provider event
+func validateProviderEventJSON(at string, event ProviderEvent) []error {
+	var errs []error
+	if event.Source == "" || event.Summary == "" {
+		errs = append(errs, fmt.Errorf("%s: source and summary are required", at))
+	}
+	if event.Kind != "incident" && event.Kind != "maintenance" {
+		errs = append(errs, fmt.Errorf("%s: unknown kind %q", at, event.Kind))
+	}
+	return errs
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultRolloutBatchSize is the number of clusters upgraded in each wave after the canary
+const DefaultRolloutBatchSize = 5
+
+// RolloutOptions configures a fleet-wide control plane upgrade
+type RolloutOptions struct {
+	Version string
+	// Canary is the number of clusters upgraded in the first wave (default 1)
+	Canary int
+	// BatchSize is the number of clusters upgraded in each following wave (default
+	// DefaultRolloutBatchSize)
+	BatchSize int
+	// Soak is how long to wait after a wave's upgrades before running its health gate
+	Soak time.Duration
+	// Checks are the health gate run against every cluster of a wave once it is upgraded
+	Checks []Check
+	// FailOn is the least severe check status that fails the health gate (default DefaultFailOn)
+	FailOn CheckStatus
+}
+
+// RolloutWave is a group of clusters upgraded together
+type RolloutWave struct {
+	Number   int
+	Canary   bool
+	Clusters []FleetCluster
+}
+
+// WaveStatus is the outcome of a rollout wave
+type WaveStatus string
+
+const (
+	WavePassed  WaveStatus = "passed"
+	WaveFailed  WaveStatus = "failed"
+	WaveSkipped WaveStatus = "skipped"
+)
+
+// RolloutWaveResult is the outcome of one wave: passed when every cluster upgraded and passed
+// the health gate, failed otherwise, and skipped when an earlier wave failed
+type RolloutWaveResult struct {
+	Wave    int           `json:"wave"`
+	Canary  bool          `json:"canary,omitempty"`
+	Status  WaveStatus    `json:"status"`
+	Results []FleetResult `json:"-"`
+}
+
+// RolloutClusterOutput is the per-cluster output of a rollout: the upgrade and the health gate
+// checks run afterwards
+type RolloutClusterOutput struct {
+	Wave    int            `json:"wave"`
+	Upgrade *UpgradeResult `json:"upgrade,omitempty"`
+	Checks  []CheckResult  `json:"checks,omitempty"`
+}
+
+// RolloutReport is the outcome of every wave of a rollout in order
+type RolloutReport struct {
+	Version string              `json:"version"`
+	Waves   []RolloutWaveResult `json:"waves"`
+}
+
+// Results returns the results of all clusters across the waves, in wave order
+func (r *RolloutReport) Results() []FleetResult {
+	var results []FleetResult
+	for _, wave := range r.Waves {
+		results = append(results, wave.Results...)
+	}
+	return results
+}
+
+// Halted reports whether a wave failed, stopping the rollout
+func (r *RolloutReport) Halted() bool {
+	for _, wave := range r.Waves {
+		if wave.Status == WaveFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// PlanRolloutWaves splits clusters, in order, into a canary wave of canary clusters followed by
+// waves of batchSize clusters
+func PlanRolloutWaves(clusters []FleetCluster, canary, batchSize int) []RolloutWave {
+	if canary <= 0 {
+		canary = 1
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultRolloutBatchSize
+	}
+
+	var waves []RolloutWave
+	for start, size := 0, canary; start < len(clusters); start, size = start+size, batchSize {
+		end := min(start+size, len(clusters))
+		waves = append(waves, RolloutWave{Number: len(waves) + 1, Canary: start == 0, Clusters: clusters[start:end]})
+	}
+	return waves
+}
+
+// RunRollout upgrades the control planes of config's clusters to opts.Version wave by wave. Each
+// wave's clusters are upgraded concurrently within the fleet's concurrency limits, and once they
+// are all upgraded and opts.Soak has passed, the health gate checks run against them. The first
+// wave with a failed upgrade or check halts the rollout; the clusters of later waves are left
+// untouched and reported as skipped.
+func RunRollout(ctx context.Context, config *FleetConfig, opts RolloutOptions) *RolloutReport {
+	registry := NewClusterRegistry(ClusterRegistryOptions{})
+	defer registry.Close()
+
+	report := &RolloutReport{Version: opts.Version}
+	halted := 0
+	for _, wave := range PlanRolloutWaves(config.Clusters, opts.Canary, opts.BatchSize) {
+		result := RolloutWaveResult{Wave: wave.Number, Canary: wave.Canary}
+		if halted > 0 {
+			result.Status = WaveSkipped
+			for _, cluster := range wave.Clusters {
+				result.Results = append(result.Results, FleetResult{
+					Cluster: cluster,
+					Err:     fmt.Errorf("not upgraded, wave %d failed", halted),
+				})
+			}
+			report.Waves = append(report.Waves, result)
+			continue
+		}
+
+		result.Results = runRolloutWave(ctx, config, registry, wave, opts)
+		result.Status = WavePassed
+		for _, cluster := range result.Results {
+			if cluster.Err != nil {
+				result.Status = WaveFailed
+				halted = wave.Number
+			}
+		}
+		report.Waves = append(report.Waves, result)
+	}
+	return report
+}
+
+// runRolloutWave upgrades the clusters of wave and, when all of them succeeded, soaks and runs
+// the health gate against them
+func runRolloutWave(ctx context.Context, config *FleetConfig, registry *ClusterRegistry, wave RolloutWave, opts RolloutOptions) []FleetResult {
+	name := fmt.Sprintf("wave %d", wave.Number)
+	if wave.Canary {
+		name = "canary " + name
+	}
+	Infof("Upgrading %s: %d cluster(s) to %s", name, len(wave.Clusters), opts.Version)
+
+	waveConfig := *config
+	waveConfig.Clusters = wave.Clusters
+	results := RunFleetWithRegistry(ctx, &waveConfig, registry, func(ctx context.Context, client ClusterClient) (interface{}, error) {
+		upgrade, err := UpgradeControlPlane(ctx, client, opts.Version)
+		if err != nil {
+			return nil, err
+		}
+		return &RolloutClusterOutput{Wave: wave.Number, Upgrade: upgrade}, nil
+	})
+	for _, result := range results {
+		if result.Err != nil {
+			Warnf("Halting the rollout: %s in %s failed to upgrade", result.Cluster.Identity().Key(), name)
+			return results
+		}
+	}
+
+	if opts.Soak > 0 {
+		Infof("Soaking %s for %s before its health gate", name, opts.Soak)
+		select {
+		case <-time.After(opts.Soak):
+		case <-ctx.Done():
+			for i := range results {
+				results[i].Err = fmt.Errorf("health gate not run: %w", ctx.Err())
+			}
+			return results
+		}
+	}
+
+	gate := RunFleetWithRegistry(ctx, &waveConfig, registry, func(ctx context.Context, client ClusterClient) (interface{}, error) {
+		return runChecks(ctx, client, ChecksForCluster(ctx, client, opts.Checks, nil), opts.FailOn)
+	})
+	passed := true
+	for i, check := range gate {
+		output := results[i].Output.(*RolloutClusterOutput)
+		output.Checks, _ = check.Output.([]CheckResult)
+		results[i].Duration += check.Duration
+		if check.Err != nil {
+			results[i].Err = fmt.Errorf("health gate failed: %w", check.Err)
+			passed = false
+		}
+	}
+	if passed {
+		Infof("✓ %s passed its health gate", name)
+	} else {
+		Warnf("Halting the rollout: %s failed its health gate", name)
+	}
+	return results
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	azpolicy "github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// DefaultCredentialsDir is where a Secret of provider credentials is mounted when running in a
+// pod; CREDENTIALS_DIR overrides it
+const DefaultCredentialsDir = "/var/run/secrets/connect-managed-k8s"
+
+// awsFileCredentialsTTL is how long AWS credentials read from files are cached before the files
+// are checked for a rotation
+const awsFileCredentialsTTL = time.Minute
+
+// credentialsDir returns the directory mounted credential Secrets are read from, or "" when
+// there is none
+func credentialsDir() string {
+	if dir := os.Getenv("CREDENTIALS_DIR"); dir != "" {
+		return dir
+	}
+	if info, err := os.Stat(DefaultCredentialsDir); err == nil && info.IsDir() {
+		return DefaultCredentialsDir
+	}
+	return ""
+}
+
+// credentialFile returns the path of the mounted credential name, a key of the Secret named
+// like the environment variable it replaces, when it exists
+func credentialFile(name string) (string, bool) {
+	dir := credentialsDir()
+	if dir == "" {
+		return "", false
+	}
+	path := filepath.Join(dir, name)
+	info, err := os.Stat(path)
+	return path, err == nil && !info.IsDir()
+}
+
+// credentialValue returns the environment variable name, or else the content of the mounted
+// credential file of the same name
+func credentialValue(name string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	if path, ok := credentialFile(name); ok {
+		if data, err := os.ReadFile(path); err == nil {
+			return string(bytes.TrimSpace(data))
+		}
+	}
+	return ""
+}
+
+// secretFile is a mounted credential re-read when it changes. The kubelet rotates a mounted
+// Secret by swapping a symlink, which gives the file a new modification time.
+type secretFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	value   []byte
+}
+
+// Read returns the file's content and whether it changed since the previous read
+func (f *secretFile) Read() ([]byte, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read credential file: %w", err)
+	}
+	if f.value != nil && info.ModTime().Equal(f.modTime) {
+		return f.value, false, nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read credential file: %w", err)
+	}
+	data = bytes.TrimSpace(data)
+	RegisterSecret(string(data))
+	changed := f.value != nil && !bytes.Equal(data, f.value)
+	if changed {
+		Infof("Reloaded rotated credential %s", f.path)
+	}
+	f.modTime, f.value = info.ModTime(), data
+	return data, changed, nil
+}
+
+// awsFileCredentials is an AWS credentials provider reading AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and the optional AWS_SESSION_TOKEN from a mounted Secret. Credentials
+// expire after awsFileCredentialsTTL, so a credentials cache picks up rotated keys.
+type awsFileCredentials struct {
+	accessKey, secretKey, sessionToken *secretFile
+}
+
+// newAWSFileCredentials returns a provider for the AWS keys mounted in dir
+func newAWSFileCredentials(dir string) *awsFileCredentials {
+	provider := &awsFileCredentials{
+		accessKey: &secretFile{path: filepath.Join(dir, "AWS_ACCESS_KEY_ID")},
+		secretKey: &secretFile{path: filepath.Join(dir, "AWS_SECRET_ACCESS_KEY")},
+	}
+	if _, err := os.Stat(filepath.Join(dir, "AWS_SESSION_TOKEN")); err == nil {
+		provider.sessionToken = &secretFile{path: filepath.Join(dir, "AWS_SESSION_TOKEN")}
+	}
+	return provider
+}
+
+// Retrieve reads the current keys
+func (p *awsFileCredentials) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	accessKey, _, err := p.accessKey.Read()
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	secretKey, _, err := p.secretKey.Read()
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	credentials := aws.Credentials{
+		AccessKeyID:     string(accessKey),
+		SecretAccessKey: string(secretKey),
+		Source:          "MountedSecret",
+		CanExpire:       true,
+		Expires:         time.Now().Add(awsFileCredentialsTTL),
+	}
+	if p.sessionToken != nil {
+		token, _, err := p.sessionToken.Read()
+		if err != nil {
+			return aws.Credentials{}, err
+		}
+		credentials.SessionToken = string(token)
+	}
+	return credentials, nil
+}
+
+// rotatingAzureCredential is a service principal credential whose client secret is read from a
+// mounted Secret, recreated when the secret is rotated
+type rotatingAzureCredential struct {
+	tenantID, clientID string
+	secret             *secretFile
+
+	mu   sync.Mutex
+	cred azcore.TokenCredential
+}
+
+// newRotatingAzureCredential returns a service principal credential reading its client secret
+// from path
+func newRotatingAzureCredential(tenantID, clientID, path string) (*rotatingAzureCredential, error) {
+	cred := &rotatingAzureCredential{tenantID: tenantID, clientID: clientID, secret: &secretFile{path: path}}
+	if _, err := cred.current(); err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+// current returns the credential for the client secret on disk
+func (c *rotatingAzureCredential) current() (azcore.TokenCredential, error) {
+	secret, changed, err := c.secret.Read()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cred == nil || changed {
+		cred, err := azidentity.NewClientSecretCredential(c.tenantID, c.clientID, string(secret),
+			&azidentity.ClientSecretCredentialOptions{ClientOptions: azureClientOptions()})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create service principal credential: %w", err)
+		}
+		c.cred = cred
+	}
+	return c.cred, nil
+}
+
+// GetToken returns a token for the current client secret
+func (c *rotatingAzureCredential) GetToken(ctx context.Context, options azpolicy.TokenRequestOptions) (azcore.AccessToken, error) {
+	cred, err := c.current()
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+	return cred.GetToken(ctx, options)
+}
+
+// rotatingTokenSource is a GCP token source for a credentials file, such as a mounted service
+// account key, reloaded when the file changes
+type rotatingTokenSource struct {
+	ctx    context.Context
+	file   *secretFile
+	scopes []string
+
+	mu     sync.Mutex
+	source oauth2.TokenSource
+}
+
+// newRotatingCredentials loads the credentials file at path with scopes, with a token source
+// that follows rotations of the file
+func newRotatingCredentials(ctx context.Context, path string, scopes []string) (*google.Credentials, error) {
+	file := &secretFile{path: path}
+	data, _, err := file.Read()
+	if err != nil {
+		return nil, err
+	}
+	creds, err := google.CredentialsFromJSON(ctx, data, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	creds.TokenSource = &rotatingTokenSource{ctx: ctx, file: file, scopes: scopes, source: creds.TokenSource}
+	return creds, nil
+}
+
+// Token returns a token from the credentials currently on disk
+func (s *rotatingTokenSource) Token() (*oauth2.Token, error) {
+	data, changed, err := s.file.Read()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if changed {
+		creds, err := google.CredentialsFromJSON(s.ctx, data, s.scopes...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load rotated Google Cloud credentials: %w", err)
+		}
+		s.source = creds.TokenSource
+	}
+	return s.source.Token()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultExpectedRunDuration is how long whoami expects a run to take when warning about
+// credentials expiring before it finishes
+const DefaultExpectedRunDuration = time.Hour
+
+// SessionInfo is the cloud identity the tool is authenticated as and how long its session is valid
+type SessionInfo struct {
+	Provider Provider `json:"provider"`
+	Identity string   `json:"identity"`          // IAM ARN, Google account email or Azure AD user/app
+	Account  string   `json:"account,omitempty"` // AWS account, GCP project or Azure tenant
+	Source   string   `json:"source,omitempty"`  // where the credentials came from
+	// Expires is when the current credentials or token expire; zero for credentials that do not
+	// expire, such as IAM user access keys
+	Expires time.Time `json:"expires,omitempty"`
+	// Warnings are set by CheckSessionExpiry
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Remaining is how long the session is still valid at now, or a negative duration once it has
+// expired. It is meaningless for sessions that do not expire.
+func (s *SessionInfo) Remaining(now time.Time) time.Duration {
+	return s.Expires.Sub(now)
+}
+
+// sessionDescriber is implemented by clients that can report their cloud session
+type sessionDescriber interface {
+	Session(ctx context.Context) (*SessionInfo, error)
+}
+
+// DescribeSession reports who client is authenticated as with its cloud and when that session
+// expires: the STS credential expiration on EKS, the OAuth token expiry on GKE or the exp claim
+// of the Azure AD token on AKS
+func DescribeSession(ctx context.Context, client ClusterClient) (*SessionInfo, error) {
+	describer, ok := client.(sessionDescriber)
+	if !ok {
+		return nil, fmt.Errorf("%s clients cannot describe their session", client.Identity().Provider)
+	}
+	return describer.Session(ctx)
+}
+
+// CheckSessionExpiry adds a warning to session when it expires within expected, the duration a
+// run is expected to take
+func CheckSessionExpiry(session *SessionInfo, now time.Time, expected time.Duration) {
+	if session.Expires.IsZero() {
+		return
+	}
+	remaining := session.Remaining(now)
+	switch {
+	case remaining <= 0:
+		session.Warnings = append(session.Warnings, fmt.Sprintf("credentials expired %s ago; re-authenticate", formatRemaining(-remaining)))
+	case remaining < expected:
+		session.Warnings = append(session.Warnings, fmt.Sprintf("credentials expire in %s, before a run of %s would finish; refresh them first",
+			formatRemaining(remaining), formatRemaining(expected)))
+	}
+}
+
+// formatRemaining renders a duration rounded to the minute, or to the second under a minute
+func formatRemaining(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	s := strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// PrintSessionInfo prints the cloud identity and the remaining validity of its session
+func PrintSessionInfo(session *SessionInfo, now time.Time) {
+	fmt.Printf("%s Session:\n", strings.ToUpper(string(session.Provider)))
+	fmt.Printf("  Identity: %s\n", session.Identity)
+	printIfSet("Account", session.Account)
+	printIfSet("Source", session.Source)
+	switch remaining := session.Remaining(now); {
+	case session.Expires.IsZero():
+		fmt.Printf("  Expires: never (long-lived credentials)\n")
+	case remaining <= 0:
+		fmt.Printf("  Expires: %s (expired)\n", session.Expires.Local().Format(time.RFC3339))
+	default:
+		fmt.Printf("  Expires: %s (in %s)\n", session.Expires.Local().Format(time.RFC3339), formatRemaining(remaining))
+	}
+	for _, warning := range session.Warnings {
+		fmt.Printf("  ⚠ %s\n", warning)
+	}
+}
+
+// jwtClaims decodes the claims of a JWT without verifying it, for displaying who a token was
+// issued to
+func jwtClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode token claims: %w", err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("failed to parse token claims: %w", err)
+	}
+	return claims, nil
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq" // registers the postgres driver used by the database sink
+)
+
+// Report is the outcome of a fleet run, delivered to every active ReportSink
+type Report struct {
+	Action   string // fleet action, e.g. check
+	Finished time.Time
+	Results  []FleetResult
+	// Incidents are the active incidents on the provider status pages for the fleet's regions
+	Incidents []ProviderEvent
+	// FailOn is the least severe check status that failed a cluster (default DefaultFailOn)
+	FailOn CheckStatus
+}
+
+// Failed returns the number of clusters whose operation failed
+func (r *Report) Failed() int {
+	failed := 0
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// runID names the run in object keys and database rows
+func (r *Report) runID() string {
+	return r.Finished.UTC().Format("20060102T150405Z")
+}
+
+// ReportSink delivers the report of a fleet run, decoupling running operations from how their
+// results are published. Any number of sinks can be active at once.
+type ReportSink interface {
+	// Name describes the destination, without credentials
+	Name() string
+	Deliver(ctx context.Context, report *Report) error
+	Close() error
+}
+
+// reportHTTPTimeout bounds a report POST
+const reportHTTPTimeout = 30 * time.Second
+
+// NewReportSink opens the sink described by spec, so a bad destination fails before any
+// cluster is contacted:
+//
+//	stdout[:text|json|junit|markdown]          printed to stdout
+//	template:<path>                            rendered with a Go template to stdout
+//	file:<path>                                JSON, or JUnit or Markdown for .xml or .md paths
+//	s3://, gs://, https://<acct>.blob.<...>/   uploaded to object storage
+//	http://, https://                          POSTed as JSON
+//	postgres://                                inserted into the fleet_reports table
+func NewReportSink(ctx context.Context, spec string) (ReportSink, error) {
+	kind, err := reportSinkKind(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	_, rest, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "stdout":
+		if rest == "" {
+			rest = "text"
+		}
+		return stdoutSink{format: rest}, nil
+	case "template":
+		tmpl, err := LoadReportTemplate(rest)
+		if err != nil {
+			return nil, err
+		}
+		return templateSink{path: rest, tmpl: tmpl}, nil
+	case "file":
+		return fileSink{path: rest}, nil
+	case "object storage":
+		store, err := NewObjectStore(ctx, spec)
+		if err != nil {
+			return nil, err
+		}
+		return objectStoreSink{store: store}, nil
+	case "http":
+		return httpSink{url: spec, client: &http.Client{Timeout: reportHTTPTimeout}}, nil
+	default:
+		return newDatabaseSink(ctx, spec)
+	}
+}
+
+// reportSinkKind validates spec without opening it and returns the kind of sink it describes
+func reportSinkKind(spec string) (string, error) {
+	scheme, rest, _ := strings.Cut(spec, ":")
+	switch {
+	case scheme == "stdout":
+		if rest != "" && rest != "text" && rest != "json" && rest != "junit" && rest != "markdown" {
+			return "", fmt.Errorf("unknown output format %q (expected text, json, junit or markdown)", rest)
+		}
+		return "stdout", nil
+	case scheme == "template":
+		if rest == "" {
+			return "", fmt.Errorf("invalid report sink %q: template path is missing", spec)
+		}
+		return "template", nil
+	case scheme == "file":
+		if rest == "" {
+			return "", fmt.Errorf("invalid report sink %q: file path is missing", spec)
+		}
+		return "file", nil
+	case scheme == "s3" || scheme == "gs" || (scheme == "https" && isAzureBlobURL(spec)):
+		if _, err := ParseObjectStoreLocation(spec); err != nil {
+			return "", err
+		}
+		return "object storage", nil
+	case scheme == "http" || scheme == "https":
+		if _, err := url.ParseRequestURI(spec); err != nil {
+			return "", fmt.Errorf("invalid report sink %q: %w", spec, err)
+		}
+		return "http", nil
+	case scheme == "postgres" || scheme == "postgresql":
+		if _, err := url.Parse(spec); err != nil {
+			return "", fmt.Errorf("invalid database URL: %w", err)
+		}
+		return "database", nil
+	default:
+		return "", fmt.Errorf("unknown report sink %q (expected stdout, file:, s3://, gs://, https://, http:// or postgres://)", Redact(spec))
+	}
+}
+
+// NewReportSinks opens the sinks of a comma-separated list of specs, closing those already
+// opened if one fails
+func NewReportSinks(ctx context.Context, specs string) ([]ReportSink, error) {
+	var sinks []ReportSink
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		sink, err := NewReportSink(ctx, spec)
+		if err != nil {
+			closeReportSinks(sinks)
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// DeliverReport delivers report to every sink, returning the failures of all sinks that failed
+func DeliverReport(ctx context.Context, sinks []ReportSink, report *Report) error {
+	var errs []error
+	for _, sink := range sinks {
+		if err := sink.Deliver(ctx, report); err != nil {
+			errs = append(errs, fmt.Errorf("failed to deliver report to %s: %w", sink.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// closeReportSinks closes every sink
+func closeReportSinks(sinks []ReportSink) {
+	for _, sink := range sinks {
+		sink.Close()
+	}
+}
+
+// isAzureBlobURL reports whether raw is an Azure Blob endpoint URL
+func isAzureBlobURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && strings.Contains(u.Host, ".blob.")
+}
+
+// stdoutSink prints the report as text, JSON or JUnit
+type stdoutSink struct {
+	format string
+}
+
+func (s stdoutSink) Name() string { return "stdout" }
+
+func (s stdoutSink) Deliver(ctx context.Context, report *Report) error {
+	switch s.format {
+	case "json":
+		printFleetResultsJSON(report)
+	case "markdown":
+		fmt.Print(string(EncodeMarkdownReport(report)))
+	case "junit":
+		data, err := EncodeJUnitReport(report.Results, report.FailOn)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	default:
+		printFleetReportText(report)
+	}
+	return nil
+}
+
+func (s stdoutSink) Close() error { return nil }
+
+// printFleetReportText prints each cluster's output followed by the per-cluster summary
+func printFleetReportText(report *Report) {
+	PrintStatusPageIncidents(report.Incidents)
+	for _, result := range report.Results {
+		switch output := result.Output.(type) {
+		case *ClusterInfo:
+			fmt.Println()
+			PrintClusterInfo(output)
+		case []CheckResult:
+			fmt.Printf("\n[%s] %s:\n", result.Cluster.ProfileName(), result.Cluster.Identity().Key())
+			for _, check := range output {
+				PrintCheckResult(check)
+			}
+		case *AcceleratorInventory:
+			fmt.Printf("\n[%s] %s:\n", result.Cluster.ProfileName(), result.Cluster.Identity().Key())
+			PrintAcceleratorInventory(output)
+		case *ServerFeatures:
+			fmt.Printf("\n[%s] %s:\n", result.Cluster.ProfileName(), result.Cluster.Identity().Key())
+			PrintServerFeatures(output)
+		case *PolicyInventory:
+			fmt.Printf("\n[%s] %s:\n", result.Cluster.ProfileName(), result.Cluster.Identity().Key())
+			PrintPolicyInventory(output)
+		case []AccessMapping:
+			fmt.Printf("\n[%s] %s:\n", result.Cluster.ProfileName(), result.Cluster.Identity().Key())
+			PrintAccessMappings(output)
+		case []ExportedFile:
+			fmt.Printf("\n[%s] %s:\n", result.Cluster.ProfileName(), result.Cluster.Identity().Key())
+			PrintExportedFiles(output)
+		case []WorkloadMatch:
+			if len(output) > 0 {
+				fmt.Printf("\n[%s] %s:\n", result.Cluster.ProfileName(), result.Cluster.Identity().Key())
+				PrintWorkloadMatches(output)
+			}
+		}
+	}
+	switch report.Action {
+	case "find":
+		printFindSummary(report.Results)
+	case "capabilities":
+		PrintCapabilityMatrix(report.Results)
+	case "accelerators":
+		printAcceleratorSummary(report.Results)
+	case "features":
+		printFeatureConsistency(report.Results)
+	case "policies":
+		printPolicyConsistency(report.Results)
+	}
+	fmt.Println()
+	PrintFleetResults(report.Results)
+}
+
+// fileSink writes the JSON report, or the JUnit or Markdown report for paths ending in .xml or
+// .md, to a file
+type fileSink struct {
+	path string
+}
+
+func (s fileSink) Name() string { return s.path }
+
+func (s fileSink) Deliver(ctx context.Context, report *Report) error {
+	var data []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(s.path), ".xml") {
+		if report.Action != "check" {
+			return fmt.Errorf("JUnit reports are only written for fleet check")
+		}
+		data, err = EncodeJUnitReport(report.Results, report.FailOn)
+	} else if ext := strings.ToLower(filepath.Ext(s.path)); ext == ".md" || ext == ".markdown" {
+		data = EncodeMarkdownReport(report)
+	} else {
+		data, _, err = encodeFleetResultsJSON(report)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+func (s fileSink) Close() error { return nil }
+
+// objectStoreSink uploads the JSON and Markdown reports, and the JUnit report for checks, to
+// <prefix>/<run timestamp>/fleet-<action>.json, .md and .junit.xml
+type objectStoreSink struct {
+	store ObjectStore
+}
+
+func (s objectStoreSink) Name() string { return s.store.URL("") }
+
+func (s objectStoreSink) Deliver(ctx context.Context, report *Report) error {
+	files, err := reportFiles(report)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := s.store.Put(ctx, path.Join(report.runID(), file.name), file.data, file.contentType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s objectStoreSink) Close() error { return s.store.Close() }
+
+// httpSink POSTs the JSON report to a webhook or collector endpoint
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s httpSink) Name() string { return Redact(s.url) }
+
+func (s httpSink) Deliver(ctx context.Context, report *Report) error {
+	data, _, err := encodeFleetResultsJSON(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Fleet-Action", report.Action)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post report: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("report endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s httpSink) Close() error { return nil }
+
+// createReportsTable creates the table the database sink inserts into
+const createReportsTable = `CREATE TABLE IF NOT EXISTS fleet_reports (
+	id          BIGSERIAL PRIMARY KEY,
+	run_id      TEXT NOT NULL,
+	action      TEXT NOT NULL,
+	finished_at TIMESTAMPTZ NOT NULL,
+	clusters    INTEGER NOT NULL,
+	failed      INTEGER NOT NULL,
+	report      JSONB NOT NULL
+)`
+
+// databaseSink inserts one row per run, holding the JSON report, into a PostgreSQL table
+type databaseSink struct {
+	name string
+	db   *sql.DB
+}
+
+// newDatabaseSink connects to the PostgreSQL database at dsn and creates the fleet_reports
+// table if needed
+func newDatabaseSink(ctx context.Context, dsn string) (*databaseSink, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+	if password, ok := u.User.Password(); ok {
+		RegisterSecret(password)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, createReportsTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create fleet_reports table: %w", err)
+	}
+	return &databaseSink{name: fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, u.Path), db: db}, nil
+}
+
+func (s *databaseSink) Name() string { return s.name }
+
+func (s *databaseSink) Deliver(ctx context.Context, report *Report) error {
+	data, failed, err := encodeFleetResultsJSON(report)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO fleet_reports (run_id, action, finished_at, clusters, failed, report) VALUES ($1, $2, $3, $4, $5, $6)`,
+		report.runID(), report.Action, report.Finished, len(report.Results), failed, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to insert report: %w", err)
+	}
+	return nil
+}
+
+func (s *databaseSink) Close() error { return s.db.Close() }
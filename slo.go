@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SLOOptions configures an SLO calculation over the stored fleet reports
+type SLOOptions struct {
+	Action        string        // fleet action whose runs are measured, e.g. check
+	Window        time.Duration // SLO window ending now
+	Target        float64       // availability objective in percent, e.g. 99.5
+	BurnWindow    time.Duration // recent window the error budget burn rate is warned about
+	BurnThreshold float64       // burn rate in BurnWindow that triggers a warning
+}
+
+// DefaultSLOOptions measures fleet check runs against 99.5% over 30 days, warning when the last
+// day burned the error budget at twice the sustainable rate or faster
+func DefaultSLOOptions() SLOOptions {
+	return SLOOptions{Action: "check", Window: 30 * 24 * time.Hour, Target: 99.5, BurnWindow: 24 * time.Hour, BurnThreshold: 2}
+}
+
+// Validate checks that the options describe a computable SLO
+func (o SLOOptions) Validate() error {
+	switch {
+	case o.Action == "":
+		return fmt.Errorf("the fleet action to measure is missing")
+	case o.Window <= 0 || o.BurnWindow <= 0:
+		return fmt.Errorf("windows must be positive")
+	case o.BurnWindow > o.Window:
+		return fmt.Errorf("the burn rate window %s is longer than the SLO window %s", o.BurnWindow, o.Window)
+	case o.Target <= 0 || o.Target >= 100:
+		return fmt.Errorf("target %.3g%% must be between 0 and 100", o.Target)
+	case o.BurnThreshold <= 0:
+		return fmt.Errorf("burn rate threshold must be positive")
+	}
+	return nil
+}
+
+// sloSample is the outcome of one cluster in one stored run
+type sloSample struct {
+	Time       time.Time
+	OK         bool
+	DurationMS int64
+}
+
+// ClusterSLO is the availability, recovery and latency of one cluster over the SLO window
+type ClusterSLO struct {
+	Cluster      string   `json:"cluster"`
+	Provider     Provider `json:"provider"`
+	Name         string   `json:"name"`
+	Runs         int      `json:"runs"`
+	Failures     int      `json:"failures"`
+	Availability float64  `json:"availability"` // percent of runs the cluster succeeded in
+	// BudgetRemaining is the share of the error budget (100% - Target) left, negative when spent
+	BudgetRemaining float64 `json:"budgetRemaining"`
+	// BurnRate is how fast the error budget burned in the burn rate window, 1 being the rate
+	// that spends it exactly over the SLO window
+	BurnRate float64 `json:"burnRate"`
+	// MTTRSeconds is the mean time from a failing run to the next succeeding one
+	MTTRSeconds float64 `json:"mttrSeconds,omitempty"`
+	Incidents   int     `json:"incidents"` // failure streaks, including one still open
+	LatencyP50  int64   `json:"latencyP50Ms"`
+	LatencyP95  int64   `json:"latencyP95Ms"`
+	// LatencyTrend is the change of the median duration from the first to the second half of
+	// the window, in percent
+	LatencyTrend float64  `json:"latencyTrend"`
+	Warnings     []string `json:"warnings,omitempty"`
+}
+
+// Met reports whether the cluster's availability meets target
+func (s ClusterSLO) Met(target float64) bool {
+	return s.Availability >= target
+}
+
+// SLOReport is the SLO of every cluster found in the stored reports of the window
+type SLOReport struct {
+	Action   string       `json:"action"`
+	Target   float64      `json:"target"`
+	From     time.Time    `json:"from"`
+	To       time.Time    `json:"to"`
+	Reports  int          `json:"reports"`
+	Clusters []ClusterSLO `json:"clusters"`
+}
+
+// storedReport is a fleet report read back from the persistence backend
+type storedReport struct {
+	Finished time.Time
+	Profiles map[string][]fleetResultJSON
+}
+
+// LoadReportHistory reads the reports of action finished since from a source: a postgres:// URL
+// of the database sink, or a glob of JSON report files written by file: sinks
+func LoadReportHistory(ctx context.Context, source, action string, since time.Time) ([]storedReport, error) {
+	if strings.HasPrefix(source, "postgres://") || strings.HasPrefix(source, "postgresql://") {
+		return loadDatabaseReports(ctx, source, action, since)
+	}
+
+	paths, err := filepath.Glob(strings.TrimPrefix(source, "file:"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid report history pattern: %w", err)
+	}
+	var reports []storedReport
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read report: %w", err)
+		}
+		var report fleetReportJSON
+		if err := json.Unmarshal(data, &report); err != nil || report.SchemaVersion == 0 {
+			Verbosef("Skipping %s: not a versioned fleet report", path)
+			continue
+		}
+		if report.Action != action || report.Finished.Before(since) {
+			continue
+		}
+		reports = append(reports, storedReport{Finished: report.Finished, Profiles: report.Profiles})
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Finished.Before(reports[j].Finished) })
+	return reports, nil
+}
+
+// loadDatabaseReports reads reports from the fleet_reports table of the database sink. Rows
+// written before the report schema was versioned hold the profiles object alone.
+func loadDatabaseReports(ctx context.Context, dsn, action string, since time.Time) ([]storedReport, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+	if password, ok := u.User.Password(); ok {
+		RegisterSecret(password)
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT finished_at, report FROM fleet_reports WHERE action = $1 AND finished_at >= $2 ORDER BY finished_at`,
+		action, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fleet_reports: %w", err)
+	}
+	defer rows.Close()
+
+	var reports []storedReport
+	for rows.Next() {
+		var finished time.Time
+		var data []byte
+		if err := rows.Scan(&finished, &data); err != nil {
+			return nil, fmt.Errorf("failed to read fleet_reports: %w", err)
+		}
+		report := storedReport{Finished: finished}
+		var versioned fleetReportJSON
+		if err := json.Unmarshal(data, &versioned); err == nil && versioned.SchemaVersion > 0 {
+			report.Profiles = versioned.Profiles
+		} else if err := json.Unmarshal(data, &report.Profiles); err != nil {
+			Verbosef("Skipping the report of %s: %v", finished.Format(time.RFC3339), err)
+			continue
+		}
+		reports = append(reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read fleet_reports: %w", err)
+	}
+	return reports, nil
+}
+
+// ComputeSLOs calculates each cluster's SLO over the reports, which finished in the window
+// ending at now, in chronological order
+func ComputeSLOs(reports []storedReport, opts SLOOptions, now time.Time) *SLOReport {
+	report := &SLOReport{Action: opts.Action, Target: opts.Target, From: now.Add(-opts.Window), To: now, Reports: len(reports)}
+
+	samples := map[string][]sloSample{}
+	clusters := map[string]fleetResultJSON{}
+	var keys []string
+	for _, stored := range reports {
+		for _, results := range stored.Profiles {
+			for _, result := range results {
+				if _, ok := clusters[result.Cluster]; !ok {
+					keys = append(keys, result.Cluster)
+				}
+				clusters[result.Cluster] = result
+				samples[result.Cluster] = append(samples[result.Cluster],
+					sloSample{Time: stored.Finished, OK: result.Error == "", DurationMS: result.DurationMS})
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		result := clusters[key]
+		slo := computeClusterSLO(samples[key], opts, now)
+		slo.Cluster, slo.Provider, slo.Name = key, result.Provider, result.Name
+		report.Clusters = append(report.Clusters, slo)
+	}
+	return report
+}
+
+// computeClusterSLO calculates the SLO of one cluster from its chronological samples
+func computeClusterSLO(samples []sloSample, opts SLOOptions, now time.Time) ClusterSLO {
+	slo := ClusterSLO{Runs: len(samples)}
+	budget := 1 - opts.Target/100
+
+	burnRuns, burnFailures := 0, 0
+	var failedSince time.Time
+	var recovery time.Duration
+	recovered := 0
+	for _, sample := range samples {
+		if !sample.Time.Before(now.Add(-opts.BurnWindow)) {
+			burnRuns++
+		}
+		if sample.OK {
+			if !failedSince.IsZero() {
+				recovery += sample.Time.Sub(failedSince)
+				recovered++
+				failedSince = time.Time{}
+			}
+			continue
+		}
+		slo.Failures++
+		if !sample.Time.Before(now.Add(-opts.BurnWindow)) {
+			burnFailures++
+		}
+		if failedSince.IsZero() {
+			failedSince = sample.Time
+			slo.Incidents++
+		}
+	}
+
+	if slo.Runs > 0 {
+		slo.Availability = 100 * float64(slo.Runs-slo.Failures) / float64(slo.Runs)
+		slo.BudgetRemaining = 100 * (1 - (float64(slo.Failures)/float64(slo.Runs))/budget)
+	}
+	if burnRuns > 0 {
+		slo.BurnRate = (float64(burnFailures) / float64(burnRuns)) / budget
+	}
+	if recovered > 0 {
+		slo.MTTRSeconds = (recovery / time.Duration(recovered)).Seconds()
+	}
+
+	durations := make([]int64, 0, len(samples))
+	for _, sample := range samples {
+		durations = append(durations, sample.DurationMS)
+	}
+	slo.LatencyP50 = percentile(durations, 50)
+	slo.LatencyP95 = percentile(durations, 95)
+	if half := len(samples) / 2; half > 0 {
+		first, second := percentile(durations[:half], 50), percentile(durations[half:], 50)
+		if first > 0 {
+			slo.LatencyTrend = 100 * float64(second-first) / float64(first)
+		}
+	}
+
+	if slo.Runs > 0 && !slo.Met(opts.Target) {
+		slo.Warnings = append(slo.Warnings, fmt.Sprintf("availability %.3f%% is below the %.3g%% target; the error budget is spent", slo.Availability, opts.Target))
+	}
+	if slo.BurnRate >= opts.BurnThreshold {
+		slo.Warnings = append(slo.Warnings, fmt.Sprintf("error budget burning %.1fx faster than sustainable over the last %s", slo.BurnRate, formatWindow(opts.BurnWindow)))
+	}
+	if !failedSince.IsZero() {
+		slo.Warnings = append(slo.Warnings, fmt.Sprintf("failing since %s", failedSince.UTC().Format(time.RFC3339)))
+	}
+	return slo
+}
+
+// percentile returns the p-th percentile of values by the nearest-rank method
+func percentile(values []int64, p float64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+// ParseWindow parses a window such as 30d, 12h or 90m; d counts 24 hours
+func ParseWindow(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid window %q", value)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil || window <= 0 {
+		return 0, fmt.Errorf("invalid window %q (e.g. 30d, 12h)", value)
+	}
+	return window, nil
+}
+
+// formatWindow renders a window in days when it is a whole number of them
+func formatWindow(window time.Duration) string {
+	if window >= 24*time.Hour && window%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", window/(24*time.Hour))
+	}
+	return window.String()
+}
+
+// PrintSLOReport renders the SLO report for humans and returns the number of clusters missing
+// the target or burning their budget too fast
+func PrintSLOReport(report *SLOReport, opts SLOOptions) int {
+	fmt.Printf("SLO %.3g%% for fleet %s over %s (%d runs since %s)\n",
+		report.Target, report.Action, formatWindow(opts.Window), report.Reports, report.From.UTC().Format(time.RFC3339))
+	if len(report.Clusters) == 0 {
+		fmt.Println("  no stored reports in the window")
+		return 0
+	}
+
+	problems := 0
+	for _, slo := range report.Clusters {
+		symbol := "✓"
+		if len(slo.Warnings) > 0 {
+			symbol = "⚠"
+			problems++
+		}
+		if !slo.Met(report.Target) {
+			symbol = "✗"
+		}
+		mttr := "-"
+		if slo.MTTRSeconds > 0 {
+			mttr = (time.Duration(slo.MTTRSeconds) * time.Second).String()
+		}
+		fmt.Printf("%s %s: %.3f%% available (%d/%d runs failed), budget left %.0f%%, burn rate %.1fx, MTTR %s, latency p50 %dms p95 %dms (%+.0f%%)\n",
+			symbol, slo.Cluster, slo.Availability, slo.Failures, slo.Runs, slo.BudgetRemaining, slo.BurnRate, mttr,
+			slo.LatencyP50, slo.LatencyP95, slo.LatencyTrend)
+		for _, warning := range slo.Warnings {
+			fmt.Printf("    ⚠ %s\n", warning)
+		}
+	}
+	return problems
+}
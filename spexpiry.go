@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// DefaultSPExpiryWindow flags service principal client secrets and certificates expiring within
+// this long
+const DefaultSPExpiryWindow = 30 * 24 * time.Hour
+
+// errGraphNotFound is returned for Graph objects that do not exist, such as the application of a
+// managed identity
+var errGraphNotFound = errors.New("not found")
+
+// AppCredential is a client secret or certificate of an Azure AD application or its service
+// principal
+type AppCredential struct {
+	Kind  string    `json:"kind"`  // secret or certificate
+	Owner string    `json:"owner"` // application or service principal
+	Name  string    `json:"name,omitempty"`
+	KeyID string    `json:"keyId"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// InUse marks the client secret the tool authenticates with, recognised by its hint (first
+	// characters)
+	InUse bool `json:"inUse,omitempty"`
+}
+
+// Label names the credential for humans, e.g. "client secret ci (2f1c…)"
+func (c AppCredential) Label() string {
+	kind := "client secret"
+	if c.Kind == "certificate" {
+		kind = "certificate"
+	}
+	id := c.KeyID
+	if len(id) > 8 {
+		id = id[:8] + "…"
+	}
+	if c.Name == "" {
+		return fmt.Sprintf("%s %s", kind, id)
+	}
+	return fmt.Sprintf("%s %s (%s)", kind, c.Name, id)
+}
+
+// ServicePrincipalCredentials are the client secrets and certificates of the service principal
+// the tool authenticates to Azure as
+type ServicePrincipalCredentials struct {
+	AppID       string          `json:"appId"`
+	DisplayName string          `json:"displayName,omitempty"`
+	Credentials []AppCredential `json:"credentials"`
+}
+
+// spCredentialReader is implemented by clients that can read the credentials of the service
+// principal they authenticate as. It returns nil when the client does not authenticate as one.
+type spCredentialReader interface {
+	ServicePrincipalCredentials(ctx context.Context) (*ServicePrincipalCredentials, error)
+}
+
+// graphCredentialObject is the part of a Graph application or servicePrincipal holding its
+// credentials
+type graphCredentialObject struct {
+	DisplayName         string `json:"displayName"`
+	PasswordCredentials []struct {
+		KeyID         string    `json:"keyId"`
+		DisplayName   string    `json:"displayName"`
+		Hint          string    `json:"hint"`
+		StartDateTime time.Time `json:"startDateTime"`
+		EndDateTime   time.Time `json:"endDateTime"`
+	} `json:"passwordCredentials"`
+	KeyCredentials []struct {
+		KeyID         string    `json:"keyId"`
+		DisplayName   string    `json:"displayName"`
+		Usage         string    `json:"usage"`
+		StartDateTime time.Time `json:"startDateTime"`
+		EndDateTime   time.Time `json:"endDateTime"`
+	} `json:"keyCredentials"`
+}
+
+// ReadServicePrincipalCredentials reads the client secrets and certificates of the application
+// cred authenticates as, and of its service principal, from Microsoft Graph. secret, when known,
+// is the client secret in use, recognised among them by its hint. It returns nil when cred
+// authenticates as a user. Reading another tenant's application, as for a multi-tenant app, is
+// not possible, so only its service principal's credentials are seen then.
+func ReadServicePrincipalCredentials(ctx context.Context, cred azcore.TokenCredential, secret string) (*ServicePrincipalCredentials, error) {
+	endpoint := azureGraphEndpoints[azureCloud]
+	token, err := cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{endpoint + "/.default"}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Microsoft Graph token: %w", err)
+	}
+	claims, err := jwtClaims(token.Token)
+	if err != nil {
+		return nil, err
+	}
+	if _, delegated := claims["scp"]; delegated {
+		return nil, nil
+	}
+	appID, _ := claims["appid"].(string)
+	if appID == "" {
+		appID, _ = claims["azp"].(string)
+	}
+	if appID == "" {
+		return nil, errors.New("Microsoft Graph token names no application")
+	}
+
+	credentials := &ServicePrincipalCredentials{AppID: appID}
+	for _, owner := range []string{"application", "service principal"} {
+		collection := "applications"
+		if owner == "service principal" {
+			collection = "servicePrincipals"
+		}
+		var object graphCredentialObject
+		path := fmt.Sprintf("/v1.0/%s(appId='%s')", collection, url.PathEscape(appID))
+		err := graphGet(ctx, endpoint, token.Token, path+"?$select=displayName,passwordCredentials,keyCredentials", &object)
+		if errors.Is(err, errGraphNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the %s of %s: %w", owner, appID, err)
+		}
+		if credentials.DisplayName == "" {
+			credentials.DisplayName = object.DisplayName
+		}
+		for _, password := range object.PasswordCredentials {
+			credentials.Credentials = append(credentials.Credentials, AppCredential{
+				Kind:  "secret",
+				Owner: owner,
+				Name:  password.DisplayName,
+				KeyID: password.KeyID,
+				Start: password.StartDateTime,
+				End:   password.EndDateTime,
+				InUse: secret != "" && password.Hint != "" && strings.HasPrefix(secret, password.Hint),
+			})
+		}
+		for _, key := range object.KeyCredentials {
+			if key.Usage != "Verify" {
+				continue // signing and encryption keys, not client credentials
+			}
+			credentials.Credentials = append(credentials.Credentials, AppCredential{
+				Kind:  "certificate",
+				Owner: owner,
+				Name:  key.DisplayName,
+				KeyID: key.KeyID,
+				Start: key.StartDateTime,
+				End:   key.EndDateTime,
+			})
+		}
+	}
+	sort.Slice(credentials.Credentials, func(i, j int) bool {
+		return credentials.Credentials[i].End.Before(credentials.Credentials[j].End)
+	})
+	return credentials, nil
+}
+
+// graphGet reads the Microsoft Graph object at path into out
+func graphGet(ctx context.Context, endpoint, token, path string, out interface{}) error {
+	ctx, cancel := withPhaseTimeout(ctx, PhaseCloudAPI)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := auditedHTTPClient("azure").Do(req)
+	if err != nil {
+		return phaseTimeoutError(ctx, PhaseCloudAPI, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errGraphNotFound
+	case resp.StatusCode == http.StatusForbidden:
+		return errors.New("access denied; grant the application the Application.Read.All Microsoft Graph permission")
+	case resp.StatusCode != http.StatusOK:
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Microsoft Graph returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode Microsoft Graph response: %w", err)
+	}
+	return nil
+}
+
+// CheckServicePrincipalExpiry fails when the client secret or certificate the tool
+// authenticates to Azure with has expired and warns when it expires within window. When the
+// secret in use cannot be recognised, the credential expiring last counts, so the check warns
+// once every credential is about to expire.
+func CheckServicePrincipalExpiry(ctx context.Context, client ClusterClient, window time.Duration) CheckResult {
+	result := CheckResult{Name: "sp-expiry"}
+	reader, ok := client.(spCredentialReader)
+	if !ok {
+		result.Status = CheckPass
+		result.Message = fmt.Sprintf("%s clusters do not use an Azure service principal", client.Identity().Provider)
+		return result
+	}
+	sp, err := reader.ServicePrincipalCredentials(ctx)
+	if err != nil {
+		result.Status = CheckWarn
+		result.Message = fmt.Sprintf("failed to read service principal credentials: %v", err)
+		return result
+	}
+	if sp == nil {
+		result.Status = CheckPass
+		result.Message = "not authenticated as a service principal"
+		return result
+	}
+	name := sp.AppID
+	if sp.DisplayName != "" {
+		name = fmt.Sprintf("%s (%s)", sp.DisplayName, sp.AppID)
+	}
+	if len(sp.Credentials) == 0 {
+		result.Status = CheckPass
+		result.Message = fmt.Sprintf("%s has no client secrets or certificates (managed identity or federated credentials)", name)
+		return result
+	}
+
+	now := time.Now()
+	var inUse *AppCredential
+	for i := range sp.Credentials {
+		credential := &sp.Credentials[i]
+		if credential.InUse {
+			inUse = credential
+		}
+		marker := ""
+		if credential.InUse {
+			marker = ", in use"
+		}
+		remaining := credential.End.Sub(now)
+		switch {
+		case remaining <= 0:
+			result.Details = append(result.Details, fmt.Sprintf("✗ %s of the %s expired %s%s", credential.Label(), credential.Owner, credential.End.Format(time.RFC3339), marker))
+		case remaining <= window:
+			result.Details = append(result.Details, fmt.Sprintf("⚠ %s of the %s expires %s, in %d day(s)%s", credential.Label(), credential.Owner, credential.End.Format(time.RFC3339), int(remaining.Hours()/24), marker))
+		default:
+			result.Details = append(result.Details, fmt.Sprintf("✓ %s of the %s expires %s%s", credential.Label(), credential.Owner, credential.End.Format("2006-01-02"), marker))
+		}
+	}
+
+	subject := "the client secret in use"
+	if inUse == nil {
+		subject = "the longest-lived credential"
+		if len(sp.Credentials) == 1 {
+			subject = "the only credential"
+		}
+		inUse = &sp.Credentials[0]
+		for i := range sp.Credentials {
+			if sp.Credentials[i].End.After(inUse.End) {
+				inUse = &sp.Credentials[i]
+			}
+		}
+	}
+	remaining := inUse.End.Sub(now)
+	switch {
+	case remaining <= 0:
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%s of %s expired %s", subject, name, inUse.End.Format(time.RFC3339))
+	case remaining <= window:
+		result.Status = CheckWarn
+		result.Message = fmt.Sprintf("%s of %s expires %s, in %d day(s); rotate it", subject, name, inUse.End.Format("2006-01-02"), int(remaining.Hours()/24))
+	default:
+		result.Status = CheckPass
+		result.Message = fmt.Sprintf("%s of %s is valid until %s", subject, name, inUse.End.Format("2006-01-02"))
+	}
+	return result
+}
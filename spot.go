@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// spotLabels are the node labels and values marking interruptible capacity on each provider
+var spotLabels = []struct{ label, value, kind string }{
+	{"eks.amazonaws.com/capacityType", "SPOT", "spot"},
+	{"karpenter.sh/capacity-type", "spot", "spot"},
+	{"cloud.google.com/gke-spot", "true", "spot"},
+	{"cloud.google.com/gke-preemptible", "true", "preemptible"},
+	{"kubernetes.azure.com/scalesetpriority", "spot", "spot"},
+	{"kubernetes.azure.com/scalesetpriority", "low", "low-priority"},
+}
+
+// CapacityPool is the capacity of one node pool and whether it can be interrupted
+type CapacityPool struct {
+	Pool          string `json:"pool"`
+	Interruptible string `json:"interruptible,omitempty"` // "spot", "preemptible" or "low-priority"; empty for on-demand
+	Nodes         int    `json:"nodes"`
+	CPU           string `json:"cpu"`
+}
+
+// CapacityReport splits a cluster's nodes into on-demand and interruptible capacity
+type CapacityReport struct {
+	Pools              []CapacityPool `json:"pools"`
+	Nodes              int            `json:"nodes"`
+	InterruptibleNodes int            `json:"interruptibleNodes"`
+	// InterruptibleCPU is the fraction of allocatable CPU on interruptible nodes
+	InterruptibleCPU float64 `json:"interruptibleCPU"`
+}
+
+// interruptibleKind returns how a node can be interrupted, or "" for on-demand capacity
+func interruptibleKind(node *corev1.Node) string {
+	for _, spot := range spotLabels {
+		if node.Labels[spot.label] == spot.value {
+			return spot.kind
+		}
+	}
+	return ""
+}
+
+// AnalyzeCapacity groups nodes by pool and works out how much of the cluster's capacity is
+// spot, preemptible or low-priority, from the labels each provider puts on such nodes
+func AnalyzeCapacity(ctx context.Context, clientset kubernetes.Interface) (*CapacityReport, error) {
+	report := &CapacityReport{}
+	pools := map[string]*CapacityPool{}
+	cpu := map[string]*resource.Quantity{}
+	var totalCPU, interruptibleCPU resource.Quantity
+
+	err := EachNode(ctx, clientset, metav1.ListOptions{}, func(node *corev1.Node) error {
+		kind := interruptibleKind(node)
+		key := nodePoolName(node) + "/" + kind
+		pool, ok := pools[key]
+		if !ok {
+			pool = &CapacityPool{Pool: nodePoolName(node), Interruptible: kind}
+			pools[key] = pool
+			cpu[key] = &resource.Quantity{}
+		}
+		pool.Nodes++
+		report.Nodes++
+
+		allocatable := node.Status.Allocatable[corev1.ResourceCPU]
+		cpu[key].Add(allocatable)
+		totalCPU.Add(allocatable)
+		if kind != "" {
+			report.InterruptibleNodes++
+			interruptibleCPU.Add(allocatable)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for key, pool := range pools {
+		pool.CPU = cpu[key].String()
+		report.Pools = append(report.Pools, *pool)
+	}
+	sort.Slice(report.Pools, func(i, j int) bool {
+		if report.Pools[i].Pool != report.Pools[j].Pool {
+			return report.Pools[i].Pool < report.Pools[j].Pool
+		}
+		return report.Pools[i].Interruptible < report.Pools[j].Interruptible
+	})
+	if totalCPU.MilliValue() > 0 {
+		report.InterruptibleCPU = float64(interruptibleCPU.MilliValue()) / float64(totalCPU.MilliValue())
+	}
+	return report, nil
+}
+
+// CheckSpotCapacity reports which node pools run on interruptible capacity and the fraction of
+// the cluster's CPU they hold. It is informational and always passes.
+func CheckSpotCapacity(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "spot-capacity"}
+
+	report, err := AnalyzeCapacity(ctx, client.Clientset())
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	for _, pool := range report.Pools {
+		capacity := "on-demand"
+		if pool.Interruptible != "" {
+			capacity = pool.Interruptible
+		}
+		result.Details = append(result.Details, fmt.Sprintf("%s: %s, %d node(s), %s CPU", pool.Pool, capacity, pool.Nodes, pool.CPU))
+	}
+
+	result.Status = CheckPass
+	result.Message = fmt.Sprintf("%d of %d node(s) interruptible, %.0f%% of allocatable CPU",
+		report.InterruptibleNodes, report.Nodes, report.InterruptibleCPU*100)
+	return result
+}
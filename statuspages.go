@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+)
+
+// Public status feeds polled for incidents, variables so they can be pointed at mirrors
+var (
+	awsStatusURL    = "https://health.aws.amazon.com/public/currentevents"
+	azureStatusURL  = "https://azure.status.microsoft/en-us/status/feed/"
+	gcpIncidentsURL = "https://status.cloud.google.com/incidents.json"
+)
+
+// statusFeedTimeout bounds the download of a status feed
+const statusFeedTimeout = 15 * time.Second
+
+// awsStatusServices are the AWS status page services whose events affect EKS clusters
+var awsStatusServices = []string{"eks", "ec2", "elb", "multipleservices"}
+
+// azureStatusProducts are the words marking Azure status items that affect AKS clusters
+var azureStatusProducts = []string{"Kubernetes", "AKS", "Virtual Machines"}
+
+// gcpHealthProducts are the Google Cloud status products whose incidents affect GKE clusters
+var gcpHealthProducts = []string{"Google Kubernetes Engine", "Google Compute Engine", "Cloud Load Balancing"}
+
+// StatusPageRegions returns, per provider, the regions of the clusters in config; a provider
+// with clusters but no known regions gets an empty list, matching incidents in any region
+func StatusPageRegions(config *FleetConfig) map[Provider][]string {
+	regions := map[Provider][]string{}
+	seen := map[string]bool{}
+	for _, cluster := range config.Clusters {
+		if _, ok := regions[cluster.Provider]; !ok {
+			regions[cluster.Provider] = nil
+		}
+		region := cluster.Region
+		if m := gcpZone.FindStringSubmatch(region); cluster.Provider == ProviderGKE && m != nil {
+			region = m[1]
+		}
+		key := string(cluster.Provider) + "/" + region
+		if region == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		regions[cluster.Provider] = append(regions[cluster.Provider], region)
+	}
+	return regions
+}
+
+// FetchStatusPageIncidents polls the public status pages of the providers in regions (the AWS
+// Health Dashboard, Azure status and Google Cloud status) concurrently and returns their active
+// incidents affecting EKS, AKS or GKE in those regions. Feeds that cannot be read are logged and
+// skipped, as status pages are advisory.
+func FetchStatusPageIncidents(ctx context.Context, regions map[Provider][]string) []ProviderEvent {
+	fetchers := map[Provider]func(context.Context, []string) ([]ProviderEvent, error){
+		ProviderEKS: fetchAWSStatusIncidents,
+		ProviderAKS: fetchAzureStatusIncidents,
+		ProviderGKE: fetchGCPIncidents,
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	byProvider := map[Provider][]ProviderEvent{}
+	for provider, providerRegions := range regions {
+		fetch, ok := fetchers[provider]
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(provider Provider, regions []string) {
+			defer wg.Done()
+			events, err := fetch(ctx, regions)
+			if err != nil {
+				Verbosef("Failed to poll the %s status page: %v", strings.ToUpper(string(provider)), err)
+				return
+			}
+			mu.Lock()
+			byProvider[provider] = events
+			mu.Unlock()
+		}(provider, providerRegions)
+	}
+	wg.Wait()
+
+	var incidents []ProviderEvent
+	for _, provider := range []Provider{ProviderAKS, ProviderEKS, ProviderGKE} {
+		incidents = append(incidents, byProvider[provider]...)
+	}
+	return incidents
+}
+
+// PrintStatusPageIncidents renders the active status page incidents as a report header
+func PrintStatusPageIncidents(incidents []ProviderEvent) {
+	if len(incidents) == 0 {
+		return
+	}
+	fmt.Printf("⚠ %d active incident(s) on provider status pages:\n", len(incidents))
+	for _, incident := range incidents {
+		line := fmt.Sprintf("  %s: %s", incident.Source, incident.Summary)
+		if !incident.Started.IsZero() {
+			line += fmt.Sprintf(" (since %s)", incident.Started.UTC().Format(time.RFC3339))
+		}
+		fmt.Println(line)
+	}
+}
+
+// getStatusFeed downloads the public status feed of the cloud api (aws, azure or gcp)
+func getStatusFeed(ctx context.Context, api, feedURL string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, statusFeedTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := auditedHTTPClient(api).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", feedURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read %s (HTTP %d)", feedURL, resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", feedURL, err)
+	}
+	return data, nil
+}
+
+// decodeUTF16 converts a feed served as UTF-16 with a byte order mark, as the AWS Health
+// Dashboard does, to UTF-8; other data is returned unchanged
+func decodeUTF16(data []byte) []byte {
+	var order func([]byte) uint16
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		order = func(b []byte) uint16 { return uint16(b[0]) | uint16(b[1])<<8 }
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		order = func(b []byte) uint16 { return uint16(b[1]) | uint16(b[0])<<8 }
+	default:
+		return bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+	}
+	units := make([]uint16, 0, len(data)/2)
+	for i := 2; i+1 < len(data); i += 2 {
+		units = append(units, order(data[i:i+2]))
+	}
+	return []byte(string(utf16.Decode(units)))
+}
+
+// fetchAWSStatusIncidents reads the AWS Health Dashboard's current events and returns those of
+// awsStatusServices in regions
+func fetchAWSStatusIncidents(ctx context.Context, regions []string) ([]ProviderEvent, error) {
+	data, err := getStatusFeed(ctx, "aws", awsStatusURL)
+	if err != nil {
+		return nil, err
+	}
+	var events []struct {
+		Date        string `json:"date"`
+		Service     string `json:"service"` // service-region, e.g. eks-us-east-1
+		ServiceName string `json:"service_name"`
+		Summary     string `json:"summary"`
+	}
+	if err := json.Unmarshal(decodeUTF16(data), &events); err != nil {
+		return nil, fmt.Errorf("failed to decode the AWS Health Dashboard feed: %w", err)
+	}
+
+	var incidents []ProviderEvent
+	for _, event := range events {
+		service, region, _ := strings.Cut(event.Service, "-")
+		if !containsFold(awsStatusServices, service) || (len(regions) > 0 && !containsFold(regions, region)) {
+			continue
+		}
+		incident := ProviderEvent{
+			Source:  "AWS status",
+			Kind:    "incident",
+			Summary: fmt.Sprintf("%s in %s: %s", event.ServiceName, region, event.Summary),
+		}
+		if seconds, err := strconv.ParseInt(event.Date, 10, 64); err == nil {
+			incident.Started = time.Unix(seconds, 0)
+		}
+		incidents = append(incidents, incident)
+	}
+	return incidents, nil
+}
+
+// fetchAzureStatusIncidents reads the Azure status RSS feed and returns the items about
+// azureStatusProducts mentioning one of regions, or any item about them when regions is empty.
+// Items name regions by display name ("East US"), compared without spaces to region codes.
+func fetchAzureStatusIncidents(ctx context.Context, regions []string) ([]ProviderEvent, error) {
+	data, err := getStatusFeed(ctx, "azure", azureStatusURL)
+	if err != nil {
+		return nil, err
+	}
+	var feed struct {
+		Items []struct {
+			Title       string `xml:"title"`
+			Description string `xml:"description"`
+			PubDate     string `xml:"pubDate"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		return nil, fmt.Errorf("failed to decode the Azure status feed: %w", err)
+	}
+
+	var incidents []ProviderEvent
+	for _, item := range feed.Items {
+		text := item.Title + " " + item.Description
+		relevant := false
+		for _, product := range azureStatusProducts {
+			relevant = relevant || strings.Contains(text, product)
+		}
+		compact := strings.ToLower(strings.ReplaceAll(text, " ", ""))
+		inRegion := len(regions) == 0
+		for _, region := range regions {
+			inRegion = inRegion || strings.Contains(compact, strings.ToLower(region))
+		}
+		if !relevant || !inRegion {
+			continue
+		}
+		incident := ProviderEvent{Source: "Azure status", Kind: "incident", Summary: strings.TrimSpace(item.Title)}
+		if started, err := time.Parse(time.RFC1123Z, item.PubDate); err == nil {
+			incident.Started = started
+		} else if started, err := time.Parse(time.RFC1123, item.PubDate); err == nil {
+			incident.Started = started
+		}
+		incidents = append(incidents, incident)
+	}
+	return incidents, nil
+}
+
+// fetchGCPIncidents reads the Google Cloud status feed and returns the ongoing incidents of
+// gcpHealthProducts affecting one of regions or all locations, or any region when regions is
+// empty
+func fetchGCPIncidents(ctx context.Context, regions []string) ([]ProviderEvent, error) {
+	data, err := getStatusFeed(ctx, "gcp", gcpIncidentsURL)
+	if err != nil {
+		return nil, err
+	}
+
+	type product struct {
+		Title string `json:"title"`
+		ID    string `json:"id"`
+	}
+	var incidents []struct {
+		Begin            time.Time `json:"begin"`
+		End              string    `json:"end"`
+		ExternalDesc     string    `json:"external_desc"`
+		AffectedProducts []product `json:"affected_products"`
+		Locations        []product `json:"currently_affected_locations"`
+	}
+	if err := json.Unmarshal(data, &incidents); err != nil {
+		return nil, fmt.Errorf("failed to decode the Google Cloud status feed: %w", err)
+	}
+
+	var events []ProviderEvent
+	for _, incident := range incidents {
+		if incident.End != "" {
+			continue
+		}
+		var products []string
+		for _, p := range incident.AffectedProducts {
+			if containsFold(gcpHealthProducts, p.Title) {
+				products = append(products, p.Title)
+			}
+		}
+		inRegion := len(regions) == 0 || len(incident.Locations) == 0
+		for _, location := range incident.Locations {
+			inRegion = inRegion || location.ID == "global" || containsFold(regions, location.ID)
+		}
+		if len(products) == 0 || !inRegion {
+			continue
+		}
+		events = append(events, ProviderEvent{
+			Source:  "Google Cloud",
+			Kind:    "incident",
+			Summary: fmt.Sprintf("%s: %s", strings.Join(products, ", "), incident.ExternalDesc),
+			Started: incident.Begin,
+		})
+	}
+	return events, nil
+}
+
+// containsFold reports whether values contains s, ignoring case
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// defaultStorageClassAnnotation marks the StorageClass used by PVCs that name none
+const defaultStorageClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+
+// cloudDiskDrivers are the CSI drivers provisioning each cloud's block storage
+var cloudDiskDrivers = map[Provider]string{
+	ProviderAKS: "disk.csi.azure.com",
+	ProviderEKS: "ebs.csi.aws.com",
+	ProviderGKE: "pd.csi.storage.gke.io",
+}
+
+// StorageProbeOptions configures the dynamic provisioning probe
+type StorageProbeOptions struct {
+	StorageClass string // empty for the cluster's default StorageClass
+	Size         string
+	Image        string
+	Namespace    string
+	Timeout      time.Duration
+}
+
+// StorageProbeReport is the outcome of the dynamic provisioning probe
+type StorageProbeReport struct {
+	StorageClasses []string // "name (provisioner)", the default one marked
+	CSIDrivers     []string
+	StorageClass   string // class the probe claim used
+	Provisioned    bool
+	Detail         string
+	Warnings       []string
+}
+
+// RunStorageProbe lists the StorageClasses and CSIDrivers, then creates a small
+// PersistentVolumeClaim and a pod that writes to it, verifying that a volume is provisioned,
+// attached and mounted. The pod and claim are always deleted afterwards.
+func RunStorageProbe(ctx context.Context, clientset kubernetes.Interface, provider Provider, opts StorageProbeOptions) (*StorageProbeReport, error) {
+	report := &StorageProbeReport{StorageClass: opts.StorageClass}
+
+	classes, err := clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage classes: %w", err)
+	}
+	var defaults []string
+	for _, class := range classes.Items {
+		label := fmt.Sprintf("%s (%s)", class.Name, class.Provisioner)
+		if class.Annotations[defaultStorageClassAnnotation] == "true" {
+			defaults = append(defaults, class.Name)
+			label += " default"
+		}
+		report.StorageClasses = append(report.StorageClasses, label)
+	}
+	sort.Strings(defaults)
+
+	drivers, err := clientset.StorageV1().CSIDrivers().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list CSI drivers: %w", err)
+	}
+	for _, driver := range drivers.Items {
+		report.CSIDrivers = append(report.CSIDrivers, driver.Name)
+	}
+	if expected := cloudDiskDrivers[provider]; expected != "" && !slices.Contains(report.CSIDrivers, expected) {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("CSI driver %s is not installed", expected))
+	}
+
+	if report.StorageClass == "" {
+		if len(defaults) == 0 {
+			return nil, fmt.Errorf("the cluster has no default StorageClass; choose one with --storage-class")
+		}
+		if len(defaults) > 1 {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("several default StorageClasses: %s", strings.Join(defaults, ", ")))
+		}
+		report.StorageClass = defaults[0]
+	} else if !storageClassExists(classes.Items, report.StorageClass) {
+		return nil, fmt.Errorf("StorageClass %q not found", report.StorageClass)
+	}
+
+	size, err := resource.ParseQuantity(opts.Size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid volume size %q: %w", opts.Size, err)
+	}
+	managedBy := map[string]string{"app.kubernetes.io/managed-by": "connect-managed-k8s"}
+	claim := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "connect-k8s-storage-probe-", Namespace: opts.Namespace, Labels: managedBy},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: &report.StorageClass,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: size},
+			},
+		},
+	}
+	createdClaim, err := clientset.CoreV1().PersistentVolumeClaims(opts.Namespace).Create(ctx, claim, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create probe volume claim: %w", err)
+	}
+	defer deleteProbeClaim(clientset, createdClaim.Namespace, createdClaim.Name)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "connect-k8s-storage-probe-", Namespace: opts.Namespace, Labels: managedBy},
+		Spec: corev1.PodSpec{
+			RestartPolicy:         corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds: int64Ptr(int64(opts.Timeout.Seconds())),
+			NodeSelector:          map[string]string{"kubernetes.io/os": "linux"},
+			Containers: []corev1.Container{{
+				Name:         "probe",
+				Image:        opts.Image,
+				Command:      []string{"sh", "-c", "echo ok > /data/probe && cat /data/probe"},
+				VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/data"}},
+			}},
+			Volumes: []corev1.Volume{{
+				Name: "data",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: createdClaim.Name},
+				},
+			}},
+		},
+	}
+	createdPod, err := clientset.CoreV1().Pods(opts.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create probe pod: %w", err)
+	}
+	defer deleteProbePod(clientset, createdPod.Namespace, createdPod.Name)
+
+	start := time.Now()
+	if err := waitForPodCompletion(ctx, clientset, createdPod.Namespace, createdPod.Name, opts.Timeout); err != nil {
+		report.Detail = storageProbeFailure(ctx, clientset, createdClaim.Namespace, createdClaim.Name, err)
+		return report, nil
+	}
+	finished, err := clientset.CoreV1().Pods(createdPod.Namespace).Get(ctx, createdPod.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get probe pod: %w", err)
+	}
+	if finished.Status.Phase != corev1.PodSucceeded {
+		report.Detail = fmt.Sprintf("probe pod %s: could not write to the volume", finished.Status.Phase)
+		return report, nil
+	}
+
+	report.Provisioned = true
+	report.Detail = fmt.Sprintf("%s volume provisioned, mounted and written in %s", size.String(), time.Since(start).Round(time.Second))
+	return report, nil
+}
+
+// storageProbeFailure explains a probe pod that did not complete, from the claim's phase and
+// its latest event
+func storageProbeFailure(ctx context.Context, clientset kubernetes.Interface, namespace, name string, err error) string {
+	claim, getErr := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	if getErr != nil || claim.Status.Phase == corev1.ClaimBound {
+		return err.Error()
+	}
+
+	detail := fmt.Sprintf("volume claim still %s", claim.Status.Phase)
+	events, listErr := clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "involvedObject.kind=PersistentVolumeClaim,involvedObject.name=" + name,
+	})
+	if listErr == nil && len(events.Items) > 0 {
+		sort.Slice(events.Items, func(i, j int) bool {
+			return events.Items[i].LastTimestamp.Before(&events.Items[j].LastTimestamp)
+		})
+		latest := events.Items[len(events.Items)-1]
+		detail += fmt.Sprintf(": %s: %s", latest.Reason, latest.Message)
+	}
+	return detail
+}
+
+// deleteProbeClaim removes a probe volume claim, logging instead of failing so cleanup never
+// masks a result. Dynamically provisioned volumes are released with their claim.
+func deleteProbeClaim(clientset kubernetes.Interface, namespace, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		Warnf("Failed to delete probe volume claim %s/%s: %v", namespace, name, err)
+	}
+}
+
+// storageClassExists reports whether a StorageClass named name is in classes
+func storageClassExists(classes []storagev1.StorageClass, name string) bool {
+	for _, class := range classes {
+		if class.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckStorageProbe runs the dynamic provisioning probe and turns it into a check result
+func CheckStorageProbe(ctx context.Context, client ClusterClient, opts StorageProbeOptions) CheckResult {
+	result := CheckResult{Name: "storage-probe"}
+
+	report, err := RunStorageProbe(ctx, client.Clientset(), client.Identity().Provider, opts)
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+
+	result.Details = append(result.Details, "StorageClasses: "+strings.Join(report.StorageClasses, ", "))
+	result.Details = append(result.Details, "CSI drivers: "+strings.Join(report.CSIDrivers, ", "))
+	for _, warning := range report.Warnings {
+		result.Details = append(result.Details, "⚠ "+warning)
+	}
+
+	if !report.Provisioned {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("dynamic provisioning with StorageClass %s failed: %s", report.StorageClass, report.Detail)
+		return result
+	}
+	result.Status = CheckPass
+	result.Message = fmt.Sprintf("StorageClass %s: %s", report.StorageClass, report.Detail)
+	return result
+}
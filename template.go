@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// reportTemplate is a parsed text/template or html/template
+type reportTemplate interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// reportTemplateFuncs are the functions available to report templates besides the built-ins
+var reportTemplateFuncs = map[string]interface{}{
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"join":    joinTemplateValues,
+	"replace": strings.ReplaceAll,
+	"json":    templateJSON,
+	"symbol":  templateSymbol,
+	"time":    templateTime,
+}
+
+// LoadReportTemplate parses the report template at path, as an html/template with contextual
+// escaping when the file ends in .html or .htm and as a text/template otherwise
+func LoadReportTemplate(path string) (reportTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report template: %w", err)
+	}
+	name := filepath.Base(path)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		tmpl, err := htmltemplate.New(name).Funcs(reportTemplateFuncs).Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse report template: %w", err)
+		}
+		return tmpl, nil
+	default:
+		tmpl, err := template.New(name).Funcs(reportTemplateFuncs).Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse report template: %w", err)
+		}
+		return tmpl, nil
+	}
+}
+
+// RenderReportTemplate executes tmpl over the JSON form of report, so templates use the field
+// names of the report schema (.action, .failed, .profiles, ...) and stay stable across releases
+func RenderReportTemplate(w io.Writer, tmpl reportTemplate, report *Report) error {
+	data, _, err := encodeFleetResultsJSON(report)
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return fmt.Errorf("failed to decode fleet report: %w", err)
+	}
+	if err := tmpl.Execute(w, doc); err != nil {
+		return fmt.Errorf("failed to render report template: %w", err)
+	}
+	return nil
+}
+
+// templateSink prints the report rendered with a custom template
+type templateSink struct {
+	path string
+	tmpl reportTemplate
+}
+
+func (s templateSink) Name() string { return "template " + s.path }
+
+func (s templateSink) Deliver(ctx context.Context, report *Report) error {
+	var out strings.Builder
+	if err := RenderReportTemplate(&out, s.tmpl, report); err != nil {
+		return err
+	}
+	fmt.Print(Redact(out.String()))
+	return nil
+}
+
+func (s templateSink) Close() error { return nil }
+
+// joinTemplateValues joins a list of values, such as a check's details, with sep
+func joinTemplateValues(sep string, values []interface{}) string {
+	parts := make([]string, 0, len(values))
+	for _, value := range values {
+		parts = append(parts, fmt.Sprint(value))
+	}
+	return strings.Join(parts, sep)
+}
+
+// templateJSON encodes a value, e.g. an action's output, as compact JSON
+func templateJSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// templateSymbol returns ✓ for a passed check or a result without error, ⚠ for a check that
+// warned, ○ for a skipped one, and ✗ otherwise
+func templateSymbol(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		if v == "" || v == string(CheckPass) {
+			return "✓"
+		}
+		if v == string(CheckWarn) {
+			return "⚠"
+		}
+		if v == string(CheckSkip) {
+			return "○"
+		}
+	case nil:
+		return "✓"
+	}
+	return "✗"
+}
+
+// templateTime reformats an RFC 3339 time from the report with a Go time layout, e.g.
+// {{time "02.01.2006 15:04" .finished}}, in the local time zone
+func templateTime(layout string, value string) (string, error) {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return "", err
+	}
+	return t.Local().Format(layout), nil
+}
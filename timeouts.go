@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/aws/smithy-go/middleware"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"k8s.io/client-go/rest"
+)
+
+// Phase is a stage of talking to a cluster that has its own timeout budget
+type Phase string
+
+const (
+	// PhaseAuth is credential acquisition: credential validation, role assumption and minting
+	// Kubernetes tokens
+	PhaseAuth Phase = "auth"
+	// PhaseCloudAPI is calls to the provider control plane (ARM, EKS, GKE APIs)
+	PhaseCloudAPI Phase = "cloud API"
+	// PhaseKubernetes is calls to the cluster's Kubernetes API server
+	PhaseKubernetes Phase = "Kubernetes API"
+)
+
+// PhaseTimeouts bounds each phase separately so a slow phase fails fast with an error naming
+// it. Auth and Kubernetes timeouts apply per operation, cloud API timeouts per call; zero
+// disables a timeout.
+type PhaseTimeouts struct {
+	Auth       time.Duration
+	CloudAPI   time.Duration
+	Kubernetes time.Duration
+}
+
+// DefaultPhaseTimeouts returns the timeouts used unless overridden from the environment
+func DefaultPhaseTimeouts() PhaseTimeouts {
+	return PhaseTimeouts{
+		Auth:       30 * time.Second,
+		CloudAPI:   30 * time.Second,
+		Kubernetes: 20 * time.Second,
+	}
+}
+
+// phaseTimeouts are the process-wide timeouts, installed with ConfigurePhaseTimeouts
+var phaseTimeouts = DefaultPhaseTimeouts()
+
+// ConfigurePhaseTimeouts replaces the process-wide phase timeouts
+func ConfigurePhaseTimeouts(timeouts PhaseTimeouts) {
+	phaseTimeouts = timeouts
+}
+
+// PhaseTimeoutsFromEnv reads AUTH_TIMEOUT, CLOUD_API_TIMEOUT and K8S_TIMEOUT (Go durations
+// such as 30s), falling back to the defaults for unset variables
+func PhaseTimeoutsFromEnv() (PhaseTimeouts, error) {
+	timeouts := DefaultPhaseTimeouts()
+	for name, timeout := range map[string]*time.Duration{
+		"AUTH_TIMEOUT":      &timeouts.Auth,
+		"CLOUD_API_TIMEOUT": &timeouts.CloudAPI,
+		"K8S_TIMEOUT":       &timeouts.Kubernetes,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return PhaseTimeouts{}, fmt.Errorf("invalid %s %q: must be a non-negative duration such as 30s", name, value)
+		}
+		*timeout = parsed
+	}
+	return timeouts, nil
+}
+
+// timeout returns the budget of phase
+func (t PhaseTimeouts) timeout(phase Phase) time.Duration {
+	switch phase {
+	case PhaseAuth:
+		return t.Auth
+	case PhaseCloudAPI:
+		return t.CloudAPI
+	case PhaseKubernetes:
+		return t.Kubernetes
+	default:
+		return 0
+	}
+}
+
+// PhaseTimeoutError reports that a phase ran out of its time budget
+type PhaseTimeoutError struct {
+	Phase   Phase
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *PhaseTimeoutError) Error() string {
+	return fmt.Sprintf("%s phase timed out after %s: %v", e.Phase, e.Timeout, e.Err)
+}
+
+func (e *PhaseTimeoutError) Unwrap() error { return e.Err }
+
+// withPhaseTimeout derives a context bounded by phase's timeout
+func withPhaseTimeout(ctx context.Context, phase Phase) (context.Context, context.CancelFunc) {
+	timeout := phaseTimeouts.timeout(phase)
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// phaseTimeoutError attributes err to phase when it was caused by ctx, created by
+// withPhaseTimeout, running out of time; other errors are returned unchanged
+func phaseTimeoutError(ctx context.Context, phase Phase, err error) error {
+	var already *PhaseTimeoutError
+	if err == nil || errors.As(err, &already) || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return &PhaseTimeoutError{Phase: phase, Timeout: phaseTimeouts.timeout(phase), Err: err}
+}
+
+// runPhase runs fn within phase's timeout. fn is abandoned when the timeout passes, so calls
+// that ignore their context (such as oauth2 token sources) still fail on time.
+func runPhase(ctx context.Context, phase Phase, fn func(ctx context.Context) error) error {
+	ctx, cancel := withPhaseTimeout(ctx, phase)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+
+	select {
+	case err := <-done:
+		return phaseTimeoutError(ctx, phase, err)
+	case <-ctx.Done():
+		return phaseTimeoutError(ctx, phase, ctx.Err())
+	}
+}
+
+// azureTimeoutPolicy is an azcore pipeline policy bounding each ARM call, retries included,
+// by the cloud API timeout
+type azureTimeoutPolicy struct{}
+
+// Do sends the request with the cloud API deadline applied
+func (azureTimeoutPolicy) Do(req *policy.Request) (*http.Response, error) {
+	ctx, cancel := withPhaseTimeout(req.Raw().Context(), PhaseCloudAPI)
+	defer cancel()
+	resp, err := req.WithContext(ctx).Next()
+	return resp, phaseTimeoutError(ctx, PhaseCloudAPI, err)
+}
+
+// gcpTimeoutOptions returns client options bounding each gRPC call to the GKE API by the
+// cloud API timeout
+func gcpTimeoutOptions() []option.ClientOption {
+	interceptor := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, cancel := withPhaseTimeout(ctx, PhaseCloudAPI)
+		defer cancel()
+		return phaseTimeoutError(ctx, PhaseCloudAPI, invoker(ctx, method, req, reply, cc, opts...))
+	}
+	return []option.ClientOption{option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(interceptor))}
+}
+
+// awsTimeoutMiddleware adds a step to an AWS SDK operation stack bounding the operation,
+// retries included, by the cloud API timeout
+func awsTimeoutMiddleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("PhaseTimeout",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			ctx, cancel := withPhaseTimeout(ctx, PhaseCloudAPI)
+			defer cancel()
+			out, metadata, err := next.HandleInitialize(ctx, in)
+			return out, metadata, phaseTimeoutError(ctx, PhaseCloudAPI, err)
+		}), middleware.Before)
+}
+
+// applyKubernetesTimeout bounds each request to the Kubernetes API server, including reading
+// the response body, by the Kubernetes API timeout
+func applyKubernetesTimeout(config *rest.Config) {
+	timeout := phaseTimeouts.Kubernetes
+	if timeout <= 0 {
+		return
+	}
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &kubernetesTimeoutTransport{next: rt, timeout: timeout}
+	})
+}
+
+// kubernetesTimeoutTransport applies the Kubernetes API timeout to each request
+type kubernetesTimeoutTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+// RoundTrip sends req with the timeout applied; the deadline is released once the response
+// body is closed
+func (t *kubernetesTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && req.Context().Err() == nil {
+			return nil, &PhaseTimeoutError{Phase: PhaseKubernetes, Timeout: t.timeout, Err: err}
+		}
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases a request's context when its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
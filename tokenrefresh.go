@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"k8s.io/client-go/rest"
+)
+
+// tokenRefresher mints a new bearer token for the Kubernetes API server
+type tokenRefresher func(ctx context.Context) (string, error)
+
+// applyTokenRefresh makes requests rejected with 401 Unauthorized retry once with a token
+// minted by refresh, so tokens that expired between connecting and use are replaced
+// transparently. Apply it after applyKubernetesTimeout so each attempt gets its own timeout.
+func applyTokenRefresh(config *rest.Config, refresh tokenRefresher) {
+	token := &refreshingToken{token: config.BearerToken, refresh: refresh}
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &tokenRefreshTransport{next: rt, token: token}
+	})
+}
+
+// refreshingToken is the bearer token shared by all requests of a client
+type refreshingToken struct {
+	mu      sync.Mutex
+	token   string
+	refresh tokenRefresher
+}
+
+// current returns the token to send
+func (t *refreshingToken) current() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.token
+}
+
+// renew replaces rejected with a fresh token, failing when refresh returns rejected itself.
+// Concurrent requests rejected with the same token share a single refresh.
+func (t *refreshingToken) renew(ctx context.Context, rejected string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != rejected {
+		return t.token, nil
+	}
+
+	token, err := t.refresh(ctx)
+	if err != nil {
+		return "", err
+	}
+	if token == rejected {
+		// Credentials that cache tokens until they expire, such as azidentity's, hand back the
+		// rejected token while it is still valid; resending it would only fail again
+		return "", errors.New("the credential returned the rejected token again")
+	}
+	t.token = token
+	return token, nil
+}
+
+// tokenRefreshTransport sends the current token and retries once with a fresh one on 401
+type tokenRefreshTransport struct {
+	next  http.RoundTripper
+	token *refreshingToken
+}
+
+// RoundTrip sends req, refreshing the token and resending it once if it is rejected
+func (t *tokenRefreshTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token := t.token.current()
+	resp, err := t.next.RoundTrip(withBearerToken(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	// A request whose body has been consumed cannot be resent
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	fresh, err := t.token.renew(req.Context(), token)
+	if err != nil {
+		Verbosef("Failed to refresh the Kubernetes API token after 401 Unauthorized: %v", err)
+		return resp, nil
+	}
+	Verbosef("Kubernetes API returned 401 Unauthorized; retrying with a refreshed token")
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	retry := withBearerToken(req, fresh)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	return t.next.RoundTrip(retry)
+}
+
+// withBearerToken returns a copy of req authenticated with token
+func withBearerToken(req *http.Request, token string) *http.Request {
+	authed := req.Clone(req.Context())
+	authed.Header.Set("Authorization", "Bearer "+token)
+	return authed
+}
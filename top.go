@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+const metricsAPIGroupVersion = "metrics.k8s.io/v1beta1"
+
+// ErrMetricsUnavailable is returned when the cluster does not serve the metrics.k8s.io API
+var ErrMetricsUnavailable = errors.New("metrics API (metrics.k8s.io) is not available on this cluster; install metrics-server to enable resource usage reporting")
+
+// NodeUsage is the current CPU and memory usage of a node
+type NodeUsage struct {
+	Name          string
+	CPU           resource.Quantity
+	Memory        resource.Quantity
+	CPUPercent    float64 // of allocatable CPU
+	MemoryPercent float64 // of allocatable memory
+}
+
+// PodUsage is the current CPU and memory usage of a pod, summed over its containers
+type PodUsage struct {
+	Namespace string
+	Name      string
+	CPU       resource.Quantity
+	Memory    resource.Quantity
+}
+
+// metricsAPIAvailable reports whether the metrics.k8s.io group is served by the cluster
+func metricsAPIAvailable(client discovery.DiscoveryInterface) (bool, error) {
+	_, err := client.ServerResourcesForGroupVersion(metricsAPIGroupVersion)
+	if err == nil {
+		return true, nil
+	}
+	if apierrors.IsNotFound(err) || apierrors.IsServiceUnavailable(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to discover metrics API: %w", err)
+}
+
+// newMetricsClient creates a metrics.k8s.io client, returning ErrMetricsUnavailable when
+// metrics-server (or another metrics API provider) is not installed
+func newMetricsClient(client ClusterClient) (*metricsclient.Clientset, error) {
+	available, err := metricsAPIAvailable(client.Discovery())
+	if err != nil {
+		return nil, err
+	}
+	if !available {
+		return nil, ErrMetricsUnavailable
+	}
+
+	metrics, err := metricsclient.NewForConfig(client.RESTConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metrics client: %w", err)
+	}
+
+	return metrics, nil
+}
+
+// TopNodes returns the resource usage of every node, sorted by CPU usage
+func TopNodes(ctx context.Context, client ClusterClient) ([]NodeUsage, error) {
+	metrics, err := newMetricsClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeMetrics, err := metrics.MetricsV1beta1().NodeMetricses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if apierrors.IsServiceUnavailable(err) || apierrors.IsNotFound(err) {
+			return nil, ErrMetricsUnavailable
+		}
+		return nil, fmt.Errorf("failed to get node metrics: %w", err)
+	}
+
+	nodes, err := ListNodesPaged(ctx, client.Clientset(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	allocatable := make(map[string]NodeUsage, len(nodes))
+	for _, node := range nodes {
+		allocatable[node.Name] = NodeUsage{
+			CPU:    *node.Status.Allocatable.Cpu(),
+			Memory: *node.Status.Allocatable.Memory(),
+		}
+	}
+
+	usages := make([]NodeUsage, 0, len(nodeMetrics.Items))
+	for _, m := range nodeMetrics.Items {
+		usage := NodeUsage{
+			Name:   m.Name,
+			CPU:    *m.Usage.Cpu(),
+			Memory: *m.Usage.Memory(),
+		}
+		if alloc, ok := allocatable[m.Name]; ok {
+			usage.CPUPercent = percentOf(usage.CPU.MilliValue(), alloc.CPU.MilliValue())
+			usage.MemoryPercent = percentOf(usage.Memory.Value(), alloc.Memory.Value())
+		}
+		usages = append(usages, usage)
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].CPU.Cmp(usages[j].CPU) > 0
+	})
+
+	return usages, nil
+}
+
+// TopPods returns the resource usage of the pods in namespace (all namespaces when empty),
+// sorted by CPU usage
+func TopPods(ctx context.Context, client ClusterClient, namespace string) ([]PodUsage, error) {
+	metrics, err := newMetricsClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	podMetrics, err := metrics.MetricsV1beta1().PodMetricses(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if apierrors.IsServiceUnavailable(err) || apierrors.IsNotFound(err) {
+			return nil, ErrMetricsUnavailable
+		}
+		return nil, fmt.Errorf("failed to get pod metrics: %w", err)
+	}
+
+	usages := make([]PodUsage, 0, len(podMetrics.Items))
+	for _, m := range podMetrics.Items {
+		usage := PodUsage{Namespace: m.Namespace, Name: m.Name}
+		for _, container := range m.Containers {
+			usage.CPU.Add(*container.Usage.Cpu())
+			usage.Memory.Add(*container.Usage.Memory())
+		}
+		usages = append(usages, usage)
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].CPU.Cmp(usages[j].CPU) > 0
+	})
+
+	return usages, nil
+}
+
+// PrintNodeUsage prints node usage in a kubectl top style table
+func PrintNodeUsage(usages []NodeUsage) {
+	fmt.Printf("%-45s %10s %6s %12s %8s\n", "NAME", "CPU(cores)", "CPU%", "MEMORY(bytes)", "MEMORY%")
+	for _, u := range usages {
+		fmt.Printf("%-45s %9dm %5.0f%% %11dMi %7.0f%%\n",
+			u.Name, u.CPU.MilliValue(), u.CPUPercent, u.Memory.Value()/(1024*1024), u.MemoryPercent)
+	}
+}
+
+// PrintPodUsage prints pod usage in a kubectl top style table
+func PrintPodUsage(usages []PodUsage) {
+	fmt.Printf("%-20s %-50s %10s %14s\n", "NAMESPACE", "NAME", "CPU(cores)", "MEMORY(bytes)")
+	for _, u := range usages {
+		fmt.Printf("%-20s %-50s %9dm %13dMi\n",
+			u.Namespace, u.Name, u.CPU.MilliValue(), u.Memory.Value()/(1024*1024))
+	}
+}
+
+// percentOf returns value as a percentage of total
+func percentOf(value, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(value) / float64(total) * 100
+}
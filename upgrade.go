@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// UpgradeResult is the control plane version of a cluster before and after an upgrade
+type UpgradeResult struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Skipped is set when the cluster already ran the target version
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// controlPlaneUpgrader is implemented by clients that can upgrade their cluster's control plane.
+// UpgradeControlPlane returns once the provider reports the upgrade finished; node pools keep
+// their version.
+type controlPlaneUpgrader interface {
+	UpgradeControlPlane(ctx context.Context, target string) error
+}
+
+// UpgradeControlPlane upgrades the control plane of client's cluster to target, a minor release
+// such as 1.32 or a patch release where the provider accepts one. Clusters already running
+// target are left alone, and targets more than one minor release ahead are refused as no
+// provider can upgrade across them.
+func UpgradeControlPlane(ctx context.Context, client ClusterClient, target string) (*UpgradeResult, error) {
+	upgrader, ok := client.(controlPlaneUpgrader)
+	if !ok {
+		return nil, fmt.Errorf("%s clients cannot upgrade clusters", client.Identity().Provider)
+	}
+	targetVersion, err := version.ParseGeneric(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target version %q: %w", target, err)
+	}
+
+	info, err := client.GetClusterInfo()
+	if err != nil {
+		return nil, err
+	}
+	current, err := version.ParseGeneric(info.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cluster version %q: %w", info.Version, err)
+	}
+
+	result := &UpgradeResult{From: info.Version, To: target}
+	currentMinor := version.MajorMinor(current.Major(), current.Minor())
+	targetMinor := version.MajorMinor(targetVersion.Major(), targetVersion.Minor())
+	switch {
+	case current.AtLeast(targetVersion) || (len(targetVersion.Components()) == 2 && currentMinor.AtLeast(targetMinor)):
+		result.Skipped = true
+		Infof("Cluster %s already runs %s", client.Identity().Name, info.Version)
+		return result, nil
+	case targetMinor.GreaterThan(version.MajorMinor(current.Major(), current.Minor()+1)):
+		return nil, fmt.Errorf("cannot upgrade from %s to %s, upgrade one minor release at a time", info.Version, target)
+	}
+
+	step := progress.Start(fmt.Sprintf("Upgrading control plane of %s from %s to %s", client.Identity().Name, info.Version, target))
+	defer step.Done()
+	if err := upgrader.UpgradeControlPlane(ctx, target); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
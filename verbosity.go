@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// Verbosity controls how much progress output is printed around a command's result
+type Verbosity int
+
+const (
+	// VerbosityQuiet prints only the final result and errors, for cron and CI
+	VerbosityQuiet Verbosity = iota - 1
+	// VerbosityNormal prints connection progress (default)
+	VerbosityNormal
+	// VerbosityVerbose (-v) adds credential, endpoint and timing details
+	VerbosityVerbose
+	// VerbosityDebug (-vv) also logs every Kubernetes API request
+	VerbosityDebug
+)
+
+// debugKlogLevel is the client-go log level used at VerbosityDebug: request URLs, status
+// codes and latencies, without headers or bodies
+const debugKlogLevel = 6
+
+var (
+	verbosity             = VerbosityNormal
+	progressOut io.Writer = os.Stdout
+)
+
+// SetVerbosity sets the process-wide verbosity and configures client-go logging to match
+func SetVerbosity(v Verbosity) {
+	verbosity = v
+
+	level := 0
+	if v >= VerbosityDebug {
+		level = debugKlogLevel
+	}
+	fs := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(fs)
+	_ = fs.Set("v", strconv.Itoa(level))
+	_ = fs.Set("logtostderr", "false")
+	klog.SetOutput(NewRedactingWriter(os.Stderr))
+}
+
+// ParseGlobalFlags removes the global verbosity flags (-v, -vv, --verbose, -q, --quiet) from
+// args, wherever they appear before a "--", and returns the remaining arguments
+func ParseGlobalFlags(args []string) ([]string, Verbosity, error) {
+	level := VerbosityNormal
+	quiet := false
+	var rest []string
+	for i, arg := range args {
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		switch {
+		case arg == "-q" || arg == "--quiet" || arg == "-quiet":
+			quiet = true
+		case arg == "--verbose" || arg == "-verbose":
+			level++
+		case len(arg) > 1 && strings.Trim(arg, "v") == "-":
+			level += Verbosity(len(arg) - 1)
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	if quiet {
+		if level > VerbosityNormal {
+			return nil, 0, fmt.Errorf("--quiet and -v are mutually exclusive")
+		}
+		level = VerbosityQuiet
+	}
+	if level > VerbosityDebug {
+		level = VerbosityDebug
+	}
+	return rest, level, nil
+}
+
+// stripGlobalFlags removes the global flags named in flags from args, wherever they appear
+// before a "--", and returns the remaining arguments. Each is accepted as -name or --name. A
+// flag mapped to true needs a value, given as --name=value or --name value; the others take an
+// optional --name=value only, like the flag package's boolean flags, so a following argument
+// is never consumed. visit is called for every occurrence in order.
+func stripGlobalFlags(args []string, flags map[string]bool, visit func(name, value string, hasValue bool) error) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-"), "=")
+		needsValue, ok := flags[name]
+		if !ok || !strings.HasPrefix(arg, "-") {
+			rest = append(rest, arg)
+			continue
+		}
+		if needsValue && !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("flag --%s needs a value", name)
+			}
+			i++
+			value, hasValue = args[i], true
+		}
+		if err := visit(name, value, hasValue); err != nil {
+			return nil, err
+		}
+	}
+	return rest, nil
+}
+
+// Infof prints progress output such as connection steps; it is suppressed by --quiet
+func Infof(format string, args ...interface{}) {
+	printAt(VerbosityNormal, format, args...)
+}
+
+// Verbosef prints details only shown with -v
+func Verbosef(format string, args ...interface{}) {
+	printAt(VerbosityVerbose, format, args...)
+}
+
+// Debugf prints details only shown with -vv
+func Debugf(format string, args ...interface{}) {
+	printAt(VerbosityDebug, format, args...)
+}
+
+// Warnf prints a warning prefixed with ⚠. Warnings are not decorative, so with --quiet they
+// go to stderr instead of being dropped.
+func Warnf(format string, args ...interface{}) {
+	out := progressOut
+	if verbosity == VerbosityQuiet {
+		out = os.Stderr
+	}
+	clearProgress()
+	fmt.Fprint(out, Redact("⚠ "+fmt.Sprintf(format, args...)+"\n"))
+}
+
+// printAt prints a redacted, newline-terminated message when the verbosity is at least level
+func printAt(level Verbosity, format string, args ...interface{}) {
+	if verbosity < level {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+	clearProgress()
+	fmt.Fprint(progressOut, Redact(message))
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// VersionPolicy constrains the Kubernetes version and release channel of the fleet clusters it
+// selects, e.g. "all prod clusters run 1.29 or later"
+type VersionPolicy struct {
+	Name string `json:"name"`
+	// Selector matches the clusters' cloud tags/labels, as --selector does; empty selects all
+	Selector  string     `json:"selector,omitempty"`
+	Providers []Provider `json:"providers,omitempty"` // empty selects every provider
+
+	MinVersion string `json:"minVersion,omitempty"` // e.g. 1.29 or 1.29.8
+	MaxVersion string `json:"maxVersion,omitempty"` // a minor release allows all its patches
+	// ForbiddenChannels are release channels clusters must not be on, such as RAPID for GKE,
+	// none for a GKE static version or an AKS cluster without auto-upgrade, or EXTENDED for
+	// the EKS support type
+	ForbiddenChannels []string `json:"forbiddenChannels,omitempty"`
+	// RequireStandardSupport fails EKS clusters whose version is past the end of standard support
+	RequireStandardSupport bool `json:"requireStandardSupport,omitempty"`
+
+	selector labels.Selector
+}
+
+// Validate checks the policy's selector and versions
+func (p *VersionPolicy) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	selector, err := ParseClusterSelector(p.Selector)
+	if err != nil {
+		return err
+	}
+	p.selector = selector
+	for _, provider := range p.Providers {
+		if _, err := parseProvider(string(provider)); err != nil {
+			return err
+		}
+	}
+
+	var minVersion, maxVersion *version.Version
+	if p.MinVersion != "" {
+		if minVersion, err = version.ParseGeneric(p.MinVersion); err != nil {
+			return fmt.Errorf("invalid minVersion %q: %w", p.MinVersion, err)
+		}
+	}
+	if p.MaxVersion != "" {
+		if maxVersion, err = version.ParseGeneric(p.MaxVersion); err != nil {
+			return fmt.Errorf("invalid maxVersion %q: %w", p.MaxVersion, err)
+		}
+	}
+	if minVersion != nil && maxVersion != nil && minVersion.GreaterThan(maxVersion) {
+		return fmt.Errorf("minVersion %s is above maxVersion %s", p.MinVersion, p.MaxVersion)
+	}
+	for _, channel := range p.ForbiddenChannels {
+		if strings.TrimSpace(channel) == "" {
+			return fmt.Errorf("forbiddenChannels must not contain empty entries")
+		}
+	}
+	if p.MinVersion == "" && p.MaxVersion == "" && len(p.ForbiddenChannels) == 0 && !p.RequireStandardSupport {
+		return fmt.Errorf("policy %q has no constraints", p.Name)
+	}
+	return nil
+}
+
+// Applies reports whether the policy selects the cluster described by info
+func (p *VersionPolicy) Applies(info *ClusterInfo) bool {
+	if len(p.Providers) > 0 {
+		matched := false
+		for _, provider := range p.Providers {
+			matched = matched || provider == info.Provider
+		}
+		if !matched {
+			return false
+		}
+	}
+	if p.selector == nil || p.selector.Empty() {
+		return true
+	}
+	return p.selector.Matches(labels.Set(info.Tags))
+}
+
+// Violations returns how the cluster described by info breaks the policy, one line per
+// constraint
+func (p *VersionPolicy) Violations(info *ClusterInfo, now time.Time) []string {
+	var violations []string
+	if p.MinVersion != "" || p.MaxVersion != "" {
+		current, err := version.ParseGeneric(info.Version)
+		if err != nil {
+			return []string{fmt.Sprintf("cannot evaluate version %q: %v", info.Version, err)}
+		}
+		if p.MinVersion != "" && !current.AtLeast(version.MustParseGeneric(p.MinVersion)) {
+			violations = append(violations, fmt.Sprintf("version %s is below the minimum %s", info.Version, p.MinVersion))
+		}
+		if p.MaxVersion != "" {
+			maxVersion := version.MustParseGeneric(p.MaxVersion)
+			if len(maxVersion.Components()) == 2 {
+				current = version.MajorMinor(current.Major(), current.Minor())
+			}
+			if current.GreaterThan(maxVersion) {
+				violations = append(violations, fmt.Sprintf("version %s is above the maximum %s", info.Version, p.MaxVersion))
+			}
+		}
+	}
+
+	if channel := info.ReleaseChannel; channel != "" {
+		for _, forbidden := range p.ForbiddenChannels {
+			if strings.EqualFold(channel, strings.TrimSpace(forbidden)) {
+				violations = append(violations, fmt.Sprintf("release channel %s is forbidden", channel))
+			}
+		}
+	}
+
+	if p.RequireStandardSupport {
+		if ends, err := time.Parse("2006-01-02", info.Details["Standard Support Ends"]); err == nil && now.After(ends) {
+			violations = append(violations, fmt.Sprintf("version %s left standard support on %s", info.Version, info.Details["Standard Support Ends"]))
+		}
+	}
+	return violations
+}
+
+// CheckVersionPolicies evaluates the version policies that select the client's cluster and
+// fails on any violation. It warns when a selected cluster's version nears or is past the end
+// of its provider's support without violating a policy.
+func CheckVersionPolicies(ctx context.Context, client ClusterClient, policies []VersionPolicy) CheckResult {
+	result := CheckResult{Name: "version-policy"}
+	if len(policies) == 0 {
+		result.Status = CheckPass
+		result.Message = "no version policies configured"
+		return result
+	}
+
+	info, err := client.GetClusterInfo()
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("failed to get cluster info: %v", err)
+		return result
+	}
+
+	applied := 0
+	now := time.Now()
+	for i := range policies {
+		policy := &policies[i]
+		if !policy.Applies(info) {
+			continue
+		}
+		applied++
+		for _, violation := range policy.Violations(info, now) {
+			result.Details = append(result.Details, fmt.Sprintf("%s: %s", policy.Name, violation))
+		}
+	}
+
+	switch {
+	case len(result.Details) > 0:
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%d violation(s) of %d applicable version policy(ies)", len(result.Details), applied)
+	case applied == 0:
+		result.Status = CheckPass
+		result.Message = "no version policy selects this cluster"
+	case len(info.Warnings) > 0:
+		result.Status = CheckWarn
+		result.Message = fmt.Sprintf("version %s satisfies %d version policy(ies) but nears end of support", info.Version, applied)
+		for _, warning := range info.Warnings {
+			result.Details = append(result.Details, "⚠ "+warning)
+		}
+	default:
+		result.Status = CheckPass
+		result.Message = fmt.Sprintf("version %s satisfies %d version policy(ies)", info.Version, applied)
+	}
+	return result
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultWaitForReady is how long --wait-for-ready without a value waits for a cluster
+	DefaultWaitForReady = 20 * time.Minute
+
+	waitForReadyInitialBackoff = 5 * time.Second
+	waitForReadyMaxBackoff     = time.Minute
+)
+
+// waitForReady is the process-wide wait for clusters still being created or updated, installed
+// with ConfigureWaitForReady and applied by the clients created from the environment
+var waitForReady time.Duration
+
+// ConfigureWaitForReady sets how long clients created from the environment wait for a cluster in
+// a transitional state to become ready; zero fails immediately
+func ConfigureWaitForReady(wait time.Duration) {
+	waitForReady = wait
+}
+
+// ParseWaitForReadyFlag strips --wait-for-ready[=duration] from args, falling back to the
+// WAIT_FOR_READY environment variable when the flag is absent
+func ParseWaitForReadyFlag(args []string) ([]string, time.Duration, error) {
+	var wait time.Duration
+	set := false
+	rest, err := stripGlobalFlags(args, map[string]bool{"wait-for-ready": false}, func(_, value string, hasValue bool) error {
+		set = true
+		if !hasValue {
+			wait = DefaultWaitForReady
+			return nil
+		}
+		parsed, err := parseWaitForReady(value)
+		if err != nil {
+			return fmt.Errorf("invalid --wait-for-ready: %w", err)
+		}
+		wait = parsed
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !set {
+		if value := os.Getenv("WAIT_FOR_READY"); value != "" {
+			parsed, err := parseWaitForReady(value)
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid WAIT_FOR_READY: %w", err)
+			}
+			wait = parsed
+		}
+	}
+	return rest, wait, nil
+}
+
+// parseWaitForReady parses a non-negative Go duration such as 20m
+func parseWaitForReady(value string) (time.Duration, error) {
+	wait, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if wait < 0 {
+		return 0, fmt.Errorf("%q is negative", value)
+	}
+	return wait, nil
+}
+
+// clusterState is what pollClusterReady needs to know about one observation of a cluster
+type clusterState struct {
+	// Status is the provider's status, e.g. CREATING or RUNNING
+	Status string
+	// Ready reports whether the cluster can be connected to
+	Ready bool
+	// Transitional reports whether the cluster is expected to become ready on its own, e.g.
+	// while it is being created or upgraded
+	Transitional bool
+}
+
+// pollClusterReady calls observe until it reports the cluster ready, backing off from 5s up to a
+// minute while the cluster is in a transitional state for at most wait. Clusters in any other
+// state, or still transitional once wait has passed, fail with an error naming their status.
+func pollClusterReady(ctx context.Context, provider Provider, name string, wait time.Duration, observe func(context.Context) (clusterState, error)) error {
+	deadline := time.Now().Add(wait)
+	backoff := waitForReadyInitialBackoff
+	for {
+		state, err := observe(ctx)
+		if err != nil {
+			return err
+		}
+		if state.Ready {
+			return nil
+		}
+		if !state.Transitional || wait <= 0 {
+			return fmt.Errorf("cluster %s is not ready, current status: %s", name, state.Status)
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("cluster %s did not become ready within %s, current status: %s", name, wait, state.Status)
+		}
+		delay := min(backoff, remaining)
+		Infof("%s cluster %s is %s, checking again in %s...", strings.ToUpper(string(provider)), name, state.Status, delay.Round(time.Second))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("stopped waiting for cluster %s, current status: %s: %w", name, state.Status, ctx.Err())
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, waitForReadyMaxBackoff)
+	}
+}
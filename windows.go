@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DefaultWindowsProbeImage is a multi-OS image with Windows Server 2019 and 2022 variants, so
+	// it runs on any Windows node without matching the host build
+	DefaultWindowsProbeImage = "registry.k8s.io/pause:3.10"
+	// windowsBuildLabel is the Windows build of a node, e.g. 10.0.20348
+	windowsBuildLabel = "node.kubernetes.io/windows-build"
+)
+
+// WindowsProbeOptions configures the pod windows-probe schedules onto a Windows node
+type WindowsProbeOptions struct {
+	Image     string
+	Namespace string
+	Timeout   time.Duration
+}
+
+// WindowsNodePool is a node pool of Windows nodes and how many of them are Ready
+type WindowsNodePool struct {
+	Pool     string   `json:"pool"`
+	Nodes    int      `json:"nodes"`
+	Ready    int      `json:"ready"`
+	OSImages []string `json:"osImages"` // e.g. "Windows Server 2022 Datacenter (10.0.20348)"
+	Runtimes []string `json:"runtimes"`
+	NotReady []string `json:"notReady,omitempty"`
+}
+
+// DiscoverWindowsNodePools groups the cluster's Windows nodes by pool, from the kubernetes.io/os
+// label every provider sets
+func DiscoverWindowsNodePools(ctx context.Context, clientset kubernetes.Interface) ([]WindowsNodePool, error) {
+	pools := map[string]*WindowsNodePool{}
+	images := map[string]map[string]bool{}
+	runtimes := map[string]map[string]bool{}
+	err := EachNode(ctx, clientset, metav1.ListOptions{LabelSelector: corev1.LabelOSStable + "=windows"}, func(node *corev1.Node) error {
+		name := nodePoolName(node)
+		pool, ok := pools[name]
+		if !ok {
+			pool = &WindowsNodePool{Pool: name}
+			pools[name] = pool
+			images[name], runtimes[name] = map[string]bool{}, map[string]bool{}
+		}
+		pool.Nodes++
+		if nodeReady(*node) {
+			pool.Ready++
+		} else {
+			pool.NotReady = append(pool.NotReady, node.Name)
+		}
+
+		image := node.Status.NodeInfo.OSImage
+		if build := node.Labels[windowsBuildLabel]; build != "" {
+			image += " (" + build + ")"
+		}
+		images[name][image] = true
+		runtimes[name][node.Status.NodeInfo.ContainerRuntimeVersion] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]WindowsNodePool, 0, len(pools))
+	for name, pool := range pools {
+		pool.OSImages = sortedSet(images[name])
+		pool.Runtimes = sortedSet(runtimes[name])
+		sort.Strings(pool.NotReady)
+		result = append(result, *pool)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Pool < result[j].Pool })
+	return result, nil
+}
+
+// CheckWindowsNodes lists the Windows node pools with their OS image and container runtime, and
+// fails when a Windows node is not Ready. Clusters without Windows nodes pass.
+func CheckWindowsNodes(ctx context.Context, client ClusterClient) CheckResult {
+	result := CheckResult{Name: "windows-nodes"}
+
+	pools, err := DiscoverWindowsNodePools(ctx, client.Clientset())
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+	if len(pools) == 0 {
+		result.Status = CheckPass
+		result.Message = "no Windows node pools"
+		return result
+	}
+
+	nodes, notReady := 0, 0
+	for _, pool := range pools {
+		nodes += pool.Nodes
+		notReady += len(pool.NotReady)
+		mark := "✓"
+		if len(pool.NotReady) > 0 {
+			mark = "✗"
+		}
+		result.Details = append(result.Details, fmt.Sprintf("%s %s: %d/%d Ready, %s, %s", mark, pool.Pool, pool.Ready, pool.Nodes,
+			strings.Join(pool.OSImages, ", "), strings.Join(pool.Runtimes, ", ")))
+		if len(pool.NotReady) > 0 {
+			result.Details = append(result.Details, fmt.Sprintf("    not Ready: %s", strings.Join(pool.NotReady, ", ")))
+		}
+	}
+
+	if notReady > 0 {
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%d of %d Windows node(s) not Ready", notReady, nodes)
+		return result
+	}
+	result.Status = CheckPass
+	result.Message = fmt.Sprintf("%d Windows node(s) Ready in %d pool(s)", nodes, len(pools))
+	return result
+}
+
+// RunWindowsProbe schedules a pod onto a Windows node and waits for it to run and get an IP,
+// verifying scheduling, the Windows container runtime and pod networking. GKE taints Windows
+// nodes with node.kubernetes.io/os=windows, which the pod tolerates. The pod is always deleted
+// afterwards.
+func RunWindowsProbe(ctx context.Context, clientset kubernetes.Interface, opts WindowsProbeOptions) (string, error) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "connect-k8s-windows-probe-",
+			Namespace:    opts.Namespace,
+			Labels:       map[string]string{"app.kubernetes.io/managed-by": "connect-managed-k8s"},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:         corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds: int64Ptr(int64(opts.Timeout.Seconds())),
+			NodeSelector:          map[string]string{corev1.LabelOSStable: "windows"},
+			Tolerations: []corev1.Toleration{{
+				Key:      "node.kubernetes.io/os",
+				Operator: corev1.TolerationOpEqual,
+				Value:    "windows",
+				Effect:   corev1.TaintEffectNoSchedule,
+			}},
+			Containers: []corev1.Container{{Name: "probe", Image: opts.Image}},
+		},
+	}
+
+	created, err := clientset.CoreV1().Pods(opts.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to create probe pod: %w", err)
+	}
+	defer deleteProbePod(clientset, created.Namespace, created.Name)
+
+	start := time.Now()
+	ip, err := waitForPodIP(ctx, clientset, created.Namespace, created.Name, opts.Timeout)
+	if err != nil {
+		return "", err
+	}
+	running, err := clientset.CoreV1().Pods(created.Namespace).Get(ctx, created.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get probe pod: %w", err)
+	}
+	return fmt.Sprintf("pod ran on %s with IP %s after %s", running.Spec.NodeName, ip, time.Since(start).Round(time.Second)), nil
+}
+
+// CheckWindowsProbe runs the Windows scheduling probe on clusters with Windows nodes
+func CheckWindowsProbe(ctx context.Context, client ClusterClient, opts WindowsProbeOptions) CheckResult {
+	result := CheckResult{Name: "windows-probe"}
+
+	pools, err := DiscoverWindowsNodePools(ctx, client.Clientset())
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+	if len(pools) == 0 {
+		result.Status = CheckPass
+		result.Message = "no Windows node pools to schedule on"
+		return result
+	}
+
+	detail, err := RunWindowsProbe(ctx, client.Clientset(), opts)
+	if err != nil {
+		result.Status = CheckFail
+		result.Message = err.Error()
+		return result
+	}
+	result.Status = CheckPass
+	result.Message = "Windows " + detail
+	return result
+}